@@ -0,0 +1,151 @@
+package ees
+
+// Aggregation 聚合，Source返回对应的JSON DSL
+type Aggregation interface {
+	Source() map[string]interface{}
+}
+
+// BucketAggregation 桶聚合，可以包含子聚合
+type BucketAggregation struct {
+	typ    string
+	params map[string]interface{}
+	subs   map[string]Aggregation
+}
+
+// TermsAgg 按字段的值分桶
+func TermsAgg(field string) *BucketAggregation {
+	return newBucketAggregation("terms", map[string]interface{}{"field": field})
+}
+
+// DateHistogramAgg 按时间间隔分桶，interval为calendar_interval，如1d、1M
+func DateHistogramAgg(field string, interval string) *BucketAggregation {
+	return newBucketAggregation("date_histogram", map[string]interface{}{"field": field, "calendar_interval": interval})
+}
+
+// HistogramAgg 按数值间隔分桶
+func HistogramAgg(field string, interval float64) *BucketAggregation {
+	return newBucketAggregation("histogram", map[string]interface{}{"field": field, "interval": interval})
+}
+
+// NestedAgg nested类型字段的聚合，子聚合中的字段需要带上path前缀
+func NestedAgg(path string) *BucketAggregation {
+	return newBucketAggregation("nested", map[string]interface{}{"path": path})
+}
+
+// FilterAgg 满足条件的文档作为一个桶，复制查询的map，Param不会修改传入的查询
+func FilterAgg(query Query) *BucketAggregation {
+	source := query.Source()
+	params := make(map[string]interface{}, len(source))
+	for k, v := range source {
+		params[k] = v
+	}
+	return newBucketAggregation("filter", params)
+}
+
+func newBucketAggregation(typ string, params map[string]interface{}) *BucketAggregation {
+	return &BucketAggregation{typ: typ, params: params, subs: make(map[string]Aggregation)}
+}
+
+// Size 返回的桶数量，用于terms
+func (a *BucketAggregation) Size(size int) *BucketAggregation {
+	a.params["size"] = size
+	return a
+}
+
+// Order 桶的排序，key为_count、_key或者子聚合名称，用于terms、histogram
+func (a *BucketAggregation) Order(key string, ascending bool) *BucketAggregation {
+	order := "desc"
+	if ascending {
+		order = "asc"
+	}
+	a.params["order"] = map[string]interface{}{key: order}
+	return a
+}
+
+// MinDocCount 桶中最少的文档数量
+func (a *BucketAggregation) MinDocCount(count int) *BucketAggregation {
+	a.params["min_doc_count"] = count
+	return a
+}
+
+// Format 日期格式，用于date_histogram
+func (a *BucketAggregation) Format(format string) *BucketAggregation {
+	a.params["format"] = format
+	return a
+}
+
+// TimeZone 时区，用于date_histogram
+func (a *BucketAggregation) TimeZone(timeZone string) *BucketAggregation {
+	a.params["time_zone"] = timeZone
+	return a
+}
+
+// Param 设置builder没有覆盖的参数
+func (a *BucketAggregation) Param(key string, value interface{}) *BucketAggregation {
+	a.params[key] = value
+	return a
+}
+
+// SubAggregation 子聚合
+func (a *BucketAggregation) SubAggregation(name string, agg Aggregation) *BucketAggregation {
+	a.subs[name] = agg
+	return a
+}
+
+// Source ...
+func (a *BucketAggregation) Source() map[string]interface{} {
+	source := map[string]interface{}{a.typ: a.params}
+	if len(a.subs) > 0 {
+		source["aggs"] = aggregationSources(a.subs)
+	}
+	return source
+}
+
+// metricAggregation 指标聚合
+type metricAggregation struct {
+	typ   string
+	field string
+}
+
+// Source ...
+func (a metricAggregation) Source() map[string]interface{} {
+	return map[string]interface{}{a.typ: map[string]interface{}{"field": a.field}}
+}
+
+// StatsAgg 统计count、min、max、avg、sum
+func StatsAgg(field string) Aggregation {
+	return metricAggregation{typ: "stats", field: field}
+}
+
+// AvgAgg 平均值
+func AvgAgg(field string) Aggregation {
+	return metricAggregation{typ: "avg", field: field}
+}
+
+// SumAgg 求和
+func SumAgg(field string) Aggregation {
+	return metricAggregation{typ: "sum", field: field}
+}
+
+// MinAgg 最小值
+func MinAgg(field string) Aggregation {
+	return metricAggregation{typ: "min", field: field}
+}
+
+// MaxAgg 最大值
+func MaxAgg(field string) Aggregation {
+	return metricAggregation{typ: "max", field: field}
+}
+
+// CardinalityAgg 去重计数
+func CardinalityAgg(field string) Aggregation {
+	return metricAggregation{typ: "cardinality", field: field}
+}
+
+func aggregationSources(aggs map[string]Aggregation) map[string]interface{} {
+	sources := make(map[string]interface{}, len(aggs))
+	for name, agg := range aggs {
+		sources[name] = agg.Source()
+	}
+	return sources
+}
@@ -0,0 +1,204 @@
+package ees
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+// Aggregations 聚合结果，key为聚合名称。
+// 访问方法在聚合不存在或者类型不匹配时返回false，不会panic
+type Aggregations map[string]json.RawMessage
+
+// Bucket 桶聚合结果中的一个桶
+type Bucket struct {
+	Key          interface{} // string或者json.Number
+	KeyAsString  string      // 设置format或者日期类型时的格式化结果
+	DocCount     int64
+	Aggregations Aggregations // 子聚合
+}
+
+// bucketFields 桶中非子聚合的字段
+var bucketFields = map[string]bool{
+	"key":                         true,
+	"key_as_string":               true,
+	"doc_count":                   true,
+	"doc_count_error_upper_bound": true,
+	"from":                        true,
+	"from_as_string":              true,
+	"to":                          true,
+	"to_as_string":                true,
+	"meta":                        true,
+}
+
+// UnmarshalJSON 子聚合与key、doc_count在同一层，需要拆分出来
+func (b *Bucket) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if raw, ok := fields["key"]; ok {
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&b.Key); err != nil {
+			return err
+		}
+	}
+	if raw, ok := fields["key_as_string"]; ok {
+		if err := json.Unmarshal(raw, &b.KeyAsString); err != nil {
+			return err
+		}
+	}
+	if raw, ok := fields["doc_count"]; ok {
+		if err := json.Unmarshal(raw, &b.DocCount); err != nil {
+			return err
+		}
+	}
+	b.Aggregations = make(Aggregations)
+	for k, v := range fields {
+		if !bucketFields[k] {
+			b.Aggregations[k] = v
+		}
+	}
+	return nil
+}
+
+// KeyString 桶的key，优先返回key_as_string
+func (b Bucket) KeyString() string {
+	if b.KeyAsString != "" {
+		return b.KeyAsString
+	}
+	switch key := b.Key.(type) {
+	case string:
+		return key
+	case json.Number:
+		return key.String()
+	}
+	return ""
+}
+
+// KeyInt64 数值类型的key，如long字段的terms、date_histogram的毫秒时间戳
+func (b Bucket) KeyInt64() (int64, bool) {
+	key, ok := b.Key.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	if v, err := key.Int64(); err == nil {
+		return v, true
+	}
+	v, err := key.Float64()
+	return int64(v), err == nil
+}
+
+// KeyFloat64 数值类型的key，如histogram
+func (b Bucket) KeyFloat64() (float64, bool) {
+	key, ok := b.Key.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	v, err := key.Float64()
+	return v, err == nil
+}
+
+// KeyTime date_histogram的key
+func (b Bucket) KeyTime() (time.Time, bool) {
+	ms, ok := b.KeyInt64()
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(ms), true
+}
+
+// TermsResult terms聚合结果
+type TermsResult struct {
+	DocCountErrorUpperBound int64    `json:"doc_count_error_upper_bound"`
+	SumOtherDocCount        int64    `json:"sum_other_doc_count"` // 没有返回的桶中的文档数
+	Buckets                 []Bucket `json:"buckets"`
+}
+
+// StatsResult stats聚合结果，没有文档时Count为0，其他字段为0
+type StatsResult struct {
+	Count int64   `json:"count"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Avg   float64 `json:"avg"`
+	Sum   float64 `json:"sum"`
+}
+
+// SingleBucket nested、filter等单桶聚合结果
+type SingleBucket struct {
+	DocCount     int64
+	Aggregations Aggregations
+}
+
+// Terms terms聚合结果
+func (a Aggregations) Terms(name string) (*TermsResult, bool) {
+	var result TermsResult
+	if !a.decode(name, &result) {
+		return nil, false
+	}
+	return &result, true
+}
+
+// Buckets 多桶聚合的桶，用于terms、histogram、date_histogram等返回buckets数组的聚合
+func (a Aggregations) Buckets(name string) ([]Bucket, bool) {
+	var result struct {
+		Buckets []Bucket `json:"buckets"`
+	}
+	if !a.decode(name, &result) || result.Buckets == nil {
+		return nil, false
+	}
+	return result.Buckets, true
+}
+
+// DateHistogram date_histogram聚合的桶，通过Bucket.KeyTime获取时间
+func (a Aggregations) DateHistogram(name string) ([]Bucket, bool) {
+	return a.Buckets(name)
+}
+
+// Stats stats聚合结果
+func (a Aggregations) Stats(name string) (*StatsResult, bool) {
+	var result StatsResult
+	if !a.decode(name, &result) {
+		return nil, false
+	}
+	return &result, true
+}
+
+// Value avg、sum、min、max、cardinality等单值聚合的结果，没有文档时avg等返回null，此时返回false
+func (a Aggregations) Value(name string) (float64, bool) {
+	var result struct {
+		Value *float64 `json:"value"`
+	}
+	if !a.decode(name, &result) || result.Value == nil {
+		return 0, false
+	}
+	return *result.Value, true
+}
+
+// Single nested、filter等单桶聚合的结果，可以继续访问子聚合
+func (a Aggregations) Single(name string) (*SingleBucket, bool) {
+	var b Bucket
+	if !a.decode(name, &b) {
+		return nil, false
+	}
+	return &SingleBucket{DocCount: b.DocCount, Aggregations: b.Aggregations}, true
+}
+
+// Nested nested聚合的结果
+func (a Aggregations) Nested(name string) (*SingleBucket, bool) {
+	return a.Single(name)
+}
+
+// Filter filter聚合的结果
+func (a Aggregations) Filter(name string) (*SingleBucket, bool) {
+	return a.Single(name)
+}
+
+func (a Aggregations) decode(name string, out interface{}) bool {
+	raw, ok := a[name]
+	if !ok || len(raw) == 0 || string(raw) == "null" {
+		return false
+	}
+	return json.Unmarshal(raw, out) == nil
+}
@@ -0,0 +1,141 @@
+package ees
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucketUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		keyString string
+		keyInt    int64
+		keyIntOk  bool
+		docCount  int64
+		subs      []string
+		wantErr   bool
+	}{
+		{name: "string key", data: `{"key":"a","doc_count":3}`, keyString: "a", docCount: 3, subs: []string{}},
+		{name: "long key", data: `{"key":9007199254740993,"doc_count":1}`, keyString: "9007199254740993", keyInt: 9007199254740993, keyIntOk: true, docCount: 1, subs: []string{}},
+		{name: "float key", data: `{"key":10.0,"doc_count":1}`, keyString: "10.0", keyInt: 10, keyIntOk: true, docCount: 1, subs: []string{}},
+		{name: "key as string", data: `{"key":1633046400000,"key_as_string":"2021-10-01","doc_count":2}`, keyString: "2021-10-01", keyInt: 1633046400000, keyIntOk: true, docCount: 2, subs: []string{}},
+		{name: "sub aggregations", data: `{"key":"a","doc_count":2,"doc_count_error_upper_bound":0,"meta":{},"sum":{"value":3},"tags":{"buckets":[]}}`, keyString: "a", docCount: 2, subs: []string{"sum", "tags"}},
+		{name: "missing fields", data: `{}`, subs: []string{}},
+		{name: "null fields", data: `{"key":null,"key_as_string":null,"doc_count":null}`, subs: []string{}},
+		{name: "range bucket", data: `{"key":"*-10.0","to":10,"to_as_string":"10","doc_count":4}`, keyString: "*-10.0", docCount: 4, subs: []string{}},
+		{name: "not object", data: `[]`, wantErr: true},
+		{name: "invalid doc_count", data: `{"doc_count":"x"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b Bucket
+			err := json.Unmarshal([]byte(tt.data), &b)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.keyString, b.KeyString())
+			keyInt, ok := b.KeyInt64()
+			assert.Equal(t, tt.keyIntOk, ok)
+			assert.Equal(t, tt.keyInt, keyInt)
+			assert.Equal(t, tt.docCount, b.DocCount)
+			subs := make([]string, 0, len(b.Aggregations))
+			for name := range b.Aggregations {
+				subs = append(subs, name)
+			}
+			assert.ElementsMatch(t, tt.subs, subs)
+		})
+	}
+}
+
+func TestBucketKeyTime(t *testing.T) {
+	var b Bucket
+	require.NoError(t, json.Unmarshal([]byte(`{"key":1633046400000,"doc_count":1}`), &b))
+	ts, ok := b.KeyTime()
+	require.True(t, ok)
+	assert.True(t, ts.Equal(time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)))
+	f, ok := b.KeyFloat64()
+	assert.True(t, ok)
+	assert.Equal(t, float64(1633046400000), f)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"key":"a"}`), &b))
+	_, ok = b.KeyTime()
+	assert.False(t, ok)
+	_, ok = b.KeyFloat64()
+	assert.False(t, ok)
+}
+
+func TestAggregationsResult(t *testing.T) {
+	var aggs Aggregations
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"tags": {"doc_count_error_upper_bound":0,"sum_other_doc_count":5,"buckets":[{"key":"a","doc_count":3,"avg":{"value":1.5}},{"key":"b","doc_count":1,"avg":{"value":null}}]},
+		"daily": {"buckets":[{"key_as_string":"2021-10-01","key":1633046400000,"doc_count":2}]},
+		"stats": {"count":2,"min":1,"max":3,"avg":2,"sum":4},
+		"empty_stats": {"count":0,"min":null,"max":null,"avg":null,"sum":0},
+		"avg": {"value":null},
+		"sum": {"value":0},
+		"comments": {"doc_count":4,"authors":{"value":2}},
+		"null": null
+	}`), &aggs))
+
+	terms, ok := aggs.Terms("tags")
+	require.True(t, ok)
+	assert.Equal(t, int64(5), terms.SumOtherDocCount)
+	require.Len(t, terms.Buckets, 2)
+	v, ok := terms.Buckets[0].Aggregations.Value("avg")
+	assert.True(t, ok)
+	assert.Equal(t, 1.5, v)
+	// 桶中没有文档时子聚合为null
+	_, ok = terms.Buckets[1].Aggregations.Value("avg")
+	assert.False(t, ok)
+
+	daily, ok := aggs.DateHistogram("daily")
+	require.True(t, ok)
+	require.Len(t, daily, 1)
+	assert.Equal(t, "2021-10-01", daily[0].KeyString())
+
+	stats, ok := aggs.Stats("stats")
+	require.True(t, ok)
+	assert.Equal(t, StatsResult{Count: 2, Min: 1, Max: 3, Avg: 2, Sum: 4}, *stats)
+	// 没有文档时min、max、avg为null，返回0
+	stats, ok = aggs.Stats("empty_stats")
+	require.True(t, ok)
+	assert.Equal(t, StatsResult{}, *stats)
+
+	_, ok = aggs.Value("avg")
+	assert.False(t, ok)
+	v, ok = aggs.Value("sum")
+	assert.True(t, ok)
+	assert.Zero(t, v)
+
+	comments, ok := aggs.Nested("comments")
+	require.True(t, ok)
+	assert.Equal(t, int64(4), comments.DocCount)
+	v, ok = comments.Aggregations.Value("authors")
+	assert.True(t, ok)
+	assert.Equal(t, float64(2), v)
+
+	// 不存在、null、类型不匹配时返回false
+	for _, name := range []string{"missing", "null"} {
+		_, ok = aggs.Terms(name)
+		assert.False(t, ok, name)
+		_, ok = aggs.Stats(name)
+		assert.False(t, ok, name)
+		_, ok = aggs.Value(name)
+		assert.False(t, ok, name)
+		_, ok = aggs.Filter(name)
+		assert.False(t, ok, name)
+	}
+	_, ok = aggs.Buckets("stats")
+	assert.False(t, ok)
+	_, ok = aggs.Value("tags")
+	assert.False(t, ok)
+	_, ok = aggs.Buckets("avg")
+	assert.False(t, ok)
+}
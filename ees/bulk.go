@@ -0,0 +1,386 @@
+package ees
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+// ErrBulkIndexerClosed 向已经关闭的BulkIndexer添加数据时返回
+var ErrBulkIndexerClosed = errors.New("ees: bulk indexer closed")
+
+// BulkIndexerConfig BulkIndexer配置
+type BulkIndexerConfig struct {
+	Index           string        // 默认的索引，BulkItem中没有设置Index时使用
+	NumWorkers      int           // 并发写入的worker数，默认runtime.NumCPU()
+	FlushBytes      int           // 每个worker缓存的数据超过该大小时写入，默认5MB
+	FlushInterval   time.Duration // 缓存的数据超过该时间没有写入时写入，默认30s
+	MaxRetries      int           // 429或者网络错误时的最大重试次数，默认3，小于0时不重试
+	RetryBackoff    time.Duration // 第一次重试前的等待时间，之后每次翻倍，默认100ms
+	MaxRetryBackoff time.Duration // 重试前最大的等待时间，默认5s
+	Refresh         string        // Bulk API的refresh参数，true、false、wait_for
+	Pipeline        string        // Bulk API的pipeline参数
+
+	OnError func(ctx context.Context, err error) // 整个请求失败时调用，默认记录日志
+}
+
+// BulkItem 写入的一条数据
+type BulkItem struct {
+	Action     string // index、create、update、delete，默认index
+	Index      string // 索引，为空时使用BulkIndexerConfig.Index
+	DocumentID string // 文档ID
+	Routing    string // 路由
+	Body       []byte // 文档内容，update时为{"doc":{...}}，delete时为空
+
+	OnSuccess func(ctx context.Context, item BulkItem, res BulkResponseItem)            // 写入成功时调用
+	OnFailure func(ctx context.Context, item BulkItem, res BulkResponseItem, err error) // 写入失败时调用，err不为空时表示请求失败，否则失败原因在res.Error中
+}
+
+// BulkResponseItem Bulk API返回的每条数据的结果
+type BulkResponseItem struct {
+	Index      string `json:"_index"`
+	DocumentID string `json:"_id"`
+	Version    int64  `json:"_version"`
+	Result     string `json:"result"`
+	Status     int    `json:"status"`
+	Error      struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// BulkIndexerStats BulkIndexer统计数据
+type BulkIndexerStats struct {
+	NumAdded    uint64 // 添加的数据条数
+	NumFlushed  uint64 // 已经写入的数据条数，包括成功和失败
+	NumFailed   uint64 // 失败的数据条数
+	NumRetried  uint64 // 重试的数据条数，同一条数据重试多次时计算多次
+	NumRequests uint64 // Bulk请求的次数
+}
+
+// BulkIndexer 批量写入，按大小、时间合并为Bulk请求，429或者网络错误时按指数退避重试，
+// 重试期间worker不再消费新的数据，Add阻塞起到背压的作用，Close时写入剩余的数据
+type BulkIndexer struct {
+	client *Component
+	config BulkIndexerConfig
+	queue  chan BulkItem
+	done   chan struct{}  // Close时关闭，唤醒阻塞在Add的调用
+	adding sync.WaitGroup // 正在执行的Add，全部返回后才能关闭queue
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+	stats  BulkIndexerStats
+}
+
+// NewBulkIndexer 创建BulkIndexer，使用完之后需要调用Close
+func (c *Component) NewBulkIndexer(config BulkIndexerConfig) *BulkIndexer {
+	if config.NumWorkers <= 0 {
+		config.NumWorkers = runtime.NumCPU()
+	}
+	if config.FlushBytes <= 0 {
+		config.FlushBytes = 5 * 1024 * 1024
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 30 * time.Second
+	}
+	if config.MaxRetries == 0 {
+		config.MaxRetries = 3
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = 100 * time.Millisecond
+	}
+	if config.MaxRetryBackoff <= 0 {
+		config.MaxRetryBackoff = 5 * time.Second
+	}
+
+	bi := &BulkIndexer{
+		client: c,
+		config: config,
+		queue:  make(chan BulkItem, config.NumWorkers),
+		done:   make(chan struct{}),
+	}
+	for i := 0; i < config.NumWorkers; i++ {
+		bi.wg.Add(1)
+		go bi.work()
+	}
+	return bi
+}
+
+// Add 添加一条数据，worker都在重试时阻塞，直到ctx结束或者BulkIndexer关闭
+func (bi *BulkIndexer) Add(ctx context.Context, item BulkItem) error {
+	if item.Action == "" {
+		item.Action = "index"
+	}
+	// 只在检查closed时持有锁，阻塞期间不持有锁，Close可以随时执行
+	bi.mu.RLock()
+	if bi.closed {
+		bi.mu.RUnlock()
+		return ErrBulkIndexerClosed
+	}
+	bi.adding.Add(1)
+	bi.mu.RUnlock()
+	defer bi.adding.Done()
+
+	select {
+	case bi.queue <- item:
+		atomic.AddUint64(&bi.stats.NumAdded, 1)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-bi.done:
+		return ErrBulkIndexerClosed
+	}
+}
+
+// Close 停止接收数据，阻塞在Add的调用返回ErrBulkIndexerClosed，等待所有worker写入剩余的数据后返回，ctx结束时不再等待
+func (bi *BulkIndexer) Close(ctx context.Context) error {
+	bi.mu.Lock()
+	first := !bi.closed
+	bi.closed = true
+	bi.mu.Unlock()
+	if first {
+		close(bi.done)
+		go func() {
+			// 等待正在执行的Add返回后再关闭queue，避免向已经关闭的channel写入
+			bi.adding.Wait()
+			close(bi.queue)
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		bi.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Stats 返回统计数据
+func (bi *BulkIndexer) Stats() BulkIndexerStats {
+	return BulkIndexerStats{
+		NumAdded:    atomic.LoadUint64(&bi.stats.NumAdded),
+		NumFlushed:  atomic.LoadUint64(&bi.stats.NumFlushed),
+		NumFailed:   atomic.LoadUint64(&bi.stats.NumFailed),
+		NumRetried:  atomic.LoadUint64(&bi.stats.NumRetried),
+		NumRequests: atomic.LoadUint64(&bi.stats.NumRequests),
+	}
+}
+
+// work 从队列中读取数据，按FlushBytes、FlushInterval写入，队列关闭后写入剩余的数据
+func (bi *BulkIndexer) work() {
+	defer bi.wg.Done()
+	ticker := time.NewTicker(bi.config.FlushInterval)
+	defer ticker.Stop()
+
+	items := make([]BulkItem, 0)
+	size := 0
+	for {
+		select {
+		case item, ok := <-bi.queue:
+			if !ok {
+				bi.flush(context.Background(), items)
+				return
+			}
+			items = append(items, item)
+			size += len(item.Body)
+			if size >= bi.config.FlushBytes {
+				bi.flush(context.Background(), items)
+				items, size = make([]BulkItem, 0), 0
+			}
+		case <-ticker.C:
+			bi.flush(context.Background(), items)
+			items, size = make([]BulkItem, 0), 0
+		}
+	}
+}
+
+// flush 写入一批数据，需要重试的数据按指数退避重试，超过MaxRetries后作为失败处理
+func (bi *BulkIndexer) flush(ctx context.Context, items []BulkItem) {
+	backoff := bi.config.RetryBackoff
+	for attempt := 0; len(items) > 0; attempt++ {
+		retries, err := bi.send(ctx, items)
+		if len(retries) == 0 {
+			return
+		}
+		if attempt >= bi.config.MaxRetries {
+			if err == nil {
+				err = fmt.Errorf("retries exceeded, status %d", http.StatusTooManyRequests)
+			}
+			for _, retry := range retries {
+				bi.fail(ctx, retry.item, retry.res, err)
+			}
+			return
+		}
+		atomic.AddUint64(&bi.stats.NumRetried, uint64(len(retries)))
+		bi.client.logger.Warn("bulk retry", elog.Int("attempt", attempt+1), elog.Int("items", len(retries)), elog.FieldErr(err))
+		// 加上随机的抖动，避免多个worker同时重试
+		time.Sleep(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1)))
+		if backoff *= 2; backoff > bi.config.MaxRetryBackoff {
+			backoff = bi.config.MaxRetryBackoff
+		}
+		items = items[:0]
+		for _, retry := range retries {
+			items = append(items, retry.item)
+		}
+	}
+}
+
+// bulkRetry 需要重试的数据以及上一次的结果
+type bulkRetry struct {
+	item BulkItem
+	res  BulkResponseItem
+}
+
+// send 发送一次Bulk请求，返回需要重试的数据，err为整个请求失败的原因
+func (bi *BulkIndexer) send(ctx context.Context, items []BulkItem) ([]bulkRetry, error) {
+	var buf bytes.Buffer
+	sent := make([]BulkItem, 0, len(items))
+	for _, item := range items {
+		if err := writeBulkItem(&buf, item); err != nil {
+			bi.fail(ctx, item, BulkResponseItem{}, err)
+			continue
+		}
+		sent = append(sent, item)
+	}
+	if len(sent) == 0 {
+		return nil, nil
+	}
+	items = sent
+
+	atomic.AddUint64(&bi.stats.NumRequests, 1)
+	bulk := bi.client.Client.Bulk
+	opts := []func(*esapi.BulkRequest){bulk.WithContext(ctx)}
+	if bi.config.Index != "" {
+		opts = append(opts, bulk.WithIndex(bi.config.Index))
+	}
+	if bi.config.Refresh != "" {
+		opts = append(opts, bulk.WithRefresh(bi.config.Refresh))
+	}
+	if bi.config.Pipeline != "" {
+		opts = append(opts, bulk.WithPipeline(bi.config.Pipeline))
+	}
+	res, err := bulk(&buf, opts...)
+	if err != nil {
+		bi.onError(ctx, err)
+		return retryAll(items), err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusTooManyRequests {
+		return retryAll(items), fmt.Errorf("bulk request rejected, %s", res.Status())
+	}
+	if res.IsError() {
+		err = fmt.Errorf("bulk request fail, %s", res.String())
+		bi.onError(ctx, err)
+		for _, item := range items {
+			bi.fail(ctx, item, BulkResponseItem{}, err)
+		}
+		return nil, err
+	}
+
+	var blk struct {
+		Items []map[string]BulkResponseItem `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&blk); err != nil {
+		err = fmt.Errorf("decode bulk response fail, %w", err)
+		bi.onError(ctx, err)
+		for _, item := range items {
+			bi.fail(ctx, item, BulkResponseItem{}, err)
+		}
+		return nil, err
+	}
+
+	retries := make([]bulkRetry, 0)
+	for i, resItem := range blk.Items {
+		if i >= len(items) {
+			break
+		}
+		item := items[i]
+		for _, info := range resItem {
+			switch {
+			case info.Status == http.StatusTooManyRequests:
+				retries = append(retries, bulkRetry{item: item, res: info})
+			case info.Status >= 300:
+				bi.fail(ctx, item, info, nil)
+			default:
+				atomic.AddUint64(&bi.stats.NumFlushed, 1)
+				if item.OnSuccess != nil {
+					item.OnSuccess(ctx, item, info)
+				}
+			}
+		}
+	}
+	return retries, nil
+}
+
+func (bi *BulkIndexer) fail(ctx context.Context, item BulkItem, res BulkResponseItem, err error) {
+	atomic.AddUint64(&bi.stats.NumFlushed, 1)
+	atomic.AddUint64(&bi.stats.NumFailed, 1)
+	if item.OnFailure != nil {
+		item.OnFailure(ctx, item, res, err)
+	}
+}
+
+func (bi *BulkIndexer) onError(ctx context.Context, err error) {
+	if bi.config.OnError != nil {
+		bi.config.OnError(ctx, err)
+		return
+	}
+	bi.client.logger.Error("bulk request", elog.FieldErr(err))
+}
+
+// retryAll 整个请求需要重试
+func retryAll(items []BulkItem) []bulkRetry {
+	retries := make([]bulkRetry, 0, len(items))
+	for _, item := range items {
+		retries = append(retries, bulkRetry{item: item})
+	}
+	return retries
+}
+
+// writeBulkItem 按Bulk API的格式写入一条数据，action一行，body压缩为一行，格式错误时不写入
+func writeBulkItem(buf *bytes.Buffer, item BulkItem) error {
+	meta := make(map[string]string, 3)
+	if item.Index != "" {
+		meta["_index"] = item.Index
+	}
+	if item.DocumentID != "" {
+		meta["_id"] = item.DocumentID
+	}
+	if item.Routing != "" {
+		meta["routing"] = item.Routing
+	}
+	line, err := json.Marshal(map[string]interface{}{item.Action: meta})
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	if item.Action != "delete" {
+		if len(item.Body) == 0 {
+			return fmt.Errorf("%s without body", item.Action)
+		}
+		if err := json.Compact(&body, item.Body); err != nil {
+			return fmt.Errorf("invalid body, %w", err)
+		}
+		body.WriteByte('\n')
+	}
+	buf.Write(line)
+	buf.WriteByte('\n')
+	buf.Write(body.Bytes())
+	return nil
+}
@@ -0,0 +1,162 @@
+package ees
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bulkHandler 返回每条数据的结果，status返回该条数据的状态码，action行中的_id作为参数
+func bulkHandler(status func(id string) int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		items := make([]map[string]BulkResponseItem, 0)
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var action map[string]map[string]string
+			if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+				continue
+			}
+			for name, meta := range action {
+				items = append(items, map[string]BulkResponseItem{name: {DocumentID: meta["_id"], Status: status(meta["_id"])}})
+				if name != "delete" {
+					scanner.Scan()
+				}
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"items": items})
+	}
+}
+
+func TestBulkIndexer(t *testing.T) {
+	var attempts sync.Map
+	c := newTestComponent(t, bulkHandler(func(id string) int {
+		n, _ := attempts.LoadOrStore(id, new(int32))
+		attempt := atomic.AddInt32(n.(*int32), 1)
+		switch {
+		case id == "bad":
+			return http.StatusBadRequest
+		case id == "busy" && attempt == 1:
+			return http.StatusTooManyRequests
+		}
+		return http.StatusCreated
+	}))
+	bi := c.NewBulkIndexer(BulkIndexerConfig{Index: "test", NumWorkers: 2, FlushInterval: 10 * time.Millisecond, RetryBackoff: time.Millisecond})
+
+	var (
+		mu        sync.Mutex
+		succeeded []string
+		failed    []string
+	)
+	onSuccess := func(ctx context.Context, item BulkItem, res BulkResponseItem) {
+		mu.Lock()
+		defer mu.Unlock()
+		succeeded = append(succeeded, item.DocumentID)
+	}
+	onFailure := func(ctx context.Context, item BulkItem, res BulkResponseItem, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, item.DocumentID)
+	}
+	ctx := context.Background()
+	for _, id := range []string{"1", "2", "busy", "bad"} {
+		require.NoError(t, bi.Add(ctx, BulkItem{DocumentID: id, Body: []byte(`{"a": 1}`), OnSuccess: onSuccess, OnFailure: onFailure}))
+	}
+	// body格式错误，不发送
+	require.NoError(t, bi.Add(ctx, BulkItem{DocumentID: "invalid", Body: []byte(`{`), OnSuccess: onSuccess, OnFailure: onFailure}))
+	require.NoError(t, bi.Close(ctx))
+
+	assert.ElementsMatch(t, []string{"1", "2", "busy"}, succeeded)
+	assert.ElementsMatch(t, []string{"bad", "invalid"}, failed)
+	stats := bi.Stats()
+	assert.Equal(t, uint64(5), stats.NumAdded)
+	assert.Equal(t, uint64(5), stats.NumFlushed)
+	assert.Equal(t, uint64(2), stats.NumFailed)
+	assert.Equal(t, uint64(1), stats.NumRetried)
+
+	assert.Equal(t, ErrBulkIndexerClosed, bi.Add(ctx, BulkItem{DocumentID: "late", Body: []byte(`{}`)}))
+	// 重复Close
+	require.NoError(t, bi.Close(ctx))
+}
+
+func TestBulkIndexerCloseWhileAddBlocked(t *testing.T) {
+	release := make(chan struct{})
+	var requests int32
+	c := newTestComponent(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		bulkHandler(func(string) int { return http.StatusCreated })(w, r)
+	})
+	// 每条数据单独写入，worker阻塞在第一个请求上
+	bi := c.NewBulkIndexer(BulkIndexerConfig{Index: "test", NumWorkers: 1, FlushBytes: 1})
+	ctx := context.Background()
+	require.NoError(t, bi.Add(ctx, BulkItem{DocumentID: "1", Body: []byte(`{}`)}))
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&requests) == 1 }, time.Second, time.Millisecond)
+	require.NoError(t, bi.Add(ctx, BulkItem{DocumentID: "2", Body: []byte(`{}`)}))
+
+	// 队列已满，Add阻塞
+	added := make(chan error, 1)
+	go func() {
+		added <- bi.Add(ctx, BulkItem{DocumentID: "3", Body: []byte(`{}`)})
+	}()
+	select {
+	case err := <-added:
+		t.Fatalf("add should block, got %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	// Close不会被阻塞的Add卡住，ctx结束时返回
+	closeCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, bi.Close(closeCtx))
+	select {
+	case err := <-added:
+		assert.Equal(t, ErrBulkIndexerClosed, err)
+	case <-time.After(time.Second):
+		t.Fatal("blocked add not woken by close")
+	}
+
+	// 写入剩余的数据后worker退出
+	close(release)
+	require.NoError(t, bi.Close(ctx))
+	stats := bi.Stats()
+	assert.Equal(t, uint64(2), stats.NumAdded)
+	assert.Equal(t, uint64(2), stats.NumFlushed)
+	assert.Equal(t, uint64(0), stats.NumFailed)
+}
+
+func TestWriteBulkItem(t *testing.T) {
+	tests := []struct {
+		item    BulkItem
+		want    string
+		wantErr bool
+	}{
+		{item: BulkItem{Action: "index", Index: "i", DocumentID: "1", Body: []byte("{\n \"a\": 1\n}")}, want: "{\"index\":{\"_id\":\"1\",\"_index\":\"i\"}}\n{\"a\":1}\n"},
+		{item: BulkItem{Action: "delete", DocumentID: "1", Routing: "r"}, want: "{\"delete\":{\"_id\":\"1\",\"routing\":\"r\"}}\n"},
+		{item: BulkItem{Action: "update", DocumentID: "1"}, wantErr: true},
+		{item: BulkItem{Action: "index", Body: []byte("{")}, wantErr: true},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			var buf bytes.Buffer
+			err := writeBulkItem(&buf, tt.item)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Zero(t, buf.Len())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, buf.String())
+		})
+	}
+}
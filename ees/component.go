@@ -12,6 +12,7 @@ type Component struct {
 	name   string
 	config *config
 	logger *elog.Component
+	shadow *shadowTransport
 	Client *elasticsearch.Client
 }
 
@@ -19,6 +20,7 @@ type Component struct {
 func newComponent(name string, config *config, logger *elog.Component) *Component {
 	elasticConfig := elasticsearch.Config{
 		Addresses:             config.Addrs,
+		CloudID:               config.CloudID,
 		Username:              config.Username,
 		Password:              config.Password,
 		APIKey:                config.APIKey,
@@ -34,9 +36,25 @@ func newComponent(name string, config *config, logger *elog.Component) *Componen
 		DisableMetaHeader:     !config.EnableMetaHeader,
 	}
 
+	transport, err := newHTTPTransport(config)
+	if err != nil {
+		logger.Panic("component tls config panic", elog.FieldErr(err))
+	}
+	var shadow *shadowTransport
+	if len(config.Shadow.Addrs) > 0 {
+		shadow, err = newShadowTransport(name, config.Shadow, logger, transport)
+		if err != nil {
+			logger.Panic("shadow component new panic", elog.FieldErr(err))
+		}
+		transport = shadow
+	}
 	if config.EnableTrace {
-		elasticConfig.Transport = NewTransport()
+		transport = NewTransport(WithRoundTripper(transport))
+	}
+	if config.EnableMetricInterceptor || config.SlowLogThreshold > 0 {
+		transport = &interceptorTransport{name: name, config: config, logger: logger, rt: transport}
 	}
+	elasticConfig.Transport = transport
 
 	client, err := elasticsearch.NewClient(elasticConfig)
 	if err != nil {
@@ -47,8 +65,17 @@ func newComponent(name string, config *config, logger *elog.Component) *Componen
 		name:   name,
 		logger: logger,
 		config: config,
+		shadow: shadow,
 		Client: client,
 	}
 
 	return cc
 }
+
+// Close 停止写入影子集群的worker，未发送的请求丢弃
+func (c *Component) Close() error {
+	if c.shadow != nil {
+		c.shadow.close()
+	}
+	return nil
+}
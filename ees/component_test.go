@@ -0,0 +1,20 @@
+package ees
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestComponent 创建请求发送到handler的组件
+func newTestComponent(t *testing.T, handler http.HandlerFunc) *Component {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client, err := elasticsearch.NewClient(elasticsearch.Config{Addresses: []string{srv.URL}})
+	require.NoError(t, err)
+	return &Component{name: "test", config: DefaultConfig(), logger: elog.DefaultLogger, Client: client}
+}
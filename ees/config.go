@@ -2,15 +2,23 @@ package ees
 
 import (
 	"time"
+
+	"github.com/gotomicro/ego/core/util/xtime"
 )
 
 // config ...
 type config struct {
 	Addrs                      []string      // A list of Elasticsearch nodes to use.
+	CloudID                    string        // Endpoint for the Elastic Service (https://elastic.co/cloud); can't be set together with Addrs.
 	Username                   string        // Username for HTTP Basic Authentication.
 	Password                   string        // Password for HTTP Basic Authentication.
 	APIKey                     string        // Base64-encoded token for authorization; if set, overrides username/password and service token.
 	ServiceToken               string        // Service token for authorization; if set, overrides username/password.
+	CaCert                     string        // CA证书文件路径，用于校验自建集群的证书
+	CertificateFingerprint     string        // 证书的sha256指纹（hex编码，可以包含冒号），如Elasticsearch 8自动生成的http_ca.crt的指纹，设置后使用该证书代替系统CA校验服务端证书
+	CertFile                   string        // 客户端证书文件路径，用于双向认证，需要与KeyFile同时配置
+	KeyFile                    string        // 客户端私钥文件路径，用于双向认证
+	InsecureSkipVerify         bool          // 不校验服务端证书，仅用于测试环境
 	RetryOnStatus              []int         // List of status codes for retry. Default: 502, 503, 504.
 	EnableRetry                bool          // Default: false.
 	EnableRetryOnTimeout       bool          // Default: false.
@@ -21,6 +29,14 @@ type config struct {
 	EnableDebugLogger          bool          // Enable the debug logging.
 	EnableMetaHeader           bool          // Disable the additional "X-Elastic-Client-Meta" HTTP header.
 	EnableTrace                bool          // Enable the trace collection.
+	EnableMetricInterceptor    bool          // 是否开启按索引、操作统计请求耗时，默认开启
+	SlowLogThreshold           time.Duration // 慢查询门限值，搜索请求超过该门限值时记录到慢日志中，默认500ms，小于等于0时不记录
+	Shadow                     ShadowConfig  // 影子集群，配置地址后文档写入成功时异步写入影子集群
+	ProvisionDryRun            bool          // 启动时只检查WithIndexTemplate、WithILMPolicy声明的模板、策略，不创建、不更新
+	SnapshotRepository         string        // 默认的快照仓库，快照相关的方法中repository为空时使用
+
+	indexTemplates []IndexTemplate
+	ilmPolicies    []ILMPolicy
 }
 
 // DefaultConfig 返回默认配置
@@ -41,5 +57,7 @@ func DefaultConfig() *config {
 		EnableDebugLogger:          false,
 		EnableMetaHeader:           false,
 		EnableTrace:                false,
+		EnableMetricInterceptor:    true,
+		SlowLogThreshold:           xtime.Duration("500ms"),
 	}
 }
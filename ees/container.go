@@ -1,6 +1,8 @@
 package ees
 
 import (
+	"context"
+
 	"github.com/gotomicro/ego/core/econf"
 	"github.com/gotomicro/ego/core/elog"
 )
@@ -35,5 +37,12 @@ func (c *Container) Build(options ...Option) *Component {
 		option(c)
 	}
 	cc := newComponent(c.name, c.config, c.logger)
+	if len(c.config.ilmPolicies) > 0 || len(c.config.indexTemplates) > 0 {
+		report, err := cc.EnsureProvisions(context.Background(), c.config.ProvisionDryRun)
+		if err != nil {
+			c.logger.Panic("ensure provisions", elog.FieldErr(err))
+		}
+		cc.logProvisionReport(report)
+	}
 	return cc
 }
@@ -0,0 +1,146 @@
+package ees
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// Document 文档及其元数据
+type Document[T any] struct {
+	Index       string
+	ID          string
+	Version     int64
+	SeqNo       int64
+	PrimaryTerm int64
+	Score       float64 // 搜索时的得分
+	Source      T
+}
+
+// IndexResult 写入文档的结果
+type IndexResult struct {
+	Index       string `json:"_index"`
+	ID          string `json:"_id"`
+	Version     int64  `json:"_version"`
+	SeqNo       int64  `json:"_seq_no"`
+	PrimaryTerm int64  `json:"_primary_term"`
+	Result      string `json:"result"` // created、updated
+}
+
+// SearchResult 搜索结果
+type SearchResult[T any] struct {
+	Took         int64
+	Total        int64
+	Hits         []Document[T]
+	Aggregations Aggregations
+}
+
+// hit 搜索结果、Get返回的文档
+type hit struct {
+	Index       string          `json:"_index"`
+	ID          string          `json:"_id"`
+	Version     int64           `json:"_version"`
+	SeqNo       int64           `json:"_seq_no"`
+	PrimaryTerm int64           `json:"_primary_term"`
+	Score       float64         `json:"_score"`
+	Found       bool            `json:"found"`
+	Source      json.RawMessage `json:"_source"`
+}
+
+func decodeHit[T any](h hit) (Document[T], error) {
+	doc := Document[T]{
+		Index:       h.Index,
+		ID:          h.ID,
+		Version:     h.Version,
+		SeqNo:       h.SeqNo,
+		PrimaryTerm: h.PrimaryTerm,
+		Score:       h.Score,
+	}
+	if len(h.Source) == 0 {
+		return doc, nil
+	}
+	if err := json.Unmarshal(h.Source, &doc.Source); err != nil {
+		return doc, fmt.Errorf("ees: decode document %s fail, %w", h.ID, err)
+	}
+	return doc, nil
+}
+
+// Index 写入文档，id为空时由Elasticsearch生成，opts为esapi的参数，如c.Client.Index.WithIfSeqNo
+func Index[T any](ctx context.Context, c *Component, index string, id string, doc T, opts ...func(*esapi.IndexRequest)) (*IndexResult, error) {
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]func(*esapi.IndexRequest){c.Client.Index.WithContext(ctx)}, opts...)
+	if id != "" {
+		opts = append(opts, c.Client.Index.WithDocumentID(id))
+	}
+	var result IndexResult
+	res, err := c.Client.Index(index, bytes.NewReader(body), opts...)
+	if err := decodeResponse(res, err, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Get 读取文档，文档不存在时返回的错误满足IsNotFound
+func Get[T any](ctx context.Context, c *Component, index string, id string, opts ...func(*esapi.GetRequest)) (*Document[T], error) {
+	opts = append([]func(*esapi.GetRequest){c.Client.Get.WithContext(ctx)}, opts...)
+	var h hit
+	res, err := c.Client.Get(index, id, opts...)
+	if err := decodeResponse(res, err, &h); err != nil {
+		return nil, err
+	}
+	doc, err := decodeHit[T](h)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// Search 搜索文档，返回的文档按顺序解析为T，opts为esapi的参数，如c.Client.Search.WithRouting
+func Search[T any](ctx context.Context, c *Component, index string, source *SearchSource, opts ...func(*esapi.SearchRequest)) (*SearchResult[T], error) {
+	body, err := source.Reader()
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]func(*esapi.SearchRequest){
+		c.Client.Search.WithContext(ctx),
+		c.Client.Search.WithIndex(index),
+		c.Client.Search.WithBody(body),
+		c.Client.Search.WithVersion(true),
+		c.Client.Search.WithSeqNoPrimaryTerm(true),
+	}, opts...)
+	var resp struct {
+		Took int64 `json:"took"`
+		Hits struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+			Hits []hit `json:"hits"`
+		} `json:"hits"`
+		Aggregations Aggregations `json:"aggregations"`
+	}
+	res, err := c.Client.Search(opts...)
+	if err := decodeResponse(res, err, &resp); err != nil {
+		return nil, err
+	}
+
+	result := &SearchResult[T]{
+		Took:         resp.Took,
+		Total:        resp.Hits.Total.Value,
+		Hits:         make([]Document[T], 0, len(resp.Hits.Hits)),
+		Aggregations: resp.Aggregations,
+	}
+	for _, h := range resp.Hits.Hits {
+		doc, err := decodeHit[T](h)
+		if err != nil {
+			return nil, err
+		}
+		result.Hits = append(result.Hits, doc)
+	}
+	return result, nil
+}
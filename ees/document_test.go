@@ -0,0 +1,102 @@
+package ees
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func TestIndex(t *testing.T) {
+	var requests []string
+	var bodies []testUser
+	c := newTestComponent(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		var user testUser
+		_ = json.NewDecoder(r.Body).Decode(&user)
+		bodies = append(bodies, user)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"_index":"users","_id":"1","_version":2,"_seq_no":5,"_primary_term":1,"result":"updated"}`))
+	})
+
+	result, err := Index(context.Background(), c, "users", "1", testUser{Name: "ego", Age: 3}, c.Client.Index.WithIfSeqNo(4), c.Client.Index.WithIfPrimaryTerm(1))
+	require.NoError(t, err)
+	assert.Equal(t, &IndexResult{Index: "users", ID: "1", Version: 2, SeqNo: 5, PrimaryTerm: 1, Result: "updated"}, result)
+
+	// id为空时由Elasticsearch生成
+	_, err = Index(context.Background(), c, "users", "", testUser{Name: "egorm"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PUT /users/_doc/1?if_primary_term=1&if_seq_no=4", "POST /users/_doc"}, requests)
+	assert.Equal(t, []testUser{{Name: "ego", Age: 3}, {Name: "egorm"}}, bodies)
+}
+
+func TestGet(t *testing.T) {
+	c := newTestComponent(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/users/_doc/1":
+			_, _ = w.Write([]byte(`{"_index":"users","_id":"1","_version":3,"_seq_no":7,"_primary_term":2,"found":true,"_source":{"name":"ego","age":3}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"_index":"users","_id":"2","found":false}`))
+		}
+	})
+
+	doc, err := Get[testUser](context.Background(), c, "users", "1")
+	require.NoError(t, err)
+	assert.Equal(t, &Document[testUser]{Index: "users", ID: "1", Version: 3, SeqNo: 7, PrimaryTerm: 2, Source: testUser{Name: "ego", Age: 3}}, doc)
+
+	// 文档不存在时返回404错误
+	_, err = Get[testUser](context.Background(), c, "users", "2")
+	assert.True(t, IsNotFound(err))
+}
+
+func TestSearch(t *testing.T) {
+	var body map[string]interface{}
+	var query map[string][]string
+	c := newTestComponent(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/users/_search", r.URL.Path)
+		query = r.URL.Query()
+		data, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"took": 4,
+			"hits": {
+				"total": {"value": 12, "relation": "eq"},
+				"hits": [
+					{"_index":"users","_id":"1","_version":3,"_seq_no":7,"_primary_term":2,"_score":1.5,"_source":{"name":"ego","age":3}},
+					{"_index":"users","_id":"2","_version":1,"_seq_no":8,"_primary_term":2,"_score":0.5,"_source":{"name":"egorm","age":2}}
+				]
+			},
+			"aggregations": {"ages": {"buckets": [{"key": 3, "doc_count": 1}]}}
+		}`))
+	})
+
+	result, err := Search[testUser](context.Background(), c, "users", NewSearchSource().Query(Term("name", "ego")).Size(2))
+	require.NoError(t, err)
+
+	// 搜索结果需要带上版本和seq_no，用于后续的乐观并发控制
+	assert.Equal(t, []string{"true"}, query["version"])
+	assert.Equal(t, []string{"true"}, query["seq_no_primary_term"])
+	assert.Equal(t, float64(2), body["size"])
+	assert.Contains(t, body, "query")
+
+	assert.Equal(t, int64(4), result.Took)
+	assert.Equal(t, int64(12), result.Total)
+	assert.Equal(t, []Document[testUser]{
+		{Index: "users", ID: "1", Version: 3, SeqNo: 7, PrimaryTerm: 2, Score: 1.5, Source: testUser{Name: "ego", Age: 3}},
+		{Index: "users", ID: "2", Version: 1, SeqNo: 8, PrimaryTerm: 2, Score: 0.5, Source: testUser{Name: "egorm", Age: 2}},
+	}, result.Hits)
+	assert.JSONEq(t, `{"buckets": [{"key": 3, "doc_count": 1}]}`, string(result.Aggregations["ages"]))
+}
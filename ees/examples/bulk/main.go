@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gotomicro/ego"
+	"github.com/gotomicro/ego/core/elog"
+
+	"github.com/gotomicro/ego-component/ees"
+)
+
+//  export EGO_DEBUG=true && go run main.go --config=config.toml
+func main() {
+	ego.New().Invoker(bulk).Run()
+}
+
+func bulk() error {
+	comp := ees.Load("es").Build()
+	indexer := comp.NewBulkIndexer(ees.BulkIndexerConfig{
+		Index:         "ego_logger",
+		NumWorkers:    2,
+		FlushInterval: time.Second,
+	})
+
+	for i := 0; i < 100; i++ {
+		err := indexer.Add(context.Background(), ees.BulkItem{
+			DocumentID: fmt.Sprintf("%d", i),
+			Body:       []byte(fmt.Sprintf(`{"title":"hello %d"}`, i)),
+			OnFailure: func(ctx context.Context, item ees.BulkItem, res ees.BulkResponseItem, err error) {
+				elog.Error("bulk fail", elog.String("id", item.DocumentID), elog.String("reason", res.Error.Reason), elog.FieldErr(err))
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := indexer.Close(ctx); err != nil {
+		return err
+	}
+	fmt.Printf("%+v\n", indexer.Stats())
+	return nil
+}
@@ -0,0 +1,211 @@
+package ees
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/gotomicro/ego/core/emetric"
+	"github.com/spf13/cast"
+)
+
+// requestHistogram 按索引、操作统计的请求耗时
+var requestHistogram = emetric.HistogramVecOpts{
+	Namespace: emetric.DefaultNamespace,
+	Name:      "es_request_seconds",
+	Help:      "Elasticsearch request latency by index and operation",
+	Labels:    []string{"name", "index", "operation", "code"},
+	Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+}.Build()
+
+// maxSlowLogQuerySize 慢日志中记录的查询语句的最大长度
+const maxSlowLogQuerySize = 2048
+
+// indexNumberPattern 索引名中的数字串，如logs-2021.10.01中的日期、logs-000001中的rollover序号
+var indexNumberPattern = regexp.MustCompile(`[0-9]+([._-][0-9]+)*`)
+
+// interceptorTransport 记录请求的耗时，搜索请求超过SlowLogThreshold时记录慢日志
+type interceptorTransport struct {
+	name   string
+	config *config
+	logger *elog.Component
+	rt     http.RoundTripper
+}
+
+// RoundTrip ...
+func (t *interceptorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	index, operation := parsePath(req.URL.Path)
+	slowLog := t.config.SlowLogThreshold > 0 && isSearch(operation)
+
+	var reqBody []byte
+	if slowLog && req.Body != nil {
+		reqBody, _ = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	beg := time.Now()
+	resp, err := t.rt.RoundTrip(req)
+	cost := time.Since(beg)
+
+	code := "error"
+	if resp != nil {
+		code = cast.ToString(resp.StatusCode)
+	}
+	if t.config.EnableMetricInterceptor {
+		requestHistogram.WithLabelValues(t.name, normalizeIndex(index), operation, code).Observe(cost.Seconds())
+	}
+
+	// 服务端的took一定小于客户端的耗时，客户端耗时没有超过门限值时不需要解析响应
+	if slowLog && cost > t.config.SlowLogThreshold {
+		fields := []elog.Field{
+			elog.FieldComponentName(t.name),
+			elog.FieldMethod(operation),
+			elog.String("index", index),
+			elog.FieldCost(cost),
+			elog.String("query", sanitizeQuery(reqBody)),
+		}
+		if err != nil {
+			fields = append(fields, elog.FieldErr(err))
+		}
+		if resp != nil && resp.StatusCode < http.StatusMultipleChoices {
+			fields = append(fields, t.searchStats(resp)...)
+		}
+		t.logger.Warn("slow", fields...)
+	}
+	return resp, err
+}
+
+// searchStats 解析搜索响应中的took、hits，读取后恢复响应的body
+func (t *interceptorTransport) searchStats(resp *http.Response) []elog.Field {
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil
+	}
+	var stats struct {
+		Took int64 `json:"took"`
+		Hits struct {
+			Total struct {
+				Value int64 `json:"value"`
+			} `json:"total"`
+		} `json:"hits"`
+	}
+	if json.Unmarshal(body, &stats) != nil {
+		return nil
+	}
+	return []elog.Field{
+		elog.Int64("took", stats.Took),
+		elog.Int64("hits", stats.Hits.Total.Value),
+	}
+}
+
+// parsePath 从请求路径中解析索引和操作，如/logs/_search的索引为logs，操作为search
+func parsePath(path string) (index string, operation string) {
+	for _, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		if strings.HasPrefix(segment, "_") {
+			if operation == "" {
+				operation = strings.TrimPrefix(segment, "_")
+			}
+			continue
+		}
+		if index == "" && operation == "" {
+			index = segment
+		}
+	}
+	if operation == "" {
+		operation = "info"
+		if index != "" {
+			operation = "index"
+		}
+	}
+	return index, operation
+}
+
+func isSearch(operation string) bool {
+	switch operation {
+	case "search", "msearch", "count":
+		return true
+	}
+	return false
+}
+
+// sanitizeQuery 将查询语句中的值替换为?，保留结构和字段名，避免记录用户数据
+// msearch的NDJSON请求逐行处理，按行输出
+func sanitizeQuery(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	lines := make([]string, 0, 1)
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	for {
+		var query interface{}
+		err := decoder.Decode(&query)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ""
+		}
+		data, err := json.Marshal(sanitizeValue("", query))
+		if err != nil {
+			return ""
+		}
+		lines = append(lines, string(data))
+	}
+	out := strings.Join(lines, "\n")
+	if len(out) > maxSlowLogQuerySize {
+		return out[:maxSlowLogQuerySize] + "..."
+	}
+	return out
+}
+
+// normalizeIndex 将索引名中至少4位数字的日期、序号替换为*，避免按天、按月创建的索引使监控的label无限增长
+func normalizeIndex(index string) string {
+	return indexNumberPattern.ReplaceAllStringFunc(index, func(s string) string {
+		digits := 0
+		for _, r := range s {
+			if r >= '0' && r <= '9' {
+				digits++
+			}
+		}
+		if digits < 4 {
+			return s
+		}
+		return "*"
+	})
+}
+
+func sanitizeValue(key string, v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(value))
+		for k, sub := range value {
+			out[k] = sanitizeValue(k, sub)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(value))
+		for _, sub := range value {
+			out = append(out, sanitizeValue(key, sub))
+		}
+		return out
+	default:
+		switch key {
+		// 字段名、分页等不是用户数据
+		case "field", "path", "size", "from", "order", "operator", "format", "calendar_interval", "interval":
+			return v
+		}
+		return "?"
+	}
+}
@@ -0,0 +1,122 @@
+package ees
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path      string
+		index     string
+		operation string
+	}{
+		{"/", "", "info"},
+		{"/logs", "logs", "index"},
+		{"/logs/_search", "logs", "search"},
+		{"/logs/_doc/1", "logs", "doc"},
+		{"/_msearch", "", "msearch"},
+		{"/_cluster/health", "", "cluster"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			index, operation := parsePath(tt.path)
+			assert.Equal(t, tt.index, index)
+			assert.Equal(t, tt.operation, operation)
+		})
+	}
+}
+
+func TestNormalizeIndex(t *testing.T) {
+	tests := []struct {
+		index string
+		want  string
+	}{
+		{"", ""},
+		{"users", "users"},
+		{"logs-2021.10.01", "logs-*"},
+		{"logs-2021-10-01", "logs-*"},
+		{"logs_20211001", "logs_*"},
+		{"logs-2021.10", "logs-*"},
+		{"logs-000001", "logs-*"},
+		{".ds-logs-2021.10.01-000002", ".ds-logs-*"},
+		{"users-v10", "users-v10"},
+		{"logs-2021.10.01,logs-2021.10.02", "logs-*,logs-*"},
+		{"v2", "v2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.index, func(t *testing.T) {
+			assert.Equal(t, tt.want, normalizeIndex(tt.index))
+		})
+	}
+}
+
+func TestSanitizeQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"empty", "", ""},
+		{"invalid", "{", ""},
+		{
+			"search",
+			`{"query":{"term":{"user":"alice"}},"size":10,"aggs":{"a":{"terms":{"field":"tag"}}}}`,
+			`{"aggs":{"a":{"terms":{"field":"tag"}}},"query":{"term":{"user":"?"}},"size":10}`,
+		},
+		{
+			"msearch",
+			"{\"index\":\"logs\"}\n{\"query\":{\"match\":{\"msg\":\"secret\"}}}\n{}\n{\"query\":{\"match_all\":{}},\"from\":5}\n",
+			"{\"index\":\"?\"}\n{\"query\":{\"match\":{\"msg\":\"?\"}}}\n{}\n{\"from\":5,\"query\":{\"match_all\":{}}}",
+		},
+		{"msearch invalid line", "{\"index\":\"logs\"}\n{\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sanitizeQuery([]byte(tt.body)))
+		})
+	}
+
+	long := `{"query":{"terms":{"id":[` + strings.Repeat(`1,`, maxSlowLogQuerySize) + `1]}}}`
+	got := sanitizeQuery([]byte(long))
+	assert.Len(t, got, maxSlowLogQuerySize+3)
+	assert.True(t, strings.HasSuffix(got, "..."))
+}
+
+// TestInterceptorTLS 开启拦截器时仍然使用TLS配置
+func TestInterceptorTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"took":1,"hits":{"total":{"value":0}}}`))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "ees-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	caCert := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600))
+
+	config := DefaultConfig()
+	config.Addrs = []string{srv.URL}
+	config.CaCert = caCert
+	config.EnableTrace = true
+	config.SlowLogThreshold = time.Nanosecond
+	c := newComponent("test", config, elog.DefaultLogger)
+
+	resp, err := c.Client.Search(c.Client.Search.WithIndex("logs"))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
@@ -1,3 +1,17 @@
 package ees
 
 type Option func(c *Container)
+
+// WithIndexTemplate 声明索引模板，Build时检查，不存在或者不一致时创建、更新
+func WithIndexTemplate(name string, body interface{}) Option {
+	return func(c *Container) {
+		c.config.indexTemplates = append(c.config.indexTemplates, IndexTemplate{Name: name, Body: body})
+	}
+}
+
+// WithILMPolicy 声明索引生命周期策略，Build时检查，不存在或者不一致时创建、更新
+func WithILMPolicy(name string, body interface{}) Option {
+	return func(c *Container) {
+		c.config.ilmPolicies = append(c.config.ilmPolicies, ILMPolicy{Name: name, Body: body})
+	}
+}
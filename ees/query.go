@@ -0,0 +1,350 @@
+package ees
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// Query 查询条件，Source返回对应的JSON DSL
+type Query interface {
+	Source() map[string]interface{}
+}
+
+// rawQuery 直接由map构成的查询
+type rawQuery map[string]interface{}
+
+func (q rawQuery) Source() map[string]interface{} {
+	return q
+}
+
+// RawQuery 使用map构建builder没有覆盖的查询，如RawQuery(map[string]interface{}{"ids": ...})
+func RawQuery(source map[string]interface{}) Query {
+	return rawQuery(source)
+}
+
+// MatchAll 匹配所有文档
+func MatchAll() Query {
+	return rawQuery{"match_all": map[string]interface{}{}}
+}
+
+// Term 精确匹配
+func Term(field string, value interface{}) Query {
+	return rawQuery{"term": map[string]interface{}{field: value}}
+}
+
+// Terms 匹配任意一个值
+func Terms(field string, values ...interface{}) Query {
+	return rawQuery{"terms": map[string]interface{}{field: values}}
+}
+
+// Exists 字段存在
+func Exists(field string) Query {
+	return rawQuery{"exists": map[string]interface{}{"field": field}}
+}
+
+// Prefix 前缀匹配
+func Prefix(field string, prefix string) Query {
+	return rawQuery{"prefix": map[string]interface{}{field: prefix}}
+}
+
+// MatchQuery 全文检索
+type MatchQuery struct {
+	field  string
+	params map[string]interface{}
+}
+
+// Match 全文检索
+func Match(field string, text interface{}) *MatchQuery {
+	return &MatchQuery{field: field, params: map[string]interface{}{"query": text}}
+}
+
+// Operator 分词之间的关系，and、or，默认or
+func (q *MatchQuery) Operator(operator string) *MatchQuery {
+	q.params["operator"] = operator
+	return q
+}
+
+// MinimumShouldMatch 最少匹配的分词数量或者比例，如2、"75%"
+func (q *MatchQuery) MinimumShouldMatch(v interface{}) *MatchQuery {
+	q.params["minimum_should_match"] = v
+	return q
+}
+
+// Fuzziness 模糊匹配，如AUTO
+func (q *MatchQuery) Fuzziness(fuzziness string) *MatchQuery {
+	q.params["fuzziness"] = fuzziness
+	return q
+}
+
+// Boost 权重
+func (q *MatchQuery) Boost(boost float64) *MatchQuery {
+	q.params["boost"] = boost
+	return q
+}
+
+// Source ...
+func (q *MatchQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"match": map[string]interface{}{q.field: q.params}}
+}
+
+// RangeQuery 范围查询
+type RangeQuery struct {
+	field  string
+	params map[string]interface{}
+}
+
+// Range 范围查询
+func Range(field string) *RangeQuery {
+	return &RangeQuery{field: field, params: make(map[string]interface{})}
+}
+
+// Gt 大于
+func (q *RangeQuery) Gt(v interface{}) *RangeQuery {
+	q.params["gt"] = v
+	return q
+}
+
+// Gte 大于等于
+func (q *RangeQuery) Gte(v interface{}) *RangeQuery {
+	q.params["gte"] = v
+	return q
+}
+
+// Lt 小于
+func (q *RangeQuery) Lt(v interface{}) *RangeQuery {
+	q.params["lt"] = v
+	return q
+}
+
+// Lte 小于等于
+func (q *RangeQuery) Lte(v interface{}) *RangeQuery {
+	q.params["lte"] = v
+	return q
+}
+
+// Format 日期格式，如yyyy-MM-dd
+func (q *RangeQuery) Format(format string) *RangeQuery {
+	q.params["format"] = format
+	return q
+}
+
+// TimeZone 时区，如+08:00
+func (q *RangeQuery) TimeZone(timeZone string) *RangeQuery {
+	q.params["time_zone"] = timeZone
+	return q
+}
+
+// Source ...
+func (q *RangeQuery) Source() map[string]interface{} {
+	return map[string]interface{}{"range": map[string]interface{}{q.field: q.params}}
+}
+
+// BoolQuery 组合查询
+type BoolQuery struct {
+	must               []Query
+	filter             []Query
+	should             []Query
+	mustNot            []Query
+	minimumShouldMatch interface{}
+	boost              *float64
+}
+
+// Bool 组合查询
+func Bool() *BoolQuery {
+	return &BoolQuery{}
+}
+
+// Must 必须匹配，参与打分
+func (q *BoolQuery) Must(queries ...Query) *BoolQuery {
+	q.must = append(q.must, queries...)
+	return q
+}
+
+// Filter 必须匹配，不参与打分，可以被缓存
+func (q *BoolQuery) Filter(queries ...Query) *BoolQuery {
+	q.filter = append(q.filter, queries...)
+	return q
+}
+
+// Should 应该匹配
+func (q *BoolQuery) Should(queries ...Query) *BoolQuery {
+	q.should = append(q.should, queries...)
+	return q
+}
+
+// MustNot 必须不匹配
+func (q *BoolQuery) MustNot(queries ...Query) *BoolQuery {
+	q.mustNot = append(q.mustNot, queries...)
+	return q
+}
+
+// MinimumShouldMatch should最少匹配的数量或者比例
+func (q *BoolQuery) MinimumShouldMatch(v interface{}) *BoolQuery {
+	q.minimumShouldMatch = v
+	return q
+}
+
+// Boost 权重
+func (q *BoolQuery) Boost(boost float64) *BoolQuery {
+	q.boost = &boost
+	return q
+}
+
+// Source ...
+func (q *BoolQuery) Source() map[string]interface{} {
+	params := make(map[string]interface{})
+	for clause, queries := range map[string][]Query{"must": q.must, "filter": q.filter, "should": q.should, "must_not": q.mustNot} {
+		if len(queries) > 0 {
+			params[clause] = querySources(queries)
+		}
+	}
+	if q.minimumShouldMatch != nil {
+		params["minimum_should_match"] = q.minimumShouldMatch
+	}
+	if q.boost != nil {
+		params["boost"] = *q.boost
+	}
+	return map[string]interface{}{"bool": params}
+}
+
+// NestedQuery nested类型字段的查询
+type NestedQuery struct {
+	path      string
+	query     Query
+	scoreMode string
+}
+
+// Nested nested类型字段的查询，query中的字段需要带上path前缀
+func Nested(path string, query Query) *NestedQuery {
+	return &NestedQuery{path: path, query: query}
+}
+
+// ScoreMode 打分方式，avg、max、min、sum、none，默认avg
+func (q *NestedQuery) ScoreMode(scoreMode string) *NestedQuery {
+	q.scoreMode = scoreMode
+	return q
+}
+
+// Source ...
+func (q *NestedQuery) Source() map[string]interface{} {
+	params := map[string]interface{}{
+		"path":  q.path,
+		"query": q.query.Source(),
+	}
+	if q.scoreMode != "" {
+		params["score_mode"] = q.scoreMode
+	}
+	return map[string]interface{}{"nested": params}
+}
+
+func querySources(queries []Query) []interface{} {
+	sources := make([]interface{}, 0, len(queries))
+	for _, q := range queries {
+		sources = append(sources, q.Source())
+	}
+	return sources
+}
+
+// SearchSource 搜索请求的body
+type SearchSource struct {
+	query          Query
+	from           *int
+	size           *int
+	sorts          []interface{}
+	includes       []string
+	aggregations   map[string]Aggregation
+	trackTotalHits interface{}
+}
+
+// NewSearchSource 创建搜索请求的body
+func NewSearchSource() *SearchSource {
+	return &SearchSource{aggregations: make(map[string]Aggregation)}
+}
+
+// Query 查询条件
+func (s *SearchSource) Query(query Query) *SearchSource {
+	s.query = query
+	return s
+}
+
+// From 偏移量
+func (s *SearchSource) From(from int) *SearchSource {
+	s.from = &from
+	return s
+}
+
+// Size 返回的文档数量
+func (s *SearchSource) Size(size int) *SearchSource {
+	s.size = &size
+	return s
+}
+
+// Sort 排序，可以调用多次
+func (s *SearchSource) Sort(field string, ascending bool) *SearchSource {
+	order := "desc"
+	if ascending {
+		order = "asc"
+	}
+	s.sorts = append(s.sorts, map[string]interface{}{field: map[string]interface{}{"order": order}})
+	return s
+}
+
+// Includes 返回的_source字段
+func (s *SearchSource) Includes(fields ...string) *SearchSource {
+	s.includes = append(s.includes, fields...)
+	return s
+}
+
+// Aggregation 聚合
+func (s *SearchSource) Aggregation(name string, agg Aggregation) *SearchSource {
+	s.aggregations[name] = agg
+	return s
+}
+
+// TrackTotalHits 是否精确统计总数，true、false或者数量上限
+func (s *SearchSource) TrackTotalHits(v interface{}) *SearchSource {
+	s.trackTotalHits = v
+	return s
+}
+
+// Source ...
+func (s *SearchSource) Source() map[string]interface{} {
+	source := make(map[string]interface{})
+	if s.query != nil {
+		source["query"] = s.query.Source()
+	}
+	if s.from != nil {
+		source["from"] = *s.from
+	}
+	if s.size != nil {
+		source["size"] = *s.size
+	}
+	if len(s.sorts) > 0 {
+		source["sort"] = s.sorts
+	}
+	if len(s.includes) > 0 {
+		source["_source"] = s.includes
+	}
+	if len(s.aggregations) > 0 {
+		source["aggs"] = aggregationSources(s.aggregations)
+	}
+	if s.trackTotalHits != nil {
+		source["track_total_hits"] = s.trackTotalHits
+	}
+	return source
+}
+
+// MarshalJSON ...
+func (s *SearchSource) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Source())
+}
+
+// Reader 序列化为esapi请求的body，如es.Search.WithBody(reader)
+func (s *SearchSource) Reader() (io.Reader, error) {
+	data, err := json.Marshal(s.Source())
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(data), nil
+}
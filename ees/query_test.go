@@ -0,0 +1,129 @@
+package ees
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// assertSource 比较序列化后的JSON
+func assertSource(t *testing.T, want string, source interface{}) {
+	t.Helper()
+	data, err := json.Marshal(source)
+	require.NoError(t, err)
+	assert.JSONEq(t, want, string(data))
+}
+
+func TestQueries(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		want  string
+	}{
+		{"match_all", MatchAll(), `{"match_all":{}}`},
+		{"term", Term("status", 1), `{"term":{"status":1}}`},
+		{"terms", Terms("tag", "a", "b"), `{"terms":{"tag":["a","b"]}}`},
+		{"exists", Exists("email"), `{"exists":{"field":"email"}}`},
+		{"prefix", Prefix("name", "ab"), `{"prefix":{"name":"ab"}}`},
+		{"raw", RawQuery(map[string]interface{}{"ids": map[string]interface{}{"values": []string{"1"}}}), `{"ids":{"values":["1"]}}`},
+		{
+			"match",
+			Match("title", "hello world").Operator("and").MinimumShouldMatch("75%").Fuzziness("AUTO").Boost(2),
+			`{"match":{"title":{"query":"hello world","operator":"and","minimum_should_match":"75%","fuzziness":"AUTO","boost":2}}}`,
+		},
+		{
+			"range",
+			Range("created").Gte("2021-01-01").Lt("2022-01-01").Format("yyyy-MM-dd").TimeZone("+08:00"),
+			`{"range":{"created":{"gte":"2021-01-01","lt":"2022-01-01","format":"yyyy-MM-dd","time_zone":"+08:00"}}}`,
+		},
+		{"range gt lte", Range("age").Gt(1).Lte(9), `{"range":{"age":{"gt":1,"lte":9}}}`},
+		{
+			"bool",
+			Bool().Must(Term("a", 1)).Filter(Term("b", 2), Exists("c")).Should(Term("d", 3)).MustNot(Term("e", 4)).MinimumShouldMatch(1).Boost(1.5),
+			`{"bool":{"must":[{"term":{"a":1}}],"filter":[{"term":{"b":2}},{"exists":{"field":"c"}}],"should":[{"term":{"d":3}}],"must_not":[{"term":{"e":4}}],"minimum_should_match":1,"boost":1.5}}`,
+		},
+		{"empty bool", Bool(), `{"bool":{}}`},
+		{
+			"nested",
+			Nested("comments", Term("comments.author", "a")).ScoreMode("max"),
+			`{"nested":{"path":"comments","query":{"term":{"comments.author":"a"}},"score_mode":"max"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertSource(t, tt.want, tt.query.Source())
+		})
+	}
+}
+
+func TestAggregations(t *testing.T) {
+	tests := []struct {
+		name string
+		agg  Aggregation
+		want string
+	}{
+		{"terms", TermsAgg("tag").Size(10).Order("_count", false).MinDocCount(2), `{"terms":{"field":"tag","size":10,"order":{"_count":"desc"},"min_doc_count":2}}`},
+		{
+			"date_histogram",
+			DateHistogramAgg("created", "1d").Format("yyyy-MM-dd").TimeZone("+08:00").SubAggregation("amount", SumAgg("amount")),
+			`{"date_histogram":{"field":"created","calendar_interval":"1d","format":"yyyy-MM-dd","time_zone":"+08:00"},"aggs":{"amount":{"sum":{"field":"amount"}}}}`,
+		},
+		{"histogram", HistogramAgg("price", 10).Order("_key", true), `{"histogram":{"field":"price","interval":10,"order":{"_key":"asc"}}}`},
+		{"nested", NestedAgg("comments").SubAggregation("authors", CardinalityAgg("comments.author")), `{"nested":{"path":"comments"},"aggs":{"authors":{"cardinality":{"field":"comments.author"}}}}`},
+		{"filter", FilterAgg(Term("status", 1)).SubAggregation("avg", AvgAgg("price")), `{"filter":{"term":{"status":1}},"aggs":{"avg":{"avg":{"field":"price"}}}}`},
+		{"stats", StatsAgg("price"), `{"stats":{"field":"price"}}`},
+		{"min", MinAgg("price"), `{"min":{"field":"price"}}`},
+		{"max", MaxAgg("price"), `{"max":{"field":"price"}}`},
+		{"param", TermsAgg("tag").Param("missing", "N/A"), `{"terms":{"field":"tag","missing":"N/A"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertSource(t, tt.want, tt.agg.Source())
+		})
+	}
+}
+
+func TestFilterAggDoesNotMutateQuery(t *testing.T) {
+	raw := map[string]interface{}{"term": map[string]interface{}{"status": 1}}
+	query := RawQuery(raw)
+	agg := FilterAgg(query).Param("extra", true)
+
+	assertSource(t, `{"filter":{"term":{"status":1},"extra":true}}`, agg.Source())
+	assert.Equal(t, map[string]interface{}{"term": map[string]interface{}{"status": 1}}, raw)
+	assertSource(t, `{"term":{"status":1}}`, query.Source())
+}
+
+func TestSearchSource(t *testing.T) {
+	source := NewSearchSource().
+		Query(Bool().Filter(Term("status", 1))).
+		From(10).
+		Size(20).
+		Sort("created", false).
+		Sort("_id", true).
+		Includes("id", "title").
+		Aggregation("tags", TermsAgg("tag")).
+		TrackTotalHits(true)
+	want := `{
+		"query":{"bool":{"filter":[{"term":{"status":1}}]}},
+		"from":10,
+		"size":20,
+		"sort":[{"created":{"order":"desc"}},{"_id":{"order":"asc"}}],
+		"_source":["id","title"],
+		"aggs":{"tags":{"terms":{"field":"tag"}}},
+		"track_total_hits":true
+	}`
+	assertSource(t, want, source)
+
+	reader, err := source.Reader()
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.JSONEq(t, want, string(data))
+
+	assertSource(t, `{}`, NewSearchSource())
+	// size为0时也输出
+	assertSource(t, `{"size":0}`, NewSearchSource().Size(0))
+}
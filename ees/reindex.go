@@ -0,0 +1,238 @@
+package ees
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+// reindexOptions Reindex的选项
+type reindexOptions struct {
+	requestsPerSecond int
+	slices            interface{}
+	pollInterval      time.Duration
+	deleteOld         bool
+	indexName         func(alias string, t time.Time) string
+}
+
+// ReindexOption Reindex的选项
+type ReindexOption func(o *reindexOptions)
+
+// WithReindexRequestsPerSecond 限制每秒写入的文档数，默认不限制
+func WithReindexRequestsPerSecond(n int) ReindexOption {
+	return func(o *reindexOptions) {
+		o.requestsPerSecond = n
+	}
+}
+
+// WithReindexSlices 并行执行的分片数，如auto，默认1
+func WithReindexSlices(slices interface{}) ReindexOption {
+	return func(o *reindexOptions) {
+		o.slices = slices
+	}
+}
+
+// WithReindexPollInterval 检查reindex任务是否完成的间隔，默认5s
+func WithReindexPollInterval(interval time.Duration) ReindexOption {
+	return func(o *reindexOptions) {
+		o.pollInterval = interval
+	}
+}
+
+// WithReindexDeleteOld 切换别名后删除原来的索引，默认保留原来的索引并保持只读，确认新索引的数据无误后由人工删除
+func WithReindexDeleteOld() ReindexOption {
+	return func(o *reindexOptions) {
+		o.deleteOld = true
+	}
+}
+
+// WithReindexIndexName 新索引的命名方式，默认为alias_20060102150405
+func WithReindexIndexName(fn func(alias string, t time.Time) string) ReindexOption {
+	return func(o *reindexOptions) {
+		o.indexName = fn
+	}
+}
+
+// Reindex 不停机重建索引：使用newMapping（创建索引的body，包含settings、mappings）创建新索引，
+// 将alias指向的索引中的数据按限速复制到新索引，完成后原子地将alias切换到新索引。
+// alias不存在时直接创建新索引并设置alias。返回新索引的名称。
+// 第一遍复制期间原索引可以正常写入；复制完成后给原索引加上写入阻塞，再按文档版本补一遍复制期间新增、修改的文档，
+// 之后切换alias。补写期间写入原索引的请求会返回cluster_block_exception，需要业务重试。
+// 复制期间删除的文档不会从新索引中删除。原索引默认保留并保持只读，使用WithReindexDeleteOld在切换后删除
+func (c *Component) Reindex(ctx context.Context, alias string, newMapping interface{}, opts ...ReindexOption) (string, error) {
+	o := &reindexOptions{
+		pollInterval: 5 * time.Second,
+		indexName: func(alias string, t time.Time) string {
+			return alias + "_" + t.Format("20060102150405")
+		},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	oldIndices, err := c.aliasIndices(ctx, alias)
+	if err != nil {
+		return "", err
+	}
+	newIndex := o.indexName(alias, time.Now())
+	if err := c.createIndex(ctx, newIndex, newMapping); err != nil {
+		return "", err
+	}
+
+	if len(oldIndices) > 0 {
+		if err := c.reindex(ctx, oldIndices, newIndex, false, o); err != nil {
+			return "", err
+		}
+		if err := c.setWriteBlock(ctx, oldIndices, true); err != nil {
+			return "", err
+		}
+		if err := c.reindex(ctx, oldIndices, newIndex, true, o); err != nil {
+			c.unblockWrite(oldIndices)
+			return "", err
+		}
+	}
+
+	actions := make([]interface{}, 0, len(oldIndices)+1)
+	for _, index := range oldIndices {
+		actions = append(actions, map[string]interface{}{"remove": map[string]interface{}{"index": index, "alias": alias}})
+	}
+	actions = append(actions, map[string]interface{}{"add": map[string]interface{}{"index": newIndex, "alias": alias}})
+	body, err := json.Marshal(map[string]interface{}{"actions": actions})
+	if err != nil {
+		return "", err
+	}
+	res, err := c.Client.Indices.UpdateAliases(bytes.NewReader(body), c.Client.Indices.UpdateAliases.WithContext(ctx))
+	if err := decodeResponse(res, err, nil); err != nil {
+		c.unblockWrite(oldIndices)
+		return "", fmt.Errorf("ees: switch alias %s to %s fail, %w", alias, newIndex, err)
+	}
+	c.logger.Info("reindex switch alias", elog.String("alias", alias), elog.Any("from", oldIndices), elog.String("to", newIndex))
+
+	if !o.deleteOld || len(oldIndices) == 0 {
+		return newIndex, nil
+	}
+	res, err = c.Client.Indices.Delete(oldIndices, c.Client.Indices.Delete.WithContext(ctx))
+	if err := decodeResponse(res, err, nil); err != nil {
+		// 别名已经切换，删除失败不影响使用，记录日志后由人工清理
+		c.logger.Error("reindex delete old index", elog.FieldErr(err), elog.Any("indices", oldIndices))
+	}
+	return newIndex, nil
+}
+
+// aliasIndices 返回alias指向的索引，alias不存在时返回空
+func (c *Component) aliasIndices(ctx context.Context, alias string) ([]string, error) {
+	var resp map[string]interface{}
+	res, err := c.Client.Indices.GetAlias(c.Client.Indices.GetAlias.WithName(alias), c.Client.Indices.GetAlias.WithContext(ctx))
+	err = decodeResponse(res, err, &resp)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ees: get alias %s fail, %w", alias, err)
+	}
+	indices := make([]string, 0, len(resp))
+	for index := range resp {
+		indices = append(indices, index)
+	}
+	return indices, nil
+}
+
+// setWriteBlock 设置索引的写入阻塞
+func (c *Component) setWriteBlock(ctx context.Context, indices []string, block bool) error {
+	body, err := json.Marshal(map[string]interface{}{"index": map[string]interface{}{"blocks": map[string]interface{}{"write": block}}})
+	if err != nil {
+		return err
+	}
+	res, err := c.Client.Indices.PutSettings(bytes.NewReader(body), c.Client.Indices.PutSettings.WithIndex(indices...), c.Client.Indices.PutSettings.WithContext(ctx))
+	if err := decodeResponse(res, err, nil); err != nil {
+		return fmt.Errorf("ees: set write block of %v to %t fail, %w", indices, block, err)
+	}
+	return nil
+}
+
+// unblockWrite 重建失败时恢复原索引的写入，ctx可能已经结束，使用单独的ctx
+func (c *Component) unblockWrite(indices []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.setWriteBlock(ctx, indices, false); err != nil {
+		c.logger.Error("reindex unblock write", elog.FieldErr(err), elog.Any("indices", indices))
+	}
+}
+
+// reindex 提交异步的reindex任务，等待任务完成。catchUp为true时使用原索引的版本号写入，
+// 只覆盖新索引中版本更低的文档，版本冲突的文档跳过
+func (c *Component) reindex(ctx context.Context, source []string, dest string, catchUp bool, o *reindexOptions) error {
+	request := map[string]interface{}{
+		"source": map[string]interface{}{"index": source},
+		"dest":   map[string]interface{}{"index": dest},
+	}
+	if catchUp {
+		request["dest"] = map[string]interface{}{"index": dest, "version_type": "external"}
+		request["conflicts"] = "proceed"
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	reindexOpts := []func(*esapi.ReindexRequest){
+		c.Client.Reindex.WithContext(ctx),
+		c.Client.Reindex.WithWaitForCompletion(false),
+	}
+	if o.requestsPerSecond > 0 {
+		reindexOpts = append(reindexOpts, c.Client.Reindex.WithRequestsPerSecond(o.requestsPerSecond))
+	}
+	if o.slices != nil {
+		reindexOpts = append(reindexOpts, c.Client.Reindex.WithSlices(o.slices))
+	}
+	var task struct {
+		Task string `json:"task"`
+	}
+	res, err := c.Client.Reindex(bytes.NewReader(body), reindexOpts...)
+	if err := decodeResponse(res, err, &task); err != nil {
+		return fmt.Errorf("ees: reindex to %s fail, %w", dest, err)
+	}
+	c.logger.Info("reindex start", elog.Any("source", source), elog.String("dest", dest), elog.Any("catchUp", catchUp), elog.String("task", task.Task))
+
+	ticker := time.NewTicker(o.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		var status struct {
+			Completed bool `json:"completed"`
+			Task      struct {
+				Status struct {
+					Total   int64 `json:"total"`
+					Created int64 `json:"created"`
+				} `json:"status"`
+			} `json:"task"`
+			Response struct {
+				Failures []json.RawMessage `json:"failures"`
+			} `json:"response"`
+			Error json.RawMessage `json:"error"`
+		}
+		res, err := c.Client.Tasks.Get(task.Task, c.Client.Tasks.Get.WithContext(ctx))
+		if err := decodeResponse(res, err, &status); err != nil {
+			return fmt.Errorf("ees: get reindex task %s fail, %w", task.Task, err)
+		}
+		if !status.Completed {
+			c.logger.Info("reindex progress", elog.String("task", task.Task), elog.Int64("total", status.Task.Status.Total), elog.Int64("created", status.Task.Status.Created))
+			continue
+		}
+		if len(status.Error) > 0 {
+			return fmt.Errorf("ees: reindex task %s fail, %s", task.Task, status.Error)
+		}
+		if len(status.Response.Failures) > 0 {
+			return fmt.Errorf("ees: reindex task %s has %d failures, first: %s", task.Task, len(status.Response.Failures), status.Response.Failures[0])
+		}
+		return nil
+	}
+}
@@ -0,0 +1,122 @@
+package ees
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeReindexServer 记录Reindex发出的请求，alias为空时别名不存在，failTask对应的任务返回错误
+type fakeReindexServer struct {
+	mu        sync.Mutex
+	alias     string
+	failTask  string
+	requests  []string
+	reindexes []map[string]interface{}
+}
+
+func (s *fakeReindexServer) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, _ := ioutil.ReadAll(r.Body)
+	request := r.Method + " " + r.URL.Path
+	if strings.HasSuffix(r.URL.Path, "/_settings") {
+		request += " " + string(body)
+	}
+	s.requests = append(s.requests, request)
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/_alias/"):
+		if s.alias == "" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":"alias [users] missing","status":404}`))
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{%q:{"aliases":{"users":{}}}}`, s.alias)
+	case r.URL.Path == "/_reindex":
+		var reindex map[string]interface{}
+		_ = json.Unmarshal(body, &reindex)
+		s.reindexes = append(s.reindexes, reindex)
+		_, _ = fmt.Fprintf(w, `{"task":"t%d"}`, len(s.reindexes))
+	case strings.HasPrefix(r.URL.Path, "/_tasks/"):
+		if strings.TrimPrefix(r.URL.Path, "/_tasks/") == s.failTask {
+			_, _ = w.Write([]byte(`{"completed":true,"error":{"type":"search_phase_execution_exception"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"completed":true,"response":{"failures":[]}}`))
+	default:
+		_, _ = w.Write([]byte(`{"acknowledged":true}`))
+	}
+}
+
+var reindexTestOptions = []ReindexOption{
+	WithReindexPollInterval(time.Millisecond),
+	WithReindexIndexName(func(alias string, t time.Time) string { return alias + "_new" }),
+}
+
+func TestReindex(t *testing.T) {
+	srv := &fakeReindexServer{alias: "users_old"}
+	c := newTestComponent(t, srv.handle)
+	index, err := c.Reindex(context.Background(), "users", map[string]interface{}{"mappings": map[string]interface{}{}}, reindexTestOptions...)
+	require.NoError(t, err)
+	assert.Equal(t, "users_new", index)
+
+	// 复制后阻塞写入、补写，再切换别名，默认保留原索引
+	assert.Equal(t, []string{
+		"GET /_alias/users",
+		"PUT /users_new",
+		"POST /_reindex",
+		"GET /_tasks/t1",
+		`PUT /users_old/_settings {"index":{"blocks":{"write":true}}}`,
+		"POST /_reindex",
+		"GET /_tasks/t2",
+		"POST /_aliases",
+	}, srv.requests)
+	require.Len(t, srv.reindexes, 2)
+	assert.Equal(t, map[string]interface{}{
+		"source": map[string]interface{}{"index": []interface{}{"users_old"}},
+		"dest":   map[string]interface{}{"index": "users_new"},
+	}, srv.reindexes[0])
+	assert.Equal(t, map[string]interface{}{
+		"source":    map[string]interface{}{"index": []interface{}{"users_old"}},
+		"dest":      map[string]interface{}{"index": "users_new", "version_type": "external"},
+		"conflicts": "proceed",
+	}, srv.reindexes[1])
+}
+
+func TestReindexDeleteOld(t *testing.T) {
+	srv := &fakeReindexServer{alias: "users_old"}
+	c := newTestComponent(t, srv.handle)
+	_, err := c.Reindex(context.Background(), "users", nil, append(reindexTestOptions, WithReindexDeleteOld())...)
+	require.NoError(t, err)
+	assert.Equal(t, "DELETE /users_old", srv.requests[len(srv.requests)-1])
+}
+
+func TestReindexNewAlias(t *testing.T) {
+	srv := &fakeReindexServer{}
+	c := newTestComponent(t, srv.handle)
+	_, err := c.Reindex(context.Background(), "users", nil, append(reindexTestOptions, WithReindexDeleteOld())...)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"GET /_alias/users", "PUT /users_new", "POST /_aliases"}, srv.requests)
+}
+
+func TestReindexCatchUpFail(t *testing.T) {
+	srv := &fakeReindexServer{alias: "users_old", failTask: "t2"}
+	c := newTestComponent(t, srv.handle)
+	_, err := c.Reindex(context.Background(), "users", nil, reindexTestOptions...)
+	assert.Error(t, err)
+
+	// 补写失败时恢复原索引的写入，不切换别名
+	assert.Equal(t, `PUT /users_old/_settings {"index":{"blocks":{"write":false}}}`, srv.requests[len(srv.requests)-1])
+	assert.NotContains(t, srv.requests, "POST /_aliases")
+}
@@ -0,0 +1,74 @@
+package ees
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+)
+
+// ResponseError Elasticsearch返回的错误
+type ResponseError struct {
+	StatusCode int
+	Type       string // 错误类型，如index_not_found_exception、resource_already_exists_exception
+	Reason     string
+}
+
+// Error ...
+func (e *ResponseError) Error() string {
+	return fmt.Sprintf("ees: status %d, %s: %s", e.StatusCode, e.Type, e.Reason)
+}
+
+// IsNotFound 是否为404，支持被fmt.Errorf("%w")包装的错误
+func IsNotFound(err error) bool {
+	var respErr *ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// decodeResponse 检查请求结果，失败时返回ResponseError，成功时将响应解析到out中，out为nil时忽略响应
+func decodeResponse(res *esapi.Response, err error, out interface{}) error {
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.IsError() {
+		return newResponseError(res.StatusCode, res.Body)
+	}
+	if out == nil {
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("ees: decode response fail, %w", err)
+	}
+	return nil
+}
+
+// newResponseError 解析错误响应，响应不是Elasticsearch的错误格式时Reason为响应内容
+func newResponseError(statusCode int, body io.Reader) *ResponseError {
+	respErr := &ResponseError{StatusCode: statusCode}
+	data, _ := ioutil.ReadAll(body)
+	var e struct {
+		Error json.RawMessage `json:"error"`
+	}
+	if json.Unmarshal(data, &e) != nil || len(e.Error) == 0 {
+		respErr.Reason = string(data)
+		return respErr
+	}
+	var detail struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+	if json.Unmarshal(e.Error, &detail) != nil {
+		// 部分接口的error为字符串
+		respErr.Reason = string(e.Error)
+		return respErr
+	}
+	respErr.Type = detail.Type
+	respErr.Reason = detail.Reason
+	return respErr
+}
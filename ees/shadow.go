@@ -0,0 +1,326 @@
+package ees
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/gotomicro/ego/core/emetric"
+)
+
+// shadowCounter 影子集群请求结果，result为ok（与主集群一致）、diverged（与主集群不一致）、error（请求失败）、dropped（队列已满丢弃）
+var shadowCounter = emetric.CounterVecOpts{
+	Namespace: emetric.DefaultNamespace,
+	Name:      "es_shadow_total",
+	Help:      "Number of requests mirrored to the shadow elasticsearch cluster by operation and result",
+	Labels:    []string{"name", "operation", "result"},
+}.Build()
+
+// ShadowConfig 影子集群配置，用于集群迁移、版本升级前的双写验证
+type ShadowConfig struct {
+	Addrs       []string // 影子集群的地址，为空时不开启双写
+	Username    string   // Username for HTTP Basic Authentication.
+	Password    string   // Password for HTTP Basic Authentication.
+	APIKey      string   // Base64-encoded token for authorization.
+	QueueSize   int      // 等待写入影子集群的请求数，超过后丢弃，默认10000
+	QueueBytes  int      // 等待写入影子集群的请求的总字节数，包含请求内容和需要对比的主集群响应，超过后丢弃，默认64MB
+	Workers     int      // 写入影子集群的并发数，默认4
+	VerifyReads float64  // 按该比例将读取文档的请求发送到影子集群，对比返回的文档，默认0不对比；双写是异步的，刚写入的文档可能短暂不一致
+
+	// 影子集群的TLS配置，含义与主集群的配置相同，都为空时使用主集群的TLS配置
+	CaCert                 string
+	CertificateFingerprint string
+	CertFile               string
+	KeyFile                string
+	InsecureSkipVerify     bool
+}
+
+// tls 影子集群的TLS配置，没有单独配置时返回nil
+func (c ShadowConfig) tls() *config {
+	if c.CaCert == "" && c.CertificateFingerprint == "" && c.CertFile == "" && c.KeyFile == "" && !c.InsecureSkipVerify {
+		return nil
+	}
+	return &config{
+		CaCert:                 c.CaCert,
+		CertificateFingerprint: c.CertificateFingerprint,
+		CertFile:               c.CertFile,
+		KeyFile:                c.KeyFile,
+		InsecureSkipVerify:     c.InsecureSkipVerify,
+	}
+}
+
+// shadowRequest 需要发送到影子集群的请求
+type shadowRequest struct {
+	operation string
+	method    string
+	url       string
+	header    http.Header
+	body      []byte
+	status    int    // 主集群返回的状态码
+	primary   []byte // 主集群返回的内容，只有对比读取和bulk请求时记录
+}
+
+// size 请求占用的字节数
+func (sr shadowRequest) size() int64 {
+	return int64(len(sr.url) + len(sr.body) + len(sr.primary))
+}
+
+// shadowTransport 主集群写入成功后异步将请求发送到影子集群，不影响主集群请求的耗时和结果
+type shadowTransport struct {
+	name   string
+	config ShadowConfig
+	logger *elog.Component
+	rt     http.RoundTripper
+	client *elasticsearch.Client
+	queue  chan shadowRequest
+	queued int64 // 队列中请求的字节数
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+}
+
+// newShadowTransport rt为发送到主集群的Transport，影子集群没有单独的TLS配置时也使用rt
+func newShadowTransport(name string, config ShadowConfig, logger *elog.Component, rt http.RoundTripper) (*shadowTransport, error) {
+	if config.QueueSize <= 0 {
+		config.QueueSize = 10000
+	}
+	if config.QueueBytes <= 0 {
+		config.QueueBytes = 64 << 20
+	}
+	if config.Workers <= 0 {
+		config.Workers = 4
+	}
+	transport := rt
+	if tlsConfig := config.tls(); tlsConfig != nil {
+		var err error
+		if transport, err = newHTTPTransport(tlsConfig); err != nil {
+			return nil, err
+		}
+	}
+	client, err := elasticsearch.NewClient(elasticsearch.Config{
+		Addresses: config.Addrs,
+		Username:  config.Username,
+		Password:  config.Password,
+		APIKey:    config.APIKey,
+		Transport: transport,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &shadowTransport{
+		name:   name,
+		config: config,
+		logger: logger.With(elog.String("shadow", "true")),
+		rt:     rt,
+		client: client,
+		queue:  make(chan shadowRequest, config.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	t.wg.Add(config.Workers)
+	for i := 0; i < config.Workers; i++ {
+		go t.work()
+	}
+	return t, nil
+}
+
+// RoundTrip ...
+func (t *shadowTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	_, operation := parsePath(req.URL.Path)
+	write := isShadowWrite(req.Method, operation)
+	verify := !write && isShadowRead(req.Method, operation) && t.config.VerifyReads > 0 && rand.Float64() < t.config.VerifyReads
+	if !write && !verify {
+		return t.rt.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		body, _ = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		return resp, err
+	}
+
+	sr := shadowRequest{
+		operation: operation,
+		method:    req.Method,
+		url:       req.URL.RequestURI(),
+		header:    req.Header.Clone(),
+		body:      body,
+		status:    resp.StatusCode,
+	}
+	// bulk部分失败时状态码仍然是200，需要对比每条数据的结果
+	if verify || operation == "bulk" {
+		sr.primary, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(bytes.NewReader(sr.primary))
+	}
+	t.enqueue(sr)
+	return resp, err
+}
+
+// enqueue 将请求放入队列，队列已满、超过字节数限制或者已经关闭时丢弃
+func (t *shadowTransport) enqueue(sr shadowRequest) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	size := sr.size()
+	if t.closed {
+		shadowCounter.Inc(t.name, sr.operation, "dropped")
+		return
+	}
+	if atomic.AddInt64(&t.queued, size) > int64(t.config.QueueBytes) {
+		atomic.AddInt64(&t.queued, -size)
+		shadowCounter.Inc(t.name, sr.operation, "dropped")
+		return
+	}
+	select {
+	case t.queue <- sr:
+	default:
+		atomic.AddInt64(&t.queued, -size)
+		shadowCounter.Inc(t.name, sr.operation, "dropped")
+	}
+}
+
+// close 停止worker，正在发送的请求被取消，队列中剩余的请求丢弃
+func (t *shadowTransport) close() {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		return
+	}
+	t.closed = true
+	t.mu.Unlock()
+
+	t.cancel()
+	t.wg.Wait()
+	for {
+		select {
+		case sr := <-t.queue:
+			atomic.AddInt64(&t.queued, -sr.size())
+			shadowCounter.Inc(t.name, sr.operation, "dropped")
+		default:
+			return
+		}
+	}
+}
+
+// work 从队列中取出请求发送到影子集群
+func (t *shadowTransport) work() {
+	defer t.wg.Done()
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case sr := <-t.queue:
+			atomic.AddInt64(&t.queued, -sr.size())
+			t.send(sr)
+		}
+	}
+}
+
+// send 将请求发送到影子集群，对比结果
+func (t *shadowTransport) send(sr shadowRequest) {
+	req, err := http.NewRequestWithContext(t.ctx, sr.method, sr.url, bytes.NewReader(sr.body))
+	if err != nil {
+		shadowCounter.Inc(t.name, sr.operation, "error")
+		return
+	}
+	for k, v := range sr.header {
+		// 认证信息使用影子集群的配置
+		if k == "Authorization" {
+			continue
+		}
+		req.Header[k] = v
+	}
+	resp, err := t.client.Perform(req)
+	if err != nil {
+		shadowCounter.Inc(t.name, sr.operation, "error")
+		t.logger.Error("shadow request", elog.FieldErr(err), elog.FieldMethod(sr.operation), elog.String("url", sr.url))
+		return
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	var same bool
+	switch {
+	case sr.operation == "bulk":
+		same = statusClass(sr.status) == statusClass(resp.StatusCode) && sameBulkResult(sr.primary, body)
+	case sr.primary != nil:
+		same = sameDocument(sr.primary, body)
+	default:
+		same = statusClass(sr.status) == statusClass(resp.StatusCode)
+	}
+	result := "ok"
+	if !same {
+		result = "diverged"
+		t.logger.Warn("shadow diverged", elog.FieldMethod(sr.operation), elog.String("url", sr.url), elog.Int("primaryStatus", sr.status), elog.Int("shadowStatus", resp.StatusCode))
+	}
+	shadowCounter.Inc(t.name, sr.operation, result)
+}
+
+// isShadowWrite 是否为需要双写的文档写入请求，索引管理等请求不双写
+func isShadowWrite(method string, operation string) bool {
+	if method == http.MethodGet || method == http.MethodHead {
+		return false
+	}
+	switch operation {
+	case "doc", "create", "update", "bulk", "delete_by_query", "update_by_query":
+		return true
+	}
+	return false
+}
+
+// isShadowRead 是否为可以对比的文档读取请求
+func isShadowRead(method string, operation string) bool {
+	return method == http.MethodGet && operation == "doc"
+}
+
+func statusClass(status int) int {
+	return status / 100
+}
+
+// sameBulkResult 对比两个集群bulk请求中每条数据的状态码类别，主集群部分失败时影子集群也应该失败
+func sameBulkResult(primary []byte, shadow []byte) bool {
+	var p, s struct {
+		Items []map[string]struct {
+			Status int `json:"status"`
+		} `json:"items"`
+	}
+	if json.Unmarshal(primary, &p) != nil || json.Unmarshal(shadow, &s) != nil || len(p.Items) != len(s.Items) {
+		return false
+	}
+	for i := range p.Items {
+		for action, item := range p.Items[i] {
+			if statusClass(item.Status) != statusClass(s.Items[i][action].Status) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sameDocument 对比两个集群返回的文档是否一致，只比较found和_source
+func sameDocument(primary []byte, shadow []byte) bool {
+	var p, s struct {
+		Found  bool        `json:"found"`
+		Source interface{} `json:"_source"`
+	}
+	if json.Unmarshal(primary, &p) != nil || json.Unmarshal(shadow, &s) != nil {
+		return false
+	}
+	return p.Found == s.Found && reflect.DeepEqual(p.Source, s.Source)
+}
@@ -0,0 +1,220 @@
+package ees
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestIsShadowWrite(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   bool
+	}{
+		{http.MethodPut, "/users/_doc/1", true},
+		{http.MethodPost, "/users/_doc", true},
+		{http.MethodDelete, "/users/_doc/1", true},
+		{http.MethodPut, "/users/_create/1", true},
+		{http.MethodPost, "/users/_update/1", true},
+		{http.MethodPost, "/_bulk", true},
+		{http.MethodPost, "/users/_delete_by_query", true},
+		{http.MethodPost, "/users/_update_by_query", true},
+		{http.MethodGet, "/users/_doc/1", false},
+		{http.MethodHead, "/users/_doc/1", false},
+		{http.MethodPost, "/users/_search", false},
+		{http.MethodPut, "/users", false},
+		{http.MethodDelete, "/users", false},
+		{http.MethodPut, "/users/_mapping", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			_, operation := parsePath(tt.path)
+			assert.Equal(t, tt.want, isShadowWrite(tt.method, operation))
+		})
+	}
+}
+
+func TestSameDocument(t *testing.T) {
+	tests := []struct {
+		name    string
+		primary string
+		shadow  string
+		want    bool
+	}{
+		{"same", `{"_id":"1","_version":3,"found":true,"_source":{"a":1,"b":[1,2]}}`, `{"_id":"1","_version":1,"found":true,"_source":{"b":[1,2],"a":1}}`, true},
+		{"both missing", `{"found":false}`, `{"found":false}`, true},
+		{"missing in shadow", `{"found":true,"_source":{"a":1}}`, `{"found":false}`, false},
+		{"different source", `{"found":true,"_source":{"a":1}}`, `{"found":true,"_source":{"a":2}}`, false},
+		{"invalid", `{"found":true}`, `<html>`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sameDocument([]byte(tt.primary), []byte(tt.shadow)))
+		})
+	}
+}
+
+func TestSameBulkResult(t *testing.T) {
+	tests := []struct {
+		name    string
+		primary string
+		shadow  string
+		want    bool
+	}{
+		{"same", `{"errors":false,"items":[{"index":{"status":201}},{"delete":{"status":200}}]}`, `{"errors":false,"items":[{"index":{"status":200}},{"delete":{"status":200}}]}`, true},
+		{"same partial failure", `{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":400}}]}`, `{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":409}}]}`, true},
+		{"partial failure in shadow", `{"errors":false,"items":[{"index":{"status":201}},{"index":{"status":201}}]}`, `{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":429}}]}`, false},
+		{"different length", `{"items":[{"index":{"status":201}}]}`, `{"items":[]}`, false},
+		{"different action", `{"items":[{"index":{"status":201}}]}`, `{"items":[{"create":{"status":201}}]}`, false},
+		{"invalid", `{"items":[]}`, `<html>`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sameBulkResult([]byte(tt.primary), []byte(tt.shadow)))
+		})
+	}
+}
+
+// newShadowServer 返回影子集群，记录收到的请求数
+func newShadowServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, *int32) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func shadowRoundTrip(t *testing.T, rt http.RoundTripper, method string, url string, body string) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	resp, err := rt.RoundTrip(req)
+	require.NoError(t, err)
+	_, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+}
+
+func TestShadowTransportBulk(t *testing.T) {
+	primary := httptest.NewServer(bulkHandler(func(string) int { return http.StatusCreated }))
+	defer primary.Close()
+	shadow, requests := newShadowServer(t, bulkHandler(func(id string) int {
+		if id == "2" {
+			return http.StatusTooManyRequests
+		}
+		return http.StatusCreated
+	}))
+
+	core, logs := observer.New(zap.InfoLevel)
+	logger := elog.DefaultContainer().Build(elog.WithZapCore(core))
+	st, err := newShadowTransport("test", ShadowConfig{Addrs: []string{shadow.URL}, Workers: 1}, logger, http.DefaultTransport)
+	require.NoError(t, err)
+	defer st.close()
+
+	shadowRoundTrip(t, st, http.MethodPost, primary.URL+"/_bulk", "{\"index\":{\"_index\":\"a\",\"_id\":\"1\"}}\n{}\n")
+	require.Eventually(t, func() bool { return atomic.LoadInt32(requests) == 1 }, time.Second, time.Millisecond)
+	// 部分失败的状态码仍然是200，需要按每条数据对比
+	shadowRoundTrip(t, st, http.MethodPost, primary.URL+"/_bulk", "{\"index\":{\"_index\":\"a\",\"_id\":\"1\"}}\n{}\n{\"index\":{\"_index\":\"a\",\"_id\":\"2\"}}\n{}\n")
+	require.Eventually(t, func() bool { return logs.FilterMessage("shadow diverged").Len() == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(requests))
+	assert.Zero(t, atomic.LoadInt64(&st.queued))
+}
+
+func TestShadowTransportQueueBytes(t *testing.T) {
+	primary := httptest.NewServer(bulkHandler(func(string) int { return http.StatusCreated }))
+	defer primary.Close()
+	shadow, requests := newShadowServer(t, bulkHandler(func(string) int { return http.StatusCreated }))
+
+	st, err := newShadowTransport("test", ShadowConfig{Addrs: []string{shadow.URL}, Workers: 1, QueueBytes: 16}, elog.DefaultLogger, http.DefaultTransport)
+	require.NoError(t, err)
+	defer st.close()
+
+	// 超过字节数限制的请求丢弃，不影响主集群
+	shadowRoundTrip(t, st, http.MethodPost, primary.URL+"/_bulk", "{\"index\":{\"_index\":\"a\",\"_id\":\"1\"}}\n{}\n")
+	time.Sleep(20 * time.Millisecond)
+	assert.Zero(t, atomic.LoadInt32(requests))
+	assert.Zero(t, atomic.LoadInt64(&st.queued))
+}
+
+func TestShadowTransportClose(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer primary.Close()
+	release := make(chan struct{})
+	shadow, requests := newShadowServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	defer close(release)
+
+	st, err := newShadowTransport("test", ShadowConfig{Addrs: []string{shadow.URL}, Workers: 1}, elog.DefaultLogger, http.DefaultTransport)
+	require.NoError(t, err)
+	shadowRoundTrip(t, st, http.MethodPut, primary.URL+"/a/_doc/1", `{}`)
+	require.Eventually(t, func() bool { return atomic.LoadInt32(requests) == 1 }, time.Second, time.Millisecond)
+	shadowRoundTrip(t, st, http.MethodPut, primary.URL+"/a/_doc/2", `{}`)
+
+	// 取消正在发送的请求，丢弃队列中的请求
+	closed := make(chan struct{})
+	go func() {
+		st.close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("close blocked by the shadow request")
+	}
+	assert.Zero(t, atomic.LoadInt64(&st.queued))
+
+	// 关闭后只写入主集群
+	shadowRoundTrip(t, st, http.MethodPut, primary.URL+"/a/_doc/3", `{}`)
+	assert.Zero(t, atomic.LoadInt64(&st.queued))
+	assert.Equal(t, int32(1), atomic.LoadInt32(requests))
+	st.close()
+}
+
+func TestShadowTransportTLS(t *testing.T) {
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer primary.Close()
+	var requests int32
+	shadow := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer shadow.Close()
+
+	dir, err := ioutil.TempDir("", "ees-shadow")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	caCert := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(caCert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: shadow.Certificate().Raw}), 0600))
+
+	core, logs := observer.New(zap.InfoLevel)
+	logger := elog.DefaultContainer().Build(elog.WithZapCore(core))
+	st, err := newShadowTransport("test", ShadowConfig{Addrs: []string{shadow.URL}, Workers: 1, CaCert: caCert}, logger, http.DefaultTransport)
+	require.NoError(t, err)
+	defer st.close()
+
+	shadowRoundTrip(t, st, http.MethodPut, primary.URL+"/a/_doc/1", `{}`)
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&requests) == 1 }, time.Second, time.Millisecond)
+	assert.Zero(t, logs.FilterMessage("shadow request").Len())
+}
@@ -0,0 +1,228 @@
+package ees
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+)
+
+// ErrNoSnapshotRepository 没有指定快照仓库，也没有配置SnapshotRepository
+var ErrNoSnapshotRepository = errors.New("ees: snapshot repository is empty")
+
+// SnapshotOptions 创建、恢复快照的选项
+type SnapshotOptions struct {
+	Indices            []string // 索引，支持通配符，为空时为所有索引
+	IncludeGlobalState bool     // 是否包含集群状态，如模板、ILM策略
+	Partial            bool     // 创建时允许部分分片不可用；恢复时允许恢复部分分片
+	WaitForCompletion  bool     // 是否等待完成，不等待时只返回是否已接受
+	RenamePattern      string   // 恢复时重命名索引的正则，如index_(.+)
+	RenameReplacement  string   // 恢复时重命名索引的替换，如restored_index_$1
+}
+
+// SnapshotInfo 快照信息
+type SnapshotInfo struct {
+	Snapshot          string            `json:"snapshot"`
+	UUID              string            `json:"uuid"`
+	Repository        string            `json:"repository"`
+	State             string            `json:"state"` // IN_PROGRESS、SUCCESS、FAILED、PARTIAL
+	Indices           []string          `json:"indices"`
+	StartTimeInMillis int64             `json:"start_time_in_millis"`
+	EndTimeInMillis   int64             `json:"end_time_in_millis"`
+	Failures          []json.RawMessage `json:"failures"`
+	Shards            struct {
+		Total      int `json:"total"`
+		Failed     int `json:"failed"`
+		Successful int `json:"successful"`
+	} `json:"shards"`
+}
+
+// StartTime 开始时间
+func (s *SnapshotInfo) StartTime() time.Time {
+	return time.UnixMilli(s.StartTimeInMillis)
+}
+
+// EndTime 结束时间，未完成时为零值
+func (s *SnapshotInfo) EndTime() time.Time {
+	if s.EndTimeInMillis == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(s.EndTimeInMillis)
+}
+
+// Done 快照是否已经结束，结束不代表成功，需要判断State
+func (s *SnapshotInfo) Done() bool {
+	return s.State != "" && s.State != "IN_PROGRESS"
+}
+
+// CreateSnapshotRepository 创建或更新快照仓库，如typ为fs时settings为{"location": "/backup"}，typ为s3时为{"bucket": "es-backup"}
+func (c *Component) CreateSnapshotRepository(ctx context.Context, repository string, typ string, settings map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"type": typ, "settings": settings})
+	if err != nil {
+		return err
+	}
+	res, err := c.Client.Snapshot.CreateRepository(repository, bytes.NewReader(body), c.Client.Snapshot.CreateRepository.WithContext(ctx))
+	if err := decodeResponse(res, err, nil); err != nil {
+		return fmt.Errorf("ees: create snapshot repository %s fail, %w", repository, err)
+	}
+	return nil
+}
+
+// CreateSnapshot 创建快照，repository为空时使用配置的SnapshotRepository。
+// 等待完成时返回快照信息，否则只返回快照名称，可以通过SnapshotStatus查询进度
+func (c *Component) CreateSnapshot(ctx context.Context, repository string, snapshot string, opts SnapshotOptions) (*SnapshotInfo, error) {
+	repository, err := c.snapshotRepository(repository)
+	if err != nil {
+		return nil, err
+	}
+	params := map[string]interface{}{
+		"include_global_state": opts.IncludeGlobalState,
+		"partial":              opts.Partial,
+	}
+	if len(opts.Indices) > 0 {
+		params["indices"] = strings.Join(opts.Indices, ",")
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Snapshot *SnapshotInfo `json:"snapshot"`
+	}
+	res, err := c.Client.Snapshot.Create(repository, snapshot,
+		c.Client.Snapshot.Create.WithContext(ctx),
+		c.Client.Snapshot.Create.WithBody(bytes.NewReader(body)),
+		c.Client.Snapshot.Create.WithWaitForCompletion(opts.WaitForCompletion),
+	)
+	if err := decodeResponse(res, err, &resp); err != nil {
+		return nil, fmt.Errorf("ees: create snapshot %s/%s fail, %w", repository, snapshot, err)
+	}
+	c.logger.Info("create snapshot", elog.String("repository", repository), elog.String("snapshot", snapshot), elog.Any("indices", opts.Indices))
+	if resp.Snapshot == nil {
+		return &SnapshotInfo{Snapshot: snapshot, Repository: repository, State: "IN_PROGRESS"}, nil
+	}
+	resp.Snapshot.Repository = repository
+	return resp.Snapshot, nil
+}
+
+// RestoreSnapshot 恢复快照，repository为空时使用配置的SnapshotRepository。
+// 恢复的索引不能已经存在并且处于打开状态，可以通过RenamePattern、RenameReplacement恢复为新的索引
+func (c *Component) RestoreSnapshot(ctx context.Context, repository string, snapshot string, opts SnapshotOptions) error {
+	repository, err := c.snapshotRepository(repository)
+	if err != nil {
+		return err
+	}
+	params := map[string]interface{}{
+		"include_global_state": opts.IncludeGlobalState,
+		"partial":              opts.Partial,
+	}
+	if len(opts.Indices) > 0 {
+		params["indices"] = strings.Join(opts.Indices, ",")
+	}
+	if opts.RenamePattern != "" {
+		params["rename_pattern"] = opts.RenamePattern
+		params["rename_replacement"] = opts.RenameReplacement
+	}
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	res, err := c.Client.Snapshot.Restore(repository, snapshot,
+		c.Client.Snapshot.Restore.WithContext(ctx),
+		c.Client.Snapshot.Restore.WithBody(bytes.NewReader(body)),
+		c.Client.Snapshot.Restore.WithWaitForCompletion(opts.WaitForCompletion),
+	)
+	if err := decodeResponse(res, err, nil); err != nil {
+		return fmt.Errorf("ees: restore snapshot %s/%s fail, %w", repository, snapshot, err)
+	}
+	c.logger.Info("restore snapshot", elog.String("repository", repository), elog.String("snapshot", snapshot), elog.Any("indices", opts.Indices))
+	return nil
+}
+
+// SnapshotStatus 查询快照信息，repository为空时使用配置的SnapshotRepository，快照不存在时返回的错误满足IsNotFound
+func (c *Component) SnapshotStatus(ctx context.Context, repository string, snapshot string) (*SnapshotInfo, error) {
+	snapshots, err := c.getSnapshots(ctx, repository, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, &ResponseError{StatusCode: http.StatusNotFound, Type: "snapshot_missing_exception", Reason: snapshot}
+	}
+	return snapshots[0], nil
+}
+
+// ListSnapshots 列出仓库中的所有快照，按开始时间升序，repository为空时使用配置的SnapshotRepository
+func (c *Component) ListSnapshots(ctx context.Context, repository string) ([]*SnapshotInfo, error) {
+	return c.getSnapshots(ctx, repository, "_all")
+}
+
+// DeleteSnapshot 删除快照，repository为空时使用配置的SnapshotRepository
+func (c *Component) DeleteSnapshot(ctx context.Context, repository string, snapshot string) error {
+	repository, err := c.snapshotRepository(repository)
+	if err != nil {
+		return err
+	}
+	res, err := c.Client.Snapshot.Delete(repository, []string{snapshot}, c.Client.Snapshot.Delete.WithContext(ctx))
+	if err := decodeResponse(res, err, nil); err != nil {
+		return fmt.Errorf("ees: delete snapshot %s/%s fail, %w", repository, snapshot, err)
+	}
+	return nil
+}
+
+// WaitSnapshot 按interval轮询快照状态直到结束，快照失败时返回错误
+func (c *Component) WaitSnapshot(ctx context.Context, repository string, snapshot string, interval time.Duration) (*SnapshotInfo, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		info, err := c.SnapshotStatus(ctx, repository, snapshot)
+		if err != nil {
+			return nil, err
+		}
+		if info.Done() {
+			if info.State == "FAILED" {
+				return info, fmt.Errorf("ees: snapshot %s/%s failed, %d failures", info.Repository, snapshot, len(info.Failures))
+			}
+			return info, nil
+		}
+		select {
+		case <-ctx.Done():
+			return info, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Component) getSnapshots(ctx context.Context, repository string, snapshot string) ([]*SnapshotInfo, error) {
+	repository, err := c.snapshotRepository(repository)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Snapshots []*SnapshotInfo `json:"snapshots"`
+	}
+	res, err := c.Client.Snapshot.Get(repository, []string{snapshot}, c.Client.Snapshot.Get.WithContext(ctx))
+	if err := decodeResponse(res, err, &resp); err != nil {
+		return nil, fmt.Errorf("ees: get snapshot %s/%s fail, %w", repository, snapshot, err)
+	}
+	for _, s := range resp.Snapshots {
+		s.Repository = repository
+	}
+	return resp.Snapshots, nil
+}
+
+// snapshotRepository repository为空时返回配置的SnapshotRepository
+func (c *Component) snapshotRepository(repository string) (string, error) {
+	if repository != "" {
+		return repository, nil
+	}
+	if c.config.SnapshotRepository == "" {
+		return "", ErrNoSnapshotRepository
+	}
+	return c.config.SnapshotRepository, nil
+}
@@ -0,0 +1,347 @@
+package ees
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v8/esapi"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+// IndexTemplate 索引模板定义，Body为_index_template接口的内容，如
+// {"index_patterns": ["logs-*"], "template": {"settings": {...}, "mappings": {...}}, "priority": 100}
+type IndexTemplate struct {
+	Name string
+	Body interface{}
+}
+
+// ILMPolicy 索引生命周期策略定义，Body为_ilm/policy接口的内容，如{"policy": {"phases": {...}}}
+type ILMPolicy struct {
+	Name string
+	Body interface{}
+}
+
+// ProvisionDiff 与集群中不一致的模板或者策略
+type ProvisionDiff struct {
+	Kind   string // indexTemplate、ilmPolicy
+	Name   string
+	Detail string // 不一致的原因
+}
+
+// ProvisionReport 模板、策略检查结果
+type ProvisionReport struct {
+	DryRun  bool            // 是否只检查不修改
+	Missing []ProvisionDiff // 集群中不存在，DryRun为false时已经创建
+	Changed []ProvisionDiff // 与集群中不一致，DryRun为false时已经更新
+}
+
+// HasDrift 集群中的模板、策略与声明是否不一致
+func (r *ProvisionReport) HasDrift() bool {
+	return len(r.Missing) > 0 || len(r.Changed) > 0
+}
+
+// EnsureProvisions 对比WithILMPolicy、WithIndexTemplate声明的策略、模板与集群中的是否一致，
+// dryRun为false时创建或者更新，先处理策略，模板中可以引用声明的策略
+func (c *Component) EnsureProvisions(ctx context.Context, dryRun bool) (*ProvisionReport, error) {
+	report := &ProvisionReport{DryRun: dryRun}
+	for _, policy := range c.config.ilmPolicies {
+		existing, err := c.getILMPolicy(ctx, policy.Name)
+		if err != nil {
+			return nil, err
+		}
+		declared, err := normalizeJSON(policy.Body)
+		if err != nil {
+			return nil, fmt.Errorf("ees: invalid ilm policy %s, %w", policy.Name, err)
+		}
+		if !report.add("ilmPolicy", policy.Name, existing, declared) || dryRun {
+			continue
+		}
+		if err := c.putJSON(policy.Body, func(body *bytes.Reader) error {
+			res, err := c.Client.ILM.PutLifecycle(policy.Name, c.Client.ILM.PutLifecycle.WithBody(body), c.Client.ILM.PutLifecycle.WithContext(ctx))
+			return decodeResponse(res, err, nil)
+		}); err != nil {
+			return nil, fmt.Errorf("ees: put ilm policy %s fail, %w", policy.Name, err)
+		}
+	}
+
+	for _, tpl := range c.config.indexTemplates {
+		existing, err := c.getIndexTemplate(ctx, tpl.Name)
+		if err != nil {
+			return nil, err
+		}
+		declared, err := normalizeJSON(tpl.Body)
+		if err != nil {
+			return nil, fmt.Errorf("ees: invalid index template %s, %w", tpl.Name, err)
+		}
+		if !report.add("indexTemplate", tpl.Name, existing, declared) || dryRun {
+			continue
+		}
+		if err := c.putJSON(tpl.Body, func(body *bytes.Reader) error {
+			res, err := c.Client.Indices.PutIndexTemplate(tpl.Name, body, c.Client.Indices.PutIndexTemplate.WithContext(ctx))
+			return decodeResponse(res, err, nil)
+		}); err != nil {
+			return nil, fmt.Errorf("ees: put index template %s fail, %w", tpl.Name, err)
+		}
+	}
+	return report, nil
+}
+
+// add 对比声明与集群中的内容，不一致时记录到report中并返回true
+func (r *ProvisionReport) add(kind string, name string, existing interface{}, declared interface{}) bool {
+	if existing == nil {
+		r.Missing = append(r.Missing, ProvisionDiff{Kind: kind, Name: name, Detail: "not exists"})
+		return true
+	}
+	if path, ok := containsJSON(existing, declared, ""); !ok {
+		r.Changed = append(r.Changed, ProvisionDiff{Kind: kind, Name: name, Detail: "changed at " + path})
+		return true
+	}
+	return false
+}
+
+// getILMPolicy 获取集群中的策略，格式与声明一致，即{"policy": {...}}，不存在时返回nil
+func (c *Component) getILMPolicy(ctx context.Context, name string) (interface{}, error) {
+	var resp map[string]struct {
+		Policy json.RawMessage `json:"policy"`
+	}
+	res, err := c.Client.ILM.GetLifecycle(c.Client.ILM.GetLifecycle.WithPolicy(name), c.Client.ILM.GetLifecycle.WithContext(ctx))
+	err = decodeResponse(res, err, &resp)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ees: get ilm policy %s fail, %w", name, err)
+	}
+	policy, ok := resp[name]
+	if !ok {
+		return nil, nil
+	}
+	var existing interface{}
+	if err := json.Unmarshal(policy.Policy, &existing); err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"policy": existing}, nil
+}
+
+// getIndexTemplate 获取集群中的索引模板，不存在时返回nil
+func (c *Component) getIndexTemplate(ctx context.Context, name string) (interface{}, error) {
+	var resp struct {
+		IndexTemplates []struct {
+			Name          string      `json:"name"`
+			IndexTemplate interface{} `json:"index_template"`
+		} `json:"index_templates"`
+	}
+	res, err := c.Client.Indices.GetIndexTemplate(c.Client.Indices.GetIndexTemplate.WithName(name), c.Client.Indices.GetIndexTemplate.WithContext(ctx))
+	err = decodeResponse(res, err, &resp)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ees: get index template %s fail, %w", name, err)
+	}
+	for _, tpl := range resp.IndexTemplates {
+		if tpl.Name == name {
+			return tpl.IndexTemplate, nil
+		}
+	}
+	return nil, nil
+}
+
+// putJSON 序列化body后执行请求
+func (c *Component) putJSON(body interface{}, do func(body *bytes.Reader) error) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return do(bytes.NewReader(data))
+}
+
+// logProvisionReport 记录模板、策略检查结果
+func (c *Component) logProvisionReport(report *ProvisionReport) {
+	for _, diff := range report.Missing {
+		if report.DryRun {
+			c.logger.Warn("provision missing", elog.String("kind", diff.Kind), elog.FieldName(diff.Name), elog.String("detail", diff.Detail))
+			continue
+		}
+		c.logger.Info("provision created", elog.String("kind", diff.Kind), elog.FieldName(diff.Name), elog.String("detail", diff.Detail))
+	}
+	for _, diff := range report.Changed {
+		if report.DryRun {
+			c.logger.Warn("provision changed", elog.String("kind", diff.Kind), elog.FieldName(diff.Name), elog.String("detail", diff.Detail))
+			continue
+		}
+		c.logger.Info("provision updated", elog.String("kind", diff.Kind), elog.FieldName(diff.Name), elog.String("detail", diff.Detail))
+	}
+}
+
+// normalizeJSON 转换为json.Unmarshal得到的通用结构，用于比较
+func normalizeJSON(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// containsJSON 判断集群中的内容是否包含声明的全部字段，集群会补充默认值、将数字转换为字符串，
+// 所以只比较声明中出现的字段，标量按字符串比较；不一致时返回字段路径
+func containsJSON(existing interface{}, declared interface{}, path string) (string, bool) {
+	switch d := declared.(type) {
+	case map[string]interface{}:
+		e, ok := existing.(map[string]interface{})
+		if !ok {
+			return path, false
+		}
+		for k, v := range d {
+			sub := strings.TrimPrefix(path+"."+k, ".")
+			ev, ok := e[k]
+			if !ok {
+				// settings中的index前缀可以省略，如number_of_shards与index.number_of_shards
+				if index, isMap := e["index"].(map[string]interface{}); isMap {
+					if ev, ok = index[k]; ok {
+						if p, same := containsJSON(ev, v, sub); !same {
+							return p, false
+						}
+						continue
+					}
+				}
+				return sub, false
+			}
+			// settings中可以使用"index.lifecycle.name"的写法，集群返回的是嵌套的结构
+			if k == "settings" {
+				ev, v = expandDottedKeys(ev), expandDottedKeys(v)
+			}
+			if p, same := containsJSON(ev, v, sub); !same {
+				return p, false
+			}
+		}
+		return "", true
+	case []interface{}:
+		e, ok := existing.([]interface{})
+		if !ok || len(e) != len(d) {
+			return path, false
+		}
+		for i := range d {
+			if p, same := containsJSON(e[i], d[i], fmt.Sprintf("%s[%d]", path, i)); !same {
+				return p, false
+			}
+		}
+		return "", true
+	default:
+		if scalarString(existing) != scalarString(declared) {
+			return path, false
+		}
+		return "", true
+	}
+}
+
+// scalarString 标量转换为字符串，数字不使用科学计数法，与集群返回的字符串一致
+func scalarString(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// expandDottedKeys 将{"index.lifecycle.name": "logs"}展开为{"index": {"lifecycle": {"name": "logs"}}}
+func expandDottedKeys(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	out := make(map[string]interface{}, len(m))
+	for k, value := range m {
+		parts := strings.Split(k, ".")
+		cur := out
+		for _, part := range parts[:len(parts)-1] {
+			next, ok := cur[part].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				cur[part] = next
+			}
+			cur = next
+		}
+		mergeValue(cur, parts[len(parts)-1], expandDottedKeys(value))
+	}
+	return out
+}
+
+// mergeValue 设置m[key]，两边都是对象时合并
+func mergeValue(m map[string]interface{}, key string, value interface{}) {
+	existing, ok := m[key].(map[string]interface{})
+	add, isMap := value.(map[string]interface{})
+	if !ok || !isMap {
+		m[key] = value
+		return
+	}
+	for k, v := range add {
+		mergeValue(existing, k, v)
+	}
+}
+
+// DatedIndex 按日期生成索引名，如logs-2021.12.01
+func DatedIndex(prefix string, t time.Time) string {
+	return prefix + "-" + t.Format("2006.01.02")
+}
+
+// EnsureDatedIndex 创建t对应的按日期命名的索引，已经存在时忽略，返回索引名；
+// 索引的settings、mappings由匹配的索引模板提供
+func (c *Component) EnsureDatedIndex(ctx context.Context, prefix string, t time.Time) (string, error) {
+	index := DatedIndex(prefix, t)
+	if err := c.createIndex(ctx, index, nil); err != nil {
+		return "", err
+	}
+	return index, nil
+}
+
+// BootstrapRolloverIndex 为ILM滚动创建第一个索引<alias-{now/d}-000001>，并将alias设置为写入别名，
+// alias已经存在时忽略。模板中需要设置index.lifecycle.rollover_alias为alias
+func (c *Component) BootstrapRolloverIndex(ctx context.Context, alias string) error {
+	res, err := c.Client.Indices.ExistsAlias([]string{alias}, c.Client.Indices.ExistsAlias.WithContext(ctx))
+	err = decodeResponse(res, err, nil)
+	if err == nil {
+		return nil
+	}
+	if !IsNotFound(err) {
+		return fmt.Errorf("ees: check alias %s fail, %w", alias, err)
+	}
+	// 日期数学表达式需要URL编码，esapi会对路径进行编码
+	index := fmt.Sprintf("<%s-{now/d}-000001>", alias)
+	body := map[string]interface{}{
+		"aliases": map[string]interface{}{
+			alias: map[string]interface{}{"is_write_index": true},
+		},
+	}
+	return c.createIndex(ctx, index, body)
+}
+
+// createIndex 创建索引，已经存在时忽略
+func (c *Component) createIndex(ctx context.Context, index string, body interface{}) error {
+	opts := []func(*esapi.IndicesCreateRequest){c.Client.Indices.Create.WithContext(ctx)}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, c.Client.Indices.Create.WithBody(bytes.NewReader(data)))
+	}
+	res, err := c.Client.Indices.Create(index, opts...)
+	err = decodeResponse(res, err, nil)
+	if respErr, ok := err.(*ResponseError); ok && respErr.Type == "resource_already_exists_exception" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("ees: create index %s fail, %w", index, err)
+	}
+	c.logger.Info("create index", elog.String("index", index))
+	return nil
+}
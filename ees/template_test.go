@@ -0,0 +1,111 @@
+package ees
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustJSON(t *testing.T, s string) interface{} {
+	var v interface{}
+	require.NoError(t, json.Unmarshal([]byte(s), &v))
+	return v
+}
+
+func TestContainsJSON(t *testing.T) {
+	// 集群返回的模板，settings为嵌套结构，数字为字符串
+	existing := `{
+		"index_patterns": ["logs-*"],
+		"template": {
+			"settings": {"index": {"number_of_shards": "3", "refresh_interval": "1s", "max_result_window": "1000000", "lifecycle": {"name": "logs", "rollover_alias": "logs"}}},
+			"mappings": {"properties": {"msg": {"type": "text"}, "tags": {"type": "keyword"}}}
+		},
+		"priority": 100
+	}`
+	tests := []struct {
+		name     string
+		declared string
+		path     string
+	}{
+		{name: "same", declared: existing},
+		{name: "index prefix omitted", declared: `{"template": {"settings": {"number_of_shards": 3}}}`},
+		{name: "dotted keys", declared: `{"template": {"settings": {"index.lifecycle.name": "logs", "index.lifecycle.rollover_alias": "logs"}}}`},
+		{name: "dotted keys without index prefix", declared: `{"template": {"settings": {"lifecycle.name": "logs", "number_of_shards": 3}}}`},
+		{name: "dotted and nested keys", declared: `{"template": {"settings": {"index": {"refresh_interval": "1s"}, "index.lifecycle": {"name": "logs"}}}}`},
+		{name: "numbers as strings", declared: `{"template": {"settings": {"index.max_result_window": 1000000}}, "priority": 100}`},
+		{name: "array", declared: `{"index_patterns": ["logs-*"]}`},
+		{name: "dotted value changed", declared: `{"template": {"settings": {"index.lifecycle.name": "metrics"}}}`, path: "template.settings.index.lifecycle.name"},
+		{name: "number changed", declared: `{"template": {"settings": {"number_of_shards": 1}}}`, path: "template.settings.number_of_shards"},
+		{name: "missing setting", declared: `{"template": {"settings": {"index.number_of_replicas": 1}}}`, path: "template.settings.index.number_of_replicas"},
+		{name: "array changed", declared: `{"index_patterns": ["logs-*", "app-*"]}`, path: "index_patterns"},
+		{name: "array item changed", declared: `{"index_patterns": ["app-*"]}`, path: "index_patterns[0]"},
+		{name: "mapping changed", declared: `{"template": {"mappings": {"properties": {"tags": {"type": "text"}}}}}`, path: "template.mappings.properties.tags.type"},
+		{name: "type changed", declared: `{"template": {"mappings": "text"}}`, path: "template.mappings"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, same := containsJSON(mustJSON(t, existing), mustJSON(t, tt.declared), "")
+			assert.Equal(t, tt.path == "", same)
+			assert.Equal(t, tt.path, path)
+		})
+	}
+}
+
+func TestExpandDottedKeys(t *testing.T) {
+	assert.Equal(t, mustJSON(t, `{"index": {"number_of_shards": 1, "lifecycle": {"name": "logs", "rollover_alias": "logs"}}}`),
+		expandDottedKeys(mustJSON(t, `{"index.number_of_shards": 1, "index": {"lifecycle.name": "logs"}, "index.lifecycle": {"rollover_alias": "logs"}}`)))
+	assert.Equal(t, "logs", expandDottedKeys("logs"))
+}
+
+func TestEnsureProvisions(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	c := newTestComponent(t, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/_index_template/logs":
+			if r.Method == http.MethodGet {
+				_, _ = w.Write([]byte(`{"index_templates": [{"name": "logs", "index_template": {"index_patterns": ["logs-*"], "template": {"settings": {"index": {"number_of_shards": "3", "lifecycle": {"name": "logs", "rollover_alias": "logs"}}}}}}]}`))
+				return
+			}
+		case "/_ilm/policy/logs":
+			if r.Method == http.MethodGet {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`{"error": {"type": "resource_not_found_exception"}, "status": 404}`))
+				return
+			}
+		}
+		_, _ = w.Write([]byte(`{"acknowledged": true}`))
+	})
+	c.config.ilmPolicies = []ILMPolicy{{Name: "logs", Body: map[string]interface{}{"policy": map[string]interface{}{"phases": map[string]interface{}{}}}}}
+	c.config.indexTemplates = []IndexTemplate{{Name: "logs", Body: map[string]interface{}{
+		"index_patterns": []string{"logs-*"},
+		"template": map[string]interface{}{"settings": map[string]interface{}{
+			"number_of_shards":               3,
+			"index.lifecycle.name":           "logs",
+			"index.lifecycle.rollover_alias": "logs",
+		}},
+	}}}
+
+	// 模板与集群中一致，不会重复更新
+	report, err := c.EnsureProvisions(context.Background(), true)
+	require.NoError(t, err)
+	assert.Equal(t, []ProvisionDiff{{Kind: "ilmPolicy", Name: "logs", Detail: "not exists"}}, report.Missing)
+	assert.Empty(t, report.Changed)
+	_, err = c.EnsureProvisions(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"GET /_ilm/policy/logs", "GET /_index_template/logs",
+		"GET /_ilm/policy/logs", "PUT /_ilm/policy/logs", "GET /_index_template/logs",
+	}, requests)
+}
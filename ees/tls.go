@@ -0,0 +1,94 @@
+package ees
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// newHTTPTransport 根据TLS配置创建http.Transport，没有TLS配置时返回http.DefaultTransport
+func newHTTPTransport(config *config) (http.RoundTripper, error) {
+	if config.CaCert == "" && config.CertificateFingerprint == "" && config.CertFile == "" && config.KeyFile == "" && !config.InsecureSkipVerify {
+		return http.DefaultTransport, nil
+	}
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	if config.CaCert != "" {
+		certBytes, err := ioutil.ReadFile(config.CaCert)
+		if err != nil {
+			return nil, fmt.Errorf("read CaCert fail, %w", err)
+		}
+		caCertPool := x509.NewCertPool()
+		if !caCertPool.AppendCertsFromPEM(certBytes) {
+			return nil, fmt.Errorf("no certificate found in CaCert %s", config.CaCert)
+		}
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	if (config.CertFile == "") != (config.KeyFile == "") {
+		return nil, errors.New("CertFile and KeyFile must be set together")
+	}
+	if config.CertFile != "" {
+		tlsCert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load CertFile or KeyFile fail, %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{tlsCert}
+	}
+
+	if config.CertificateFingerprint != "" {
+		fingerprint, err := hex.DecodeString(strings.ReplaceAll(config.CertificateFingerprint, ":", ""))
+		if err != nil || len(fingerprint) != sha256.Size {
+			return nil, fmt.Errorf("invalid CertificateFingerprint %s, must be hex encoded sha256", config.CertificateFingerprint)
+		}
+		// 自签名证书无法通过系统CA校验，跳过默认的校验，使用指纹对应的证书校验
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyFingerprint(cs, fingerprint)
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// verifyFingerprint 服务端证书的指纹一致时直接通过，否则将证书链中指纹一致的证书（如http_ca.crt）作为唯一的根证书，
+// 校验服务端证书的签名和域名。CA证书是公开的，只比较证书链中的指纹时中间人可以把CA证书附加到自己的证书链中。
+// 使用IP访问时ServerName为空，只校验证书链
+func verifyFingerprint(cs tls.ConnectionState, fingerprint []byte) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("ees: no peer certificate")
+	}
+	leaf := cs.PeerCertificates[0]
+	if sum := sha256.Sum256(leaf.Raw); bytes.Equal(sum[:], fingerprint) {
+		return nil
+	}
+	roots := x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+	found := false
+	for _, cert := range cs.PeerCertificates[1:] {
+		if sum := sha256.Sum256(cert.Raw); bytes.Equal(sum[:], fingerprint) {
+			roots.AddCert(cert)
+			found = true
+			continue
+		}
+		intermediates.AddCert(cert)
+	}
+	if !found {
+		return errors.New("ees: no certificate matches CertificateFingerprint")
+	}
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: cs.ServerName, Roots: roots, Intermediates: intermediates}); err != nil {
+		return fmt.Errorf("ees: verify certificate by CertificateFingerprint fail, %w", err)
+	}
+	return nil
+}
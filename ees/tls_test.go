@@ -0,0 +1,136 @@
+package ees
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestCert 生成证书，parent为nil时为自签名的CA证书
+func newTestCert(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, hosts ...string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func fingerprintOf(cert *x509.Certificate) []byte {
+	sum := sha256.Sum256(cert.Raw)
+	return sum[:]
+}
+
+func TestVerifyFingerprint(t *testing.T) {
+	ca, caKey := newTestCert(t, "ca", nil, nil)
+	leaf, _ := newTestCert(t, "es", ca, caKey, "es.local", "10.0.0.1")
+	mitmCA, mitmKey := newTestCert(t, "mitm", nil, nil)
+	mitm, _ := newTestCert(t, "es", mitmCA, mitmKey, "es.local")
+	selfSigned, _ := newTestCert(t, "es", nil, nil, "es.local")
+
+	tests := []struct {
+		name        string
+		chain       []*x509.Certificate
+		serverName  string
+		fingerprint []byte
+		wantErr     bool
+	}{
+		{name: "signed by pinned ca", chain: []*x509.Certificate{leaf, ca}, serverName: "es.local", fingerprint: fingerprintOf(ca)},
+		{name: "ip address", chain: []*x509.Certificate{leaf, ca}, fingerprint: fingerprintOf(ca)},
+		{name: "pinned leaf", chain: []*x509.Certificate{selfSigned}, serverName: "other", fingerprint: fingerprintOf(selfSigned)},
+		{name: "wrong host", chain: []*x509.Certificate{leaf, ca}, serverName: "evil.local", fingerprint: fingerprintOf(ca), wantErr: true},
+		// 中间人把公开的CA证书附加到自己的证书链中
+		{name: "appended ca", chain: []*x509.Certificate{mitm, ca}, serverName: "es.local", fingerprint: fingerprintOf(ca), wantErr: true},
+		{name: "appended ca with own ca", chain: []*x509.Certificate{mitm, mitmCA, ca}, serverName: "es.local", fingerprint: fingerprintOf(ca), wantErr: true},
+		{name: "no match", chain: []*x509.Certificate{leaf, ca}, serverName: "es.local", fingerprint: fingerprintOf(mitmCA), wantErr: true},
+		{name: "no certificate", fingerprint: fingerprintOf(ca), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyFingerprint(tls.ConnectionState{PeerCertificates: tt.chain, ServerName: tt.serverName}, tt.fingerprint)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestNewHTTPTransport(t *testing.T) {
+	rt, err := newHTTPTransport(DefaultConfig())
+	require.NoError(t, err)
+	assert.Equal(t, http.DefaultTransport, rt)
+
+	tests := []struct {
+		name   string
+		config config
+	}{
+		{name: "cert without key", config: config{CertFile: "client.pem"}},
+		{name: "key without cert", config: config{KeyFile: "client.key"}},
+		{name: "invalid fingerprint", config: config{CertificateFingerprint: "zz"}},
+		{name: "short fingerprint", config: config{CertificateFingerprint: "ab:cd"}},
+		{name: "missing ca", config: config{CaCert: "/not/exist.pem"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newHTTPTransport(&tt.config)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCertificateFingerprint(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	get := func(fingerprint []byte) error {
+		rt, err := newHTTPTransport(&config{CertificateFingerprint: hex.EncodeToString(fingerprint)})
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		require.NoError(t, err)
+		resp, err := rt.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		return resp.Body.Close()
+	}
+	assert.NoError(t, get(fingerprintOf(srv.Certificate())))
+	other, _ := newTestCert(t, "other", nil, nil)
+	assert.Error(t, get(fingerprintOf(other)))
+}
@@ -0,0 +1,220 @@
+package eetcd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// Barrier 屏障，Hold后所有调用Wait的进程阻塞，直到Release
+type Barrier struct {
+	client *Component
+	key    string
+}
+
+// NewBarrier 创建屏障
+func (c *Component) NewBarrier(key string) *Barrier {
+	return &Barrier{client: c, key: key}
+}
+
+// Hold 创建屏障的key，阻塞之后调用Wait的进程，屏障已经存在时返回ErrKeyExists
+func (b *Barrier) Hold(ctx context.Context) error {
+	if _, err := putNewKey(ctx, b.client.Client, b.key, "", clientv3.NoLease); err != nil {
+		return err
+	}
+	b.client.logger.Info("barrier hold", elog.FieldKey(b.key))
+	return nil
+}
+
+// Release 删除屏障的key，唤醒所有阻塞在Wait的进程
+func (b *Barrier) Release(ctx context.Context) error {
+	if _, err := b.client.Delete(ctx, b.key); err != nil {
+		return err
+	}
+	b.client.logger.Info("barrier release", elog.FieldKey(b.key))
+	return nil
+}
+
+// Wait 阻塞直到屏障被Release，屏障不存在时直接返回
+func (b *Barrier) Wait(ctx context.Context) error {
+	resp, err := b.client.Get(ctx, b.key)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil
+	}
+	return waitEvent(ctx, b.client.Client, b.key, resp.Header.Revision+1, mvccpb.DELETE)
+}
+
+// DoubleBarrier 双屏障，Enter阻塞直到count个进程进入，Leave阻塞直到所有进程离开，
+// 每个进程的key绑定在自己的租约上，进程异常退出后租约过期，其他进程不会一直阻塞在Leave
+type DoubleBarrier struct {
+	client  *Component
+	session *concurrency.Session
+	key     string
+	count   int
+	myKey   string
+}
+
+// NewDoubleBarrier 创建双屏障，count为参与的进程数，opts用于设置租约，如concurrency.WithTTL
+func (c *Component) NewDoubleBarrier(key string, count int, opts ...concurrency.SessionOption) (*DoubleBarrier, error) {
+	session, err := concurrency.NewSession(c.Client, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &DoubleBarrier{client: c, session: session, key: key, count: count}, nil
+}
+
+// Enter 进入屏障，阻塞直到count个进程进入，进入的进程超过count时返回ErrTooManyParticipants
+func (b *DoubleBarrier) Enter(ctx context.Context) error {
+	waiters := b.key + "/waiters"
+	myKey, rev, err := putUniqueKey(ctx, b.client.Client, waiters, "", b.session.Lease())
+	if err != nil {
+		return err
+	}
+	b.myKey = myKey
+
+	resp, err := b.client.Get(ctx, waiters, clientv3.WithPrefix())
+	if err != nil {
+		b.abandon()
+		return err
+	}
+	if len(resp.Kvs) > b.count {
+		b.abandon()
+		return ErrTooManyParticipants
+	}
+	b.client.logger.Info("double barrier enter", elog.FieldKey(b.key), elog.Int("participants", len(resp.Kvs)), elog.Int("count", b.count))
+	if len(resp.Kvs) == b.count {
+		// 最后一个进入的进程唤醒其他进程
+		if _, err = b.client.Put(ctx, b.key+"/ready", ""); err != nil {
+			b.abandon()
+			return err
+		}
+		return nil
+	}
+	if err := waitEvent(ctx, b.client.Client, b.key+"/ready", rev, mvccpb.PUT); err != nil {
+		b.abandon()
+		return err
+	}
+	return nil
+}
+
+// abandon 进入失败时删除本进程的key，避免占用参与者的名额
+func (b *DoubleBarrier) abandon() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := b.client.Delete(ctx, b.myKey); err != nil {
+		b.client.logger.Warn("double barrier delete key fail", elog.FieldKey(b.myKey), elog.FieldErr(err))
+	}
+	b.myKey = ""
+}
+
+// Leave 离开屏障，阻塞直到所有进程离开
+func (b *DoubleBarrier) Leave(ctx context.Context) error {
+	for {
+		resp, err := b.client.Get(ctx, b.key+"/waiters", clientv3.WithPrefix())
+		if err != nil {
+			return err
+		}
+		if len(resp.Kvs) == 0 {
+			return nil
+		}
+
+		lowest, highest := resp.Kvs[0], resp.Kvs[0]
+		for _, kv := range resp.Kvs {
+			if kv.ModRevision < lowest.ModRevision {
+				lowest = kv
+			}
+			if kv.ModRevision > highest.ModRevision {
+				highest = kv
+			}
+		}
+
+		if len(resp.Kvs) == 1 {
+			// 最后一个离开的进程清理屏障
+			if _, err := b.client.Delete(ctx, b.key+"/ready"); err != nil {
+				return err
+			}
+			if _, err := b.client.Delete(ctx, b.myKey); err != nil {
+				return err
+			}
+			b.client.logger.Info("double barrier leave", elog.FieldKey(b.key))
+			return nil
+		}
+
+		// 最早进入的进程等待最晚进入的进程离开，其他进程删除自己的key后等待最早进入的进程离开
+		if string(lowest.Key) == b.myKey {
+			if err := waitEvent(ctx, b.client.Client, string(highest.Key), highest.ModRevision, mvccpb.DELETE); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := b.client.Delete(ctx, b.myKey); err != nil {
+			return err
+		}
+		if err := waitEvent(ctx, b.client.Client, string(lowest.Key), lowest.ModRevision, mvccpb.DELETE); err != nil {
+			return err
+		}
+	}
+}
+
+// Close 撤销租约，删除本进程在屏障中的key
+func (b *DoubleBarrier) Close() error {
+	return b.session.Close()
+}
+
+// putNewKey key不存在时写入，返回写入时的revision，key已经存在时返回ErrKeyExists
+func putNewKey(ctx context.Context, kv clientv3.KV, key string, value string, leaseID clientv3.LeaseID) (int64, error) {
+	resp, err := kv.Txn(ctx).
+		If(clientv3.Compare(clientv3.Version(key), "=", 0)).
+		Then(clientv3.OpPut(key, value, clientv3.WithLease(leaseID))).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, ErrKeyExists
+	}
+	return resp.Header.Revision, nil
+}
+
+// putUniqueKey 在prefix下写入一个唯一的key
+func putUniqueKey(ctx context.Context, kv clientv3.KV, prefix string, value string, leaseID clientv3.LeaseID) (string, int64, error) {
+	for {
+		key := fmt.Sprintf("%s/%v", prefix, time.Now().UnixNano())
+		rev, err := putNewKey(ctx, kv, key, value, leaseID)
+		if err == nil {
+			return key, rev, nil
+		}
+		if err != ErrKeyExists {
+			return "", 0, err
+		}
+	}
+}
+
+// waitEvent 从revision开始监听key，直到出现指定类型的事件，opts用于监听前缀等
+func waitEvent(ctx context.Context, client *clientv3.Client, key string, revision int64, eventType mvccpb.Event_EventType, opts ...clientv3.OpOption) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	opts = append([]clientv3.OpOption{clientv3.WithRev(revision)}, opts...)
+	for resp := range client.Watch(ctx, key, opts...) {
+		if err := resp.Err(); err != nil {
+			return err
+		}
+		for _, ev := range resp.Events {
+			if ev.Type == eventType {
+				return nil
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return ErrWatchClosed
+}
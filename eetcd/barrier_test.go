@@ -0,0 +1,35 @@
+package eetcd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+func TestDoubleBarrierTooManyParticipants(t *testing.T) {
+	ctx := context.Background()
+	etcd := newFakeEtcd()
+	c := &Component{Client: etcd.client(), logger: elog.DefaultLogger}
+
+	barrier, err := c.NewDoubleBarrier("/barrier", 1, concurrency.WithContext(ctx))
+	require.NoError(t, err)
+	defer barrier.Close()
+	require.NoError(t, barrier.Enter(ctx))
+
+	// 名额已满，进入失败的进程删除自己的key
+	other, err := c.NewDoubleBarrier("/barrier", 1, concurrency.WithContext(ctx))
+	require.NoError(t, err)
+	defer other.Close()
+	assert.Equal(t, ErrTooManyParticipants, other.Enter(ctx))
+	assert.Empty(t, other.myKey)
+
+	resp, err := etcd.Get(ctx, "/barrier/waiters", clientv3.WithPrefix())
+	require.NoError(t, err)
+	require.Len(t, resp.Kvs, 1)
+	assert.Equal(t, barrier.myKey, string(resp.Kvs[0].Key))
+}
@@ -14,6 +14,7 @@ import (
 	"go.etcd.io/etcd/api/v3/mvccpb"
 	"go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/client/v3/concurrency"
+	"go.etcd.io/etcd/client/v3/namespace"
 	"google.golang.org/grpc"
 )
 
@@ -21,9 +22,12 @@ const PackageName = "component.eetcd"
 
 // Component ...
 type Component struct {
-	name   string
-	config *config
-	logger *elog.Component
+	name         string
+	config       *config
+	logger       *elog.Component
+	lockClient   *lockClient
+	stmIsolation concurrency.Isolation
+	auth         *authCredentials
 	*clientv3.Client
 }
 
@@ -35,6 +39,16 @@ func newComponent(name string, config *config, logger *elog.Component) *Componen
 		grpc.FailOnNonTempDialError(config.EnableFailOnNonTempDialError),
 	}
 
+	if config.EnableMetricInterceptor {
+		dialOptions = append(dialOptions,
+			grpc.WithChainUnaryInterceptor(metricUnaryInterceptor(name, config)),
+			grpc.WithChainStreamInterceptor(metricStreamInterceptor(name, config)),
+		)
+	}
+	if config.EnableAccessInterceptor || config.SlowLogThreshold > 0 {
+		dialOptions = append(dialOptions, grpc.WithChainUnaryInterceptor(accessUnaryInterceptor(name, config, logger)))
+	}
+
 	if config.EnableBlock {
 		dialOptions = append(dialOptions, grpc.WithBlock())
 	}
@@ -45,7 +59,6 @@ func newComponent(name string, config *config, logger *elog.Component) *Componen
 		DialKeepAliveTime:    10 * time.Second,
 		DialKeepAliveTimeout: 3 * time.Second,
 		DialOptions:          dialOptions,
-		AutoSyncInterval:     config.AutoSyncInterval,
 	}
 
 	if config.Addrs == nil {
@@ -96,22 +109,89 @@ func newComponent(name string, config *config, logger *elog.Component) *Componen
 		conf.TLS = tlsConfig
 	}
 
+	var reloader *credentialReloader
+	if config.CredentialReloadInterval > 0 {
+		var err error
+		reloader, err = newCredentialReloader(config, logger)
+		if err != nil {
+			logger.Panic("load credentials failed", elog.FieldErr(err))
+		}
+		if tlsEnabled {
+			conf.TLS = reloader.tlsConfig()
+		}
+	} else if config.EnableBasicAuth && config.PasswordFile != "" {
+		pwdBytes, err := ioutil.ReadFile(config.PasswordFile)
+		if err != nil {
+			logger.Panic("read PasswordFile failed", elog.FieldErr(err))
+		}
+		conf.Password = strings.TrimSpace(string(pwdBytes))
+	}
+
+	stmIsolation, err := parseIsolation(config.STMIsolation)
+	if err != nil {
+		logger.Panic("invalid config", elog.FieldErr(err), elog.FieldKey("stmIsolation"))
+	}
+
+	var auth *authCredentials
+	if reloader != nil && config.EnableBasicAuth {
+		// 密码会重新加载，不能使用clientv3内置的认证
+		auth, err = newAuthCredentials(conf, config, reloader.password())
+		if err != nil {
+			logger.Panic("client etcd start panic", elog.FieldErr(err), elog.FieldValueAny(config))
+		}
+		conf.Username, conf.Password = "", ""
+		conf.DialOptions = append(conf.DialOptions,
+			grpc.WithPerRPCCredentials(auth),
+			grpc.WithChainUnaryInterceptor(auth.unaryInterceptor()),
+			grpc.WithChainStreamInterceptor(auth.streamInterceptor()),
+		)
+	}
+
 	client, err := clientv3.New(conf)
 	if err != nil {
 		logger.Panic("client etcd start panic", elog.FieldErr(err), elog.FieldValueAny(config))
 	}
+	if auth != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), config.ConnectTimeout)
+		_, err := auth.GetRequestMetadata(ctx)
+		cancel()
+		if err != nil {
+			logger.Panic("client etcd authenticate panic", elog.FieldErr(err), elog.FieldValueAny(config))
+		}
+	}
+
+	if config.Namespace != "" {
+		client.KV = namespace.NewKV(client.KV, config.Namespace)
+		client.Watcher = namespace.NewWatcher(client.Watcher, config.Namespace)
+		client.Lease = namespace.NewLease(client.Lease, config.Namespace)
+	}
 
 	cc := &Component{
-		name:   name,
-		logger: logger,
-		Client: client,
-		config: config,
+		name:         name,
+		logger:       logger,
+		Client:       client,
+		config:       config,
+		lockClient:   &lockClient{client: client},
+		stmIsolation: stmIsolation,
+		auth:         auth,
+	}
+
+	if config.AutoSyncInterval > 0 {
+		go cc.autoSyncEndpoints(config.AutoSyncInterval)
+	}
+	if reloader != nil {
+		go cc.reloadCredentials(reloader, config.CredentialReloadInterval)
 	}
 
 	logger.Info("dial etcd server")
 	return cc
 }
 
+// LockClient gets default distributed Lock client
+func (c *Component) LockClient() LockClient {
+	return c.lockClient
+}
+
 // GetKeyValue queries etcd key, returns mvccpb.KeyValue
 func (c *Component) GetKeyValue(ctx context.Context, key string) (kv *mvccpb.KeyValue, err error) {
 	rp, err := c.Client.Get(ctx, key)
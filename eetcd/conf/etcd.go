@@ -2,36 +2,51 @@ package conf
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
 	"net/url"
+	"sync"
 	"time"
 
 	"github.com/gotomicro/ego/core/econf"
 	"github.com/gotomicro/ego/core/econf/manager"
 	"github.com/gotomicro/ego/core/elog"
 	"github.com/spf13/cast"
-	"go.etcd.io/etcd/api/v3/mvccpb"
 	"go.etcd.io/etcd/client/v3"
 
 	"github.com/gotomicro/ego-component/eetcd"
 )
 
+const (
+	// minWatchBackoff watch出错后第一次重新watch前的等待时间
+	minWatchBackoff = time.Second
+	// maxWatchBackoff watch连续出错时的最大等待时间
+	maxWatchBackoff = 30 * time.Second
+)
+
 // dataSource file provider.
 type dataSource struct {
-	key                 string
-	enableWatch         bool
-	lastUpdatedRevision int64
-	changed             chan struct{}
-	cancel              context.CancelFunc
-	logger              *elog.Component
-	etcd                *eetcd.Component
+	key         string
+	prefix      bool
+	configType  econf.ConfigType
+	enableWatch bool
+	mu          sync.Mutex
+	revision    int64    // 最近一次读取或者处理的revision，重新watch时从下一个revision开始
+	digest      [32]byte // 最近一次ReadConfig返回的内容摘要，内容没有变化的事件不通知
+	changed     chan struct{}
+	ctx         context.Context
+	cancel      context.CancelFunc
+	logger      *elog.Component
+	etcd        *eetcd.Component
 }
 
 func init() {
 	manager.Register("etcd", &dataSource{})
 }
 
-// Parse
+// Parse 解析配置
+// 单个key etcd://ip:port?configKey=/config/app.toml&configType=toml
+// 前缀 etcd://ip:port?configPrefix=/config/app/&configType=toml，前缀下的每个key是一个配置片段，按key的顺序合并，后面的覆盖前面的
 func (fp *dataSource) Parse(path string, watch bool) econf.ConfigType {
 	fp.logger = elog.EgoLogger.With(elog.FieldComponent(econf.PackageName))
 
@@ -42,9 +57,10 @@ func (fp *dataSource) Parse(path string, watch bool) econf.ConfigType {
 	}
 
 	configKey := urlInfo.Query().Get("configKey")
+	configPrefix := urlInfo.Query().Get("configPrefix")
 	configType := urlInfo.Query().Get("configType")
 
-	if configKey == "" {
+	if configKey == "" && configPrefix == "" {
 		fp.logger.Panic("key is empty")
 	}
 
@@ -61,10 +77,17 @@ func (fp *dataSource) Parse(path string, watch bool) econf.ConfigType {
 		eetcd.WithCaCert(urlInfo.Query().Get("caCert")),
 		eetcd.WithUserName(urlInfo.Query().Get("username")),
 		eetcd.WithPassword(urlInfo.Query().Get("password")),
+		eetcd.WithNamespace(urlInfo.Query().Get("namespace")),
 	)
 
 	fp.key = configKey
+	if configKey == "" {
+		fp.key = configPrefix
+		fp.prefix = true
+	}
+	fp.configType = econf.ConfigType(configType)
 	fp.enableWatch = watch
+	fp.ctx, fp.cancel = context.WithCancel(context.Background())
 
 	if watch {
 		fp.changed = make(chan struct{}, 1)
@@ -72,49 +95,62 @@ func (fp *dataSource) Parse(path string, watch bool) econf.ConfigType {
 			fp.watch()
 		}()
 	}
-	return econf.ConfigType(configType)
+	return fp.configType
 }
 
 // ReadConfig ...
 func (fp *dataSource) ReadConfig() (content []byte, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-	resp, err := fp.etcd.Get(ctx, fp.key)
+	content, revision, err := fp.read()
 	if err != nil {
 		return nil, err
 	}
-	if resp.Count == 0 {
-		return nil, errors.New("empty response")
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	if revision > fp.revision {
+		fp.revision = revision
 	}
-	fp.lastUpdatedRevision = resp.Header.GetRevision()
-	return resp.Kvs[0].Value, nil
+	fp.digest = sha256.Sum256(content)
+	return content, nil
 }
 
-func (fp *dataSource) handle(resp *clientv3.WatchResponse) {
-	if resp.CompactRevision > fp.lastUpdatedRevision {
-		fp.lastUpdatedRevision = resp.CompactRevision
-	}
-	if resp.Header.GetRevision() > fp.lastUpdatedRevision {
-		fp.lastUpdatedRevision = resp.Header.GetRevision()
+// read 读取配置内容以及对应的revision
+func (fp *dataSource) read() ([]byte, int64, error) {
+	ctx, cancel := context.WithTimeout(fp.ctx, 10*time.Second)
+	defer cancel()
+	if !fp.prefix {
+		resp, err := fp.etcd.Get(ctx, fp.key)
+		if err != nil {
+			return nil, 0, err
+		}
+		if resp.Count == 0 {
+			return nil, 0, errors.New("empty response")
+		}
+		return resp.Kvs[0].Value, resp.Header.GetRevision(), nil
 	}
 
-	if err := resp.Err(); err != nil {
-		return
+	resp, err := fp.etcd.Get(ctx, fp.key, clientv3.WithPrefix(), clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend))
+	if err != nil {
+		return nil, 0, err
 	}
-
-	for _, ev := range resp.Events {
-		if ev.Type == mvccpb.PUT || ev.Type == mvccpb.DELETE {
-			select {
-			case fp.changed <- struct{}{}:
-			default:
-			}
-		}
+	if resp.Count == 0 {
+		return nil, 0, errors.New("empty response")
+	}
+	fragments := make([][]byte, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		fragments = append(fragments, kv.Value)
 	}
+	content, err := mergeFragments(fp.configType, fragments)
+	if err != nil {
+		return nil, 0, err
+	}
+	return content, resp.Header.GetRevision(), nil
 }
 
 // Close ...
 func (fp *dataSource) Close() error {
-	fp.cancel()
+	if fp.cancel != nil {
+		fp.cancel()
+	}
 	return nil
 }
 
@@ -123,23 +159,67 @@ func (fp *dataSource) IsConfigChanged() <-chan struct{} {
 	return fp.changed
 }
 
-// Watch file and automate update.
+// notifyIfChanged 读取最新的配置，内容与上一次ReadConfig不同时才通知econf重新加载
+func (fp *dataSource) notifyIfChanged() {
+	content, revision, err := fp.read()
+	if err != nil {
+		fp.logger.Error("read config", elog.FieldErr(err), elog.FieldKey(fp.key))
+		return
+	}
+	fp.mu.Lock()
+	if revision > fp.revision {
+		fp.revision = revision
+	}
+	unchanged := sha256.Sum256(content) == fp.digest
+	fp.mu.Unlock()
+	if unchanged {
+		return
+	}
+	select {
+	case fp.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Watch key and automate update.
+// watch断开或者出错时按指数退避重新watch，revision被压缩时重新读取一次配置
 func (fp *dataSource) watch() {
-	ctx, cancel := context.WithCancel(context.Background())
-	fp.cancel = cancel
-	rch := fp.etcd.Watch(ctx, fp.key, clientv3.WithCreatedNotify(), clientv3.WithRev(fp.lastUpdatedRevision))
-	for {
+	backoff := minWatchBackoff
+	for fp.ctx.Err() == nil {
+		fp.mu.Lock()
+		opts := []clientv3.OpOption{clientv3.WithCreatedNotify(), clientv3.WithRev(fp.revision + 1)}
+		fp.mu.Unlock()
+		if fp.prefix {
+			opts = append(opts, clientv3.WithPrefix())
+		}
+
+		ctx, cancel := context.WithCancel(fp.ctx)
+		rch := fp.etcd.Watch(clientv3.WithRequireLeader(ctx), fp.key, opts...)
 		for resp := range rch {
-			fp.handle(&resp)
+			if resp.CompactRevision != 0 {
+				// 需要的revision已经被压缩，从当前配置重新开始
+				fp.logger.Warn("watch compacted", elog.FieldKey(fp.key), elog.Int64("compactRevision", resp.CompactRevision))
+				fp.notifyIfChanged()
+				break
+			}
+			if err := resp.Err(); err != nil {
+				fp.logger.Error("watch error", elog.FieldErr(err), elog.FieldKey(fp.key))
+				break
+			}
+			backoff = minWatchBackoff
+			if len(resp.Events) > 0 {
+				fp.notifyIfChanged()
+			}
 		}
-		time.Sleep(time.Second)
+		cancel()
 
-		ctx, cancel = context.WithCancel(context.Background())
-		if fp.lastUpdatedRevision > 0 {
-			rch = fp.etcd.Watch(ctx, fp.key, clientv3.WithCreatedNotify(), clientv3.WithRev(fp.lastUpdatedRevision))
-		} else {
-			rch = fp.etcd.Watch(ctx, fp.key, clientv3.WithCreatedNotify())
+		select {
+		case <-fp.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxWatchBackoff {
+			backoff = maxWatchBackoff
 		}
-		fp.cancel = cancel
 	}
 }
@@ -0,0 +1,67 @@
+package conf
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gotomicro/ego/core/econf"
+	"gopkg.in/yaml.v3"
+)
+
+// mergeFragments 合并前缀下的配置片段，后面的片段覆盖前面的同名配置，合并后按configType重新编码
+func mergeFragments(configType econf.ConfigType, fragments [][]byte) ([]byte, error) {
+	if len(fragments) == 1 {
+		return fragments[0], nil
+	}
+	merged := make(map[string]interface{})
+	for _, fragment := range fragments {
+		values := make(map[string]interface{})
+		var err error
+		switch configType {
+		case econf.ConfigTypeJSON:
+			err = json.Unmarshal(fragment, &values)
+		case econf.ConfigTypeToml:
+			err = toml.Unmarshal(fragment, &values)
+		case econf.ConfigTypeYaml:
+			err = yaml.Unmarshal(fragment, &values)
+		default:
+			return nil, fmt.Errorf("unsupported config type %s", configType)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse config fragment fail, %w", err)
+		}
+		deepMerge(merged, values)
+	}
+
+	switch configType {
+	case econf.ConfigTypeJSON:
+		return json.Marshal(merged)
+	case econf.ConfigTypeToml:
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(merged); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return yaml.Marshal(merged)
+	}
+}
+
+// deepMerge 将src合并到dst中，两边都是map时递归合并，否则src覆盖dst
+func deepMerge(dst map[string]interface{}, src map[string]interface{}) {
+	for key, value := range src {
+		srcMap, ok := value.(map[string]interface{})
+		if !ok {
+			dst[key] = value
+			continue
+		}
+		dstMap, ok := dst[key].(map[string]interface{})
+		if !ok {
+			dstMap = make(map[string]interface{})
+			dst[key] = dstMap
+		}
+		deepMerge(dstMap, srcMap)
+	}
+}
@@ -0,0 +1,149 @@
+package conf
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDeepMerge(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  map[string]interface{}
+		src  map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "add key",
+			dst:  map[string]interface{}{"a": 1},
+			src:  map[string]interface{}{"b": 2},
+			want: map[string]interface{}{"a": 1, "b": 2},
+		},
+		{
+			name: "override scalar",
+			dst:  map[string]interface{}{"a": 1},
+			src:  map[string]interface{}{"a": "x"},
+			want: map[string]interface{}{"a": "x"},
+		},
+		{
+			name: "merge nested map",
+			dst:  map[string]interface{}{"server": map[string]interface{}{"host": "127.0.0.1", "port": 80}},
+			src:  map[string]interface{}{"server": map[string]interface{}{"port": 8080}},
+			want: map[string]interface{}{"server": map[string]interface{}{"host": "127.0.0.1", "port": 8080}},
+		},
+		{
+			name: "map replaces scalar",
+			dst:  map[string]interface{}{"server": "off"},
+			src:  map[string]interface{}{"server": map[string]interface{}{"port": 8080}},
+			want: map[string]interface{}{"server": map[string]interface{}{"port": 8080}},
+		},
+		{
+			name: "scalar replaces map",
+			dst:  map[string]interface{}{"server": map[string]interface{}{"port": 8080}},
+			src:  map[string]interface{}{"server": "off"},
+			want: map[string]interface{}{"server": "off"},
+		},
+		{
+			name: "slice is replaced not appended",
+			dst:  map[string]interface{}{"addrs": []interface{}{"a", "b"}},
+			src:  map[string]interface{}{"addrs": []interface{}{"c"}},
+			want: map[string]interface{}{"addrs": []interface{}{"c"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deepMerge(tt.dst, tt.src)
+			assert.Equal(t, tt.want, tt.dst)
+		})
+	}
+}
+
+func TestDeepMergeDoesNotAliasSource(t *testing.T) {
+	src := map[string]interface{}{"server": map[string]interface{}{"port": 8080}}
+	dst := map[string]interface{}{}
+	deepMerge(dst, src)
+	deepMerge(dst, map[string]interface{}{"server": map[string]interface{}{"port": 9090}})
+	assert.Equal(t, 8080, src["server"].(map[string]interface{})["port"])
+}
+
+func TestMergeFragments(t *testing.T) {
+	tests := []struct {
+		name       string
+		configType econf.ConfigType
+		fragments  []string
+		unmarshal  func([]byte, interface{}) error
+		want       map[string]interface{}
+		wantErr    bool
+	}{
+		{
+			name:       "json",
+			configType: econf.ConfigTypeJSON,
+			fragments:  []string{`{"server":{"host":"127.0.0.1","port":80},"debug":true}`, `{"server":{"port":8080}}`},
+			unmarshal:  json.Unmarshal,
+			want:       map[string]interface{}{"server": map[string]interface{}{"host": "127.0.0.1", "port": float64(8080)}, "debug": true},
+		},
+		{
+			name:       "toml",
+			configType: econf.ConfigTypeToml,
+			fragments:  []string{"[server]\nhost = \"127.0.0.1\"\nport = 80\n", "[server]\nport = 8080\n[log]\nlevel = \"info\"\n"},
+			unmarshal:  toml.Unmarshal,
+			want:       map[string]interface{}{"server": map[string]interface{}{"host": "127.0.0.1", "port": int64(8080)}, "log": map[string]interface{}{"level": "info"}},
+		},
+		{
+			name:       "yaml",
+			configType: econf.ConfigTypeYaml,
+			fragments:  []string{"server:\n  host: 127.0.0.1\n  port: 80\n", "server:\n  port: 8080\n"},
+			unmarshal:  yaml.Unmarshal,
+			want:       map[string]interface{}{"server": map[string]interface{}{"host": "127.0.0.1", "port": 8080}},
+		},
+		{
+			name:       "later fragment wins",
+			configType: econf.ConfigTypeJSON,
+			fragments:  []string{`{"a":1}`, `{"a":2}`, `{"a":3}`},
+			unmarshal:  json.Unmarshal,
+			want:       map[string]interface{}{"a": float64(3)},
+		},
+		{
+			name:       "invalid fragment",
+			configType: econf.ConfigTypeJSON,
+			fragments:  []string{`{"a":1}`, `{"a":`},
+			wantErr:    true,
+		},
+		{
+			name:       "unsupported type",
+			configType: econf.ConfigType("ini"),
+			fragments:  []string{"a=1", "b=2"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fragments := make([][]byte, 0, len(tt.fragments))
+			for _, fragment := range tt.fragments {
+				fragments = append(fragments, []byte(fragment))
+			}
+			out, err := mergeFragments(tt.configType, fragments)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			got := make(map[string]interface{})
+			require.NoError(t, tt.unmarshal(out, &got))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMergeFragmentsSingle(t *testing.T) {
+	// 只有一个片段时原样返回，不重新编码
+	fragment := []byte("# comment\nserver:\n  port: 80\n")
+	out, err := mergeFragments(econf.ConfigTypeYaml, [][]byte{fragment})
+	require.NoError(t, err)
+	assert.Equal(t, fragment, out)
+}
@@ -14,12 +14,22 @@ type config struct {
 	CaCert                       string        // ca cert
 	UserName                     string        // 用户名
 	Password                     string        // 密码
+	PasswordFile                 string        // 密码文件，如挂载的secret，不为空时使用文件中的密码
+	CredentialReloadInterval     time.Duration // 检查证书、密码文件是否变化的间隔，变化时重新加载，默认0不检查
 	ConnectTimeout               time.Duration // 连接超时时间
-	AutoSyncInterval             time.Duration // 自动同步member list的间隔
+	AutoSyncInterval             time.Duration // 从member list自动同步地址的间隔，默认0不同步
 	EnableBasicAuth              bool          // 是否开启认证
 	EnableSecure                 bool          // 是否开启安全
 	EnableBlock                  bool          // 是否开启阻塞，默认开启
 	EnableFailOnNonTempDialError bool          // 是否开启gRPC连接的错误信息
+	EnableMetricInterceptor      bool          // 是否开启监控，默认开启
+	EnableAccessInterceptor      bool          // 是否开启，记录请求数据
+	EnableAccessInterceptorReq   bool          // 是否开启记录请求参数
+	EnableAccessInterceptorRes   bool          // 是否开启记录响应参数
+	SlowLogThreshold             time.Duration // 慢日志门限值，超过该门限值的请求，将被记录到慢日志中，默认250ms，小于等于0时不记录
+	Namespace                    string        // key的命名空间，不为空时所有KV、Watch、Lease操作的key自动加上该前缀，如/prod/
+	STMIsolation                 string        // STM的隔离级别，可选serializableSnapshot、serializable、repeatableReads、readCommitted，默认serializableSnapshot
+	STMMaxRetries                int           // STM冲突时的最大重试次数，默认10，小于等于0时不限制，直到ctx结束
 }
 
 // DefaultConfig 返回默认配置
@@ -30,5 +40,8 @@ func DefaultConfig() *config {
 		EnableSecure:                 false,
 		EnableBlock:                  true,
 		EnableFailOnNonTempDialError: true,
+		EnableMetricInterceptor:      true,
+		SlowLogThreshold:             xtime.Duration("250ms"),
+		STMMaxRetries:                10,
 	}
 }
@@ -0,0 +1,320 @@
+package eetcd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"go.etcd.io/etcd/client/v3"
+	"google.golang.org/grpc"
+)
+
+// credentialReloader 定时检查证书、密码文件的修改时间，变化时重新加载，
+// 新的TLS握手使用新的证书，token过期后使用新的密码重新认证，不需要重启服务；
+// 只读config，重新加载的密码保存在reloader中
+type credentialReloader struct {
+	config  *config
+	logger  *elog.Component
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	pwd     string
+	modTime map[string]time.Time
+}
+
+func newCredentialReloader(config *config, logger *elog.Component) (*credentialReloader, error) {
+	r := &credentialReloader{
+		config:  config,
+		logger:  logger,
+		pwd:     config.Password,
+		modTime: make(map[string]time.Time),
+	}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// files 需要监听的文件
+func (r *credentialReloader) files() []string {
+	files := make([]string, 0, 4)
+	for _, file := range []string{r.config.CertFile, r.config.KeyFile, r.config.CaCert, r.config.PasswordFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// reload 文件有变化时重新加载，加载失败时继续使用原来的证书、密码，返回是否重新加载
+func (r *credentialReloader) reload() (bool, error) {
+	modTime := make(map[string]time.Time)
+	changed := false
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, err
+		}
+		modTime[file] = info.ModTime()
+		if !info.ModTime().Equal(r.modTime[file]) {
+			changed = true
+		}
+	}
+	if !changed {
+		return false, nil
+	}
+
+	var cert *tls.Certificate
+	if r.config.CertFile != "" && r.config.KeyFile != "" {
+		tlsCert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+		if err != nil {
+			return false, fmt.Errorf("load CertFile or KeyFile failed, %w", err)
+		}
+		cert = &tlsCert
+	}
+	var pool *x509.CertPool
+	if r.config.CaCert != "" {
+		certBytes, err := ioutil.ReadFile(r.config.CaCert)
+		if err != nil {
+			return false, fmt.Errorf("read CaCert failed, %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(certBytes) {
+			return false, errors.New("parse CaCert failed")
+		}
+	}
+	var password string
+	if r.config.PasswordFile != "" {
+		pwdBytes, err := ioutil.ReadFile(r.config.PasswordFile)
+		if err != nil {
+			return false, fmt.Errorf("read PasswordFile failed, %w", err)
+		}
+		password = strings.TrimSpace(string(pwdBytes))
+	}
+
+	r.mu.Lock()
+	r.cert = cert
+	r.pool = pool
+	if r.config.PasswordFile != "" {
+		r.pwd = password
+	}
+	r.modTime = modTime
+	r.mu.Unlock()
+	return true, nil
+}
+
+// password 当前的密码
+func (r *credentialReloader) password() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pwd
+}
+
+// tlsConfig 每次握手时使用最新的客户端证书和CA校验服务端证书
+func (r *credentialReloader) tlsConfig() *tls.Config {
+	tlsConfig := &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			if r.cert == nil {
+				return &tls.Certificate{}, nil
+			}
+			return r.cert, nil
+		},
+	}
+	if r.config.CaCert == "" {
+		return tlsConfig
+	}
+	// RootCAs无法在握手时替换，关闭默认的校验，在VerifyConnection中使用最新的CA校验
+	tlsConfig.InsecureSkipVerify = true
+	tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("no peer certificate")
+		}
+		r.mu.RLock()
+		pool := r.pool
+		r.mu.RUnlock()
+		opts := x509.VerifyOptions{
+			DNSName:       cs.ServerName,
+			Roots:         pool,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range cs.PeerCertificates[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := cs.PeerCertificates[0].Verify(opts)
+		return err
+	}
+	return tlsConfig
+}
+
+// reloadCredentials 按CredentialReloadInterval检查证书、密码是否变化，直到client关闭
+func (c *Component) reloadCredentials(r *credentialReloader, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer func() {
+		if c.auth != nil {
+			_ = c.auth.close()
+		}
+	}()
+	for {
+		select {
+		case <-c.Ctx().Done():
+			return
+		case <-ticker.C:
+			changed, err := r.reload()
+			if err != nil {
+				c.logger.Error("reload credentials", elog.FieldErr(err))
+				continue
+			}
+			if !changed {
+				continue
+			}
+			if c.auth != nil {
+				// 丢弃原来的token，下一个请求使用新的密码重新认证
+				c.auth.setPassword(r.password())
+			}
+			c.logger.Info("reload credentials", elog.Any("files", r.files()))
+		}
+	}
+}
+
+// authCredentials 开启凭证重新加载时代替clientv3内置的用户名密码认证。
+// clientv3在RPC的goroutine中无锁读取Client.Password，运行时不能修改，
+// 这里在锁内保存密码和token，密码变化或token失效时丢弃token，下一个请求使用当前的密码重新认证
+type authCredentials struct {
+	username string
+	// authenticate 使用不带认证信息的独立连接获取token，避免认证请求本身需要token
+	authenticate func(ctx context.Context, username, password string) (string, error)
+	closer       func() error
+
+	mu       sync.Mutex
+	password string
+	token    string
+	disabled bool // 服务端没有开启认证
+}
+
+// newAuthCredentials 创建认证使用的独立连接，conf为不带认证信息的配置
+func newAuthCredentials(conf clientv3.Config, config *config, password string) (*authCredentials, error) {
+	authConf := clientv3.Config{
+		Endpoints:   conf.Endpoints,
+		DialTimeout: conf.DialTimeout,
+		TLS:         conf.TLS,
+	}
+	if !config.EnableSecure {
+		authConf.DialOptions = []grpc.DialOption{grpc.WithInsecure()}
+	}
+	authClient, err := clientv3.New(authConf)
+	if err != nil {
+		return nil, err
+	}
+	return &authCredentials{
+		username: config.UserName,
+		password: password,
+		authenticate: func(ctx context.Context, username, password string) (string, error) {
+			resp, err := authClient.Authenticate(ctx, username, password)
+			if err != nil {
+				return "", err
+			}
+			return resp.Token, nil
+		},
+		closer: authClient.Close,
+	}, nil
+}
+
+// GetRequestMetadata 实现credentials.PerRPCCredentials，没有token时先认证
+func (a *authCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.disabled {
+		return nil, nil
+	}
+	if a.token == "" {
+		token, err := a.authenticate(ctx, a.username, a.password)
+		if errors.Is(err, rpctypes.ErrAuthNotEnabled) {
+			a.disabled = true
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		a.token = token
+	}
+	return map[string]string{rpctypes.TokenFieldNameGRPC: a.token}, nil
+}
+
+// RequireTransportSecurity 与clientv3一致，不要求TLS
+func (a *authCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// setPassword 替换密码并丢弃token
+func (a *authCredentials) setPassword(password string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.password = password
+	a.token = ""
+	a.disabled = false
+}
+
+// invalidate 请求返回token失效时丢弃token，clientv3的重试会重新认证
+func (a *authCredentials) invalidate(err error) {
+	if rpctypes.Error(err) != rpctypes.ErrInvalidAuthToken {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.token = ""
+}
+
+func (a *authCredentials) close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer()
+}
+
+// unaryInterceptor 在clientv3的重试拦截器内执行，每次请求失败时检查token是否失效
+func (a *authCredentials) unaryInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err != nil {
+			a.invalidate(err)
+		}
+		return err
+	}
+}
+
+// streamInterceptor Watch等stream建立失败或者接收失败时检查token是否失效
+func (a *authCredentials) streamInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			a.invalidate(err)
+			return stream, err
+		}
+		return &authStream{ClientStream: stream, auth: a}, nil
+	}
+}
+
+type authStream struct {
+	grpc.ClientStream
+	auth *authCredentials
+}
+
+func (s *authStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.auth.invalidate(err)
+	}
+	return err
+}
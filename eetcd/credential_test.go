@@ -0,0 +1,158 @@
+package eetcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"google.golang.org/grpc"
+)
+
+func TestCredentialReloaderPassword(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eetcd-credential")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "password")
+	require.NoError(t, ioutil.WriteFile(file, []byte("old\n"), 0600))
+
+	cfg := &config{Password: "static", PasswordFile: file}
+	r, err := newCredentialReloader(cfg, elog.DefaultLogger)
+	require.NoError(t, err)
+	assert.Equal(t, "old", r.password())
+
+	changed, err := r.reload()
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	require.NoError(t, ioutil.WriteFile(file, []byte("new\n"), 0600))
+	require.NoError(t, os.Chtimes(file, time.Now(), time.Now().Add(time.Minute)))
+	changed, err = r.reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "new", r.password())
+	// 不修改共享的配置
+	assert.Equal(t, "static", cfg.Password)
+
+	// 加载失败时继续使用原来的密码
+	require.NoError(t, os.Remove(file))
+	_, err = r.reload()
+	assert.Error(t, err)
+	assert.Equal(t, "new", r.password())
+}
+
+// fakeAuthenticate 记录每次认证使用的密码，token为密码加上认证的次数
+type fakeAuthenticate struct {
+	mu        sync.Mutex
+	passwords []string
+	err       error
+}
+
+func (f *fakeAuthenticate) authenticate(ctx context.Context, username, password string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return "", f.err
+	}
+	f.passwords = append(f.passwords, password)
+	return fmt.Sprintf("%s-%d", password, len(f.passwords)), nil
+}
+
+func (f *fakeAuthenticate) calls() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.passwords...)
+}
+
+func TestAuthCredentials(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeAuthenticate{}
+	auth := &authCredentials{username: "root", password: "p1", authenticate: fake.authenticate}
+
+	md, err := auth.GetRequestMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"token": "p1-1"}, md)
+	// token缓存到失效为止
+	md, err = auth.GetRequestMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "p1-1", md["token"])
+	assert.Equal(t, []string{"p1"}, fake.calls())
+
+	// 其他错误不丢弃token
+	invoker := func(err error) grpc.UnaryInvoker {
+		return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return err
+		}
+	}
+	interceptor := auth.unaryInterceptor()
+	_ = interceptor(ctx, "/etcdserverpb.KV/Range", nil, nil, nil, invoker(rpctypes.ErrGRPCNoLeader))
+	md, err = auth.GetRequestMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "p1-1", md["token"])
+
+	// token失效后重新认证
+	_ = interceptor(ctx, "/etcdserverpb.KV/Range", nil, nil, nil, invoker(rpctypes.ErrGRPCInvalidAuthToken))
+	md, err = auth.GetRequestMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "p1-2", md["token"])
+
+	// 密码变化后使用新的密码认证
+	auth.setPassword("p2")
+	md, err = auth.GetRequestMetadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "p2-3", md["token"])
+	assert.Equal(t, []string{"p1", "p1", "p2"}, fake.calls())
+}
+
+func TestAuthCredentialsErrors(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeAuthenticate{err: rpctypes.ErrAuthFailed}
+	auth := &authCredentials{username: "root", password: "bad", authenticate: fake.authenticate}
+	_, err := auth.GetRequestMetadata(ctx)
+	assert.True(t, errors.Is(err, rpctypes.ErrAuthFailed))
+
+	// 服务端没有开启认证时不带token
+	fake.err = rpctypes.ErrAuthNotEnabled
+	md, err := auth.GetRequestMetadata(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, md)
+	fake.err = nil
+	md, err = auth.GetRequestMetadata(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, md)
+	assert.Empty(t, fake.calls())
+}
+
+func TestAuthCredentialsConcurrent(t *testing.T) {
+	ctx := context.Background()
+	fake := &fakeAuthenticate{}
+	auth := &authCredentials{username: "root", password: "p0", authenticate: fake.authenticate}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := auth.GetRequestMetadata(ctx)
+				assert.NoError(t, err)
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				auth.setPassword(fmt.Sprintf("p%d", i))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,75 @@
+package eetcd
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+)
+
+// syncEndpointsTimeout 每次同步member list的超时时间
+const syncEndpointsTimeout = 5 * time.Second
+
+// SyncEndpoints 从member list同步客户端的地址，集群扩容或者替换节点后不需要修改配置、重启服务。
+// 与clientv3.Client.Sync不同，忽略learner和还没有启动的member，地址没有变化时不重新设置，
+// member list中没有可用地址时保留原来的地址
+func (c *Component) SyncEndpoints(ctx context.Context) ([]string, error) {
+	resp, err := c.MemberList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	endpoints := make([]string, 0, len(resp.Members))
+	for _, m := range resp.Members {
+		// 没有名称的member还没有启动
+		if m.Name == "" || m.IsLearner {
+			continue
+		}
+		endpoints = append(endpoints, m.ClientURLs...)
+	}
+	if len(endpoints) == 0 {
+		return nil, errors.New("no available endpoint in member list")
+	}
+	sort.Strings(endpoints)
+
+	current := append([]string(nil), c.Endpoints()...)
+	sort.Strings(current)
+	if equalStrings(current, endpoints) {
+		return endpoints, nil
+	}
+	c.SetEndpoints(endpoints...)
+	c.logger.Info("sync endpoints", elog.Any("from", current), elog.Any("to", endpoints))
+	return endpoints, nil
+}
+
+// autoSyncEndpoints 按AutoSyncInterval定时同步地址，直到client关闭
+func (c *Component) autoSyncEndpoints(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.Ctx().Done():
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(c.Ctx(), syncEndpointsTimeout)
+			_, err := c.SyncEndpoints(ctx)
+			cancel()
+			if err != nil && c.Ctx().Err() == nil {
+				c.logger.Warn("sync endpoints", elog.FieldErr(err))
+			}
+		}
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,25 @@
+package eetcd
+
+type Err string
+
+func (e Err) Error() string { return string(e) }
+
+const (
+	// ErrNotObtained is returned when a Lock cannot be obtained.
+	ErrNotObtained = Err("etcdlock: not obtained")
+
+	// ErrLockNotHeld is returned when trying to release an inactive Lock.
+	ErrLockNotHeld = Err("etcdlock: lock not held")
+
+	// ErrKeyExists is returned when creating a key that already exists.
+	ErrKeyExists = Err("etcd: key already exists")
+
+	// ErrTooManyParticipants is returned when more processes than expected enter a DoubleBarrier.
+	ErrTooManyParticipants = Err("etcd: too many participants")
+
+	// ErrWatchClosed is returned when the watch channel is closed before the expected event.
+	ErrWatchClosed = Err("etcd: watch closed")
+
+	// ErrSTMRetriesExceeded is returned when a STM transaction conflicts more than STMMaxRetries times.
+	ErrSTMRetriesExceeded = Err("etcd: stm retries exceeded")
+)
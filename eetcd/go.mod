@@ -3,15 +3,20 @@ module github.com/gotomicro/ego-component/eetcd
 go 1.15
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/HdrHistogram/hdrhistogram-go v1.1.0 // indirect
 	github.com/golang/protobuf v1.5.2
 	github.com/gotomicro/ego v0.8.0
 	github.com/grpc-ecosystem/go-grpc-prometheus v1.2.0
 	github.com/spf13/cast v1.3.1
+	github.com/stretchr/testify v1.7.0
 	github.com/uber/jaeger-client-go v2.23.1+incompatible // indirect
 	github.com/uber/jaeger-lib v2.4.1+incompatible // indirect
+	go.etcd.io/bbolt v1.3.6
 	go.etcd.io/etcd/api/v3 v3.5.0
 	go.etcd.io/etcd/client/v3 v3.5.0
+	go.uber.org/zap v1.17.0
 	golang.org/x/net v0.0.0-20210805182204-aaa1db679c0d
 	google.golang.org/grpc v1.42.0
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
@@ -0,0 +1,141 @@
+package eetcd
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/gotomicro/ego/core/emetric"
+	"github.com/gotomicro/ego/core/etrace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// metricType 监控指标中的类型
+const metricType = "etcd"
+
+// operationName 将gRPC方法转换为操作名，如/etcdserverpb.KV/Range为Get
+func operationName(method string) string {
+	name := method[strings.LastIndex(method, "/")+1:]
+	switch name {
+	case "Range":
+		return "Get"
+	case "DeleteRange":
+		return "Delete"
+	}
+	return name
+}
+
+func metricUnaryInterceptor(compName string, config *config) grpc.UnaryClientInterceptor {
+	addr := strings.Join(config.Addrs, ",")
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		beg := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		op := operationName(method)
+		emetric.ClientHandleHistogram.WithLabelValues(metricType, compName, op, addr).Observe(time.Since(beg).Seconds())
+		if err != nil {
+			emetric.ClientHandleCounter.Inc(metricType, compName, op, addr, "Error")
+			return err
+		}
+		emetric.ClientHandleCounter.Inc(metricType, compName, op, addr, "OK")
+		return nil
+	}
+}
+
+// metricStreamInterceptor Watch等stream在结束时统计整个stream的持续时间和结果，建立stream失败时统计建立的耗时
+func metricStreamInterceptor(compName string, config *config) grpc.StreamClientInterceptor {
+	addr := strings.Join(config.Addrs, ",")
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		beg := time.Now()
+		op := operationName(method)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			emetric.ClientHandleHistogram.WithLabelValues(metricType, compName, op, addr).Observe(time.Since(beg).Seconds())
+			emetric.ClientHandleCounter.Inc(metricType, compName, op, addr, "Error")
+			return stream, err
+		}
+		return &metricStream{ClientStream: stream, finish: func(err error) {
+			emetric.ClientHandleHistogram.WithLabelValues(metricType, compName, op, addr).Observe(time.Since(beg).Seconds())
+			emetric.ClientHandleCounter.Inc(metricType, compName, op, addr, streamResult(err))
+		}}, nil
+	}
+}
+
+// metricStream 接收到错误（包括io.EOF）时stream结束，只统计一次
+type metricStream struct {
+	grpc.ClientStream
+	once   sync.Once
+	finish func(err error)
+}
+
+func (s *metricStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.once.Do(func() { s.finish(err) })
+	}
+	return err
+}
+
+// streamResult 正常结束或者被调用方取消的stream为OK
+func streamResult(err error) string {
+	if err == io.EOF || errors.Is(err, context.Canceled) || status.Code(err) == codes.Canceled {
+		return "OK"
+	}
+	return "Error"
+}
+
+// isAuthMethod Auth服务的请求包含密码，响应包含token，不能记录到日志中
+func isAuthMethod(method string) bool {
+	return strings.HasPrefix(method, "/etcdserverpb.Auth/")
+}
+
+func accessUnaryInterceptor(compName string, config *config, logger *elog.Component) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		beg := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		cost := time.Since(beg)
+
+		fields := make([]elog.Field, 0, 10)
+		fields = append(fields, elog.FieldComponentName(compName),
+			elog.FieldMethod(operationName(method)),
+			elog.FieldCost(cost))
+		if config.EnableAccessInterceptorReq {
+			if isAuthMethod(method) {
+				fields = append(fields, elog.String("req", "[REDACTED]"))
+			} else {
+				fields = append(fields, elog.Any("req", req))
+			}
+		}
+		if config.EnableAccessInterceptorRes && err == nil {
+			if isAuthMethod(method) {
+				fields = append(fields, elog.String("res", "[REDACTED]"))
+			} else {
+				fields = append(fields, elog.Any("res", reply))
+			}
+		}
+		if etrace.IsGlobalTracerRegistered() {
+			fields = append(fields, elog.FieldTid(etrace.ExtractTraceID(ctx)))
+		}
+
+		if config.SlowLogThreshold > time.Duration(0) && cost > config.SlowLogThreshold {
+			logger.Warn("slow", fields...)
+		}
+
+		if err != nil {
+			fields = append(fields, elog.FieldEvent("error"), elog.FieldErr(err))
+			logger.Error("access", fields...)
+			return err
+		}
+
+		if config.EnableAccessInterceptor {
+			fields = append(fields, elog.FieldEvent("normal"))
+			logger.Info("access", fields...)
+		}
+		return nil
+	}
+}
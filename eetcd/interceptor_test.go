@@ -0,0 +1,82 @@
+package eetcd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAccessInterceptorRedactsAuth(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := elog.DefaultContainer().Build(elog.WithZapCore(core))
+	interceptor := accessUnaryInterceptor("etcd", &config{EnableAccessInterceptor: true, EnableAccessInterceptorReq: true, EnableAccessInterceptorRes: true}, logger)
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+
+	err := interceptor(context.Background(), "/etcdserverpb.Auth/Authenticate", &pb.AuthenticateRequest{Name: "root", Password: "secret"}, &pb.AuthenticateResponse{Token: "token"}, nil, invoker)
+	require.NoError(t, err)
+	err = interceptor(context.Background(), "/etcdserverpb.KV/Range", &pb.RangeRequest{Key: []byte("/a")}, &pb.RangeResponse{}, nil, invoker)
+	require.NoError(t, err)
+
+	entries := logs.FilterMessage("access").All()
+	require.Len(t, entries, 2)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "[REDACTED]", fields["req"])
+	assert.Equal(t, "[REDACTED]", fields["res"])
+	for _, value := range fields {
+		assert.NotContains(t, fmt.Sprint(value), "secret")
+	}
+	fields = entries[1].ContextMap()
+	assert.NotEqual(t, "[REDACTED]", fields["req"])
+	assert.Equal(t, "Get", fields["method"])
+}
+
+func TestStreamResult(t *testing.T) {
+	assert.Equal(t, "OK", streamResult(io.EOF))
+	assert.Equal(t, "OK", streamResult(context.Canceled))
+	assert.Equal(t, "OK", streamResult(status.Error(codes.Canceled, "context canceled")))
+	assert.Equal(t, "Error", streamResult(status.Error(codes.Unavailable, "no leader")))
+	assert.Equal(t, "Error", streamResult(errors.New("boom")))
+}
+
+// recvStream 依次返回errs中的错误
+type recvStream struct {
+	grpc.ClientStream
+	errs []error
+}
+
+func (s *recvStream) RecvMsg(m interface{}) error {
+	err := s.errs[0]
+	s.errs = s.errs[1:]
+	return err
+}
+
+func TestMetricStreamFinishOnce(t *testing.T) {
+	var results []error
+	stream := &metricStream{
+		ClientStream: &recvStream{errs: []error{nil, nil, io.EOF, io.EOF}},
+		finish: func(err error) {
+			results = append(results, err)
+		},
+	}
+	for i := 0; i < 2; i++ {
+		require.NoError(t, stream.RecvMsg(nil))
+	}
+	assert.Empty(t, results, "stream still open")
+	assert.Equal(t, io.EOF, stream.RecvMsg(nil))
+	assert.Equal(t, io.EOF, stream.RecvMsg(nil))
+	assert.Equal(t, []error{io.EOF}, results)
+}
@@ -0,0 +1,263 @@
+package eetcd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"sync"
+	"time"
+
+	"go.etcd.io/etcd/client/v3"
+)
+
+// LockClient 分布式锁客户端，方法与eredis的LockClient一致，业务代码依赖该接口即可在不同的锁实现之间切换
+type LockClient interface {
+	// Obtain 获取锁，锁已经被其他人持有时返回ErrNotObtained
+	Obtain(ctx context.Context, key string, ttl time.Duration, opts ...LockOption) (Locker, error)
+}
+
+// Locker 已经获取的分布式锁
+type Locker interface {
+	// Key 锁使用的key
+	Key() string
+	// Token 获取锁时生成的随机token
+	Token() string
+	// Metadata 获取锁时设置的metadata
+	Metadata() string
+	// TTL 锁的剩余时间，锁已经过期或者被其他人持有时返回0
+	TTL(ctx context.Context) (time.Duration, error)
+	// Refresh 使用新的ttl延长锁，锁已经丢失时返回ErrNotObtained
+	Refresh(ctx context.Context, ttl time.Duration, opts ...LockOption) error
+	// Release 释放锁，锁不属于自己时返回ErrLockNotHeld
+	Release(ctx context.Context) error
+}
+
+var (
+	_ LockClient = (*lockClient)(nil)
+	_ Locker     = (*Lock)(nil)
+)
+
+// lockClient 基于etcd租约的分布式锁
+type lockClient struct {
+	client *clientv3.Client
+	tmp    []byte
+	tmpMu  sync.Mutex
+}
+
+// Obtain tries to obtain a new Lock using a key with the given TTL.
+// etcd租约的最小单位为秒，ttl不足1秒时按1秒处理。
+// May return ErrNotObtained if not successful.
+func (c *lockClient) Obtain(ctx context.Context, key string, ttl time.Duration, opts ...LockOption) (Locker, error) {
+	// Create a random token
+	token, err := c.randomToken()
+	if err != nil {
+		return nil, err
+	}
+	opt := &lockOption{}
+	for _, o := range opts {
+		o(opt)
+	}
+	if opt.retryStrategy == nil {
+		opt.retryStrategy = NoRetry()
+	}
+
+	value := token + opt.metadata
+	retry := opt.retryStrategy
+
+	deadlineCtx, cancel := context.WithDeadline(ctx, time.Now().Add(ttl))
+	defer cancel()
+
+	var timer *time.Timer
+	for {
+		leaseID, ok, err := c.obtain(deadlineCtx, key, value, ttl)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			return &Lock{client: c, key: key, value: value, leaseID: leaseID}, nil
+		}
+
+		backoff := retry.NextBackoff()
+		if backoff < 1 {
+			return nil, ErrNotObtained
+		}
+
+		if timer == nil {
+			timer = time.NewTimer(backoff)
+			defer timer.Stop()
+		} else {
+			timer.Reset(backoff)
+		}
+
+		select {
+		case <-deadlineCtx.Done():
+			return nil, ErrNotObtained
+		case <-timer.C:
+		}
+	}
+}
+
+// obtain 创建租约，key不存在时写入key并绑定租约，失败时撤销租约
+func (c *lockClient) obtain(ctx context.Context, key, value string, ttl time.Duration) (clientv3.LeaseID, bool, error) {
+	lease, err := c.client.Grant(ctx, leaseSeconds(ttl))
+	if err != nil {
+		return 0, false, err
+	}
+	resp, err := c.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, value, clientv3.WithLease(lease.ID))).
+		Commit()
+	if err != nil || !resp.Succeeded {
+		c.revoke(lease.ID)
+		return 0, false, err
+	}
+	return lease.ID, true, nil
+}
+
+// revoke 撤销不再使用的租约，失败时等待租约自然过期
+func (c *lockClient) revoke(leaseID clientv3.LeaseID) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, _ = c.client.Revoke(ctx, leaseID)
+}
+
+func (c *lockClient) randomToken() (string, error) {
+	c.tmpMu.Lock()
+	defer c.tmpMu.Unlock()
+
+	if len(c.tmp) == 0 {
+		c.tmp = make([]byte, 16)
+	}
+
+	if _, err := io.ReadFull(rand.Reader, c.tmp); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(c.tmp), nil
+}
+
+// leaseSeconds 将ttl转换为租约的秒数，向上取整
+func leaseSeconds(ttl time.Duration) int64 {
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// Lock represents an obtained, distributed Lock.
+type Lock struct {
+	client  *lockClient
+	key     string
+	value   string
+	mu      sync.Mutex
+	leaseID clientv3.LeaseID
+}
+
+// Key returns the etcd key used by the Lock.
+func (l *Lock) Key() string {
+	return l.key
+}
+
+// Token returns the token value set by the Lock.
+func (l *Lock) Token() string {
+	return l.value[:22]
+}
+
+// Metadata returns the metadata of the Lock.
+func (l *Lock) Metadata() string {
+	return l.value[22:]
+}
+
+func (l *Lock) lease() clientv3.LeaseID {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.leaseID
+}
+
+// TTL returns the remaining time-to-live. Returns 0 if the Lock has expired.
+func (l *Lock) TTL(ctx context.Context) (time.Duration, error) {
+	resp, err := l.client.client.Get(ctx, l.key)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Kvs) == 0 || string(resp.Kvs[0].Value) != l.value {
+		return 0, nil
+	}
+	ttl, err := l.client.client.TimeToLive(ctx, clientv3.LeaseID(resp.Kvs[0].Lease))
+	if err != nil {
+		return 0, err
+	}
+	if ttl.TTL > 0 {
+		return time.Duration(ttl.TTL) * time.Second, nil
+	}
+	return 0, nil
+}
+
+// Refresh extends the Lock with a new TTL.
+// etcd不能修改租约的TTL，刷新时创建新的租约并绑定到key上，再撤销原来的租约。
+// May return ErrNotObtained if refresh is unsuccessful.
+func (l *Lock) Refresh(ctx context.Context, ttl time.Duration, opts ...LockOption) error {
+	lease, err := l.client.client.Grant(ctx, leaseSeconds(ttl))
+	if err != nil {
+		return err
+	}
+	resp, err := l.client.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(l.key), "=", l.value)).
+		Then(clientv3.OpPut(l.key, l.value, clientv3.WithLease(lease.ID))).
+		Commit()
+	if err != nil {
+		l.client.revoke(lease.ID)
+		return err
+	} else if !resp.Succeeded {
+		l.client.revoke(lease.ID)
+		return ErrNotObtained
+	}
+
+	l.mu.Lock()
+	old := l.leaseID
+	l.leaseID = lease.ID
+	l.mu.Unlock()
+	l.client.revoke(old)
+	return nil
+}
+
+// Release manually releases the Lock.
+// May return ErrLockNotHeld.
+func (l *Lock) Release(ctx context.Context) error {
+	resp, err := l.client.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(l.key), "=", l.value)).
+		Then(clientv3.OpDelete(l.key)).
+		Commit()
+	if err != nil {
+		return err
+	}
+	l.client.revoke(l.lease())
+	if !resp.Succeeded {
+		return ErrLockNotHeld
+	}
+	return nil
+}
+
+type LockOption func(c *lockOption)
+
+// Options describe the options for the Lock
+type lockOption struct {
+	// retryStrategy allows to customise the Lock retry strategy.
+	// Default: do not retry
+	retryStrategy RetryStrategy
+
+	// metadata string is appended to the Lock token.
+	metadata string
+}
+
+func WithLockOptionMetadata(md string) LockOption {
+	return func(lo *lockOption) {
+		lo.metadata = md
+	}
+}
+
+func WithLockOptionRetryStrategy(retryStrategy RetryStrategy) LockOption {
+	return func(lo *lockOption) {
+		lo.retryStrategy = retryStrategy
+	}
+}
@@ -0,0 +1,325 @@
+package eetcd
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"go.etcd.io/etcd/client/v3"
+)
+
+// fakeEtcd 内存中的KV和Lease，只实现用到的Get、Txn、Grant、Revoke和TimeToLive，Get支持排序和limit；
+// 只保存最新的数据，带revision的Get在revision小于等于compacted时返回ErrCompacted
+type fakeEtcd struct {
+	clientv3.KV
+	clientv3.Lease
+
+	mu        sync.Mutex
+	kvs       map[string]*mvccpb.KeyValue
+	rev       int64
+	compacted int64
+	txns      int
+	leases    map[clientv3.LeaseID]int64
+	revoked   []clientv3.LeaseID
+	granted   clientv3.LeaseID
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{kvs: map[string]*mvccpb.KeyValue{}, leases: map[clientv3.LeaseID]int64{}}
+}
+
+func (f *fakeEtcd) client() *clientv3.Client {
+	return &clientv3.Client{KV: f, Lease: f}
+}
+
+func (f *fakeEtcd) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.get(clientv3.OpGet(key, opts...))
+}
+
+func (f *fakeEtcd) get(op clientv3.Op) (*clientv3.GetResponse, error) {
+	key := string(op.KeyBytes())
+	if key == "\x00" {
+		// 空的前缀，读取全部的key
+		key = ""
+	}
+	if op.Rev() > 0 && op.Rev() <= f.compacted {
+		return nil, rpctypes.ErrCompacted
+	}
+	resp := &clientv3.GetResponse{Header: &pb.ResponseHeader{Revision: f.rev}}
+	if len(op.RangeBytes()) == 0 {
+		if kv, ok := f.kvs[key]; ok {
+			resp.Kvs = append(resp.Kvs, kv)
+		}
+		return resp, nil
+	}
+	for k, kv := range f.kvs {
+		if strings.HasPrefix(k, key) {
+			resp.Kvs = append(resp.Kvs, kv)
+		}
+	}
+	target, order, limit := opSortLimit(op)
+	sort.Slice(resp.Kvs, func(i, j int) bool {
+		a, b := resp.Kvs[i], resp.Kvs[j]
+		if order == clientv3.SortDescend {
+			a, b = b, a
+		}
+		switch target {
+		case clientv3.SortByCreateRevision:
+			return a.CreateRevision < b.CreateRevision
+		case clientv3.SortByModRevision:
+			return a.ModRevision < b.ModRevision
+		}
+		return string(a.Key) < string(b.Key)
+	})
+	resp.Count = int64(len(resp.Kvs))
+	if limit > 0 && int64(len(resp.Kvs)) > limit {
+		resp.Kvs = resp.Kvs[:limit]
+		resp.More = true
+	}
+	return resp, nil
+}
+
+// opSortLimit 读取Op中未导出的排序和limit参数
+func opSortLimit(op clientv3.Op) (clientv3.SortTarget, clientv3.SortOrder, int64) {
+	v := reflect.ValueOf(op)
+	limit := v.FieldByName("limit").Int()
+	sortOption := v.FieldByName("sort")
+	if sortOption.IsNil() {
+		return clientv3.SortByKey, clientv3.SortNone, limit
+	}
+	return clientv3.SortTarget(sortOption.Elem().FieldByName("Target").Int()), clientv3.SortOrder(sortOption.Elem().FieldByName("Order").Int()), limit
+}
+
+func (f *fakeEtcd) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	resp, err := f.Txn(ctx).Then(clientv3.OpPut(key, val, opts...)).Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &clientv3.PutResponse{Header: resp.Header}, nil
+}
+
+func (f *fakeEtcd) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	resp, err := f.Txn(ctx).Then(clientv3.OpDelete(key, opts...)).Commit()
+	if err != nil {
+		return nil, err
+	}
+	return &clientv3.DeleteResponse{Header: resp.Header}, nil
+}
+
+// KeepAlive 租约不会过期，ctx结束时关闭channel
+func (f *fakeEtcd) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	ch := make(chan *clientv3.LeaseKeepAliveResponse)
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+// put 直接写入key，返回写入后的revision
+func (f *fakeEtcd) put(key, value string) int64 {
+	_, _ = f.Txn(context.Background()).Then(clientv3.OpPut(key, value)).Commit()
+	return f.rev
+}
+
+func (f *fakeEtcd) Txn(ctx context.Context) clientv3.Txn {
+	return &fakeTxn{etcd: f}
+}
+
+func (f *fakeEtcd) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.granted++
+	f.leases[f.granted] = ttl
+	return &clientv3.LeaseGrantResponse{ID: f.granted, TTL: ttl}, nil
+}
+
+func (f *fakeEtcd) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.leases, id)
+	f.revoked = append(f.revoked, id)
+	for key, kv := range f.kvs {
+		if clientv3.LeaseID(kv.Lease) == id {
+			delete(f.kvs, key)
+		}
+	}
+	return &clientv3.LeaseRevokeResponse{}, nil
+}
+
+func (f *fakeEtcd) TimeToLive(ctx context.Context, id clientv3.LeaseID, opts ...clientv3.LeaseOption) (*clientv3.LeaseTimeToLiveResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ttl, ok := f.leases[id]
+	if !ok {
+		ttl = -1
+	}
+	return &clientv3.LeaseTimeToLiveResponse{ID: id, TTL: ttl}, nil
+}
+
+// fakeTxn Op中的租约不可见，写入的key绑定最近创建的租约，Get的结果按顺序放到Responses中
+type fakeTxn struct {
+	etcd *fakeEtcd
+	cmps []clientv3.Cmp
+	then []clientv3.Op
+	els  []clientv3.Op
+}
+
+func (t *fakeTxn) If(cs ...clientv3.Cmp) clientv3.Txn   { t.cmps = append(t.cmps, cs...); return t }
+func (t *fakeTxn) Then(ops ...clientv3.Op) clientv3.Txn { t.then = append(t.then, ops...); return t }
+func (t *fakeTxn) Else(ops ...clientv3.Op) clientv3.Txn { t.els = append(t.els, ops...); return t }
+
+func (t *fakeTxn) Commit() (*clientv3.TxnResponse, error) {
+	f := t.etcd
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.txns++
+	succeeded := true
+	for _, cmp := range t.cmps {
+		kv := f.kvs[string(cmp.Key)]
+		switch target := cmp.TargetUnion.(type) {
+		case *pb.Compare_CreateRevision:
+			var rev int64
+			if kv != nil {
+				rev = kv.CreateRevision
+			}
+			succeeded = succeeded && compareInt(cmp.Result, rev, target.CreateRevision)
+		case *pb.Compare_Version:
+			var version int64
+			if kv != nil {
+				version = kv.Version
+			}
+			succeeded = succeeded && compareInt(cmp.Result, version, target.Version)
+		case *pb.Compare_ModRevision:
+			var rev int64
+			if kv != nil {
+				rev = kv.ModRevision
+			}
+			succeeded = succeeded && compareInt(cmp.Result, rev, target.ModRevision)
+		case *pb.Compare_Value:
+			succeeded = succeeded && kv != nil && string(kv.Value) == string(target.Value)
+		}
+	}
+	ops := t.els
+	if succeeded {
+		ops = t.then
+	}
+	resp := &clientv3.TxnResponse{Header: &pb.ResponseHeader{}, Succeeded: succeeded}
+	for _, op := range ops {
+		key := string(op.KeyBytes())
+		switch {
+		case op.IsGet():
+			getResp, err := f.get(op)
+			if err != nil {
+				return nil, err
+			}
+			resp.Responses = append(resp.Responses, &pb.ResponseOp{Response: &pb.ResponseOp_ResponseRange{ResponseRange: (*pb.RangeResponse)(getResp)}})
+		case op.IsPut():
+			f.rev++
+			kv := &mvccpb.KeyValue{Key: op.KeyBytes(), Value: op.ValueBytes(), CreateRevision: f.rev, ModRevision: f.rev, Version: 1, Lease: int64(f.granted)}
+			if old, ok := f.kvs[key]; ok {
+				kv.CreateRevision = old.CreateRevision
+				kv.Version = old.Version + 1
+			}
+			f.kvs[key] = kv
+		case op.IsDelete():
+			delete(f.kvs, key)
+		}
+	}
+	resp.Header.Revision = f.rev
+	return resp, nil
+}
+
+func compareInt(result pb.Compare_CompareResult, a, b int64) bool {
+	switch result {
+	case pb.Compare_GREATER:
+		return a > b
+	case pb.Compare_LESS:
+		return a < b
+	case pb.Compare_NOT_EQUAL:
+		return a != b
+	}
+	return a == b
+}
+
+func TestLeaseSeconds(t *testing.T) {
+	tests := []struct {
+		ttl  time.Duration
+		want int64
+	}{
+		{0, 1},
+		{100 * time.Millisecond, 1},
+		{time.Second, 1},
+		{1500 * time.Millisecond, 2},
+		{10 * time.Second, 10},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, leaseSeconds(tt.ttl), tt.ttl.String())
+	}
+}
+
+func TestLockClient(t *testing.T) {
+	ctx := context.Background()
+	etcd := newFakeEtcd()
+	var client LockClient = &lockClient{client: etcd.client()}
+
+	lock, err := client.Obtain(ctx, "/locks/a", 1500*time.Millisecond, WithLockOptionMetadata("meta"))
+	require.NoError(t, err)
+	assert.Equal(t, "/locks/a", lock.Key())
+	assert.Len(t, lock.Token(), 22)
+	assert.Equal(t, "meta", lock.Metadata())
+	ttl, err := lock.TTL(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, ttl)
+
+	// 锁已经被持有，不重试时直接返回，创建的租约被撤销
+	_, err = client.Obtain(ctx, "/locks/a", time.Second)
+	assert.Equal(t, ErrNotObtained, err)
+	assert.Equal(t, []clientv3.LeaseID{2}, etcd.revoked)
+
+	// 刷新时换绑新的租约，撤销原来的租约
+	require.NoError(t, lock.Refresh(ctx, 5*time.Second))
+	assert.Equal(t, []clientv3.LeaseID{2, 1}, etcd.revoked)
+	ttl, err = lock.TTL(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, ttl)
+
+	require.NoError(t, lock.Release(ctx))
+	assert.Equal(t, ErrLockNotHeld, lock.Release(ctx))
+	assert.Equal(t, ErrNotObtained, lock.Refresh(ctx, time.Second))
+	ttl, err = lock.TTL(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, ttl)
+
+	// 释放后可以重新获取
+	other, err := client.Obtain(ctx, "/locks/a", time.Second)
+	require.NoError(t, err)
+	assert.NotEqual(t, lock.Token(), other.Token())
+}
+
+func TestLockClientRetry(t *testing.T) {
+	ctx := context.Background()
+	etcd := newFakeEtcd()
+	client := &lockClient{client: etcd.client()}
+
+	lock, err := client.Obtain(ctx, "/locks/b", time.Second)
+	require.NoError(t, err)
+	go func() {
+		time.Sleep(30 * time.Millisecond)
+		_ = lock.Release(ctx)
+	}()
+	other, err := client.Obtain(ctx, "/locks/b", time.Second, WithLockOptionRetryStrategy(LinearBackoffRetry(10*time.Millisecond)))
+	require.NoError(t, err)
+	assert.Equal(t, "/locks/b", other.Key())
+}
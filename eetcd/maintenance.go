@@ -0,0 +1,301 @@
+package eetcd
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/client/v3"
+)
+
+// snapshotHashSize 快照文件末尾追加的sha256长度
+const snapshotHashSize = sha256.Size
+
+// SaveSnapshot 将当前集群的快照保存到path，先写入临时文件，完整写入并校验后再重命名，返回快照的大小。
+// 重建数据目录需要在etcd节点上使用etcdutl snapshot restore，客户端可以使用RestoreSnapshot将快照中的key写回集群
+func (c *Component) SaveSnapshot(ctx context.Context, path string) (int64, error) {
+	beg := time.Now()
+	partPath := path + ".part"
+	f, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return 0, fmt.Errorf("create snapshot file fail, %w", err)
+	}
+	defer os.Remove(partPath)
+
+	rd, err := c.Snapshot(ctx)
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+	size, err := io.Copy(f, rd)
+	rd.Close()
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("save snapshot fail, %w", err)
+	}
+	if err := VerifySnapshot(partPath); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(partPath, path); err != nil {
+		return 0, fmt.Errorf("rename snapshot file fail, %w", err)
+	}
+	c.logger.Info("save snapshot", elog.String("path", path), elog.Int64("size", size), elog.FieldCost(time.Since(beg)))
+	return size, nil
+}
+
+// VerifySnapshot 校验快照文件末尾的sha256与内容是否一致
+func VerifySnapshot(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	// boltdb的大小是512的整数倍，etcd在快照末尾追加了sha256
+	if info.Size() < snapshotHashSize || (info.Size()-snapshotHashSize)%512 != 0 {
+		return fmt.Errorf("snapshot %s has no integrity hash, size %d", path, info.Size())
+	}
+	h := sha256.New()
+	if _, err := io.CopyN(h, f, info.Size()-snapshotHashSize); err != nil {
+		return err
+	}
+	expected := make([]byte, snapshotHashSize)
+	if _, err := io.ReadFull(f, expected); err != nil {
+		return err
+	}
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return fmt.Errorf("snapshot %s integrity hash mismatch", path)
+	}
+	return nil
+}
+
+// snapshotKeyBucket etcd数据文件中保存key的bucket，key为revision，value为mvccpb.KeyValue
+var snapshotKeyBucket = []byte("key")
+
+// maxRestoreTxnOps 每个事务写入的key数量，etcd默认的--max-txn-ops为128
+const maxRestoreTxnOps = 128
+
+// RestoreOption RestoreSnapshot的选项
+type RestoreOption func(o *restoreOption)
+
+type restoreOption struct {
+	prefix     string
+	withLeased bool
+	skipVerify bool
+}
+
+// WithRestorePrefix 只恢复prefix下的key，默认恢复全部key
+func WithRestorePrefix(prefix string) RestoreOption {
+	return func(o *restoreOption) {
+		o.prefix = prefix
+	}
+}
+
+// WithRestoreLeasedKeys 恢复绑定了租约的key，快照中的租约不会恢复，这些key恢复后不会过期，默认跳过
+func WithRestoreLeasedKeys() RestoreOption {
+	return func(o *restoreOption) {
+		o.withLeased = true
+	}
+}
+
+// WithRestoreSkipVerify 不校验快照末尾的sha256，用于从节点数据目录直接拷贝的db文件
+func WithRestoreSkipVerify() RestoreOption {
+	return func(o *restoreOption) {
+		o.skipVerify = true
+	}
+}
+
+// RestoreSnapshot 将快照中每个key的最新值写回当前集群，返回写入的key数量。
+// 用于误删、误改后从快照中找回数据，不会删除集群中快照里没有的key，也不恢复租约、用户和权限；
+// 配置了namespace时只恢复namespace下的key，写入时去掉namespace前缀。
+// 重建整个集群需要在etcd节点上使用etcdutl snapshot restore
+func (c *Component) RestoreSnapshot(ctx context.Context, path string, opts ...RestoreOption) (int, error) {
+	beg := time.Now()
+	opt := &restoreOption{}
+	for _, o := range opts {
+		o(opt)
+	}
+	kvs, err := readSnapshot(path, !opt.skipVerify)
+	if err != nil {
+		return 0, err
+	}
+
+	ops := make([]clientv3.Op, 0, maxRestoreTxnOps)
+	var restored int
+	flush := func() error {
+		if len(ops) == 0 {
+			return nil
+		}
+		if _, err := c.Txn(ctx).Then(ops...).Commit(); err != nil {
+			return fmt.Errorf("restore snapshot fail, %w", err)
+		}
+		restored += len(ops)
+		ops = ops[:0]
+		return nil
+	}
+	for _, kv := range kvs {
+		key := string(kv.Key)
+		if !strings.HasPrefix(key, c.config.Namespace) {
+			continue
+		}
+		key = strings.TrimPrefix(key, c.config.Namespace)
+		if !strings.HasPrefix(key, opt.prefix) || (kv.Lease != 0 && !opt.withLeased) {
+			continue
+		}
+		ops = append(ops, clientv3.OpPut(key, string(kv.Value)))
+		if len(ops) == maxRestoreTxnOps {
+			if err := flush(); err != nil {
+				return restored, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return restored, err
+	}
+	c.logger.Info("restore snapshot", elog.String("path", path), elog.Int("keys", restored), elog.FieldCost(time.Since(beg)))
+	return restored, nil
+}
+
+// readSnapshot 按revision顺序读取快照中的key，返回每个key的最新值，删除的key不返回
+func readSnapshot(path string, verify bool) ([]*mvccpb.KeyValue, error) {
+	dbPath := path
+	if verify {
+		if err := VerifySnapshot(path); err != nil {
+			return nil, err
+		}
+		// bolt不能打开末尾追加了sha256的文件，去掉sha256后拷贝到临时文件
+		tmp, err := copySnapshotData(path)
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(tmp)
+		dbPath = tmp
+	}
+
+	db, err := bolt.Open(dbPath, 0400, &bolt.Options{ReadOnly: true, Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open snapshot fail, %w", err)
+	}
+	defer db.Close()
+
+	latest := make(map[string]*mvccpb.KeyValue)
+	order := make([]string, 0)
+	err = db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(snapshotKeyBucket)
+		if bucket == nil {
+			return fmt.Errorf("snapshot %s has no key bucket", path)
+		}
+		return bucket.ForEach(func(rev, value []byte) error {
+			kv := &mvccpb.KeyValue{}
+			if err := kv.Unmarshal(value); err != nil {
+				return err
+			}
+			key := string(kv.Key)
+			// revision为8字节main、'_'、8字节sub，删除的key末尾追加't'
+			if len(rev) == 18 && rev[17] == 't' {
+				delete(latest, key)
+				return nil
+			}
+			if _, ok := latest[key]; !ok {
+				order = append(order, key)
+			}
+			latest[key] = kv
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot fail, %w", err)
+	}
+
+	kvs := make([]*mvccpb.KeyValue, 0, len(latest))
+	for _, key := range order {
+		if kv, ok := latest[key]; ok {
+			kvs = append(kvs, kv)
+			delete(latest, key)
+		}
+	}
+	return kvs, nil
+}
+
+// copySnapshotData 将快照去掉末尾的sha256后拷贝到临时文件，返回临时文件的路径
+func copySnapshotData(path string) (string, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return "", err
+	}
+	dst, err := ioutil.TempFile("", "eetcd-snapshot-*.db")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.CopyN(dst, src, info.Size()-snapshotHashSize)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+	return dst.Name(), nil
+}
+
+// EndpointStatus 节点的状态，Err不为空时表示获取状态失败
+type EndpointStatus struct {
+	Endpoint string
+	Status   *clientv3.StatusResponse
+	Err      error
+}
+
+// EndpointStatuses 获取所有节点的状态，单个节点失败不影响其他节点
+func (c *Component) EndpointStatuses(ctx context.Context) []EndpointStatus {
+	endpoints := c.Endpoints()
+	statuses := make([]EndpointStatus, 0, len(endpoints))
+	for _, ep := range endpoints {
+		resp, err := c.Status(ctx, ep)
+		statuses = append(statuses, EndpointStatus{Endpoint: ep, Status: resp, Err: err})
+	}
+	return statuses
+}
+
+// DefragmentAll 依次整理所有节点的碎片，整理期间节点不能处理请求，不要同时整理多个节点，遇到错误时停止
+func (c *Component) DefragmentAll(ctx context.Context) error {
+	for _, ep := range c.Endpoints() {
+		beg := time.Now()
+		if _, err := c.Defragment(ctx, ep); err != nil {
+			return fmt.Errorf("defragment %s fail, %w", ep, err)
+		}
+		c.logger.Info("defragment", elog.FieldAddr(ep), elog.FieldCost(time.Since(beg)))
+	}
+	return nil
+}
+
+// Alarms 获取集群当前的告警，如NOSPACE、CORRUPT
+func (c *Component) Alarms(ctx context.Context) ([]*etcdserverpb.AlarmMember, error) {
+	resp, err := c.AlarmList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Alarms, nil
+}
@@ -0,0 +1,154 @@
+package eetcd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/client/v3"
+)
+
+type snapshotRecord struct {
+	key       string
+	value     string
+	lease     int64
+	tombstone bool
+}
+
+// writeSnapshot 按etcd数据文件的格式写入key bucket，每条记录使用递增的revision，末尾追加sha256
+func writeSnapshot(t *testing.T, records []snapshotRecord) string {
+	dir, err := ioutil.TempDir("", "eetcd-snapshot")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "snapshot.db")
+
+	db, err := bolt.Open(path, 0600, nil)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucket(snapshotKeyBucket)
+		if err != nil {
+			return err
+		}
+		for i, record := range records {
+			rev := make([]byte, 17, 18)
+			binary.BigEndian.PutUint64(rev, uint64(i+2))
+			rev[8] = '_'
+			if record.tombstone {
+				rev = append(rev, 't')
+			}
+			kv := &mvccpb.KeyValue{Key: []byte(record.key), Value: []byte(record.value), ModRevision: int64(i + 2), Lease: record.lease}
+			value, err := kv.Marshal()
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put(rev, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+	require.NoError(t, db.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	hash := sha256.Sum256(data)
+	require.NoError(t, ioutil.WriteFile(path, append(data, hash[:]...), 0600))
+	return path
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	path := writeSnapshot(t, []snapshotRecord{
+		{key: "/prod/config/a", value: "1"},
+		{key: "/prod/config/b", value: "2"},
+		{key: "/prod/config/a", value: "11"},
+		{key: "/prod/config/b", tombstone: true},
+		{key: "/prod/services/x", value: "addr", lease: 7},
+		{key: "/prod/other", value: "o"},
+		{key: "/test/config/a", value: "t"},
+	})
+	require.NoError(t, VerifySnapshot(path))
+
+	tests := []struct {
+		name      string
+		namespace string
+		opts      []RestoreOption
+		want      map[string]string
+	}{
+		{
+			name: "all keys without leases",
+			want: map[string]string{"/prod/config/a": "11", "/prod/other": "o", "/test/config/a": "t"},
+		},
+		{
+			name: "prefix",
+			opts: []RestoreOption{WithRestorePrefix("/prod/config/")},
+			want: map[string]string{"/prod/config/a": "11"},
+		},
+		{
+			name: "leased keys",
+			opts: []RestoreOption{WithRestorePrefix("/prod/services/"), WithRestoreLeasedKeys()},
+			want: map[string]string{"/prod/services/x": "addr"},
+		},
+		{
+			name:      "namespace",
+			namespace: "/prod/",
+			opts:      []RestoreOption{WithRestorePrefix("config/")},
+			want:      map[string]string{"config/a": "11"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			etcd := newFakeEtcd()
+			c := &Component{Client: etcd.client(), config: &config{Namespace: tt.namespace}, logger: elog.DefaultLogger}
+			n, err := c.RestoreSnapshot(context.Background(), path, tt.opts...)
+			require.NoError(t, err)
+			assert.Equal(t, len(tt.want), n)
+
+			resp, err := etcd.Get(context.Background(), "", clientv3.WithPrefix())
+			require.NoError(t, err)
+			got := make(map[string]string)
+			for _, kv := range resp.Kvs {
+				got[string(kv.Key)] = string(kv.Value)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRestoreSnapshotBatches(t *testing.T) {
+	records := make([]snapshotRecord, 0, 300)
+	for i := 0; i < 300; i++ {
+		records = append(records, snapshotRecord{key: fmt.Sprintf("/k/%03d", i), value: "v"})
+	}
+	path := writeSnapshot(t, records)
+	etcd := newFakeEtcd()
+	c := &Component{Client: etcd.client(), config: &config{}, logger: elog.DefaultLogger}
+	n, err := c.RestoreSnapshot(context.Background(), path)
+	require.NoError(t, err)
+	assert.Equal(t, 300, n)
+	assert.Len(t, etcd.kvs, 300)
+	// 每个事务最多128个key
+	assert.Equal(t, 3, etcd.txns)
+}
+
+func TestRestoreSnapshotCorrupted(t *testing.T) {
+	path := writeSnapshot(t, []snapshotRecord{{key: "/a", value: "1"}})
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err)
+	_, err = f.Write([]byte("x"))
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	c := &Component{Client: newFakeEtcd().client(), config: &config{}, logger: elog.DefaultLogger}
+	_, err = c.RestoreSnapshot(context.Background(), path)
+	assert.Error(t, err)
+}
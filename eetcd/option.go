@@ -1,5 +1,7 @@
 package eetcd
 
+import "time"
+
 type Option func(c *Container)
 
 func WithAddrs(addrs []string) Option {
@@ -49,3 +51,31 @@ func WithEnableSecure(secure bool) Option {
 		c.config.EnableSecure = secure
 	}
 }
+
+// WithNamespace 设置key的命名空间
+func WithNamespace(namespace string) Option {
+	return func(c *Container) {
+		c.config.Namespace = namespace
+	}
+}
+
+// WithAutoSyncInterval 设置从member list自动同步地址的间隔
+func WithAutoSyncInterval(interval time.Duration) Option {
+	return func(c *Container) {
+		c.config.AutoSyncInterval = interval
+	}
+}
+
+// WithPasswordFile 设置密码文件
+func WithPasswordFile(passwordFile string) Option {
+	return func(c *Container) {
+		c.config.PasswordFile = passwordFile
+	}
+}
+
+// WithCredentialReloadInterval 设置检查证书、密码文件是否变化的间隔
+func WithCredentialReloadInterval(interval time.Duration) Option {
+	return func(c *Container) {
+		c.config.CredentialReloadInterval = interval
+	}
+}
@@ -0,0 +1,85 @@
+package eetcd
+
+import (
+	"context"
+	"fmt"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/client/v3"
+)
+
+// Queue 先进先出队列，按写入的先后顺序出队，适用于量不大的协调类任务
+type Queue struct {
+	client *Component
+	prefix string
+}
+
+// NewQueue 创建先进先出队列，队列中的元素保存在prefix下
+func (c *Component) NewQueue(prefix string) *Queue {
+	return &Queue{client: c, prefix: prefix}
+}
+
+// Enqueue 入队
+func (q *Queue) Enqueue(ctx context.Context, value string) error {
+	_, _, err := putUniqueKey(ctx, q.client.Client, q.prefix, value, clientv3.NoLease)
+	return err
+}
+
+// Dequeue 出队，队列为空时阻塞直到有元素入队或者ctx结束
+func (q *Queue) Dequeue(ctx context.Context) (string, error) {
+	return dequeue(ctx, q.client.Client, q.prefix, clientv3.WithFirstCreate()...)
+}
+
+// PriorityQueue 优先级队列，priority越小越先出队，priority相同时按写入的先后顺序出队
+type PriorityQueue struct {
+	client *Component
+	prefix string
+}
+
+// NewPriorityQueue 创建优先级队列，队列中的元素保存在prefix下
+func (c *Component) NewPriorityQueue(prefix string) *PriorityQueue {
+	return &PriorityQueue{client: c, prefix: prefix}
+}
+
+// Enqueue 按优先级入队
+func (q *PriorityQueue) Enqueue(ctx context.Context, value string, priority uint16) error {
+	// 优先级补齐为相同的长度，按key排序即按优先级排序
+	prefix := fmt.Sprintf("%s/%05d", q.prefix, priority)
+	_, _, err := putUniqueKey(ctx, q.client.Client, prefix, value, clientv3.NoLease)
+	return err
+}
+
+// Dequeue 取出优先级最高的元素，队列为空时阻塞直到有元素入队或者ctx结束
+func (q *PriorityQueue) Dequeue(ctx context.Context) (string, error) {
+	return dequeue(ctx, q.client.Client, q.prefix, clientv3.WithFirstKey()...)
+}
+
+// dequeue 按排序取出prefix下的第一个元素并删除，多个进程同时出队时只有一个能删除成功，失败的进程重新获取
+func dequeue(ctx context.Context, client *clientv3.Client, prefix string, sortOpts ...clientv3.OpOption) (string, error) {
+	for {
+		opts := append([]clientv3.OpOption{clientv3.WithPrefix()}, sortOpts...)
+		resp, err := client.Get(ctx, prefix+"/", opts...)
+		if err != nil {
+			return "", err
+		}
+		if len(resp.Kvs) == 0 {
+			// 队列为空，等待新的元素入队
+			if err := waitEvent(ctx, client, prefix+"/", resp.Header.Revision+1, mvccpb.PUT, clientv3.WithPrefix()); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		kv := resp.Kvs[0]
+		txnResp, err := client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(string(kv.Key)), "=", kv.ModRevision)).
+			Then(clientv3.OpDelete(string(kv.Key))).
+			Commit()
+		if err != nil {
+			return "", err
+		}
+		if txnResp.Succeeded {
+			return string(kv.Value), nil
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package eetcd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/client/v3"
+)
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+	c := &Component{Client: newFakeEtcd().client()}
+	queue := c.NewQueue("/queue")
+	for _, value := range []string{"c", "a", "b"} {
+		require.NoError(t, queue.Enqueue(ctx, value))
+	}
+
+	// 按入队的先后顺序出队，与值的大小无关
+	for _, want := range []string{"c", "a", "b"} {
+		value, err := queue.Dequeue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, want, value)
+	}
+}
+
+func TestPriorityQueue(t *testing.T) {
+	ctx := context.Background()
+	c := &Component{Client: newFakeEtcd().client()}
+	queue := c.NewPriorityQueue("/pq")
+	items := []struct {
+		value    string
+		priority uint16
+	}{
+		{"low-1", 10},
+		{"high-1", 1},
+		{"low-2", 10},
+		{"urgent", 0},
+		{"high-2", 1},
+		{"low-3", 10},
+	}
+	for _, item := range items {
+		require.NoError(t, queue.Enqueue(ctx, item.value, item.priority))
+	}
+
+	// priority越小越先出队，priority相同时按入队的先后顺序出队
+	for _, want := range []string{"urgent", "high-1", "high-2", "low-1", "low-2", "low-3"} {
+		value, err := queue.Dequeue(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, want, value)
+	}
+}
+
+func TestQueueConcurrentDequeue(t *testing.T) {
+	ctx := context.Background()
+	etcd := newFakeEtcd()
+	c := &Component{Client: etcd.client()}
+	queue := c.NewQueue("/queue")
+	const n = 20
+	want := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		value := fmt.Sprintf("job-%d", i)
+		want = append(want, value)
+		require.NoError(t, queue.Enqueue(ctx, value))
+	}
+
+	// 多个进程同时出队，每个元素只被取出一次
+	var (
+		wg  sync.WaitGroup
+		mu  sync.Mutex
+		got []string
+	)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := queue.Dequeue(ctx)
+			assert.NoError(t, err)
+			mu.Lock()
+			got = append(got, value)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.ElementsMatch(t, want, got)
+
+	resp, err := etcd.Get(ctx, "/queue/", clientv3.WithPrefix())
+	require.NoError(t, err)
+	assert.Empty(t, resp.Kvs)
+}
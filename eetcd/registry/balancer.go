@@ -0,0 +1,105 @@
+package registry
+
+import (
+	"sync"
+
+	"github.com/gotomicro/ego/core/constant"
+	"github.com/gotomicro/ego/core/eapp"
+	"github.com/gotomicro/ego/server"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+)
+
+const (
+	// WeightedBalancerName 按注册信息中的weight加权轮询，egrpc配置balancerName = "ego_weighted"
+	WeightedBalancerName = "ego_weighted"
+	// ZoneWeightedBalancerName 优先选择与调用方相同zone的节点，相同zone内加权轮询，
+	// 相同zone内没有可用节点时在全部节点内加权轮询，egrpc配置balancerName = "ego_zone_weighted"
+	ZoneWeightedBalancerName = "ego_zone_weighted"
+)
+
+func init() {
+	balancer.Register(base.NewBalancerBuilder(WeightedBalancerName, &weightedPickerBuilder{}, base.Config{HealthCheck: true}))
+	balancer.Register(base.NewBalancerBuilder(ZoneWeightedBalancerName, &weightedPickerBuilder{zone: eapp.AppZone()}, base.Config{HealthCheck: true}))
+}
+
+type weightedPickerBuilder struct {
+	zone string // 调用方的zone，为空时不区分zone
+}
+
+// Build 根据可用的节点创建picker，weight小于等于0的节点不分配流量，全部节点的weight都小于等于0时平均分配
+func (b *weightedPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	all := make([]*weightedNode, 0, len(info.ReadySCs))
+	local := make([]*weightedNode, 0, len(info.ReadySCs))
+	for sc, scInfo := range info.ReadySCs {
+		node := &weightedNode{subConn: sc, weight: 1}
+		var zone string
+		if attrs := scInfo.Address.Attributes; attrs != nil {
+			if serviceInfo, ok := attrs.Value(constant.KeyServiceInfo).(server.ServiceInfo); ok {
+				node.weight = serviceInfo.Weight
+				zone = serviceInfo.Zone
+			}
+		}
+		all = append(all, node)
+		if b.zone != "" && zone == b.zone {
+			local = append(local, node)
+		}
+	}
+	if nodes := withWeight(local); len(nodes) > 0 {
+		return &weightedPicker{nodes: nodes}
+	}
+	if nodes := withWeight(all); len(nodes) > 0 {
+		return &weightedPicker{nodes: nodes}
+	}
+	// 全部节点的weight都小于等于0，平均分配
+	for _, node := range all {
+		node.weight = 1
+	}
+	return &weightedPicker{nodes: all}
+}
+
+// withWeight 过滤weight小于等于0的节点
+func withWeight(nodes []*weightedNode) []*weightedNode {
+	res := make([]*weightedNode, 0, len(nodes))
+	for _, node := range nodes {
+		if node.weight > 0 {
+			res = append(res, node)
+		}
+	}
+	return res
+}
+
+type weightedNode struct {
+	subConn balancer.SubConn
+	weight  float64
+	current float64
+}
+
+// weightedPicker 平滑加权轮询，与nginx的算法一致，权重大的节点不会连续被选中
+type weightedPicker struct {
+	mu    sync.Mutex
+	nodes []*weightedNode
+}
+
+// Pick ...
+func (p *weightedPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var (
+		total float64
+		best  *weightedNode
+	)
+	for _, node := range p.nodes {
+		node.current += node.weight
+		total += node.weight
+		if best == nil || node.current > best.current {
+			best = node
+		}
+	}
+	best.current -= total
+	return balancer.PickResult{SubConn: best.subConn}, nil
+}
@@ -0,0 +1,165 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/gotomicro/ego/core/constant"
+	"github.com/gotomicro/ego/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+type fakeSubConn struct {
+	balancer.SubConn
+	name string
+}
+
+// buildInfo 根据节点的注册信息创建PickerBuildInfo，info为nil的节点没有注册信息
+func buildInfo(infos map[string]*server.ServiceInfo) base.PickerBuildInfo {
+	info := base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{}}
+	for name, serviceInfo := range infos {
+		sc := &fakeSubConn{name: name}
+		addr := resolver.Address{Addr: name}
+		if serviceInfo != nil {
+			addr.Attributes = attributes.New(constant.KeyServiceInfo, *serviceInfo)
+		}
+		info.ReadySCs[sc] = base.SubConnInfo{Address: addr}
+	}
+	return info
+}
+
+// pickCounts 选择n次，返回每个节点被选中的次数
+func pickCounts(t *testing.T, picker balancer.Picker, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		res, err := picker.Pick(balancer.PickInfo{})
+		require.NoError(t, err)
+		counts[res.SubConn.(*fakeSubConn).name]++
+	}
+	return counts
+}
+
+func TestWeightedPickerBuilder(t *testing.T) {
+	tests := []struct {
+		name  string
+		zone  string
+		infos map[string]*server.ServiceInfo
+		want  map[string]int // 选择70次各节点被选中的次数
+	}{
+		{
+			name: "weighted",
+			infos: map[string]*server.ServiceInfo{
+				"a": {Weight: 5},
+				"b": {Weight: 1},
+				"c": {Weight: 1},
+			},
+			want: map[string]int{"a": 50, "b": 10, "c": 10},
+		},
+		{
+			name: "zero weight gets no traffic",
+			infos: map[string]*server.ServiceInfo{
+				"a": {Weight: 1},
+				"b": {Weight: 0},
+			},
+			want: map[string]int{"a": 70},
+		},
+		{
+			name: "all zero weight is even",
+			infos: map[string]*server.ServiceInfo{
+				"a": {Weight: 0},
+				"b": {Weight: -1},
+			},
+			want: map[string]int{"a": 35, "b": 35},
+		},
+		{
+			name: "missing service info defaults to weight 1",
+			infos: map[string]*server.ServiceInfo{
+				"a": nil,
+				"b": {Weight: 6},
+			},
+			want: map[string]int{"a": 10, "b": 60},
+		},
+		{
+			name: "prefer same zone",
+			zone: "z1",
+			infos: map[string]*server.ServiceInfo{
+				"a": {Weight: 1, Zone: "z1"},
+				"b": {Weight: 1, Zone: "z1"},
+				"c": {Weight: 5, Zone: "z2"},
+			},
+			want: map[string]int{"a": 35, "b": 35},
+		},
+		{
+			name: "fall back to all zones without weighted local nodes",
+			zone: "z1",
+			infos: map[string]*server.ServiceInfo{
+				"a": {Weight: 0, Zone: "z1"},
+				"b": {Weight: 1, Zone: "z2"},
+				"c": {Weight: 1, Zone: "z3"},
+			},
+			want: map[string]int{"b": 35, "c": 35},
+		},
+		{
+			name: "no zone ignores zone",
+			infos: map[string]*server.ServiceInfo{
+				"a": {Weight: 1, Zone: "z1"},
+				"b": {Weight: 1, Zone: "z2"},
+			},
+			want: map[string]int{"a": 35, "b": 35},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info := buildInfo(tt.infos)
+			picker := (&weightedPickerBuilder{zone: tt.zone}).Build(info)
+			assert.Equal(t, tt.want, pickCounts(t, picker, 70))
+		})
+	}
+}
+
+func TestWeightedPickerSmooth(t *testing.T) {
+	info := buildInfo(map[string]*server.ServiceInfo{
+		"a": {Weight: 5},
+		"b": {Weight: 1},
+		"c": {Weight: 1},
+	})
+	picker := (&weightedPickerBuilder{}).Build(info)
+
+	// 平滑加权轮询，每轮的顺序为a a x a y a a，{x, y}为{b, c}，权重小的节点穿插在中间
+	for round := 0; round < 3; round++ {
+		var names []string
+		for i := 0; i < 7; i++ {
+			res, err := picker.Pick(balancer.PickInfo{})
+			require.NoError(t, err)
+			names = append(names, res.SubConn.(*fakeSubConn).name)
+		}
+		assert.Equal(t, []string{"a", "a", "a", "a", "a"}, []string{names[0], names[1], names[3], names[5], names[6]})
+		assert.ElementsMatch(t, []string{"b", "c"}, []string{names[2], names[4]})
+	}
+}
+
+func TestWeightedPickerBuilderNoSubConn(t *testing.T) {
+	picker := (&weightedPickerBuilder{}).Build(base.PickerBuildInfo{})
+	_, err := picker.Pick(balancer.PickInfo{})
+	assert.Equal(t, balancer.ErrNoSubConnAvailable, err)
+}
+
+func TestWithMetadata(t *testing.T) {
+	info := &server.ServiceInfo{Name: "svc", Weight: 1, Zone: "z1", Metadata: map[string]string{"a": "1", "b": "2"}}
+
+	reg := &Component{Config: &Config{}}
+	assert.Same(t, info, reg.withMetadata(info))
+
+	reg = &Component{Config: &Config{Weight: 3, Zone: "z2", Metadata: map[string]string{"b": "3", "c": "4"}}}
+	got := reg.withMetadata(info)
+	assert.Equal(t, float64(3), got.Weight)
+	assert.Equal(t, "z2", got.Zone)
+	assert.Equal(t, map[string]string{"a": "1", "b": "3", "c": "4"}, got.Metadata)
+	// 不修改服务自身的注册信息
+	assert.Equal(t, float64(1), info.Weight)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, info.Metadata)
+}
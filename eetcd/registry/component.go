@@ -25,14 +25,17 @@ import (
 var _ eregistry.Registry = &Component{}
 
 type Component struct {
-	name     string
-	client   *eetcd.Component
-	kvs      sync.Map
-	Config   *Config
-	cancel   context.CancelFunc
-	rmu      *sync.RWMutex
-	sessions map[string]*concurrency.Session
-	logger   *elog.Component
+	name         string
+	client       *eetcd.Component
+	kvs          sync.Map
+	Config       *Config
+	ctx          context.Context
+	cancel       context.CancelFunc
+	rmu          *sync.RWMutex
+	umu          *sync.Mutex // 串行化租约丢失后的重新注册和注销
+	sessions     map[string]*concurrency.Session
+	logger       *elog.Component
+	leaseHandler func(event LeaseEvent)
 }
 
 func newComponent(name string, config *Config, logger *elog.Component, client *eetcd.Component) *Component {
@@ -43,8 +46,10 @@ func newComponent(name string, config *Config, logger *elog.Component, client *e
 		Config:   config,
 		kvs:      sync.Map{},
 		rmu:      &sync.RWMutex{},
+		umu:      &sync.Mutex{},
 		sessions: make(map[string]*concurrency.Session),
 	}
+	reg.ctx, reg.cancel = context.WithCancel(context.Background())
 	resolver.Register(config.Scheme, reg)
 	return reg
 }
@@ -137,6 +142,8 @@ func (reg *Component) unregister(ctx context.Context, key string) error {
 		defer cancel()
 	}
 
+	reg.umu.Lock()
+	defer reg.umu.Unlock()
 	if err := reg.delSession(key); err != nil {
 		return err
 	}
@@ -188,74 +195,76 @@ func (reg *Component) registerMetric(ctx context.Context, info *server.ServiceIn
 
 	val := info.Address
 	key := fmt.Sprintf(metric, info.Name, val)
-
-	opOptions := make([]clientv3.OpOption, 0)
-	if ttl := reg.Config.ServiceTTL.Seconds(); ttl > 0 {
-		//todo ctx without timeout for same as service life?
-		sess, err := reg.getSession(key, concurrency.WithTTL(int(ttl)))
-		if err != nil {
-			return err
-		}
-		opOptions = append(opOptions, clientv3.WithLease(sess.Lease()))
-	}
-	_, err := reg.client.Put(ctx, key, val, opOptions...)
-	if err != nil {
+	if err := reg.put(ctx, key, val); err != nil {
 		reg.logger.Error("register service", elog.FieldErrKind("register err"), elog.FieldErr(err), elog.FieldKey(key), elog.FieldValueAny(info))
 		return err
 	}
-
 	reg.logger.Info("register service", elog.FieldKey(key), elog.FieldValueAny(val))
-	reg.kvs.Store(key, val)
 	return nil
-
 }
+
 func (reg *Component) registerBiz(ctx context.Context, info *server.ServiceInfo) error {
-	var readCtx context.Context
-	var readCancel context.CancelFunc
 	if _, ok := ctx.Deadline(); !ok {
-		readCtx, readCancel = context.WithTimeout(ctx, reg.Config.ReadTimeout)
-		defer readCancel()
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, reg.Config.ReadTimeout)
+		defer cancel()
 	}
 
 	key := reg.registerKey(info)
-	val := reg.registerValue(info)
+	val := reg.registerValue(reg.withMetadata(info))
+	if err := reg.put(ctx, key, val); err != nil {
+		reg.logger.Error("register service", elog.FieldErrKind("register err"), elog.FieldErr(err), elog.FieldKey(key), elog.FieldValueAny(info))
+		return err
+	}
+	reg.logger.Info("register service", elog.FieldKey(key), elog.FieldValueAny(val))
+	return nil
+}
 
+// put 写入注册信息，配置了ServiceTTL时绑定到租约上，并监听租约是否丢失
+func (reg *Component) put(ctx context.Context, key string, val string) error {
 	opOptions := make([]clientv3.OpOption, 0)
 	// opOptions = append(opOptions, clientv3.WithSerializable())
+	var sess *concurrency.Session
+	var created bool
 	if ttl := reg.Config.ServiceTTL.Seconds(); ttl > 0 {
 		//todo ctx without timeout for same as service life?
-		sess, err := reg.getSession(key, concurrency.WithTTL(int(ttl)))
+		var err error
+		sess, created, err = reg.getSession(key, concurrency.WithTTL(int(ttl)))
 		if err != nil {
 			return err
 		}
-
 		opOptions = append(opOptions, clientv3.WithLease(sess.Lease()))
 	}
-	_, err := reg.client.Put(readCtx, key, val, opOptions...)
+	_, err := reg.client.Put(ctx, key, val, opOptions...)
 	if err != nil {
-		reg.logger.Error("register service", elog.FieldErrKind("register err"), elog.FieldErr(err), elog.FieldKey(key), elog.FieldValueAny(info))
+		if created && reg.dropSession(key, sess) {
+			// 写入失败时丢弃新建的session，下次注册重新创建并监听
+			_ = sess.Close()
+		}
 		return err
 	}
-	reg.logger.Info("register service", elog.FieldKey(key), elog.FieldValueAny(val))
 	reg.kvs.Store(key, val)
+	if created {
+		go reg.keepRegistered(key, sess)
+	}
 	return nil
 }
 
-func (reg *Component) getSession(k string, opts ...concurrency.SessionOption) (*concurrency.Session, error) {
+func (reg *Component) getSession(k string, opts ...concurrency.SessionOption) (*concurrency.Session, bool, error) {
 	reg.rmu.RLock()
 	sess, ok := reg.sessions[k]
 	reg.rmu.RUnlock()
 	if ok {
-		return sess, nil
+		return sess, false, nil
 	}
 	sess, err := concurrency.NewSession(reg.client.Client, opts...)
 	if err != nil {
-		return sess, err
+		return sess, false, err
 	}
 	reg.rmu.Lock()
 	reg.sessions[k] = sess
 	reg.rmu.Unlock()
-	return sess, nil
+	return sess, true, nil
 }
 
 func (reg *Component) delSession(k string) error {
@@ -279,6 +288,30 @@ func (reg *Component) registerKey(info *server.ServiceInfo) string {
 	return eregistry.GetServiceKey(reg.Config.Prefix, info)
 }
 
+// withMetadata 使用配置中的weight、zone、metadata覆盖服务自身的注册信息
+func (reg *Component) withMetadata(info *server.ServiceInfo) *server.ServiceInfo {
+	if reg.Config.Weight <= 0 && reg.Config.Zone == "" && len(reg.Config.Metadata) == 0 {
+		return info
+	}
+	copied := *info
+	if reg.Config.Weight > 0 {
+		copied.Weight = reg.Config.Weight
+	}
+	if reg.Config.Zone != "" {
+		copied.Zone = reg.Config.Zone
+	}
+	if len(reg.Config.Metadata) > 0 {
+		copied.Metadata = make(map[string]string, len(info.Metadata)+len(reg.Config.Metadata))
+		for k, v := range info.Metadata {
+			copied.Metadata[k] = v
+		}
+		for k, v := range reg.Config.Metadata {
+			copied.Metadata[k] = v
+		}
+	}
+	return &copied
+}
+
 func (reg *Component) registerValue(info *server.ServiceInfo) string {
 	return eregistry.GetServiceValue(info)
 }
@@ -6,11 +6,14 @@ import (
 
 // Config Registry配置
 type Config struct {
-	Scheme       string        // 协议
-	Prefix       string        // 注册前缀
-	ReadTimeout  time.Duration // 读超时
-	ServiceTTL   time.Duration // 服务续期
-	OnFailHandle string        // 错误后处理手段，panic，error
+	Scheme       string            // 协议
+	Prefix       string            // 注册前缀
+	ReadTimeout  time.Duration     // 读超时
+	ServiceTTL   time.Duration     // 服务续期
+	OnFailHandle string            // 错误后处理手段，panic，error
+	Weight       float64           // 注册的权重，默认0使用服务自身的权重，配合ego_weighted、ego_zone_weighted负载均衡使用
+	Zone         string            // 注册的zone，默认使用服务自身的zone，即EGO_ZONE
+	Metadata     map[string]string // 附加到注册信息中的元数据
 }
 
 const (
@@ -13,6 +13,8 @@ type Container struct {
 	name   string
 	logger *elog.Component
 	client *eetcd.Component
+
+	leaseHandler func(event LeaseEvent)
 }
 
 func DefaultContainer() *Container {
@@ -39,6 +41,13 @@ func WithClientEtcd(etcdClient *eetcd.Component) Option {
 	}
 }
 
+// WithLeaseEventHandler 设置租约事件回调，租约丢失、重新注册成功或失败时调用
+func WithLeaseEventHandler(handler func(event LeaseEvent)) Option {
+	return func(c *Container) {
+		c.leaseHandler = handler
+	}
+}
+
 // Build ...
 func (c *Container) Build(options ...Option) *Component {
 	for _, option := range options {
@@ -51,5 +60,7 @@ func (c *Container) Build(options ...Option) *Component {
 			c.logger.Error("client etcd nil", elog.FieldKey("use WithClientEtcd method"))
 		}
 	}
-	return newComponent(c.name, c.config, c.logger, c.client)
+	reg := newComponent(c.name, c.config, c.logger, c.client)
+	reg.leaseHandler = c.leaseHandler
+	return reg
 }
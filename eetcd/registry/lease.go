@@ -0,0 +1,125 @@
+package registry
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+var (
+	// minReregisterBackoff 租约丢失后第一次重新注册失败的等待时间
+	minReregisterBackoff = time.Second
+	// maxReregisterBackoff 重新注册连续失败时的最大等待时间
+	maxReregisterBackoff = 30 * time.Second
+)
+
+// LeaseEventType 租约事件类型
+type LeaseEventType int
+
+const (
+	// LeaseLost keepalive停止或者租约被撤销，服务已经从注册中心消失
+	LeaseLost LeaseEventType = iota + 1
+	// LeaseRecovered 使用新的租约重新注册成功
+	LeaseRecovered
+	// LeaseRecoverFailed 重新注册失败，等待一段时间后继续重试
+	LeaseRecoverFailed
+)
+
+// String ...
+func (t LeaseEventType) String() string {
+	switch t {
+	case LeaseLost:
+		return "lost"
+	case LeaseRecovered:
+		return "recovered"
+	case LeaseRecoverFailed:
+		return "recoverFailed"
+	}
+	return "unknown"
+}
+
+// LeaseEvent 注册key的租约事件
+type LeaseEvent struct {
+	Type LeaseEventType
+	Key  string
+	Err  error // 重新注册失败的原因
+}
+
+// keepRegistered 监听session，keepalive停止或者租约被撤销时（网络分区、etcd重启等）使用新的租约重新注册，
+// 主动注销或者注册中心关闭时退出
+func (reg *Component) keepRegistered(key string, sess *concurrency.Session) {
+	select {
+	case <-sess.Done():
+	case <-reg.ctx.Done():
+		return
+	}
+	if !reg.dropSession(key, sess) {
+		// 已经主动注销
+		return
+	}
+	if _, ok := reg.kvs.Load(key); !ok {
+		return
+	}
+
+	reg.logger.Warn("lease lost, re-register", elog.FieldKey(key), elog.Int64("lease", int64(sess.Lease())))
+	reg.emitLeaseEvent(LeaseEvent{Type: LeaseLost, Key: key})
+
+	backoff := minReregisterBackoff
+	for reg.ctx.Err() == nil {
+		ctx, cancel := context.WithTimeout(reg.ctx, reg.Config.ReadTimeout)
+		registered, err := reg.reregister(ctx, key)
+		cancel()
+		if !registered {
+			// 重试期间已经主动注销
+			return
+		}
+		if err == nil {
+			reg.logger.Info("re-register service", elog.FieldKey(key))
+			reg.emitLeaseEvent(LeaseEvent{Type: LeaseRecovered, Key: key})
+			return
+		}
+		if reg.ctx.Err() != nil {
+			return
+		}
+		reg.logger.Error("re-register service", elog.FieldErrKind("register err"), elog.FieldErr(err), elog.FieldKey(key))
+		reg.emitLeaseEvent(LeaseEvent{Type: LeaseRecoverFailed, Key: key, Err: err})
+		select {
+		case <-reg.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxReregisterBackoff {
+			backoff = maxReregisterBackoff
+		}
+	}
+}
+
+// reregister 与注销互斥，key仍然处于注册状态时重新写入，已经注销时返回false
+func (reg *Component) reregister(ctx context.Context, key string) (bool, error) {
+	reg.umu.Lock()
+	defer reg.umu.Unlock()
+	val, ok := reg.kvs.Load(key)
+	if !ok {
+		return false, nil
+	}
+	return true, reg.put(ctx, key, val.(string))
+}
+
+// dropSession 删除已经失效的session，key对应的已经不是该session时返回false
+func (reg *Component) dropSession(key string, sess *concurrency.Session) bool {
+	reg.rmu.Lock()
+	defer reg.rmu.Unlock()
+	if cur, ok := reg.sessions[key]; !ok || cur != sess {
+		return false
+	}
+	delete(reg.sessions, key)
+	return true
+}
+
+func (reg *Component) emitLeaseEvent(event LeaseEvent) {
+	if reg.leaseHandler != nil {
+		reg.leaseHandler(event)
+	}
+}
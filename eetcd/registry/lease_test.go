@@ -0,0 +1,278 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/client/v3"
+
+	"github.com/gotomicro/ego-component/eetcd"
+)
+
+// fakeEtcd 内存中的KV和Lease，只实现注册用到的Put、Delete、Grant、KeepAlive和Revoke；
+// 写入的key绑定最近创建的租约，expire模拟租约过期，beforePut在每次写入前调用
+type fakeEtcd struct {
+	clientv3.KV
+	clientv3.Lease
+
+	mu        sync.Mutex
+	kvs       map[string]fakeKV
+	granted   clientv3.LeaseID
+	lost      map[clientv3.LeaseID]chan struct{}
+	beforePut func(key string) error
+}
+
+type fakeKV struct {
+	value string
+	lease clientv3.LeaseID
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{kvs: map[string]fakeKV{}, lost: map[clientv3.LeaseID]chan struct{}{}}
+}
+
+func (f *fakeEtcd) client() *clientv3.Client {
+	client := clientv3.NewCtxClient(context.Background())
+	client.KV = f
+	client.Lease = f
+	return client
+}
+
+func (f *fakeEtcd) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	f.mu.Lock()
+	beforePut := f.beforePut
+	f.mu.Unlock()
+	if beforePut != nil {
+		if err := beforePut(key); err != nil {
+			return nil, err
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.kvs[key] = fakeKV{value: val, lease: f.granted}
+	return &clientv3.PutResponse{Header: &pb.ResponseHeader{}}, nil
+}
+
+func (f *fakeEtcd) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.kvs, key)
+	return &clientv3.DeleteResponse{Header: &pb.ResponseHeader{}}, nil
+}
+
+func (f *fakeEtcd) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.granted++
+	f.lost[f.granted] = make(chan struct{})
+	return &clientv3.LeaseGrantResponse{ID: f.granted, TTL: ttl}, nil
+}
+
+// KeepAlive ctx结束或者租约过期时关闭channel
+func (f *fakeEtcd) KeepAlive(ctx context.Context, id clientv3.LeaseID) (<-chan *clientv3.LeaseKeepAliveResponse, error) {
+	f.mu.Lock()
+	lost := f.lost[id]
+	f.mu.Unlock()
+	ch := make(chan *clientv3.LeaseKeepAliveResponse)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-lost:
+		}
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (f *fakeEtcd) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.removeLease(id)
+	return &clientv3.LeaseRevokeResponse{}, nil
+}
+
+// expire 租约过期，删除绑定的key并停止keepalive
+func (f *fakeEtcd) expire(id clientv3.LeaseID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if lost, ok := f.lost[id]; ok {
+		close(lost)
+	}
+	f.removeLease(id)
+}
+
+func (f *fakeEtcd) removeLease(id clientv3.LeaseID) {
+	delete(f.lost, id)
+	for key, kv := range f.kvs {
+		if kv.lease == id {
+			delete(f.kvs, key)
+		}
+	}
+}
+
+func (f *fakeEtcd) get(key string) (fakeKV, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	kv, ok := f.kvs[key]
+	return kv, ok
+}
+
+func (f *fakeEtcd) setBeforePut(beforePut func(key string) error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.beforePut = beforePut
+}
+
+// newTestRegistry 使用fakeEtcd创建开启了ServiceTTL的注册中心，租约事件写入返回的channel
+func newTestRegistry(t *testing.T, etcd *fakeEtcd) (*Component, chan LeaseEvent) {
+	backoff := minReregisterBackoff
+	minReregisterBackoff = 10 * time.Millisecond
+	t.Cleanup(func() { minReregisterBackoff = backoff })
+
+	config := DefaultConfig()
+	config.ServiceTTL = 10 * time.Second
+	reg := newComponent("test", config, elog.DefaultLogger, &eetcd.Component{Client: etcd.client()})
+	events := make(chan LeaseEvent, 16)
+	reg.leaseHandler = func(event LeaseEvent) {
+		events <- event
+	}
+	t.Cleanup(func() { _ = reg.Close() })
+	return reg, events
+}
+
+func nextLeaseEvent(t *testing.T, events chan LeaseEvent) LeaseEvent {
+	select {
+	case event := <-events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no lease event")
+		return LeaseEvent{}
+	}
+}
+
+func TestKeepRegistered(t *testing.T) {
+	etcd := newFakeEtcd()
+	reg, events := newTestRegistry(t, etcd)
+	const key = "/ego/svc/providers/grpc://127.0.0.1:9001"
+	require.NoError(t, reg.put(context.Background(), key, "v1"))
+	kv, ok := etcd.get(key)
+	require.True(t, ok)
+	assert.Equal(t, fakeKV{value: "v1", lease: 1}, kv)
+
+	// 租约过期后使用新的租约重新注册
+	etcd.expire(1)
+	assert.Equal(t, LeaseEvent{Type: LeaseLost, Key: key}, nextLeaseEvent(t, events))
+	assert.Equal(t, LeaseEvent{Type: LeaseRecovered, Key: key}, nextLeaseEvent(t, events))
+	kv, ok = etcd.get(key)
+	require.True(t, ok)
+	assert.Equal(t, fakeKV{value: "v1", lease: 2}, kv)
+
+	// 新的租约继续被监听
+	etcd.expire(2)
+	assert.Equal(t, LeaseEvent{Type: LeaseLost, Key: key}, nextLeaseEvent(t, events))
+	assert.Equal(t, LeaseEvent{Type: LeaseRecovered, Key: key}, nextLeaseEvent(t, events))
+
+	// 主动注销时撤销租约，不再重新注册
+	require.NoError(t, reg.unregister(context.Background(), key))
+	_, ok = etcd.get(key)
+	assert.False(t, ok)
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected lease event %+v", event)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestKeepRegisteredRetry(t *testing.T) {
+	etcd := newFakeEtcd()
+	reg, events := newTestRegistry(t, etcd)
+	const key = "/ego/svc/providers/grpc://127.0.0.1:9002"
+	require.NoError(t, reg.put(context.Background(), key, "v1"))
+
+	// 前两次重新注册失败，等待后继续重试
+	errUnavailable := errors.New("etcd unavailable")
+	var failures int
+	etcd.setBeforePut(func(string) error {
+		if failures < 2 {
+			failures++
+			return errUnavailable
+		}
+		return nil
+	})
+	etcd.expire(1)
+	assert.Equal(t, LeaseEvent{Type: LeaseLost, Key: key}, nextLeaseEvent(t, events))
+	assert.Equal(t, LeaseEvent{Type: LeaseRecoverFailed, Key: key, Err: errUnavailable}, nextLeaseEvent(t, events))
+	assert.Equal(t, LeaseEvent{Type: LeaseRecoverFailed, Key: key, Err: errUnavailable}, nextLeaseEvent(t, events))
+	assert.Equal(t, LeaseEvent{Type: LeaseRecovered, Key: key}, nextLeaseEvent(t, events))
+	_, ok := etcd.get(key)
+	assert.True(t, ok)
+}
+
+func TestKeepRegisteredUnregister(t *testing.T) {
+	etcd := newFakeEtcd()
+	reg, events := newTestRegistry(t, etcd)
+	const key = "/ego/svc/providers/grpc://127.0.0.1:9003"
+	require.NoError(t, reg.put(context.Background(), key, "v1"))
+
+	// 重新注册的写入阻塞时注销服务，写入完成后服务不能再次出现在注册中心
+	putting := make(chan struct{})
+	release := make(chan struct{})
+	etcd.setBeforePut(func(string) error {
+		close(putting)
+		<-release
+		return nil
+	})
+	etcd.expire(1)
+	assert.Equal(t, LeaseEvent{Type: LeaseLost, Key: key}, nextLeaseEvent(t, events))
+	<-putting
+	etcd.setBeforePut(nil)
+	unregistered := make(chan error)
+	go func() {
+		unregistered <- reg.unregister(context.Background(), key)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	require.NoError(t, <-unregistered)
+	assert.Equal(t, LeaseEvent{Type: LeaseRecovered, Key: key}, nextLeaseEvent(t, events))
+
+	_, ok := etcd.get(key)
+	assert.False(t, ok)
+	_, ok = reg.kvs.Load(key)
+	assert.False(t, ok)
+	reg.rmu.RLock()
+	assert.Empty(t, reg.sessions)
+	reg.rmu.RUnlock()
+}
+
+func TestKeepRegisteredUnregisterDuringBackoff(t *testing.T) {
+	etcd := newFakeEtcd()
+	reg, events := newTestRegistry(t, etcd)
+	minReregisterBackoff = 100 * time.Millisecond
+	const key = "/ego/svc/providers/grpc://127.0.0.1:9004"
+	require.NoError(t, reg.put(context.Background(), key, "v1"))
+
+	// 重新注册失败后等待重试期间注销，不再重试
+	etcd.setBeforePut(func(string) error {
+		return errors.New("etcd unavailable")
+	})
+	etcd.expire(1)
+	assert.Equal(t, LeaseLost, nextLeaseEvent(t, events).Type)
+	assert.Equal(t, LeaseRecoverFailed, nextLeaseEvent(t, events).Type)
+	etcd.setBeforePut(nil)
+	require.NoError(t, reg.unregister(context.Background(), key))
+
+	select {
+	case event := <-events:
+		t.Fatalf("unexpected lease event %+v", event)
+	case <-time.After(200 * time.Millisecond):
+	}
+	_, ok := etcd.get(key)
+	assert.False(t, ok)
+}
@@ -0,0 +1,49 @@
+package eetcd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// STM 软件事务内存，fn中通过stm.Get、stm.Put读写多个key，提交时检查读过的key没有被修改，
+// 冲突时自动重新执行fn，最多重试STMMaxRetries次，超过后返回ErrSTMRetriesExceeded。
+// keys为需要预先读取的key，可以减少第一次执行时的请求次数。fn可能被执行多次，不要在fn中执行非幂等的操作
+func (c *Component) STM(ctx context.Context, fn func(stm concurrency.STM) error, keys ...string) (*clientv3.TxnResponse, error) {
+	attempts := 0
+	apply := func(stm concurrency.STM) error {
+		attempts++
+		if c.config.STMMaxRetries > 0 && attempts > c.config.STMMaxRetries+1 {
+			return ErrSTMRetriesExceeded
+		}
+		return fn(stm)
+	}
+
+	resp, err := concurrency.NewSTM(c.Client, apply,
+		concurrency.WithAbortContext(ctx),
+		concurrency.WithIsolation(c.stmIsolation),
+		concurrency.WithPrefetch(keys...),
+	)
+	if attempts > 1 {
+		c.logger.Warn("stm retry", elog.Int("attempts", attempts), elog.Any("keys", keys), elog.FieldErr(err))
+	}
+	return resp, err
+}
+
+// parseIsolation 解析STM的隔离级别
+func parseIsolation(isolation string) (concurrency.Isolation, error) {
+	switch isolation {
+	case "", "serializableSnapshot":
+		return concurrency.SerializableSnapshot, nil
+	case "serializable":
+		return concurrency.Serializable, nil
+	case "repeatableReads":
+		return concurrency.RepeatableReads, nil
+	case "readCommitted":
+		return concurrency.ReadCommitted, nil
+	}
+	return 0, fmt.Errorf("invalid stm isolation %q", isolation)
+}
@@ -0,0 +1,91 @@
+package eetcd
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+func newTestSTMComponent(etcd *fakeEtcd, maxRetries int) *Component {
+	return &Component{
+		Client:       etcd.client(),
+		config:       &config{STMMaxRetries: maxRetries},
+		logger:       elog.DefaultLogger,
+		stmIsolation: concurrency.SerializableSnapshot,
+	}
+}
+
+func TestSTM(t *testing.T) {
+	ctx := context.Background()
+	etcd := newFakeEtcd()
+	etcd.put("/stm/a", "1")
+	c := newTestSTMComponent(etcd, 3)
+
+	// 第一次执行时读过的key被其他进程修改，提交冲突后重新执行
+	calls := 0
+	_, err := c.STM(ctx, func(stm concurrency.STM) error {
+		calls++
+		stm.Put("/stm/b", stm.Get("/stm/a"))
+		if calls == 1 {
+			etcd.put("/stm/a", "2")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	resp, err := etcd.Get(ctx, "/stm/b")
+	require.NoError(t, err)
+	require.Len(t, resp.Kvs, 1)
+	assert.Equal(t, "2", string(resp.Kvs[0].Value))
+}
+
+func TestSTMRetriesExceeded(t *testing.T) {
+	ctx := context.Background()
+	etcd := newFakeEtcd()
+	etcd.put("/stm/a", "1")
+	c := newTestSTMComponent(etcd, 3)
+
+	// 每次执行时读过的key都被其他进程修改，重试STMMaxRetries次后放弃
+	calls := 0
+	_, err := c.STM(ctx, func(stm concurrency.STM) error {
+		calls++
+		stm.Put("/stm/b", stm.Get("/stm/a"))
+		etcd.put("/stm/a", strconv.Itoa(calls+1))
+		return nil
+	})
+	assert.Equal(t, ErrSTMRetriesExceeded, err)
+	assert.Equal(t, 1+3, calls)
+	resp, err := etcd.Get(ctx, "/stm/b")
+	require.NoError(t, err)
+	assert.Empty(t, resp.Kvs)
+}
+
+func TestParseIsolation(t *testing.T) {
+	tests := []struct {
+		isolation string
+		want      concurrency.Isolation
+		wantErr   bool
+	}{
+		{"", concurrency.SerializableSnapshot, false},
+		{"serializableSnapshot", concurrency.SerializableSnapshot, false},
+		{"serializable", concurrency.Serializable, false},
+		{"repeatableReads", concurrency.RepeatableReads, false},
+		{"readCommitted", concurrency.ReadCommitted, false},
+		{"readUncommitted", 0, true},
+		{"Serializable", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseIsolation(tt.isolation)
+		if tt.wantErr {
+			assert.Error(t, err, tt.isolation)
+			continue
+		}
+		require.NoError(t, err, tt.isolation)
+		assert.Equal(t, tt.want, got, tt.isolation)
+	}
+}
@@ -0,0 +1,471 @@
+package eetcd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"go.etcd.io/etcd/client/v3"
+)
+
+// WatchEventType 事件类型
+type WatchEventType int
+
+const (
+	// WatchEventAdd 新增key
+	WatchEventAdd WatchEventType = iota + 1
+	// WatchEventUpdate 修改key
+	WatchEventUpdate
+	// WatchEventDelete 删除key
+	WatchEventDelete
+)
+
+// String ...
+func (t WatchEventType) String() string {
+	switch t {
+	case WatchEventAdd:
+		return "add"
+	case WatchEventUpdate:
+		return "update"
+	case WatchEventDelete:
+		return "delete"
+	}
+	return "unknown"
+}
+
+// WatchEvent Watcher投递的事件
+type WatchEvent struct {
+	Type      WatchEventType
+	Key       string
+	Value     []byte // 删除事件为空
+	PrevValue []byte // 新增事件为空
+	Revision  int64  // 事件发生时的revision，压缩后重新全量对比得到的事件为对比时的revision
+}
+
+// WatchHandler 处理事件，返回错误时不保存revision，等待一段时间后从上一次保存的revision重新投递
+type WatchHandler func(ctx context.Context, event WatchEvent) error
+
+// RevisionStore 保存Watcher处理到的revision，重启后从该revision继续
+type RevisionStore interface {
+	LoadRevision(ctx context.Context, name string) (int64, error)
+	SaveRevision(ctx context.Context, name string, revision int64) error
+}
+
+// KeysStore 可选接口，RevisionStore同时实现该接口时，Watcher在key集合变化后保存前缀下的全部key，
+// 重启时保存的revision已经被压缩，用保存的key与当前的key对比得到期间的删除事件
+type KeysStore interface {
+	LoadKeys(ctx context.Context, name string) ([]string, error)
+	SaveKeys(ctx context.Context, name string, keys []string) error
+}
+
+// memoryRevisionStore 保存在内存中的revision，进程重启后重新全量投递
+type memoryRevisionStore struct {
+	revisions sync.Map
+	keys      sync.Map
+}
+
+// NewMemoryRevisionStore 创建内存revision存储，用于测试或者不需要跨进程恢复的场景
+func NewMemoryRevisionStore() RevisionStore {
+	return &memoryRevisionStore{}
+}
+
+func (s *memoryRevisionStore) LoadRevision(ctx context.Context, name string) (int64, error) {
+	if revision, ok := s.revisions.Load(name); ok {
+		return revision.(int64), nil
+	}
+	return 0, nil
+}
+
+func (s *memoryRevisionStore) SaveRevision(ctx context.Context, name string, revision int64) error {
+	s.revisions.Store(name, revision)
+	return nil
+}
+
+func (s *memoryRevisionStore) LoadKeys(ctx context.Context, name string) ([]string, error) {
+	if keys, ok := s.keys.Load(name); ok {
+		return keys.([]string), nil
+	}
+	return nil, nil
+}
+
+func (s *memoryRevisionStore) SaveKeys(ctx context.Context, name string, keys []string) error {
+	s.keys.Store(name, keys)
+	return nil
+}
+
+// etcdRevisionStore 保存在etcd中的revision
+type etcdRevisionStore struct {
+	client    *Component
+	keyPrefix string
+}
+
+// NewEtcdRevisionStore 创建保存在etcd中的revision存储，key为keyPrefix加上Watcher的名称，
+// 前缀下的key集合以JSON数组保存在该key加上"/keys"中，
+// keyPrefix不能在Watcher监听的前缀下，否则保存revision会产生新的事件
+func NewEtcdRevisionStore(client *Component, keyPrefix string) RevisionStore {
+	return &etcdRevisionStore{client: client, keyPrefix: keyPrefix}
+}
+
+func (s *etcdRevisionStore) LoadRevision(ctx context.Context, name string) (int64, error) {
+	resp, err := s.client.Get(ctx, s.keyPrefix+name)
+	if err != nil {
+		return 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
+}
+
+func (s *etcdRevisionStore) SaveRevision(ctx context.Context, name string, revision int64) error {
+	_, err := s.client.Put(ctx, s.keyPrefix+name, strconv.FormatInt(revision, 10))
+	return err
+}
+
+func (s *etcdRevisionStore) LoadKeys(ctx context.Context, name string) ([]string, error) {
+	resp, err := s.client.Get(ctx, s.keyPrefix+name+"/keys")
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, nil
+	}
+	var keys []string
+	if err := json.Unmarshal(resp.Kvs[0].Value, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (s *etcdRevisionStore) SaveKeys(ctx context.Context, name string, keys []string) error {
+	value, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	_, err = s.client.Put(ctx, s.keyPrefix+name+"/keys", string(value))
+	return err
+}
+
+// WatcherOption Watcher的选项
+type WatcherOption func(w *Watcher)
+
+// WithRevisionStore 设置revision的存储，默认保存在内存中
+func WithRevisionStore(store RevisionStore) WatcherOption {
+	return func(w *Watcher) {
+		w.store = store
+	}
+}
+
+// WithWatcherRetryInterval 设置出错后重新watch的间隔，默认1s
+func WithWatcherRetryInterval(interval time.Duration) WatcherOption {
+	return func(w *Watcher) {
+		w.retryInterval = interval
+	}
+}
+
+// kvState 前缀下key的最新状态，用于压缩后全量对比
+type kvState struct {
+	value       []byte
+	modRevision int64
+}
+
+// Watcher 可恢复的前缀监听，处理完事件后保存revision，重启后从保存的revision继续；
+// 需要的revision已经被压缩时，重新读取前缀下的全部key，与内存中的状态对比后投递新增、修改、删除事件
+type Watcher struct {
+	name          string
+	prefix        string
+	handler       WatchHandler
+	store         RevisionStore
+	retryInterval time.Duration
+	client        *Component
+	logger        *elog.Component
+
+	snapshot  map[string]kvState
+	revision  int64
+	keysDirty bool // key集合发生了变化，下次保存revision时同时保存key
+}
+
+// NewWatcher 创建前缀监听，name用于保存revision，不同的Watcher需要使用不同的name
+func (c *Component) NewWatcher(name string, prefix string, handler WatchHandler, opts ...WatcherOption) *Watcher {
+	w := &Watcher{
+		name:          name,
+		prefix:        prefix,
+		handler:       handler,
+		store:         NewMemoryRevisionStore(),
+		retryInterval: time.Second,
+		client:        c,
+		logger:        c.logger.With(elog.FieldName(name), elog.FieldKey(prefix)),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Watch 阻塞监听前缀下的变化，直到ctx结束，出错时等待retryInterval后重新监听
+func (w *Watcher) Watch(ctx context.Context) error {
+	for {
+		err := w.run(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			w.logger.Error("watch error", elog.FieldErr(err))
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(w.retryInterval):
+		}
+	}
+}
+
+// run 初始化状态后监听，返回时需要重新监听
+func (w *Watcher) run(ctx context.Context) error {
+	if w.snapshot == nil {
+		if err := w.restore(ctx); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rch := w.client.Watch(clientv3.WithRequireLeader(ctx), w.prefix, clientv3.WithPrefix(), clientv3.WithPrevKV(), clientv3.WithRev(w.revision+1))
+	for resp := range rch {
+		if resp.CompactRevision != 0 {
+			w.logger.Warn("watch compacted, relist", elog.Int64("revision", w.revision), elog.Int64("compactRevision", resp.CompactRevision))
+			return w.relist(ctx)
+		}
+		if err := resp.Err(); err != nil {
+			return err
+		}
+		for _, ev := range resp.Events {
+			event := w.toEvent(ev)
+			if err := w.handle(ctx, event); err != nil {
+				return err
+			}
+		}
+		if len(resp.Events) > 0 {
+			if err := w.checkpoint(ctx, resp.Header.GetRevision()); err != nil {
+				return err
+			}
+		}
+	}
+	return ctx.Err()
+}
+
+// restore 从保存的revision恢复状态，没有保存时全量投递新增事件
+func (w *Watcher) restore(ctx context.Context) error {
+	revision, err := w.store.LoadRevision(ctx, w.name)
+	if err != nil {
+		return fmt.Errorf("load revision fail, %w", err)
+	}
+	if revision == 0 {
+		return w.relist(ctx)
+	}
+
+	snapshot, _, err := w.list(ctx, revision)
+	if errors.Is(err, rpctypes.ErrCompacted) {
+		// 保存的revision已经被压缩，无法得到当时的状态，使用保存的key集合得到期间的删除
+		current, header, err := w.list(ctx, 0)
+		if err != nil {
+			return err
+		}
+		var events []WatchEvent
+		if keysStore, ok := w.store.(KeysStore); ok {
+			keys, err := keysStore.LoadKeys(ctx, w.name)
+			if err != nil {
+				return fmt.Errorf("load keys fail, %w", err)
+			}
+			events = restoreEvents(keys, current, revision, header)
+		} else {
+			w.logger.Warn("revision compacted and store does not save keys, deletes since revision are missed", elog.Int64("revision", revision))
+			events = sinceRevision(current, revision, header)
+		}
+		for _, event := range events {
+			if err := w.handle(ctx, event); err != nil {
+				return err
+			}
+		}
+		w.snapshot = current
+		w.keysDirty = true
+		return w.checkpoint(ctx, header)
+	}
+	if err != nil {
+		return err
+	}
+	w.snapshot = snapshot
+	w.revision = revision
+	return nil
+}
+
+// relist 重新读取前缀下的全部key，与内存中的状态对比后投递事件
+func (w *Watcher) relist(ctx context.Context) error {
+	current, header, err := w.list(ctx, 0)
+	if err != nil {
+		return err
+	}
+	for _, event := range diffSnapshot(w.snapshot, current, header) {
+		if err := w.handle(ctx, event); err != nil {
+			return err
+		}
+	}
+	w.snapshot = current
+	w.keysDirty = true
+	return w.checkpoint(ctx, header)
+}
+
+// list 读取前缀下的全部key，revision为0时读取最新的数据
+func (w *Watcher) list(ctx context.Context, revision int64) (map[string]kvState, int64, error) {
+	opts := []clientv3.OpOption{clientv3.WithPrefix()}
+	if revision > 0 {
+		opts = append(opts, clientv3.WithRev(revision))
+	}
+	resp, err := w.client.Get(ctx, w.prefix, opts...)
+	if err != nil {
+		return nil, 0, err
+	}
+	snapshot := make(map[string]kvState, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		snapshot[string(kv.Key)] = kvState{value: kv.Value, modRevision: kv.ModRevision}
+	}
+	if revision > 0 {
+		return snapshot, revision, nil
+	}
+	return snapshot, resp.Header.GetRevision(), nil
+}
+
+// handle 投递事件并更新内存中的状态，失败时丢弃内存中的状态，下次从保存的revision重新开始
+func (w *Watcher) handle(ctx context.Context, event WatchEvent) error {
+	if err := w.handler(ctx, event); err != nil {
+		w.snapshot = nil
+		return fmt.Errorf("handle %s event of %s fail, %w", event.Type, event.Key, err)
+	}
+	if w.snapshot == nil {
+		return nil
+	}
+	if event.Type == WatchEventDelete {
+		delete(w.snapshot, event.Key)
+		w.keysDirty = true
+		return nil
+	}
+	if event.Type == WatchEventAdd {
+		w.keysDirty = true
+	}
+	w.snapshot[event.Key] = kvState{value: event.Value, modRevision: event.Revision}
+	return nil
+}
+
+// checkpoint 保存处理到的revision，key集合变化时先保存key
+func (w *Watcher) checkpoint(ctx context.Context, revision int64) error {
+	w.revision = revision
+	if keysStore, ok := w.store.(KeysStore); ok && w.keysDirty && w.snapshot != nil {
+		keys := make([]string, 0, len(w.snapshot))
+		for key := range w.snapshot {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		if err := keysStore.SaveKeys(ctx, w.name, keys); err != nil {
+			return fmt.Errorf("save keys fail, %w", err)
+		}
+		w.keysDirty = false
+	}
+	if err := w.store.SaveRevision(ctx, w.name, revision); err != nil {
+		return fmt.Errorf("save revision fail, %w", err)
+	}
+	return nil
+}
+
+// toEvent 将etcd的事件转换为WatchEvent，没有PrevKv时使用内存中的状态
+func (w *Watcher) toEvent(ev *clientv3.Event) WatchEvent {
+	key := string(ev.Kv.Key)
+	event := WatchEvent{Key: key, Revision: ev.Kv.ModRevision}
+	if ev.PrevKv != nil {
+		event.PrevValue = ev.PrevKv.Value
+	} else if prev, ok := w.snapshot[key]; ok {
+		event.PrevValue = prev.value
+	}
+	switch {
+	case ev.Type == mvccpb.DELETE:
+		event.Type = WatchEventDelete
+	case ev.IsCreate():
+		event.Type = WatchEventAdd
+		event.PrevValue = nil
+		event.Value = ev.Kv.Value
+	default:
+		event.Type = WatchEventUpdate
+		event.Value = ev.Kv.Value
+	}
+	return event
+}
+
+// diffSnapshot 对比两次全量读取的状态，按key排序返回新增、修改、删除事件
+func diffSnapshot(prev map[string]kvState, current map[string]kvState, revision int64) []WatchEvent {
+	events := make([]WatchEvent, 0)
+	for key, cur := range current {
+		old, ok := prev[key]
+		switch {
+		case !ok:
+			events = append(events, WatchEvent{Type: WatchEventAdd, Key: key, Value: cur.value, Revision: revision})
+		case old.modRevision != cur.modRevision:
+			events = append(events, WatchEvent{Type: WatchEventUpdate, Key: key, Value: cur.value, PrevValue: old.value, Revision: revision})
+		}
+	}
+	for key, old := range prev {
+		if _, ok := current[key]; !ok {
+			events = append(events, WatchEvent{Type: WatchEventDelete, Key: key, PrevValue: old.value, Revision: revision})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key < events[j].Key
+	})
+	return events
+}
+
+// sinceRevision 没有之前的状态时，将revision之后修改过的key作为修改事件投递
+func sinceRevision(current map[string]kvState, since int64, revision int64) []WatchEvent {
+	events := make([]WatchEvent, 0)
+	for key, cur := range current {
+		if cur.modRevision > since {
+			events = append(events, WatchEvent{Type: WatchEventUpdate, Key: key, Value: cur.value, Revision: revision})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key < events[j].Key
+	})
+	return events
+}
+
+// restoreEvents 保存的revision已经被压缩时，用保存的key集合与当前状态对比，
+// 保存的key中不存在的为新增事件，revision之后修改过的为修改事件，当前不存在的为删除事件（没有PrevValue）
+func restoreEvents(keys []string, current map[string]kvState, since int64, revision int64) []WatchEvent {
+	known := make(map[string]struct{}, len(keys))
+	for _, key := range keys {
+		known[key] = struct{}{}
+	}
+	events := make([]WatchEvent, 0)
+	for key, cur := range current {
+		if _, ok := known[key]; !ok {
+			events = append(events, WatchEvent{Type: WatchEventAdd, Key: key, Value: cur.value, Revision: revision})
+		} else if cur.modRevision > since {
+			events = append(events, WatchEvent{Type: WatchEventUpdate, Key: key, Value: cur.value, Revision: revision})
+		}
+	}
+	for key := range known {
+		if _, ok := current[key]; !ok {
+			events = append(events, WatchEvent{Type: WatchEventDelete, Key: key, Revision: revision})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Key < events[j].Key
+	})
+	return events
+}
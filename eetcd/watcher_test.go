@@ -0,0 +1,161 @@
+package eetcd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffSnapshot(t *testing.T) {
+	prev := map[string]kvState{
+		"/a": {value: []byte("1"), modRevision: 2},
+		"/b": {value: []byte("2"), modRevision: 3},
+		"/c": {value: []byte("3"), modRevision: 4},
+	}
+	current := map[string]kvState{
+		"/a": {value: []byte("1"), modRevision: 2},
+		"/b": {value: []byte("22"), modRevision: 8},
+		"/d": {value: []byte("4"), modRevision: 9},
+	}
+	assert.Equal(t, []WatchEvent{
+		{Type: WatchEventUpdate, Key: "/b", Value: []byte("22"), PrevValue: []byte("2"), Revision: 10},
+		{Type: WatchEventDelete, Key: "/c", PrevValue: []byte("3"), Revision: 10},
+		{Type: WatchEventAdd, Key: "/d", Value: []byte("4"), Revision: 10},
+	}, diffSnapshot(prev, current, 10))
+
+	// 没有之前的状态时全部为新增
+	assert.Equal(t, []WatchEvent{
+		{Type: WatchEventAdd, Key: "/a", Value: []byte("1"), Revision: 10},
+	}, diffSnapshot(nil, map[string]kvState{"/a": {value: []byte("1"), modRevision: 2}}, 10))
+	assert.Empty(t, diffSnapshot(prev, prev, 10))
+}
+
+func TestSinceRevision(t *testing.T) {
+	current := map[string]kvState{
+		"/a": {value: []byte("1"), modRevision: 5},
+		"/b": {value: []byte("2"), modRevision: 6},
+		"/c": {value: []byte("3"), modRevision: 7},
+	}
+	assert.Equal(t, []WatchEvent{
+		{Type: WatchEventUpdate, Key: "/b", Value: []byte("2"), Revision: 10},
+		{Type: WatchEventUpdate, Key: "/c", Value: []byte("3"), Revision: 10},
+	}, sinceRevision(current, 5, 10))
+	assert.Empty(t, sinceRevision(current, 7, 10))
+}
+
+func TestRestoreEvents(t *testing.T) {
+	current := map[string]kvState{
+		"/a": {value: []byte("1"), modRevision: 3},
+		"/b": {value: []byte("2"), modRevision: 6},
+		"/d": {value: []byte("4"), modRevision: 7},
+	}
+	assert.Equal(t, []WatchEvent{
+		{Type: WatchEventUpdate, Key: "/b", Value: []byte("2"), Revision: 10},
+		{Type: WatchEventDelete, Key: "/c", Revision: 10},
+		{Type: WatchEventAdd, Key: "/d", Value: []byte("4"), Revision: 10},
+	}, restoreEvents([]string{"/a", "/b", "/c"}, current, 5, 10))
+}
+
+func newTestWatcher(etcd *fakeEtcd, store RevisionStore, events *[]WatchEvent) *Watcher {
+	c := &Component{Client: etcd.client(), logger: elog.DefaultLogger}
+	return c.NewWatcher("test", "/w/", func(ctx context.Context, event WatchEvent) error {
+		*events = append(*events, event)
+		return nil
+	}, WithRevisionStore(store))
+}
+
+func TestWatcherRestoreCompacted(t *testing.T) {
+	ctx := context.Background()
+	etcd := newFakeEtcd()
+	etcd.put("/w/a", "1")
+	etcd.put("/w/b", "2")
+	store := NewMemoryRevisionStore()
+
+	// 第一次启动全量投递新增事件，保存revision和key集合
+	var events []WatchEvent
+	w := newTestWatcher(etcd, store, &events)
+	require.NoError(t, w.restore(ctx))
+	assert.Len(t, events, 2)
+	revision, err := store.LoadRevision(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, etcd.rev, revision)
+	keys, err := store.(KeysStore).LoadKeys(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/w/a", "/w/b"}, keys)
+
+	// 停止期间删除、修改、新增key，并且保存的revision被压缩
+	etcd.mu.Lock()
+	delete(etcd.kvs, "/w/a")
+	etcd.mu.Unlock()
+	etcd.put("/w/b", "22")
+	etcd.put("/w/c", "3")
+	etcd.compacted = etcd.rev
+
+	events = nil
+	w = newTestWatcher(etcd, store, &events)
+	require.NoError(t, w.restore(ctx))
+	assert.Equal(t, []WatchEvent{
+		{Type: WatchEventDelete, Key: "/w/a", Revision: etcd.rev},
+		{Type: WatchEventUpdate, Key: "/w/b", Value: []byte("22"), Revision: etcd.rev},
+		{Type: WatchEventAdd, Key: "/w/c", Value: []byte("3"), Revision: etcd.rev},
+	}, events)
+	keys, err = store.(KeysStore).LoadKeys(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/w/b", "/w/c"}, keys)
+}
+
+// revisionOnlyStore 只保存revision，不保存key集合
+type revisionOnlyStore struct {
+	revision int64
+}
+
+func (s *revisionOnlyStore) LoadRevision(ctx context.Context, name string) (int64, error) {
+	return s.revision, nil
+}
+
+func (s *revisionOnlyStore) SaveRevision(ctx context.Context, name string, revision int64) error {
+	s.revision = revision
+	return nil
+}
+
+func TestWatcherRestoreCompactedWithoutKeys(t *testing.T) {
+	ctx := context.Background()
+	etcd := newFakeEtcd()
+	etcd.put("/w/a", "1")
+	store := &revisionOnlyStore{revision: etcd.rev}
+	etcd.put("/w/b", "2")
+	etcd.compacted = etcd.rev
+
+	// 无法得到删除事件，只投递之后修改过的key
+	var events []WatchEvent
+	w := newTestWatcher(etcd, store, &events)
+	require.NoError(t, w.restore(ctx))
+	assert.Equal(t, []WatchEvent{
+		{Type: WatchEventUpdate, Key: "/w/b", Value: []byte("2"), Revision: etcd.rev},
+	}, events)
+	assert.Equal(t, etcd.rev, store.revision)
+}
+
+func TestWatcherHandleKeysDirty(t *testing.T) {
+	ctx := context.Background()
+	var events []WatchEvent
+	w := newTestWatcher(newFakeEtcd(), NewMemoryRevisionStore(), &events)
+	w.snapshot = map[string]kvState{"/w/a": {value: []byte("1"), modRevision: 1}}
+
+	// 修改不改变key集合
+	require.NoError(t, w.handle(ctx, WatchEvent{Type: WatchEventUpdate, Key: "/w/a", Value: []byte("2"), Revision: 2}))
+	assert.False(t, w.keysDirty)
+	require.NoError(t, w.handle(ctx, WatchEvent{Type: WatchEventAdd, Key: "/w/b", Value: []byte("1"), Revision: 3}))
+	assert.True(t, w.keysDirty)
+	require.NoError(t, w.checkpoint(ctx, 3))
+	assert.False(t, w.keysDirty)
+	require.NoError(t, w.handle(ctx, WatchEvent{Type: WatchEventDelete, Key: "/w/a", Revision: 4}))
+	assert.True(t, w.keysDirty)
+	require.NoError(t, w.checkpoint(ctx, 4))
+	keys, err := w.store.(KeysStore).LoadKeys(ctx, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/w/b"}, keys)
+}
@@ -0,0 +1,118 @@
+package egorm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// archiveTableSuffix 归档表后缀
+	archiveTableSuffix = "_archive"
+	// archiveDeletedAt 归档表中的删除时间字段
+	archiveDeletedAt = "deleted_at"
+	// archiveDeletedBy 归档表中的删除人字段
+	archiveDeletedBy = "deleted_by"
+)
+
+type operatorKey struct{}
+
+// WithOperator 返回带有操作人的context，归档时写入归档表的deleted_by字段
+func WithOperator(ctx context.Context, operator string) context.Context {
+	return context.WithValue(ctx, operatorKey{}, operator)
+}
+
+func operatorFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	operator, _ := ctx.Value(operatorKey{}).(string)
+	return operator
+}
+
+// archive 删除前将要删除的记录写入 表名_archive，归档表的字段为原表字段加上deleted_at、deleted_by
+type archive struct {
+	tables map[string]struct{}
+}
+
+func newArchive(tables []string) *archive {
+	a := &archive{tables: make(map[string]struct{}, len(tables))}
+	for _, table := range tables {
+		a.tables[table] = struct{}{}
+	}
+	return a
+}
+
+// Name 插件名称
+func (a *archive) Name() string {
+	return "egorm:archive"
+}
+
+// Initialize 在删除前归档，归档和删除在gorm默认开启的同一个事务中执行
+func (a *archive) Initialize(db *gorm.DB) error {
+	return db.Callback().Delete().Before("gorm:delete").Register("egorm:archive", a.archive)
+}
+
+func (a *archive) archive(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return
+	}
+	if _, ok := a.tables[stmt.Table]; !ok {
+		return
+	}
+	// 软删除只更新deleted_at，不需要归档
+	if !stmt.Unscoped && len(stmt.Schema.DeleteClauses) > 0 {
+		return
+	}
+	exprs := deleteConditions(stmt)
+	if len(exprs) == 0 {
+		// 没有条件时gorm会返回ErrMissingWhereClause，不归档
+		return
+	}
+
+	columns := make([]string, 0, len(stmt.Schema.DBNames)+2)
+	for _, name := range stmt.Schema.DBNames {
+		if name != archiveDeletedAt && name != archiveDeletedBy {
+			columns = append(columns, stmt.Quote(name))
+		}
+	}
+	selects := strings.Join(columns, ",")
+	columns = append(columns, stmt.Quote(archiveDeletedAt), stmt.Quote(archiveDeletedBy))
+
+	// 删除语句的条件中已经带有租户条件，归档的原生SQL跳过租户隔离
+	tx := db.Session(&gorm.Session{NewDB: true, Context: SkipTenant(stmt.Context)})
+	rows := tx.Table(stmt.Table).Select(selects+",?,?", time.Now(), operatorFromContext(stmt.Context)).Clauses(clause.Where{Exprs: exprs})
+	sql := fmt.Sprintf("INSERT INTO %s (%s) ?", stmt.Quote(stmt.Table+archiveTableSuffix), strings.Join(columns, ","))
+	if err := tx.Exec(sql, rows).Error; err != nil {
+		_ = db.AddError(fmt.Errorf("egorm: archive %s: %w", stmt.Table, err))
+	}
+}
+
+// deleteConditions 返回删除语句的条件，与gorm:delete相同，包括where条件和模型中的主键
+func deleteConditions(stmt *gorm.Statement) []clause.Expression {
+	var exprs []clause.Expression
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			exprs = append(exprs, where.Exprs...)
+		}
+	}
+	primaryKeys := func(value reflect.Value) {
+		_, queryValues := schema.GetIdentityFieldValuesMap(value, stmt.Schema.PrimaryFields)
+		column, values := schema.ToQueryValues(stmt.Table, stmt.Schema.PrimaryFieldDBNames, queryValues)
+		if len(values) > 0 {
+			exprs = append(exprs, clause.IN{Column: column, Values: values})
+		}
+	}
+	primaryKeys(stmt.ReflectValue)
+	if stmt.ReflectValue.CanAddr() && stmt.Dest != stmt.Model && stmt.Model != nil {
+		primaryKeys(reflect.ValueOf(stmt.Model))
+	}
+	return exprs
+}
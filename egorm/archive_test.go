@@ -0,0 +1,31 @@
+package egorm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestArchive(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(newArchive([]string{"projects"})))
+	var sqls []string
+	require.NoError(t, db.Callback().Raw().After("gorm:raw").Register("test:sql", func(db *gorm.DB) {
+		sqls = append(sqls, db.Statement.SQL.String())
+	}))
+
+	ctx := WithOperator(context.Background(), "admin")
+	stmt := db.WithContext(ctx).Where("tenant_id = ?", 1).Delete(&project{ID: 3}).Statement
+	require.NoError(t, stmt.Error)
+	require.Len(t, sqls, 1)
+	assert.Equal(t, "INSERT INTO `projects_archive` (`id`,`tenant_id`,`name`,`deleted_at`,`deleted_by`) SELECT `id`,`tenant_id`,`name`,?,? FROM `projects` WHERE tenant_id = ? AND `projects`.`id` = ?", sqls[0])
+
+	// 没有条件时不归档
+	db.Delete(&project{})
+	assert.Len(t, sqls, 1)
+}
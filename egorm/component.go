@@ -2,6 +2,7 @@ package egorm
 
 import (
 	"context"
+	"sync"
 
 	"github.com/gotomicro/ego-component/egorm/manager"
 	"github.com/gotomicro/ego/core/elog"
@@ -46,12 +47,77 @@ func WithContext(ctx context.Context, db *Component) *Component {
 	return db
 }
 
+// closer 保存组件的后台任务的停止信号，通过gorm的插件在Session之间共享
+type closer struct {
+	once sync.Once
+	done chan struct{}
+}
+
+func newCloser() *closer {
+	return &closer{done: make(chan struct{})}
+}
+
+// Name 插件名称
+func (c *closer) Name() string {
+	return "egorm:closer"
+}
+
+// Initialize 不需要注册回调
+func (c *closer) Initialize(db *gorm.DB) error {
+	return nil
+}
+
+func (c *closer) close() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// isClosed 组件是否已经Close
+func isClosed(db *Component) bool {
+	c, ok := db.Config.Plugins["egorm:closer"].(*closer)
+	if !ok {
+		return false
+	}
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close 停止组件的后台任务（如凭证轮换、复制延迟检测），从egorm.Get中删除组件并注销连接池指标，然后关闭连接池
+func Close(db *Component) error {
+	if c, ok := db.Config.Plugins["egorm:closer"].(*closer); ok {
+		c.close()
+	}
+	deregister(db)
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
 // newComponent ...
 func newComponent(compName string, dsnParser manager.DSNParser, config *config, elogger *elog.Component) (*Component, error) {
-	db, err := gorm.Open(dsnParser.GetDialector(config.DSN), &gorm.Config{})
+	db, err := gorm.Open(config.dialector(dsnParser, config.DSN), &gorm.Config{})
 	if err != nil {
 		return nil, err
 	}
+	closer := newCloser()
+	if err := db.Use(closer); err != nil {
+		return nil, err
+	}
+
+	if config.PrepareStmt {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		pool := newStmtCachePool(compName, sqlDB, config.PrepareStmtCacheSize)
+		db.ConnPool = pool
+		db.Statement.ConnPool = pool
+	}
 
 	if config.RawDebug {
 		db = db.Debug()
@@ -70,6 +136,10 @@ func newComponent(compName string, dsnParser manager.DSNParser, config *config,
 		gormDB.SetConnMaxLifetime(config.ConnMaxLifetime)
 	}
 
+	if config.credentials != nil && config.Credential.RefreshInterval > 0 {
+		go config.credentials.run(closer.done, config, elogger)
+	}
+
 	replace := func(processor Processor, callbackName string, interceptors ...Interceptor) {
 		handler := processor.Get(callbackName)
 		for _, interceptor := range config.interceptors {
@@ -85,5 +155,59 @@ func newComponent(compName string, dsnParser manager.DSNParser, config *config,
 	replace(db.Callback().Query(), "gorm:query", config.interceptors...)
 	// replace(db.Callback().Row(), "gorm:row", config.interceptors...)
 	replace(db.Callback().Raw(), "gorm:raw", config.interceptors...)
+
+	if config.EnableTraceInterceptor {
+		if err := db.Use(newTracePlugin(config.dsnCfg)); err != nil {
+			return nil, err
+		}
+	}
+
+	readOnly, err := newReadOnlyTx(config.ReadOnlyTxIsolation)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Use(readOnly); err != nil {
+		return nil, err
+	}
+
+	if config.EnableOptimisticLock {
+		if err := db.Use(optimisticLock{}); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.TenantColumn != "" {
+		if err := db.Use(&tenant{column: config.TenantColumn}); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(config.ArchiveTables) > 0 {
+		if err := db.Use(newArchive(config.ArchiveTables)); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.queryCacheStore != nil {
+		if err := db.Use(&queryCache{store: config.queryCacheStore, ttl: config.queryCacheTTL, logger: elogger}); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(config.Shardings) > 0 {
+		plugin, err := newSharding(config.Shardings)
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Use(plugin); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(config.Resolvers) > 0 {
+		if err := registerResolver(db, compName, dsnParser, config, elogger, closer.done); err != nil {
+			return nil, err
+		}
+	}
 	return db, nil
 }
@@ -1,6 +1,7 @@
 package egorm
 
 import (
+	"context"
 	"fmt"
 
 	_ "github.com/gotomicro/ego-component/egorm/internal/dsn"
@@ -54,10 +55,6 @@ func (c *Container) Build(options ...Option) *Component {
 		options = append(options, WithInterceptor(debugInterceptor))
 	}
 
-	if c.config.EnableTraceInterceptor {
-		options = append(options, WithInterceptor(traceInterceptor))
-	}
-
 	if c.config.EnableMetricInterceptor {
 		options = append(options, WithInterceptor(metricInterceptor))
 	}
@@ -71,6 +68,20 @@ func (c *Container) Build(options ...Option) *Component {
 	// timeout 1s
 	// readTimeout 5s
 	// writeTimeout 5s
+	if c.config.credentialProvider == nil && c.config.Credential.Provider != "" {
+		c.config.credentialProvider, err = newCredentialProvider(c.config.Credential)
+		if err != nil {
+			c.logger.Panic("credential provider", elog.FieldErr(err))
+		}
+	}
+	if c.config.credentialProvider != nil {
+		// DSN保持为模板，渲染后的DSN只用于建立连接，避免密码出现在日志中
+		c.config.credentials, err = newCredentialRotator(context.Background(), c.config.credentialProvider)
+		if err != nil {
+			c.logger.Panic("read credential", elog.FieldErr(err))
+		}
+	}
+
 	err = c.setDSNParser(c.config.Dialect)
 	if err != nil {
 		c.logger.Panic("setDSNParser err", elog.String("dialect", c.config.Dialect), elog.FieldErr(err))
@@ -103,8 +114,18 @@ func (c *Container) Build(options ...Option) *Component {
 	if err := sqlDB.Ping(); err != nil {
 		c.logger.Panic("ping db", elog.FieldErrKind("register err"), elog.FieldErr(err), elog.FieldValueAny(c.config))
 	}
+	if c.config.migrations != nil {
+		if err := Migrate(context.Background(), component, c.config.migrations, c.config.migrationLocker); err != nil {
+			c.logger.Panic("migrate db", elog.FieldErr(err))
+		}
+		migratedInstances.Store(c.name, component)
+	}
 
-	// store db
-	instances.Store(c.name, component)
+	// store db，按配置名注册组件和连接池指标
+	register(c.name, component, c.config, c.logger)
+	// 连接池配置热更新
+	if c.name != "" {
+		econf.OnChange(c.onConfChange(component))
+	}
 	return component
 }
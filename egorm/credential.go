@@ -0,0 +1,254 @@
+package egorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego-component/egorm/manager"
+	"github.com/gotomicro/ego/core/elog"
+	"gorm.io/gorm"
+)
+
+const (
+	// CredentialProviderEnv 从环境变量读取用户名、密码
+	CredentialProviderEnv = "env"
+	// CredentialProviderFile 从文件读取用户名、密码，如Kubernetes Secret、Vault Agent挂载的文件
+	CredentialProviderFile = "file"
+)
+
+// Credential 数据库用户名、密码
+type Credential struct {
+	Username string
+	Password string
+}
+
+// CredentialProvider 提供数据库用户名、密码，DSN中的{username}、{password}会被替换为对应的值
+type CredentialProvider interface {
+	Credential(ctx context.Context) (Credential, error)
+}
+
+type envCredentialProvider struct {
+	usernameEnv string
+	passwordEnv string
+}
+
+// NewEnvCredentialProvider 从环境变量读取用户名、密码
+func NewEnvCredentialProvider(usernameEnv, passwordEnv string) CredentialProvider {
+	return &envCredentialProvider{usernameEnv: usernameEnv, passwordEnv: passwordEnv}
+}
+
+func (p *envCredentialProvider) Credential(ctx context.Context) (Credential, error) {
+	username, ok := os.LookupEnv(p.usernameEnv)
+	if !ok {
+		return Credential{}, fmt.Errorf("egorm: env %s not found", p.usernameEnv)
+	}
+	password, ok := os.LookupEnv(p.passwordEnv)
+	if !ok {
+		return Credential{}, fmt.Errorf("egorm: env %s not found", p.passwordEnv)
+	}
+	return Credential{Username: username, Password: password}, nil
+}
+
+type fileCredentialProvider struct {
+	usernameFile string
+	passwordFile string
+}
+
+// NewFileCredentialProvider 从文件读取用户名、密码，文件首尾的空白字符会被去掉
+func NewFileCredentialProvider(usernameFile, passwordFile string) CredentialProvider {
+	return &fileCredentialProvider{usernameFile: usernameFile, passwordFile: passwordFile}
+}
+
+func (p *fileCredentialProvider) Credential(ctx context.Context) (Credential, error) {
+	username, err := ioutil.ReadFile(p.usernameFile)
+	if err != nil {
+		return Credential{}, fmt.Errorf("egorm: read username file: %w", err)
+	}
+	password, err := ioutil.ReadFile(p.passwordFile)
+	if err != nil {
+		return Credential{}, fmt.Errorf("egorm: read password file: %w", err)
+	}
+	return Credential{Username: strings.TrimSpace(string(username)), Password: strings.TrimSpace(string(password))}, nil
+}
+
+// newCredentialProvider 根据配置创建CredentialProvider
+func newCredentialProvider(cc credentialConfig) (CredentialProvider, error) {
+	switch cc.Provider {
+	case CredentialProviderEnv:
+		return NewEnvCredentialProvider(cc.Username, cc.Password), nil
+	case CredentialProviderFile:
+		return NewFileCredentialProvider(cc.Username, cc.Password), nil
+	}
+	return nil, fmt.Errorf("egorm: invalid credential provider %s", cc.Provider)
+}
+
+// renderDSN 将DSN中的{username}、{password}替换为凭证
+func renderDSN(dsn string, credential Credential) string {
+	return strings.NewReplacer("{username}", credential.Username, "{password}", credential.Password).Replace(dsn)
+}
+
+// credentialRotator 保存当前的凭证，主库、读写分离的连接池建立新连接时都使用最新的凭证
+type credentialRotator struct {
+	provider CredentialProvider
+
+	mu         sync.RWMutex
+	credential Credential
+	pools      []*sql.DB
+}
+
+// newCredentialRotator 读取凭证，读取失败时返回错误
+func newCredentialRotator(ctx context.Context, provider CredentialProvider) (*credentialRotator, error) {
+	credential, err := provider.Credential(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &credentialRotator{provider: provider, credential: credential}, nil
+}
+
+func (r *credentialRotator) current() Credential {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.credential
+}
+
+// setCredential 更新凭证，凭证没有变化时返回false
+func (r *credentialRotator) setCredential(credential Credential) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.credential == credential {
+		return false
+	}
+	r.credential = credential
+	return true
+}
+
+func (r *credentialRotator) addPool(pool *sql.DB) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pools = append(r.pools, pool)
+}
+
+// dialector 返回使用最新凭证建立连接的Dialector，dsn为带有{username}、{password}占位符的模板，
+// 渲染后的DSN只交给Dialector，不会写回配置
+func (r *credentialRotator) dialector(parser manager.DSNParser, dsn string) gorm.Dialector {
+	return &credentialDialector{
+		Dialector: parser.GetDialector(renderDSN(dsn, r.current())),
+		dsn:       dsn,
+		rotator:   r,
+	}
+}
+
+// run 定期读取凭证，凭证变化后关闭所有连接池的空闲连接，新连接使用新凭证，done关闭后退出
+func (r *credentialRotator) run(done <-chan struct{}, config *config, logger *elog.Component) {
+	ticker := time.NewTicker(config.Credential.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), config.Credential.RefreshInterval)
+		credential, err := r.provider.Credential(ctx)
+		cancel()
+		if err != nil {
+			logger.Error("refresh credential", elog.FieldErr(err))
+			continue
+		}
+		if !r.setCredential(credential) {
+			continue
+		}
+		r.mu.RLock()
+		pools := r.pools
+		r.mu.RUnlock()
+		maxIdleConns := config.pool().MaxIdleConns
+		for _, pool := range pools {
+			pool.SetMaxIdleConns(0)
+			pool.SetMaxIdleConns(maxIdleConns)
+		}
+		logger.Info("credential rotated", elog.String("username", credential.Username))
+	}
+}
+
+// credentialDialector 初始化后将连接池替换为使用credentialConnector的连接池
+type credentialDialector struct {
+	gorm.Dialector
+	dsn     string
+	rotator *credentialRotator
+}
+
+// Apply 转发给原Dialector，如mysql设置NowFunc
+func (d *credentialDialector) Apply(config *gorm.Config) error {
+	if a, ok := d.Dialector.(interface{ Apply(*gorm.Config) error }); ok {
+		return a.Apply(config)
+	}
+	return nil
+}
+
+func (d *credentialDialector) Initialize(db *gorm.DB) error {
+	if err := d.Dialector.Initialize(db); err != nil {
+		return err
+	}
+	sqlDB, ok := db.ConnPool.(*sql.DB)
+	if !ok {
+		return fmt.Errorf("egorm: dialector %s does not use *sql.DB", d.Dialector.Name())
+	}
+	pool := sql.OpenDB(&credentialConnector{driver: sqlDB.Driver(), dsn: d.dsn, rotator: d.rotator})
+	db.ConnPool = pool
+	d.rotator.addPool(pool)
+	return sqlDB.Close()
+}
+
+// SavePoint 转发给原Dialector，嵌套事务需要
+func (d *credentialDialector) SavePoint(tx *gorm.DB, name string) error {
+	if sp, ok := d.Dialector.(gorm.SavePointerDialectorInterface); ok {
+		return sp.SavePoint(tx, name)
+	}
+	return gorm.ErrUnsupportedDriver
+}
+
+// RollbackTo 转发给原Dialector，嵌套事务需要
+func (d *credentialDialector) RollbackTo(tx *gorm.DB, name string) error {
+	if sp, ok := d.Dialector.(gorm.SavePointerDialectorInterface); ok {
+		return sp.RollbackTo(tx, name)
+	}
+	return gorm.ErrUnsupportedDriver
+}
+
+// credentialConnector 每次建立新连接时使用最新的凭证
+type credentialConnector struct {
+	driver  driver.Driver
+	dsn     string
+	rotator *credentialRotator
+}
+
+func (c *credentialConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	dsn := renderDSN(c.dsn, c.rotator.current())
+	if dc, ok := c.driver.(driver.DriverContext); ok {
+		connector, err := dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		return connector.Connect(ctx)
+	}
+	return c.driver.Open(dsn)
+}
+
+func (c *credentialConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// dialector 创建DSN对应的Dialector，开启凭证后DSN中的占位符在建立连接时替换
+func (c *config) dialector(parser manager.DSNParser, dsn string) gorm.Dialector {
+	if c.credentials == nil {
+		return parser.GetDialector(dsn)
+	}
+	return c.credentials.dialector(parser, dsn)
+}
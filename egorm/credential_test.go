@@ -0,0 +1,97 @@
+package egorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego-component/egorm/manager"
+	"github.com/gotomicro/ego/core/elog"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+)
+
+type dsnRecorder struct {
+	dsns []string
+}
+
+func (d *dsnRecorder) Open(dsn string) (driver.Conn, error) {
+	d.dsns = append(d.dsns, dsn)
+	return fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not implemented") }
+func (fakeConn) Close() error                              { return nil }
+func (fakeConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not implemented") }
+
+func TestCredentialConnector(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "username"), []byte("ego\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "password"), []byte("secret1\n"), 0600))
+	provider := NewFileCredentialProvider(filepath.Join(dir, "username"), filepath.Join(dir, "password"))
+	credential, err := provider.Credential(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, Credential{Username: "ego", Password: "secret1"}, credential)
+
+	recorder := &dsnRecorder{}
+	rotator := &credentialRotator{provider: provider, credential: credential}
+	connector := &credentialConnector{driver: recorder, dsn: "{username}:{password}@tcp(127.0.0.1:3306)/test", rotator: rotator}
+	db := sql.OpenDB(connector)
+	require.NoError(t, db.Ping())
+
+	// 凭证轮换后关闭空闲连接，新连接使用新凭证
+	assert.True(t, rotator.setCredential(Credential{Username: "ego", Password: "secret2"}))
+	assert.False(t, rotator.setCredential(Credential{Username: "ego", Password: "secret2"}))
+	db.SetMaxIdleConns(0)
+	db.SetMaxIdleConns(2)
+	require.NoError(t, db.Ping())
+	assert.Equal(t, []string{
+		"ego:secret1@tcp(127.0.0.1:3306)/test",
+		"ego:secret2@tcp(127.0.0.1:3306)/test",
+	}, recorder.dsns)
+}
+
+func TestCredentialRotator(t *testing.T) {
+	t.Setenv("EGORM_TEST_USERNAME", "ego")
+	t.Setenv("EGORM_TEST_PASSWORD", "secret1")
+	rotator, err := newCredentialRotator(context.Background(), NewEnvCredentialProvider("EGORM_TEST_USERNAME", "EGORM_TEST_PASSWORD"))
+	require.NoError(t, err)
+
+	// 渲染后的DSN只交给Dialector，模板不变
+	template := "{username}:{password}@tcp(127.0.0.1:3306)/test"
+	c := &config{DSN: template, credentials: rotator}
+	d, ok := c.dialector(manager.Get("mysql"), c.DSN).(*credentialDialector)
+	require.True(t, ok)
+	assert.Equal(t, "ego:secret1@tcp(127.0.0.1:3306)/test", d.Dialector.(*mysql.Dialector).DSN)
+	assert.Equal(t, template, d.dsn)
+	assert.Equal(t, template, c.DSN)
+
+	// done关闭后停止定期读取凭证
+	c.Credential.RefreshInterval = time.Millisecond
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		rotator.run(done, c, elog.DefaultLogger)
+		close(exited)
+	}()
+	os.Setenv("EGORM_TEST_PASSWORD", "secret2")
+	assert.Eventually(t, func() bool {
+		return rotator.current().Password == "secret2"
+	}, time.Second, time.Millisecond)
+	close(done)
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("credential rotator did not stop")
+	}
+}
@@ -0,0 +1,112 @@
+package egorm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// dtmResultSuccess DTM接口成功时返回的dtm_result
+const dtmResultSuccess = "SUCCESS"
+
+// DTMClient DTM事务协调服务的HTTP客户端，saga提交给DTM后由DTM持久化、调用分支并负责重试和补偿，
+// 各分支的本地事务和补偿仍可以使用egorm实现
+type DTMClient struct {
+	server string
+	client *http.Client
+}
+
+// NewDTMClient 创建DTM客户端，server为DTM的HTTP地址，如 http://localhost:36789/api/dtmsvr
+func NewDTMClient(server string) *DTMClient {
+	return &DTMClient{server: strings.TrimRight(server, "/"), client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// DTMSagaStep 提交给DTM的saga分支，Action、Compensate为分支服务的HTTP地址，DTM使用POST调用并将Payload作为请求体
+type DTMSagaStep struct {
+	Action     string
+	Compensate string
+	Payload    interface{}
+}
+
+// NewGID 从DTM获取全局事务ID
+func (c *DTMClient) NewGID(ctx context.Context) (string, error) {
+	var resp struct {
+		GID       string `json:"gid"`
+		DTMResult string `json:"dtm_result"`
+	}
+	if err := c.call(ctx, http.MethodGet, "/newGid", nil, &resp); err != nil {
+		return "", err
+	}
+	if resp.GID == "" {
+		return "", fmt.Errorf("egorm: dtm newGid returned empty gid")
+	}
+	return resp.GID, nil
+}
+
+// SubmitSaga 提交saga，DTM按顺序调用各分支的Action，失败时按相反顺序调用Compensate
+func (c *DTMClient) SubmitSaga(ctx context.Context, gid string, steps []DTMSagaStep) error {
+	req := struct {
+		GID       string              `json:"gid"`
+		TransType string              `json:"trans_type"`
+		Steps     []map[string]string `json:"steps"`
+		Payloads  []string            `json:"payloads"`
+	}{GID: gid, TransType: "saga"}
+	for _, step := range steps {
+		payload, err := json.Marshal(step.Payload)
+		if err != nil {
+			return fmt.Errorf("egorm: marshal dtm saga payload: %w", err)
+		}
+		req.Steps = append(req.Steps, map[string]string{"action": step.Action, "compensate": step.Compensate})
+		req.Payloads = append(req.Payloads, string(payload))
+	}
+	var resp struct {
+		DTMResult string `json:"dtm_result"`
+	}
+	if err := c.call(ctx, http.MethodPost, "/submit", req, &resp); err != nil {
+		return err
+	}
+	if resp.DTMResult != "" && resp.DTMResult != dtmResultSuccess {
+		return fmt.Errorf("egorm: dtm submit saga %s: %s", gid, resp.DTMResult)
+	}
+	return nil
+}
+
+func (c *DTMClient) call(ctx context.Context, method string, path string, body interface{}, resp interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.server+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("egorm: dtm %s: %w", path, err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("egorm: dtm %s: %w", path, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("egorm: dtm %s: status %d: %s", path, res.StatusCode, data)
+	}
+	if err := json.Unmarshal(data, resp); err != nil {
+		return fmt.Errorf("egorm: dtm %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package egorm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDTMClient(t *testing.T) {
+	var submitted map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/dtmsvr/newGid":
+			_, _ = w.Write([]byte(`{"gid":"gid1","dtm_result":"SUCCESS"}`))
+		case "/api/dtmsvr/submit":
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&submitted))
+			if submitted["gid"] == "conflict" {
+				w.WriteHeader(http.StatusConflict)
+				_, _ = w.Write([]byte(`{"dtm_result":"FAILURE","message":"duplicated gid"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"dtm_result":"SUCCESS"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	client := NewDTMClient(server.URL + "/api/dtmsvr/")
+	gid, err := client.NewGID(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "gid1", gid)
+
+	err = client.SubmitSaga(context.Background(), gid, []DTMSagaStep{
+		{Action: "http://order/create", Compensate: "http://order/cancel", Payload: map[string]int{"amount": 30}},
+		{Action: "http://payment/pay", Compensate: "http://payment/refund"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"gid":        "gid1",
+		"trans_type": "saga",
+		"steps": []interface{}{
+			map[string]interface{}{"action": "http://order/create", "compensate": "http://order/cancel"},
+			map[string]interface{}{"action": "http://payment/pay", "compensate": "http://payment/refund"},
+		},
+		"payloads": []interface{}{`{"amount":30}`, "null"},
+	}, submitted)
+
+	err = client.SubmitSaga(context.Background(), "conflict", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 409")
+}
@@ -0,0 +1,216 @@
+package egorm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// encryptedSeparator 密文格式为 密钥ID$base64(nonce+密文)
+const encryptedSeparator = "$"
+
+var (
+	// ErrNoKeyProvider 没有通过SetKeyProvider设置密钥
+	ErrNoKeyProvider = errors.New("egorm: key provider is not set")
+	// ErrInvalidCiphertext 数据库中的值不是合法的密文
+	ErrInvalidCiphertext = errors.New("egorm: invalid ciphertext")
+)
+
+// KeyProvider 提供字段加密使用的AES密钥，可以对接KMS
+type KeyProvider interface {
+	// CurrentKeyID 加密新数据使用的密钥ID
+	CurrentKeyID() string
+	// Key 返回密钥ID对应的密钥，长度为16、24或32字节，轮换密钥后旧密钥需要保留用于解密
+	Key(keyID string) ([]byte, error)
+}
+
+type staticKeyProvider struct {
+	currentKeyID string
+	keys         map[string][]byte
+}
+
+// NewStaticKeyProvider 使用固定的密钥，currentKeyID为加密新数据使用的密钥
+func NewStaticKeyProvider(currentKeyID string, keys map[string][]byte) KeyProvider {
+	return &staticKeyProvider{currentKeyID: currentKeyID, keys: keys}
+}
+
+func (p *staticKeyProvider) CurrentKeyID() string {
+	return p.currentKeyID
+}
+
+func (p *staticKeyProvider) Key(keyID string) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("egorm: unknown encryption key id %s", keyID)
+	}
+	return key, nil
+}
+
+// encryptor 使用AES-GCM加解密，密钥ID作为附加数据，防止密文被挪用到其他密钥下
+type encryptor struct {
+	provider KeyProvider
+	aeads    sync.Map // keyID => cipher.AEAD
+}
+
+var defaultEncryptor struct {
+	sync.RWMutex
+	*encryptor
+}
+
+// SetKeyProvider 设置EncryptedString字段加解密使用的密钥。EncryptedString读写时拿不到所属的组件，
+// 因此密钥是进程级别的，所有egorm组件共用，需要在读写加密字段之前设置，如在main函数中
+func SetKeyProvider(provider KeyProvider) {
+	defaultEncryptor.Lock()
+	defer defaultEncryptor.Unlock()
+	defaultEncryptor.encryptor = &encryptor{provider: provider}
+}
+
+func getEncryptor() (*encryptor, error) {
+	defaultEncryptor.RLock()
+	defer defaultEncryptor.RUnlock()
+	if defaultEncryptor.encryptor == nil {
+		return nil, ErrNoKeyProvider
+	}
+	return defaultEncryptor.encryptor, nil
+}
+
+func (e *encryptor) aead(keyID string) (cipher.AEAD, error) {
+	if aead, ok := e.aeads.Load(keyID); ok {
+		return aead.(cipher.AEAD), nil
+	}
+	key, err := e.provider.Key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("egorm: encryption key %s: %w", keyID, err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	e.aeads.Store(keyID, aead)
+	return aead, nil
+}
+
+func (e *encryptor) encrypt(plaintext []byte) (string, error) {
+	keyID := e.provider.CurrentKeyID()
+	if keyID == "" || strings.Contains(keyID, encryptedSeparator) {
+		return "", fmt.Errorf("egorm: invalid encryption key id %q", keyID)
+	}
+	aead, err := e.aead(keyID)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(keyID))
+	return keyID + encryptedSeparator + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (e *encryptor) decrypt(ciphertext string) ([]byte, error) {
+	i := strings.Index(ciphertext, encryptedSeparator)
+	if i <= 0 {
+		return nil, ErrInvalidCiphertext
+	}
+	keyID := ciphertext[:i]
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext[i+1:])
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+	aead, err := e.aead(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrInvalidCiphertext
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCiphertext, err)
+	}
+	return plaintext, nil
+}
+
+// EncryptedString 写入数据库时加密、读取时解密的字符串，用于手机号、身份证号等敏感字段，
+// 数据库中的字段类型需要能存下密文，如varchar(255)
+//
+//	type User struct {
+//		ID    int64
+//		Phone egorm.EncryptedString `gorm:"type:varchar(255)"`
+//	}
+//
+// 密文每次都不同，不能作为查询条件使用。字段可能为NULL时使用NullEncryptedString
+type EncryptedString string
+
+// Value 实现driver.Valuer，写入时加密
+func (s EncryptedString) Value() (driver.Value, error) {
+	e, err := getEncryptor()
+	if err != nil {
+		return nil, err
+	}
+	return e.encrypt([]byte(s))
+}
+
+// Scan 实现sql.Scanner，读取时解密，与database/sql的string一样不支持NULL
+func (s *EncryptedString) Scan(value interface{}) error {
+	var ciphertext string
+	switch v := value.(type) {
+	case nil:
+		return fmt.Errorf("egorm: converting NULL to EncryptedString is unsupported, use NullEncryptedString")
+	case string:
+		ciphertext = v
+	case []byte:
+		ciphertext = string(v)
+	default:
+		return fmt.Errorf("egorm: unsupported type %T for EncryptedString", value)
+	}
+	e, err := getEncryptor()
+	if err != nil {
+		return err
+	}
+	plaintext, err := e.decrypt(ciphertext)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(plaintext)
+	return nil
+}
+
+// NullEncryptedString 可以为NULL的EncryptedString，与sql.NullString用法相同，
+// Valid为false时写入NULL，读取到NULL时Valid为false
+type NullEncryptedString struct {
+	String EncryptedString
+	Valid  bool
+}
+
+// Value 实现driver.Valuer，Valid为false时写入NULL
+func (s NullEncryptedString) Value() (driver.Value, error) {
+	if !s.Valid {
+		return nil, nil
+	}
+	return s.String.Value()
+}
+
+// Scan 实现sql.Scanner，读取到NULL时Valid为false
+func (s *NullEncryptedString) Scan(value interface{}) error {
+	if value == nil {
+		s.String, s.Valid = "", false
+		return nil
+	}
+	if err := s.String.Scan(value); err != nil {
+		return err
+	}
+	s.Valid = true
+	return nil
+}
@@ -0,0 +1,51 @@
+package egorm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedString(t *testing.T) {
+	SetKeyProvider(NewStaticKeyProvider("k1", map[string][]byte{
+		"k1": []byte("0123456789abcdef"),
+		"k2": []byte("0123456789abcdef0123456789abcdef"),
+	}))
+	value, err := EncryptedString("13800000000").Value()
+	require.NoError(t, err)
+	assert.Contains(t, value, "k1$")
+	assert.NotContains(t, value, "13800000000")
+
+	var s EncryptedString
+	require.NoError(t, s.Scan([]byte(value.(string))))
+	assert.Equal(t, EncryptedString("13800000000"), s)
+
+	// 轮换密钥后旧数据仍可解密
+	SetKeyProvider(NewStaticKeyProvider("k2", map[string][]byte{
+		"k1": []byte("0123456789abcdef"),
+		"k2": []byte("0123456789abcdef0123456789abcdef"),
+	}))
+	require.NoError(t, s.Scan(value))
+	assert.Equal(t, EncryptedString("13800000000"), s)
+
+	// 密钥ID被篡改时无法解密
+	assert.ErrorIs(t, s.Scan("k2"+value.(string)[2:]), ErrInvalidCiphertext)
+
+	// NULL不能读取到EncryptedString，需要使用NullEncryptedString
+	assert.Error(t, s.Scan(nil))
+
+	var ns NullEncryptedString
+	require.NoError(t, ns.Scan(nil))
+	assert.False(t, ns.Valid)
+	null, err := ns.Value()
+	require.NoError(t, err)
+	assert.Nil(t, null)
+
+	ns = NullEncryptedString{String: "", Valid: true}
+	value, err = ns.Value()
+	require.NoError(t, err)
+	assert.Contains(t, value, "k2$")
+	require.NoError(t, ns.Scan(value))
+	assert.Equal(t, NullEncryptedString{String: "", Valid: true}, ns)
+}
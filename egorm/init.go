@@ -21,6 +21,12 @@ func init() {
 		rets.Gorms = stats()
 		_ = jsoniter.NewEncoder(w).Encode(rets)
 	})
+	egovernor.HandleFunc("/debug/gorm/configs", func(w http.ResponseWriter, r *http.Request) {
+		_ = jsoniter.NewEncoder(w).Encode(configs())
+	})
+	egovernor.HandleFunc("/debug/gorm/migrations", func(w http.ResponseWriter, r *http.Request) {
+		_ = jsoniter.NewEncoder(w).Encode(appliedMigrations())
+	})
 	go monitor()
 }
 
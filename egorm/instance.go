@@ -1,24 +1,112 @@
 package egorm
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/gotomicro/ego/core/elog"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var instances = sync.Map{}
 
+// instance 已经Build的组件，保存组件的配置和连接池指标，组件之间互不影响
+type instance struct {
+	db        *Component
+	config    *config
+	collector prometheus.Collector // 连接池指标，没有开启监控时为nil
+}
+
+// unregister 注销连接池指标
+func (i *instance) unregister() {
+	if i.collector != nil {
+		prometheus.Unregister(i.collector)
+	}
+}
+
+// register 按配置名保存组件并注册连接池指标，同名组件已经Build时替换旧组件，并注销旧组件的连接池指标
+func register(name string, db *Component, config *config, logger *elog.Component) {
+	if old, ok := instances.Load(name); ok {
+		logger.Warn("component already built, replace it", elog.FieldName(name))
+		old.(*instance).unregister()
+	}
+	inst := &instance{db: db, config: config}
+	if config.EnableMetricInterceptor {
+		sqlDB, err := db.DB()
+		if err == nil {
+			inst.collector, err = registerPoolMetrics(name, sqlDB)
+		}
+		if err != nil {
+			logger.Error("register pool metrics", elog.FieldErr(err))
+		}
+	}
+	instances.Store(name, inst)
+}
+
+// deregister 删除组件并注销连接池指标
+func deregister(db *Component) {
+	instances.Range(func(key, val interface{}) bool {
+		if inst := val.(*instance); inst.db == db {
+			inst.unregister()
+			instances.Delete(key)
+		}
+		return true
+	})
+}
+
+// Get 根据配置名获取已经Build的组件，没有Build时返回nil，用于多个数据库的服务中按名称获取组件
+//
+//	egorm.Load("mysql.orders").Build()
+//	egorm.Load("mysql.users").Build()
+//	orders := egorm.Get("mysql.orders")
+func Get(name string) *Component {
+	if inst, ok := instances.Load(name); ok {
+		return inst.(*instance).db
+	}
+	return nil
+}
+
+// Names 返回所有已经Build的组件的配置名
+func Names() []string {
+	names := make([]string, 0)
+	iterate(func(name string, db *Component) bool {
+		names = append(names, name)
+		return true
+	})
+	sort.Strings(names)
+	return names
+}
+
 // iterate 遍历所有实例
 func iterate(fn func(name string, db *Component) bool) {
 	instances.Range(func(key, val interface{}) bool {
-		return fn(key.(string), val.(*Component))
+		return fn(key.(string), val.(*instance).db)
 	})
 }
 
-// configs
+// configs 返回所有组件的配置，不包含DSN，避免泄露密码
 func configs() map[string]interface{} {
 	var rets = make(map[string]interface{})
 	instances.Range(func(key, val interface{}) bool {
+		config := val.(*instance).config
+		pool := config.pool()
+		ret := map[string]interface{}{
+			"dialect":                 config.Dialect,
+			"maxIdleConns":            pool.MaxIdleConns,
+			"maxOpenConns":            pool.MaxOpenConns,
+			"connMaxLifetime":         pool.ConnMaxLifetime.String(),
+			"slowLogThreshold":        config.SlowLogThreshold.String(),
+			"enableMetricInterceptor": config.EnableMetricInterceptor,
+			"enableTraceInterceptor":  config.EnableTraceInterceptor,
+			"interceptors":            len(config.interceptors),
+			"resolvers":               len(config.Resolvers),
+			"shardings":               len(config.Shardings),
+		}
+		if config.dsnCfg != nil {
+			ret["addr"] = config.dsnCfg.Addr
+			ret["dbName"] = config.dsnCfg.DBName
+		}
+		rets[key.(string)] = ret
 		return true
 	})
 
@@ -28,10 +116,7 @@ func configs() map[string]interface{} {
 // stats
 func stats() (stats map[string]interface{}) {
 	stats = make(map[string]interface{})
-	instances.Range(func(key, val interface{}) bool {
-		name := key.(string)
-		db := val.(*Component)
-
+	iterate(func(name string, db *Component) bool {
 		sqlDB, err := db.DB()
 		if err != nil {
 			elog.EgoLogger.With(elog.FieldComponent(PackageName)).Panic("stats db error", elog.FieldErr(err))
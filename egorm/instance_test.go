@@ -0,0 +1,70 @@
+package egorm
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/gotomicro/ego-component/egorm/manager"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+// openInstanceDB 创建不连接数据库的组件
+func openInstanceDB(t *testing.T) *Component {
+	sqlDB := sql.OpenDB(&credentialConnector{driver: &dsnRecorder{}})
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+	return db
+}
+
+func TestGet(t *testing.T) {
+	orders, users := openInstanceDB(t), openInstanceDB(t)
+	ordersConfig := DefaultConfig()
+	ordersConfig.DSN = "root:secret@tcp(127.0.0.1:3306)/orders"
+	ordersConfig.dsnCfg = &manager.DSN{Addr: "127.0.0.1:3306", DBName: "orders"}
+	register("mysql.orders", orders, ordersConfig, elog.DefaultLogger)
+	register("mysql.users", users, DefaultConfig(), elog.DefaultLogger)
+	defer deregister(orders)
+	defer deregister(users)
+
+	assert.Same(t, orders, Get("mysql.orders"))
+	assert.Same(t, users, Get("mysql.users"))
+	assert.Nil(t, Get("mysql.unknown"))
+	assert.Equal(t, []string{"mysql.orders", "mysql.users"}, Names())
+
+	// 配置按组件区分，不包含DSN
+	conf := configs()["mysql.orders"].(map[string]interface{})
+	assert.Equal(t, "orders", conf["dbName"])
+	assert.NotContains(t, conf, "dsn")
+	assert.Contains(t, configs(), "mysql.users")
+
+	// 每个组件有自己的连接池指标
+	ordersCollector := instanceOf(t, "mysql.orders").collector
+	require.NotNil(t, ordersCollector)
+	assert.NotSame(t, ordersCollector, instanceOf(t, "mysql.users").collector)
+
+	// 同名组件重新Build时替换旧组件，并注销旧组件的指标
+	newOrders := openInstanceDB(t)
+	register("mysql.orders", newOrders, DefaultConfig(), elog.DefaultLogger)
+	defer deregister(newOrders)
+	assert.Same(t, newOrders, Get("mysql.orders"))
+	// 旧组件的指标注销后新组件才能注册成功
+	assert.NotNil(t, instanceOf(t, "mysql.orders").collector)
+
+	// Close后不能再获取，指标被注销
+	usersCollector := instanceOf(t, "mysql.users").collector
+	require.NoError(t, Close(users))
+	assert.Nil(t, Get("mysql.users"))
+	assert.False(t, prometheus.Unregister(usersCollector))
+	assert.Equal(t, []string{"mysql.orders"}, Names())
+}
+
+func instanceOf(t *testing.T, name string) *instance {
+	inst, ok := instances.Load(name)
+	require.True(t, ok)
+	return inst.(*instance)
+}
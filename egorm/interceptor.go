@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"math/rand"
 	"strconv"
 	"strings"
 	"time"
@@ -17,10 +18,6 @@ import (
 	"github.com/gotomicro/ego/core/transport"
 	"github.com/gotomicro/ego/core/util/xdebug"
 	"github.com/spf13/cast"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/codes"
-	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
-	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
@@ -72,7 +69,11 @@ func metricInterceptor(compName string, dsn *manager.DSN, op string, config *con
 			var fields = make([]elog.Field, 0, 15+len(loggerKeys))
 			fields = append(fields,
 				elog.FieldMethod(op),
-				elog.FieldName(dsn.DBName+"."+db.Statement.Table), elog.FieldCost(cost))
+				elog.FieldName(dsn.DBName+"."+db.Statement.Table), elog.FieldCost(cost),
+				elog.Int64("rows", db.RowsAffected))
+			if txID := transactionID(db); txID != "" {
+				fields = append(fields, elog.String("txid", txID))
+			}
 			if config.EnableAccessInterceptorReq {
 				fields = append(fields, elog.String("req", logSQL(db, config.EnableDetailSQL)))
 			}
@@ -96,29 +97,31 @@ func metricInterceptor(compName string, dsn *manager.DSN, op string, config *con
 			emetric.ClientHandleHistogram.WithLabelValues(emetric.TypeGorm, compName, dsn.DBName+"."+db.Statement.Table, dsn.Addr).Observe(cost.Seconds())
 
 			// 如果有慢日志，就记录
-			if config.SlowLogThreshold > time.Duration(0) && config.SlowLogThreshold < cost {
-				logger.Warn("slow", fields...)
-			}
+			observeQuery(compName, op, db, cost, config, logger, fields)
 
 			// 如果有错误，记录错误信息
 			if db.Error != nil {
-				fields = append(fields, elog.FieldEvent("error"), elog.FieldErr(db.Error))
+				fields = append(fields, elog.FieldEvent("error"), elog.FieldErr(db.Error), elog.String("caller", caller()))
 				if errors.Is(db.Error, ErrRecordNotFound) {
 					logger.Warn("access", fields...)
 					emetric.ClientHandleCounter.Inc(emetric.TypeGorm, compName, dsn.DBName+"."+db.Statement.Table, dsn.Addr, "Empty")
+					countQuery(compName, op, db, "Empty")
 					return
 				}
 				logger.Error("access", fields...)
 				emetric.ClientHandleCounter.Inc(emetric.TypeGorm, compName, dsn.DBName+"."+db.Statement.Table, dsn.Addr, "Error")
+				countQuery(compName, op, db, "Error")
 				return
 			}
 
 			emetric.ClientHandleCounter.Inc(emetric.TypeGorm, compName, dsn.DBName+"."+db.Statement.Table, dsn.Addr, "OK")
+			countQuery(compName, op, db, "OK")
 			// 开启了记录日志信息，那么就记录access
 			// event normal和error，代表全部access的请求数
-			if config.EnableAccessInterceptor {
+			if config.EnableAccessInterceptor && sampled(config.AccessLogSampleRate) {
 				fields = append(fields,
 					elog.FieldEvent("normal"),
+					elog.String("caller", caller()),
 				)
 				logger.Info("access", fields...)
 			}
@@ -133,47 +136,23 @@ func logSQL(db *gorm.DB, enableDetailSQL bool) string {
 	return db.Statement.SQL.String()
 }
 
-func traceInterceptor(compName string, dsn *manager.DSN, op string, options *config, logger *elog.Component) func(Handler) Handler {
-	ip, port := peerInfo(dsn.Addr)
-	attrs := []attribute.KeyValue{
-		semconv.NetHostIPKey.String(ip),
-		semconv.NetPeerPortKey.Int(port),
-		semconv.NetTransportKey.String(dsn.Net),
-		semconv.DBNameKey.String(dsn.DBName),
+// sampled 按采样率决定是否记录，rate大于等于1时全部记录，小于等于0时不记录
+func sampled(rate float64) bool {
+	if rate >= 1 {
+		return true
 	}
-	tracer := etrace.NewTracer(trace.SpanKindClient)
-	return func(next Handler) Handler {
-		return func(db *gorm.DB) {
-			if db.Statement.Context != nil {
-				operation := "gorm:"
-				if len(db.Statement.BuildClauses) > 0 {
-					operation += strings.ToLower(db.Statement.BuildClauses[0])
-				}
-
-				_, span := tracer.Start(db.Statement.Context, operation, nil, trace.WithAttributes(attrs...))
-				defer span.End()
-				// 延迟执行 scope.CombinedConditionSql() 避免sqlVar被重复追加
-				next(db)
-				span.SetAttributes(
-					semconv.DBSystemKey.String(db.Dialector.Name()),
-					semconv.DBStatementKey.String(logSQL(db, options.EnableDetailSQL)),
-					semconv.DBOperationKey.String(operation),
-					semconv.DBSQLTableKey.String(db.Statement.Table),
-					semconv.NetPeerNameKey.String(dsn.Addr),
-					attribute.Int64("db.rows_affected", db.RowsAffected),
-				)
-				if db.Error != nil {
-					span.RecordError(db.Error)
-					span.SetStatus(codes.Error, db.Error.Error())
-					return
-				}
-				span.SetStatus(codes.Ok, "OK")
-				return
-			}
+	if rate <= 0 {
+		return false
+	}
+	return rand.Float64() < rate
+}
 
-			next(db)
-		}
+// transactionID 返回事务的标识，同一个事务中的SQL标识相同，不在事务中时返回空
+func transactionID(db *gorm.DB) string {
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); !ok {
+		return ""
 	}
+	return fmt.Sprintf("%p", db.Statement.ConnPool)
 }
 
 func getContextValue(c context.Context, key string) string {
@@ -1,7 +1,11 @@
 package egorm
 
 import (
+	"database/sql"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
 )
 
 func Test_peerInfo(t *testing.T) {
@@ -35,3 +39,26 @@ func Test_peerInfo(t *testing.T) {
 		})
 	}
 }
+
+func Test_sampled(t *testing.T) {
+	assert.True(t, sampled(1))
+	assert.False(t, sampled(0))
+
+	hits := 0
+	for i := 0; i < 10000; i++ {
+		if sampled(0.1) {
+			hits++
+		}
+	}
+	assert.InDelta(t, 1000, hits, 300)
+}
+
+func Test_transactionID(t *testing.T) {
+	db := &gorm.DB{Statement: &gorm.Statement{ConnPool: &sql.DB{}}}
+	assert.Empty(t, transactionID(db))
+
+	db.Statement.ConnPool = &sql.Tx{}
+	txID := transactionID(db)
+	assert.NotEmpty(t, txID)
+	assert.Equal(t, txID, transactionID(db))
+}
@@ -0,0 +1,57 @@
+package egorm
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/gotomicro/ego/core/emetric"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"gorm.io/gorm"
+)
+
+var (
+	// queryHistogram 按表和操作统计的SQL耗时
+	queryHistogram = emetric.HistogramVecOpts{
+		Namespace: emetric.DefaultNamespace,
+		Name:      "gorm_query_seconds",
+		Help:      "Latency of gorm queries by table and operation",
+		Labels:    []string{"name", "table", "operation"},
+		Buckets:   []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}.Build()
+	// queryCounter 按表、操作和结果统计的SQL次数，code为OK、Empty、Error
+	queryCounter = emetric.CounterVecOpts{
+		Namespace: emetric.DefaultNamespace,
+		Name:      "gorm_query_total",
+		Help:      "Number of gorm queries by table, operation and result code",
+		Labels:    []string{"name", "table", "operation", "code"},
+	}.Build()
+	// slowQueryCounter 按表和操作统计的慢查询次数
+	slowQueryCounter = emetric.CounterVecOpts{
+		Namespace: emetric.DefaultNamespace,
+		Name:      "gorm_slow_query_total",
+		Help:      "Number of gorm queries slower than slowLogThreshold",
+		Labels:    []string{"name", "table", "operation"},
+	}.Build()
+)
+
+// countQuery 记录SQL次数
+func countQuery(compName string, op string, db *gorm.DB, code string) {
+	queryCounter.Inc(compName, db.Statement.Table, strings.TrimPrefix(op, "gorm:"), code)
+}
+
+// registerPoolMetrics 注册连接池指标，指标名为go_sql_*，db_name为组件名，采集时读取sql.DBStats，
+// 返回注册的Collector用于注销，同名指标已经注册时忽略并返回nil
+func registerPoolMetrics(compName string, sqlDB *sql.DB) (prometheus.Collector, error) {
+	collector := collectors.NewDBStatsCollector(sqlDB, compName)
+	err := prometheus.Register(collector)
+	var registered prometheus.AlreadyRegisteredError
+	if errors.As(err, &registered) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return collector, nil
+}
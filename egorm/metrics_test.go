@@ -0,0 +1,38 @@
+package egorm
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterPoolMetrics(t *testing.T) {
+	sqlDB := sql.OpenDB(&credentialConnector{driver: &dsnRecorder{}})
+	sqlDB.SetMaxOpenConns(7)
+	collector, err := registerPoolMetrics("mysql.metrics", sqlDB)
+	require.NoError(t, err)
+	require.NotNil(t, collector)
+	defer prometheus.Unregister(collector)
+	// 同名组件重复注册时忽略
+	collector, err = registerPoolMetrics("mysql.metrics", sqlDB)
+	require.NoError(t, err)
+	assert.Nil(t, collector)
+
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	var maxOpen float64
+	for _, family := range families {
+		if family.GetName() != "go_sql_max_open_connections" {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if m.GetLabel()[0].GetValue() == "mysql.metrics" {
+				maxOpen = m.GetGauge().GetValue()
+			}
+		}
+	}
+	assert.Equal(t, float64(7), maxOpen)
+}
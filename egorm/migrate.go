@@ -0,0 +1,275 @@
+package egorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrDirtyMigration 不支持事务DDL的数据库（如MySQL）中迁移执行到一半失败，需要人工修复数据库后删除schema_migrations中的记录
+var ErrDirtyMigration = errors.New("egorm: dirty migration")
+
+// migrationFilePattern 迁移文件名格式为 版本号_名称.sql，如 0001_create_users.sql
+var migrationFilePattern = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+
+// migratedInstances 执行过迁移的组件，用于governor查看迁移版本
+var migratedInstances = sync.Map{}
+
+// Migration 一个版本的数据库迁移
+type Migration struct {
+	Version int64
+	Name    string
+	SQL     string // 多条语句以行尾的分号分隔
+}
+
+// Locker 分布式锁，保证多个副本同时启动时只有一个副本执行迁移，可以基于eredis、eetcd实现
+type Locker interface {
+	// Lock 阻塞直到获取锁，返回释放锁的函数
+	Lock(ctx context.Context) (unlock func(), err error)
+}
+
+// dbLocker 使用数据库的咨询锁，锁与数据库连接绑定，连接断开时自动释放
+type dbLocker struct {
+	db   *Component
+	name string
+}
+
+// NewDBLocker 返回基于数据库咨询锁的Locker，MySQL使用GET_LOCK，PostgreSQL使用pg_advisory_lock，SQL Server使用sp_getapplock
+func NewDBLocker(db *Component, name string) Locker {
+	return &dbLocker{db: db, name: name}
+}
+
+// dbLockSQL 返回加锁、解锁的SQL，不支持的数据库返回false
+func dbLockSQL(dialect string) (lock string, unlock string, ok bool) {
+	switch dialect {
+	case "mysql":
+		return "SELECT GET_LOCK(?, -1)", "SELECT RELEASE_LOCK(?)", true
+	case "postgres":
+		return "SELECT pg_advisory_lock(hashtext($1))", "SELECT pg_advisory_unlock(hashtext($1))", true
+	case "sqlserver":
+		return "EXEC sp_getapplock @Resource = @p1, @LockMode = 'Exclusive', @LockOwner = 'Session', @LockTimeout = -1",
+			"EXEC sp_releaseapplock @Resource = @p1, @LockOwner = 'Session'", true
+	}
+	return "", "", false
+}
+
+// Lock 在独占的连接上加锁，阻塞直到获取锁或者ctx结束
+func (l *dbLocker) Lock(ctx context.Context) (func(), error) {
+	lockSQL, unlockSQL, ok := dbLockSQL(l.db.Dialector.Name())
+	if !ok {
+		return nil, fmt.Errorf("egorm: dialect %s does not support db locker", l.db.Dialector.Name())
+	}
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if l.db.Dialector.Name() == "mysql" {
+		var locked sql.NullInt64
+		err = conn.QueryRowContext(ctx, lockSQL, l.name).Scan(&locked)
+		if err == nil && locked.Int64 != 1 {
+			err = fmt.Errorf("egorm: GET_LOCK %s returned %v", l.name, locked)
+		}
+	} else {
+		_, err = conn.ExecContext(ctx, lockSQL, l.name)
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return func() {
+		_, _ = conn.ExecContext(context.Background(), unlockSQL, l.name)
+		_ = conn.Close()
+	}, nil
+}
+
+// migrationLockName 没有传入locker时数据库咨询锁的名称
+const migrationLockName = "egorm_schema_migrations"
+
+// migrationRecord 已执行的迁移，Dirty为true时迁移执行到一半失败
+type migrationRecord struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `gorm:"size:255" json:"name"`
+	Dirty     bool      `json:"dirty"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+func (migrationRecord) TableName() string {
+	return "schema_migrations"
+}
+
+// LoadMigrations 读取目录下的迁移文件，通常配合embed使用
+//
+//	//go:embed migrations/*.sql
+//	var migrationFS embed.FS
+//	migrations, err := egorm.LoadMigrations(migrationFS, "migrations")
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]Migration, 0, len(entries))
+	versions := make(map[int64]string, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		m := migrationFilePattern.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("egorm: invalid migration version %s: %w", entry.Name(), err)
+		}
+		if name, ok := versions[version]; ok {
+			return nil, fmt.Errorf("egorm: duplicated migration version %d, %s and %s", version, name, entry.Name())
+		}
+		versions[version] = entry.Name()
+		content, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, Migration{Version: version, Name: m[2], SQL: string(content)})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Version < ret[j].Version
+	})
+	return ret, nil
+}
+
+// Migrate 按版本号顺序执行未执行过的迁移，已执行的版本记录在schema_migrations表中。
+// locker为nil时使用数据库的咨询锁（见NewDBLocker），不支持的数据库不加锁。
+// PostgreSQL、SQL Server的迁移在事务中执行，失败时整体回滚；MySQL的DDL会隐式提交，
+// 迁移失败时记录标记为dirty，之后的迁移返回ErrDirtyMigration，需要人工修复
+func Migrate(ctx context.Context, db *Component, migrations []Migration, locker Locker) error {
+	if locker == nil {
+		if _, _, ok := dbLockSQL(db.Dialector.Name()); ok {
+			locker = NewDBLocker(db, migrationLockName)
+		}
+	}
+	if locker != nil {
+		unlock, err := locker.Lock(ctx)
+		if err != nil {
+			return fmt.Errorf("egorm: lock migrations: %w", err)
+		}
+		defer unlock()
+	}
+
+	// 迁移执行的是DDL，不做租户隔离；schema_migrations的Version是迁移版本号，不是乐观锁版本号
+	db = db.WithContext(SkipOptimisticLock(SkipTenant(ctx)))
+	if err := db.AutoMigrate(&migrationRecord{}); err != nil {
+		return err
+	}
+	var records []migrationRecord
+	if err := db.Find(&records).Error; err != nil {
+		return err
+	}
+	appliedSet := make(map[int64]struct{}, len(records))
+	for _, record := range records {
+		if record.Dirty {
+			return fmt.Errorf("%w: %d_%s, fix the database manually and delete the record from schema_migrations", ErrDirtyMigration, record.Version, record.Name)
+		}
+		appliedSet[record.Version] = struct{}{}
+	}
+
+	pending := make([]Migration, len(migrations))
+	copy(pending, migrations)
+	sort.Slice(pending, func(i, j int) bool {
+		return pending[i].Version < pending[j].Version
+	})
+	for _, m := range pending {
+		if _, ok := appliedSet[m.Version]; ok {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("egorm: migration %d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// transactionalDDL 数据库是否支持在事务中执行DDL
+func transactionalDDL(dialect string) bool {
+	return dialect == "postgres" || dialect == "sqlserver"
+}
+
+// applyMigration 执行一个版本的迁移。支持事务DDL时在事务中执行，
+// 否则先写入dirty记录，全部语句执行成功后再清除dirty标记
+func applyMigration(db *gorm.DB, m Migration) error {
+	record := &migrationRecord{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}
+	if transactionalDDL(db.Dialector.Name()) {
+		return db.Transaction(func(tx *gorm.DB) error {
+			for _, stmt := range splitStatements(m.SQL) {
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Create(record).Error
+		})
+	}
+
+	record.Dirty = true
+	if err := db.Create(record).Error; err != nil {
+		return err
+	}
+	for _, stmt := range splitStatements(m.SQL) {
+		if err := db.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("%w: %v", ErrDirtyMigration, err)
+		}
+	}
+	return db.Model(record).Update("dirty", false).Error
+}
+
+// splitStatements 按行尾的分号拆分多条语句，MySQL默认不支持一次执行多条语句
+func splitStatements(sql string) []string {
+	var (
+		stmts []string
+		buf   strings.Builder
+	)
+	for _, line := range strings.Split(sql, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			stmts = append(stmts, strings.TrimSpace(buf.String()))
+			buf.Reset()
+		}
+	}
+	if rest := strings.TrimSpace(buf.String()); rest != "" {
+		stmts = append(stmts, rest)
+	}
+	return stmts
+}
+
+// appliedMigrations 返回执行过迁移的组件中已执行的迁移
+func appliedMigrations() map[string]interface{} {
+	rets := make(map[string]interface{})
+	migratedInstances.Range(func(key, val interface{}) bool {
+		var records []migrationRecord
+		if err := val.(*Component).Order("version").Find(&records).Error; err != nil {
+			rets[key.(string)] = err.Error()
+			return true
+		}
+		rets[key.(string)] = records
+		return true
+	})
+	return rets
+}
@@ -0,0 +1,111 @@
+package egorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_user_email.sql": {Data: []byte("ALTER TABLE users ADD COLUMN email varchar(255);")},
+		"migrations/0001_create_users.sql": {Data: []byte(`-- 用户表
+CREATE TABLE users (
+  id bigint PRIMARY KEY,
+  name varchar(64) DEFAULT 'a;b'
+);
+CREATE INDEX idx_name ON users (name);
+`)},
+		"migrations/README.md": {Data: []byte("ignored")},
+	}
+	migrations, err := LoadMigrations(fsys, "migrations")
+	require.NoError(t, err)
+	require.Len(t, migrations, 2)
+	assert.Equal(t, int64(1), migrations[0].Version)
+	assert.Equal(t, "create_users", migrations[0].Name)
+	assert.Equal(t, []string{
+		"CREATE TABLE users (\n  id bigint PRIMARY KEY,\n  name varchar(64) DEFAULT 'a;b'\n);",
+		"CREATE INDEX idx_name ON users (name);",
+	}, splitStatements(migrations[0].SQL))
+
+	fsys["migrations/0001_duplicated.sql"] = &fstest.MapFile{Data: []byte("SELECT 1;")}
+	_, err = LoadMigrations(fsys, "migrations")
+	assert.Error(t, err)
+}
+
+// lockConn 记录执行的SQL，查询返回1
+type lockConn struct {
+	mu      *sync.Mutex
+	queries *[]string
+}
+
+func (c lockConn) record(query string, args []driver.NamedValue) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.queries = append(*c.queries, query+" "+args[0].Value.(string))
+}
+
+func (c lockConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.record(query, args)
+	return &oneRows{}, nil
+}
+
+func (c lockConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.record(query, args)
+	return driver.RowsAffected(0), nil
+}
+
+func (lockConn) Prepare(query string) (driver.Stmt, error) { return nil, errors.New("not implemented") }
+func (lockConn) Close() error                              { return nil }
+func (lockConn) Begin() (driver.Tx, error)                 { return nil, errors.New("not implemented") }
+
+type oneRows struct {
+	done bool
+}
+
+func (r *oneRows) Columns() []string { return []string{"locked"} }
+func (r *oneRows) Close() error      { return nil }
+func (r *oneRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+type lockConnector struct {
+	conn lockConn
+}
+
+func (c lockConnector) Connect(ctx context.Context) (driver.Conn, error) { return c.conn, nil }
+func (c lockConnector) Driver() driver.Driver                            { return nil }
+
+func TestDBLocker(t *testing.T) {
+	var queries []string
+	pool := sql.OpenDB(lockConnector{conn: lockConn{mu: &sync.Mutex{}, queries: &queries}})
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: pool, SkipInitializeWithVersion: true}), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+
+	unlock, err := NewDBLocker(db, "migrations").Lock(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, pool.Stats().InUse, "lock holds a dedicated connection")
+	unlock()
+	assert.Equal(t, 0, pool.Stats().InUse)
+	assert.Equal(t, []string{"SELECT GET_LOCK(?, -1) migrations", "SELECT RELEASE_LOCK(?) migrations"}, queries)
+
+	_, _, ok := dbLockSQL("sqlite")
+	assert.False(t, ok)
+	assert.True(t, transactionalDDL("postgres"))
+	assert.False(t, transactionalDDL("mysql"))
+}
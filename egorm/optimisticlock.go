@@ -0,0 +1,130 @@
+package egorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// versionFieldName 乐观锁版本号字段
+	versionFieldName = "Version"
+	versionKey       = "egorm:optimistic_lock:version"
+)
+
+// ErrVersionConflict 乐观锁冲突，更新时记录的版本号已经被其他请求修改
+var ErrVersionConflict = errors.New("egorm: optimistic lock version conflict")
+
+type skipOptimisticLockKey struct{}
+
+// SkipOptimisticLock 返回不校验版本号的context，用于没有读取过记录、直接按主键更新的场景
+func SkipOptimisticLock(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipOptimisticLockKey{}, true)
+}
+
+func isSkipOptimisticLock(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	skip, _ := ctx.Value(skipOptimisticLockKey{}).(bool)
+	return skip
+}
+
+// optimisticLock 模型中有整数类型的Version字段时，更新自动带上 version = 当前版本 的条件并递增版本号
+type optimisticLock struct{}
+
+// Name 插件名称
+func (optimisticLock) Name() string {
+	return "egorm:optimistic_lock"
+}
+
+// Initialize 注册创建时初始化版本号、更新时校验版本号的回调
+func (p optimisticLock) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("egorm:optimistic_lock", p.initVersion); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("egorm:optimistic_lock:before", p.before); err != nil {
+		return err
+	}
+	return db.Callback().Update().After("gorm:update").Register("egorm:optimistic_lock:after", p.after)
+}
+
+// versionField 返回模型的版本号字段，只支持单条记录
+func versionField(db *gorm.DB) *schema.Field {
+	if db.Error != nil || db.Statement.Schema == nil || reflect.Indirect(db.Statement.ReflectValue).Kind() != reflect.Struct {
+		return nil
+	}
+	field := db.Statement.Schema.LookUpField(versionFieldName)
+	if field == nil {
+		return nil
+	}
+	switch field.FieldType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field
+	}
+	return nil
+}
+
+// initVersion 创建时版本号为0则设置为1
+func (optimisticLock) initVersion(db *gorm.DB) {
+	field := versionField(db)
+	if field == nil {
+		return
+	}
+	if _, zero := field.ValueOf(reflect.Indirect(db.Statement.ReflectValue)); zero {
+		db.Statement.SetColumn(field.DBName, 1)
+	}
+}
+
+// loadedRecord 语句是否更新一条已经读取的记录，即主键都不为零值
+func loadedRecord(db *gorm.DB) bool {
+	if len(db.Statement.Schema.PrimaryFields) == 0 {
+		return false
+	}
+	rv := reflect.Indirect(db.Statement.ReflectValue)
+	for _, field := range db.Statement.Schema.PrimaryFields {
+		if _, zero := field.ValueOf(rv); zero {
+			return false
+		}
+	}
+	return true
+}
+
+// before 更新已经读取的记录时加上版本号条件并递增版本号，版本号为0也是合法的版本号。
+// 模型主键为零值的Where条件更新、批量更新不校验版本号，不需要校验版本号时使用SkipOptimisticLock
+func (optimisticLock) before(db *gorm.DB) {
+	field := versionField(db)
+	if field == nil || isSkipOptimisticLock(db.Statement.Context) || !loadedRecord(db) {
+		return
+	}
+	value, _ := field.ValueOf(reflect.Indirect(db.Statement.ReflectValue))
+	version := cast.ToInt64(value)
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: version},
+	}})
+	if len(db.Statement.Selects) > 0 {
+		db.Statement.Selects = append(db.Statement.Selects, field.DBName)
+	}
+	db.Statement.SetColumn(field.DBName, version+1)
+	db.InstanceSet(versionKey, version)
+}
+
+// after 没有更新到记录时返回ErrVersionConflict，并还原模型中的版本号
+func (optimisticLock) after(db *gorm.DB) {
+	value, ok := db.InstanceGet(versionKey)
+	if !ok || db.Error != nil || db.DryRun || db.RowsAffected > 0 {
+		return
+	}
+	version := value.(int64)
+	if field := versionField(db); field != nil && db.Statement.ReflectValue.CanAddr() {
+		_ = field.Set(db.Statement.ReflectValue, version)
+	}
+	_ = db.AddError(fmt.Errorf("%w: table %s, version %d", ErrVersionConflict, db.Statement.Table, version))
+}
@@ -0,0 +1,85 @@
+package egorm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type account struct {
+	ID      int64
+	Balance int64
+	Version int
+}
+
+func TestOptimisticLock(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(optimisticLock{}))
+
+	a := account{Balance: 100}
+	require.NoError(t, db.Create(&a).Error)
+	assert.Equal(t, 1, a.Version)
+
+	a.ID = 1
+	stmt := db.Model(&a).Update("balance", 50).Statement
+	assert.NoError(t, stmt.Error)
+	assert.Equal(t, "UPDATE `accounts` SET `balance`=?,`version`=? WHERE `accounts`.`version` = ? AND `id` = ?", stmt.SQL.String())
+	assert.Equal(t, []interface{}{50, int64(2), int64(1), int64(1)}, stmt.Vars)
+	assert.Equal(t, 2, a.Version)
+
+	stmt = db.Save(&a).Statement
+	assert.NoError(t, stmt.Error)
+	assert.Contains(t, stmt.SQL.String(), "`accounts`.`version` = ?")
+	assert.Equal(t, 3, a.Version)
+
+	// 版本号为0也加锁
+	stmt = db.Model(&account{ID: 1}).Update("balance", 0).Statement
+	assert.NoError(t, stmt.Error)
+	assert.Equal(t, "UPDATE `accounts` SET `balance`=?,`version`=? WHERE `accounts`.`version` = ? AND `id` = ?", stmt.SQL.String())
+	assert.Equal(t, []interface{}{0, int64(1), int64(0), int64(1)}, stmt.Vars)
+
+	// Where条件更新不校验版本号
+	stmt = db.Model(&account{}).Where("balance > ?", 0).Update("balance", 0).Statement
+	assert.NoError(t, stmt.Error)
+	assert.Equal(t, "UPDATE `accounts` SET `balance`=? WHERE balance > ?", stmt.SQL.String())
+
+	// 跳过版本号校验
+	stmt = db.WithContext(SkipOptimisticLock(context.Background())).Model(&account{ID: 1}).Update("balance", 0).Statement
+	assert.NoError(t, stmt.Error)
+	assert.NotContains(t, stmt.SQL.String(), "version")
+}
+
+func TestOptimisticLockBulkUpdate(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(optimisticLock{}))
+	require.NoError(t, db.AutoMigrate(&account{}))
+	accounts := []account{{Balance: 100}, {Balance: 200, Version: 3}, {Balance: 0}}
+	for i := range accounts {
+		require.NoError(t, db.Create(&accounts[i]).Error)
+	}
+
+	// 模型主键为零值时更新所有满足条件的记录，不管版本号是多少
+	res := db.Model(&account{}).Where("balance > ?", 0).Update("balance", 1)
+	require.NoError(t, res.Error)
+	assert.Equal(t, int64(2), res.RowsAffected)
+	var got []account
+	require.NoError(t, db.Order("id").Find(&got).Error)
+	assert.Equal(t, []account{{ID: 1, Balance: 1, Version: 1}, {ID: 2, Balance: 1, Version: 3}, {ID: 3, Balance: 0, Version: 1}}, got)
+
+	// 已经读取的记录仍然校验版本号
+	stale := got[0]
+	require.NoError(t, db.Model(&got[0]).Update("balance", 2).Error)
+	assert.Equal(t, 2, got[0].Version)
+	err = db.Model(&stale).Update("balance", 3).Error
+	assert.True(t, errors.Is(err, ErrVersionConflict))
+	assert.Equal(t, 1, stale.Version)
+}
@@ -1,6 +1,8 @@
 package egorm
 
 import (
+	"time"
+
 	"github.com/gotomicro/ego-component/egorm/manager"
 )
 
@@ -30,3 +32,29 @@ func WithInterceptor(is ...Interceptor) Option {
 		c.config.interceptors = append(c.config.interceptors, is...)
 	}
 }
+
+// WithCredentialProvider 设置自定义的用户名、密码来源，如Vault，DSN中的{username}、{password}会被替换为读取到的凭证
+func WithCredentialProvider(provider CredentialProvider) Option {
+	return func(c *Container) {
+		c.config.credentialProvider = provider
+	}
+}
+
+// WithMigrations 启动时执行数据库迁移，locker用于保证多个副本只有一个执行迁移，单副本时可以为nil
+func WithMigrations(migrations []Migration, locker Locker) Option {
+	return func(c *Container) {
+		c.config.migrations = migrations
+		c.config.migrationLocker = locker
+	}
+}
+
+// WithQueryCache 开启查询缓存，只有通过WithCache开启缓存的查询会读写缓存，ttl为默认过期时间，小于等于0时为1分钟
+func WithQueryCache(store QueryCacheStore, ttl time.Duration) Option {
+	return func(c *Container) {
+		if ttl <= 0 {
+			ttl = time.Minute
+		}
+		c.config.queryCacheStore = store
+		c.config.queryCacheTTL = ttl
+	}
+}
@@ -0,0 +1,83 @@
+package egorm
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// OutboxStatusPending 待投递
+	OutboxStatusPending = 0
+	// OutboxStatusSent 已投递
+	OutboxStatusSent = 1
+)
+
+// OutboxMessage 发件箱消息，与业务数据在同一个事务中写入，由RelayOutbox投递到消息队列
+type OutboxMessage struct {
+	ID          int64     `gorm:"primaryKey"`
+	Topic       string    `gorm:"size:255;not null"`
+	Key         string    `gorm:"size:255"`
+	Payload     []byte    `gorm:"type:blob"`
+	Status      int8      `gorm:"not null;default:0;index:idx_status_next_retry_at"`
+	Attempts    int       `gorm:"not null;default:0"`
+	NextRetryAt time.Time `gorm:"index:idx_status_next_retry_at"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// TableName 发件箱表名
+func (OutboxMessage) TableName() string {
+	return "outbox_messages"
+}
+
+// AddOutbox 在事务中写入发件箱消息，保证业务数据和消息同时提交或回滚
+//
+//	err := db.Transaction(func(tx *gorm.DB) error {
+//		if err := tx.Create(&order).Error; err != nil {
+//			return err
+//		}
+//		return egorm.AddOutbox(tx, "order_created", order.No, payload)
+//	})
+func AddOutbox(tx *Component, topic string, key string, payload []byte) error {
+	return tx.Create(&OutboxMessage{Topic: topic, Key: key, Payload: payload, NextRetryAt: time.Now()}).Error
+}
+
+// RelayOutbox 投递一批待投递的消息，返回投递成功的数量，投递失败的消息按尝试次数退避后重试。
+// 使用 FOR UPDATE SKIP LOCKED 锁定消息，多个副本可以同时投递，MySQL需要8.0及以上版本
+func RelayOutbox(ctx context.Context, db *Component, batchSize int, publish func(ctx context.Context, msg OutboxMessage) error) (int, error) {
+	sent := 0
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var msgs []OutboxMessage
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_retry_at <= ?", OutboxStatusPending, time.Now()).
+			Order("id").Limit(batchSize).Find(&msgs).Error
+		if err != nil {
+			return err
+		}
+		for _, msg := range msgs {
+			if err := publish(ctx, msg); err != nil {
+				backoff := time.Duration(msg.Attempts+1) * time.Second
+				if backoff > time.Minute {
+					backoff = time.Minute
+				}
+				err = tx.Model(&OutboxMessage{}).Where("id = ?", msg.ID).Updates(map[string]interface{}{
+					"attempts":      gorm.Expr("attempts + 1"),
+					"next_retry_at": time.Now().Add(backoff),
+				}).Error
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Model(&OutboxMessage{}).Where("id = ?", msg.ID).Update("status", OutboxStatusSent).Error; err != nil {
+				return err
+			}
+			sent++
+		}
+		return nil
+	})
+	return sent, err
+}
@@ -0,0 +1,74 @@
+package egorm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+)
+
+func TestRelayOutbox(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	pool := &fakeTxPool{}
+	db.ConnPool = pool
+	db.Statement.ConnPool = pool
+
+	var query string
+	require.NoError(t, db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) {
+		callbacks.BuildQuerySQL(db)
+		query = db.Statement.SQL.String()
+		*db.Statement.Dest.(*[]OutboxMessage) = []OutboxMessage{
+			{ID: 1, Topic: "order_created", Payload: []byte("1")},
+			{ID: 2, Topic: "order_created", Payload: []byte("2"), Attempts: 100},
+			{ID: 3, Topic: "order_created", Payload: []byte("3")},
+		}
+	}))
+	updates := make(map[interface{}]interface{})
+	require.NoError(t, db.Callback().Update().Replace("gorm:update", func(db *gorm.DB) {
+		where := db.Statement.Clauses["WHERE"].Expression.(clause.Where)
+		id := where.Exprs[0].(clause.Expr).Vars[0]
+		updates[id] = db.Statement.Dest
+	}))
+
+	var published []int64
+	start := time.Now()
+	sent, err := RelayOutbox(context.Background(), db, 10, func(ctx context.Context, msg OutboxMessage) error {
+		published = append(published, msg.ID)
+		if msg.ID == 2 {
+			return errors.New("broker unavailable")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.True(t, pool.committed)
+	assert.Equal(t, []int64{1, 2, 3}, published)
+	assert.Equal(t, "SELECT * FROM `outbox_messages` WHERE status = ? AND next_retry_at <= ? ORDER BY id LIMIT 10 FOR UPDATE SKIP LOCKED", query)
+
+	// 投递成功的消息标记为已投递
+	assert.Equal(t, map[string]interface{}{"status": OutboxStatusSent}, updates[int64(1)])
+	assert.Equal(t, map[string]interface{}{"status": OutboxStatusSent}, updates[int64(3)])
+	// 投递失败的消息增加尝试次数，退避时间最多1分钟
+	retry := updates[int64(2)].(map[string]interface{})
+	assert.Equal(t, gorm.Expr("attempts + 1"), retry["attempts"])
+	nextRetryAt := retry["next_retry_at"].(time.Time)
+	assert.WithinDuration(t, start.Add(time.Minute), nextRetryAt, time.Second)
+
+	// 查询失败时事务回滚
+	pool.committed = false
+	errQuery := errors.New("connection refused")
+	require.NoError(t, db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) {
+		_ = db.AddError(errQuery)
+	}))
+	_, err = RelayOutbox(context.Background(), db, 10, func(ctx context.Context, msg OutboxMessage) error { return nil })
+	assert.ErrorIs(t, err, errQuery)
+	assert.False(t, pool.committed)
+}
@@ -0,0 +1,383 @@
+package egorm
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	// DefaultPageSize 默认每页数量
+	DefaultPageSize = 20
+	// MaxPageSize 每页数量上限
+	MaxPageSize = 1000
+)
+
+// ErrInvalidCursor 游标不是PaginateCursor返回的NextCursor
+var ErrInvalidCursor = errors.New("egorm: invalid cursor")
+
+// Page 分页结果
+type Page[T any] struct {
+	List       []T    `json:"list"`
+	Total      int64  `json:"total,omitempty"`      // 页码分页且WithTotal为true时的总数
+	NextCursor string `json:"nextCursor,omitempty"` // 游标分页的下一页游标，为空时没有下一页
+}
+
+// PageRequest 页码分页参数
+type PageRequest struct {
+	Page      int  // 页码，从1开始
+	PageSize  int  // 每页数量，默认20，最大1000
+	WithTotal bool // 是否统计总数，大表统计总数较慢，不需要时关闭
+}
+
+// CursorRequest 游标分页参数，按Column和主键排序，翻页性能不随页数下降
+type CursorRequest struct {
+	Cursor   string // 上一页返回的NextCursor，第一页为空
+	PageSize int    // 每页数量，默认20，最大1000
+	Column   string // 排序字段，为空时按主键排序
+	Desc     bool   // 是否倒序
+}
+
+func pageSize(size int) int {
+	if size <= 0 {
+		return DefaultPageSize
+	}
+	if size > MaxPageSize {
+		return MaxPageSize
+	}
+	return size
+}
+
+// primaryField 返回T的主键，只支持单一主键
+func primaryField[T any](db *Component) (*schema.Field, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	if stmt.Schema.PrioritizedPrimaryField == nil {
+		return nil, fmt.Errorf("egorm: pagination requires a single primary key on %s", stmt.Schema.Name)
+	}
+	return stmt.Schema.PrioritizedPrimaryField, nil
+}
+
+// hasOrderColumn 判断已有的ORDER BY中是否包含column
+func hasOrderColumn(db *Component, column string) bool {
+	c, ok := db.Statement.Clauses["ORDER BY"]
+	if !ok {
+		return false
+	}
+	orderBy, ok := c.Expression.(clause.OrderBy)
+	if !ok {
+		return false
+	}
+	for _, col := range orderBy.Columns {
+		for _, name := range strings.Split(col.Column.Name, ",") {
+			fields := strings.Fields(name)
+			if len(fields) == 0 {
+				continue
+			}
+			name = fields[0]
+			if i := strings.LastIndexByte(name, '.'); i >= 0 {
+				name = name[i+1:]
+			}
+			if strings.Trim(name, "`\"") == column {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Paginate 页码分页，db中可以带有查询条件和排序，排序中没有主键时会追加主键排序，保证翻页时顺序稳定
+//
+//	page, err := egorm.Paginate[User](db.WithContext(ctx).Where("status = ?", 1).Order("created_at desc"), egorm.PageRequest{Page: 2, PageSize: 20})
+func Paginate[T any](db *Component, req PageRequest) (*Page[T], error) {
+	pk, err := primaryField[T](db)
+	if err != nil {
+		return nil, err
+	}
+	size := pageSize(req.PageSize)
+	page := req.Page
+	if page <= 0 {
+		page = 1
+	}
+
+	tx := db.Model(new(T)).Session(&gorm.Session{})
+	ret := &Page[T]{List: make([]T, 0, size)}
+	if req.WithTotal {
+		if err := tx.Count(&ret.Total).Error; err != nil {
+			return nil, err
+		}
+		if ret.Total <= int64((page-1)*size) {
+			return ret, nil
+		}
+	}
+	if !hasOrderColumn(tx, pk.DBName) {
+		tx = tx.Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}})
+	}
+	if err := tx.Offset((page - 1) * size).Limit(size).Find(&ret.List).Error; err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// PaginateCursor 游标分页（keyset），db中可以带有查询条件，不能带有排序。
+// 排序字段为指针或者sql.NullXxx时可以为NULL，NULL视为最小值，升序时排在最前面，降序时排在最后面
+//
+//	page, err := egorm.PaginateCursor[User](db.WithContext(ctx).Where("status = ?", 1), egorm.CursorRequest{Cursor: cursor, Column: "created_at", Desc: true})
+func PaginateCursor[T any](db *Component, req CursorRequest) (*Page[T], error) {
+	pk, err := primaryField[T](db)
+	if err != nil {
+		return nil, err
+	}
+	size := pageSize(req.PageSize)
+	column := pk
+	if req.Column != "" && req.Column != pk.DBName {
+		column = pk.Schema.LookUpField(req.Column)
+		if column == nil {
+			return nil, fmt.Errorf("egorm: unknown cursor column %s on %s", req.Column, pk.Schema.Name)
+		}
+	}
+
+	tx := db.Model(new(T)).Session(&gorm.Session{})
+	if req.Cursor != "" {
+		values, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		tx, err = cursorCondition(tx, column, pk, values, req.Desc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	col := clause.Column{Table: clause.CurrentTable, Name: column.DBName}
+	pkCol := clause.Column{Table: clause.CurrentTable, Name: pk.DBName}
+	if nullableField(column) {
+		// NULL视为最小值，升序时排在最前面，降序时排在最后面，不依赖数据库对NULL的默认排序
+		dir := ""
+		if req.Desc {
+			dir = " DESC"
+		}
+		tx = tx.Clauses(clause.OrderBy{Expression: clause.Expr{
+			SQL:  fmt.Sprintf("CASE WHEN ? IS NULL THEN 0 ELSE 1 END%s,?%s,?%s", dir, dir, dir),
+			Vars: []interface{}{col, col, pkCol},
+		}})
+	} else {
+		tx = tx.Order(clause.OrderByColumn{Column: col, Desc: req.Desc})
+		if column != pk {
+			tx = tx.Order(clause.OrderByColumn{Column: pkCol, Desc: req.Desc})
+		}
+	}
+
+	// 多查一条判断是否有下一页
+	list := make([]T, 0, size+1)
+	if err := tx.Limit(size + 1).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	ret := &Page[T]{List: list}
+	if len(list) > size {
+		ret.List = list[:size]
+		last := reflect.ValueOf(&ret.List[size-1]).Elem()
+		values := []interface{}{}
+		if column != pk {
+			value, err := cursorFieldValue(column, last)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		value, err := cursorFieldValue(pk, last)
+		if err != nil {
+			return nil, err
+		}
+		if ret.NextCursor, err = encodeCursor(append(values, value)); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// nullableField 字段是否可能为NULL：指针或者sql.NullTime等实现了driver.Valuer的类型，并且没有not null标签。
+// 其他类型的字段读取时NULL会变成零值，这类排序字段在数据库中需要为NOT NULL
+func nullableField(field *schema.Field) bool {
+	if field.PrimaryKey || field.NotNull {
+		return false
+	}
+	return field.FieldType.Kind() == reflect.Ptr || field.FieldType.Implements(valuerType)
+}
+
+// cursorFieldValue 获取记录中字段在数据库中的值，指针为nil或者Valid为false的sql.NullXxx返回nil
+func cursorFieldValue(field *schema.Field, rv reflect.Value) (interface{}, error) {
+	value, _ := field.ValueOf(rv)
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+	value = v.Interface()
+	if valuer, ok := value.(driver.Valuer); ok {
+		return valuer.Value()
+	}
+	return value, nil
+}
+
+// cursorCondition 生成 (column, pk) 大于（倒序时小于）游标的条件，
+// 可以为NULL的字段按NULL最小处理，与PaginateCursor的排序一致
+func cursorCondition(tx *Component, column, pk *schema.Field, values []interface{}, desc bool) (*Component, error) {
+	after := func(field *schema.Field, value interface{}) clause.Expression {
+		col := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+		if desc {
+			return clause.Lt{Column: col, Value: value}
+		}
+		return clause.Gt{Column: col, Value: value}
+	}
+	if column == pk {
+		if len(values) != 1 || values[0] == nil {
+			return nil, ErrInvalidCursor
+		}
+		return tx.Where(after(pk, values[0])), nil
+	}
+	if len(values) != 2 || values[1] == nil {
+		return nil, ErrInvalidCursor
+	}
+	col := clause.Column{Table: clause.CurrentTable, Name: column.DBName}
+	// column相同时按主键翻页，游标的值为NULL时为 column IS NULL
+	tie := clause.And(clause.Eq{Column: col, Value: values[0]}, after(pk, values[1]))
+	switch {
+	case values[0] == nil && !nullableField(column):
+		return nil, ErrInvalidCursor
+	case values[0] == nil && !desc:
+		// 升序时NULL之后为所有有值的记录
+		return tx.Where(clause.Or(clause.Neq{Column: col, Value: nil}, tie)), nil
+	case values[0] == nil:
+		// 降序时NULL之后没有更小的值
+		return tx.Where(tie), nil
+	case desc && nullableField(column):
+		// 降序时比当前值小的记录之后为NULL的记录
+		return tx.Where(clause.Or(after(column, values[0]), tie, clause.Eq{Column: col, Value: nil})), nil
+	}
+	return tx.Where(clause.Or(after(column, values[0]), tie)), nil
+}
+
+// cursorValue 游标中带有类型的值，解码后按原类型绑定参数，时间不会按字符串比较
+type cursorValue struct {
+	Type  string          `json:"t"`
+	Value json.RawMessage `json:"v,omitempty"`
+}
+
+func encodeCursor(values []interface{}) (string, error) {
+	typed := make([]cursorValue, 0, len(values))
+	for _, value := range values {
+		var cv cursorValue
+		switch v := value.(type) {
+		case nil:
+			cv.Type = "null"
+		case time.Time:
+			cv.Type, value = "time", v.Format(time.RFC3339Nano)
+		case []byte:
+			cv.Type = "bytes"
+		default:
+			rv := reflect.ValueOf(v)
+			switch rv.Kind() {
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				cv.Type, value = "int", rv.Int()
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+				cv.Type, value = "uint", rv.Uint()
+			case reflect.Float32, reflect.Float64:
+				cv.Type, value = "float", rv.Float()
+			case reflect.String:
+				cv.Type, value = "string", rv.String()
+			case reflect.Bool:
+				cv.Type, value = "bool", rv.Bool()
+			default:
+				return "", fmt.Errorf("egorm: unsupported cursor value type %T", v)
+			}
+		}
+		if value != nil {
+			data, err := json.Marshal(value)
+			if err != nil {
+				return "", err
+			}
+			cv.Value = data
+		}
+		typed = append(typed, cv)
+	}
+	data, err := json.Marshal(typed)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(cursor string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var typed []cursorValue
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	values := make([]interface{}, 0, len(typed))
+	for _, cv := range typed {
+		var (
+			value interface{}
+			err   error
+		)
+		switch cv.Type {
+		case "null":
+		case "time":
+			var v string
+			if err = json.Unmarshal(cv.Value, &v); err == nil {
+				value, err = time.Parse(time.RFC3339Nano, v)
+			}
+		case "bytes":
+			var v []byte
+			err = json.Unmarshal(cv.Value, &v)
+			value = v
+		case "int":
+			var v int64
+			err = json.Unmarshal(cv.Value, &v)
+			value = v
+		case "uint":
+			var v uint64
+			err = json.Unmarshal(cv.Value, &v)
+			value = v
+		case "float":
+			var v float64
+			err = json.Unmarshal(cv.Value, &v)
+			value = v
+		case "string":
+			var v string
+			err = json.Unmarshal(cv.Value, &v)
+			value = v
+		case "bool":
+			var v bool
+			err = json.Unmarshal(cv.Value, &v)
+			value = v
+		default:
+			return nil, ErrInvalidCursor
+		}
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
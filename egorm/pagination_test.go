@@ -0,0 +1,151 @@
+package egorm
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestPaginate(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+
+	var sql string
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:sql", func(db *gorm.DB) {
+		sql = db.Statement.SQL.String()
+	}))
+
+	_, err = Paginate[project](db.Where("name = ?", "ego").Order("name desc"), PageRequest{Page: 3, PageSize: 10})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM `projects` WHERE name = ? ORDER BY name desc,`projects`.`id` LIMIT 10 OFFSET 20", sql)
+
+	_, err = Paginate[project](db.Order("id desc"), PageRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM `projects` ORDER BY id desc LIMIT 20", sql)
+
+	cursor, err := encodeCursor([]interface{}{"ego", int64(42)})
+	require.NoError(t, err)
+	_, err = PaginateCursor[project](db, CursorRequest{Cursor: cursor, Column: "name", Desc: true, PageSize: 5})
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM `projects` WHERE (`projects`.`name` < ? OR (`projects`.`name` = ? AND `projects`.`id` < ?)) ORDER BY `projects`.`name` DESC,`projects`.`id` DESC LIMIT 6", sql)
+
+	values, err := decodeCursor(cursor)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{"ego", int64(42)}, values)
+	_, err = PaginateCursor[project](db, CursorRequest{Cursor: "invalid"})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestCursorEncoding(t *testing.T) {
+	now := time.Date(2021, 6, 1, 8, 30, 0, 123456789, time.FixedZone("CST", 8*3600))
+	values := []interface{}{now, nil, int32(-3), uint8(7), 1.5, "ego", true, []byte("raw")}
+	cursor, err := encodeCursor(values)
+	require.NoError(t, err)
+	got, err := decodeCursor(cursor)
+	require.NoError(t, err)
+	require.Len(t, got, len(values))
+	// 时间解码为time.Time，按时间绑定参数
+	gotTime, ok := got[0].(time.Time)
+	require.True(t, ok)
+	assert.True(t, now.Equal(gotTime))
+	assert.Equal(t, []interface{}{nil, int64(-3), uint64(7), 1.5, "ego", true, []byte("raw")}, got[1:])
+
+	_, err = encodeCursor([]interface{}{struct{}{}})
+	assert.Error(t, err)
+	for _, cursor := range []string{"invalid", "W3sidCI6InRpbWUiLCJ2IjoiYWJjIn1d", "W3sidCI6Inh4In1d"} {
+		_, err = decodeCursor(cursor)
+		assert.ErrorIs(t, err, ErrInvalidCursor, cursor)
+	}
+}
+
+type article struct {
+	ID          int64
+	Title       string
+	PublishedAt *time.Time
+	Score       sql.NullInt64
+	CreatedAt   time.Time
+}
+
+func TestPaginateCursorNull(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&article{}))
+	base := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(hour int) *time.Time {
+		v := base.Add(time.Duration(hour) * time.Hour)
+		return &v
+	}
+	articles := []article{
+		{PublishedAt: at(2), Score: sql.NullInt64{Int64: 5, Valid: true}, CreatedAt: base.Add(3 * time.Hour)},
+		{CreatedAt: base.Add(time.Hour)},
+		{PublishedAt: at(1), CreatedAt: base.Add(2 * time.Hour)},
+		{Score: sql.NullInt64{Int64: 5, Valid: true}, CreatedAt: base.Add(time.Hour)},
+		{PublishedAt: at(2), Score: sql.NullInt64{Int64: 1, Valid: true}, CreatedAt: base.Add(3 * time.Hour)},
+		{CreatedAt: base.Add(4 * time.Hour)},
+	}
+	require.NoError(t, db.Create(&articles).Error)
+
+	// 每页2条翻完所有记录
+	all := func(req CursorRequest) []int64 {
+		ids := make([]int64, 0)
+		for i := 0; i < len(articles); i++ {
+			page, err := PaginateCursor[article](db, req)
+			require.NoError(t, err)
+			for _, a := range page.List {
+				ids = append(ids, a.ID)
+			}
+			if page.NextCursor == "" {
+				return ids
+			}
+			req.Cursor = page.NextCursor
+		}
+		t.Fatal("too many pages")
+		return nil
+	}
+	tests := []struct {
+		column string
+		desc   bool
+		ids    []int64
+	}{
+		{column: "published_at", ids: []int64{2, 4, 6, 3, 1, 5}},
+		{column: "published_at", desc: true, ids: []int64{5, 1, 3, 6, 4, 2}},
+		{column: "score", ids: []int64{2, 3, 6, 5, 1, 4}},
+		{column: "score", desc: true, ids: []int64{4, 1, 5, 6, 3, 2}},
+		{column: "created_at", ids: []int64{2, 4, 3, 1, 5, 6}},
+		{column: "created_at", desc: true, ids: []int64{6, 5, 1, 3, 4, 2}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.ids, all(CursorRequest{Column: tt.column, Desc: tt.desc, PageSize: 2}), "%s desc %v", tt.column, tt.desc)
+	}
+
+	// 时间游标按time.Time绑定
+	dry := db.Session(&gorm.Session{DryRun: true})
+	cursor, err := encodeCursor([]interface{}{base, int64(1)})
+	require.NoError(t, err)
+	parsed := &gorm.Statement{DB: db}
+	require.NoError(t, parsed.Parse(&article{}))
+	tx, err := cursorCondition(dry.Model(&article{}), parsed.Schema.LookUpField("created_at"), parsed.Schema.PrioritizedPrimaryField, mustDecodeCursor(t, cursor), false)
+	require.NoError(t, err)
+	stmt := tx.Find(&[]article{}).Statement
+	require.NotEmpty(t, stmt.Vars)
+	assert.IsType(t, time.Time{}, stmt.Vars[0])
+
+	// 不能为NULL的字段游标值不能为NULL
+	cursor, err = encodeCursor([]interface{}{nil, int64(1)})
+	require.NoError(t, err)
+	_, err = PaginateCursor[article](db, CursorRequest{Column: "created_at", Cursor: cursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func mustDecodeCursor(t *testing.T, cursor string) []interface{} {
+	values, err := decodeCursor(cursor)
+	require.NoError(t, err)
+	return values
+}
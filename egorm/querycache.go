@@ -0,0 +1,315 @@
+package egorm
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+)
+
+// QueryCacheStore 查询缓存的存储，*eredis.Component 实现了该接口
+type QueryCacheStore interface {
+	Get(ctx context.Context, key string) (string, error)
+	GetBytes(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value interface{}, expire time.Duration) error
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+type queryCacheKey struct{}
+
+// WithCache 返回开启查询缓存的context，ttl小于等于0时使用WithQueryCache设置的默认过期时间
+//
+//	db.WithContext(egorm.WithCache(ctx, time.Minute)).Where("status = ?", 1).Find(&users)
+func WithCache(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, queryCacheKey{}, ttl)
+}
+
+func cacheTTL(ctx context.Context) (time.Duration, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	ttl, ok := ctx.Value(queryCacheKey{}).(time.Duration)
+	return ttl, ok
+}
+
+// queryCacheEntry 缓存的查询结果
+type queryCacheEntry struct {
+	RowsAffected int64           `json:"rowsAffected"`
+	Dest         json.RawMessage `json:"dest"`
+}
+
+// queryCache 缓存SELECT结果，写入表时递增表的版本号，使该表的缓存全部失效
+type queryCache struct {
+	store  QueryCacheStore
+	ttl    time.Duration
+	logger *elog.Component
+}
+
+// Name 插件名称
+func (c *queryCache) Name() string {
+	return "egorm:query_cache"
+}
+
+// Initialize 包装gorm:query，注册写入后使缓存失效的回调。
+// 连接池被包装为queryCachePool，事务中的写入在提交后才使缓存失效
+func (c *queryCache) Initialize(db *gorm.DB) error {
+	pool := &queryCachePool{ConnPool: db.ConnPool, cache: c}
+	db.ConnPool = pool
+	db.Statement.ConnPool = pool
+	if err := db.Callback().Query().Replace("gorm:query", c.query(db.Callback().Query().Get("gorm:query"))); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("egorm:query_cache", c.invalidate); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("egorm:query_cache", c.invalidate); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().After("gorm:delete").Register("egorm:query_cache", c.invalidate); err != nil {
+		return err
+	}
+	return db.Callback().Raw().After("gorm:raw").Register("egorm:query_cache", c.invalidateRaw)
+}
+
+func (c *queryCache) query(next func(*gorm.DB)) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		ttl, ok := cacheTTL(db.Statement.Context)
+		if !ok || db.Error != nil || db.Statement.Table == "" {
+			next(db)
+			return
+		}
+		if ttl <= 0 {
+			ttl = c.ttl
+		}
+
+		callbacks.BuildQuerySQL(db)
+		if db.Error != nil || db.DryRun {
+			next(db)
+			return
+		}
+		if !cacheable(db) {
+			next(db)
+			return
+		}
+		ctx := db.Statement.Context
+		key, err := c.key(ctx, db)
+		if err != nil {
+			c.logger.Warn("query cache key", elog.FieldErr(err))
+			next(db)
+			return
+		}
+		if c.load(ctx, db, key) {
+			return
+		}
+
+		next(db)
+		if db.Error != nil {
+			return
+		}
+		dest, err := json.Marshal(db.Statement.Dest)
+		if err != nil {
+			c.logger.Warn("query cache marshal", elog.FieldErr(err))
+			return
+		}
+		entry, _ := json.Marshal(queryCacheEntry{RowsAffected: db.RowsAffected, Dest: dest})
+		if err := c.store.Set(ctx, key, entry, ttl); err != nil {
+			c.logger.Warn("query cache set", elog.FieldErr(err))
+		}
+	}
+}
+
+// cacheable 事务中的查询可能读到未提交的数据，联表查询的结果依赖其他表的写入，都不读写缓存
+func cacheable(db *gorm.DB) bool {
+	if _, ok := db.Statement.ConnPool.(*queryCacheTx); ok {
+		return false
+	}
+	if len(db.Statement.Joins) > 0 {
+		return false
+	}
+	// Table("a, b")、Table("a JOIN b ON ...")、Table("(?) AS t", subQuery)
+	if expr := db.Statement.TableExpr; expr != nil && (strings.ContainsAny(expr.SQL, " ,") || len(expr.Vars) > 0) {
+		return false
+	}
+	if c, ok := db.Statement.Clauses["FROM"]; ok {
+		if from, ok := c.Expression.(clause.From); ok && (len(from.Joins) > 0 || len(from.Tables) > 1) {
+			return false
+		}
+	}
+	return true
+}
+
+// load 命中缓存时将结果写入Dest
+func (c *queryCache) load(ctx context.Context, db *gorm.DB, key string) bool {
+	data, err := c.store.GetBytes(ctx, key)
+	if err != nil || len(data) == 0 {
+		return false
+	}
+	var entry queryCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(entry.Dest, db.Statement.Dest); err != nil {
+		return false
+	}
+	db.RowsAffected = entry.RowsAffected
+	return true
+}
+
+// key 缓存key由表名、表的版本号、结果类型、SQL和参数组成
+func (c *queryCache) key(ctx context.Context, db *gorm.DB) (string, error) {
+	version, err := c.store.Get(ctx, tableVersionKey(db.Statement.Table))
+	if err != nil || version == "" {
+		version = "0"
+	}
+	vars, err := json.Marshal(db.Statement.Vars)
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum([]byte(fmt.Sprintf("%T|%s|%s", db.Statement.Dest, db.Statement.SQL.String(), vars)))
+	return fmt.Sprintf("egorm:cache:%s:%s:%x", db.Statement.Table, version, sum), nil
+}
+
+// invalidate 写入成功后使表的缓存失效
+func (c *queryCache) invalidate(db *gorm.DB) {
+	if db.Error != nil || db.DryRun || db.Statement.Table == "" {
+		return
+	}
+	c.invalidateTables(db, db.Statement.Table)
+}
+
+// rawWriteTablePattern 匹配原生SQL中写入的表名，多表UPDATE、DELETE只识别第一张表
+var rawWriteTablePattern = regexp.MustCompile("(?i)^\\s*(?:INSERT\\s+(?:IGNORE\\s+)?INTO|REPLACE\\s+INTO|UPDATE(?:\\s+IGNORE)?|DELETE\\s+FROM|TRUNCATE(?:\\s+TABLE)?|ALTER\\s+TABLE|DROP\\s+TABLE(?:\\s+IF\\s+EXISTS)?)\\s+([^\\s(,;]+)")
+
+// invalidateRaw 原生SQL（Exec）写入成功后，使SQL中写入的表的缓存失效
+func (c *queryCache) invalidateRaw(db *gorm.DB) {
+	if db.Error != nil || db.DryRun {
+		return
+	}
+	tables := make([]string, 0, 2)
+	if db.Statement.Table != "" {
+		tables = append(tables, db.Statement.Table)
+	}
+	if m := rawWriteTablePattern.FindStringSubmatch(db.Statement.SQL.String()); m != nil {
+		table := m[1]
+		if i := strings.LastIndexByte(table, '.'); i >= 0 {
+			table = table[i+1:]
+		}
+		tables = append(tables, strings.Trim(table, "`\"[]"))
+	}
+	c.invalidateTables(db, tables...)
+}
+
+// invalidateTables 递增表的版本号，事务中的写入记录到事务里，提交后再递增，
+// 避免提交前其他请求读到旧数据并以新版本号写入缓存
+func (c *queryCache) invalidateTables(db *gorm.DB, tables ...string) {
+	if tx, ok := db.Statement.ConnPool.(*queryCacheTx); ok {
+		tx.add(tables...)
+		return
+	}
+	for _, table := range tables {
+		c.incr(db.Statement.Context, table)
+	}
+}
+
+func (c *queryCache) incr(ctx context.Context, table string) {
+	if _, err := c.store.Incr(ctx, tableVersionKey(table)); err != nil {
+		c.logger.Error("query cache invalidate", elog.FieldErr(err), elog.String("table", table))
+	}
+}
+
+// queryCachePool 开启事务时返回queryCacheTx
+type queryCachePool struct {
+	gorm.ConnPool
+	cache *queryCache
+}
+
+// BeginTx 开启事务，与gorm.DB.Begin一样支持*sql.DB和其他连接池
+func (p *queryCachePool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	var tx gorm.ConnPool
+	switch beginner := p.ConnPool.(type) {
+	case gorm.TxBeginner:
+		sqlTx, err := beginner.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		tx = sqlTx
+	case gorm.ConnPoolBeginner:
+		poolTx, err := beginner.BeginTx(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		tx = poolTx
+	default:
+		return nil, gorm.ErrInvalidTransaction
+	}
+	return &queryCacheTx{ConnPool: tx, cache: p.cache, tables: make(map[string]struct{})}, nil
+}
+
+// GetDBConn 返回*sql.DB，用于gorm.DB.DB()
+func (p *queryCachePool) GetDBConn() (*sql.DB, error) {
+	switch pool := p.ConnPool.(type) {
+	case gorm.GetDBConnector:
+		return pool.GetDBConn()
+	case *sql.DB:
+		return pool, nil
+	}
+	return nil, gorm.ErrInvalidDB
+}
+
+// queryCacheTx 记录事务中写入的表，提交成功后使缓存失效，回滚时不需要失效
+type queryCacheTx struct {
+	gorm.ConnPool
+	cache *queryCache
+
+	mu     sync.Mutex
+	tables map[string]struct{}
+}
+
+func (tx *queryCacheTx) add(tables ...string) {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	for _, table := range tables {
+		tx.tables[table] = struct{}{}
+	}
+}
+
+// Commit 提交事务后递增事务中写入的表的版本号
+func (tx *queryCacheTx) Commit() error {
+	committer, ok := tx.ConnPool.(gorm.TxCommitter)
+	if !ok {
+		return gorm.ErrInvalidTransaction
+	}
+	if err := committer.Commit(); err != nil {
+		return err
+	}
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	for table := range tx.tables {
+		// 事务的context可能已经结束，失效使用新的context
+		tx.cache.incr(context.Background(), table)
+	}
+	return nil
+}
+
+// Rollback 回滚事务
+func (tx *queryCacheTx) Rollback() error {
+	committer, ok := tx.ConnPool.(gorm.TxCommitter)
+	if !ok {
+		return gorm.ErrInvalidTransaction
+	}
+	return committer.Rollback()
+}
+
+func tableVersionKey(table string) string {
+	return "egorm:cache:version:" + table
+}
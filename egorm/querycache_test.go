@@ -0,0 +1,209 @@
+package egorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+type memoryCacheStore map[string]string
+
+func (m memoryCacheStore) Get(ctx context.Context, key string) (string, error) {
+	value, ok := m[key]
+	if !ok {
+		return "", errors.New("nil")
+	}
+	return value, nil
+}
+
+func (m memoryCacheStore) GetBytes(ctx context.Context, key string) ([]byte, error) {
+	value, err := m.Get(ctx, key)
+	return []byte(value), err
+}
+
+func (m memoryCacheStore) Set(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	m[key] = string(value.([]byte))
+	return nil
+}
+
+func (m memoryCacheStore) Incr(ctx context.Context, key string) (int64, error) {
+	n, _ := strconv.ParseInt(m[key], 10, 64)
+	m[key] = strconv.FormatInt(n+1, 10)
+	return n + 1, nil
+}
+
+func TestQueryCache(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	queries := 0
+	require.NoError(t, db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) {
+		callbacks.BuildQuerySQL(db)
+		queries++
+		*db.Statement.Dest.(*[]project) = []project{{ID: 1, Name: "ego"}}
+		db.RowsAffected = 1
+	}))
+	require.NoError(t, db.Callback().Update().Replace("gorm:update", func(db *gorm.DB) {}))
+	require.NoError(t, db.Use(&queryCache{store: memoryCacheStore{}, ttl: time.Minute, logger: elog.DefaultLogger}))
+
+	ctx := WithCache(context.Background(), 0)
+	for i := 0; i < 2; i++ {
+		var projects []project
+		tx := db.WithContext(ctx).Where("name = ?", "ego").Find(&projects)
+		assert.NoError(t, tx.Error)
+		assert.Equal(t, int64(1), tx.RowsAffected)
+		assert.Equal(t, []project{{ID: 1, Name: "ego"}}, projects)
+	}
+	assert.Equal(t, 1, queries)
+
+	// 没有开启缓存的查询不读缓存
+	var projects []project
+	db.Where("name = ?", "ego").Find(&projects)
+	assert.Equal(t, 2, queries)
+
+	// 写入后该表的缓存失效
+	require.NoError(t, db.Model(&project{ID: 1}).Update("name", "ego2").Error)
+	db.WithContext(ctx).Where("name = ?", "ego").Find(&projects)
+	assert.Equal(t, 3, queries)
+}
+
+// fakeTxPool 不连接数据库的连接池，Exec直接返回成功
+type fakeTxPool struct {
+	committed bool
+}
+
+func (p *fakeTxPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *fakeTxPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return driverResult{}, nil
+}
+
+func (p *fakeTxPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *fakeTxPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func (p *fakeTxPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	return &fakePoolTx{fakeTxPool: p}, nil
+}
+
+// fakePoolTx fakeTxPool开启的事务
+type fakePoolTx struct {
+	*fakeTxPool
+}
+
+func (tx *fakePoolTx) Commit() error {
+	tx.committed = true
+	return nil
+}
+
+func (tx *fakePoolTx) Rollback() error {
+	return nil
+}
+
+type driverResult struct{}
+
+func (driverResult) LastInsertId() (int64, error) { return 0, nil }
+func (driverResult) RowsAffected() (int64, error) { return 1, nil }
+
+func TestQueryCacheInvalidate(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	pool := &fakeTxPool{}
+	db.ConnPool = pool
+	db.Statement.ConnPool = pool
+	require.NoError(t, db.Callback().Update().Replace("gorm:update", func(db *gorm.DB) {}))
+	store := memoryCacheStore{}
+	require.NoError(t, db.Use(&queryCache{store: store, ttl: time.Minute, logger: elog.DefaultLogger}))
+	version := tableVersionKey("projects")
+
+	// 事务中的写入在提交后才使缓存失效
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&project{ID: 1}).Update("name", "ego").Error; err != nil {
+			return err
+		}
+		assert.Empty(t, store[version], "invalidated before commit")
+		return nil
+	})
+	require.NoError(t, err)
+	assert.True(t, pool.committed)
+	assert.Equal(t, "1", store[version])
+
+	// 回滚的事务不使缓存失效
+	_ = db.Transaction(func(tx *gorm.DB) error {
+		tx.Model(&project{ID: 1}).Update("name", "ego")
+		return errors.New("rollback")
+	})
+	assert.Equal(t, "1", store[version])
+
+	// 原生SQL写入后使SQL中的表的缓存失效
+	require.NoError(t, db.Exec("UPDATE `projects` SET name = ?", "ego").Error)
+	assert.Equal(t, "2", store[version])
+	require.NoError(t, db.Exec("insert into test.projects (name) values (?)", "ego").Error)
+	assert.Equal(t, "3", store[version])
+	require.NoError(t, db.Exec("SELECT 1").Error)
+	assert.Equal(t, "3", store[version])
+
+	// 连接池被包装后仍然可以获取*sql.DB
+	sqlDB, err := sql.Open("mysql", "root@tcp(127.0.0.1:3306)/test")
+	require.NoError(t, err)
+	got, err := (&queryCachePool{ConnPool: sqlDB}).GetDBConn()
+	require.NoError(t, err)
+	assert.Same(t, sqlDB, got)
+}
+
+func TestQueryCacheBypass(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	pool := &fakeTxPool{}
+	db.ConnPool = pool
+	db.Statement.ConnPool = pool
+	queries := 0
+	require.NoError(t, db.Callback().Query().Replace("gorm:query", func(db *gorm.DB) {
+		callbacks.BuildQuerySQL(db)
+		queries++
+		*db.Statement.Dest.(*[]project) = []project{{ID: 1, Name: "ego"}}
+		db.RowsAffected = 1
+	}))
+	store := memoryCacheStore{}
+	require.NoError(t, db.Use(&queryCache{store: store, ttl: time.Minute, logger: elog.DefaultLogger}))
+	ctx := WithCache(context.Background(), 0)
+
+	// 事务中的查询不读写缓存，回滚后不会读到未提交的数据
+	_ = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for i := 0; i < 2; i++ {
+			var projects []project
+			require.NoError(t, tx.Where("name = ?", "ego").Find(&projects).Error)
+		}
+		return errors.New("rollback")
+	})
+	assert.Equal(t, 2, queries)
+	assert.Empty(t, store)
+
+	// 联表查询不缓存
+	for i := 0; i < 2; i++ {
+		var projects []project
+		require.NoError(t, db.WithContext(ctx).Joins("JOIN owners ON owners.id = projects.owner_id").Find(&projects).Error)
+		require.NoError(t, db.WithContext(ctx).Table("projects, owners").Find(&projects).Error)
+	}
+	assert.Equal(t, 6, queries)
+	assert.Empty(t, store)
+
+	var projects []project
+	require.NoError(t, db.WithContext(ctx).Where("name = ?", "ego").Find(&projects).Error)
+	assert.Len(t, store, 1)
+}
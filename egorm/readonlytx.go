@@ -0,0 +1,74 @@
+package egorm
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const readOnlyTxPluginName = "egorm:read_only_tx"
+
+// readOnlyTx 保存只读事务的配置，注册为插件后ReadOnlyTx可以通过db.Config.Plugins获取
+type readOnlyTx struct {
+	isolation sql.IsolationLevel
+}
+
+func newReadOnlyTx(isolation string) (*readOnlyTx, error) {
+	level, err := parseIsolationLevel(isolation)
+	if err != nil {
+		return nil, err
+	}
+	return &readOnlyTx{isolation: level}, nil
+}
+
+// Name 插件名称
+func (p *readOnlyTx) Name() string {
+	return readOnlyTxPluginName
+}
+
+// Initialize 不需要注册回调
+func (p *readOnlyTx) Initialize(db *gorm.DB) error {
+	return nil
+}
+
+// ReadOnlyTx 在只读事务中执行fn，隔离级别使用配置中的ReadOnlyTxIsolation，
+// 适用于报表等需要多次查询结果一致的场景，事务中的写操作会被数据库拒绝
+//
+//	err := egorm.ReadOnlyTx(ctx, db, func(tx *egorm.Component) error {
+//		if err := tx.Model(&Order{}).Count(&total).Error; err != nil {
+//			return err
+//		}
+//		return tx.Find(&orders).Error
+//	})
+func ReadOnlyTx(ctx context.Context, db *Component, fn func(tx *Component) error) error {
+	opts := &sql.TxOptions{ReadOnly: true}
+	if plugin, ok := db.Config.Plugins[readOnlyTxPluginName].(*readOnlyTx); ok {
+		opts.Isolation = plugin.isolation
+	}
+	return db.WithContext(ctx).Transaction(fn, opts)
+}
+
+// parseIsolationLevel 解析隔离级别，如read committed、repeatable_read，为空时使用数据库的默认隔离级别
+func parseIsolationLevel(isolation string) (sql.IsolationLevel, error) {
+	name := strings.ToLower(strings.NewReplacer("_", " ", "-", " ").Replace(strings.TrimSpace(isolation)))
+	if name == "" {
+		return sql.LevelDefault, nil
+	}
+	for _, level := range []sql.IsolationLevel{
+		sql.LevelReadUncommitted,
+		sql.LevelReadCommitted,
+		sql.LevelWriteCommitted,
+		sql.LevelRepeatableRead,
+		sql.LevelSnapshot,
+		sql.LevelSerializable,
+		sql.LevelLinearizable,
+	} {
+		if strings.ToLower(level.String()) == name {
+			return level, nil
+		}
+	}
+	return sql.LevelDefault, fmt.Errorf("egorm: unknown isolation level %q", isolation)
+}
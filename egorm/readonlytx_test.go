@@ -0,0 +1,70 @@
+package egorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type txConn struct {
+	fakeConn
+	opts driver.TxOptions
+}
+
+func (c *txConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.opts = opts
+	return fakeTx{}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type txConnector struct {
+	conn *txConn
+}
+
+func (c txConnector) Connect(ctx context.Context) (driver.Conn, error) { return c.conn, nil }
+func (c txConnector) Driver() driver.Driver                            { return nil }
+
+func TestReadOnlyTx(t *testing.T) {
+	conn := &txConn{}
+	sqlDB := sql.OpenDB(txConnector{conn: conn})
+	defer sqlDB.Close()
+	db, err := gorm.Open(mysql.New(mysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+
+	plugin, err := newReadOnlyTx("repeatable_read")
+	require.NoError(t, err)
+	require.NoError(t, db.Use(plugin))
+
+	errFn := errors.New("fn error")
+	assert.ErrorIs(t, ReadOnlyTx(context.Background(), db, func(tx *Component) error { return errFn }), errFn)
+	assert.True(t, conn.opts.ReadOnly)
+	assert.Equal(t, driver.IsolationLevel(sql.LevelRepeatableRead), conn.opts.Isolation)
+
+	_, err = newReadOnlyTx("unknown")
+	assert.Error(t, err)
+}
+
+func TestParseIsolationLevel(t *testing.T) {
+	level, err := parseIsolationLevel("")
+	assert.NoError(t, err)
+	assert.Equal(t, sql.LevelDefault, level)
+
+	level, err = parseIsolationLevel("Read Committed")
+	assert.NoError(t, err)
+	assert.Equal(t, sql.LevelReadCommitted, level)
+
+	level, err = parseIsolationLevel("serializable")
+	assert.NoError(t, err)
+	assert.Equal(t, sql.LevelSerializable, level)
+}
@@ -0,0 +1,86 @@
+package egorm
+
+import (
+	"time"
+
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"gorm.io/plugin/dbresolver"
+)
+
+// poolConfig 支持热更新的连接池配置
+type poolConfig struct {
+	MaxIdleConns    int
+	MaxOpenConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// pool 返回当前的连接池配置，配置热更新时会修改，读取时需要加锁
+func (c *config) pool() poolConfig {
+	c.poolMu.RLock()
+	defer c.poolMu.RUnlock()
+	return poolConfig{
+		MaxIdleConns:    c.MaxIdleConns,
+		MaxOpenConns:    c.MaxOpenConns,
+		ConnMaxLifetime: c.ConnMaxLifetime,
+	}
+}
+
+// onConfChange 配置变更时将连接池配置应用到正在使用的连接池，其他配置需要重启生效
+// econf不支持取消回调，组件Close后回调仍会被调用，此时忽略变更
+func (c *Container) onConfChange(component *Component) func(conf *econf.Configuration) {
+	return func(conf *econf.Configuration) {
+		if isClosed(component) {
+			return
+		}
+		// 加写锁，避免多次变更并发应用时，连接池与保存的配置不一致
+		c.config.poolMu.Lock()
+		defer c.config.poolMu.Unlock()
+		current := poolConfig{
+			MaxIdleConns:    c.config.MaxIdleConns,
+			MaxOpenConns:    c.config.MaxOpenConns,
+			ConnMaxLifetime: c.config.ConnMaxLifetime,
+		}
+		pool := current
+		if err := conf.UnmarshalKey(c.name, &pool); err != nil {
+			c.logger.Error("reload pool config", elog.FieldErr(err))
+			return
+		}
+		if pool == current {
+			return
+		}
+		if err := applyPoolConfig(component, pool); err != nil {
+			c.logger.Error("reload pool config", elog.FieldErr(err))
+			return
+		}
+		c.logger.Info("reload pool config",
+			elog.Int("maxIdleConns", pool.MaxIdleConns),
+			elog.Int("maxOpenConns", pool.MaxOpenConns),
+			elog.Duration("connMaxLifetime", pool.ConnMaxLifetime),
+		)
+		c.config.MaxIdleConns = pool.MaxIdleConns
+		c.config.MaxOpenConns = pool.MaxOpenConns
+		c.config.ConnMaxLifetime = pool.ConnMaxLifetime
+	}
+}
+
+// applyPoolConfig 设置主库和读写分离中所有库的连接池
+func applyPoolConfig(component *Component, pool poolConfig) error {
+	sqlDB, err := component.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxIdleConns(pool.MaxIdleConns)
+	sqlDB.SetMaxOpenConns(pool.MaxOpenConns)
+	if pool.ConnMaxLifetime != 0 {
+		sqlDB.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+	if resolver, ok := component.Config.Plugins["gorm:db_resolver"].(*dbresolver.DBResolver); ok {
+		resolver.SetMaxIdleConns(pool.MaxIdleConns)
+		resolver.SetMaxOpenConns(pool.MaxOpenConns)
+		if pool.ConnMaxLifetime != 0 {
+			resolver.SetConnMaxLifetime(pool.ConnMaxLifetime)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package egorm
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestOnConfChange(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+	c := DefaultContainer()
+	c.name = "mysql.test"
+	c.logger = elog.DefaultLogger
+
+	conf := econf.New()
+	require.NoError(t, conf.Load([]byte(`
+[mysql.test]
+   maxOpenConns = 20
+   maxIdleConns = 5
+`), toml.Unmarshal))
+	c.onConfChange(db)(conf)
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	assert.Equal(t, 20, sqlDB.Stats().MaxOpenConnections)
+	assert.Equal(t, 20, c.config.MaxOpenConns)
+	assert.Equal(t, 5, c.config.MaxIdleConns)
+}
+
+func TestOnConfChangeAfterClose(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(newCloser()))
+	c := DefaultContainer()
+	c.name = "mysql.test"
+	c.logger = elog.DefaultLogger
+	require.NoError(t, Close(db))
+
+	// Close后回调没有取消，配置变更时忽略
+	conf := econf.New()
+	require.NoError(t, conf.Load([]byte(`
+[mysql.test]
+   maxOpenConns = 20
+`), toml.Unmarshal))
+	c.onConfChange(db)(conf)
+	assert.Equal(t, 100, c.config.MaxOpenConns)
+}
+
+func TestOnConfChangeConcurrent(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DisableAutomaticPing: true})
+	require.NoError(t, err)
+	c := DefaultContainer()
+	c.name = "mysql.test"
+	c.logger = elog.DefaultLogger
+
+	// 配置变更与读取连接池配置并发执行，使用-race检测
+	var wg sync.WaitGroup
+	for i := 1; i <= 10; i++ {
+		conf := econf.New()
+		require.NoError(t, conf.Load([]byte(fmt.Sprintf(`
+[mysql.test]
+   maxOpenConns = %d
+`, i*10)), toml.Unmarshal))
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			c.onConfChange(db)(conf)
+		}()
+		go func() {
+			defer wg.Done()
+			_ = c.config.pool()
+		}()
+	}
+	wg.Wait()
+
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	assert.Equal(t, c.config.pool().MaxOpenConns, sqlDB.Stats().MaxOpenConnections)
+}
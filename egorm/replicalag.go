@@ -0,0 +1,286 @@
+package egorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/gotomicro/ego-component/egorm/manager"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/gotomicro/ego/core/emetric"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/plugin/dbresolver"
+)
+
+// replicaLagGauge 读库复制延迟
+var replicaLagGauge = emetric.GaugeVecOpts{
+	Namespace: emetric.DefaultNamespace,
+	Name:      "gorm_replica_lag_seconds",
+	Help:      "Replication lag of gorm replicas, -1 if lag check failed",
+	Labels:    []string{"name", "replica"},
+}.Build()
+
+// lagUnknown 检测失败时的延迟，视为超过任意阈值
+const lagUnknown = time.Duration(math.MaxInt64)
+
+// lagMonitor 定期检测一组读库的复制延迟，读库顺序与resolver配置中的Replicas相同
+type lagMonitor struct {
+	compName string
+	rc       resolverConfig
+	parser   manager.DSNParser
+	// dialector 创建检测读库使用的Dialector，开启凭证时替换DSN中的占位符
+	dialector func(dsn string) gorm.Dialector
+	logger    *elog.Component
+	addrs     []string
+	dbs       []*gorm.DB
+	legacy    []bool  // 读库不支持SHOW REPLICA STATUS，每个下标只在检测该读库的goroutine中读写
+	lags      []int64 // time.Duration，原子读写
+}
+
+func newLagMonitor(compName string, rc resolverConfig, parser manager.DSNParser, dialector func(dsn string) gorm.Dialector, logger *elog.Component) *lagMonitor {
+	m := &lagMonitor{
+		compName:  compName,
+		rc:        rc,
+		parser:    parser,
+		dialector: dialector,
+		logger:    logger,
+		addrs:     make([]string, len(rc.Replicas)),
+		dbs:       make([]*gorm.DB, len(rc.Replicas)),
+		legacy:    make([]bool, len(rc.Replicas)),
+		lags:      make([]int64, len(rc.Replicas)),
+	}
+	for i, dsn := range rc.Replicas {
+		m.addrs[i] = strconv.Itoa(i)
+		if cfg, err := parser.ParseDSN(dsn); err == nil {
+			m.addrs[i] = cfg.Addr
+		}
+	}
+	return m
+}
+
+// run 定期检测所有读库的复制延迟，done关闭后等待正在进行的检测结束，关闭检测使用的连接后退出
+func (m *lagMonitor) run(done <-chan struct{}) {
+	interval := m.rc.LagCheckInterval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	defer m.close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		var wg sync.WaitGroup
+		for i := range m.rc.Replicas {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				m.check(ctx, i, interval)
+			}(i)
+		}
+		wg.Wait()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// close 关闭检测使用的连接
+func (m *lagMonitor) close() {
+	for i, db := range m.dbs {
+		if db == nil {
+			continue
+		}
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+		m.dbs[i] = nil
+	}
+}
+
+func (m *lagMonitor) check(ctx context.Context, i int, timeout time.Duration) {
+	lag, err := m.measure(ctx, i, timeout)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		m.logger.Warn("check replica lag", elog.FieldErr(err), elog.FieldAddr(m.addrs[i]))
+		atomic.StoreInt64(&m.lags[i], int64(lagUnknown))
+		replicaLagGauge.Set(-1, m.compName, m.addrs[i])
+		return
+	}
+	atomic.StoreInt64(&m.lags[i], int64(lag))
+	replicaLagGauge.Set(lag.Seconds(), m.compName, m.addrs[i])
+}
+
+// measure 使用心跳表或复制状态中的Seconds_Behind_Source（8.0.22之前为Seconds_Behind_Master）获取复制延迟
+func (m *lagMonitor) measure(ctx context.Context, i int, timeout time.Duration) (time.Duration, error) {
+	if m.dbs[i] == nil {
+		db, err := gorm.Open(m.dialector(m.rc.Replicas[i]), &gorm.Config{Logger: logger.Discard})
+		if err != nil {
+			return 0, err
+		}
+		sqlDB, err := db.DB()
+		if err != nil {
+			return 0, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+		m.dbs[i] = db
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	db := m.dbs[i].WithContext(ctx)
+
+	if m.rc.HeartbeatTable != "" {
+		var micros sql.NullInt64
+		err := db.Raw(fmt.Sprintf("SELECT TIMESTAMPDIFF(MICROSECOND, MAX(ts), UTC_TIMESTAMP(6)) FROM %s", m.rc.HeartbeatTable)).Row().Scan(&micros)
+		if err != nil {
+			return 0, err
+		}
+		if !micros.Valid {
+			return 0, fmt.Errorf("egorm: heartbeat table %s is empty", m.rc.HeartbeatTable)
+		}
+		return time.Duration(micros.Int64) * time.Microsecond, nil
+	}
+
+	// MySQL 8.0.22开始使用SHOW REPLICA STATUS，SHOW SLAVE STATUS在8.4中被移除，旧版本执行失败时改用SHOW SLAVE STATUS
+	var (
+		rows *sql.Rows
+		err  error
+	)
+	if !m.legacy[i] {
+		rows, err = db.Raw("SHOW REPLICA STATUS").Rows()
+		if err != nil && ctx.Err() == nil && isSyntaxError(err) {
+			m.legacy[i] = true
+		}
+	}
+	if m.legacy[i] {
+		rows, err = db.Raw("SHOW SLAVE STATUS").Rows()
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	return replicaLag(rows)
+}
+
+// isSyntaxError MySQL的语法错误，错误码1064
+func isSyntaxError(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == 1064
+}
+
+// replicaLag 从复制状态中读取延迟，不是从库时返回0
+func replicaLag(rows *sql.Rows) (time.Duration, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		// 不是从库
+		return 0, rows.Err()
+	}
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for j := range values {
+		dest[j] = &values[j]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	for j, column := range columns {
+		if column != "Seconds_Behind_Source" && column != "Seconds_Behind_Master" {
+			continue
+		}
+		if !values[j].Valid {
+			return 0, fmt.Errorf("egorm: replication is not running")
+		}
+		seconds, err := strconv.ParseInt(values[j].String, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, fmt.Errorf("egorm: Seconds_Behind_Source not found")
+}
+
+// healthy 返回复制延迟没有超过MaxReplicationLag的读库下标
+func (m *lagMonitor) healthy() []int {
+	ret := make([]int, 0, len(m.lags))
+	for i := range m.lags {
+		if time.Duration(atomic.LoadInt64(&m.lags[i])) <= m.rc.MaxReplicationLag {
+			ret = append(ret, i)
+		}
+	}
+	return ret
+}
+
+// lagAwarePolicy 只在复制延迟没有超过阈值的读库中选择
+type lagAwarePolicy struct {
+	base    dbresolver.Policy
+	monitor *lagMonitor
+}
+
+func (p *lagAwarePolicy) Resolve(connPools []gorm.ConnPool) gorm.ConnPool {
+	healthy := p.monitor.healthy()
+	if len(healthy) == 0 || len(connPools) != len(p.monitor.lags) {
+		return p.base.Resolve(connPools)
+	}
+	pools := make([]gorm.ConnPool, 0, len(healthy))
+	for _, i := range healthy {
+		pools = append(pools, connPools[i])
+	}
+	return p.base.Resolve(pools)
+}
+
+// lagRouter 所有读库的复制延迟都超过阈值时读写库
+type lagRouter struct {
+	tables   map[string]*lagMonitor // 配置了Tables的resolver，没有开启检测时为nil
+	fallback *lagMonitor            // 默认resolver
+}
+
+func (r *lagRouter) route(db *gorm.DB) {
+	monitor, ok := r.tables[db.Statement.Table]
+	if !ok {
+		monitor = r.fallback
+	}
+	if monitor != nil && len(monitor.healthy()) == 0 {
+		db.Statement.AddClause(dbresolver.Write)
+	}
+}
+
+// monitors 返回所有开启检测的lagMonitor
+func (r *lagRouter) monitors() []*lagMonitor {
+	seen := make(map[*lagMonitor]struct{})
+	var ret []*lagMonitor
+	add := func(monitor *lagMonitor) {
+		if _, ok := seen[monitor]; ok || monitor == nil {
+			return
+		}
+		seen[monitor] = struct{}{}
+		ret = append(ret, monitor)
+	}
+	add(r.fallback)
+	for _, monitor := range r.tables {
+		add(monitor)
+	}
+	return ret
+}
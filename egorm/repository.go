@@ -0,0 +1,138 @@
+package egorm
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Repository 模型T的通用增删改查，条件使用Conds构建，复杂查询通过DB获取gorm.DB
+//
+//	users := egorm.NewRepository[User](db)
+//	user, err := users.FindByID(ctx, 1)
+//	list, err := users.List(ctx, egorm.Conds{"status": 1, "nickname": egorm.Cond{Op: "like", Val: "ego"}})
+type Repository[T any] struct {
+	db *Component
+}
+
+// NewRepository 创建模型T的Repository
+func NewRepository[T any](db *Component) *Repository[T] {
+	return &Repository[T]{db: db}
+}
+
+// DB 返回模型为T的gorm.DB，用于Repository不支持的查询
+func (r *Repository[T]) DB(ctx context.Context) *Component {
+	return r.db.WithContext(ctx).Model(new(T))
+}
+
+// where 将conds转为where条件，conds为空时不加条件
+func (r *Repository[T]) where(ctx context.Context, conds Conds) *Component {
+	db := r.DB(ctx)
+	if len(conds) == 0 {
+		return db
+	}
+	sql, binds := BuildQuery(conds)
+	return db.Where(sql, binds...)
+}
+
+// FindByID 根据主键查询，记录不存在时返回ErrRecordNotFound。
+// id总是作为参数绑定，字符串主键不会被当作SQL条件
+func (r *Repository[T]) FindByID(ctx context.Context, id interface{}) (*T, error) {
+	var entity T
+	if err := r.DB(ctx).Where(primaryKeyCondition[T](r.db), id).First(&entity).Error; err != nil {
+		return nil, err
+	}
+	return &entity, nil
+}
+
+// First 查询满足条件的第一条记录，记录不存在时返回ErrRecordNotFound
+func (r *Repository[T]) First(ctx context.Context, conds Conds) (*T, error) {
+	var entity T
+	if err := r.where(ctx, conds).First(&entity).Error; err != nil {
+		return nil, err
+	}
+	return &entity, nil
+}
+
+// List 查询满足条件的所有记录，orders为排序，如"id desc"
+func (r *Repository[T]) List(ctx context.Context, conds Conds, orders ...string) ([]T, error) {
+	db := r.where(ctx, conds)
+	for _, order := range orders {
+		db = db.Order(order)
+	}
+	var list []T
+	if err := db.Find(&list).Error; err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Count 统计满足条件的记录数
+func (r *Repository[T]) Count(ctx context.Context, conds Conds) (int64, error) {
+	var count int64
+	err := r.where(ctx, conds).Count(&count).Error
+	return count, err
+}
+
+// Paginate 页码分页查询满足条件的记录
+func (r *Repository[T]) Paginate(ctx context.Context, conds Conds, req PageRequest) (*Page[T], error) {
+	return Paginate[T](r.where(ctx, conds), req)
+}
+
+// Create 创建记录
+func (r *Repository[T]) Create(ctx context.Context, entity *T) error {
+	return r.db.WithContext(ctx).Create(entity).Error
+}
+
+// Creates 批量创建记录
+func (r *Repository[T]) Creates(ctx context.Context, entities []T) error {
+	if len(entities) == 0 {
+		return nil
+	}
+	return r.db.WithContext(ctx).Create(&entities).Error
+}
+
+// Save 保存entity的所有字段，主键为空时创建
+func (r *Repository[T]) Save(ctx context.Context, entity *T) error {
+	return r.db.WithContext(ctx).Save(entity).Error
+}
+
+// UpdateByID 根据主键更新ups中的字段，返回更新的行数
+func (r *Repository[T]) UpdateByID(ctx context.Context, id interface{}, ups map[string]interface{}) (int64, error) {
+	result := r.DB(ctx).Where(primaryKeyCondition[T](r.db), id).Updates(ups)
+	return result.RowsAffected, result.Error
+}
+
+// Update 更新满足条件的记录中ups的字段，conds不能为空，返回更新的行数
+func (r *Repository[T]) Update(ctx context.Context, conds Conds, ups map[string]interface{}) (int64, error) {
+	if len(conds) == 0 {
+		return 0, gorm.ErrMissingWhereClause
+	}
+	result := r.where(ctx, conds).Updates(ups)
+	return result.RowsAffected, result.Error
+}
+
+// DeleteByID 根据主键删除，返回删除的行数
+func (r *Repository[T]) DeleteByID(ctx context.Context, id interface{}) (int64, error) {
+	result := r.db.WithContext(ctx).Where(primaryKeyCondition[T](r.db), id).Delete(new(T))
+	return result.RowsAffected, result.Error
+}
+
+// Delete 删除满足条件的记录，conds不能为空，返回删除的行数
+func (r *Repository[T]) Delete(ctx context.Context, conds Conds) (int64, error) {
+	if len(conds) == 0 {
+		return 0, gorm.ErrMissingWhereClause
+	}
+	sql, binds := BuildQuery(conds)
+	result := r.db.WithContext(ctx).Where(sql, binds...).Delete(new(T))
+	return result.RowsAffected, result.Error
+}
+
+// primaryKeyCondition 返回 主键 = ? 的条件，T没有单一主键时使用id
+func primaryKeyCondition[T any](db *Component) string {
+	field, err := primaryField[T](db)
+	if err != nil {
+		return "id = ?"
+	}
+	return db.Statement.Quote(field.DBName) + " = ?"
+}
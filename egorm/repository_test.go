@@ -0,0 +1,81 @@
+package egorm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestRepository(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	var sql string
+	record := func(db *gorm.DB) {
+		sql = db.Statement.SQL.String()
+	}
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:sql", record))
+	require.NoError(t, db.Callback().Update().After("gorm:update").Register("test:sql", record))
+	require.NoError(t, db.Callback().Delete().After("gorm:delete").Register("test:sql", record))
+
+	ctx := context.Background()
+	projects := NewRepository[project](db)
+
+	_, _ = projects.FindByID(ctx, 1)
+	assert.Equal(t, "SELECT * FROM `projects` WHERE `id` = ? ORDER BY `projects`.`id` LIMIT 1", sql)
+
+	_, err = projects.List(ctx, Conds{"name": Cond{Op: "like", Val: "ego"}}, "id desc")
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT * FROM `projects` WHERE 1=1 AND `name` like ? ORDER BY id desc", sql)
+
+	_, err = projects.UpdateByID(ctx, 1, map[string]interface{}{"name": "ego"})
+	assert.NoError(t, err)
+	assert.Equal(t, "UPDATE `projects` SET `name`=? WHERE `id` = ?", sql)
+
+	_, err = projects.Delete(ctx, Conds{"tenant_id": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "DELETE FROM `projects` WHERE 1=1 AND `tenant_id`= ? ", sql)
+
+	_, err = projects.DeleteByID(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "DELETE FROM `projects` WHERE `id` = ?", sql)
+
+	_, err = projects.Delete(ctx, nil)
+	assert.ErrorIs(t, err, gorm.ErrMissingWhereClause)
+}
+
+type apiKey struct {
+	Key  string `gorm:"primaryKey"`
+	Name string
+}
+
+func TestRepositoryStringID(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	var (
+		sql  string
+		vars []interface{}
+	)
+	record := func(db *gorm.DB) {
+		sql = db.Statement.SQL.String()
+		vars = db.Statement.Vars
+	}
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:sql", record))
+	require.NoError(t, db.Callback().Delete().After("gorm:delete").Register("test:sql", record))
+
+	ctx := context.Background()
+	keys := NewRepository[apiKey](db)
+
+	// 字符串主键作为参数绑定，不会被当作SQL条件
+	_, _ = keys.FindByID(ctx, "1 OR 1=1")
+	assert.Equal(t, "SELECT * FROM `api_keys` WHERE `key` = ? ORDER BY `api_keys`.`key` LIMIT 1", sql)
+	assert.Equal(t, []interface{}{"1 OR 1=1"}, vars)
+
+	_, err = keys.DeleteByID(ctx, "1 OR 1=1")
+	assert.NoError(t, err)
+	assert.Equal(t, "DELETE FROM `api_keys` WHERE `key` = ?", sql)
+	assert.Equal(t, []interface{}{"1 OR 1=1"}, vars)
+}
@@ -0,0 +1,214 @@
+package egorm
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gotomicro/ego-component/egorm/manager"
+	"github.com/gotomicro/ego/core/elog"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+const (
+	// PolicyRandom 随机选择读库
+	PolicyRandom = "random"
+	// PolicyRoundRobin 轮询选择读库
+	PolicyRoundRobin = "roundRobin"
+)
+
+type forceMasterKey struct{}
+
+// WithMaster 返回强制走主库的context，用于写入后需要立即读到最新数据的场景
+//
+//	ctx = egorm.WithMaster(ctx)
+//	db.WithContext(ctx).Create(&order)
+//	db.WithContext(ctx).First(&order, order.ID) // 读主库
+func WithMaster(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceMasterKey{}, true)
+}
+
+type stickyPrimaryKey struct{}
+
+// stickyPrimary 记录请求中最后一次写入的时间
+type stickyPrimary struct {
+	duration  time.Duration
+	lastWrite int64 // unix nano，原子读写
+}
+
+// StickToPrimary 返回写入后读主库的context，解决写入后立即读取读到旧数据的问题。
+// d大于0时，使用该context写入后d时间内的读请求走主库；d小于等于0时，该context的读请求都走主库，与WithMaster相同
+//
+//	ctx = egorm.StickToPrimary(ctx, 3*time.Second)
+//	db.WithContext(ctx).First(&user, id)        // 读从库
+//	db.WithContext(ctx).Create(&order)          // 写主库
+//	db.WithContext(ctx).Find(&orders)           // 3s内读主库
+func StickToPrimary(ctx context.Context, d time.Duration) context.Context {
+	if d <= 0 {
+		return WithMaster(ctx)
+	}
+	return context.WithValue(ctx, stickyPrimaryKey{}, &stickyPrimary{duration: d})
+}
+
+// isForceMaster 判断context是否强制走主库
+func isForceMaster(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	if force, _ := ctx.Value(forceMasterKey{}).(bool); force {
+		return true
+	}
+	sticky, ok := ctx.Value(stickyPrimaryKey{}).(*stickyPrimary)
+	if !ok {
+		return false
+	}
+	lastWrite := atomic.LoadInt64(&sticky.lastWrite)
+	return lastWrite > 0 && time.Since(time.Unix(0, lastWrite)) < sticky.duration
+}
+
+// markWrite 记录StickToPrimary的context中的写入时间
+func markWrite(db *gorm.DB) {
+	if db.Error != nil || db.DryRun || db.Statement.Context == nil {
+		return
+	}
+	if sticky, ok := db.Statement.Context.Value(stickyPrimaryKey{}).(*stickyPrimary); ok {
+		atomic.StoreInt64(&sticky.lastWrite, time.Now().UnixNano())
+	}
+}
+
+// roundRobinPolicy 轮询选择连接
+type roundRobinPolicy struct {
+	next uint64
+}
+
+func (p *roundRobinPolicy) Resolve(connPools []gorm.ConnPool) gorm.ConnPool {
+	n := atomic.AddUint64(&p.next, 1)
+	return connPools[(n-1)%uint64(len(connPools))]
+}
+
+func newPolicy(policy string) (dbresolver.Policy, error) {
+	switch policy {
+	case "", PolicyRandom:
+		return dbresolver.RandomPolicy{}, nil
+	case PolicyRoundRobin:
+		return &roundRobinPolicy{}, nil
+	}
+	return nil, fmt.Errorf("invalid resolver policy: %s", policy)
+}
+
+// newResolver 根据配置创建读写分离插件，未配置Tables的resolver为默认配置，只能有一个。
+// 配置了MaxReplicationLag的resolver会检测读库复制延迟，返回的lagRouter为nil时没有开启检测
+func newResolver(compName string, dsnParser manager.DSNParser, config *config, logger *elog.Component) (*dbresolver.DBResolver, *lagRouter, error) {
+	dialectors := func(dsns []string) []gorm.Dialector {
+		ds := make([]gorm.Dialector, 0, len(dsns))
+		for _, dsn := range dsns {
+			ds = append(ds, config.dialector(dsnParser, dsn))
+		}
+		return ds
+	}
+
+	var (
+		resolver   *dbresolver.DBResolver
+		router     = &lagRouter{tables: make(map[string]*lagMonitor)}
+		monitoring bool
+	)
+	for _, rc := range config.Resolvers {
+		policy, err := newPolicy(rc.Policy)
+		if err != nil {
+			return nil, nil, err
+		}
+		var monitor *lagMonitor
+		if rc.MaxReplicationLag > 0 && len(rc.Replicas) > 0 {
+			monitor = newLagMonitor(compName, rc, dsnParser, func(dsn string) gorm.Dialector {
+				return config.dialector(dsnParser, dsn)
+			}, logger)
+			policy = &lagAwarePolicy{base: policy, monitor: monitor}
+			monitoring = true
+		}
+		tables := make([]interface{}, 0, len(rc.Tables))
+		for _, table := range rc.Tables {
+			tables = append(tables, table)
+			router.tables[table] = monitor
+		}
+		if len(rc.Tables) == 0 {
+			router.fallback = monitor
+		}
+		resolverConfig := dbresolver.Config{
+			Sources:  dialectors(rc.Sources),
+			Replicas: dialectors(rc.Replicas),
+			Policy:   policy,
+		}
+		if resolver == nil {
+			resolver = dbresolver.Register(resolverConfig, tables...)
+		} else {
+			resolver = resolver.Register(resolverConfig, tables...)
+		}
+	}
+
+	resolver.SetMaxIdleConns(config.MaxIdleConns)
+	resolver.SetMaxOpenConns(config.MaxOpenConns)
+	if config.ConnMaxLifetime != 0 {
+		resolver.SetConnMaxLifetime(config.ConnMaxLifetime)
+	}
+	if !monitoring {
+		router = nil
+	}
+	return resolver, router, nil
+}
+
+// forceMaster 在dbresolver选择连接前，为WithMaster的请求加上写标记
+func forceMaster(db *gorm.DB) {
+	if isForceMaster(db.Statement.Context) {
+		db.Statement.AddClause(dbresolver.Write)
+	}
+}
+
+// registerResolver 注册读写分离插件，done关闭后停止检测复制延迟
+func registerResolver(db *gorm.DB, compName string, dsnParser manager.DSNParser, config *config, logger *elog.Component, done <-chan struct{}) error {
+	resolver, router, err := newResolver(compName, dsnParser, config, logger)
+	if err != nil {
+		return err
+	}
+	if err := db.Use(resolver); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("gorm:db_resolver").Register("egorm:force_master", forceMaster); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:db_resolver").Register("egorm:force_master", forceMaster); err != nil {
+		return err
+	}
+	if err := db.Callback().Raw().Before("gorm:db_resolver").Register("egorm:force_master", forceMaster); err != nil {
+		return err
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("egorm:sticky_primary", markWrite); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().After("gorm:update").Register("egorm:sticky_primary", markWrite); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().After("gorm:delete").Register("egorm:sticky_primary", markWrite); err != nil {
+		return err
+	}
+	if err := db.Callback().Raw().After("gorm:raw").Register("egorm:sticky_primary", markWrite); err != nil {
+		return err
+	}
+	if router == nil {
+		return nil
+	}
+	if err := db.Callback().Query().Before("gorm:db_resolver").Register("egorm:replica_lag", router.route); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:db_resolver").Register("egorm:replica_lag", router.route); err != nil {
+		return err
+	}
+	if err := db.Callback().Raw().Before("gorm:db_resolver").Register("egorm:replica_lag", router.route); err != nil {
+		return err
+	}
+	for _, monitor := range router.monitors() {
+		go monitor.run(done)
+	}
+	return nil
+}
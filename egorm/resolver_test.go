@@ -0,0 +1,156 @@
+package egorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/gotomicro/ego-component/egorm/manager"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/plugin/dbresolver"
+)
+
+func TestRoundRobinPolicy(t *testing.T) {
+	policy, err := newPolicy(PolicyRoundRobin)
+	assert.NoError(t, err)
+
+	pools := []gorm.ConnPool{&gorm.PreparedStmtDB{}, &gorm.PreparedStmtDB{}, &gorm.PreparedStmtDB{}}
+	for i := 0; i < 6; i++ {
+		assert.Same(t, pools[i%3], policy.Resolve(pools))
+	}
+
+	_, err = newPolicy("weighted")
+	assert.Error(t, err)
+}
+
+func TestWithMaster(t *testing.T) {
+	assert.False(t, isForceMaster(nil))
+	assert.False(t, isForceMaster(context.Background()))
+	assert.True(t, isForceMaster(WithMaster(context.Background())))
+}
+
+func TestLagAwarePolicy(t *testing.T) {
+	monitor := &lagMonitor{
+		rc:   resolverConfig{MaxReplicationLag: time.Second},
+		lags: []int64{int64(3 * time.Second), int64(100 * time.Millisecond), int64(lagUnknown)},
+	}
+	policy := &lagAwarePolicy{base: &roundRobinPolicy{}, monitor: monitor}
+	pools := []gorm.ConnPool{&gorm.PreparedStmtDB{}, &gorm.PreparedStmtDB{}, &gorm.PreparedStmtDB{}}
+	for i := 0; i < 3; i++ {
+		assert.Same(t, pools[1], policy.Resolve(pools))
+	}
+
+	router := &lagRouter{tables: map[string]*lagMonitor{"orders": nil}, fallback: monitor}
+	db := &gorm.DB{Statement: &gorm.Statement{Table: "users", Clauses: map[string]clause.Clause{}}}
+	router.route(db)
+	_, forced := db.Statement.Clauses[dbresolver.Write.Name()]
+	assert.False(t, forced)
+
+	// 所有读库延迟都超过阈值时读写库
+	atomic.StoreInt64(&monitor.lags[1], int64(2*time.Second))
+	router.route(db)
+	_, forced = db.Statement.Clauses[dbresolver.Write.Name()]
+	assert.True(t, forced)
+}
+
+func TestStickToPrimary(t *testing.T) {
+	assert.True(t, isForceMaster(StickToPrimary(context.Background(), 0)))
+
+	ctx := StickToPrimary(context.Background(), time.Hour)
+	assert.False(t, isForceMaster(ctx))
+	markWrite(&gorm.DB{Config: &gorm.Config{}, Statement: &gorm.Statement{Context: ctx}})
+	assert.True(t, isForceMaster(ctx))
+}
+
+// replicaConn 模拟MySQL 8.0.22之前的从库，不支持SHOW REPLICA STATUS
+type replicaConn struct {
+	mu      *sync.Mutex
+	queries *[]string
+}
+
+func (c replicaConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.mu.Lock()
+	*c.queries = append(*c.queries, query)
+	c.mu.Unlock()
+	if query == "SHOW REPLICA STATUS" {
+		return nil, &mysqldriver.MySQLError{Number: 1064, Message: "You have an error in your SQL syntax"}
+	}
+	return &statusRows{columns: []string{"Slave_IO_State", "Seconds_Behind_Master"}, values: []driver.Value{"Waiting for master", "3"}}, nil
+}
+
+func (replicaConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not implemented")
+}
+func (replicaConn) Close() error              { return nil }
+func (replicaConn) Begin() (driver.Tx, error) { return nil, errors.New("not implemented") }
+
+type statusRows struct {
+	columns []string
+	values  []driver.Value
+	done    bool
+}
+
+func (r *statusRows) Columns() []string { return r.columns }
+func (r *statusRows) Close() error      { return nil }
+func (r *statusRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.values)
+	return nil
+}
+
+type replicaConnector struct {
+	conn replicaConn
+}
+
+func (c replicaConnector) Connect(ctx context.Context) (driver.Conn, error) { return c.conn, nil }
+func (c replicaConnector) Driver() driver.Driver                            { return nil }
+
+func TestLagMonitor(t *testing.T) {
+	var queries []string
+	conn := replicaConn{mu: &sync.Mutex{}, queries: &queries}
+	monitor := newLagMonitor("test", resolverConfig{Replicas: []string{"replica"}, MaxReplicationLag: time.Second, LagCheckInterval: 10 * time.Millisecond}, manager.Get("mysql"),
+		func(dsn string) gorm.Dialector {
+			return mysql.New(mysql.Config{Conn: sql.OpenDB(replicaConnector{conn: conn}), SkipInitializeWithVersion: true})
+		}, elog.DefaultLogger)
+
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		monitor.run(done)
+		close(exited)
+	}()
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&monitor.lags[0]) == int64(3*time.Second)
+	}, time.Second, time.Millisecond)
+	close(done)
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatal("lag monitor did not stop")
+	}
+	assert.Nil(t, monitor.dbs[0], "probe connection closed")
+
+	// 不支持SHOW REPLICA STATUS时只尝试一次，之后使用SHOW SLAVE STATUS
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	require.GreaterOrEqual(t, len(queries), 2)
+	assert.Equal(t, "SHOW REPLICA STATUS", queries[0])
+	for _, query := range queries[1:] {
+		assert.Equal(t, "SHOW SLAVE STATUS", query)
+	}
+}
@@ -0,0 +1,217 @@
+package egorm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// SagaStatusRunning 正在执行分支
+	SagaStatusRunning = "running"
+	// SagaStatusCompensating 正在补偿，或者有分支补偿失败，等待RecoverSagas重试
+	SagaStatusCompensating = "compensating"
+	// SagaStatusSucceeded 所有分支执行成功
+	SagaStatusSucceeded = "succeeded"
+	// SagaStatusAborted 分支执行失败，已成功的分支都已补偿
+	SagaStatusAborted = "aborted"
+)
+
+// SagaState 持久化的saga执行状态
+type SagaState struct {
+	GID       string `gorm:"primaryKey;size:128"`
+	Name      string `gorm:"size:255;not null"`
+	Payload   []byte `gorm:"type:blob"`
+	Status    string `gorm:"size:32;not null;index:idx_status_updated_at"`
+	Step      int    // 执行中时为正在执行的分支，补偿中时为需要从该分支开始向前补偿
+	Error     string `gorm:"size:1024"`
+	CreatedAt time.Time
+	UpdatedAt time.Time `gorm:"index:idx_status_updated_at"`
+}
+
+// TableName saga状态表名
+func (SagaState) TableName() string {
+	return "saga_states"
+}
+
+// SagaStore 保存saga的执行状态，进程退出后由RecoverSagas继续补偿
+type SagaStore interface {
+	Save(ctx context.Context, state *SagaState) error
+	// Unfinished 返回updatedBefore之前最后更新、没有结束的saga
+	Unfinished(ctx context.Context, updatedBefore time.Time, limit int) ([]SagaState, error)
+}
+
+type gormSagaStore struct {
+	db *Component
+}
+
+// NewGormSagaStore 将saga状态保存在saga_states表中，需要先AutoMigrate(&egorm.SagaState{})
+func NewGormSagaStore(db *Component) SagaStore {
+	return &gormSagaStore{db: db}
+}
+
+func (s *gormSagaStore) Save(ctx context.Context, state *SagaState) error {
+	return s.db.WithContext(ctx).Save(state).Error
+}
+
+func (s *gormSagaStore) Unfinished(ctx context.Context, updatedBefore time.Time, limit int) ([]SagaState, error) {
+	var states []SagaState
+	err := s.db.WithContext(ctx).
+		Where("status IN ? AND updated_at < ?", []string{SagaStatusRunning, SagaStatusCompensating}, updatedBefore).
+		Order("updated_at").Limit(limit).Find(&states).Error
+	return states, err
+}
+
+// SagaStep saga中的一个分支，Compensate用于在后续分支失败时撤销Action，可以为nil
+type SagaStep struct {
+	Name       string
+	Action     func(ctx context.Context) error
+	Compensate func(ctx context.Context) error
+}
+
+// Saga 按顺序执行分支，某个分支失败时按相反顺序执行已成功分支的补偿
+//
+//	err := egorm.NewSaga().
+//		Add("order", createOrder, cancelOrder).
+//		Add("inventory", deductInventory, restoreInventory).
+//		Add("payment", pay, nil).
+//		Run(ctx)
+type Saga struct {
+	steps []SagaStep
+	store SagaStore
+	state *SagaState
+}
+
+// NewSaga 创建Saga
+func NewSaga() *Saga {
+	return &Saga{}
+}
+
+// Add 添加分支
+func (s *Saga) Add(name string, action, compensate func(ctx context.Context) error) *Saga {
+	s.steps = append(s.steps, SagaStep{Name: name, Action: action, Compensate: compensate})
+	return s
+}
+
+// WithStore 持久化saga的执行状态，gid为全局唯一的事务ID，name、payload用于进程重启后通过RecoverSagas重新构造分支。
+// 持久化的saga的补偿需要幂等，并且能处理Action没有执行过的情况（空补偿）
+func (s *Saga) WithStore(store SagaStore, gid, name string, payload []byte) *Saga {
+	s.store = store
+	s.state = &SagaState{GID: gid, Name: name, Payload: payload}
+	return s
+}
+
+// save 保存执行状态，没有设置store时忽略
+func (s *Saga) save(ctx context.Context, status string, step int, err error) error {
+	if s.store == nil {
+		return nil
+	}
+	s.state.Status, s.state.Step, s.state.Error = status, step, ""
+	if err != nil {
+		s.state.Error = err.Error()
+		if len(s.state.Error) > 1024 {
+			s.state.Error = s.state.Error[:1024]
+		}
+	}
+	if serr := s.store.Save(ctx, s.state); serr != nil {
+		return fmt.Errorf("egorm: save saga %s: %w", s.state.GID, serr)
+	}
+	return nil
+}
+
+// SagaError 分支执行失败，CompensateErrs为补偿失败的分支，需要人工介入或重试
+type SagaError struct {
+	Step           string
+	Err            error
+	CompensateErrs map[string]error
+}
+
+func (e *SagaError) Error() string {
+	msg := fmt.Sprintf("egorm: saga step %s failed: %v", e.Step, e.Err)
+	if len(e.CompensateErrs) == 0 {
+		return msg
+	}
+	failed := make([]string, 0, len(e.CompensateErrs))
+	for name, err := range e.CompensateErrs {
+		failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+	}
+	return msg + ", compensate failed: " + strings.Join(failed, "; ")
+}
+
+func (e *SagaError) Unwrap() error {
+	return e.Err
+}
+
+// Run 执行所有分支，失败时返回*SagaError。设置了store时每个分支执行前保存状态，保存失败时停止执行并补偿
+func (s *Saga) Run(ctx context.Context) error {
+	for i, step := range s.steps {
+		if err := s.save(ctx, SagaStatusRunning, i, nil); err != nil {
+			return s.compensate(ctx, i-1, &SagaError{Step: step.Name, Err: err})
+		}
+		if err := step.Action(ctx); err != nil {
+			// 分支返回错误时认为Action没有生效，只补偿之前的分支
+			return s.compensate(ctx, i-1, &SagaError{Step: step.Name, Err: err})
+		}
+	}
+	return s.save(ctx, SagaStatusSucceeded, len(s.steps), nil)
+}
+
+// compensate 按相反顺序补偿from及之前的分支，补偿失败时记录在CompensateErrs中，并保持compensating状态等待重试
+func (s *Saga) compensate(ctx context.Context, from int, sagaErr *SagaError) error {
+	_ = s.save(ctx, SagaStatusCompensating, from, sagaErr.Err)
+	retry := -1
+	for i := from; i >= 0; i-- {
+		step := s.steps[i]
+		if step.Compensate == nil {
+			continue
+		}
+		if cerr := step.Compensate(ctx); cerr != nil {
+			if sagaErr.CompensateErrs == nil {
+				sagaErr.CompensateErrs = make(map[string]error)
+			}
+			sagaErr.CompensateErrs[step.Name] = cerr
+			if retry < 0 {
+				retry = i
+			}
+			continue
+		}
+		if retry < 0 {
+			_ = s.save(ctx, SagaStatusCompensating, i-1, sagaErr.Err)
+		}
+	}
+	if retry >= 0 {
+		_ = s.save(ctx, SagaStatusCompensating, retry, sagaErr)
+		return sagaErr
+	}
+	_ = s.save(ctx, SagaStatusAborted, -1, sagaErr.Err)
+	return sagaErr
+}
+
+// RecoverSagas 继续补偿进程退出或补偿失败时没有结束的saga，返回处理的数量。
+// 只处理olderThan之前最后更新的saga，olderThan需要大于最长的分支执行时间；
+// build根据name、payload重新构造与原来相同的分支。执行中的saga无法确定正在执行的分支是否生效，会从该分支开始补偿
+func RecoverSagas(ctx context.Context, store SagaStore, olderThan time.Duration, limit int, build func(name string, payload []byte) (*Saga, error)) (int, error) {
+	states, err := store.Unfinished(ctx, time.Now().Add(-olderThan), limit)
+	if err != nil {
+		return 0, err
+	}
+	for i := range states {
+		state := states[i]
+		saga, err := build(state.Name, state.Payload)
+		if err != nil {
+			return i, fmt.Errorf("egorm: build saga %s: %w", state.GID, err)
+		}
+		saga.store, saga.state = store, &state
+		from := state.Step
+		if from >= len(saga.steps) {
+			from = len(saga.steps) - 1
+		}
+		step := "recover"
+		if from >= 0 {
+			step = saga.steps[from].Name
+		}
+		_ = saga.compensate(ctx, from, &SagaError{Step: step, Err: fmt.Errorf("egorm: recover saga %s: %s", state.GID, state.Error)})
+	}
+	return len(states), nil
+}
@@ -0,0 +1,144 @@
+package egorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaga(t *testing.T) {
+	var calls []string
+	step := func(name string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+	errPay := errors.New("insufficient balance")
+	err := NewSaga().
+		Add("order", step("order", nil), step("cancel order", nil)).
+		Add("inventory", step("inventory", nil), step("restore inventory", nil)).
+		Add("payment", step("payment", errPay), step("refund", nil)).
+		Run(context.Background())
+
+	var sagaErr *SagaError
+	assert.True(t, errors.As(err, &sagaErr))
+	assert.Equal(t, "payment", sagaErr.Step)
+	assert.ErrorIs(t, err, errPay)
+	assert.Equal(t, []string{"order", "inventory", "payment", "restore inventory", "cancel order"}, calls)
+}
+
+// memorySagaStore 记录每次保存的状态
+type memorySagaStore struct {
+	states  map[string]SagaState
+	history []string
+}
+
+func (m *memorySagaStore) Save(ctx context.Context, state *SagaState) error {
+	state.UpdatedAt = time.Now()
+	m.states[state.GID] = *state
+	m.history = append(m.history, fmt.Sprintf("%s:%d", state.Status, state.Step))
+	return nil
+}
+
+func (m *memorySagaStore) Unfinished(ctx context.Context, updatedBefore time.Time, limit int) ([]SagaState, error) {
+	var ret []SagaState
+	for _, state := range m.states {
+		if (state.Status == SagaStatusRunning || state.Status == SagaStatusCompensating) && state.UpdatedAt.Before(updatedBefore) {
+			ret = append(ret, state)
+		}
+	}
+	return ret, nil
+}
+
+func TestSagaStore(t *testing.T) {
+	store := &memorySagaStore{states: make(map[string]SagaState)}
+	var calls []string
+	step := func(name string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+	build := func(refundErr error) *Saga {
+		return NewSaga().
+			Add("order", step("order", nil), step("cancel order", nil)).
+			Add("payment", step("payment", nil), step("refund", refundErr))
+	}
+
+	require.NoError(t, build(nil).WithStore(store, "gid1", "order", []byte("1")).Run(context.Background()))
+	assert.Equal(t, []string{"running:0", "running:1", "succeeded:2"}, store.history)
+
+	// 补偿失败时保持compensating状态，RecoverSagas重试补偿
+	store.history = nil
+	saga := build(errors.New("refund failed")).
+		Add("notify", step("notify", errors.New("timeout")), nil).
+		WithStore(store, "gid2", "order", []byte("2"))
+	err := saga.Run(context.Background())
+	var sagaErr *SagaError
+	require.True(t, errors.As(err, &sagaErr))
+	assert.Contains(t, sagaErr.CompensateErrs, "payment")
+	assert.Equal(t, SagaState{GID: "gid2", Name: "order", Payload: []byte("2"), Status: SagaStatusCompensating, Step: 1, Error: err.Error(), UpdatedAt: store.states["gid2"].UpdatedAt}, store.states["gid2"])
+
+	// 进程在执行分支时退出，从正在执行的分支开始补偿
+	store.states["gid3"] = SagaState{GID: "gid3", Name: "order", Payload: []byte("3"), Status: SagaStatusRunning, Step: 0}
+
+	calls = nil
+	var payloads []string
+	n, err := RecoverSagas(context.Background(), store, 0, 10, func(name string, payload []byte) (*Saga, error) {
+		payloads = append(payloads, string(payload))
+		return build(nil), nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.ElementsMatch(t, []string{"2", "3"}, payloads)
+	assert.ElementsMatch(t, []string{"refund", "cancel order", "cancel order"}, calls)
+	assert.Equal(t, SagaStatusAborted, store.states["gid2"].Status)
+	assert.Equal(t, SagaStatusAborted, store.states["gid3"].Status)
+}
+
+func TestTCC(t *testing.T) {
+	var calls []string
+	step := func(name string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			calls = append(calls, name)
+			return err
+		}
+	}
+	require.NoError(t, NewTCC().
+		Add("inventory", step("try inventory", nil), step("confirm inventory", nil), step("cancel inventory", nil)).
+		Add("payment", step("try payment", nil), step("confirm payment", nil), step("cancel payment", nil)).
+		Run(context.Background()))
+	assert.Equal(t, []string{"try inventory", "try payment", "confirm inventory", "confirm payment"}, calls)
+
+	// Try失败时Cancel执行过Try的分支，包括失败的分支
+	calls = nil
+	errFreeze := errors.New("insufficient balance")
+	err := NewTCC().
+		Add("inventory", step("try inventory", nil), step("confirm inventory", nil), step("cancel inventory", nil)).
+		Add("payment", step("try payment", errFreeze), step("confirm payment", nil), step("cancel payment", nil)).
+		Add("coupon", step("try coupon", nil), step("confirm coupon", nil), step("cancel coupon", nil)).
+		Run(context.Background())
+	var tccErr *TCCError
+	require.True(t, errors.As(err, &tccErr))
+	assert.Equal(t, TCCPhaseTry, tccErr.Phase)
+	assert.Equal(t, "payment", tccErr.Branch)
+	assert.ErrorIs(t, err, errFreeze)
+	assert.Equal(t, []string{"try inventory", "try payment", "cancel payment", "cancel inventory"}, calls)
+
+	// Confirm失败时继续Confirm其他分支，返回需要重试的分支
+	calls = nil
+	err = NewTCC().
+		Add("inventory", step("try inventory", nil), step("confirm inventory", errors.New("timeout")), nil).
+		Add("payment", step("try payment", nil), step("confirm payment", nil), nil).
+		Run(context.Background())
+	require.True(t, errors.As(err, &tccErr))
+	assert.Equal(t, TCCPhaseConfirm, tccErr.Phase)
+	assert.Contains(t, tccErr.PhaseErrs, "inventory")
+	assert.Equal(t, []string{"try inventory", "try payment", "confirm inventory", "confirm payment"}, calls)
+}
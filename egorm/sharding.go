@@ -0,0 +1,411 @@
+package egorm
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// ShardingAlgorithmMod 分片键取模，分片键必须是整数
+	ShardingAlgorithmMod = "mod"
+	// ShardingAlgorithmHash 分片键crc32后取模
+	ShardingAlgorithmHash = "hash"
+	// ShardingAlgorithmDate 按分片键的时间分表，分片键必须是time.Time
+	ShardingAlgorithmDate = "date"
+)
+
+var (
+	// ErrMissingShardingKey 分表的查询、写入中没有分片键的等值条件
+	ErrMissingShardingKey = errors.New("egorm: missing sharding key")
+	// ErrCrossShard 分片键的值分布在多张分表中，不支持跨分表操作
+	ErrCrossShard = errors.New("egorm: cross shard operation is not supported")
+)
+
+// shardingExprPattern 匹配 "user_id = ?"、"`orders`.`user_id` IN (?)" 形式的条件
+var shardingExprPattern = regexp.MustCompile("(?i)^\\(?\\s*(?:`?\\w+`?\\.)?`?(\\w+)`?\\s*(?:=|in)\\s*\\(?\\s*\\?\\s*\\)?\\s*\\)?$")
+
+var shardingAndPattern = regexp.MustCompile(`(?i)\s+and\s+`)
+
+var shardingOrPattern = regexp.MustCompile(`(?i)\bor\b`)
+
+// shardingRule 一张逻辑表的分表规则
+type shardingRule struct {
+	table      string
+	column     string
+	algorithm  string
+	shards     int
+	dateFormat string
+	// columnPattern 匹配SQL片段中的分片键列名
+	columnPattern *regexp.Regexp
+}
+
+// suffix 根据分片键的值计算分表后缀
+func (r *shardingRule) suffix(value interface{}) (string, error) {
+	switch r.algorithm {
+	case ShardingAlgorithmDate:
+		t, ok := value.(time.Time)
+		if !ok {
+			if p, isPtr := value.(*time.Time); isPtr && p != nil {
+				t, ok = *p, true
+			}
+		}
+		if !ok {
+			return "", fmt.Errorf("egorm: sharding key %s.%s must be time.Time, got %T", r.table, r.column, value)
+		}
+		return "_" + t.Format(r.dateFormat), nil
+	case ShardingAlgorithmHash:
+		sum := crc32.ChecksumIEEE([]byte(cast.ToString(value)))
+		return r.shardSuffix(int64(sum % uint32(r.shards))), nil
+	default:
+		n, err := cast.ToInt64E(value)
+		if err != nil || n < 0 {
+			return "", fmt.Errorf("egorm: sharding key %s.%s must be a non-negative integer, got %v", r.table, r.column, value)
+		}
+		return r.shardSuffix(n % int64(r.shards)), nil
+	}
+}
+
+// shardSuffix 分表后缀补齐到相同位数，如256张分表时为 _000 到 _255
+func (r *shardingRule) shardSuffix(shard int64) string {
+	width := len(strconv.Itoa(r.shards - 1))
+	return fmt.Sprintf("_%0*d", width, shard)
+}
+
+// sharding 按配置的分片键将逻辑表改写为分表
+type sharding struct {
+	rules map[string]*shardingRule
+}
+
+func newSharding(configs []shardingConfig) (*sharding, error) {
+	s := &sharding{rules: make(map[string]*shardingRule, len(configs))}
+	for _, sc := range configs {
+		rule := &shardingRule{
+			table:      sc.Table,
+			column:     sc.Column,
+			algorithm:  sc.Algorithm,
+			shards:     sc.Shards,
+			dateFormat: sc.DateFormat,
+		}
+		rule.columnPattern = regexp.MustCompile("(?i)(^|[^\\w])`?" + regexp.QuoteMeta(rule.column) + "`?($|[^\\w])")
+		if rule.algorithm == "" {
+			rule.algorithm = ShardingAlgorithmMod
+		}
+		if rule.dateFormat == "" {
+			rule.dateFormat = "200601"
+		}
+		switch {
+		case rule.table == "" || rule.column == "":
+			return nil, fmt.Errorf("egorm: sharding table and column are required")
+		case rule.algorithm != ShardingAlgorithmMod && rule.algorithm != ShardingAlgorithmHash && rule.algorithm != ShardingAlgorithmDate:
+			return nil, fmt.Errorf("egorm: invalid sharding algorithm %s for table %s", rule.algorithm, rule.table)
+		case rule.algorithm != ShardingAlgorithmDate && rule.shards <= 0:
+			return nil, fmt.Errorf("egorm: sharding shards must be positive for table %s", rule.table)
+		}
+		if _, ok := s.rules[rule.table]; ok {
+			return nil, fmt.Errorf("egorm: duplicated sharding table %s", rule.table)
+		}
+		s.rules[rule.table] = rule
+	}
+	return s, nil
+}
+
+// Name 插件名称
+func (s *sharding) Name() string {
+	return "egorm:sharding"
+}
+
+// Initialize 在执行SQL前改写表名
+func (s *sharding) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("egorm:sharding", s.switchTable(true)); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("gorm:query").Register("egorm:sharding", s.switchTable(false)); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("egorm:sharding", s.switchTable(true)); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("egorm:sharding", s.switchTable(true)); err != nil {
+		return err
+	}
+	return db.Callback().Row().Before("gorm:row").Register("egorm:sharding", s.switchTable(false))
+}
+
+// switchTable 将逻辑表改写为分表，useModel为true时where条件中没有分片键会从写入、更新、删除的模型中获取
+func (s *sharding) switchTable(useModel bool) func(db *gorm.DB) {
+	return func(db *gorm.DB) {
+		if db.Error != nil {
+			return
+		}
+		if rule, ok := s.rules[db.Statement.Table]; ok {
+			rule.switchTable(db, useModel)
+		}
+	}
+}
+
+func (r *shardingRule) switchTable(db *gorm.DB, useModel bool) {
+	if r.orCondition(db.Statement) {
+		_ = db.AddError(fmt.Errorf("%w: table %s, OR condition on %s", ErrCrossShard, r.table, r.column))
+		return
+	}
+	values := r.whereValues(db.Statement)
+	if len(values) == 0 && useModel {
+		values = r.modelValues(db.Statement)
+	}
+	if len(values) == 0 {
+		_ = db.AddError(fmt.Errorf("%w: table %s requires an equality condition on %s", ErrMissingShardingKey, r.table, r.column))
+		return
+	}
+
+	var suffix string
+	for _, value := range values {
+		shard, err := r.suffix(value)
+		if err != nil {
+			_ = db.AddError(err)
+			return
+		}
+		if suffix != "" && shard != suffix {
+			_ = db.AddError(fmt.Errorf("%w: table %s, %s%s and %s%s", ErrCrossShard, r.table, r.table, suffix, r.table, shard))
+			return
+		}
+		suffix = shard
+	}
+	db.Statement.Table = r.table + suffix
+}
+
+// whereValues 从where条件中取出分片键的值，只识别顶层AND连接的等值、IN条件
+func (r *shardingRule) whereValues(stmt *gorm.Statement) []interface{} {
+	c, ok := stmt.Clauses["WHERE"]
+	if !ok {
+		return nil
+	}
+	where, ok := c.Expression.(clause.Where)
+	if !ok {
+		return nil
+	}
+	return r.exprValues(where.Exprs)
+}
+
+// orCondition where条件中OR的分支带有分片键时返回true。
+// 如 Where("user_id = ?", 1).Or("user_id = ?", 2)，或者整个where是OR连接且带有分片键，结果可能分布在多张分表中
+func (r *shardingRule) orCondition(stmt *gorm.Statement) bool {
+	c, ok := stmt.Clauses["WHERE"]
+	if !ok {
+		return false
+	}
+	where, ok := c.Expression.(clause.Where)
+	if !ok {
+		return false
+	}
+	return r.exprsOr(where.Exprs)
+}
+
+func (r *shardingRule) exprsOr(exprs []clause.Expression) bool {
+	for idx, expr := range exprs {
+		switch e := expr.(type) {
+		case clause.OrConditions:
+			if r.mentions(e.Exprs...) {
+				return true
+			}
+			// 只有一个条件的OrConditions会以OR和前面的条件连接，此时任意一侧带有分片键都不能路由到单张分表
+			if idx > 0 && len(e.Exprs) == 1 && r.mentions(exprs[:idx]...) {
+				return true
+			}
+		case clause.AndConditions:
+			if r.exprsOr(e.Exprs) {
+				return true
+			}
+		case clause.Expr:
+			if shardingOrPattern.MatchString(e.SQL) && r.mentions(e) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mentions 条件中是否引用了分片键
+func (r *shardingRule) mentions(exprs ...clause.Expression) bool {
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case clause.Eq:
+			if r.isColumn(e.Column) {
+				return true
+			}
+		case clause.Neq:
+			if r.isColumn(e.Column) {
+				return true
+			}
+		case clause.IN:
+			if r.isColumn(e.Column) {
+				return true
+			}
+		case clause.Gt, clause.Gte, clause.Lt, clause.Lte:
+			if r.isColumn(compareColumn(e)) {
+				return true
+			}
+		case clause.Like:
+			if r.isColumn(e.Column) {
+				return true
+			}
+		case clause.AndConditions:
+			if r.mentions(e.Exprs...) {
+				return true
+			}
+		case clause.OrConditions:
+			if r.mentions(e.Exprs...) {
+				return true
+			}
+		case clause.NotConditions:
+			if r.mentions(e.Exprs...) {
+				return true
+			}
+		case clause.Expr:
+			if r.columnPattern.MatchString(e.SQL) {
+				return true
+			}
+		case clause.NamedExpr:
+			if r.columnPattern.MatchString(e.SQL) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compareColumn(expr clause.Expression) interface{} {
+	switch e := expr.(type) {
+	case clause.Gt:
+		return e.Column
+	case clause.Gte:
+		return e.Column
+	case clause.Lt:
+		return e.Column
+	case clause.Lte:
+		return e.Column
+	}
+	return nil
+}
+
+func (r *shardingRule) exprValues(exprs []clause.Expression) []interface{} {
+	for _, expr := range exprs {
+		switch e := expr.(type) {
+		case clause.Eq:
+			if r.isColumn(e.Column) {
+				return flatten(e.Value)
+			}
+		case clause.IN:
+			if r.isColumn(e.Column) {
+				return flatten(e.Values...)
+			}
+		case clause.AndConditions:
+			if values := r.exprValues(e.Exprs); len(values) > 0 {
+				return values
+			}
+		case clause.Expr:
+			if values := r.sqlValues(e.SQL, e.Vars); len(values) > 0 {
+				return values
+			}
+		}
+	}
+	return nil
+}
+
+// sqlValues 解析 Where("user_id = ? AND status = ?", 1, 2) 形式的条件
+func (r *shardingRule) sqlValues(sql string, vars []interface{}) []interface{} {
+	index := 0
+	for _, part := range shardingAndPattern.Split(strings.TrimSpace(sql), -1) {
+		placeholders := strings.Count(part, "?")
+		if m := shardingExprPattern.FindStringSubmatch(strings.TrimSpace(part)); m != nil && m[1] == r.column && index < len(vars) {
+			return flatten(vars[index])
+		}
+		index += placeholders
+	}
+	return nil
+}
+
+// modelValues 从写入或更新的模型中取出分片键的值
+func (r *shardingRule) modelValues(stmt *gorm.Statement) []interface{} {
+	if stmt.Schema == nil {
+		return nil
+	}
+	field := stmt.Schema.LookUpField(r.column)
+	if field == nil {
+		return nil
+	}
+	rv := reflect.Indirect(stmt.ReflectValue)
+	var values []interface{}
+	switch rv.Kind() {
+	case reflect.Struct:
+		if value, zero := field.ValueOf(rv); !zero {
+			values = append(values, value)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			value, zero := field.ValueOf(reflect.Indirect(rv.Index(i)))
+			if zero {
+				// 批量写入时每条记录都必须有分片键
+				return nil
+			}
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func (r *shardingRule) isColumn(column interface{}) bool {
+	switch c := column.(type) {
+	case string:
+		name := c
+		if i := strings.LastIndexByte(name, '.'); i >= 0 {
+			name = name[i+1:]
+		}
+		return strings.Trim(name, "`\"") == r.column
+	case clause.Column:
+		return c.Name == r.column
+	}
+	return false
+}
+
+// flatten 展开IN条件中的切片
+func flatten(values ...interface{}) []interface{} {
+	var ret []interface{}
+	for _, value := range values {
+		rv := reflect.ValueOf(value)
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+			for i := 0; i < rv.Len(); i++ {
+				ret = append(ret, rv.Index(i).Interface())
+			}
+			continue
+		}
+		ret = append(ret, value)
+	}
+	return ret
+}
+
+// ShardingTable 返回分片键的值对应的分表名，用于手写SQL，table没有配置分表时直接返回table
+func ShardingTable(db *Component, table string, value interface{}) (string, error) {
+	plugin, ok := db.Config.Plugins["egorm:sharding"].(*sharding)
+	if !ok {
+		return table, nil
+	}
+	rule, ok := plugin.rules[table]
+	if !ok {
+		return table, nil
+	}
+	suffix, err := rule.suffix(value)
+	if err != nil {
+		return "", err
+	}
+	return table + suffix, nil
+}
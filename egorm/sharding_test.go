@@ -0,0 +1,87 @@
+package egorm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type userOrder struct {
+	ID        int64
+	UserID    int64
+	CreatedAt time.Time
+}
+
+func (userOrder) TableName() string {
+	return "user_orders"
+}
+
+func newShardingDB(t *testing.T, configs ...shardingConfig) *gorm.DB {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	plugin, err := newSharding(configs)
+	require.NoError(t, err)
+	require.NoError(t, db.Use(plugin))
+	return db
+}
+
+func TestSharding(t *testing.T) {
+	db := newShardingDB(t, shardingConfig{Table: "user_orders", Column: "user_id", Shards: 256})
+
+	var orders []userOrder
+	stmt := db.Where("user_id = ? AND id > ?", 258, 10).Find(&orders).Statement
+	assert.NoError(t, stmt.Error)
+	assert.Equal(t, "SELECT * FROM `user_orders_002` WHERE user_id = ? AND id > ?", stmt.SQL.String())
+
+	stmt = db.Where(map[string]interface{}{"user_id": []int64{1, 257}}).Find(&orders).Statement
+	assert.NoError(t, stmt.Error)
+	assert.Equal(t, "user_orders_001", stmt.Table)
+
+	stmt = db.Create(&userOrder{UserID: 255}).Statement
+	assert.NoError(t, stmt.Error)
+	assert.Equal(t, "user_orders_255", stmt.Table)
+
+	stmt = db.Model(&userOrder{ID: 1, UserID: 3}).Update("created_at", time.Now()).Statement
+	assert.NoError(t, stmt.Error)
+	assert.Equal(t, "user_orders_003", stmt.Table)
+
+	assert.ErrorIs(t, db.Find(&orders).Error, ErrMissingShardingKey)
+	assert.ErrorIs(t, db.Where("user_id IN ?", []int64{1, 2}).Find(&orders).Error, ErrCrossShard)
+	assert.ErrorIs(t, db.Create([]userOrder{{UserID: 1}, {UserID: 2}}).Error, ErrCrossShard)
+}
+
+func TestShardingOr(t *testing.T) {
+	db := newShardingDB(t, shardingConfig{Table: "user_orders", Column: "user_id", Shards: 256})
+
+	var orders []userOrder
+	assert.ErrorIs(t, db.Where("user_id = ?", 1).Or("user_id = ?", 2).Find(&orders).Error, ErrCrossShard)
+	assert.ErrorIs(t, db.Where("user_id = ?", 1).Or("id = ?", 2).Find(&orders).Error, ErrCrossShard)
+	assert.ErrorIs(t, db.Where("user_id = ? OR user_id = ?", 1, 2).Find(&orders).Error, ErrCrossShard)
+	assert.ErrorIs(t, db.Where("user_id = ?", 1).Where(db.Where("user_id = ?", 1).Or("id = ?", 2)).Find(&orders).Error, ErrCrossShard)
+
+	// OR分支中没有分片键时仍然按AND连接的分片键路由
+	stmt := db.Where("user_id = ?", 1).Where(db.Where("id = ?", 1).Or("id = ?", 2)).Find(&orders).Statement
+	assert.NoError(t, stmt.Error)
+	assert.Equal(t, "user_orders_001", stmt.Table)
+
+	// 列名只是前缀相同时不视为分片键
+	stmt = db.Where("user_id = ?", 1).Where("user_id_ext = ? OR id = ?", 2, 3).Find(&orders).Statement
+	assert.NoError(t, stmt.Error)
+	assert.Equal(t, "user_orders_001", stmt.Table)
+}
+
+func TestShardingDate(t *testing.T) {
+	db := newShardingDB(t, shardingConfig{Table: "user_orders", Column: "created_at", Algorithm: ShardingAlgorithmDate})
+
+	stmt := db.Create(&userOrder{UserID: 1, CreatedAt: time.Date(2022, 3, 1, 0, 0, 0, 0, time.Local)}).Statement
+	assert.NoError(t, stmt.Error)
+	assert.Equal(t, "user_orders_202203", stmt.Table)
+
+	table, err := ShardingTable(db, "user_orders", time.Date(2022, 4, 1, 0, 0, 0, 0, time.Local))
+	assert.NoError(t, err)
+	assert.Equal(t, "user_orders_202204", table)
+}
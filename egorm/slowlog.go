@@ -0,0 +1,64 @@
+package egorm
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"gorm.io/gorm"
+)
+
+// egormSourceDir egorm源码目录，获取调用方时跳过
+var egormSourceDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return path.Dir(file)
+}()
+
+// observeQuery 记录SQL耗时，超过slowLogThreshold时记录慢查询日志
+func observeQuery(compName string, op string, db *gorm.DB, cost time.Duration, config *config, logger *elog.Component, fields []elog.Field) {
+	operation := strings.TrimPrefix(op, "gorm:")
+	queryHistogram.Observe(cost.Seconds(), compName, db.Statement.Table, operation)
+	if config.SlowLogThreshold <= time.Duration(0) || cost <= config.SlowLogThreshold {
+		return
+	}
+	slowQueryCounter.Inc(compName, db.Statement.Table, operation)
+	logger.Warn("slow", append(fields,
+		elog.String("sql", db.Statement.SQL.String()),
+		elog.Any("args", redactArgs(db.Statement.Vars)),
+		elog.String("caller", caller()),
+		elog.Duration("threshold", config.SlowLogThreshold),
+	)...)
+}
+
+// redactArgs 只保留参数的类型，避免敏感数据写入日志
+func redactArgs(vars []interface{}) []string {
+	args := make([]string, 0, len(vars))
+	for _, v := range vars {
+		if v == nil {
+			args = append(args, "NULL")
+			continue
+		}
+		args = append(args, fmt.Sprintf("<%T>", v))
+	}
+	return args
+}
+
+// caller 返回业务代码中发起SQL的位置
+func caller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		inEgorm := path.Dir(frame.File) == egormSourceDir && !strings.HasSuffix(frame.File, "_test.go")
+		if !inEgorm && !strings.Contains(frame.File, "gorm.io/") {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return ""
+		}
+	}
+}
@@ -0,0 +1,13 @@
+package egorm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactArgs(t *testing.T) {
+	args := redactArgs([]interface{}{"13800000000", int64(1), nil, time.Time{}})
+	assert.Equal(t, []string{"<string>", "<int64>", "NULL", "<time.Time>"}, args)
+}
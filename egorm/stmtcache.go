@@ -0,0 +1,183 @@
+package egorm
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/gotomicro/ego/core/emetric"
+	"gorm.io/gorm"
+)
+
+// stmtCacheCounter 预编译语句缓存的命中、未命中、淘汰次数
+var stmtCacheCounter = emetric.CounterVecOpts{
+	Namespace: emetric.DefaultNamespace,
+	Name:      "gorm_stmt_cache_total",
+	Help:      "Number of gorm prepared statement cache lookups and evictions, result is hit, miss or evict",
+	Labels:    []string{"name", "result"},
+}.Build()
+
+// stmtEntry 缓存的预编译语句，淘汰时如果还在使用，等使用结束后再关闭
+type stmtEntry struct {
+	query   string
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+}
+
+// stmtCachePool 缓存预编译语句的连接池，超过size时淘汰最久没有使用的语句。
+// gorm自带的PrepareStmt不限制缓存数量，动态拼接SQL时内存和数据库的预编译语句数会持续增长
+type stmtCachePool struct {
+	compName string
+	db       *sql.DB
+	size     int
+
+	mu    sync.Mutex
+	lru   *list.List // 最近使用的在前
+	items map[string]*list.Element
+}
+
+func newStmtCachePool(compName string, db *sql.DB, size int) *stmtCachePool {
+	if size <= 0 {
+		size = 1000
+	}
+	return &stmtCachePool{
+		compName: compName,
+		db:       db,
+		size:     size,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// acquire 获取query的预编译语句，使用结束后需要调用release
+func (p *stmtCachePool) acquire(ctx context.Context, query string) (*stmtEntry, error) {
+	p.mu.Lock()
+	if elem, ok := p.items[query]; ok {
+		p.lru.MoveToFront(elem)
+		entry := elem.Value.(*stmtEntry)
+		entry.refs++
+		p.mu.Unlock()
+		stmtCacheCounter.Inc(p.compName, "hit")
+		return entry, nil
+	}
+	p.mu.Unlock()
+	stmtCacheCounter.Inc(p.compName, "miss")
+
+	stmt, err := p.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	// 并发预编译了同一条语句时使用先放入缓存的
+	if elem, ok := p.items[query]; ok {
+		_ = stmt.Close()
+		entry := elem.Value.(*stmtEntry)
+		entry.refs++
+		return entry, nil
+	}
+	entry := &stmtEntry{query: query, stmt: stmt, refs: 1}
+	p.items[query] = p.lru.PushFront(entry)
+	for p.lru.Len() > p.size {
+		oldest := p.lru.Back()
+		p.lru.Remove(oldest)
+		evicted := oldest.Value.(*stmtEntry)
+		delete(p.items, evicted.query)
+		evicted.evicted = true
+		if evicted.refs == 0 {
+			_ = evicted.stmt.Close()
+		}
+		stmtCacheCounter.Inc(p.compName, "evict")
+	}
+	return entry, nil
+}
+
+func (p *stmtCachePool) release(entry *stmtEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry.refs--
+	if entry.evicted && entry.refs == 0 {
+		_ = entry.stmt.Close()
+	}
+}
+
+func (p *stmtCachePool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.db.PrepareContext(ctx, query)
+}
+
+func (p *stmtCachePool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	entry, err := p.acquire(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer p.release(entry)
+	return entry.stmt.ExecContext(ctx, args...)
+}
+
+func (p *stmtCachePool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	entry, err := p.acquire(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer p.release(entry)
+	return entry.stmt.QueryContext(ctx, args...)
+}
+
+func (p *stmtCachePool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	entry, err := p.acquire(ctx, query)
+	if err != nil {
+		return p.db.QueryRowContext(ctx, query, args...)
+	}
+	defer p.release(entry)
+	return entry.stmt.QueryRowContext(ctx, args...)
+}
+
+// BeginTx 开启事务，事务中使用缓存的预编译语句
+func (p *stmtCachePool) BeginTx(ctx context.Context, opts *sql.TxOptions) (gorm.ConnPool, error) {
+	tx, err := p.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &stmtCacheTx{Tx: tx, pool: p}, nil
+}
+
+// GetDBConn 返回*sql.DB，用于gorm.DB.DB()
+func (p *stmtCachePool) GetDBConn() (*sql.DB, error) {
+	return p.db, nil
+}
+
+// stmtCacheTx 事务中将缓存的预编译语句绑定到事务的连接上执行
+type stmtCacheTx struct {
+	*sql.Tx
+	pool *stmtCachePool
+}
+
+func (tx *stmtCacheTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	entry, err := tx.pool.acquire(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.pool.release(entry)
+	return tx.StmtContext(ctx, entry.stmt).ExecContext(ctx, args...)
+}
+
+func (tx *stmtCacheTx) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	entry, err := tx.pool.acquire(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.pool.release(entry)
+	return tx.StmtContext(ctx, entry.stmt).QueryContext(ctx, args...)
+}
+
+func (tx *stmtCacheTx) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	entry, err := tx.pool.acquire(ctx, query)
+	if err != nil {
+		return tx.Tx.QueryRowContext(ctx, query, args...)
+	}
+	defer tx.pool.release(entry)
+	return tx.StmtContext(ctx, entry.stmt).QueryRowContext(ctx, args...)
+}
@@ -0,0 +1,80 @@
+package egorm
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stmtDriver 记录预编译和关闭的语句
+type stmtDriver struct {
+	mu       sync.Mutex
+	prepared []string
+	closed   []string
+}
+
+func (d *stmtDriver) Open(name string) (driver.Conn, error) {
+	return &stmtConn{driver: d}, nil
+}
+
+type stmtConn struct {
+	driver *stmtDriver
+}
+
+func (c *stmtConn) Prepare(query string) (driver.Stmt, error) {
+	c.driver.mu.Lock()
+	defer c.driver.mu.Unlock()
+	c.driver.prepared = append(c.driver.prepared, query)
+	return &fakeStmt{driver: c.driver, query: query}, nil
+}
+func (c *stmtConn) Close() error              { return nil }
+func (c *stmtConn) Begin() (driver.Tx, error) { return nil, errors.New("not implemented") }
+
+type fakeStmt struct {
+	driver *stmtDriver
+	query  string
+}
+
+func (s *fakeStmt) Close() error {
+	s.driver.mu.Lock()
+	defer s.driver.mu.Unlock()
+	s.driver.closed = append(s.driver.closed, s.query)
+	return nil
+}
+func (s *fakeStmt) NumInput() int { return -1 }
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+
+type stmtConnector struct {
+	driver *stmtDriver
+}
+
+func (c stmtConnector) Connect(ctx context.Context) (driver.Conn, error) { return c.driver.Open("") }
+func (c stmtConnector) Driver() driver.Driver                            { return c.driver }
+
+func TestStmtCachePool(t *testing.T) {
+	d := &stmtDriver{}
+	sqlDB := sql.OpenDB(stmtConnector{driver: d})
+	sqlDB.SetMaxOpenConns(1)
+	pool := newStmtCachePool("test", sqlDB, 2)
+	ctx := context.Background()
+
+	for _, query := range []string{"q1", "q2", "q1", "q3", "q1"} {
+		_, err := pool.ExecContext(ctx, query)
+		require.NoError(t, err)
+	}
+	// q2最久没有使用，被淘汰
+	assert.Equal(t, []string{"q1", "q2", "q3"}, d.prepared)
+	assert.Equal(t, []string{"q2"}, d.closed)
+	assert.Equal(t, 2, pool.lru.Len())
+}
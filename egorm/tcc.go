@@ -0,0 +1,115 @@
+package egorm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// TCCBranch TCC中的一个分支，Try预留资源，Confirm确认，Cancel释放预留的资源
+type TCCBranch struct {
+	Name    string
+	Try     func(ctx context.Context) error
+	Confirm func(ctx context.Context) error
+	Cancel  func(ctx context.Context) error
+}
+
+// TCC 按顺序执行所有分支的Try，全部成功后依次Confirm；某个分支Try失败时，
+// 按相反顺序Cancel执行过Try的分支，包括失败的分支，Cancel需要能处理Try没有生效的情况（空回滚）
+//
+//	err := egorm.NewTCC().
+//		Add("inventory", freezeInventory, deductInventory, unfreezeInventory).
+//		Add("payment", freezeBalance, deductBalance, unfreezeBalance).
+//		Run(ctx)
+type TCC struct {
+	branches []TCCBranch
+}
+
+// NewTCC 创建TCC
+func NewTCC() *TCC {
+	return &TCC{}
+}
+
+// Add 添加分支，confirm、cancel可以为nil
+func (t *TCC) Add(name string, try, confirm, cancel func(ctx context.Context) error) *TCC {
+	t.branches = append(t.branches, TCCBranch{Name: name, Try: try, Confirm: confirm, Cancel: cancel})
+	return t
+}
+
+const (
+	// TCCPhaseTry Try阶段失败，已经Cancel
+	TCCPhaseTry = "try"
+	// TCCPhaseConfirm Confirm阶段失败，资源已经预留，需要重试Confirm直到成功
+	TCCPhaseConfirm = "confirm"
+)
+
+// TCCError 分支执行失败，Phase为失败的阶段，PhaseErrs为Try失败后Cancel失败、或者Confirm失败的分支
+type TCCError struct {
+	Phase     string
+	Branch    string
+	Err       error
+	PhaseErrs map[string]error
+}
+
+func (e *TCCError) Error() string {
+	msg := fmt.Sprintf("egorm: tcc branch %s %s failed: %v", e.Branch, e.Phase, e.Err)
+	if len(e.PhaseErrs) == 0 {
+		return msg
+	}
+	failed := make([]string, 0, len(e.PhaseErrs))
+	for name, err := range e.PhaseErrs {
+		failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+	}
+	action := "cancel"
+	if e.Phase == TCCPhaseConfirm {
+		action = "confirm"
+	}
+	return msg + ", " + action + " failed: " + strings.Join(failed, "; ")
+}
+
+func (e *TCCError) Unwrap() error {
+	return e.Err
+}
+
+// Run 执行所有分支，失败时返回*TCCError
+func (t *TCC) Run(ctx context.Context) error {
+	for i, branch := range t.branches {
+		if err := branch.Try(ctx); err != nil {
+			return t.cancel(ctx, i, err)
+		}
+	}
+	var tccErr *TCCError
+	for _, branch := range t.branches {
+		if branch.Confirm == nil {
+			continue
+		}
+		if err := branch.Confirm(ctx); err != nil {
+			if tccErr == nil {
+				tccErr = &TCCError{Phase: TCCPhaseConfirm, Branch: branch.Name, Err: err, PhaseErrs: make(map[string]error)}
+			}
+			tccErr.PhaseErrs[branch.Name] = err
+		}
+	}
+	if tccErr != nil {
+		return tccErr
+	}
+	return nil
+}
+
+// cancel 按相反顺序Cancel failed及之前的分支
+func (t *TCC) cancel(ctx context.Context, failed int, err error) error {
+	tccErr := &TCCError{Phase: TCCPhaseTry, Branch: t.branches[failed].Name, Err: err}
+	for i := failed; i >= 0; i-- {
+		branch := t.branches[i]
+		if branch.Cancel == nil {
+			continue
+		}
+		if cerr := branch.Cancel(ctx); cerr != nil {
+			if tccErr.PhaseErrs == nil {
+				tccErr.PhaseErrs = make(map[string]error)
+			}
+			tccErr.PhaseErrs[branch.Name] = cerr
+		}
+	}
+	return tccErr
+}
@@ -0,0 +1,123 @@
+package egorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrMissingTenant 多租户表的操作中context没有租户ID
+	ErrMissingTenant = errors.New("egorm: missing tenant id in context")
+	// ErrTenantUnscoped 原生SQL或者没有模型的语句无法加上租户条件，需要通过SkipTenant明确跳过租户隔离
+	ErrTenantUnscoped = errors.New("egorm: statement can not be scoped by tenant")
+)
+
+// tenantExemptPattern 嵌套事务的SAVEPOINT等语句不访问数据，不需要租户隔离
+var tenantExemptPattern = regexp.MustCompile(`(?i)^\s*(SAVEPOINT|RELEASE\s+SAVEPOINT|ROLLBACK\s+TO\s+SAVEPOINT)\s`)
+
+type (
+	tenantKey     struct{}
+	skipTenantKey struct{}
+)
+
+// WithTenant 返回带有租户ID的context，多租户表的查询、更新、删除会自动加上租户条件
+func WithTenant(ctx context.Context, tenantID interface{}) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// TenantFromContext 获取context中的租户ID
+func TenantFromContext(ctx context.Context) (interface{}, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	tenantID := ctx.Value(tenantKey{})
+	return tenantID, tenantID != nil
+}
+
+// SkipTenant 返回不做租户隔离的context，用于后台任务等需要跨租户操作的场景
+func SkipTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipTenantKey{}, true)
+}
+
+func isSkipTenant(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	skip, _ := ctx.Value(skipTenantKey{}).(bool)
+	return skip
+}
+
+// tenant 模型中有租户字段的表，按context中的租户ID隔离数据
+type tenant struct {
+	column string
+}
+
+// Name 插件名称
+func (t *tenant) Name() string {
+	return "egorm:tenant"
+}
+
+// Initialize 注册写入租户ID、加上租户条件的回调
+func (t *tenant) Initialize(db *gorm.DB) error {
+	if err := db.Callback().Create().Before("gorm:create").Register("egorm:tenant", t.create); err != nil {
+		return err
+	}
+	if err := db.Callback().Query().Before("gorm:query").Register("egorm:tenant", t.scope); err != nil {
+		return err
+	}
+	if err := db.Callback().Update().Before("gorm:update").Register("egorm:tenant", t.scope); err != nil {
+		return err
+	}
+	if err := db.Callback().Delete().Before("gorm:delete").Register("egorm:tenant", t.scope); err != nil {
+		return err
+	}
+	if err := db.Callback().Row().Before("gorm:row").Register("egorm:tenant", t.scope); err != nil {
+		return err
+	}
+	return db.Callback().Raw().Before("gorm:raw").Register("egorm:tenant", t.scope)
+}
+
+// tenantID 返回需要隔离的租户ID，表中没有租户字段或跳过隔离时返回false。
+// 原生SQL（Raw、Exec）和没有模型的语句无法判断是否访问了多租户表，没有跳过隔离时返回ErrTenantUnscoped
+func (t *tenant) tenantID(db *gorm.DB) (interface{}, bool) {
+	if db.Error != nil || isSkipTenant(db.Statement.Context) {
+		return nil, false
+	}
+	if db.Statement.SQL.Len() > 0 && tenantExemptPattern.MatchString(db.Statement.SQL.String()) {
+		return nil, false
+	}
+	if db.Statement.SQL.Len() > 0 || db.Statement.Schema == nil {
+		_ = db.AddError(fmt.Errorf("%w: table %q, use egorm.SkipTenant for raw SQL", ErrTenantUnscoped, db.Statement.Table))
+		return nil, false
+	}
+	if db.Statement.Schema.LookUpField(t.column) == nil {
+		return nil, false
+	}
+	tenantID, ok := TenantFromContext(db.Statement.Context)
+	if !ok {
+		_ = db.AddError(fmt.Errorf("%w: table %s", ErrMissingTenant, db.Statement.Table))
+		return nil, false
+	}
+	return tenantID, true
+}
+
+// create 写入时设置租户ID
+func (t *tenant) create(db *gorm.DB) {
+	if tenantID, ok := t.tenantID(db); ok {
+		db.Statement.SetColumn(t.column, tenantID, true)
+	}
+}
+
+// scope 查询、更新、删除时加上租户条件
+func (t *tenant) scope(db *gorm.DB) {
+	if tenantID, ok := t.tenantID(db); ok {
+		db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+			clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: t.column}, Value: tenantID},
+		}})
+	}
+}
@@ -0,0 +1,53 @@
+package egorm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type project struct {
+	ID       int64
+	TenantID int64
+	Name     string
+}
+
+func TestTenant(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(&tenant{column: "tenant_id"}))
+
+	ctx := WithTenant(context.Background(), int64(7))
+	var projects []project
+	stmt := db.WithContext(ctx).Where("name = ?", "ego").Find(&projects).Statement
+	assert.NoError(t, stmt.Error)
+	assert.Equal(t, "SELECT * FROM `projects` WHERE name = ? AND `projects`.`tenant_id` = ?", stmt.SQL.String())
+
+	p := project{Name: "ego"}
+	assert.NoError(t, db.WithContext(ctx).Create(&p).Error)
+	assert.Equal(t, int64(7), p.TenantID)
+
+	stmt = db.WithContext(ctx).Delete(&project{}, 1).Statement
+	assert.NoError(t, stmt.Error)
+	assert.Contains(t, stmt.SQL.String(), "`projects`.`tenant_id` = ?")
+
+	assert.ErrorIs(t, db.WithContext(context.Background()).Find(&projects).Error, ErrMissingTenant)
+	assert.NoError(t, db.WithContext(SkipTenant(context.Background())).Find(&projects).Error)
+
+	// 原生SQL和没有模型的语句无法加上租户条件，需要明确跳过
+	assert.ErrorIs(t, db.WithContext(ctx).Raw("SELECT * FROM projects").Scan(&projects).Error, ErrTenantUnscoped)
+	assert.ErrorIs(t, db.WithContext(ctx).Exec("DELETE FROM projects").Error, ErrTenantUnscoped)
+	var names []string
+	assert.ErrorIs(t, db.WithContext(ctx).Table("projects").Pluck("name", &names).Error, ErrTenantUnscoped)
+	assert.ErrorIs(t, db.WithContext(ctx).Table("projects").Create(map[string]interface{}{"name": "ego"}).Error, ErrTenantUnscoped)
+	assert.NoError(t, db.WithContext(SkipTenant(ctx)).Exec("DELETE FROM projects WHERE tenant_id = ?", 7).Error)
+	assert.NoError(t, db.WithContext(ctx).Exec("SAVEPOINT sp1").Error)
+
+	// 没有租户字段的模型不受影响
+	var orders []userOrder
+	assert.NoError(t, db.WithContext(context.Background()).Find(&orders).Error)
+}
@@ -0,0 +1,139 @@
+package egorm
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/gotomicro/ego-component/egorm/manager"
+	"github.com/gotomicro/ego/core/etrace"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const traceSpanKey = "egorm:trace:span"
+
+var (
+	sqlStringLiteral = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.|"")*"`)
+	sqlNumberLiteral = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+)
+
+// tracePlugin 为每条SQL创建span，span的父节点为请求context中的span
+type tracePlugin struct {
+	tracer *etrace.Tracer
+	attrs  []attribute.KeyValue
+}
+
+func newTracePlugin(dsn *manager.DSN) *tracePlugin {
+	host, port := peerInfo(dsn.Addr)
+	return &tracePlugin{
+		tracer: etrace.NewTracer(trace.SpanKindClient),
+		attrs: []attribute.KeyValue{
+			semconv.NetPeerNameKey.String(host),
+			semconv.NetPeerPortKey.Int(port),
+			semconv.NetTransportKey.String(dsn.Net),
+			semconv.DBNameKey.String(dsn.DBName),
+			semconv.DBUserKey.String(dsn.User),
+		},
+	}
+}
+
+// Name 插件名称
+func (p *tracePlugin) Name() string {
+	return "egorm:trace"
+}
+
+// Initialize 注册span的开始、结束回调
+func (p *tracePlugin) Initialize(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if err := callbacks.Create().Before("gorm:create").Register("egorm:trace:before", p.before("create")); err != nil {
+		return err
+	}
+	if err := callbacks.Create().After("gorm:create").Register("egorm:trace:after", p.after); err != nil {
+		return err
+	}
+	if err := callbacks.Query().Before("gorm:query").Register("egorm:trace:before", p.before("query")); err != nil {
+		return err
+	}
+	if err := callbacks.Query().After("gorm:query").Register("egorm:trace:after", p.after); err != nil {
+		return err
+	}
+	if err := callbacks.Update().Before("gorm:update").Register("egorm:trace:before", p.before("update")); err != nil {
+		return err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("egorm:trace:after", p.after); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().Before("gorm:delete").Register("egorm:trace:before", p.before("delete")); err != nil {
+		return err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("egorm:trace:after", p.after); err != nil {
+		return err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("egorm:trace:before", p.before("row")); err != nil {
+		return err
+	}
+	if err := callbacks.Row().After("gorm:row").Register("egorm:trace:after", p.after); err != nil {
+		return err
+	}
+	if err := callbacks.Raw().Before("gorm:raw").Register("egorm:trace:before", p.before("raw")); err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("egorm:trace:after", p.after)
+}
+
+func (p *tracePlugin) before(op string) func(db *gorm.DB) {
+	operation := "gorm:" + op
+	return func(db *gorm.DB) {
+		if db.Statement.Context == nil {
+			return
+		}
+		ctx, span := p.tracer.Start(db.Statement.Context, operation, nil, trace.WithAttributes(p.attrs...))
+		db.Statement.Context = ctx
+		db.InstanceSet(traceSpanKey, span)
+	}
+}
+
+func (p *tracePlugin) after(db *gorm.DB) {
+	value, ok := db.InstanceGet(traceSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := value.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	sql := db.Statement.SQL.String()
+	span.SetAttributes(
+		semconv.DBSystemKey.String(db.Dialector.Name()),
+		semconv.DBStatementKey.String(sanitizeSQL(sql)),
+		semconv.DBOperationKey.String(sqlOperation(sql)),
+		semconv.DBSQLTableKey.String(db.Statement.Table),
+		attribute.Int64("db.rows_affected", db.RowsAffected),
+	)
+	if db.Error != nil && db.Error != ErrRecordNotFound {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+		return
+	}
+	span.SetStatus(codes.Ok, "OK")
+}
+
+// sanitizeSQL 将SQL中的字符串、数字字面量替换为?，避免原生SQL中的敏感数据写入链路
+func sanitizeSQL(sql string) string {
+	sql = sqlStringLiteral.ReplaceAllString(sql, "?")
+	return sqlNumberLiteral.ReplaceAllString(sql, "?")
+}
+
+// sqlOperation 返回SQL的第一个关键字，如SELECT、INSERT
+func sqlOperation(sql string) string {
+	sql = strings.TrimSpace(sql)
+	if i := strings.IndexAny(sql, " \t\n"); i > 0 {
+		sql = sql[:i]
+	}
+	return strings.ToUpper(sql)
+}
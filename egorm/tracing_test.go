@@ -0,0 +1,46 @@
+package egorm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotomicro/ego-component/egorm/manager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestTracePlugin(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(newTracePlugin(&manager.DSN{Addr: "127.0.0.1:3306", Net: "tcp", DBName: "test", User: "root"})))
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	db.WithContext(ctx).Exec("UPDATE users SET name = 'alice', age = 18 WHERE id = ?", 1)
+	parent.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	span := spans[0]
+	assert.Equal(t, "gorm:raw", span.Name())
+	assert.Equal(t, parent.SpanContext().TraceID(), span.SpanContext().TraceID())
+	assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	assert.Equal(t, "UPDATE users SET name = ?, age = ? WHERE id = ?", attrs[semconv.DBStatementKey].AsString())
+	assert.Equal(t, "UPDATE", attrs[semconv.DBOperationKey].AsString())
+	assert.Equal(t, "127.0.0.1", attrs[semconv.NetPeerNameKey].AsString())
+	assert.Equal(t, int64(3306), attrs[semconv.NetPeerPortKey].AsInt64())
+}
@@ -0,0 +1,93 @@
+package egorm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultBulkChunkSize 批量写入时每批的默认行数
+const DefaultBulkChunkSize = 500
+
+// BulkOption 批量写入的可选项
+type BulkOption func(o *bulkOptions)
+
+type bulkOptions struct {
+	chunkSize int
+}
+
+// BulkChunkSize 设置每批写入的行数，默认500
+func BulkChunkSize(size int) BulkOption {
+	return func(o *bulkOptions) {
+		o.chunkSize = size
+	}
+}
+
+// ChunkError 一批数据写入失败
+type ChunkError struct {
+	Offset int // 该批第一行在rows中的下标
+	Size   int // 该批的行数
+	Err    error
+}
+
+// BulkError 部分批次写入失败，其他批次已经写入
+type BulkError struct {
+	Chunks []ChunkError
+}
+
+func (e *BulkError) Error() string {
+	msgs := make([]string, 0, len(e.Chunks))
+	for _, c := range e.Chunks {
+		msgs = append(msgs, fmt.Sprintf("rows[%d:%d]: %v", c.Offset, c.Offset+c.Size, c.Err))
+	}
+	return fmt.Sprintf("egorm: bulk upsert failed in %d chunks, %s", len(e.Chunks), strings.Join(msgs, "; "))
+}
+
+// BulkUpsert 分批写入rows，conflictColumns上的唯一键冲突时更新updateColumns，updateColumns为空时忽略冲突的行。
+// 根据数据库生成 ON DUPLICATE KEY UPDATE（MySQL）、ON CONFLICT（PostgreSQL）或 MERGE（SQL Server）语句。
+// 每批在单独的语句中执行，某批失败时继续写入后续批次，返回写入的行数和*BulkError
+//
+//	affected, err := egorm.BulkUpsert(ctx, db, users, []string{"uid"}, []string{"nickname", "updated_at"})
+func BulkUpsert[T any](ctx context.Context, db *Component, rows []T, conflictColumns []string, updateColumns []string, opts ...BulkOption) (int64, error) {
+	options := bulkOptions{chunkSize: DefaultBulkChunkSize}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.chunkSize <= 0 {
+		options.chunkSize = DefaultBulkChunkSize
+	}
+
+	onConflict := clause.OnConflict{DoNothing: len(updateColumns) == 0}
+	for _, column := range conflictColumns {
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: column})
+	}
+	if len(updateColumns) > 0 {
+		onConflict.DoUpdates = clause.AssignmentColumns(updateColumns)
+	}
+
+	var (
+		affected int64
+		bulkErr  BulkError
+	)
+	tx := db.WithContext(ctx).Clauses(onConflict).Session(&gorm.Session{})
+	for offset := 0; offset < len(rows); offset += options.chunkSize {
+		end := offset + options.chunkSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		chunk := rows[offset:end]
+		result := tx.Create(&chunk)
+		if result.Error != nil {
+			bulkErr.Chunks = append(bulkErr.Chunks, ChunkError{Offset: offset, Size: len(chunk), Err: result.Error})
+			continue
+		}
+		affected += result.RowsAffected
+	}
+	if len(bulkErr.Chunks) > 0 {
+		return affected, &bulkErr
+	}
+	return affected, nil
+}
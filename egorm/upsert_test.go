@@ -0,0 +1,28 @@
+package egorm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+func TestBulkUpsert(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "root@tcp(127.0.0.1:3306)/test", SkipInitializeWithVersion: true}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	require.NoError(t, err)
+	var sqls []string
+	require.NoError(t, db.Callback().Create().After("gorm:create").Register("test:sql", func(db *gorm.DB) {
+		sqls = append(sqls, db.Statement.SQL.String())
+	}))
+
+	rows := []project{{ID: 1, TenantID: 1, Name: "a"}, {ID: 2, TenantID: 1, Name: "b"}, {ID: 3, TenantID: 1, Name: "c"}}
+	_, err = BulkUpsert(context.Background(), db, rows, []string{"id"}, []string{"name"}, BulkChunkSize(2))
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"INSERT INTO `projects` (`tenant_id`,`name`,`id`) VALUES (?,?,?),(?,?,?) ON DUPLICATE KEY UPDATE `name`=VALUES(`name`)",
+		"INSERT INTO `projects` (`tenant_id`,`name`,`id`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE `name`=VALUES(`name`)",
+	}, sqls)
+}
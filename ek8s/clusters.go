@@ -0,0 +1,44 @@
+package ek8s
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gotomicro/ego/core/econf"
+)
+
+// components 已经构建的组件，key为配置key或者集群名称
+var components sync.Map
+
+// Get 获取已经构建的组件，name为Load的配置key，或者LoadClusters中的集群名称，不存在时返回nil
+func Get(name string) *Component {
+	v, ok := components.Load(name)
+	if !ok {
+		return nil
+	}
+	return v.(*Component)
+}
+
+// LoadClusters 构建key下的多个集群，返回以集群名称为key的组件，之后可以通过Get(集群名称)获取。
+// 如以下配置可以通过Get("local")、Get("prod")获取：
+//
+//	[k8s.local] # 不配置kubeconfig时使用in-cluster配置
+//	namespaces = ["default"]
+//	[k8s.prod]
+//	kubeconfig = "~/.kube/config"
+//	context = "prod"
+//	namespaces = ["app"]
+func LoadClusters(key string, options ...Option) map[string]*Component {
+	names := make([]string, 0)
+	for name := range econf.GetStringMap(key) {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	clusters := make(map[string]*Component, len(names))
+	for _, name := range names {
+		cc := Load(key + "." + name).Build(options...)
+		components.Store(name, cc)
+		clusters[name] = cc
+	}
+	return clusters
+}
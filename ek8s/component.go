@@ -3,6 +3,7 @@ package ek8s
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"sync"
 	"time"
 
@@ -10,15 +11,22 @@ import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/transport"
 )
 
 const PackageName = "component.ek8s"
 const defaultResync = 5 * time.Minute
 
 const (
-	KindPods      = "pods"
-	KindEndpoints = "endpoints"
+	KindPods           = "pods"
+	KindEndpoints      = "endpoints"
+	KindEndpointSlices = "endpointslices"
 )
 
 type (
@@ -32,6 +40,16 @@ type Component struct {
 	*kubernetes.Clientset
 	logger *elog.Component
 	locker sync.RWMutex
+	// factories 每个命名空间共享的informer factory，多个watch共用同一个连接和缓存
+	factories map[string]informers.SharedInformerFactory
+	// dispatchers 每个informer的事件分发器，watch结束后可以移除回调
+	dispatchers map[cache.SharedIndexInformer]*eventDispatcher
+	stopCh      chan struct{}
+	closeOnce   sync.Once
+
+	restConfig       *rest.Config
+	dynamic          dynamic.Interface
+	dynamicFactories map[string]dynamicinformer.DynamicSharedInformerFactory
 }
 
 type KubernetesEvent struct {
@@ -41,15 +59,33 @@ type KubernetesEvent struct {
 
 // New ...
 func newComponent(name string, config *Config, logger *elog.Component) *Component {
-	client, err := kubernetes.NewForConfig(config.toRestConfig())
+	restConfig, err := config.toRestConfig()
+	if err != nil {
+		logger.Panic("new component rest config err", elog.FieldErr(err))
+	}
+	restConfig.WrapTransport = transport.Wrappers(restConfig.WrapTransport, func(rt http.RoundTripper) http.RoundTripper {
+		return &watchMetricTransport{name: name, rt: rt}
+	})
+	client, err := kubernetes.NewForConfig(restConfig)
 	if err != nil {
 		logger.Panic("new component err", elog.FieldErr(err))
 	}
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		logger.Panic("new component dynamic client err", elog.FieldErr(err))
+	}
 	return &Component{
-		name:      name,
-		config:    config,
-		logger:    logger,
-		Clientset: client,
+		name:        name,
+		config:      config,
+		logger:      logger,
+		Clientset:   client,
+		factories:   make(map[string]informers.SharedInformerFactory),
+		dispatchers: make(map[cache.SharedIndexInformer]*eventDispatcher),
+		stopCh:      make(chan struct{}),
+
+		restConfig:       restConfig,
+		dynamic:          dynamicClient,
+		dynamicFactories: make(map[string]dynamicinformer.DynamicSharedInformerFactory),
 	}
 }
 
@@ -57,6 +93,14 @@ func (c *Component) Config() Config {
 	return *c.config
 }
 
+// Close 停止组件创建的所有informer，WatchServiceAddresses、WatchEndpoints不再回调，之后再调用返回ErrClosed
+func (c *Component) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.stopCh)
+	})
+	return nil
+}
+
 func (c *Component) ListPods(option ListOptions) (pods []*v1.PodList, err error) {
 	pods = make([]*v1.PodList, 0)
 	for _, ns := range c.config.Namespaces {
@@ -0,0 +1,217 @@
+package conf
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/econf/manager"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/spf13/cast"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/gotomicro/ego-component/ek8s"
+)
+
+const (
+	kindConfigMap = "configmap"
+	kindSecret    = "secret"
+	// readTimeout 读取配置的超时时间
+	readTimeout = 10 * time.Second
+)
+
+// dataSource ConfigMap、Secret中某个key的配置
+type dataSource struct {
+	kind        string
+	namespace   string
+	name        string
+	key         string
+	configType  econf.ConfigType
+	enableWatch bool
+	mu          sync.Mutex
+	digest      [32]byte // 最近一次ReadConfig返回的内容摘要，内容没有变化的事件不通知
+	changed     chan struct{}
+	ctx         context.Context
+	cancel      context.CancelFunc
+	logger      *elog.Component
+	k8s         *ek8s.Component
+}
+
+func init() {
+	manager.Register("k8s", &dataSource{})
+}
+
+// Parse 解析配置
+// ConfigMap k8s://configmap/default/app-config?key=config.toml
+// Secret k8s://secret/default/app-secret?key=config.toml&configType=toml
+// configType为空时根据key的后缀判断；默认使用in-cluster的地址和token，可以通过addr、token、insecure或者kubeconfig、context参数指定
+func (fp *dataSource) Parse(path string, watch bool) econf.ConfigType {
+	fp.logger = elog.EgoLogger.With(elog.FieldComponent(econf.PackageName))
+
+	urlInfo, err := url.Parse(path)
+	if err != nil {
+		fp.logger.Panic("new datasource", elog.FieldErr(err))
+		return ""
+	}
+
+	fp.kind = urlInfo.Host
+	if fp.kind != kindConfigMap && fp.kind != kindSecret {
+		fp.logger.Panic("kind must be configmap or secret", elog.String("kind", fp.kind))
+	}
+	segments := strings.Split(strings.Trim(urlInfo.Path, "/"), "/")
+	if len(segments) != 2 || segments[0] == "" || segments[1] == "" {
+		fp.logger.Panic("path must be /namespace/name", elog.String("path", urlInfo.Path))
+	}
+	fp.namespace, fp.name = segments[0], segments[1]
+
+	fp.key = urlInfo.Query().Get("key")
+	if fp.key == "" {
+		fp.logger.Panic("key is empty")
+	}
+	configType := urlInfo.Query().Get("configType")
+	if configType == "" {
+		configType = strings.TrimPrefix(filepath.Ext(fp.key), ".")
+	}
+	if configType == "" {
+		fp.logger.Panic("configType is empty")
+	}
+
+	options := []ek8s.Option{ek8s.WithNamespaces([]string{fp.namespace})}
+	if addr := urlInfo.Query().Get("addr"); addr != "" {
+		options = append(options, ek8s.WithAddr(addr))
+	}
+	if token := urlInfo.Query().Get("token"); token != "" {
+		options = append(options, ek8s.WithToken(token))
+	}
+	if kubeconfig := urlInfo.Query().Get("kubeconfig"); kubeconfig != "" {
+		options = append(options, ek8s.WithKubeconfig(kubeconfig), ek8s.WithContext(urlInfo.Query().Get("context")))
+	}
+	if insecure := urlInfo.Query().Get("insecure"); insecure != "" {
+		options = append(options, ek8s.WithTLSClientConfigInsecure(cast.ToBool(insecure)))
+	}
+	fp.k8s = ek8s.DefaultContainer().Build(options...)
+
+	fp.configType = econf.ConfigType(configType)
+	fp.enableWatch = watch
+	fp.ctx, fp.cancel = context.WithCancel(context.Background())
+
+	if watch {
+		fp.changed = make(chan struct{}, 1)
+		fp.watch()
+	}
+	return fp.configType
+}
+
+// ReadConfig ...
+func (fp *dataSource) ReadConfig() (content []byte, err error) {
+	content, err = fp.read()
+	if err != nil {
+		return nil, err
+	}
+	fp.mu.Lock()
+	fp.digest = sha256.Sum256(content)
+	fp.mu.Unlock()
+	return content, nil
+}
+
+// read 从apiserver读取配置内容
+func (fp *dataSource) read() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(fp.ctx, readTimeout)
+	defer cancel()
+	switch fp.kind {
+	case kindSecret:
+		secret, err := fp.k8s.CoreV1().Secrets(fp.namespace).Get(ctx, fp.name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := secret.Data[fp.key]; ok {
+			return value, nil
+		}
+		if value, ok := secret.StringData[fp.key]; ok {
+			return []byte(value), nil
+		}
+	default:
+		configMap, err := fp.k8s.CoreV1().ConfigMaps(fp.namespace).Get(ctx, fp.name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := configMap.Data[fp.key]; ok {
+			return []byte(value), nil
+		}
+		if value, ok := configMap.BinaryData[fp.key]; ok {
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("key %s not found in %s %s/%s", fp.key, fp.kind, fp.namespace, fp.name)
+}
+
+// Close ...
+func (fp *dataSource) Close() error {
+	if fp.cancel != nil {
+		fp.cancel()
+	}
+	return nil
+}
+
+// IsConfigChanged ...
+func (fp *dataSource) IsConfigChanged() <-chan struct{} {
+	return fp.changed
+}
+
+// notifyIfChanged 读取最新的配置，内容与上一次ReadConfig不同时才通知econf重新加载
+func (fp *dataSource) notifyIfChanged() {
+	content, err := fp.read()
+	if err != nil {
+		fp.logger.Error("read config", elog.FieldErr(err), elog.FieldKey(fp.key))
+		return
+	}
+	fp.mu.Lock()
+	unchanged := sha256.Sum256(content) == fp.digest
+	fp.mu.Unlock()
+	if unchanged {
+		return
+	}
+	select {
+	case fp.changed <- struct{}{}:
+	default:
+	}
+}
+
+// watch 只监听指定名称的ConfigMap、Secret，informer断开后会自动重新list、watch
+func (fp *dataSource) watch() {
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		fp.k8s.Clientset,
+		0,
+		informers.WithNamespace(fp.namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.FieldSelector = "metadata.name=" + fp.name
+		}),
+	)
+	var informer cache.SharedIndexInformer
+	if fp.kind == kindSecret {
+		informer = factory.Core().V1().Secrets().Informer()
+	} else {
+		informer = factory.Core().V1().ConfigMaps().Informer()
+	}
+	onEvent := func(interface{}) {
+		fp.notifyIfChanged()
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: onEvent,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			onEvent(newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			fp.logger.Warn("config deleted", elog.String("kind", fp.kind), elog.String("namespace", fp.namespace), elog.String("name", fp.name))
+		},
+	})
+	factory.Start(fp.ctx.Done())
+}
@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
 )
 
 // Config ...
@@ -17,6 +19,8 @@ type Config struct {
 	Namespaces              []string
 	DeploymentPrefix        string // 命名前缀
 	TLSClientConfigInsecure bool
+	Kubeconfig              string // kubeconfig文件路径，支持~，不为空时使用kubeconfig中的地址、证书，忽略Addr、Token
+	Context                 string // kubeconfig中的context，默认为current-context
 }
 
 // DefaultConfig 返回默认配置
@@ -29,14 +33,28 @@ func DefaultConfig() *Config {
 	}
 }
 
-func (c *Config) toRestConfig() *rest.Config {
+func (c *Config) toRestConfig() (*rest.Config, error) {
+	if c.Kubeconfig != "" {
+		path := c.Kubeconfig
+		if strings.HasPrefix(path, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			path = filepath.Join(home, path[2:])
+		}
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			&clientcmd.ClientConfigLoadingRules{ExplicitPath: path},
+			&clientcmd.ConfigOverrides{CurrentContext: c.Context},
+		).ClientConfig()
+	}
 	return &rest.Config{
 		Host:        c.Addr,
 		BearerToken: c.Token,
 		TLSClientConfig: rest.TLSClientConfig{
 			Insecure: c.TLSClientConfigInsecure,
 		},
-	}
+	}, nil
 }
 
 func inClusterAddr() string {
@@ -35,5 +35,8 @@ func (c *Container) Build(options ...Option) *Component {
 		option(c)
 	}
 	cc := newComponent(c.name, c.config, c.logger)
+	if c.name != "" {
+		components.Store(c.name, cc)
+	}
 	return cc
 }
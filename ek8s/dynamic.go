@@ -0,0 +1,77 @@
+package ek8s
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+)
+
+type (
+	GroupVersionResource = schema.GroupVersionResource
+	Unstructured         = unstructured.Unstructured
+)
+
+// RestConfig 返回组件使用的rest.Config的副本，用于创建code-generator生成的CRD clientset和informer factory，
+// 如versioned.NewForConfig(k8s.RestConfig())
+func (c *Component) RestConfig() *rest.Config {
+	return rest.CopyConfig(c.restConfig)
+}
+
+// Dynamic 返回dynamic client，用于读写没有生成clientset的CRD
+func (c *Component) Dynamic() dynamic.Interface {
+	return c.dynamic
+}
+
+// DynamicInformerFactory 返回命名空间共享的dynamic informer factory，namespace为空时监听所有命名空间。
+// 通过ForResource获取informer后需要调用Start
+func (c *Component) DynamicInformerFactory(namespace string) dynamicinformer.DynamicSharedInformerFactory {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if factory, ok := c.dynamicFactories[namespace]; ok {
+		return factory
+	}
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(c.dynamic, defaultResync, namespace, nil)
+	c.dynamicFactories[namespace] = factory
+	return factory
+}
+
+// WatchResource 监听gvr对应的资源，如CRD，handler收到的对象为*unstructured.Unstructured，可以通过FromUnstructured转换为结构体。
+// 等待缓存同步后返回lister；namespace为空时监听所有命名空间
+func (c *Component) WatchResource(ctx context.Context, gvr GroupVersionResource, namespace string, handler cache.ResourceEventHandler) (cache.GenericLister, error) {
+	factory := c.DynamicInformerFactory(namespace)
+	informer := factory.ForResource(gvr)
+	informer.Informer().AddEventHandler(handler)
+	factory.Start(c.stopCh)
+	if !cache.WaitForCacheSync(ctx.Done(), informer.Informer().HasSynced) {
+		return nil, fmt.Errorf("wait %s cache sync in namespace (%s), err: %w", gvr.String(), namespace, ctx.Err())
+	}
+	return informer.Lister(), nil
+}
+
+// FromUnstructured 将dynamic client、informer返回的对象转换为结构体，out为结构体指针
+func FromUnstructured(obj interface{}, out interface{}) error {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return fmt.Errorf("object %T is not *unstructured.Unstructured", obj)
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(u.UnstructuredContent(), out)
+}
+
+// ToUnstructured 将结构体转换为dynamic client可以写入的对象，obj需要设置apiVersion、kind
+func ToUnstructured(obj interface{}) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
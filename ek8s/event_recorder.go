@@ -0,0 +1,84 @@
+package ek8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/gotomicro/ego/core/eapp"
+	"github.com/gotomicro/ego/core/elog"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// EventRecorder 在当前Pod上记录Kubernetes事件，kubectl describe pod可以看到，同时记录到elog
+type EventRecorder struct {
+	logger      *elog.Component
+	broadcaster record.EventBroadcaster
+	recorder    record.EventRecorder
+	ref         *v1.ObjectReference
+}
+
+// NewEventRecorder 创建当前Pod的事件记录器，component为事件的来源，为空时使用应用名。
+// Pod名称取POD_NAME环境变量或者hostname，命名空间取POD_NAMESPACE环境变量或者Namespaces中的第一个，
+// 需要有get pods、create events、patch events的权限
+func (c *Component) NewEventRecorder(component string) (*EventRecorder, error) {
+	if component == "" {
+		component = eapp.Name()
+	}
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" && len(c.config.Namespaces) > 0 {
+		namespace = c.config.Namespaces[0]
+	}
+	pod, err := c.CoreV1().Pods(namespace).Get(context.Background(), podIdentity(), metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get current pod in namespace (%s), err: %w", namespace, err)
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: c.CoreV1().Events(namespace)})
+	return &EventRecorder{
+		logger:      c.logger.With(elog.String("pod", pod.Name)),
+		broadcaster: broadcaster,
+		recorder:    broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: component, Host: pod.Spec.NodeName}),
+		ref: &v1.ObjectReference{
+			Kind:            "Pod",
+			APIVersion:      "v1",
+			Namespace:       pod.Namespace,
+			Name:            pod.Name,
+			UID:             pod.UID,
+			ResourceVersion: pod.ResourceVersion,
+		},
+	}, nil
+}
+
+// Normal 记录Normal事件，reason为大驼峰的简短原因，如ConsumerRebalanced
+func (r *EventRecorder) Normal(reason string, message string, fields ...elog.Field) {
+	r.logger.Info(message, append(fields, elog.String("reason", reason))...)
+	r.recorder.Event(r.ref, v1.EventTypeNormal, reason, message)
+}
+
+// Warning 记录Warning事件，如Warning("CircuitOpen", "redis circuit open")
+func (r *EventRecorder) Warning(reason string, message string, fields ...elog.Field) {
+	r.logger.Warn(message, append(fields, elog.String("reason", reason))...)
+	r.recorder.Event(r.ref, v1.EventTypeWarning, reason, message)
+}
+
+// Normalf 记录Normal事件，message支持格式化
+func (r *EventRecorder) Normalf(reason string, format string, args ...interface{}) {
+	r.Normal(reason, fmt.Sprintf(format, args...))
+}
+
+// Warningf 记录Warning事件，message支持格式化
+func (r *EventRecorder) Warningf(reason string, format string, args ...interface{}) {
+	r.Warning(reason, fmt.Sprintf(format, args...))
+}
+
+// Close 停止发送事件，未发送的事件会丢弃
+func (r *EventRecorder) Close() error {
+	r.broadcaster.Shutdown()
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+
+	"github.com/gotomicro/ego"
+	"github.com/gotomicro/ego-component/ek8s"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+func main() {
+	if err := ego.New().Invoker(
+		invokerWatch,
+	).Run(); err != nil {
+		elog.Error("startup", elog.FieldErr(err))
+	}
+}
+
+func invokerWatch() error {
+	obj := ek8s.Load("k8s").Build()
+	return obj.WatchEndpoints(context.Background(), "svc-oss", "", func(added []ek8s.Address, removed []ek8s.Address) {
+		elog.Info("endpoints changed", elog.Any("added", added), elog.Any("removed", removed))
+	})
+}
@@ -0,0 +1,227 @@
+package ek8s
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// ExecOptions 在容器中执行命令的选项
+type ExecOptions struct {
+	Container string    // 容器名称，Pod只有一个容器时可以为空
+	Stdin     io.Reader // 可以为空
+	Stdout    io.Writer // 可以为空
+	Stderr    io.Writer // 可以为空，TTY为true时stderr合并到stdout
+	TTY       bool
+}
+
+// Exec 在Pod的容器中执行命令，等价于kubectl exec。
+// 命令退出码不为0时，返回的错误可以通过ExitCode获取退出码。
+// ctx结束时关闭连接，等待写入Stdout、Stderr的goroutine退出后返回ctx.Err()，返回后可以安全地读取Stdout、Stderr。
+// exec协议不支持向命令发送信号，连接关闭后命令的标准输入输出被关闭，大多数命令会因此退出，
+// 但忽略SIGPIPE、不读写标准输入输出的命令会继续执行，需要在命令中自行限制时间，如timeout 10 cmd
+func (c *Component) Exec(ctx context.Context, namespace string, pod string, command []string, opts ExecOptions) error {
+	req := c.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: opts.Container,
+			Command:   command,
+			Stdin:     opts.Stdin != nil,
+			Stdout:    opts.Stdout != nil,
+			Stderr:    opts.Stderr != nil && !opts.TTY,
+			TTY:       opts.TTY,
+		}, scheme.ParameterCodec)
+
+	transport, upgrader, err := spdy.RoundTripperFor(c.restConfig)
+	if err != nil {
+		return fmt.Errorf("exec in pod %s/%s, err: %w", namespace, pod, err)
+	}
+	cu := &cancelableUpgrader{Upgrader: upgrader}
+	executor, err := remotecommand.NewSPDYExecutorForTransports(transport, cu, http.MethodPost, req.URL())
+	if err != nil {
+		return fmt.Errorf("exec in pod %s/%s, err: %w", namespace, pod, err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- executor.Stream(remotecommand.StreamOptions{
+			Stdin:  opts.Stdin,
+			Stdout: opts.Stdout,
+			Stderr: opts.Stderr,
+			Tty:    opts.TTY,
+		})
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// 关闭连接后Stream返回，等待它不再写入Stdout、Stderr
+		cu.close()
+		<-done
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("exec in pod %s/%s, err: %w", namespace, pod, err)
+	}
+	return nil
+}
+
+// errExecCanceled 连接建立前ctx已经结束
+var errExecCanceled = errors.New("exec canceled")
+
+// cancelableUpgrader 记录升级后的连接，client-go的Stream不支持ctx，通过关闭连接使其返回
+type cancelableUpgrader struct {
+	spdy.Upgrader
+	mu     sync.Mutex
+	conn   httpstream.Connection
+	closed bool
+}
+
+// NewConnection ...
+func (u *cancelableUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.Upgrader.NewConnection(resp)
+	if err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.closed {
+		conn.Close()
+		return nil, errExecCanceled
+	}
+	u.conn = conn
+	return conn, nil
+}
+
+// close 关闭已经建立的连接，之后建立的连接会立即关闭
+func (u *cancelableUpgrader) close() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.closed {
+		return
+	}
+	u.closed = true
+	if u.conn != nil {
+		u.conn.Close()
+	}
+}
+
+// ExecOutput 在Pod的容器中执行命令，返回stdout、stderr
+func (c *Component) ExecOutput(ctx context.Context, namespace string, pod string, container string, command ...string) (stdout string, stderr string, err error) {
+	var outBuf, errBuf bytes.Buffer
+	err = c.Exec(ctx, namespace, pod, command, ExecOptions{
+		Container: container,
+		Stdout:    &outBuf,
+		Stderr:    &errBuf,
+	})
+	return outBuf.String(), errBuf.String(), err
+}
+
+// ExitCode 获取Exec返回的错误中命令的退出码，不是命令退出码不为0导致的错误时返回false
+func ExitCode(err error) (int, bool) {
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), true
+	}
+	return 0, false
+}
+
+// PortForwarder 端口转发，使用完需要调用Close
+type PortForwarder struct {
+	forwarder *portforward.PortForwarder
+	stopCh    chan struct{}
+	stopOnce  sync.Once
+	done      chan error
+}
+
+// ForwardedPort 转发的端口
+type ForwardedPort struct {
+	Local  uint16
+	Remote uint16
+}
+
+// PortForward 将本地端口转发到Pod的端口，等价于kubectl port-forward，ports如"8080:80"，":80"表示随机本地端口。
+// 转发就绪后返回，ctx结束后停止转发
+func (c *Component) PortForward(ctx context.Context, namespace string, pod string, ports ...string) (*PortForwarder, error) {
+	req := c.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(namespace).
+		Name(pod).
+		SubResource("portforward")
+
+	transport, upgrader, err := spdy.RoundTripperFor(c.restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("port forward to pod %s/%s, err: %w", namespace, pod, err)
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, http.MethodPost, req.URL())
+
+	p := &PortForwarder{
+		stopCh: make(chan struct{}),
+		done:   make(chan error, 1),
+	}
+	readyCh := make(chan struct{})
+	p.forwarder, err = portforward.New(dialer, ports, p.stopCh, readyCh, ioutil.Discard, ioutil.Discard)
+	if err != nil {
+		return nil, fmt.Errorf("port forward to pod %s/%s, err: %w", namespace, pod, err)
+	}
+	go func() {
+		p.done <- p.forwarder.ForwardPorts()
+		close(p.done)
+	}()
+
+	select {
+	case <-readyCh:
+	case err := <-p.done:
+		return nil, fmt.Errorf("port forward to pod %s/%s, err: %w", namespace, pod, err)
+	case <-ctx.Done():
+		p.Close()
+		return nil, ctx.Err()
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.Close()
+		case <-p.stopCh:
+		}
+	}()
+	return p, nil
+}
+
+// Ports 返回转发的端口，用于获取随机分配的本地端口
+func (p *PortForwarder) Ports() ([]ForwardedPort, error) {
+	ports, err := p.forwarder.GetPorts()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ForwardedPort, 0, len(ports))
+	for _, port := range ports {
+		out = append(out, ForwardedPort{Local: port.Local, Remote: port.Remote})
+	}
+	return out, nil
+}
+
+// Done 转发停止后返回错误，Close停止时为nil
+func (p *PortForwarder) Done() <-chan error {
+	return p.done
+}
+
+// Close 停止转发，可以多次调用
+func (p *PortForwarder) Close() {
+	p.stopOnce.Do(func() {
+		close(p.stopCh)
+	})
+}
@@ -0,0 +1,64 @@
+package ek8s
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+)
+
+// fakeConnection 只记录Close的次数
+type fakeConnection struct {
+	httpstream.Connection
+	closed int32
+}
+
+func (c *fakeConnection) Close() error {
+	atomic.AddInt32(&c.closed, 1)
+	return nil
+}
+
+type fakeUpgrader struct {
+	conn *fakeConnection
+	err  error
+}
+
+func (u *fakeUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	if u.err != nil {
+		return nil, u.err
+	}
+	return u.conn, nil
+}
+
+func TestCancelableUpgrader(t *testing.T) {
+	conn := &fakeConnection{}
+	u := &cancelableUpgrader{Upgrader: &fakeUpgrader{conn: conn}}
+	got, err := u.NewConnection(nil)
+	require.NoError(t, err)
+	assert.Equal(t, conn, got)
+	assert.Zero(t, atomic.LoadInt32(&conn.closed))
+
+	// 取消时关闭已经建立的连接，只关闭一次
+	u.close()
+	u.close()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conn.closed))
+}
+
+func TestCancelableUpgraderClosedBeforeConnect(t *testing.T) {
+	conn := &fakeConnection{}
+	u := &cancelableUpgrader{Upgrader: &fakeUpgrader{conn: conn}}
+	u.close()
+	_, err := u.NewConnection(nil)
+	assert.Equal(t, errExecCanceled, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&conn.closed))
+
+	errUpgrade := errors.New("upgrade failed")
+	u = &cancelableUpgrader{Upgrader: &fakeUpgrader{err: errUpgrade}}
+	_, err = u.NewConnection(nil)
+	assert.Equal(t, errUpgrade, err)
+	u.close()
+}
@@ -0,0 +1,153 @@
+package ek8s
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// LeaderElectionConfig 基于coordination.k8s.io Lease的选主配置
+type LeaderElectionConfig struct {
+	LeaseName        string                    // Lease的名称，同一组竞争者使用相同的名称
+	Namespace        string                    // Lease所在的命名空间，默认为Namespaces中的第一个
+	Identity         string                    // 竞争者的标识，默认为POD_NAME环境变量，没有时使用hostname（即Pod名称）
+	LeaseDuration    time.Duration             // 非leader等待多久后可以抢占，默认15s
+	RenewDeadline    time.Duration             // leader续约的超时时间，超过后放弃leader，默认10s
+	RetryPeriod      time.Duration             // 竞争、续约的间隔，默认2s
+	ReleaseOnCancel  bool                      // ctx结束时主动释放Lease，使其他竞争者可以立即成为leader；OnStartedLeading需要在ctx结束时退出
+	OnStartedLeading func(ctx context.Context) // 成为leader后调用，ctx在失去leader时结束
+	OnStoppedLeading func()                    // 失去leader时调用，只有成为过leader才会调用
+	OnNewLeader      func(identity string)     // leader变化时调用，可以为空
+}
+
+// LeaderElector 选主
+type LeaderElector struct {
+	config  LeaderElectionConfig
+	logger  *elog.Component
+	elector *leaderelection.LeaderElector
+	leading int32
+}
+
+// NewLeaderElector 创建选主，调用Run开始竞争
+func (c *Component) NewLeaderElector(config LeaderElectionConfig) (*LeaderElector, error) {
+	if config.LeaseName == "" {
+		return nil, fmt.Errorf("new leader elector, lease name is empty")
+	}
+	if config.Namespace == "" && len(c.config.Namespaces) > 0 {
+		config.Namespace = c.config.Namespaces[0]
+	}
+	if config.Identity == "" {
+		config.Identity = podIdentity()
+	}
+	if config.LeaseDuration == 0 {
+		config.LeaseDuration = 15 * time.Second
+	}
+	if config.RenewDeadline == 0 {
+		config.RenewDeadline = 10 * time.Second
+	}
+	if config.RetryPeriod == 0 {
+		config.RetryPeriod = 2 * time.Second
+	}
+
+	le := &LeaderElector{
+		config: config,
+		logger: c.logger.With(elog.String("lease", config.Namespace+"/"+config.LeaseName), elog.String("identity", config.Identity)),
+	}
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Name:      config.LeaseName,
+				Namespace: config.Namespace,
+			},
+			Client:     c.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: config.Identity},
+		},
+		LeaseDuration:   config.LeaseDuration,
+		RenewDeadline:   config.RenewDeadline,
+		RetryPeriod:     config.RetryPeriod,
+		ReleaseOnCancel: config.ReleaseOnCancel,
+		Name:            config.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: le.onStartedLeading,
+			OnStoppedLeading: le.onStoppedLeading,
+			OnNewLeader:      le.onNewLeader,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("new leader elector, err: %w", err)
+	}
+	le.elector = elector
+	return le, nil
+}
+
+// Run 开始竞争leader，阻塞直到ctx结束；失去leader后会重新参与竞争
+func (le *LeaderElector) Run(ctx context.Context) {
+	for {
+		le.elector.Run(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+	}
+}
+
+// IsLeader 当前是否为leader
+func (le *LeaderElector) IsLeader() bool {
+	return le.elector.IsLeader()
+}
+
+// GetLeader 最近一次观察到的leader的标识
+func (le *LeaderElector) GetLeader() string {
+	return le.elector.GetLeader()
+}
+
+// Identity 当前竞争者的标识
+func (le *LeaderElector) Identity() string {
+	return le.config.Identity
+}
+
+func (le *LeaderElector) onStartedLeading(ctx context.Context) {
+	atomic.StoreInt32(&le.leading, 1)
+	le.logger.Info("started leading")
+	if le.config.OnStartedLeading != nil {
+		le.config.OnStartedLeading(ctx)
+	}
+}
+
+// onStoppedLeading client-go在Run退出时总会调用，只有成为过leader才回调
+func (le *LeaderElector) onStoppedLeading() {
+	if !atomic.CompareAndSwapInt32(&le.leading, 1, 0) {
+		return
+	}
+	le.logger.Warn("stopped leading")
+	if le.config.OnStoppedLeading != nil {
+		le.config.OnStoppedLeading()
+	}
+}
+
+func (le *LeaderElector) onNewLeader(identity string) {
+	le.logger.Info("new leader", elog.String("leader", identity))
+	if le.config.OnNewLeader != nil {
+		le.config.OnNewLeader(identity)
+	}
+}
+
+// podIdentity 优先使用通过Downward API注入的POD_NAME，没有时使用hostname
+func podIdentity() string {
+	if name := os.Getenv("POD_NAME"); name != "" {
+		return name
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fmt.Sprintf("ego-%d", time.Now().UnixNano())
+	}
+	return hostname
+}
@@ -38,3 +38,15 @@ func WithTLSClientConfigInsecure(insecure bool) Option {
 		c.config.TLSClientConfigInsecure = insecure
 	}
 }
+
+func WithKubeconfig(kubeconfig string) Option {
+	return func(c *Container) {
+		c.config.Kubeconfig = kubeconfig
+	}
+}
+
+func WithContext(context string) Option {
+	return func(c *Container) {
+		c.config.Context = context
+	}
+}
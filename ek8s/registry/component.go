@@ -11,6 +11,7 @@ import (
 	"github.com/gotomicro/ego/core/eregistry"
 	"github.com/gotomicro/ego/server"
 	"go.uber.org/zap"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/watch"
 
@@ -94,6 +95,27 @@ func (reg *Component) ListServices(ctx context.Context, t eregistry.Target) (ser
 		}
 		elog.Debug("ListServices", zap.Any("services", services))
 		return
+	case ek8s.KindEndpointSlices:
+		for _, ns := range reg.client.Config().Namespaces {
+			slices, listErr := reg.client.DiscoveryV1().EndpointSlices(ns).List(ctx, metav1.ListOptions{
+				LabelSelector: discoveryv1.LabelServiceName + "=" + reg.client.Config().DeploymentPrefix + appName,
+			})
+			if listErr != nil {
+				reg.logger.Error("watch request err", elog.FieldErrKind("request err"), elog.FieldErr(listErr), elog.FieldAddr(appName))
+				return nil, listErr
+			}
+			for _, slice := range slices.Items {
+				for _, endpoint := range slice.Endpoints {
+					if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+						continue
+					}
+					for _, ip := range endpoint.Addresses {
+						services = append(services, &server.ServiceInfo{Address: ip + ":" + port})
+					}
+				}
+			}
+		}
+		return
 	default:
 		elog.Error("list services error", zap.String("kind", reg.config.Kind))
 	}
@@ -107,6 +129,10 @@ func (reg *Component) WatchServices(ctx context.Context, t eregistry.Target) (ch
 		return nil, err
 	}
 
+	if reg.config.Kind == ek8s.KindEndpoints || reg.config.Kind == ek8s.KindEndpointSlices {
+		return reg.watchServiceAddresses(ctx, appName, port)
+	}
+
 	app, err := reg.client.NewWatcherApp(ctx, appName, reg.config.Kind)
 	if err != nil {
 		return nil, err
@@ -166,6 +192,39 @@ func (reg *Component) WatchServices(ctx context.Context, t eregistry.Target) (ch
 	return addresses, nil
 }
 
+// watchServiceAddresses 通过共享的informer监听Endpoints、EndpointSlices，地址变化时立即推送给resolver
+func (reg *Component) watchServiceAddresses(ctx context.Context, appName string, port string) (chan eregistry.Endpoints, error) {
+	var addresses = make(chan eregistry.Endpoints, 10)
+	err := reg.client.WatchServiceAddresses(ctx, appName, reg.config.Kind, func(addrs []ek8s.Address) {
+		var al = &eregistry.Endpoints{
+			Nodes:           make(map[string]server.ServiceInfo),
+			RouteConfigs:    make(map[string]eregistry.RouteConfig),
+			ConsumerConfigs: make(map[string]eregistry.ConsumerConfig),
+			ProviderConfigs: make(map[string]eregistry.ProviderConfig),
+		}
+		for _, addr := range addrs {
+			reg.addAddrList(al, []string{addr.IP + ":" + port})
+		}
+		reg.logger.Info("update addresses", zap.String("appName", appName), zap.Any("addresses", *al))
+		// 只保留最新的地址，resolver来不及消费时丢弃旧的地址
+		for {
+			select {
+			case addresses <- *al:
+				return
+			default:
+			}
+			select {
+			case <-addresses:
+			default:
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
 func (reg *Component) SyncServices(context.Context, eregistry.SyncServicesOptions) error {
 	return nil
 }
@@ -189,6 +248,15 @@ func (reg *Component) IsValid(ctx context.Context) error {
 				return fmt.Errorf("k8s component watch pod fail, %w", err)
 			}
 		}
+	} else if reg.config.Kind == ek8s.KindEndpointSlices {
+		for _, ns := range reg.client.Config().Namespaces {
+			if _, err := reg.client.DiscoveryV1().EndpointSlices(ns).List(ctx, metav1.ListOptions{}); err != nil {
+				return fmt.Errorf("k8s component list endpointslices fail, %w", err)
+			}
+			if _, err := reg.client.DiscoveryV1().EndpointSlices(ns).Watch(ctx, metav1.ListOptions{}); err != nil {
+				return fmt.Errorf("k8s component watch endpointslices fail, %w", err)
+			}
+		}
 	} else if reg.config.Kind == ek8s.KindEndpoints {
 		for _, ns := range reg.client.Config().Namespaces {
 			if _, err := reg.client.CoreV1().Endpoints(ns).List(ctx, metav1.ListOptions{}); err != nil {
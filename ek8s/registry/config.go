@@ -7,7 +7,7 @@ import (
 // Config ...
 type Config struct {
 	Scheme       string
-	Kind         string
+	Kind         string // pods、endpoints、endpointslices，endpoints和endpointslices通过共享的informer监听，地址变化时立即推送
 	OnFailHandle string
 }
 
@@ -0,0 +1,270 @@
+package ek8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/gotomicro/ego/core/eregistry"
+	"github.com/gotomicro/ego/server"
+)
+
+// ShutdownCoordinator 优雅停止：标记未就绪、从注册中心注销、等待endpoints摘除、等待各组件处理完请求，整个过程不超过Timeout。
+// 可以通过ego.WithBeforeStopClean(coordinator.BeforeStop)接入ego的停止流程，
+// 也可以通过Watch监听SIGTERM，或者将PreStopHandler配置为Pod的preStop httpGet
+type ShutdownCoordinator struct {
+	logger       *elog.Component
+	timeout      time.Duration
+	preStopDelay time.Duration
+	notReady     int32
+	mu           sync.Mutex
+	registries   []shutdownRegistry
+	drainers     []shutdownDrainer
+	once         sync.Once
+	done         chan struct{}
+	err          error
+}
+
+type shutdownRegistry struct {
+	registry eregistry.Registry
+	services []*server.ServiceInfo
+}
+
+type shutdownDrainer struct {
+	name  string
+	drain func(ctx context.Context) error
+}
+
+// ShutdownOption 优雅停止的选项
+type ShutdownOption func(s *ShutdownCoordinator)
+
+// WithShutdownTimeout 整个停止过程的最长时间，需要小于Pod的terminationGracePeriodSeconds，默认25s
+func WithShutdownTimeout(timeout time.Duration) ShutdownOption {
+	return func(s *ShutdownCoordinator) {
+		s.timeout = timeout
+	}
+}
+
+// WithPreStopDelay 标记未就绪、注销后等待的时间，使kube-proxy、客户端有时间摘除该Pod，默认5s
+func WithPreStopDelay(delay time.Duration) ShutdownOption {
+	return func(s *ShutdownCoordinator) {
+		s.preStopDelay = delay
+	}
+}
+
+// NewShutdownCoordinator 创建优雅停止的协调者
+func NewShutdownCoordinator(opts ...ShutdownOption) *ShutdownCoordinator {
+	s := &ShutdownCoordinator{
+		logger:       elog.EgoLogger.With(elog.FieldComponent(PackageName)),
+		timeout:      25 * time.Second,
+		preStopDelay: 5 * time.Second,
+		done:         make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// AddRegistry 停止时从registry注销services，如eetcd、ek8s的registry
+func (s *ShutdownCoordinator) AddRegistry(registry eregistry.Registry, services ...*server.ServiceInfo) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.registries = append(s.registries, shutdownRegistry{registry: registry, services: services})
+}
+
+// AddDrainer 停止时等待drain返回，drain需要在ctx结束时尽快返回，如等待kafka消费者提交offset、连接池中的请求完成
+func (s *ShutdownCoordinator) AddDrainer(name string, drain func(ctx context.Context) error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drainers = append(s.drainers, shutdownDrainer{name: name, drain: drain})
+}
+
+// Ready 是否就绪，开始停止后返回false
+func (s *ShutdownCoordinator) Ready() bool {
+	return atomic.LoadInt32(&s.notReady) == 0
+}
+
+// Done 停止完成后关闭
+func (s *ShutdownCoordinator) Done() <-chan struct{} {
+	return s.done
+}
+
+// ReadinessHandler readinessProbe，开始停止后返回503
+func (s *ShutdownCoordinator) ReadinessHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// PreStopHandler 用于Pod的preStop httpGet，开始停止并等待完成后返回
+func (s *ShutdownCoordinator) PreStopHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Shutdown(context.Background()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// BeforeStop 用于ego.WithBeforeStopClean，ego停止server前完成注销和等待
+func (s *ShutdownCoordinator) BeforeStop() error {
+	return s.Shutdown(context.Background())
+}
+
+// Watch 监听信号，默认为SIGTERM、SIGINT，收到后开始停止；onDone在停止完成后调用，可以为空
+func (s *ShutdownCoordinator) Watch(onDone func(err error), signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGTERM, syscall.SIGINT}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	go func() {
+		sig := <-ch
+		signal.Stop(ch)
+		s.logger.Info("shutdown signal", elog.String("signal", sig.String()))
+		err := s.Shutdown(context.Background())
+		if onDone != nil {
+			onDone(err)
+		}
+	}()
+}
+
+// Shutdown 执行停止，多次调用只执行一次，后续调用等待第一次完成并返回相同的结果，ctx结束时不再等待
+func (s *ShutdownCoordinator) Shutdown(ctx context.Context) error {
+	// once.Do会阻塞并发的调用方直到停止完成，在goroutine中执行才能响应后续调用方的ctx
+	s.once.Do(func() {
+		go func() {
+			s.err = s.shutdown(ctx)
+			close(s.done)
+		}()
+	})
+	select {
+	case <-s.done:
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *ShutdownCoordinator) shutdown(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	beg := time.Now()
+
+	s.mu.Lock()
+	registries := append([]shutdownRegistry(nil), s.registries...)
+	drainers := append([]shutdownDrainer(nil), s.drainers...)
+	s.mu.Unlock()
+
+	// 1. 标记未就绪，readinessProbe失败后endpoints会摘除该Pod
+	atomic.StoreInt32(&s.notReady, 1)
+	s.logger.Info("shutdown mark not ready")
+
+	// 2. 从注册中心注销
+	var errs []error
+	for _, r := range registries {
+		for _, info := range r.services {
+			if err := r.registry.UnregisterService(ctx, info); err != nil {
+				s.logger.Error("shutdown unregister service", elog.FieldErr(err), elog.String("service", info.Name), elog.FieldAddr(info.Address))
+				errs = append(errs, fmt.Errorf("unregister %s, err: %w", info.Address, err))
+			}
+		}
+	}
+
+	// 3. 等待客户端感知到地址变化，不再发送新的请求
+	select {
+	case <-ctx.Done():
+	case <-time.After(s.preStopDelay):
+	}
+
+	// 4. 并发等待各组件处理完已有的请求
+	var (
+		wg   sync.WaitGroup
+		emu  sync.Mutex
+		left int32 = int32(len(drainers))
+	)
+	for _, d := range drainers {
+		wg.Add(1)
+		go func(d shutdownDrainer) {
+			defer wg.Done()
+			defer atomic.AddInt32(&left, -1)
+			if err := d.drain(ctx); err != nil {
+				s.logger.Error("shutdown drain", elog.FieldErr(err), elog.FieldName(d.name))
+				emu.Lock()
+				errs = append(errs, fmt.Errorf("drain %s, err: %w", d.name, err))
+				emu.Unlock()
+			}
+		}(d)
+	}
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-ctx.Done():
+		s.logger.Error("shutdown timeout", elog.FieldCost(time.Since(beg)), elog.Int64("pendingDrainers", int64(atomic.LoadInt32(&left))))
+		emu.Lock()
+		errs = append(errs, fmt.Errorf("shutdown timeout after %s, %d drainers pending, %w", s.timeout, atomic.LoadInt32(&left), ctx.Err()))
+		emu.Unlock()
+	}
+
+	s.logger.Info("shutdown finished", elog.FieldCost(time.Since(beg)))
+	emu.Lock()
+	defer emu.Unlock()
+	if len(errs) == 0 {
+		return nil
+	}
+	// 超时后仍在执行的drainer可能继续追加错误，复制一份
+	return &ShutdownError{Errors: append([]error(nil), errs...)}
+}
+
+// ShutdownError 停止过程中的所有错误，可以通过errors.Is、errors.As判断其中的错误
+type ShutdownError struct {
+	Errors []error
+}
+
+// Error ...
+func (e *ShutdownError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Is 任意一个错误匹配target时返回true
+func (e *ShutdownError) Is(target error) bool {
+	for _, err := range e.Errors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As 将第一个匹配的错误赋值给target
+func (e *ShutdownError) As(target interface{}) bool {
+	for _, err := range e.Errors {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+package ek8s
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego/core/eregistry"
+	"github.com/gotomicro/ego/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRegistry 只实现UnregisterService，记录注销的地址
+type fakeRegistry struct {
+	eregistry.Registry
+	err    error
+	record func(step string)
+}
+
+func (r *fakeRegistry) UnregisterService(ctx context.Context, info *server.ServiceInfo) error {
+	r.record("unregister " + info.Address)
+	return r.err
+}
+
+// drainError 用于验证errors.As
+type drainError struct {
+	name string
+}
+
+func (e *drainError) Error() string {
+	return "drain error " + e.name
+}
+
+func TestShutdownSequence(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		steps []string
+	)
+	record := func(step string) {
+		mu.Lock()
+		defer mu.Unlock()
+		steps = append(steps, step)
+	}
+	s := NewShutdownCoordinator(WithPreStopDelay(30*time.Millisecond), WithShutdownTimeout(time.Second))
+	s.AddRegistry(&fakeRegistry{record: record}, &server.ServiceInfo{Address: "10.0.0.1:9001"}, &server.ServiceInfo{Address: "10.0.0.1:9002"})
+
+	var unregisteredAt time.Time
+	s.AddRegistry(&fakeRegistry{record: func(step string) {
+		record(step)
+		unregisteredAt = time.Now()
+	}}, &server.ServiceInfo{Address: "10.0.0.1:9003"})
+	var calls int32
+	for _, name := range []string{"kafka", "grpc"} {
+		name := name
+		s.AddDrainer(name, func(ctx context.Context) error {
+			atomic.AddInt32(&calls, 1)
+			// 开始drain时已经标记未就绪，并且等待了preStopDelay
+			assert.False(t, s.Ready())
+			assert.GreaterOrEqual(t, int64(time.Since(unregisteredAt)), int64(30*time.Millisecond))
+			record("drain " + name)
+			return nil
+		})
+	}
+
+	assert.True(t, s.Ready())
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.False(t, s.Ready())
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("done not closed")
+	}
+	assert.Equal(t, []string{"unregister 10.0.0.1:9001", "unregister 10.0.0.1:9002", "unregister 10.0.0.1:9003"}, steps[:3])
+	assert.ElementsMatch(t, []string{"drain kafka", "drain grpc"}, steps[3:])
+
+	// 只执行一次
+	require.NoError(t, s.Shutdown(context.Background()))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestShutdownErrors(t *testing.T) {
+	errUnregister := errors.New("unregister failed")
+	s := NewShutdownCoordinator(WithPreStopDelay(0))
+	s.AddRegistry(&fakeRegistry{err: errUnregister, record: func(string) {}}, &server.ServiceInfo{Address: "10.0.0.1:9001"})
+	s.AddDrainer("kafka", func(ctx context.Context) error {
+		return &drainError{name: "kafka"}
+	})
+	s.AddDrainer("grpc", func(ctx context.Context) error {
+		return nil
+	})
+
+	err := s.Shutdown(context.Background())
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, errUnregister))
+	var de *drainError
+	require.True(t, errors.As(err, &de))
+	assert.Equal(t, "kafka", de.name)
+	var se *ShutdownError
+	require.True(t, errors.As(err, &se))
+	assert.Len(t, se.Errors, 2)
+	assert.Equal(t, "unregister 10.0.0.1:9001, err: unregister failed; drain kafka, err: drain error kafka", err.Error())
+	assert.False(t, errors.Is(err, context.DeadlineExceeded))
+
+	// 后续调用返回相同的结果
+	assert.Equal(t, err, s.Shutdown(context.Background()))
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	s := NewShutdownCoordinator(WithPreStopDelay(time.Hour), WithShutdownTimeout(50*time.Millisecond))
+	release := make(chan struct{})
+	defer close(release)
+	s.AddDrainer("stuck", func(ctx context.Context) error {
+		// 不响应ctx的drainer不会阻塞停止
+		<-release
+		return nil
+	})
+
+	beg := time.Now()
+	err := s.Shutdown(context.Background())
+	assert.Less(t, int64(time.Since(beg)), int64(time.Second))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Contains(t, err.Error(), "1 drainers pending")
+}
+
+func TestShutdownCallerContext(t *testing.T) {
+	s := NewShutdownCoordinator(WithPreStopDelay(0))
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s.AddDrainer("slow", func(ctx context.Context) error {
+		close(started)
+		<-release
+		return nil
+	})
+	go func() {
+		_ = s.Shutdown(context.Background())
+	}()
+	<-started
+
+	// 其他调用方的ctx结束时不等待第一次停止完成
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, s.Shutdown(ctx))
+	close(release)
+	<-s.Done()
+	assert.NoError(t, s.Shutdown(context.Background()))
+}
+
+func TestShutdownHandlers(t *testing.T) {
+	s := NewShutdownCoordinator(WithPreStopDelay(0))
+	readiness := s.ReadinessHandler()
+	rec := httptest.NewRecorder()
+	readiness(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	s.PreStopHandler()(rec, httptest.NewRequest(http.MethodGet, "/prestop", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	readiness(rec, httptest.NewRequest(http.MethodGet, "/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	failed := NewShutdownCoordinator(WithPreStopDelay(0))
+	failed.AddDrainer("kafka", func(ctx context.Context) error { return errors.New("commit failed") })
+	rec = httptest.NewRecorder()
+	failed.PreStopHandler()(rec, httptest.NewRequest(http.MethodGet, "/prestop", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
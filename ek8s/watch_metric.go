@@ -0,0 +1,64 @@
+package ek8s
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/gotomicro/ego/core/emetric"
+)
+
+// watchCounter list、watch请求数，type为watch（首次watch）、rewatch（从上次的resourceVersion恢复watch）、
+// list（首次list）、relist（resourceVersion过期或者watch失败后重新list）、expired（apiserver返回410 Gone）
+var watchCounter = emetric.CounterVecOpts{
+	Namespace: emetric.DefaultNamespace,
+	Name:      "k8s_watch_total",
+	Help:      "Number of kubernetes list and watch requests by resource and type",
+	Labels:    []string{"name", "resource", "type"},
+}.Build()
+
+// watchMetricTransport 统计informer的list、watch请求。
+// informer断开后从最近的resourceVersion恢复watch，resourceVersion过期时重新list并与缓存对比产生增删改事件，
+// rewatch、relist突增说明与apiserver的连接不稳定
+type watchMetricTransport struct {
+	name string
+	rt   http.RoundTripper
+	seen sync.Map
+}
+
+// RoundTrip ...
+func (t *watchMetricTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return t.rt.RoundTrip(req)
+	}
+	query := req.URL.Query()
+	resource := watchResource(req.URL.Path)
+	key := req.URL.Path + "?" + query.Get("labelSelector") + "&" + query.Get("fieldSelector")
+
+	typ := "list"
+	if query.Get("watch") == "true" || query.Get("watch") == "1" {
+		typ = "watch"
+		key = "watch:" + key
+	} else if query.Get("resourceVersion") == "" && query.Get("limit") == "" {
+		// 不是informer的list，如Get、List调用
+		typ = ""
+	}
+	if typ != "" {
+		if _, loaded := t.seen.LoadOrStore(key, struct{}{}); loaded {
+			typ = "re" + typ
+		}
+		watchCounter.Inc(t.name, resource, typ)
+	}
+
+	resp, err := t.rt.RoundTrip(req)
+	if err == nil && resp.StatusCode == http.StatusGone {
+		watchCounter.Inc(t.name, resource, "expired")
+	}
+	return resp, err
+}
+
+// watchResource 从list、watch请求的路径中解析资源类型，如/api/v1/namespaces/default/endpoints为endpoints
+func watchResource(path string) string {
+	path = strings.TrimRight(path, "/")
+	return path[strings.LastIndex(path, "/")+1:]
+}
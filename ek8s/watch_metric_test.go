@@ -0,0 +1,122 @@
+package ek8s
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestWatchMetricTransport(t *testing.T) {
+	type request struct {
+		method string
+		url    string
+		status int
+	}
+	const endpoints = "/api/v1/namespaces/default/endpoints"
+	tests := []struct {
+		name     string
+		requests []request
+		want     map[string]float64
+	}{
+		{
+			name: "list then relist",
+			requests: []request{
+				{http.MethodGet, endpoints + "?limit=500&resourceVersion=0", http.StatusOK},
+				{http.MethodGet, endpoints + "?limit=500&resourceVersion=0", http.StatusOK},
+			},
+			want: map[string]float64{"list": 1, "relist": 1},
+		},
+		{
+			name: "list with resourceVersion only",
+			requests: []request{
+				{http.MethodGet, endpoints + "?resourceVersion=0", http.StatusOK},
+			},
+			want: map[string]float64{"list": 1},
+		},
+		{
+			name: "watch then rewatch from newer resourceVersion",
+			requests: []request{
+				{http.MethodGet, endpoints + "?watch=true&resourceVersion=10", http.StatusOK},
+				{http.MethodGet, endpoints + "?watch=true&resourceVersion=12", http.StatusOK},
+			},
+			want: map[string]float64{"watch": 1, "rewatch": 1},
+		},
+		{
+			name: "watch=1",
+			requests: []request{
+				{http.MethodGet, endpoints + "?watch=1&resourceVersion=10", http.StatusOK},
+			},
+			want: map[string]float64{"watch": 1},
+		},
+		{
+			name: "list and watch counted separately",
+			requests: []request{
+				{http.MethodGet, endpoints + "?limit=500&resourceVersion=0", http.StatusOK},
+				{http.MethodGet, endpoints + "?watch=true&resourceVersion=10", http.StatusOK},
+			},
+			want: map[string]float64{"list": 1, "watch": 1},
+		},
+		{
+			name: "different selectors are different informers",
+			requests: []request{
+				{http.MethodGet, endpoints + "?labelSelector=app%3Da&limit=500", http.StatusOK},
+				{http.MethodGet, endpoints + "?labelSelector=app%3Db&limit=500", http.StatusOK},
+				{http.MethodGet, endpoints + "?fieldSelector=metadata.name%3Dx&limit=500", http.StatusOK},
+			},
+			want: map[string]float64{"list": 3},
+		},
+		{
+			name: "expired resourceVersion",
+			requests: []request{
+				{http.MethodGet, endpoints + "?watch=true&resourceVersion=10", http.StatusGone},
+				{http.MethodGet, endpoints + "?limit=500&resourceVersion=0", http.StatusOK},
+			},
+			want: map[string]float64{"watch": 1, "expired": 1, "list": 1},
+		},
+		{
+			name: "plain get and non-get requests are ignored",
+			requests: []request{
+				{http.MethodGet, endpoints + "/svc", http.StatusOK},
+				{http.MethodGet, endpoints, http.StatusOK},
+				{http.MethodPost, endpoints + "?watch=true", http.StatusGone},
+			},
+			want: map[string]float64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var status int
+			transport := &watchMetricTransport{name: tt.name, rt: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+				rec := httptest.NewRecorder()
+				rec.WriteHeader(status)
+				return rec.Result(), nil
+			})}
+			for _, r := range tt.requests {
+				status = r.status
+				resp, err := transport.RoundTrip(httptest.NewRequest(r.method, r.url, nil))
+				require.NoError(t, err)
+				assert.Equal(t, r.status, resp.StatusCode)
+			}
+			for _, typ := range []string{"list", "relist", "watch", "rewatch", "expired"} {
+				got := testutil.ToFloat64(watchCounter.WithLabelValues(tt.name, "endpoints", typ))
+				assert.Equal(t, tt.want[typ], got, typ)
+			}
+		})
+	}
+}
+
+func TestWatchResource(t *testing.T) {
+	assert.Equal(t, "endpoints", watchResource("/api/v1/namespaces/default/endpoints"))
+	assert.Equal(t, "pods", watchResource("/api/v1/pods/"))
+	assert.Equal(t, "deployments", watchResource("/apis/apps/v1/namespaces/default/deployments"))
+}
@@ -42,14 +42,13 @@ func (c *WatcherApp) watch(ctx context.Context, ns string) error {
 			return err
 		}
 		c.logger.Debug("watch prefix label", zap.String("appname", c.appName), zap.String("label", label))
+		// 不能覆盖ResourceVersion，informer断开后需要从最近的resourceVersion恢复watch，过期时重新list
 		informersFactory := informers.NewSharedInformerFactoryWithOptions(
 			c.Clientset,
 			defaultResync,
 			informers.WithNamespace(ns),
 			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
 				options.LabelSelector = label
-				//// todo
-				options.ResourceVersion = "0"
 			}),
 		)
 
@@ -75,8 +74,6 @@ func (c *WatcherApp) watch(ctx context.Context, ns string) error {
 			informers.WithNamespace(ns),
 			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
 				options.FieldSelector = "metadata.name=" + endPoints.Name
-				// todo
-				options.ResourceVersion = "0"
 			}),
 		)
 
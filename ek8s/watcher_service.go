@@ -0,0 +1,365 @@
+package ek8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Address 服务的一个就绪地址
+type Address struct {
+	Namespace string
+	IP        string
+	Port      int32  // 端点的第一个端口
+	PodName   string // 端点对应的Pod，可能为空
+	NodeName  string // 端点所在的节点，可能为空
+}
+
+// String ...
+func (a Address) String() string {
+	return fmt.Sprintf("%s/%s:%d", a.Namespace, a.IP, a.Port)
+}
+
+// ErrClosed 组件已经Close
+var ErrClosed = errors.New("ek8s: component closed")
+
+// sharedInformerFactory 返回命名空间共享的informer factory，同一个命名空间只建立一个watch连接
+func (c *Component) sharedInformerFactory(ns string) informers.SharedInformerFactory {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+	if factory, ok := c.factories[ns]; ok {
+		return factory
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(c.Clientset, defaultResync, informers.WithNamespace(ns))
+	c.factories[ns] = factory
+	return factory
+}
+
+// WatchServiceAddresses 通过共享的informer订阅服务在所有命名空间下的就绪地址，
+// 地址变化时立即以全量地址回调fn，地址没有变化的事件（如resync）不会回调。
+// 返回前会等待informer完成首次同步，并至少回调一次。kind为KindEndpoints或者KindEndpointSlices。
+// ctx结束或者组件Close后不再回调。EndpointSlices使用discovery/v1，需要Kubernetes 1.21及以上
+func (c *Component) WatchServiceAddresses(ctx context.Context, service string, kind string, fn func(addrs []Address)) error {
+	return c.watchServiceAddresses(ctx, c.config.Namespaces, c.getDeploymentName(service), kind, fn)
+}
+
+// WatchEndpoints 监听Service的就绪地址变化，回调新增、删除的地址，用于自定义的连接池等非gRPC场景。
+// service为Service的名称，不会加上DeploymentPrefix；namespace为空时监听配置的所有命名空间。
+// 返回前会等待informer完成首次同步，并以全部地址作为added回调一次；ctx结束或者组件Close后不再回调
+func (c *Component) WatchEndpoints(ctx context.Context, service string, namespace string, fn func(added []Address, removed []Address)) error {
+	namespaces := c.config.Namespaces
+	if namespace != "" {
+		namespaces = []string{namespace}
+	}
+	current := make(map[Address]struct{})
+	return c.watchServiceAddresses(ctx, namespaces, service, KindEndpoints, func(addrs []Address) {
+		var added, removed []Address
+		current, added, removed = diffAddresses(current, addrs)
+		if len(added) == 0 && len(removed) == 0 {
+			return
+		}
+		fn(added, removed)
+	})
+}
+
+// diffAddresses 对比当前的地址和最新的全量地址，返回最新的地址集合以及新增、删除的地址，删除的地址按String排序
+func diffAddresses(current map[Address]struct{}, addrs []Address) (next map[Address]struct{}, added []Address, removed []Address) {
+	next = make(map[Address]struct{}, len(addrs))
+	added = make([]Address, 0)
+	for _, addr := range addrs {
+		if _, ok := next[addr]; ok {
+			continue
+		}
+		next[addr] = struct{}{}
+		if _, ok := current[addr]; !ok {
+			added = append(added, addr)
+		}
+	}
+	removed = make([]Address, 0)
+	for addr := range current {
+		if _, ok := next[addr]; !ok {
+			removed = append(removed, addr)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		return removed[i].String() < removed[j].String()
+	})
+	return next, added, removed
+}
+
+func (c *Component) watchServiceAddresses(ctx context.Context, namespaces []string, name string, kind string, fn func(addrs []Address)) error {
+	select {
+	case <-c.stopCh:
+		return ErrClosed
+	default:
+	}
+	w := &serviceWatcher{
+		ctx:       ctx,
+		stopCh:    c.stopCh,
+		fn:        fn,
+		addresses: make(map[string][]Address),
+	}
+	removes := make([]func(), 0, len(namespaces))
+	removeAll := func() {
+		for _, remove := range removes {
+			remove()
+		}
+	}
+	for _, ns := range namespaces {
+		ns := ns
+		factory := c.sharedInformerFactory(ns)
+		var (
+			informer cache.SharedIndexInformer
+			match    func(obj interface{}) bool
+			list     func() []Address
+		)
+		switch kind {
+		case KindEndpoints:
+			endpoints := factory.Core().V1().Endpoints()
+			informer = endpoints.Informer()
+			match = func(obj interface{}) bool {
+				m, ok := objectMeta(obj)
+				return ok && m.GetName() == name
+			}
+			list = func() []Address {
+				ep, err := endpoints.Lister().Endpoints(ns).Get(name)
+				if err != nil {
+					return nil
+				}
+				return endpointsAddresses(ep)
+			}
+		case KindEndpointSlices:
+			slices := factory.Discovery().V1().EndpointSlices()
+			informer = slices.Informer()
+			match = func(obj interface{}) bool {
+				m, ok := objectMeta(obj)
+				return ok && m.GetLabels()[discoveryv1.LabelServiceName] == name
+			}
+			selector := labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: name})
+			list = func() []Address {
+				items, err := slices.Lister().EndpointSlices(ns).List(selector)
+				if err != nil {
+					return nil
+				}
+				addrs := make([]Address, 0)
+				for _, slice := range items {
+					addrs = append(addrs, endpointSliceAddresses(slice)...)
+				}
+				return addrs
+			}
+		default:
+			removeAll()
+			return fmt.Errorf("watch service addresses, unsupported kind %s", kind)
+		}
+
+		onEvent := func(obj interface{}) {
+			if match(obj) {
+				w.update(ns, list())
+			}
+		}
+		removes = append(removes, c.addEventHandler(informer, cache.ResourceEventHandlerFuncs{
+			AddFunc: onEvent,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				onEvent(newObj)
+			},
+			DeleteFunc: onEvent,
+		}))
+		factory.Start(c.stopCh)
+		if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			removeAll()
+			return fmt.Errorf("wait %s cache sync in namespace (%s), err: %w", kind, ns, ctx.Err())
+		}
+		w.set(ns, list())
+	}
+	w.notify(true)
+	// ctx结束或者组件Close后移除回调，避免共享的informer上的回调越来越多
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-c.stopCh:
+		}
+		removeAll()
+	}()
+	return nil
+}
+
+// addEventHandler 通过informer的事件分发器注册回调，返回移除回调的函数。
+// 同一个informer只注册一次分发器，回调可以随时移除
+func (c *Component) addEventHandler(informer cache.SharedIndexInformer, handler cache.ResourceEventHandler) (remove func()) {
+	c.locker.Lock()
+	d, ok := c.dispatchers[informer]
+	if !ok {
+		d = &eventDispatcher{handlers: make(map[int]cache.ResourceEventHandler)}
+		c.dispatchers[informer] = d
+		informer.AddEventHandler(d)
+	}
+	c.locker.Unlock()
+	return d.add(handler)
+}
+
+// eventDispatcher 将informer的事件分发给当前注册的回调
+type eventDispatcher struct {
+	mu       sync.RWMutex
+	nextID   int
+	handlers map[int]cache.ResourceEventHandler
+}
+
+func (d *eventDispatcher) add(handler cache.ResourceEventHandler) (remove func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	id := d.nextID
+	d.nextID++
+	d.handlers[id] = handler
+	return func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		delete(d.handlers, id)
+	}
+}
+
+// snapshot 复制当前的回调，回调中可以移除自己
+func (d *eventDispatcher) snapshot() []cache.ResourceEventHandler {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	handlers := make([]cache.ResourceEventHandler, 0, len(d.handlers))
+	for _, handler := range d.handlers {
+		handlers = append(handlers, handler)
+	}
+	return handlers
+}
+
+// OnAdd ...
+func (d *eventDispatcher) OnAdd(obj interface{}) {
+	for _, handler := range d.snapshot() {
+		handler.OnAdd(obj)
+	}
+}
+
+// OnUpdate ...
+func (d *eventDispatcher) OnUpdate(oldObj, newObj interface{}) {
+	for _, handler := range d.snapshot() {
+		handler.OnUpdate(oldObj, newObj)
+	}
+}
+
+// OnDelete ...
+func (d *eventDispatcher) OnDelete(obj interface{}) {
+	for _, handler := range d.snapshot() {
+		handler.OnDelete(obj)
+	}
+}
+
+// serviceWatcher 合并多个命名空间的地址，变化时回调
+type serviceWatcher struct {
+	ctx       context.Context
+	stopCh    <-chan struct{}
+	fn        func(addrs []Address)
+	mu        sync.Mutex
+	addresses map[string][]Address
+	last      []Address
+	notified  bool
+}
+
+func (w *serviceWatcher) set(ns string, addrs []Address) {
+	w.mu.Lock()
+	w.addresses[ns] = addrs
+	w.mu.Unlock()
+}
+
+func (w *serviceWatcher) update(ns string, addrs []Address) {
+	w.set(ns, addrs)
+	w.notify(false)
+}
+
+// notify 地址变化时回调，force为true时只要还没有回调过就回调
+func (w *serviceWatcher) notify(force bool) {
+	if w.ctx.Err() != nil {
+		return
+	}
+	select {
+	case <-w.stopCh:
+		return
+	default:
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	all := make([]Address, 0)
+	for _, addrs := range w.addresses {
+		all = append(all, addrs...)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].String() < all[j].String()
+	})
+	if (w.notified || !force) && reflect.DeepEqual(all, w.last) {
+		return
+	}
+	w.last = all
+	w.notified = true
+	w.fn(all)
+}
+
+func endpointsAddresses(ep *v1.Endpoints) []Address {
+	addrs := make([]Address, 0)
+	for _, subset := range ep.Subsets {
+		var port int32
+		if len(subset.Ports) > 0 {
+			port = subset.Ports[0].Port
+		}
+		for _, address := range subset.Addresses {
+			addr := Address{Namespace: ep.Namespace, IP: address.IP, Port: port}
+			if address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
+				addr.PodName = address.TargetRef.Name
+			}
+			if address.NodeName != nil {
+				addr.NodeName = *address.NodeName
+			}
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+func endpointSliceAddresses(slice *discoveryv1.EndpointSlice) []Address {
+	var port int32
+	if len(slice.Ports) > 0 && slice.Ports[0].Port != nil {
+		port = *slice.Ports[0].Port
+	}
+	addrs := make([]Address, 0)
+	for _, endpoint := range slice.Endpoints {
+		// ready为空时表示就绪
+		if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+			continue
+		}
+		for _, ip := range endpoint.Addresses {
+			addr := Address{Namespace: slice.Namespace, IP: ip, Port: port}
+			if endpoint.NodeName != nil {
+				addr.NodeName = *endpoint.NodeName
+			}
+			if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+				addr.PodName = endpoint.TargetRef.Name
+			}
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// objectMeta 获取对象的元数据，支持删除时的DeletedFinalStateUnknown
+func objectMeta(obj interface{}) (metav1.Object, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	m, err := meta.Accessor(obj)
+	return m, err == nil
+}
@@ -0,0 +1,217 @@
+package ek8s
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+func addressSet(addrs ...Address) map[Address]struct{} {
+	set := make(map[Address]struct{}, len(addrs))
+	for _, addr := range addrs {
+		set[addr] = struct{}{}
+	}
+	return set
+}
+
+func TestDiffAddresses(t *testing.T) {
+	a := Address{Namespace: "default", IP: "10.0.0.1", Port: 80}
+	b := Address{Namespace: "default", IP: "10.0.0.2", Port: 80}
+	c := Address{Namespace: "default", IP: "10.0.0.3", Port: 80}
+	bOtherPort := Address{Namespace: "default", IP: "10.0.0.2", Port: 81}
+
+	tests := []struct {
+		name    string
+		current map[Address]struct{}
+		addrs   []Address
+		added   []Address
+		removed []Address
+	}{
+		{name: "first", current: addressSet(), addrs: []Address{a, b}, added: []Address{a, b}, removed: []Address{}},
+		{name: "unchanged", current: addressSet(a, b), addrs: []Address{b, a}, added: []Address{}, removed: []Address{}},
+		{name: "add and remove", current: addressSet(a, b), addrs: []Address{a, c}, added: []Address{c}, removed: []Address{b}},
+		{name: "port changed", current: addressSet(a, b), addrs: []Address{a, bOtherPort}, added: []Address{bOtherPort}, removed: []Address{b}},
+		{name: "all removed", current: addressSet(c, a, b), addrs: nil, added: []Address{}, removed: []Address{a, b, c}},
+		{name: "duplicated", current: addressSet(), addrs: []Address{a, a}, added: []Address{a}, removed: []Address{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, added, removed := diffAddresses(tt.current, tt.addrs)
+			assert.Equal(t, tt.added, added)
+			assert.Equal(t, tt.removed, removed)
+			assert.Equal(t, addressSet(tt.addrs...), next)
+		})
+	}
+}
+
+func TestServiceWatcherNotify(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stopCh := make(chan struct{})
+	var calls [][]Address
+	w := &serviceWatcher{ctx: ctx, stopCh: stopCh, addresses: make(map[string][]Address), fn: func(addrs []Address) {
+		calls = append(calls, addrs)
+	}}
+	a := Address{Namespace: "a", IP: "10.0.0.1", Port: 80}
+	b := Address{Namespace: "b", IP: "10.0.0.2", Port: 80}
+
+	// 首次同步后没有地址也回调
+	w.notify(true)
+	require.Len(t, calls, 1)
+	assert.Empty(t, calls[0])
+	w.notify(true)
+	assert.Len(t, calls, 1)
+
+	// 合并多个命名空间的地址，没有变化时不回调
+	w.update("b", []Address{b})
+	w.update("a", []Address{a})
+	w.update("a", []Address{a})
+	require.Len(t, calls, 3)
+	assert.Equal(t, []Address{a, b}, calls[2])
+
+	close(stopCh)
+	w.update("a", nil)
+	assert.Len(t, calls, 3)
+}
+
+func TestServiceWatcherContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	w := &serviceWatcher{ctx: ctx, stopCh: make(chan struct{}), addresses: make(map[string][]Address), fn: func(addrs []Address) {
+		calls++
+	}}
+	w.update("a", []Address{{Namespace: "a", IP: "10.0.0.1"}})
+	cancel()
+	w.update("a", nil)
+	assert.Equal(t, 1, calls)
+}
+
+func TestEndpointsAddresses(t *testing.T) {
+	node := "node-1"
+	ep := &v1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc"},
+		Subsets: []v1.EndpointSubset{
+			{
+				Addresses: []v1.EndpointAddress{
+					{IP: "10.0.0.1", NodeName: &node, TargetRef: &v1.ObjectReference{Kind: "Pod", Name: "pod-1"}},
+					{IP: "10.0.0.2"},
+				},
+				NotReadyAddresses: []v1.EndpointAddress{{IP: "10.0.0.3"}},
+				Ports:             []v1.EndpointPort{{Port: 8080}, {Port: 9090}},
+			},
+			{Addresses: []v1.EndpointAddress{{IP: "10.0.0.4"}}},
+		},
+	}
+	assert.Equal(t, []Address{
+		{Namespace: "default", IP: "10.0.0.1", Port: 8080, PodName: "pod-1", NodeName: "node-1"},
+		{Namespace: "default", IP: "10.0.0.2", Port: 8080},
+		{Namespace: "default", IP: "10.0.0.4"},
+	}, endpointsAddresses(ep))
+}
+
+func TestEndpointSliceAddresses(t *testing.T) {
+	ready, notReady := true, false
+	port := int32(8080)
+	node := "node-1"
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "svc-abc"},
+		Ports:      []discoveryv1.EndpointPort{{Port: &port}},
+		Endpoints: []discoveryv1.Endpoint{
+			{Addresses: []string{"10.0.0.1"}, Conditions: discoveryv1.EndpointConditions{Ready: &ready}, NodeName: &node, TargetRef: &v1.ObjectReference{Kind: "Pod", Name: "pod-1"}},
+			// ready为空时表示就绪
+			{Addresses: []string{"10.0.0.2"}},
+			{Addresses: []string{"10.0.0.3"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}},
+		},
+	}
+	assert.Equal(t, []Address{
+		{Namespace: "default", IP: "10.0.0.1", Port: 8080, PodName: "pod-1", NodeName: "node-1"},
+		{Namespace: "default", IP: "10.0.0.2", Port: 8080},
+	}, endpointSliceAddresses(slice))
+}
+
+func TestEventDispatcher(t *testing.T) {
+	d := &eventDispatcher{handlers: make(map[int]cache.ResourceEventHandler)}
+	var a, b int32
+	removeA := d.add(cache.ResourceEventHandlerFuncs{AddFunc: func(obj interface{}) { atomic.AddInt32(&a, 1) }})
+	var removeB func()
+	removeB = d.add(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) { atomic.AddInt32(&b, 1) },
+		// 回调中可以移除自己
+		DeleteFunc: func(obj interface{}) { removeB() },
+	})
+
+	d.OnAdd(nil)
+	d.OnUpdate(nil, nil)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&a))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&b))
+
+	d.OnDelete(nil)
+	d.OnUpdate(nil, nil)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&b))
+
+	removeA()
+	removeA()
+	d.OnAdd(nil)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&a))
+	assert.Empty(t, d.handlers)
+}
+
+func TestAddEventHandler(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	factory := informers.NewSharedInformerFactory(client, 0)
+	informer := factory.Core().V1().Endpoints().Informer()
+	c := &Component{dispatchers: make(map[cache.SharedIndexInformer]*eventDispatcher), stopCh: make(chan struct{})}
+	defer c.Close()
+
+	var mu sync.Mutex
+	events := make(map[string][]string)
+	handler := func(name string) cache.ResourceEventHandler {
+		return cache.ResourceEventHandlerFuncs{AddFunc: func(obj interface{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			events[name] = append(events[name], obj.(*v1.Endpoints).Name)
+		}}
+	}
+	received := func(name string) []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), events[name]...)
+	}
+	removeA := c.addEventHandler(informer, handler("a"))
+	c.addEventHandler(informer, handler("b"))
+	// 同一个informer只注册一个分发器
+	assert.Len(t, c.dispatchers, 1)
+
+	factory.Start(c.stopCh)
+	require.True(t, cache.WaitForCacheSync(c.stopCh, informer.HasSynced))
+	create := func(name string) {
+		_, err := client.CoreV1().Endpoints("default").Create(context.Background(), &v1.Endpoints{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name}}, metav1.CreateOptions{})
+		require.NoError(t, err)
+	}
+	create("svc-1")
+	require.Eventually(t, func() bool { return len(received("a")) == 1 && len(received("b")) == 1 }, time.Second, time.Millisecond)
+
+	removeA()
+	create("svc-2")
+	require.Eventually(t, func() bool { return len(received("b")) == 2 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"svc-1"}, received("a"))
+}
+
+func TestComponentClose(t *testing.T) {
+	c := &Component{config: &Config{Namespaces: []string{"default"}}, dispatchers: make(map[cache.SharedIndexInformer]*eventDispatcher), stopCh: make(chan struct{})}
+	require.NoError(t, c.Close())
+	require.NoError(t, c.Close())
+	err := c.WatchServiceAddresses(context.Background(), "svc", KindEndpoints, func(addrs []Address) {})
+	assert.Equal(t, ErrClosed, err)
+}
@@ -0,0 +1,202 @@
+package ekafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/gotomicro/ego-component/ekafka/internal/deleterecords"
+	"github.com/segmentio/kafka-go"
+)
+
+// Admin 管理 topic、分区、配置和消费组，与 Component 使用相同的 brokers、SASL 配置
+type Admin struct {
+	client *Client
+}
+
+// TopicSpec 创建 topic 的参数
+type TopicSpec struct {
+	// Name topic 名称
+	Name string
+	// NumPartitions 分区数，-1 表示使用 broker 默认值
+	NumPartitions int
+	// ReplicationFactor 副本数，-1 表示使用 broker 默认值
+	ReplicationFactor int
+	// Configs topic 级别的配置，如 retention.ms
+	Configs map[string]string
+}
+
+// ConsumerGroupDescription 消费组信息
+type ConsumerGroupDescription = kafka.DescribeGroupsResponseGroup
+
+// Admin 返回 Admin
+func (cmp *Component) Admin() *Admin {
+	return &Admin{client: cmp.Client()}
+}
+
+// CreateTopics 创建 topic，已存在的 topic 会返回 kafka.TopicAlreadyExists 错误
+func (a *Admin) CreateTopics(ctx context.Context, topics ...TopicSpec) error {
+	configs := make([]kafka.TopicConfig, 0, len(topics))
+	for _, topic := range topics {
+		entries := make([]kafka.ConfigEntry, 0, len(topic.Configs))
+		for _, name := range sortedKeys(topic.Configs) {
+			entries = append(entries, kafka.ConfigEntry{ConfigName: name, ConfigValue: topic.Configs[name]})
+		}
+		configs = append(configs, kafka.TopicConfig{
+			Topic:             topic.Name,
+			NumPartitions:     topic.NumPartitions,
+			ReplicationFactor: topic.ReplicationFactor,
+			ConfigEntries:     entries,
+		})
+	}
+	res, err := a.client.CreateTopics(ctx, &kafka.CreateTopicsRequest{Topics: configs})
+	if err != nil {
+		return err
+	}
+	return firstError(res.Errors)
+}
+
+// DeleteTopics 删除 topic
+func (a *Admin) DeleteTopics(ctx context.Context, topics ...string) error {
+	res, err := a.client.DeleteTopics(ctx, &kafka.DeleteTopicsRequest{Topics: topics})
+	if err != nil {
+		return err
+	}
+	return firstError(res.Errors)
+}
+
+// CreatePartitions 将 topic 的分区数增加到 count
+func (a *Admin) CreatePartitions(ctx context.Context, topic string, count int) error {
+	res, err := a.client.CreatePartitions(ctx, &kafka.CreatePartitionsRequest{
+		Topics: []kafka.TopicPartitionsConfig{{Name: topic, Count: int32(count)}},
+	})
+	if err != nil {
+		return err
+	}
+	return firstError(res.Errors)
+}
+
+// AlterTopicConfigs 修改 topic 级别的配置
+func (a *Admin) AlterTopicConfigs(ctx context.Context, topic string, configs map[string]string) error {
+	entries := make([]kafka.AlterConfigRequestConfig, 0, len(configs))
+	for _, name := range sortedKeys(configs) {
+		entries = append(entries, kafka.AlterConfigRequestConfig{Name: name, Value: configs[name]})
+	}
+	res, err := a.client.AlterConfigs(ctx, &kafka.AlterConfigsRequest{
+		Resources: []kafka.AlterConfigRequestResource{{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: topic,
+			Configs:      entries,
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	for resource, err := range res.Errors {
+		if err != nil {
+			return fmt.Errorf("%s: %w", resource.Name, err)
+		}
+	}
+	return nil
+}
+
+// DescribeTopicConfigs 返回 topic 的配置，不指定 names 时返回全部配置
+func (a *Admin) DescribeTopicConfigs(ctx context.Context, topic string, names ...string) (map[string]string, error) {
+	res, err := a.client.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{
+		Resources: []kafka.DescribeConfigRequestResource{{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: topic,
+			ConfigNames:  names,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	configs := make(map[string]string)
+	for _, resource := range res.Resources {
+		if resource.Error != nil {
+			return nil, fmt.Errorf("%s: %w", resource.ResourceName, resource.Error)
+		}
+		for _, entry := range resource.ConfigEntries {
+			configs[entry.ConfigName] = entry.ConfigValue
+		}
+	}
+	return configs, nil
+}
+
+// ListConsumerGroups 返回所有消费组的 ID
+func (a *Admin) ListConsumerGroups(ctx context.Context) ([]string, error) {
+	res, err := a.client.ListGroups(ctx, &kafka.ListGroupsRequest{})
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	groups := make([]string, 0, len(res.Groups))
+	for _, group := range res.Groups {
+		groups = append(groups, group.GroupID)
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+// DescribeConsumerGroups 返回消费组的状态和成员分配情况
+func (a *Admin) DescribeConsumerGroups(ctx context.Context, groupIDs ...string) ([]ConsumerGroupDescription, error) {
+	res, err := a.client.DescribeGroups(ctx, &kafka.DescribeGroupsRequest{GroupIDs: groupIDs})
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range res.Groups {
+		if group.Error != nil {
+			return nil, fmt.Errorf("%s: %w", group.GroupID, group.Error)
+		}
+	}
+	return res.Groups, nil
+}
+
+// DeleteRecords 删除分区中 offset 之前的消息，offsets 为分区到 offset 的映射，返回每个分区删除后的 low watermark
+func (a *Admin) DeleteRecords(ctx context.Context, topic string, offsets map[int]int64) (map[int]int64, error) {
+	partitions := make([]deleterecords.RequestPartition, 0, len(offsets))
+	for partition, offset := range offsets {
+		partitions = append(partitions, deleterecords.RequestPartition{
+			PartitionIndex: int32(partition),
+			Offset:         offset,
+		})
+	}
+	res, err := a.client.deleteRecords(ctx, &deleterecords.Request{
+		Topics:    []deleterecords.RequestTopic{{Name: topic, Partitions: partitions}},
+		TimeoutMs: 10000,
+	})
+	if err != nil {
+		return nil, err
+	}
+	lowWatermarks := make(map[int]int64, len(offsets))
+	for _, t := range res.Topics {
+		for _, p := range t.Partitions {
+			if p.ErrorCode != 0 {
+				return nil, fmt.Errorf("%s[%d]: %w", t.Name, p.PartitionIndex, kafka.Error(p.ErrorCode))
+			}
+			lowWatermarks[int(p.PartitionIndex)] = p.LowWatermark
+		}
+	}
+	return lowWatermarks, nil
+}
+
+func firstError(errs map[string]error) error {
+	for _, name := range sortedKeys(errs) {
+		if errs[name] != nil {
+			return fmt.Errorf("%s: %w", name, errs[name])
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,78 @@
+package ekafka
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// BalancerFunc 自定义分区函数，返回值必须是 partitions 中的一个
+type BalancerFunc = kafka.BalancerFunc
+
+// defaultStickyBatchSize sticky balancer 切换分区前写入的消息条数
+const defaultStickyBatchSize = 100
+
+// StickyBalancer 没有 key 的消息会持续写入同一个分区，写满 BatchSize 条后随机切换到另一个分区，
+// 以便 producer 攒出更大的批次；有 key 的消息使用 hash 分区，保证相同 key 落在同一个分区
+type StickyBalancer struct {
+	// BatchSize 切换分区前写入的消息条数，默认100条
+	BatchSize int
+
+	hash      kafka.Hash
+	mu        sync.Mutex
+	rand      *rand.Rand
+	partition int
+	count     int
+}
+
+// NewStickyBalancer 返回 StickyBalancer，batchSize 小于等于0时使用默认值
+func NewStickyBalancer(batchSize int) *StickyBalancer {
+	if batchSize <= 0 {
+		batchSize = defaultStickyBatchSize
+	}
+	return &StickyBalancer{
+		BatchSize: batchSize,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		partition: -1,
+	}
+}
+
+// Balance 实现 kafka.Balancer
+func (b *StickyBalancer) Balance(msg Message, partitions ...int) int {
+	if msg.Key != nil {
+		return b.hash.Balance(msg, partitions...)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.count >= b.BatchSize || !containsPartition(partitions, b.partition) {
+		b.partition = b.next(partitions)
+		b.count = 0
+	}
+	b.count++
+	return b.partition
+}
+
+// next 随机选择一个与当前不同的分区
+func (b *StickyBalancer) next(partitions []int) int {
+	if len(partitions) == 1 {
+		return partitions[0]
+	}
+	for {
+		partition := partitions[b.rand.Intn(len(partitions))]
+		if partition != b.partition {
+			return partition
+		}
+	}
+}
+
+func containsPartition(partitions []int, partition int) bool {
+	for _, p := range partitions {
+		if p == partition {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package ekafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStickyBalancer(t *testing.T) {
+	b := NewStickyBalancer(3)
+	partitions := []int{0, 1, 2, 3}
+
+	first := b.Balance(Message{}, partitions...)
+	assert.Equal(t, first, b.Balance(Message{}, partitions...))
+	assert.Equal(t, first, b.Balance(Message{}, partitions...))
+	// 写满 BatchSize 条后切换分区
+	second := b.Balance(Message{}, partitions...)
+	assert.NotEqual(t, first, second)
+
+	// 当前分区不可用时立即切换
+	assert.NotEqual(t, second, b.Balance(Message{}, removePartition(partitions, second)...))
+
+	// 有 key 的消息按 hash 分区
+	key := Message{Key: []byte("user-1")}
+	assert.Equal(t, b.Balance(key, partitions...), b.Balance(key, partitions...))
+}
+
+func removePartition(partitions []int, partition int) []int {
+	output := make([]int, 0, len(partitions))
+	for _, p := range partitions {
+		if p != partition {
+			output = append(output, p)
+		}
+	}
+	return output
+}
@@ -0,0 +1,214 @@
+package ekafka
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+)
+
+// CommitFunc 提交消息 offset，通常为 Consumer.CommitMessages
+type CommitFunc = func(ctx context.Context, msgs ...*Message) error
+
+const (
+	// DefaultCommitInterval interval 小于等于0时使用的提交周期
+	DefaultCommitInterval = time.Second
+	defaultNackAttempts   = 3
+	defaultNackBackoff    = 100 * time.Millisecond
+)
+
+// Committer 手动提交模式下的后台提交器
+// 每个分区只会提交最大的连续已确认 offset，未确认的消息会阻塞其后消息的提交，从而保证 at-least-once
+type Committer struct {
+	commit     CommitFunc
+	interval   time.Duration
+	logger     *elog.Component
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+	onNack     func(msg Message) error
+	// nackAttempts OnNack 的最大尝试次数，nackBackoff 为每次重试前的等待时间
+	nackAttempts int
+	nackBackoff  time.Duration
+}
+
+type partitionOffsets struct {
+	// pending 已拉取但尚未可提交的 offset，按拉取顺序递增
+	pending []int64
+	acked   map[int64]Message
+	// committable 最大的连续已确认消息，提交后置空
+	committable *Message
+}
+
+// AckMessage 手动提交模式下的消息，处理完成后需要调用 Ack 或 Nack
+type AckMessage struct {
+	Message
+	committer *Committer
+	once      sync.Once
+}
+
+// NewCommitter 创建提交器，interval 为提交周期，小于等于0时使用 DefaultCommitInterval
+func NewCommitter(commit CommitFunc, interval time.Duration, logger *elog.Component) *Committer {
+	if interval <= 0 {
+		interval = DefaultCommitInterval
+	}
+	return &Committer{
+		commit:       commit,
+		interval:     interval,
+		logger:       logger,
+		partitions:   make(map[int]*partitionOffsets),
+		nackAttempts: defaultNackAttempts,
+		nackBackoff:  defaultNackBackoff,
+	}
+}
+
+// OnNack 设置 Nack 时的处理函数，如投递到 retry topic 或死信 topic
+// 返回错误时按 NackRetry 重试，重试耗尽或者未设置 OnNack 时丢弃该消息并记录错误日志，
+// Nack 之后 offset 总是会被标记为已完成，不会阻塞其后消息的提交
+func (c *Committer) OnNack(fn func(msg Message) error) {
+	c.onNack = fn
+}
+
+// NackRetry 设置 OnNack 的最大尝试次数和重试等待时间，默认3次、100ms
+func (c *Committer) NackRetry(attempts int, backoff time.Duration) {
+	if attempts < 1 {
+		attempts = 1
+	}
+	c.nackAttempts = attempts
+	c.nackBackoff = backoff
+}
+
+// Track 记录拉取到的消息，必须按拉取顺序调用
+func (c *Committer) Track(msg Message) *AckMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.partitions[msg.Partition]
+	if !ok {
+		p = &partitionOffsets{acked: make(map[int64]Message)}
+		c.partitions[msg.Partition] = p
+	}
+	p.pending = append(p.pending, msg.Offset)
+	return &AckMessage{Message: msg, committer: c}
+}
+
+// Ack 确认消息处理成功
+func (m *AckMessage) Ack() {
+	m.once.Do(func() {
+		m.committer.ack(m.Message)
+	})
+}
+
+// Nack 标记消息处理失败，交给 OnNack 处理后标记为已完成
+func (m *AckMessage) Nack() {
+	m.once.Do(func() {
+		m.committer.nack(m.Message)
+		m.committer.ack(m.Message)
+	})
+}
+
+// nack 调用 OnNack，失败时重试，重试耗尽后丢弃消息
+func (c *Committer) nack(msg Message) {
+	if c.onNack == nil {
+		c.logger.Error("message nacked without OnNack, dropped", elog.String("topic", msg.Topic), elog.Int("partition", msg.Partition), elog.Int64("offset", msg.Offset))
+		return
+	}
+	var err error
+	for attempt := 1; attempt <= c.nackAttempts; attempt++ {
+		if err = c.onNack(msg); err == nil {
+			return
+		}
+		if attempt < c.nackAttempts {
+			time.Sleep(c.nackBackoff)
+		}
+	}
+	c.logger.Error("nack message failed, dropped", elog.FieldErr(err), elog.String("topic", msg.Topic), elog.Int("partition", msg.Partition), elog.Int64("offset", msg.Offset))
+}
+
+func (c *Committer) ack(msg Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.partitions[msg.Partition]
+	if !ok {
+		return
+	}
+	p.acked[msg.Offset] = msg
+	// advance the contiguous prefix
+	for len(p.pending) > 0 {
+		acked, ok := p.acked[p.pending[0]]
+		if !ok {
+			break
+		}
+		delete(p.acked, p.pending[0])
+		p.pending = p.pending[1:]
+		p.committable = &acked
+	}
+}
+
+// committableMessages 返回每个分区最大的连续已确认消息
+func (c *Committer) committableMessages() []*Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	msgs := make([]*Message, 0, len(c.partitions))
+	for _, p := range c.partitions {
+		if p.committable != nil {
+			msgs = append(msgs, p.committable)
+			p.committable = nil
+		}
+	}
+	sort.Slice(msgs, func(i, j int) bool {
+		return msgs[i].Partition < msgs[j].Partition
+	})
+	return msgs
+}
+
+// Inflight 返回已拉取但尚未确认的消息数量
+func (c *Committer) Inflight() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	inflight := 0
+	for _, p := range c.partitions {
+		inflight += len(p.pending) - len(p.acked)
+	}
+	return inflight
+}
+
+// Flush 立即提交所有分区最大的连续已确认 offset
+func (c *Committer) Flush(ctx context.Context) error {
+	msgs := c.committableMessages()
+	if len(msgs) == 0 {
+		return nil
+	}
+	if err := c.commit(ctx, msgs...); err != nil {
+		// 提交失败时放回，等待下一次提交
+		c.mu.Lock()
+		for _, msg := range msgs {
+			if p, ok := c.partitions[msg.Partition]; ok && (p.committable == nil || p.committable.Offset < msg.Offset) {
+				p.committable = msg
+			}
+		}
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Run 按 interval 周期提交，ctx 结束时做最后一次提交后返回
+func (c *Committer) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx 已经结束，使用新的 context 做最后一次提交
+			if err := c.Flush(context.Background()); err != nil {
+				c.logger.Error("final commit failed", elog.FieldErr(err))
+			}
+			return
+		case <-ticker.C:
+			if err := c.Flush(ctx); err != nil {
+				c.logger.Error("commit failed", elog.FieldErr(err))
+			}
+		}
+	}
+}
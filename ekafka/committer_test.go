@@ -0,0 +1,121 @@
+package ekafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitterContiguousAck(t *testing.T) {
+	var committed []*Message
+	commitErr := error(nil)
+	committer := NewCommitter(func(ctx context.Context, msgs ...*Message) error {
+		if commitErr != nil {
+			return commitErr
+		}
+		committed = append(committed, msgs...)
+		return nil
+	}, time.Second, elog.DefaultLogger)
+
+	m0 := committer.Track(Message{Partition: 0, Offset: 10})
+	m1 := committer.Track(Message{Partition: 0, Offset: 11})
+	m2 := committer.Track(Message{Partition: 0, Offset: 12})
+	p1 := committer.Track(Message{Partition: 1, Offset: 5})
+
+	// 11 已确认，但 10 未确认，不能提交
+	m1.Ack()
+	assert.NoError(t, committer.Flush(context.Background()))
+	assert.Empty(t, committed)
+
+	m0.Ack()
+	p1.Ack()
+	assert.NoError(t, committer.Flush(context.Background()))
+	assert.Len(t, committed, 2)
+	assert.Equal(t, int64(11), committed[0].Offset)
+	assert.Equal(t, int64(5), committed[1].Offset)
+
+	// 提交失败时保留，下次重新提交
+	committed = nil
+	commitErr = errors.New("commit failed")
+	m2.Ack()
+	assert.Error(t, committer.Flush(context.Background()))
+	commitErr = nil
+	assert.NoError(t, committer.Flush(context.Background()))
+	assert.Len(t, committed, 1)
+	assert.Equal(t, int64(12), committed[0].Offset)
+}
+
+func TestCommitterNack(t *testing.T) {
+	var committed []*Message
+	commit := func(ctx context.Context, msgs ...*Message) error {
+		committed = append(committed, msgs...)
+		return nil
+	}
+
+	// 未设置 OnNack 时，Nack 的消息被丢弃，不会阻塞其后消息的提交
+	committer := NewCommitter(commit, time.Second, elog.DefaultLogger)
+	m0 := committer.Track(Message{Offset: 0})
+	m1 := committer.Track(Message{Offset: 1})
+	m0.Nack()
+	m1.Ack()
+	assert.NoError(t, committer.Flush(context.Background()))
+	assert.Len(t, committed, 1)
+	assert.Equal(t, int64(1), committed[0].Offset)
+	assert.Equal(t, 0, committer.Inflight())
+
+	// OnNack 失败时重试，成功后视为已确认
+	committed = nil
+	committer = NewCommitter(commit, time.Second, elog.DefaultLogger)
+	committer.NackRetry(3, time.Millisecond)
+	calls := 0
+	committer.OnNack(func(msg Message) error {
+		calls++
+		if calls < 2 {
+			return errors.New("dlq unavailable")
+		}
+		return nil
+	})
+	m0 = committer.Track(Message{Offset: 0})
+	m0.Nack()
+	m0.Ack()
+	assert.Equal(t, 2, calls)
+	assert.NoError(t, committer.Flush(context.Background()))
+	assert.Len(t, committed, 1)
+	assert.Equal(t, int64(0), committed[0].Offset)
+
+	// 重试耗尽后丢弃，offset 仍然会被提交
+	committed = nil
+	calls = 0
+	committer = NewCommitter(commit, time.Second, elog.DefaultLogger)
+	committer.NackRetry(2, time.Millisecond)
+	committer.OnNack(func(msg Message) error {
+		calls++
+		return errors.New("dlq unavailable")
+	})
+	m0 = committer.Track(Message{Offset: 7})
+	m0.Nack()
+	assert.Equal(t, 2, calls)
+	assert.NoError(t, committer.Flush(context.Background()))
+	assert.Len(t, committed, 1)
+	assert.Equal(t, int64(7), committed[0].Offset)
+}
+
+func TestCommitterZeroInterval(t *testing.T) {
+	committer := NewCommitter(func(ctx context.Context, msgs ...*Message) error {
+		return nil
+	}, 0, elog.DefaultLogger)
+	assert.Equal(t, DefaultCommitInterval, committer.interval)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	exit := make(chan struct{})
+	go func() {
+		committer.Run(ctx)
+		close(exit)
+	}()
+	cancel()
+	<-exit
+}
@@ -1,8 +1,10 @@
 package ekafka
 
 import (
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/gotomicro/ego/core/elog"
 	"github.com/gotomicro/ego/core/etrace"
@@ -87,30 +89,67 @@ func (cmp *Component) Producer(name string) *Producer {
 		}
 	}
 
-	kafkaWriter := &kafka.Writer{
-		Addr:         kafka.TCP(cmp.config.Brokers...),
-		Topic:        config.Topic,
-		Balancer:     balancer,
-		MaxAttempts:  config.MaxAttempts,
-		BatchSize:    config.BatchSize,
-		BatchBytes:   config.BatchBytes,
-		BatchTimeout: config.BatchTimeout,
-		ReadTimeout:  config.ReadTimeout,
-		WriteTimeout: config.WriteTimeout,
-		RequiredAcks: config.RequiredAcks,
-		Async:        config.Async,
+	compression, err := parseCompression(config.Compression)
+	if err != nil {
+		cmp.producerMu.Unlock()
+		cmp.logger.Panic("parse compression error", elog.String("compression", config.Compression), elog.FieldErr(err))
+	}
+	newWriter := func(brokers []string) *kafka.Writer {
+		kafkaWriter := &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        config.Topic,
+			Balancer:     balancer,
+			MaxAttempts:  config.MaxAttempts,
+			BatchSize:    config.BatchSize,
+			BatchBytes:   config.BatchBytes,
+			BatchTimeout: config.BatchTimeout,
+			ReadTimeout:  config.ReadTimeout,
+			WriteTimeout: config.WriteTimeout,
+			RequiredAcks: config.RequiredAcks,
+			Async:        config.Async,
+		}
+		if transport != nil {
+			kafkaWriter.Transport = transport
+		}
+		if compression > 0 {
+			kafkaWriter.Compression = compression
+		}
+		return kafkaWriter
 	}
+	kafkaWriter := newWriter(cmp.config.Brokers)
 
-	if transport != nil {
-		kafkaWriter.Transport = transport
+	if config.MaxMessageBytes > 0 {
+		if err := cmp.verifyMaxMessageBytes(config.Topic, config.MaxMessageBytes); err != nil {
+			cmp.producerMu.Unlock()
+			cmp.logger.Panic("verify maxMessageBytes error", elog.String("name", name), elog.FieldErr(err))
+		}
 	}
-	if config.Compression > 0 {
-		kafkaWriter.Compression = kafka.Compression(config.Compression)
+
+	switch config.OversizeAction {
+	case "":
+		config.OversizeAction = OversizeActionReject
+	case OversizeActionReject, OversizeActionTruncate:
+	case OversizeActionOffload:
+		if cmp.config.offloader == nil {
+			cmp.producerMu.Unlock()
+			cmp.logger.Panic("oversizeAction offload requires an offloader, use WithOffloader", elog.String("name", name))
+		}
+	default:
+		cmp.producerMu.Unlock()
+		cmp.logger.Panic("unknown oversizeAction", elog.String("name", name), elog.String("oversizeAction", config.OversizeAction))
 	}
 
 	producer := &Producer{
-		w:       kafkaWriter,
-		logMode: cmp.config.Debug,
+		w:               kafkaWriter,
+		logMode:         cmp.config.Debug,
+		compName:        cmp.compName,
+		maxMessageBytes: config.MaxMessageBytes,
+		oversizeAction:  config.OversizeAction,
+		truncateFields:  config.TruncateFields,
+		offloader:       cmp.config.offloader,
+	}
+	if len(config.Failover.Brokers) > 0 {
+		producer.failover = newFailoverWriter(kafkaWriter, newWriter(config.Failover.Brokers), config.Failover, cmp.logger.With(elog.String("producer", name)))
 	}
 	producer.setProcessor(cmp.interceptorClientChain())
 	cmp.producers[name] = producer
@@ -189,6 +228,8 @@ func (cmp *Component) Consumer(name string) *Consumer {
 		Config:  config,
 		Brokers: cmp.config.Brokers,
 		tracer:  etrace.NewTracer(trace.SpanKindConsumer),
+		gate:    newPauseGate(),
+		limiter: newConsumeLimiter(config.RateLimit, config.ByteRateLimit),
 	}
 	consumer.setProcessor(cmp.interceptorServerChain())
 	cmp.consumers[name] = consumer
@@ -245,7 +286,9 @@ func (cmp *Component) ConsumerGroup(name string) *ConsumerGroup {
 			ReadBackoffMin:  config.ReadBackoffMin,
 			ReadBackoffMax:  config.ReadBackoffMax,
 		},
-		logMode: cmp.config.Debug,
+		RateLimit:     config.RateLimit,
+		ByteRateLimit: config.ByteRateLimit,
+		logMode:       cmp.config.Debug,
 	})
 	if err != nil {
 		cmp.logger.Panic("create ConsumerGroup failed", elog.FieldErr(err))
@@ -281,3 +324,22 @@ func (cmp *Component) Client() *Client {
 
 	return cmp.client
 }
+
+// verifyMaxMessageBytes 检查配置的 maxMessageBytes 是否超过 topic 的 max.message.bytes
+// 无法获取 broker 配置时只记录日志，不阻止启动
+func (cmp *Component) verifyMaxMessageBytes(topic string, maxMessageBytes int64) error {
+	if topic == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	limit, err := cmp.Client().topicMaxMessageBytes(ctx, topic)
+	if err != nil {
+		cmp.logger.Warn("describe topic max.message.bytes failed, skip verifying", elog.String("topic", topic), elog.FieldErr(err))
+		return nil
+	}
+	if maxMessageBytes > limit {
+		return fmt.Errorf("maxMessageBytes %d exceeds max.message.bytes %d of topic %s", maxMessageBytes, limit, topic)
+	}
+	return nil
+}
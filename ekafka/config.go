@@ -25,6 +25,7 @@ type config struct {
 	clientInterceptors         []ClientInterceptor
 	serverInterceptors         []ServerInterceptor
 	balancers                  map[string]Balancer
+	offloader                  Offloader
 	EnableTraceInterceptor     bool // 是否开启链路追踪，默认开启
 	EnableAccessInterceptor    bool // 是否开启记录请求数据，默认不开启
 	EnableAccessInterceptorReq bool // 是否开启记录请求参数，默认不开启
@@ -41,7 +42,8 @@ type clientConfig struct {
 type producerConfig struct {
 	// Topic 指定生产的消息推送到哪个topic
 	Topic string `json:"topic" toml:"topic"`
-	// Balancer 指定使用哪种Balancer，可选：hash\roundRobin
+	// Balancer 指定使用哪种Balancer，可选：hash\roundRobin\sticky\leastBytes\crc32\murmur2，
+	// 也可以是通过 WithRegisterBalancer、WithRegisterBalancerFunc 注册的自定义 balancer
 	Balancer string `json:"balancer" toml:"balancer"`
 	// MaxAttempts 最大重试次数，默认10次
 	MaxAttempts int `json:"maxAttempts" toml:"maxAttempts"`
@@ -62,12 +64,31 @@ type producerConfig struct {
 	RequiredAcks kafka.RequiredAcks `json:"requiredAcks" toml:"requiredAcks"`
 	// Async 设置成true时会导致WriteMessages非阻塞，会导致调用WriteMessages方法获取不到error
 	Async bool `json:"async" toml:"async"`
-	// Compression 压缩
-	// compress.Gzip (1)
-	// compress.Snappy (2)
-	// compress.Lz4 (3)
-	// compress.Zstd (4)
-	Compression int `json:"compression"  toml:"compression"`
+	// Compression 压缩，可以配置名称或者编号
+	// gzip (1)
+	// snappy (2)
+	// lz4 (3)
+	// zstd (4)
+	Compression string `json:"compression"  toml:"compression"`
+	// MaxMessageBytes 单条消息（key + value + headers）的最大字节数，超过时按 OversizeAction 处理，默认不限制
+	// 配置后启动时会检查 topic 的 max.message.bytes，超过 broker 限制时 panic
+	MaxMessageBytes int64 `json:"maxMessageBytes" toml:"maxMessageBytes"`
+	// OversizeAction 超过 MaxMessageBytes 的消息的处理方式，可选：reject\truncate\offload，默认 reject
+	// reject 返回 ErrMessageTooLarge；truncate 截断 value；offload 通过 WithOffloader 注册的 Offloader 转存 value
+	OversizeAction string `json:"oversizeAction" toml:"oversizeAction"`
+	// TruncateFields truncate 时优先截断的 JSON 字段路径，如 ["payload", "data.body"]，为空时截断最长的字符串字段
+	TruncateFields []string `json:"truncateFields" toml:"truncateFields"`
+	// Failover 主集群不可用时切换到备用集群，仅在同步写入（async = false）时生效
+	Failover failoverConfig `json:"failover" toml:"failover"`
+}
+
+type failoverConfig struct {
+	// Brokers 备用集群地址，为空时不开启
+	Brokers []string `json:"brokers" toml:"brokers"`
+	// After 主集群持续不可用多久后切换到备用集群，默认30s
+	After time.Duration `json:"after" toml:"after"`
+	// BufferSize 主集群不可用期间最多缓存的消息条数，超过时 WriteMessages 返回错误，默认10000条
+	BufferSize int `json:"bufferSize" toml:"bufferSize"`
 }
 
 type consumerConfig struct {
@@ -99,6 +120,10 @@ type consumerConfig struct {
 	StartOffset       int64         `json:"startOffset" toml:"startOffset"`
 	ReadBackoffMin    time.Duration `json:"readBackoffMin" toml:"readBackoffMin"`
 	ReadBackoffMax    time.Duration `json:"readBackoffMax" toml:"readBackoffMax"`
+	// RateLimit 每秒最多消费的消息条数，默认不限制
+	RateLimit float64 `json:"rateLimit" toml:"rateLimit"`
+	// ByteRateLimit 每秒最多消费的字节数，默认不限制
+	ByteRateLimit int `json:"byteRateLimit" toml:"byteRateLimit"`
 }
 
 type consumerGroupConfig struct {
@@ -121,11 +146,19 @@ type consumerGroupConfig struct {
 	CommitInterval  time.Duration `json:"commitInterval" toml:"commitInterval"`
 	ReadBackoffMin  time.Duration `json:"readBackoffMin" toml:"readBackoffMin"`
 	ReadBackoffMax  time.Duration `json:"readBackoffMax" toml:"readBackoffMax"`
+	// RateLimit 每秒最多消费的消息条数，所有分区共享，默认不限制
+	RateLimit float64 `json:"rateLimit" toml:"rateLimit"`
+	// ByteRateLimit 每秒最多消费的字节数，所有分区共享，默认不限制
+	ByteRateLimit int `json:"byteRateLimit" toml:"byteRateLimit"`
 }
 
 const (
 	balancerHash       = "hash"
 	balancerRoundRobin = "roundRobin"
+	balancerSticky     = "sticky"
+	balancerLeastBytes = "leastBytes"
+	balancerCRC32      = "crc32"
+	balancerMurmur2    = "murmur2"
 )
 
 // DefaultConfig 返回默认配置
@@ -137,6 +170,10 @@ func DefaultConfig() *config {
 		balancers: map[string]Balancer{
 			balancerHash:       &kafka.Hash{},
 			balancerRoundRobin: &kafka.RoundRobin{},
+			balancerSticky:     NewStickyBalancer(defaultStickyBatchSize),
+			balancerLeastBytes: &kafka.LeastBytes{},
+			balancerCRC32:      kafka.CRC32Balancer{},
+			balancerMurmur2:    kafka.Murmur2Balancer{},
 		},
 	}
 }
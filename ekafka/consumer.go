@@ -17,10 +17,15 @@ type Consumer struct {
 	Config    consumerConfig
 	Brokers   []string `json:"brokers" toml:"brokers"`
 	tracer    *etrace.Tracer
+	gate      *pauseGate
+	limiter   *consumeLimiter
+	probe     fetchProbe
 }
 
 type Message = kafka.Message
 
+type Header = kafka.Header
+
 type logMessage struct {
 	Topic         string
 	Partition     int
@@ -96,8 +101,15 @@ func (r *Consumer) CommitMessages(ctx context.Context, msgs ...*Message) (err er
 }
 
 func (r *Consumer) FetchMessage(ctx context.Context) (msg Message, ctxOutput context.Context, err error) {
+	if err = r.gate.wait(ctx, r.Config.Partition); err != nil {
+		return msg, ctx, err
+	}
 	err = r.processor(func(ctx context.Context, msgs Messages, c *cmd) error {
 		msg, err = r.r.FetchMessage(ctx)
+		if err == nil {
+			r.probe.observe(msg)
+			err = r.limiter.wait(ctx, msg)
+		}
 		// 在后面才解析了header
 		ctxOutput = r.getCtx(ctx, msg)
 		logCmd(r.logMode, c, "FetchMessage", cmdWithMsg(msg))
@@ -124,8 +136,15 @@ func (r *Consumer) ReadLag(ctx context.Context) (lag int64, err error) {
 }
 
 func (r *Consumer) ReadMessage(ctx context.Context) (msg Message, ctxOutput context.Context, err error) {
+	if err = r.gate.wait(ctx, r.Config.Partition); err != nil {
+		return msg, ctx, err
+	}
 	err = r.processor(func(ctx context.Context, msgs Messages, c *cmd) error {
 		msg, err = r.r.ReadMessage(ctx)
+		if err == nil {
+			r.probe.observe(msg)
+			err = r.limiter.wait(ctx, msg)
+		}
 		// 在后面才解析了header
 		ctxOutput = r.getCtx(ctx, msg)
 		logCmd(r.logMode, c, "ReadMessage", cmdWithRes(msg), cmdWithMsg(msg))
@@ -134,6 +153,36 @@ func (r *Consumer) ReadMessage(ctx context.Context) (msg Message, ctxOutput cont
 	return
 }
 
+// LastFetch 返回最近一次成功拉取消息的时间，以及拉取时该分区剩余未消费的消息数，尚未拉取到消息时 at 为零值
+func (r *Consumer) LastFetch() (at time.Time, lag int64) {
+	return r.probe.last()
+}
+
+// Pause 暂停消费，FetchMessage、ReadMessage 会阻塞直到 Resume 或 ctx 结束
+func (r *Consumer) Pause() {
+	r.gate.pause()
+}
+
+// Resume 恢复消费，不会解除 Hold
+func (r *Consumer) Resume() {
+	r.gate.resume()
+}
+
+// Hold 按原因暂停消费，与 Pause 相互独立，只能通过相同原因的 Release 恢复，用于健康检查等自动暂停
+func (r *Consumer) Hold(reason string) {
+	r.gate.hold(reason)
+}
+
+// Release 解除 Hold，不会恢复 Pause 的暂停
+func (r *Consumer) Release(reason string) {
+	r.gate.release(reason)
+}
+
+// IsPaused 返回是否处于暂停状态
+func (r *Consumer) IsPaused() bool {
+	return r.gate.isPaused(r.Config.Partition)
+}
+
 func (r *Consumer) SetOffset(offset int64) (err error) {
 	return r.processor(func(ctx context.Context, msgs Messages, c *cmd) error {
 		logCmd(r.logMode, c, "SetOffset")
@@ -148,6 +197,11 @@ func (r *Consumer) SetOffsetAt(ctx context.Context, t time.Time) (err error) {
 	})(ctx, nil, &cmd{})
 }
 
+// MessageContext 将消息头中的自定义 context key 写入 ctx，与 FetchMessage 返回的 ctx 一致
+func (r *Consumer) MessageContext(ctx context.Context, msg Message) context.Context {
+	return r.getCtx(ctx, msg)
+}
+
 func (r *Consumer) getCtx(ctx context.Context, msg Message) context.Context {
 	// 我也不想这么处理追加的context内容。奈何协议头在用户数据里，无能为力。。。
 	if transport.CustomContextKeysLength() > 0 {
@@ -20,10 +20,13 @@ type TopicPartition struct {
 
 type AssignedPartitions struct {
 	Partitions []TopicPartition
+	// GenerationID 消费组的 generation，每次 rebalance 后递增，可作为 fencing token
+	GenerationID int32
 }
 
 type RevokedPartitions struct {
-	Partitions []TopicPartition
+	Partitions   []TopicPartition
+	GenerationID int32
 }
 
 type ConsumerGroup struct {
@@ -35,6 +38,9 @@ type ConsumerGroup struct {
 	genMu      sync.RWMutex
 	readerWg   sync.WaitGroup
 	processor  ClientInterceptor
+	gate       *pauseGate
+	limiter    *consumeLimiter
+	probe      fetchProbe
 }
 
 func createTopicPartitionsFromGenAssignments(genAssignments map[string][]kafka.PartitionAssignment) []TopicPartition {
@@ -79,6 +85,10 @@ type ConsumerGroupOptions struct {
 	SASLUserName           string
 	SASLPassword           string
 	SASLMechanism          string
+	// RateLimit 每秒最多消费的消息条数，所有分区共享，默认不限制
+	RateLimit float64
+	// ByteRateLimit 每秒最多消费的字节数，所有分区共享，默认不限制
+	ByteRateLimit int
 }
 
 func NewConsumerGroup(options ConsumerGroupOptions) (*ConsumerGroup, error) {
@@ -124,6 +134,8 @@ func NewConsumerGroup(options ConsumerGroupOptions) (*ConsumerGroup, error) {
 		events: make(chan interface{}, 100),
 		//processor: defaultProcessor,
 		options: &options,
+		gate:    newPauseGate(),
+		limiter: newConsumeLimiter(options.RateLimit, options.ByteRateLimit),
 	}
 	go cg.run()
 
@@ -159,7 +171,8 @@ func (cg *ConsumerGroup) run() {
 
 		// Emit AssignedPartitions event
 		cg.events <- AssignedPartitions{
-			Partitions: topicPartitions,
+			Partitions:   topicPartitions,
+			GenerationID: gen.ID,
 		}
 
 		// We don't support multiple topics yet.
@@ -209,6 +222,16 @@ func (cg *ConsumerGroup) run() {
 				// seek to the last committed offset for this partition.
 				reader.SetOffset(offset)
 				for {
+					// block while this partition is paused
+					if err := cg.gate.wait(ctx, partition); err != nil {
+						revokeOnce.Do(func() {
+							cg.events <- RevokedPartitions{
+								Partitions:   topicPartitions,
+								GenerationID: gen.ID,
+							}
+						})
+						return
+					}
 					msg, err := reader.FetchMessage(ctx)
 
 					switch err {
@@ -218,7 +241,8 @@ func (cg *ConsumerGroup) run() {
 						// emit RevokedPartitions event
 						revokeOnce.Do(func() {
 							cg.events <- RevokedPartitions{
-								Partitions: topicPartitions,
+								Partitions:   topicPartitions,
+								GenerationID: gen.ID,
 							}
 						})
 
@@ -228,6 +252,10 @@ func (cg *ConsumerGroup) run() {
 						return
 					case nil:
 						// message received.
+						cg.probe.observe(msg)
+						if err := cg.limiter.wait(ctx, msg); err != nil {
+							continue
+						}
 						cg.events <- msg
 					default:
 						cg.events <- err
@@ -293,6 +321,57 @@ func (cg *ConsumerGroup) CommitMessages(ctx context.Context, messages ...Message
 	})(ctx, nil, &cmd{})
 }
 
+// GenerationID 返回当前 generation，尚未加入消费组时返回 false
+func (cg *ConsumerGroup) GenerationID() (int32, bool) {
+	cg.genMu.RLock()
+	defer cg.genMu.RUnlock()
+	if cg.currentGen == nil {
+		return 0, false
+	}
+	return cg.currentGen.ID, true
+}
+
+// Joined 返回是否已经加入消费组并分配到 generation
+func (cg *ConsumerGroup) Joined() bool {
+	_, ok := cg.GenerationID()
+	return ok
+}
+
+// LastFetch 返回最近一次成功拉取消息的时间，以及拉取时该分区剩余未消费的消息数，尚未拉取到消息时 at 为零值
+func (cg *ConsumerGroup) LastFetch() (at time.Time, lag int64) {
+	return cg.probe.last()
+}
+
+// Pause 暂停指定分区的消费，不指定分区时暂停全部分区，暂停期间仍保持在消费组中
+func (cg *ConsumerGroup) Pause(partitions ...int) {
+	cg.gate.pause(partitions...)
+}
+
+// Resume 恢复指定分区的消费，不指定分区时恢复全部分区，不会解除 Hold
+func (cg *ConsumerGroup) Resume(partitions ...int) {
+	cg.gate.resume(partitions...)
+}
+
+// Hold 按原因暂停全部分区的消费，与 Pause 相互独立，只能通过相同原因的 Release 恢复，用于健康检查等自动暂停
+func (cg *ConsumerGroup) Hold(reason string) {
+	cg.gate.hold(reason)
+}
+
+// Release 解除 Hold，不会恢复 Pause 暂停的分区
+func (cg *ConsumerGroup) Release(reason string) {
+	cg.gate.release(reason)
+}
+
+// IsPaused 返回分区是否处于暂停状态
+func (cg *ConsumerGroup) IsPaused(partition int) bool {
+	return cg.gate.isPaused(partition)
+}
+
+// PausedPartitions 返回被单独暂停的分区
+func (cg *ConsumerGroup) PausedPartitions() []int {
+	return cg.gate.paused()
+}
+
 func (cg *ConsumerGroup) Close() error {
 	return cg.processor(func(ctx context.Context, msgs Messages, c *cmd) error {
 		logCmd(cg.options.logMode, c, "ConsumerClose")
@@ -0,0 +1,106 @@
+package consumerserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gotomicro/ego-component/ekafka"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+func (cmp *Component) launchOnConsumerEachAckMessage() error {
+	consumer := cmp.Consumer()
+	if cmp.onEachAckMessageHandler == nil {
+		return errors.New("you must define a MessageHandler first")
+	}
+
+	committer := ekafka.NewCommitter(consumer.CommitMessages, cmp.config.CommitInterval, cmp.logger)
+	if cmp.retryEnabled() {
+		committer.OnNack(func(message ekafka.Message) error {
+			return cmp.republish(cmp.handlerCtx, message)
+		})
+	}
+	committerCtx, stopCommitter := context.WithCancel(context.Background())
+	committerExit := make(chan struct{})
+	go func() {
+		committer.Run(committerCtx)
+		close(committerExit)
+	}()
+
+	unrecoverableError := make(chan error, 1)
+	go func() {
+		for {
+			if cmp.ServerCtx.Err() != nil {
+				return
+			}
+			message, _, err := consumer.FetchMessage(cmp.ServerCtx)
+			if err != nil {
+				// Stopped fetching by GracefulStop.
+				if cmp.ServerCtx.Err() != nil {
+					return
+				}
+				cmp.consumptionErrors <- err
+				cmp.logger.Error("encountered an error while fetching message", elog.FieldErr(err))
+
+				// If this error is unrecoverable, stop consuming.
+				if isErrorUnrecoverable(err) {
+					unrecoverableError <- err
+					return
+				}
+				// Otherwise, try to fetch message again.
+				continue
+			}
+
+			// 来自 retry topic 的消息需要等到指定时间之后再处理
+			if err = cmp.waitNotBefore(message); err != nil {
+				return
+			}
+
+			ackMessage := committer.Track(message)
+			if err = cmp.onEachAckMessageHandler(consumer.MessageContext(cmp.handlerCtx, message), ackMessage); err != nil {
+				cmp.logger.Error("encountered an error while handling message", elog.FieldErr(err))
+				cmp.consumptionErrors <- err
+				ackMessage.Nack()
+			}
+		}
+	}()
+
+	var rootErr error
+	select {
+	case <-cmp.ServerCtx.Done():
+		rootErr = cmp.ServerCtx.Err()
+		cmp.logger.Error("terminating consumer because a context error", elog.FieldErr(rootErr))
+	case rootErr = <-unrecoverableError:
+		cmp.logger.Error("stopping server because of an unrecoverable error", elog.FieldErr(rootErr))
+		cmp.Stop()
+	}
+
+	// 等待已拉取的消息确认完成，最后一次提交完成后再关闭 consumer
+	cmp.drainCommitter(committer)
+	stopCommitter()
+	<-committerExit
+	if err := cmp.closeConsumer(consumer); err != nil {
+		return fmt.Errorf("encountered an error while closing consumer: %w", err)
+	}
+
+	if errors.Is(rootErr, context.Canceled) {
+		return nil
+	}
+	return rootErr
+}
+
+// drainCommitter 等待所有已拉取的消息被确认，handlerCtx 被取消（GracefulStop 超时或 Stop）时不再等待
+func (cmp *Component) drainCommitter(committer *ekafka.Committer) {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for committer.Inflight() > 0 {
+		select {
+		case <-ticker.C:
+		case <-cmp.handlerCtx.Done():
+			cmp.logger.Warn("stop waiting for in-flight messages", elog.Int("inflight", committer.Inflight()))
+			return
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package consumerserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gotomicro/ego-component/ekafka"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/gotomicro/ego/core/emetric"
+	"github.com/segmentio/kafka-go"
+)
+
+func (cmp *Component) launchOnConsumerEachBatch() error {
+	consumer := cmp.Consumer()
+	if cmp.onEachBatchHandler == nil {
+		return errors.New("you must define a BatchHandler first")
+	}
+
+	var (
+		compNameTopic = fmt.Sprintf("%s.%s", cmp.ekafkaComponent.GetCompName(), consumer.Config.Topic)
+		brokers       = strings.Join(consumer.Brokers, ",")
+	)
+
+	unrecoverableError := make(chan error, 1)
+	loopExit := make(chan struct{})
+	go func() {
+		defer close(loopExit)
+		for {
+			if cmp.ServerCtx.Err() != nil {
+				return
+			}
+			batch, err := cmp.fetchBatch(consumer)
+			// Stopped fetching by GracefulStop, the messages fetched so far are still handled and committed.
+			if err != nil && cmp.ServerCtx.Err() == nil {
+				cmp.consumptionErrors <- err
+				cmp.logger.Error("encountered an error while fetching message", elog.FieldErr(err))
+
+				// If this error is unrecoverable, stop consuming.
+				if isErrorUnrecoverable(err) {
+					unrecoverableError <- err
+					return
+				}
+				// Otherwise, handle the messages fetched so far.
+			}
+			// 来自 retry topic 的消息需要等到指定时间之后再处理，服务停止时只处理已经到期的消息，
+			// 其余消息不提交，重启后重新投递
+			batch = cmp.waitBatchNotBefore(batch)
+			if len(batch) == 0 {
+				continue
+			}
+
+			now := time.Now()
+			retryCount := 0
+
+		HANDLER:
+			err = cmp.onEachBatchHandler(cmp.handlerCtx, batch)
+			emetric.ClientHandleHistogram.WithLabelValues("kafka", compNameTopic, "HANDLER_BATCH", brokers).Observe(time.Since(now).Seconds())
+			if err != nil {
+				emetric.ClientHandleCounter.Inc("kafka", compNameTopic, "HANDLER_BATCH", brokers, "Error")
+			} else {
+				emetric.ClientHandleCounter.Inc("kafka", compNameTopic, "HANDLER_BATCH", brokers, "OK")
+			}
+
+			if err != nil {
+				cmp.logger.Error("encountered an error while handling batch", elog.FieldErr(err), elog.Int("size", len(batch)))
+				cmp.consumptionErrors <- err
+
+				// If it's a retryable error, we should execute the handler again with the whole batch.
+				if errors.Is(err, ErrRecoverableError) && retryCount < maxOnEachMessageHandlerRetryCount {
+					retryCount++
+					goto HANDLER
+				}
+				// If retry topics are enabled, republish the whole batch and commit it.
+				if cmp.retryEnabled() {
+					for _, message := range batch {
+						if err = cmp.republish(cmp.handlerCtx, message); err != nil {
+							cmp.consumptionErrors <- err
+							cmp.logger.Error("encountered an error while republishing message", elog.FieldErr(err))
+							unrecoverableError <- err
+							return
+						}
+					}
+					goto COMMIT
+				}
+				unrecoverableError <- err
+				return
+			}
+
+		COMMIT:
+			err = consumer.CommitMessages(cmp.handlerCtx, messagePointers(batch)...)
+			emetric.ClientHandleHistogram.WithLabelValues("kafka", compNameTopic, "COMMIT", brokers).Observe(time.Since(now).Seconds())
+			if err != nil {
+				emetric.ClientHandleCounter.Inc("kafka", compNameTopic, "COMMIT", brokers, "Error")
+			} else {
+				emetric.ClientHandleCounter.Inc("kafka", compNameTopic, "COMMIT", brokers, "OK")
+			}
+
+			if err != nil {
+				cmp.consumptionErrors <- err
+				cmp.logger.Error("encountered an error while committing batch", elog.FieldErr(err))
+
+				// If this error is unrecoverable, stop retry and consuming.
+				if isErrorUnrecoverable(err) {
+					unrecoverableError <- err
+					return
+				}
+
+				if cmp.ServerCtx.Err() != nil {
+					return
+				}
+
+				// Try to commit this batch again.
+				cmp.logger.Debug("try to commit batch again")
+				goto COMMIT
+			}
+		}
+	}()
+
+	select {
+	case <-cmp.ServerCtx.Done():
+		rootErr := cmp.ServerCtx.Err()
+		cmp.logger.Error("terminating consumer because a context error", elog.FieldErr(rootErr))
+
+		cmp.drain(loopExit)
+		err := cmp.closeConsumer(consumer)
+		if err != nil {
+			return fmt.Errorf("encountered an error while closing consumer: %w", err)
+		}
+
+		if errors.Is(rootErr, context.Canceled) {
+			return nil
+		}
+
+		return rootErr
+	case originErr := <-unrecoverableError:
+		cmp.logger.Fatal("stopping server because of an unrecoverable error", elog.FieldErr(originErr))
+		cmp.Stop()
+
+		err := cmp.closeConsumer(consumer)
+		if err != nil {
+			return fmt.Errorf("exiting due to an unrecoverable error, but encountered an error while closing consumer: %w", err)
+		}
+		return originErr
+	}
+}
+
+// fetchBatch 拉取一批消息，达到 MaxSize 条或者距离第一条消息超过 MaxAge 时返回
+func (cmp *Component) fetchBatch(consumer *ekafka.Consumer) ([]kafka.Message, error) {
+	batch := make([]kafka.Message, 0, cmp.config.Batch.MaxSize)
+
+	// 第一条消息没有等待时间限制
+	message, _, err := consumer.FetchMessage(cmp.ServerCtx)
+	if err != nil {
+		return batch, err
+	}
+	batch = append(batch, message)
+
+	ctx, cancel := context.WithTimeout(cmp.ServerCtx, cmp.config.Batch.MaxAge)
+	defer cancel()
+	for len(batch) < cmp.config.Batch.MaxSize {
+		message, _, err = consumer.FetchMessage(ctx)
+		if err != nil {
+			// 批次超时或服务停止都直接返回已拉取的消息
+			if ctx.Err() != nil {
+				return batch, nil
+			}
+			return batch, err
+		}
+		batch = append(batch, message)
+	}
+	return batch, nil
+}
+
+// waitBatchNotBefore 依次等待批次中每条消息的 not-before 时间，服务停止时返回已经到期的消息
+func (cmp *Component) waitBatchNotBefore(batch []kafka.Message) []kafka.Message {
+	for i, message := range batch {
+		if err := cmp.waitNotBefore(message); err != nil {
+			return batch[:i]
+		}
+	}
+	return batch
+}
+
+func messagePointers(messages []kafka.Message) []*kafka.Message {
+	output := make([]*kafka.Message, 0, len(messages))
+	for i := range messages {
+		output = append(output, &messages[i])
+	}
+	return output
+}
@@ -0,0 +1,42 @@
+package consumerserver
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego-component/ekafka"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// notBeforeMessage 创建 not-before 时间为 t 的消息
+func notBeforeMessage(offset int64, t time.Time) kafka.Message {
+	return kafka.Message{
+		Offset:  offset,
+		Headers: []kafka.Header{{Key: ekafka.HeaderRetryNotBefore, Value: []byte(strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10))}},
+	}
+}
+
+func TestWaitBatchNotBefore(t *testing.T) {
+	cmp := NewConsumerServerComponent("test", DefaultConfig(), nil, elog.DefaultLogger)
+	start := time.Now()
+	batch := []kafka.Message{
+		{Offset: 1},
+		notBeforeMessage(2, start.Add(-time.Second)),
+		notBeforeMessage(3, start.Add(50*time.Millisecond)),
+	}
+
+	// 等待到最后一条消息的 not-before 时间
+	assert.Equal(t, batch, cmp.waitBatchNotBefore(batch))
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond)
+
+	// 服务停止时只返回已经到期的消息
+	batch = append(batch, notBeforeMessage(4, time.Now().Add(time.Hour)), kafka.Message{Offset: 5})
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		_ = cmp.Stop()
+	}()
+	assert.Equal(t, batch[:3], cmp.waitBatchNotBefore(batch))
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gotomicro/ego-component/ekafka"
@@ -30,18 +31,26 @@ const (
 	consumptionModeOnConsumerStart consumptionMode = iota + 1
 	consumptionModeOnConsumerEachMessage
 	consumptionModeOnConsumerGroupStart
+	consumptionModeOnConsumerEachBatch
+	consumptionModeOnConsumerEachAckMessage
 )
 
 // Component starts an Ego server for message consuming.
 type Component struct {
 	ServerCtx                   context.Context
 	stopServer                  context.CancelFunc
+	handlerCtx                  context.Context
+	stopHandlers                context.CancelFunc
+	exited                      chan struct{}
+	started                     int32
 	config                      *config
 	name                        string
 	ekafkaComponent             *ekafka.Component
 	logger                      *elog.Component
 	mode                        consumptionMode
 	onEachMessageHandler        OnEachMessageHandler
+	onEachBatchHandler          OnEachBatchHandler
+	onEachAckMessageHandler     OnEachAckMessageHandler
 	onConsumerStartHandler      OnStartHandler
 	onConsumerGroupStartHandler OnConsumerGroupStartHandler
 	consumptionErrors           chan<- error
@@ -60,15 +69,34 @@ func (cmp *Component) Info() *server.ServiceInfo {
 	return &info
 }
 
-// GracefulStop stops the server.
+// GracefulStop stops fetching new messages, and waits for in-flight messages to be handled and committed
+// until GracefulStopTimeout or ctx is done.
 func (cmp *Component) GracefulStop(ctx context.Context) error {
 	cmp.stopServer()
+	// 没有启动时没有需要等待的消息
+	if atomic.LoadInt32(&cmp.started) == 0 {
+		cmp.stopHandlers()
+		return nil
+	}
+
+	timer := time.NewTimer(cmp.config.GracefulStopTimeout)
+	defer timer.Stop()
+	select {
+	case <-cmp.exited:
+		cmp.logger.Info("in-flight messages drained")
+	case <-timer.C:
+		cmp.logger.Warn("graceful stop timeout, canceling in-flight handlers", elog.Duration("timeout", cmp.config.GracefulStopTimeout))
+	case <-ctx.Done():
+		cmp.logger.Warn("graceful stop canceled, canceling in-flight handlers", elog.FieldErr(ctx.Err()))
+	}
+	cmp.stopHandlers()
 	return nil
 }
 
-// Stop stops the server.
+// Stop stops the server, in-flight handlers are canceled immediately.
 func (cmp *Component) Stop() error {
 	cmp.stopServer()
+	cmp.stopHandlers()
 	return nil
 }
 
@@ -84,6 +112,14 @@ func (cmp *Component) Name() string {
 
 // Start will start consuming.
 func (cmp *Component) Start() error {
+	atomic.StoreInt32(&cmp.started, 1)
+	defer close(cmp.exited)
+	servers.Store(cmp.name, cmp)
+	defer servers.Delete(cmp.name)
+	if cmp.config.healthCheck != nil {
+		go cmp.watchHealth()
+	}
+
 	switch cmp.mode {
 	case consumptionModeOnConsumerStart:
 		return cmp.launchOnConsumerStart()
@@ -91,6 +127,10 @@ func (cmp *Component) Start() error {
 		return cmp.launchOnConsumerGroupStart()
 	case consumptionModeOnConsumerEachMessage:
 		return cmp.launchOnConsumerEachMessage()
+	case consumptionModeOnConsumerEachBatch:
+		return cmp.launchOnConsumerEachBatch()
+	case consumptionModeOnConsumerEachAckMessage:
+		return cmp.launchOnConsumerEachAckMessage()
 	default:
 		return fmt.Errorf("undefined consumption mode: %v", cmp.mode)
 	}
@@ -114,6 +154,22 @@ func (cmp *Component) OnEachMessage(consumptionErrors chan<- error, handler OnEa
 	return nil
 }
 
+// OnEachBatch 批量消费，按 batch 配置攒批后调用 handler，handler 成功后整批提交
+func (cmp *Component) OnEachBatch(consumptionErrors chan<- error, handler OnEachBatchHandler) error {
+	cmp.consumptionErrors = consumptionErrors
+	cmp.mode = consumptionModeOnConsumerEachBatch
+	cmp.onEachBatchHandler = handler
+	return nil
+}
+
+// OnEachAckMessage 手动提交模式，由 handler 调用 Ack/Nack，后台按 commitInterval 提交每个分区最大的连续已确认 offset
+func (cmp *Component) OnEachAckMessage(consumptionErrors chan<- error, handler OnEachAckMessageHandler) error {
+	cmp.consumptionErrors = consumptionErrors
+	cmp.mode = consumptionModeOnConsumerEachAckMessage
+	cmp.onEachAckMessageHandler = handler
+	return nil
+}
+
 // OnStart ...
 func (cmp *Component) OnStart(handler OnStartHandler) error {
 	cmp.mode = consumptionModeOnConsumerStart
@@ -230,6 +286,9 @@ func (cmp *Component) launchOnConsumerStart() error {
 }
 
 func (cmp *Component) launchOnConsumerEachMessage() error {
+	if cmp.config.Workers > 1 {
+		return cmp.launchOnConsumerEachMessageConcurrently()
+	}
 	consumer := cmp.Consumer()
 	if cmp.onEachMessageHandler == nil {
 		return errors.New("you must define a MessageHandler first")
@@ -240,16 +299,22 @@ func (cmp *Component) launchOnConsumerEachMessage() error {
 		brokers       = strings.Join(consumer.Brokers, ",")
 	)
 
-	unrecoverableError := make(chan error)
+	unrecoverableError := make(chan error, 1)
+	loopExit := make(chan struct{})
 	go func() {
+		defer close(loopExit)
 		for {
 			if cmp.ServerCtx.Err() != nil {
 				return
 			}
 			// The beginning of time monitoring point in time
 			now := time.Now()
-			message, fetchCtx, err := consumer.FetchMessage(cmp.ServerCtx)
+			message, _, err := consumer.FetchMessage(cmp.ServerCtx)
 			if err != nil {
+				// Stopped fetching by GracefulStop.
+				if cmp.ServerCtx.Err() != nil {
+					return
+				}
 				cmp.consumptionErrors <- err
 				cmp.logger.Error("encountered an error while fetching message", elog.FieldErr(err))
 
@@ -262,10 +327,17 @@ func (cmp *Component) launchOnConsumerEachMessage() error {
 				continue
 			}
 			retryCount := 0
+			// In-flight messages are still handled and committed after stopping fetching.
+			handlerCtx := consumer.MessageContext(cmp.handlerCtx, message)
+
+			// 来自 retry topic 的消息需要等到指定时间之后再处理
+			if err = cmp.waitNotBefore(message); err != nil {
+				return
+			}
 
 		HANDLER:
 
-			err = cmp.onEachMessageHandler(fetchCtx, message)
+			err = cmp.onEachMessageHandler(handlerCtx, message)
 			cmp.PackageName()
 			// Record the redis time-consuming
 			emetric.ClientHandleHistogram.WithLabelValues("kafka", compNameTopic, "HANDLER", brokers).Observe(time.Since(now).Seconds())
@@ -284,6 +356,16 @@ func (cmp *Component) launchOnConsumerEachMessage() error {
 					retryCount++
 					goto HANDLER
 				}
+				// If retry topics are enabled, republish the message and commit it.
+				if cmp.retryEnabled() {
+					if err = cmp.republish(handlerCtx, message); err != nil {
+						cmp.consumptionErrors <- err
+						cmp.logger.Error("encountered an error while republishing message", elog.FieldErr(err))
+						unrecoverableError <- err
+						return
+					}
+					goto COMMIT
+				}
 				// Otherwise should be considered as an unrecoverable
 				// error, developers should write their own retry logic in the handler.
 				unrecoverableError <- err
@@ -291,7 +373,7 @@ func (cmp *Component) launchOnConsumerEachMessage() error {
 			}
 
 		COMMIT:
-			err = consumer.CommitMessages(fetchCtx, &message)
+			err = consumer.CommitMessages(handlerCtx, &message)
 
 			// Record the redis time-consuming
 			emetric.ClientHandleHistogram.WithLabelValues("kafka", compNameTopic, "COMMIT", brokers).Observe(time.Since(now).Seconds())
@@ -327,6 +409,7 @@ func (cmp *Component) launchOnConsumerEachMessage() error {
 		rootErr := cmp.ServerCtx.Err()
 		cmp.logger.Error("terminating consumer because a context error", elog.FieldErr(rootErr))
 
+		cmp.drain(loopExit)
 		err := cmp.closeConsumer(consumer)
 		if err != nil {
 			return fmt.Errorf("encountered an error while closing consumer: %w", err)
@@ -353,6 +436,88 @@ func (cmp *Component) launchOnConsumerEachMessage() error {
 	}
 }
 
+// drain 等待消费循环处理完已拉取的消息，handlerCtx 被取消（GracefulStop 超时或 Stop）时不再等待
+func (cmp *Component) drain(loopExit <-chan struct{}) {
+	select {
+	case <-loopExit:
+	case <-cmp.handlerCtx.Done():
+		cmp.logger.Warn("stop waiting for in-flight messages")
+	}
+}
+
+// healthHoldReason 健康检查暂停消费时使用的 Hold 原因，与用户手动 Pause 的分区相互独立
+const healthHoldReason = "consumerserver.health"
+
+// watchHealth 周期性检查下游健康状态，不健康时暂停消费，恢复后继续消费
+func (cmp *Component) watchHealth() {
+	var pause, resume func()
+	if cmp.mode == consumptionModeOnConsumerGroupStart {
+		consumerGroup := cmp.ConsumerGroup()
+		pause = func() { consumerGroup.Hold(healthHoldReason) }
+		resume = func() { consumerGroup.Release(healthHoldReason) }
+	} else {
+		consumer := cmp.Consumer()
+		pause = func() { consumer.Hold(healthHoldReason) }
+		resume = func() { consumer.Release(healthHoldReason) }
+	}
+
+	ticker := time.NewTicker(cmp.config.HealthCheckInterval)
+	defer ticker.Stop()
+	paused := false
+	for {
+		select {
+		case <-cmp.ServerCtx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		err := cmp.config.healthCheck(cmp.ServerCtx)
+		switch {
+		case err != nil && !paused:
+			cmp.logger.Warn("downstream unhealthy, pausing consumption", elog.FieldErr(err))
+			pause()
+			paused = true
+		case err == nil && paused:
+			cmp.logger.Info("downstream recovered, resuming consumption")
+			resume()
+			paused = false
+		}
+	}
+}
+
+func (cmp *Component) retryEnabled() bool {
+	return cmp.config.Retry.ProducerName != ""
+}
+
+// republish 将处理失败的消息投递到下一级 retry topic，重试次数耗尽时投递到死信 topic
+func (cmp *Component) republish(ctx context.Context, message kafka.Message) error {
+	policy := ekafka.RetryPolicy{
+		Delays:   cmp.config.Retry.Delays,
+		DLQTopic: cmp.config.Retry.DLQTopic,
+	}
+	next, dlq := policy.Next(message, time.Now())
+	if dlq {
+		cmp.logger.Warn("message retries exhausted, sending to DLQ", elog.String("topic", next.Topic), elog.Int64("offset", message.Offset))
+	}
+	return cmp.ekafkaComponent.Producer(cmp.config.Retry.ProducerName).WriteMessages(ctx, next)
+}
+
+// waitNotBefore 阻塞直到消息的 not-before 时间，服务停止时返回 context 错误
+func (cmp *Component) waitNotBefore(message kafka.Message) error {
+	delay := time.Until(ekafka.RetryNotBefore(message))
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-cmp.ServerCtx.Done():
+		return cmp.ServerCtx.Err()
+	}
+}
+
 func (cmp *Component) closeConsumer(consumer *ekafka.Consumer) error {
 	if err := consumer.Close(); err != nil {
 		cmp.logger.Fatal("failed to close Consumer", elog.FieldErr(err))
@@ -374,9 +539,13 @@ func (cmp *Component) closeConsumerGroup(consumerGroup *ekafka.ConsumerGroup) er
 // NewConsumerServerComponent creates a new server instance.
 func NewConsumerServerComponent(name string, config *config, ekafkaComponent *ekafka.Component, logger *elog.Component) *Component {
 	serverCtx, stopServer := context.WithCancel(context.Background())
+	handlerCtx, stopHandlers := context.WithCancel(context.Background())
 	return &Component{
 		ServerCtx:       serverCtx,
 		stopServer:      stopServer,
+		handlerCtx:      handlerCtx,
+		stopHandlers:    stopHandlers,
+		exited:          make(chan struct{}),
 		name:            name,
 		config:          config,
 		ekafkaComponent: ekafkaComponent,
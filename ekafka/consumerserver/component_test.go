@@ -0,0 +1,22 @@
+package consumerserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGracefulStopNotStarted(t *testing.T) {
+	config := DefaultConfig()
+	config.GracefulStopTimeout = time.Minute
+	cmp := NewConsumerServerComponent("test", config, nil, elog.DefaultLogger)
+
+	start := time.Now()
+	assert.NoError(t, cmp.GracefulStop(context.Background()))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.Error(t, cmp.ServerCtx.Err())
+	assert.Error(t, cmp.handlerCtx.Err())
+}
@@ -1,19 +1,75 @@
 package consumerserver
 
-import "github.com/gotomicro/ego-component/ekafka"
+import (
+	"time"
+
+	"github.com/gotomicro/ego-component/ekafka"
+)
 
 type config struct {
-	Debug             bool   `json:"debug" toml:"debug"`
-	ConsumerName      string `json:"consumerName" toml:"consumerName"`
-	ConsumerGroupName string `json:"consumerGroupName" toml:"consumerGroupName"`
-	ekafkaComponent   *ekafka.Component
+	Debug             bool        `json:"debug" toml:"debug"`
+	ConsumerName      string      `json:"consumerName" toml:"consumerName"`
+	ConsumerGroupName string      `json:"consumerGroupName" toml:"consumerGroupName"`
+	Retry             retryConfig `json:"retry" toml:"retry"`
+	Batch             batchConfig `json:"batch" toml:"batch"`
+	// Workers 逐条消费模式下并发处理消息的 worker 数量，大于1时开启并发消费，相同 key 的消息仍然按顺序处理
+	Workers int `json:"workers" toml:"workers"`
+	// WorkerQueueSize 每个 worker 的待处理消息队列长度，默认64
+	WorkerQueueSize int `json:"workerQueueSize" toml:"workerQueueSize"`
+	// CommitInterval 手动提交模式（OnEachAckMessage）和并发消费模式下后台提交 offset 的周期，默认1s
+	CommitInterval time.Duration `json:"commitInterval" toml:"commitInterval"`
+	// GracefulStopTimeout 优雅退出时等待已拉取消息处理、提交完成的最长时间，默认10s
+	GracefulStopTimeout time.Duration `json:"gracefulStopTimeout" toml:"gracefulStopTimeout"`
+	// HealthCheckInterval 下游健康检查的周期，配合 WithHealthCheck 使用，检查失败时自动暂停消费
+	HealthCheckInterval time.Duration `json:"healthCheckInterval" toml:"healthCheckInterval"`
+	// Probe 注册到 governor 的健康检查配置
+	Probe           probeConfig `json:"probe" toml:"probe"`
+	ekafkaComponent *ekafka.Component
+	healthCheck     HealthCheckFunc
+}
+
+// probeConfig governor 健康检查配置，通过 /debug/kafka/health 暴露
+type probeConfig struct {
+	// MaxPollInterval 存在积压时允许的最长未拉取消息时间，超过后视为消费卡住，默认5m，0表示不检查
+	MaxPollInterval time.Duration `json:"maxPollInterval" toml:"maxPollInterval"`
+	// MaxLag 允许的最大积压消息数，0表示不检查
+	MaxLag int64 `json:"maxLag" toml:"maxLag"`
+}
+
+// batchConfig 批量消费模式配置，达到 MaxSize 条或者距离第一条消息超过 MaxAge 时调用 handler
+type batchConfig struct {
+	// MaxSize 每批最多消息条数，默认100条
+	MaxSize int `json:"maxSize" toml:"maxSize"`
+	// MaxAge 每批最长等待时间，默认1s
+	MaxAge time.Duration `json:"maxAge" toml:"maxAge"`
+}
+
+// retryConfig 逐条消费模式下的分级延迟重试配置，未配置 ProducerName 时不开启
+type retryConfig struct {
+	// ProducerName 用于投递 retry topic 和死信 topic 的 producer，该 producer 不能配置 topic
+	ProducerName string `json:"producerName" toml:"producerName"`
+	// Delays 每一级重试的等待时间，如 ["5s", "1m", "10m"]
+	Delays []time.Duration `json:"delays" toml:"delays"`
+	// DLQTopic 死信 topic，默认为 <topic>.dlq
+	DLQTopic string `json:"dlqTopic" toml:"dlqTopic"`
 }
 
 // DefaultConfig returns a default config.
 func DefaultConfig() *config {
 	return &config{
-		Debug:             true,
-		ConsumerName:      "default",
-		ConsumerGroupName: "default",
+		Debug:               true,
+		ConsumerName:        "default",
+		ConsumerGroupName:   "default",
+		HealthCheckInterval: 5 * time.Second,
+		GracefulStopTimeout: 10 * time.Second,
+		CommitInterval:      time.Second,
+		WorkerQueueSize:     64,
+		Probe: probeConfig{
+			MaxPollInterval: 5 * time.Minute,
+		},
+		Batch: batchConfig{
+			MaxSize: 100,
+			MaxAge:  time.Second,
+		},
 	}
 }
@@ -39,6 +39,14 @@ func (c *Container) Build(options ...Option) *Component {
 	for _, option := range options {
 		option(c)
 	}
+	if c.config.HealthCheckInterval <= 0 {
+		c.logger.Warn("invalid healthCheckInterval, use default", elog.Duration("healthCheckInterval", c.config.HealthCheckInterval))
+		c.config.HealthCheckInterval = DefaultConfig().HealthCheckInterval
+	}
+	if c.config.CommitInterval <= 0 {
+		c.logger.Warn("invalid commitInterval, use default", elog.Duration("commitInterval", c.config.CommitInterval))
+		c.config.CommitInterval = DefaultConfig().CommitInterval
+	}
 
 	cmp := NewConsumerServerComponent(
 		c.name,
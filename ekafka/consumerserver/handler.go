@@ -9,8 +9,18 @@ import (
 // OnEachMessageHandler ...
 type OnEachMessageHandler = func(ctx context.Context, message kafka.Message) error
 
+// OnEachBatchHandler 批量处理消息，返回 nil 时整批提交，返回错误时整批都不会提交
+type OnEachBatchHandler = func(ctx context.Context, messages []kafka.Message) error
+
+// OnEachAckMessageHandler 手动提交模式下处理消息，处理完成后调用 message.Ack() 或 message.Nack()，可以异步调用
+// 返回错误时，若消息尚未确认则视为 Nack
+type OnEachAckMessageHandler = func(ctx context.Context, message *ekafka.AckMessage) error
+
 // OnStartHandler ...
 type OnStartHandler = func(ctx context.Context, consumer *ekafka.Consumer) error
 
 // OnConsumerGroupStartHandler ...
 type OnConsumerGroupStartHandler = func(ctx context.Context, consumerGroup *ekafka.ConsumerGroup) error
+
+// HealthCheckFunc 检查下游（如数据库）是否健康，返回错误时自动暂停消费
+type HealthCheckFunc = func(ctx context.Context) error
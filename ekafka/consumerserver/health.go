@@ -0,0 +1,75 @@
+package consumerserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego/server/egovernor"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// servers 正在运行的 consumer server，用于 governor 健康检查
+var servers sync.Map
+
+func init() {
+	type probeStatus struct {
+		Healthy bool   `json:"healthy"`
+		Error   string `json:"error,omitempty"`
+	}
+	// 任意一个 consumer server 不健康时返回 503，可以作为 readiness 探针
+	egovernor.HandleFunc("/debug/kafka/health", func(w http.ResponseWriter, r *http.Request) {
+		rets := make(map[string]probeStatus)
+		healthy := true
+		servers.Range(func(key, value interface{}) bool {
+			status := probeStatus{Healthy: true}
+			if err := value.(*Component).Health(); err != nil {
+				status = probeStatus{Healthy: false, Error: err.Error()}
+				healthy = false
+			}
+			rets[key.(string)] = status
+			return true
+		})
+		w.Header().Set("Content-Type", "application/json")
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = jsoniter.NewEncoder(w).Encode(rets)
+	})
+}
+
+// Health 返回 consumer server 的健康状态
+// 已退出、消费组尚未加入、有积压但超过 MaxPollInterval 未拉取到消息、积压超过 MaxLag 时返回错误
+func (cmp *Component) Health() error {
+	select {
+	case <-cmp.exited:
+		return errors.New("consumer server exited")
+	default:
+	}
+
+	var (
+		lastFetch time.Time
+		lag       int64
+	)
+	if cmp.mode == consumptionModeOnConsumerGroupStart {
+		consumerGroup := cmp.ConsumerGroup()
+		if !consumerGroup.Joined() {
+			return errors.New("consumer group has not joined")
+		}
+		lastFetch, lag = consumerGroup.LastFetch()
+	} else {
+		lastFetch, lag = cmp.Consumer().LastFetch()
+	}
+
+	if cmp.config.Probe.MaxPollInterval > 0 && lag > 0 {
+		if idle := time.Since(lastFetch); idle > cmp.config.Probe.MaxPollInterval {
+			return fmt.Errorf("no message fetched for %s while %d messages lagging", idle.Truncate(time.Second), lag)
+		}
+	}
+	if cmp.config.Probe.MaxLag > 0 && lag > cmp.config.Probe.MaxLag {
+		return fmt.Errorf("lag %d exceeds %d", lag, cmp.config.Probe.MaxLag)
+	}
+	return nil
+}
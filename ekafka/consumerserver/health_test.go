@@ -0,0 +1,81 @@
+package consumerserver
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotomicro/ego-component/ekafka"
+	"github.com/gotomicro/ego-component/ekafka/ekafkatest"
+)
+
+func TestHealth(t *testing.T) {
+	broker, err := ekafkatest.NewBroker(ekafkatest.WithTopic("orders", 1))
+	require.NoError(t, err)
+	defer broker.Close()
+	conf := `
+[kafka]
+	[kafka.client]
+		timeout="3s"
+	[kafka.producers.p1]
+		topic="orders"
+		batchTimeout="10ms"
+		requiredAcks=1
+	[kafka.consumers.c1]
+		topic="orders"
+		groupID="billing"
+		maxWait="100ms"
+`
+	require.NoError(t, econf.LoadFromReader(strings.NewReader(conf), toml.Unmarshal))
+	ec := ekafka.Load("kafka").Build(broker.Option())
+
+	config := DefaultConfig()
+	config.ConsumerName = "c1"
+	config.Probe.MaxLag = 1
+	config.Probe.MaxPollInterval = time.Hour
+	cmp := NewConsumerServerComponent("test", config, ec, elog.DefaultLogger)
+	defer cmp.Consumer().Close()
+
+	// 尚未拉取到消息
+	assert.NoError(t, cmp.Health())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	require.NoError(t, ec.Producer("p1").WriteMessages(ctx,
+		&ekafka.Message{Value: []byte("m0")},
+		&ekafka.Message{Value: []byte("m1")},
+		&ekafka.Message{Value: []byte("m2")},
+	))
+
+	// 拉取第一条消息后还有2条积压，超过 MaxLag
+	_, _, err = cmp.Consumer().FetchMessage(ctx)
+	require.NoError(t, err)
+	assert.EqualError(t, cmp.Health(), "lag 2 exceeds 1")
+
+	// 有积压但超过 MaxPollInterval 未拉取到消息
+	config.Probe.MaxLag = 0
+	assert.NoError(t, cmp.Health())
+	config.Probe.MaxPollInterval = time.Millisecond
+	time.Sleep(5 * time.Millisecond)
+	err = cmp.Health()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "2 messages lagging")
+
+	// 消费到最新位置后没有积压
+	for i := 0; i < 2; i++ {
+		_, _, err = cmp.Consumer().FetchMessage(ctx)
+		require.NoError(t, err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	assert.NoError(t, cmp.Health())
+
+	close(cmp.exited)
+	assert.EqualError(t, cmp.Health(), "consumer server exited")
+}
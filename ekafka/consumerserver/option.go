@@ -17,3 +17,10 @@ func WithDebug(debug bool) Option {
 		c.config.Debug = debug
 	}
 }
+
+// WithHealthCheck 设置下游健康检查，检查失败时自动暂停消费，恢复健康后继续消费
+func WithHealthCheck(healthCheck HealthCheckFunc) Option {
+	return func(c *Container) {
+		c.config.healthCheck = healthCheck
+	}
+}
@@ -0,0 +1,178 @@
+package consumerserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego-component/ekafka"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/gotomicro/ego/core/emetric"
+)
+
+type workerTask struct {
+	ctx     context.Context
+	message *ekafka.AckMessage
+}
+
+// launchOnConsumerEachMessageConcurrently 逐条消费的并发版本
+// 相同 key 的消息总是分配给同一个 worker，以保证 key 内有序；只提交每个分区已处理完成的连续 offset
+func (cmp *Component) launchOnConsumerEachMessageConcurrently() error {
+	consumer := cmp.Consumer()
+	if cmp.onEachMessageHandler == nil {
+		return errors.New("you must define a MessageHandler first")
+	}
+
+	var (
+		compNameTopic = fmt.Sprintf("%s.%s", cmp.ekafkaComponent.GetCompName(), consumer.Config.Topic)
+		brokers       = strings.Join(consumer.Brokers, ",")
+	)
+
+	committer := ekafka.NewCommitter(consumer.CommitMessages, cmp.config.CommitInterval, cmp.logger)
+	committerCtx, stopCommitter := context.WithCancel(context.Background())
+	committerExit := make(chan struct{})
+	go func() {
+		committer.Run(committerCtx)
+		close(committerExit)
+	}()
+
+	unrecoverableError := make(chan error, cmp.config.Workers+1)
+	queues := make([]chan workerTask, cmp.config.Workers)
+	var workerWg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan workerTask, cmp.config.WorkerQueueSize)
+		workerWg.Add(1)
+		go func(queue <-chan workerTask) {
+			defer workerWg.Done()
+			for task := range queue {
+				// 出现不可恢复的错误或者优雅退出超时后不再处理剩余消息，这些消息不会被提交
+				if cmp.handlerCtx.Err() != nil {
+					continue
+				}
+				if err := cmp.handleWorkerTask(task, compNameTopic, brokers); err != nil {
+					unrecoverableError <- err
+					cmp.Stop()
+				}
+			}
+		}(queues[i])
+	}
+
+	fetchExit := make(chan struct{})
+	go func() {
+		defer close(fetchExit)
+		for {
+			if cmp.ServerCtx.Err() != nil {
+				return
+			}
+			message, _, err := consumer.FetchMessage(cmp.ServerCtx)
+			if err != nil {
+				if cmp.ServerCtx.Err() != nil {
+					return
+				}
+				cmp.consumptionErrors <- err
+				cmp.logger.Error("encountered an error while fetching message", elog.FieldErr(err))
+
+				// If this error is unrecoverable, stop consuming.
+				if isErrorUnrecoverable(err) {
+					unrecoverableError <- err
+					cmp.Stop()
+					return
+				}
+				// Otherwise, try to fetch message again.
+				continue
+			}
+
+			queue := queues[workerIndex(message, len(queues))]
+			select {
+			case queue <- workerTask{ctx: consumer.MessageContext(cmp.handlerCtx, message), message: committer.Track(message)}:
+			case <-cmp.ServerCtx.Done():
+				return
+			}
+		}
+	}()
+
+	<-cmp.ServerCtx.Done()
+	<-fetchExit
+	for _, queue := range queues {
+		close(queue)
+	}
+	// 等待 worker 处理完队列中的消息
+	workersExit := make(chan struct{})
+	go func() {
+		workerWg.Wait()
+		close(workersExit)
+	}()
+	cmp.drain(workersExit)
+	stopCommitter()
+	<-committerExit
+
+	var rootErr error
+	select {
+	case rootErr = <-unrecoverableError:
+		cmp.logger.Error("stopping server because of an unrecoverable error", elog.FieldErr(rootErr))
+	default:
+		rootErr = cmp.ServerCtx.Err()
+		cmp.logger.Error("terminating consumer because a context error", elog.FieldErr(rootErr))
+	}
+
+	if err := cmp.closeConsumer(consumer); err != nil {
+		return fmt.Errorf("encountered an error while closing consumer: %w", err)
+	}
+	if errors.Is(rootErr, context.Canceled) {
+		return nil
+	}
+	return rootErr
+}
+
+// handleWorkerTask 处理单条消息，成功（或已投递到 retry topic）后确认，返回不可恢复的错误
+func (cmp *Component) handleWorkerTask(task workerTask, compNameTopic string, brokers string) error {
+	message := task.message
+	if err := cmp.waitNotBefore(message.Message); err != nil {
+		return nil
+	}
+
+	retryCount := 0
+	for {
+		now := time.Now()
+		err := cmp.onEachMessageHandler(task.ctx, message.Message)
+		emetric.ClientHandleHistogram.WithLabelValues("kafka", compNameTopic, "HANDLER", brokers).Observe(time.Since(now).Seconds())
+		if err == nil {
+			emetric.ClientHandleCounter.Inc("kafka", compNameTopic, "HANDLER", brokers, "OK")
+			message.Ack()
+			return nil
+		}
+		emetric.ClientHandleCounter.Inc("kafka", compNameTopic, "HANDLER", brokers, "Error")
+		cmp.logger.Error("encountered an error while handling message", elog.FieldErr(err))
+		cmp.consumptionErrors <- err
+
+		// If it's a retryable error, we should execute the handler again.
+		if errors.Is(err, ErrRecoverableError) && retryCount < maxOnEachMessageHandlerRetryCount {
+			retryCount++
+			continue
+		}
+		if cmp.retryEnabled() {
+			if err = cmp.republish(task.ctx, message.Message); err != nil {
+				cmp.consumptionErrors <- err
+				cmp.logger.Error("encountered an error while republishing message", elog.FieldErr(err))
+				return err
+			}
+			message.Ack()
+			return nil
+		}
+		return err
+	}
+}
+
+// workerIndex 相同分区、相同 key 的消息总是分配给同一个 worker，没有 key 的消息按 offset 分配
+func workerIndex(message ekafka.Message, workers int) int {
+	if len(message.Key) == 0 {
+		return int(message.Offset % int64(workers))
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(message.Key)
+	return int((h.Sum32() + uint32(message.Partition)) % uint32(workers))
+}
@@ -0,0 +1,700 @@
+// Package ekafkatest 提供进程内的 kafka broker，用于在没有 kafka 集群的情况下对 producer、consumer 做单元测试
+//
+// Broker 监听本地端口并实现 kafka 协议的一个子集：topic 与分区、生产与消费、消费组（join、sync、heartbeat、leave、提交位点），
+// 以及通过 Rebalance 主动触发消费组重平衡。ekafka 与 kafka-go 的客户端不需要任何修改，只需要把 brokers 指向 Broker.Addr。
+// 所有数据保存在内存中，不支持副本、事务和 SASL，写入的压缩消息会被解压保存，消费到的消息总是不压缩的。
+package ekafkatest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego-component/ekafka"
+	"github.com/segmentio/kafka-go"
+)
+
+// ErrTopicNotFound topic 不存在
+var ErrTopicNotFound = errors.New("ekafkatest: topic not found")
+
+const nodeID = 1
+
+// 协议错误码
+const (
+	errNone                    int16 = 0
+	errOffsetOutOfRange        int16 = 1
+	errCorruptMessage          int16 = 2
+	errUnknownTopicOrPartition int16 = 3
+	errCoordinatorNotAvailable int16 = 15
+	errIllegalGeneration       int16 = 22
+	errInconsistentProtocol    int16 = 23
+	errUnknownMemberID         int16 = 25
+	errRebalanceInProgress     int16 = 27
+	errTopicAlreadyExists      int16 = 36
+	errInvalidPartitions       int16 = 37
+)
+
+// apiVersion broker 支持的请求版本，客户端会按这里声明的版本发送请求
+type apiVersion struct {
+	key      int16
+	min, max int16
+}
+
+var apiVersions = []apiVersion{
+	{key: 0, min: 3, max: 3},
+	{key: 1, min: 5, max: 5},
+	{key: 2, min: 1, max: 1},
+	{key: 3, min: 1, max: 1},
+	{key: 8, min: 2, max: 2},
+	{key: 9, min: 1, max: 1},
+	{key: 10, min: 0, max: 0},
+	{key: 11, min: 1, max: 1},
+	{key: 12, min: 0, max: 0},
+	{key: 13, min: 0, max: 0},
+	{key: 14, min: 0, max: 0},
+	{key: 18, min: 0, max: 0},
+	{key: 19, min: 0, max: 0},
+	{key: 20, min: 0, max: 0},
+}
+
+// Option 可选项
+type Option func(b *Broker)
+
+// WithTopic 启动时创建 topic，kafka-go 的 Writer 不会自动创建 topic，生产消息前需要先创建
+func WithTopic(topic string, partitions int) Option {
+	return func(b *Broker) {
+		b.pending = append(b.pending, pendingTopic{topic: topic, partitions: partitions})
+	}
+}
+
+// Broker 进程内的 kafka broker
+type Broker struct {
+	pending []pendingTopic
+
+	listener net.Listener
+	host     string
+	port     int32
+
+	mu     sync.Mutex
+	topics map[string][]*partitionLog
+	// produced 每次写入消息后关闭并替换，用于唤醒等待新消息的 fetch 请求
+	produced chan struct{}
+	conns    map[net.Conn]struct{}
+
+	groupMu sync.Mutex
+	groups  map[string]*group
+
+	closeOnce sync.Once
+	closed    chan struct{}
+	wg        sync.WaitGroup
+}
+
+type pendingTopic struct {
+	topic      string
+	partitions int
+}
+
+// partitionLog 分区中的消息，offset 从0开始连续递增
+type partitionLog struct {
+	records []record
+}
+
+func (p *partitionLog) highWatermark() int64 {
+	return int64(len(p.records))
+}
+
+type request struct {
+	apiKey        int16
+	apiVersion    int16
+	correlationID int32
+	clientID      string
+	body          *decoder
+}
+
+// NewBroker 创建并启动 Broker，监听 127.0.0.1 上的随机端口
+func NewBroker(options ...Option) (*Broker, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("ekafkatest: listen failed: %w", err)
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	b := &Broker{
+		listener: listener,
+		host:     addr.IP.String(),
+		port:     int32(addr.Port),
+		topics:   make(map[string][]*partitionLog),
+		produced: make(chan struct{}),
+		conns:    make(map[net.Conn]struct{}),
+		groups:   make(map[string]*group),
+		closed:   make(chan struct{}),
+	}
+	for _, option := range options {
+		option(b)
+	}
+	for _, t := range b.pending {
+		if err := b.createTopicLocked(t.topic, t.partitions); err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+	}
+	b.wg.Add(2)
+	go b.serve()
+	go b.expireMembers()
+	return b, nil
+}
+
+// Addr 返回 broker 地址，作为客户端的 brokers 配置
+func (b *Broker) Addr() string {
+	return net.JoinHostPort(b.host, strconv.Itoa(int(b.port)))
+}
+
+// Option 返回指向该 Broker 的 ekafka 配置项，在 Build 时传入即可
+func (b *Broker) Option() ekafka.Option {
+	return ekafka.WithBrokers(b.Addr())
+}
+
+// Close 关闭 Broker，断开所有连接
+func (b *Broker) Close() error {
+	var err error
+	b.closeOnce.Do(func() {
+		close(b.closed)
+		err = b.listener.Close()
+		b.mu.Lock()
+		for conn := range b.conns {
+			_ = conn.Close()
+		}
+		b.mu.Unlock()
+		b.wg.Wait()
+	})
+	return err
+}
+
+// CreateTopic 创建 topic，topic 已经存在时返回错误
+func (b *Broker) CreateTopic(topic string, partitions int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.createTopicLocked(topic, partitions)
+}
+
+func (b *Broker) createTopicLocked(topic string, partitions int) error {
+	if _, ok := b.topics[topic]; ok {
+		return fmt.Errorf("ekafkatest: topic %s already exists", topic)
+	}
+	if topic == "" || partitions <= 0 {
+		return fmt.Errorf("ekafkatest: invalid topic %q with %d partitions", topic, partitions)
+	}
+	logs := make([]*partitionLog, partitions)
+	for i := range logs {
+		logs[i] = &partitionLog{}
+	}
+	b.topics[topic] = logs
+	return nil
+}
+
+// Messages 返回分区中的所有消息
+func (b *Broker) Messages(topic string, partition int) ([]ekafka.Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	logs, ok := b.topics[topic]
+	if !ok || partition < 0 || partition >= len(logs) {
+		return nil, ErrTopicNotFound
+	}
+	msgs := make([]ekafka.Message, 0, len(logs[partition].records))
+	for _, r := range logs[partition].records {
+		headers := make([]kafka.Header, 0, len(r.headers))
+		for _, h := range r.headers {
+			headers = append(headers, kafka.Header{Key: h.Key, Value: h.Value})
+		}
+		msgs = append(msgs, ekafka.Message{
+			Topic:     topic,
+			Partition: partition,
+			Offset:    r.offset,
+			Key:       r.key,
+			Value:     r.value,
+			Headers:   headers,
+			Time:      r.time,
+		})
+	}
+	return msgs, nil
+}
+
+func (b *Broker) serve() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		select {
+		case <-b.closed:
+			b.mu.Unlock()
+			_ = conn.Close()
+			return
+		default:
+		}
+		b.conns[conn] = struct{}{}
+		b.mu.Unlock()
+
+		b.wg.Add(1)
+		go b.serveConn(conn)
+	}
+}
+
+// serveConn 按顺序处理一个连接上的请求，和 kafka 一样按请求顺序返回响应
+func (b *Broker) serveConn(conn net.Conn) {
+	defer b.wg.Done()
+	defer func() {
+		b.mu.Lock()
+		delete(b.conns, conn)
+		b.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	for {
+		req, err := readRequest(r)
+		if err != nil {
+			return
+		}
+		api, ok := lookupAPI(req.apiKey)
+		if !ok || req.apiVersion < api.min || req.apiVersion > api.max {
+			// kafka 收到不支持的请求时会直接断开连接
+			return
+		}
+		e := &encoder{}
+		e.int32(0) // size，写入前回填
+		e.int32(req.correlationID)
+		respond := b.handle(req, e)
+		if req.body.err != nil {
+			return
+		}
+		if !respond {
+			continue
+		}
+		binary.BigEndian.PutUint32(e.b, uint32(len(e.b)-4))
+		if _, err := conn.Write(e.b); err != nil {
+			return
+		}
+	}
+}
+
+func readRequest(r io.Reader) (*request, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, binary.BigEndian.Uint32(size[:]))
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	d := &decoder{b: buf}
+	req := &request{
+		apiKey:        d.int16(),
+		apiVersion:    d.int16(),
+		correlationID: d.int32(),
+		clientID:      d.string(),
+		body:          d,
+	}
+	return req, d.err
+}
+
+func lookupAPI(key int16) (apiVersion, bool) {
+	for _, api := range apiVersions {
+		if api.key == key {
+			return api, true
+		}
+	}
+	return apiVersion{}, false
+}
+
+// handle 处理请求，返回 false 时不需要响应
+func (b *Broker) handle(req *request, e *encoder) bool {
+	switch req.apiKey {
+	case 0:
+		return b.handleProduce(req, e)
+	case 1:
+		return b.handleFetch(req, e)
+	case 2:
+		return b.handleListOffsets(req, e)
+	case 3:
+		return b.handleMetadata(req, e)
+	case 8:
+		return b.handleOffsetCommit(req, e)
+	case 9:
+		return b.handleOffsetFetch(req, e)
+	case 10:
+		return b.handleFindCoordinator(req, e)
+	case 11:
+		return b.handleJoinGroup(req, e)
+	case 12:
+		return b.handleHeartbeat(req, e)
+	case 13:
+		return b.handleLeaveGroup(req, e)
+	case 14:
+		return b.handleSyncGroup(req, e)
+	case 18:
+		return b.handleApiVersions(req, e)
+	case 19:
+		return b.handleCreateTopics(req, e)
+	case 20:
+		return b.handleDeleteTopics(req, e)
+	}
+	return false
+}
+
+func (b *Broker) handleApiVersions(req *request, e *encoder) bool {
+	e.int16(errNone)
+	e.arrayLen(len(apiVersions))
+	for _, api := range apiVersions {
+		e.int16(api.key)
+		e.int16(api.min)
+		e.int16(api.max)
+	}
+	return true
+}
+
+func (b *Broker) handleMetadata(req *request, e *encoder) bool {
+	topics := req.body.stringArray()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if topics == nil {
+		for topic := range b.topics {
+			topics = append(topics, topic)
+		}
+		sort.Strings(topics)
+	}
+
+	e.arrayLen(1)
+	e.int32(nodeID)
+	e.string(b.host)
+	e.int32(b.port)
+	e.nullString() // rack
+	e.int32(nodeID)
+	e.arrayLen(len(topics))
+	for _, topic := range topics {
+		logs, ok := b.topics[topic]
+		if !ok {
+			e.int16(errUnknownTopicOrPartition)
+		} else {
+			e.int16(errNone)
+		}
+		e.string(topic)
+		e.bool(false) // internal
+		e.arrayLen(len(logs))
+		for partition := range logs {
+			e.int16(errNone)
+			e.int32(int32(partition))
+			e.int32(nodeID)
+			e.int32Array(nodeID)
+			e.int32Array(nodeID)
+		}
+	}
+	return true
+}
+
+func (b *Broker) handleCreateTopics(req *request, e *encoder) bool {
+	d := req.body
+	type result struct {
+		topic     string
+		errorCode int16
+	}
+	var results []result
+	for n, i := d.arrayLen(), 0; i < n && d.err == nil; i++ {
+		topic, partitions := d.string(), int(d.int32())
+		d.int16() // replicationFactor
+		for n, i := d.arrayLen(), 0; i < n && d.err == nil; i++ {
+			d.int32()
+			d.int32Array()
+		}
+		for n, i := d.arrayLen(), 0; i < n && d.err == nil; i++ {
+			d.string()
+			d.string()
+		}
+		if partitions < 0 {
+			partitions = 1
+		}
+
+		b.mu.Lock()
+		errorCode := errNone
+		if _, ok := b.topics[topic]; ok {
+			errorCode = errTopicAlreadyExists
+		} else if err := b.createTopicLocked(topic, partitions); err != nil {
+			errorCode = errInvalidPartitions
+		}
+		b.mu.Unlock()
+		results = append(results, result{topic: topic, errorCode: errorCode})
+	}
+	d.int32() // timeoutMs
+
+	e.arrayLen(len(results))
+	for _, r := range results {
+		e.string(r.topic)
+		e.int16(r.errorCode)
+	}
+	return true
+}
+
+func (b *Broker) handleDeleteTopics(req *request, e *encoder) bool {
+	topics := req.body.stringArray()
+	req.body.int32() // timeoutMs
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e.arrayLen(len(topics))
+	for _, topic := range topics {
+		e.string(topic)
+		if _, ok := b.topics[topic]; !ok {
+			e.int16(errUnknownTopicOrPartition)
+			continue
+		}
+		delete(b.topics, topic)
+		e.int16(errNone)
+	}
+	return true
+}
+
+// lookupLocked 返回分区，不存在时返回 nil
+func (b *Broker) lookupLocked(topic string, partition int32) *partitionLog {
+	logs := b.topics[topic]
+	if partition < 0 || int(partition) >= len(logs) {
+		return nil
+	}
+	return logs[partition]
+}
+
+func (b *Broker) handleProduce(req *request, e *encoder) bool {
+	d := req.body
+	d.string() // transactionalID
+	acks := d.int16()
+	d.int32() // timeout
+
+	type partitionResult struct {
+		partition  int32
+		errorCode  int16
+		baseOffset int64
+	}
+	type topicResult struct {
+		topic      string
+		partitions []partitionResult
+	}
+	var results []topicResult
+	for n, i := d.arrayLen(), 0; i < n && d.err == nil; i++ {
+		result := topicResult{topic: d.string()}
+		for n, i := d.arrayLen(), 0; i < n && d.err == nil; i++ {
+			partition := d.int32()
+			records, err := decodeRecords(d.rawBytes())
+			if d.err != nil {
+				return false
+			}
+			pr := partitionResult{partition: partition, baseOffset: -1}
+			b.mu.Lock()
+			log := b.lookupLocked(result.topic, partition)
+			switch {
+			case log == nil:
+				pr.errorCode = errUnknownTopicOrPartition
+			case err != nil:
+				pr.errorCode = errCorruptMessage
+			default:
+				pr.baseOffset = log.highWatermark()
+				for _, r := range records {
+					r.offset = log.highWatermark()
+					log.records = append(log.records, r)
+				}
+				close(b.produced)
+				b.produced = make(chan struct{})
+			}
+			b.mu.Unlock()
+			result.partitions = append(result.partitions, pr)
+		}
+		results = append(results, result)
+	}
+	if acks == 0 {
+		return false
+	}
+
+	e.arrayLen(len(results))
+	for _, result := range results {
+		e.string(result.topic)
+		e.arrayLen(len(result.partitions))
+		for _, pr := range result.partitions {
+			e.int32(pr.partition)
+			e.int16(pr.errorCode)
+			e.int64(pr.baseOffset)
+			e.int64(-1) // logAppendTime
+		}
+	}
+	e.int32(0) // throttleTimeMs
+	return true
+}
+
+type fetchPartition struct {
+	partition int32
+	offset    int64
+	maxBytes  int32
+}
+
+type fetchTopic struct {
+	topic      string
+	partitions []fetchPartition
+}
+
+// handleFetch 没有足够的新消息时最多等待 maxWaitTime
+func (b *Broker) handleFetch(req *request, e *encoder) bool {
+	d := req.body
+	d.int32() // replicaID
+	maxWait := time.Duration(d.int32()) * time.Millisecond
+	minBytes := int(d.int32())
+	maxBytes := int(d.int32())
+	d.int8() // isolationLevel
+	var topics []fetchTopic
+	for n, i := d.arrayLen(), 0; i < n && d.err == nil; i++ {
+		topic := fetchTopic{topic: d.string()}
+		for n, i := d.arrayLen(), 0; i < n && d.err == nil; i++ {
+			partition := fetchPartition{partition: d.int32(), offset: d.int64()}
+			d.int64() // logStartOffset
+			partition.maxBytes = d.int32()
+			topic.partitions = append(topic.partitions, partition)
+		}
+		topics = append(topics, topic)
+	}
+	if d.err != nil {
+		return false
+	}
+
+	timer := time.NewTimer(maxWait)
+	defer timer.Stop()
+	for {
+		b.mu.Lock()
+		body, size := b.fetchLocked(topics, maxBytes)
+		produced := b.produced
+		b.mu.Unlock()
+		if size >= minBytes {
+			e.b = append(e.b, body...)
+			return true
+		}
+		select {
+		case <-produced:
+		case <-timer.C:
+			e.b = append(e.b, body...)
+			return true
+		case <-b.closed:
+			return false
+		}
+	}
+}
+
+// fetchLocked 编码 fetch 响应，返回响应和其中消息的字节数，出错的分区也计入字节数，使请求立即返回
+func (b *Broker) fetchLocked(topics []fetchTopic, maxBytes int) ([]byte, int) {
+	e := &encoder{}
+	size := 0
+	e.int32(0) // throttleTimeMs
+	e.arrayLen(len(topics))
+	for _, topic := range topics {
+		e.string(topic.topic)
+		e.arrayLen(len(topic.partitions))
+		for _, p := range topic.partitions {
+			e.int32(p.partition)
+			log := b.lookupLocked(topic.topic, p.partition)
+			if log == nil || p.offset < 0 || p.offset > log.highWatermark() {
+				code := errOffsetOutOfRange
+				if log == nil {
+					code = errUnknownTopicOrPartition
+				}
+				e.int16(code)
+				e.int64(-1)
+				e.int64(-1)
+				e.int64(-1)
+				e.arrayLen(-1) // abortedTransactions
+				e.bytes(nil)
+				size += maxBytes + 1
+				continue
+			}
+			limit := int(p.maxBytes)
+			if maxBytes-size < limit {
+				limit = maxBytes - size
+			}
+			records, batchSize := log.records[p.offset:], 0
+			for i, r := range records {
+				// 至少返回一条消息，避免超过 maxBytes 的消息无法消费
+				if i > 0 && batchSize+r.size() > limit {
+					records = records[:i]
+					break
+				}
+				batchSize += r.size()
+			}
+			e.int16(errNone)
+			e.int64(log.highWatermark())
+			e.int64(log.highWatermark()) // lastStableOffset
+			e.int64(0)                   // logStartOffset
+			e.arrayLen(-1)               // abortedTransactions
+			e.bytes(encodeRecordBatch(records))
+			size += batchSize
+		}
+	}
+	return e.b, size
+}
+
+func (b *Broker) handleListOffsets(req *request, e *encoder) bool {
+	d := req.body
+	d.int32() // replicaID
+	n := d.arrayLen()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e.arrayLen(n)
+	for i := 0; i < n && d.err == nil; i++ {
+		topic := d.string()
+		e.string(topic)
+		m := d.arrayLen()
+		e.arrayLen(m)
+		for j := 0; j < m && d.err == nil; j++ {
+			partition, timestamp := d.int32(), d.int64()
+			e.int32(partition)
+			log := b.lookupLocked(topic, partition)
+			if log == nil {
+				e.int16(errUnknownTopicOrPartition)
+				e.int64(-1)
+				e.int64(-1)
+				continue
+			}
+			e.int16(errNone)
+			e.int64(-1)
+			e.int64(log.offsetForTime(timestamp))
+		}
+	}
+	return true
+}
+
+// offsetForTime timestamp 为 -1 时返回最新位点，为 -2 时返回最早位点，否则返回第一条时间不早于 timestamp 的消息位点
+func (p *partitionLog) offsetForTime(timestamp int64) int64 {
+	switch timestamp {
+	case kafka.LastOffset:
+		return p.highWatermark()
+	case kafka.FirstOffset:
+		return 0
+	}
+	t := time.Unix(0, timestamp*int64(time.Millisecond))
+	for _, r := range p.records {
+		if !r.time.Before(t) {
+			return r.offset
+		}
+	}
+	return -1
+}
+
+func (b *Broker) handleFindCoordinator(req *request, e *encoder) bool {
+	req.body.string() // groupID
+	e.int16(errNone)
+	e.int32(nodeID)
+	e.string(b.host)
+	e.int32(b.port)
+	return true
+}
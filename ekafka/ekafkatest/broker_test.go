@@ -0,0 +1,132 @@
+package ekafkatest
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotomicro/ego-component/ekafka"
+)
+
+func newComponent(t *testing.T, broker *Broker) *ekafka.Component {
+	conf := `
+[kafka]
+	[kafka.client]
+		timeout="3s"
+	[kafka.producers.p1]
+		topic="orders"
+		batchTimeout="10ms"
+		requiredAcks=1
+	[kafka.consumers.c1]
+		topic="orders"
+		groupID="billing"
+		maxWait="100ms"
+	[kafka.consumerGroups.cg1]
+		topic="orders"
+		groupID="audit"
+		heartbeatInterval="100ms"
+		sessionTimeout="6s"
+		rebalanceTimeout="1s"
+		maxWait="100ms"
+`
+	require.NoError(t, econf.LoadFromReader(strings.NewReader(conf), toml.Unmarshal))
+	return ekafka.Load("kafka").Build(broker.Option())
+}
+
+func TestProduceConsume(t *testing.T) {
+	broker, err := NewBroker(WithTopic("orders", 2))
+	require.NoError(t, err)
+	defer broker.Close()
+	cmp := newComponent(t, broker)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	producer := cmp.Producer("p1")
+	err = producer.WriteMessages(ctx,
+		&ekafka.Message{Key: []byte("order-1"), Value: []byte("created"), Headers: []ekafka.Header{{Key: "event-type", Value: []byte("create")}}},
+		&ekafka.Message{Key: []byte("order-2"), Value: []byte("paid")},
+	)
+	require.NoError(t, err)
+
+	var stored []ekafka.Message
+	for partition := 0; partition < 2; partition++ {
+		msgs, err := broker.Messages("orders", partition)
+		require.NoError(t, err)
+		stored = append(stored, msgs...)
+	}
+	assert.Len(t, stored, 2)
+
+	consumer := cmp.Consumer("c1")
+	defer consumer.Close()
+	received := map[string]ekafka.Message{}
+	for len(received) < 2 {
+		msg, _, err := consumer.FetchMessage(ctx)
+		require.NoError(t, err)
+		received[string(msg.Key)] = msg
+		require.NoError(t, consumer.CommitMessages(ctx, &msg))
+	}
+	assert.Equal(t, "created", string(received["order-1"].Value))
+	assert.Equal(t, []ekafka.Header{{Key: "event-type", Value: []byte("create")}}, received["order-1"].Headers)
+	assert.Equal(t, "paid", string(received["order-2"].Value))
+
+	msg := received["order-1"]
+	offset, ok := broker.CommittedOffset("billing", "orders", msg.Partition)
+	assert.True(t, ok)
+	assert.Equal(t, msg.Offset+1, offset)
+}
+
+func TestConsumerGroupRebalance(t *testing.T) {
+	broker, err := NewBroker()
+	require.NoError(t, err)
+	defer broker.Close()
+	require.NoError(t, broker.CreateTopic("orders", 3))
+	require.Error(t, broker.CreateTopic("orders", 3))
+	cmp := newComponent(t, broker)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	group := cmp.ConsumerGroup("cg1")
+	defer group.Close()
+
+	assigned := pollUntil[ekafka.AssignedPartitions](ctx, t, group)
+	assert.Len(t, assigned.Partitions, 3)
+	assert.Equal(t, broker.Generation("audit"), assigned.GenerationID)
+
+	require.NoError(t, cmp.Producer("p1").WriteMessages(ctx, &ekafka.Message{Value: []byte("created")}))
+	msg := pollUntil[ekafka.Message](ctx, t, group)
+	assert.Equal(t, "created", string(msg.Value))
+	require.NoError(t, group.CommitMessages(ctx, msg))
+
+	// 模拟 rebalance：分区先被回收，再以新的 generation 分配
+	broker.Rebalance("audit")
+	revoked := pollUntil[ekafka.RevokedPartitions](ctx, t, group)
+	assert.Equal(t, assigned.GenerationID, revoked.GenerationID)
+	reassigned := pollUntil[ekafka.AssignedPartitions](ctx, t, group)
+	assert.Greater(t, reassigned.GenerationID, assigned.GenerationID)
+	for _, p := range reassigned.Partitions {
+		if p.Partition == msg.Partition {
+			assert.Equal(t, msg.Offset+1, p.Offset)
+		}
+	}
+}
+
+// pollUntil 读取消费组事件，直到收到类型为 T 的事件
+func pollUntil[T any](ctx context.Context, t *testing.T, group *ekafka.ConsumerGroup) T {
+	t.Helper()
+	for {
+		event, err := group.Poll(ctx)
+		require.NoError(t, err)
+		if e, ok := event.(T); ok {
+			return e
+		}
+		if err, ok := event.(error); ok {
+			require.NoError(t, err)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package ekafkatest
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errShortRead = errors.New("ekafkatest: short read")
+
+// decoder 解析请求，只支持 broker 声明的非 flexible 版本
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errShortRead
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) int8() int8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return int8(b[0])
+}
+
+func (d *decoder) int16() int16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (d *decoder) int32() int32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (d *decoder) int64() int64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+// string 读取 string 或 nullable string，null 返回空字符串
+func (d *decoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+// bytes 读取 bytes，返回的切片不包含长度前缀
+func (d *decoder) bytes() []byte {
+	n := d.int32()
+	if n < 0 {
+		return nil
+	}
+	return d.next(int(n))
+}
+
+// rawBytes 读取 bytes，返回的切片包含长度前缀，用于 protocol.RecordSet.ReadFrom
+func (d *decoder) rawBytes() []byte {
+	if d.err != nil || len(d.b) < 4 {
+		d.err = errShortRead
+		return nil
+	}
+	n := int32(binary.BigEndian.Uint32(d.b))
+	if n < 0 {
+		n = 0
+	}
+	return d.next(4 + int(n))
+}
+
+// arrayLen 读取数组长度，null 数组返回 -1
+func (d *decoder) arrayLen() int {
+	n := int(d.int32())
+	if d.err == nil && n > len(d.b) {
+		// 每个元素至少 1 个字节，避免异常请求导致分配过大的内存
+		d.err = errShortRead
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) int32Array() []int32 {
+	n := d.arrayLen()
+	if n < 0 {
+		return nil
+	}
+	values := make([]int32, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		values = append(values, d.int32())
+	}
+	return values
+}
+
+func (d *decoder) stringArray() []string {
+	n := d.arrayLen()
+	if n < 0 {
+		return nil
+	}
+	values := make([]string, 0, n)
+	for i := 0; i < n && d.err == nil; i++ {
+		values = append(values, d.string())
+	}
+	return values
+}
+
+// encoder 编码响应
+type encoder struct {
+	b []byte
+}
+
+func (e *encoder) int8(v int8) {
+	e.b = append(e.b, byte(v))
+}
+
+func (e *encoder) bool(v bool) {
+	if v {
+		e.int8(1)
+		return
+	}
+	e.int8(0)
+}
+
+func (e *encoder) int16(v int16) {
+	e.b = append(e.b, byte(v>>8), byte(v))
+}
+
+func (e *encoder) int32(v int32) {
+	e.b = append(e.b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (e *encoder) int64(v int64) {
+	e.int32(int32(v >> 32))
+	e.int32(int32(v))
+}
+
+func (e *encoder) string(v string) {
+	e.int16(int16(len(v)))
+	e.b = append(e.b, v...)
+}
+
+func (e *encoder) nullString() {
+	e.int16(-1)
+}
+
+func (e *encoder) bytes(v []byte) {
+	if v == nil {
+		e.int32(-1)
+		return
+	}
+	e.int32(int32(len(v)))
+	e.b = append(e.b, v...)
+}
+
+func (e *encoder) arrayLen(n int) {
+	e.int32(int32(n))
+}
+
+func (e *encoder) int32Array(values ...int32) {
+	e.arrayLen(len(values))
+	for _, v := range values {
+		e.int32(v)
+	}
+}
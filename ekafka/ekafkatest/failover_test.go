@@ -0,0 +1,103 @@
+package ekafkatest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gotomicro/ego/core/econf"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotomicro/ego-component/ekafka"
+)
+
+func newFailoverProducer(t *testing.T, primary *Broker, secondary string) *ekafka.Producer {
+	conf := fmt.Sprintf(`
+[kafka]
+	[kafka.producers.p1]
+		topic="orders"
+		batchTimeout="10ms"
+		requiredAcks=1
+		maxAttempts=1
+	[kafka.producers.p1.failover]
+		brokers=["%s"]
+		after="1s"
+		bufferSize=2
+`, secondary)
+	require.NoError(t, econf.LoadFromReader(strings.NewReader(conf), toml.Unmarshal))
+	return ekafka.Load("kafka").Build(primary.Option()).Producer("p1")
+}
+
+func TestFailoverReplayToSecondary(t *testing.T) {
+	primary, err := NewBroker(WithTopic("orders", 1))
+	require.NoError(t, err)
+	defer primary.Close()
+	secondary, err := NewBroker(WithTopic("orders", 1))
+	require.NoError(t, err)
+	defer secondary.Close()
+	producer := newFailoverProducer(t, primary, secondary.Addr())
+	defer producer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	require.NoError(t, producer.WriteMessages(ctx, &ekafka.Message{Value: []byte("m0")}))
+	msgs, err := primary.Messages("orders", 0)
+	require.NoError(t, err)
+	assert.Len(t, msgs, 1)
+
+	// 主集群不可用，消息进入缓存，调用方可以区分
+	require.NoError(t, primary.Close())
+	err = producer.WriteMessages(ctx, &ekafka.Message{Value: []byte("m1")})
+	assert.ErrorIs(t, err, ekafka.ErrFailoverBuffered)
+	assert.ErrorIs(t, producer.WriteMessages(ctx, &ekafka.Message{Value: []byte("m2")}), ekafka.ErrFailoverBuffered)
+	assert.Equal(t, 2, producer.FailoverBuffered())
+	// 超过 bufferSize 的消息不会被缓存
+	assert.ErrorIs(t, producer.WriteMessages(ctx, &ekafka.Message{Value: []byte("m3")}), ekafka.ErrFailoverBufferFull)
+	assert.Equal(t, "primary", producer.ActiveCluster())
+
+	// 超过 after 后切换到备用集群，缓存的消息按顺序重放
+	for producer.ActiveCluster() != "secondary" || producer.FailoverBuffered() > 0 {
+		require.NoError(t, ctx.Err())
+		time.Sleep(50 * time.Millisecond)
+	}
+	require.NoError(t, producer.WriteMessages(ctx, &ekafka.Message{Value: []byte("m4")}))
+	msgs, err = secondary.Messages("orders", 0)
+	require.NoError(t, err)
+	values := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		values = append(values, string(msg.Value))
+	}
+	assert.Equal(t, []string{"m1", "m2", "m4"}, values)
+}
+
+func TestFailoverReplayKeepsMessages(t *testing.T) {
+	primary, err := NewBroker(WithTopic("orders", 1))
+	require.NoError(t, err)
+	secondary, err := NewBroker(WithTopic("orders", 1))
+	require.NoError(t, err)
+	addr := secondary.Addr()
+	// 两个集群都不可用
+	require.NoError(t, secondary.Close())
+	producer := newFailoverProducer(t, primary, addr)
+	require.NoError(t, primary.Close())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	assert.ErrorIs(t, producer.WriteMessages(ctx, &ekafka.Message{Value: []byte("m0")}), ekafka.ErrFailoverBuffered)
+
+	// 切换后重放到备用集群失败，消息保留在缓存中
+	for producer.ActiveCluster() != "secondary" {
+		require.NoError(t, ctx.Err())
+		time.Sleep(50 * time.Millisecond)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	assert.Equal(t, 1, producer.FailoverBuffered())
+
+	err = producer.Close()
+	assert.True(t, errors.Is(err, ekafka.ErrFailoverUnflushed), "%v", err)
+}
@@ -0,0 +1,527 @@
+package ekafkatest
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+type groupState int
+
+const (
+	// groupEmpty 没有成员
+	groupEmpty groupState = iota
+	// groupPreparingRebalance 等待所有成员重新 join
+	groupPreparingRebalance
+	// groupCompletingRebalance 等待 leader 通过 sync 下发分配结果
+	groupCompletingRebalance
+	// groupStable 分配完成
+	groupStable
+)
+
+const memberExpireInterval = 100 * time.Millisecond
+
+type group struct {
+	id         string
+	state      groupState
+	generation int32
+	protocol   string
+	leader     string
+	members    map[string]*member
+	nextMember int
+	// rebalances 每次开始 rebalance 时递增，用于识别过期的 rebalance 超时回调
+	rebalances int
+	offsets    map[string]map[int32]int64
+}
+
+type member struct {
+	id               string
+	protocolType     string
+	protocols        []memberProtocol
+	sessionTimeout   time.Duration
+	rebalanceTimeout time.Duration
+	lastHeartbeat    time.Time
+	assignment       []byte
+	// joining、syncing 非空时表示成员正在等待 join、sync 的结果
+	joining chan joinResult
+	syncing chan syncResult
+}
+
+type memberProtocol struct {
+	name     string
+	metadata []byte
+}
+
+type joinResult struct {
+	errorCode  int16
+	generation int32
+	protocol   string
+	leader     string
+	memberID   string
+	members    []memberProtocol // name 为 member id，只有 leader 会收到
+}
+
+type syncResult struct {
+	errorCode  int16
+	assignment []byte
+}
+
+// Rebalance 触发消费组重平衡，成员在下一次心跳时收到 REBALANCE_IN_PROGRESS 后重新 join
+func (b *Broker) Rebalance(groupID string) {
+	b.groupMu.Lock()
+	defer b.groupMu.Unlock()
+	if g, ok := b.groups[groupID]; ok && len(g.members) > 0 {
+		b.prepareRebalanceLocked(g)
+	}
+}
+
+// Generation 返回消费组当前的 generation，消费组不存在时返回 0
+func (b *Broker) Generation(groupID string) int32 {
+	b.groupMu.Lock()
+	defer b.groupMu.Unlock()
+	if g, ok := b.groups[groupID]; ok {
+		return g.generation
+	}
+	return 0
+}
+
+// CommittedOffset 返回消费组提交的位点
+func (b *Broker) CommittedOffset(groupID string, topic string, partition int) (int64, bool) {
+	b.groupMu.Lock()
+	defer b.groupMu.Unlock()
+	g, ok := b.groups[groupID]
+	if !ok {
+		return 0, false
+	}
+	offset, ok := g.offsets[topic][int32(partition)]
+	return offset, ok
+}
+
+func (b *Broker) groupLocked(groupID string) *group {
+	g, ok := b.groups[groupID]
+	if !ok {
+		g = &group{
+			id:      groupID,
+			members: make(map[string]*member),
+			offsets: make(map[string]map[int32]int64),
+		}
+		b.groups[groupID] = g
+	}
+	return g
+}
+
+// prepareRebalanceLocked 开始 rebalance，等待 sync 结果的成员收到 REBALANCE_IN_PROGRESS，
+// 所有成员重新 join 或超过 rebalanceTimeout 后完成 join
+func (b *Broker) prepareRebalanceLocked(g *group) {
+	if g.state == groupPreparingRebalance {
+		return
+	}
+	g.state = groupPreparingRebalance
+	g.rebalances++
+	var timeout time.Duration
+	for _, m := range g.members {
+		if m.syncing != nil {
+			m.syncing <- syncResult{errorCode: errRebalanceInProgress}
+			m.syncing = nil
+		}
+		if m.rebalanceTimeout > timeout {
+			timeout = m.rebalanceTimeout
+		}
+	}
+	rebalances := g.rebalances
+	time.AfterFunc(timeout, func() {
+		b.groupMu.Lock()
+		defer b.groupMu.Unlock()
+		if g.state == groupPreparingRebalance && g.rebalances == rebalances {
+			b.completeJoinLocked(g)
+		}
+	})
+}
+
+// completeJoinLocked 移除没有重新 join 的成员，进入新的 generation，leader 收到所有成员的元数据
+func (b *Broker) completeJoinLocked(g *group) {
+	for id, m := range g.members {
+		if m.joining == nil {
+			b.removeMemberLocked(g, id, false)
+		}
+	}
+	g.generation++
+	if len(g.members) == 0 {
+		g.state = groupEmpty
+		g.leader, g.protocol = "", ""
+		return
+	}
+
+	ids := make([]string, 0, len(g.members))
+	for id := range g.members {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	if _, ok := g.members[g.leader]; !ok {
+		g.leader = ids[0]
+	}
+	g.protocol = selectProtocol(g)
+	g.state = groupCompletingRebalance
+
+	var metadata []memberProtocol
+	for _, id := range ids {
+		metadata = append(metadata, memberProtocol{name: id, metadata: g.members[id].metadata(g.protocol)})
+	}
+	now := time.Now()
+	for _, id := range ids {
+		m := g.members[id]
+		result := joinResult{
+			generation: g.generation,
+			protocol:   g.protocol,
+			leader:     g.leader,
+			memberID:   id,
+		}
+		if g.protocol == "" {
+			result.errorCode = errInconsistentProtocol
+		} else if id == g.leader {
+			result.members = metadata
+		}
+		m.joining <- result
+		m.joining = nil
+		m.assignment = nil
+		m.lastHeartbeat = now
+	}
+	if g.protocol == "" {
+		for _, id := range ids {
+			delete(g.members, id)
+		}
+		g.state = groupEmpty
+	}
+}
+
+// selectProtocol 选择 leader 支持的协议中第一个所有成员都支持的协议
+func selectProtocol(g *group) string {
+	for _, candidate := range g.members[g.leader].protocols {
+		supported := true
+		for _, m := range g.members {
+			if m.metadata(candidate.name) == nil {
+				supported = false
+				break
+			}
+		}
+		if supported {
+			return candidate.name
+		}
+	}
+	return ""
+}
+
+func (m *member) metadata(protocol string) []byte {
+	for _, p := range m.protocols {
+		if p.name == protocol {
+			if p.metadata == nil {
+				return []byte{}
+			}
+			return p.metadata
+		}
+	}
+	return nil
+}
+
+// removeMemberLocked 移除成员，rebalance 为 true 时其他成员需要重新 join
+func (b *Broker) removeMemberLocked(g *group, id string, rebalance bool) {
+	delete(g.members, id)
+	if g.leader == id {
+		g.leader = ""
+	}
+	if !rebalance {
+		return
+	}
+	if len(g.members) == 0 {
+		g.state = groupEmpty
+		g.rebalances++
+		return
+	}
+	if g.state != groupPreparingRebalance {
+		b.prepareRebalanceLocked(g)
+		return
+	}
+	b.tryCompleteJoinLocked(g)
+}
+
+func (b *Broker) tryCompleteJoinLocked(g *group) {
+	for _, m := range g.members {
+		if m.joining == nil {
+			return
+		}
+	}
+	b.completeJoinLocked(g)
+}
+
+// expireMembers 移除超过 sessionTimeout 没有心跳的成员
+func (b *Broker) expireMembers() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(memberExpireInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.closed:
+			return
+		case now := <-ticker.C:
+			b.groupMu.Lock()
+			for _, g := range b.groups {
+				for id, m := range g.members {
+					if m.joining == nil && now.Sub(m.lastHeartbeat) > m.sessionTimeout {
+						b.removeMemberLocked(g, id, true)
+					}
+				}
+			}
+			b.groupMu.Unlock()
+		}
+	}
+}
+
+func (b *Broker) handleJoinGroup(req *request, e *encoder) bool {
+	d := req.body
+	groupID := d.string()
+	sessionTimeout := time.Duration(d.int32()) * time.Millisecond
+	rebalanceTimeout := time.Duration(d.int32()) * time.Millisecond
+	memberID := d.string()
+	protocolType := d.string()
+	var protocols []memberProtocol
+	for n, i := d.arrayLen(), 0; i < n && d.err == nil; i++ {
+		protocols = append(protocols, memberProtocol{name: d.string(), metadata: d.bytes()})
+	}
+	if d.err != nil {
+		return false
+	}
+
+	result := b.join(req.clientID, groupID, memberID, protocolType, protocols, sessionTimeout, rebalanceTimeout)
+	e.int16(result.errorCode)
+	e.int32(result.generation)
+	e.string(result.protocol)
+	e.string(result.leader)
+	e.string(result.memberID)
+	e.arrayLen(len(result.members))
+	for _, m := range result.members {
+		e.string(m.name)
+		e.bytes(m.metadata)
+	}
+	return true
+}
+
+func (b *Broker) join(clientID, groupID, memberID, protocolType string, protocols []memberProtocol, sessionTimeout, rebalanceTimeout time.Duration) joinResult {
+	b.groupMu.Lock()
+	g := b.groupLocked(groupID)
+	m, ok := g.members[memberID]
+	switch {
+	case memberID != "" && !ok:
+		b.groupMu.Unlock()
+		return joinResult{errorCode: errUnknownMemberID, memberID: memberID}
+	case len(protocols) == 0 || (len(g.members) > 0 && !ok && g.protocolType() != protocolType):
+		b.groupMu.Unlock()
+		return joinResult{errorCode: errInconsistentProtocol, memberID: memberID}
+	case !ok:
+		g.nextMember++
+		m = &member{id: clientID + "-" + strconv.Itoa(g.nextMember)}
+		g.members[m.id] = m
+	}
+	m.protocolType = protocolType
+	m.protocols = protocols
+	m.sessionTimeout = sessionTimeout
+	m.rebalanceTimeout = rebalanceTimeout
+	m.lastHeartbeat = time.Now()
+	if m.joining != nil {
+		m.joining <- joinResult{errorCode: errUnknownMemberID, memberID: m.id}
+	}
+	joining := make(chan joinResult, 1)
+	m.joining = joining
+
+	b.prepareRebalanceLocked(g)
+	b.tryCompleteJoinLocked(g)
+	b.groupMu.Unlock()
+
+	select {
+	case result := <-joining:
+		return result
+	case <-b.closed:
+		return joinResult{errorCode: errCoordinatorNotAvailable, memberID: m.id}
+	}
+}
+
+func (g *group) protocolType() string {
+	for _, m := range g.members {
+		return m.protocolType
+	}
+	return ""
+}
+
+func (b *Broker) handleSyncGroup(req *request, e *encoder) bool {
+	d := req.body
+	groupID := d.string()
+	generation := d.int32()
+	memberID := d.string()
+	assignments := make(map[string][]byte)
+	for n, i := d.arrayLen(), 0; i < n && d.err == nil; i++ {
+		assignments[d.string()] = d.bytes()
+	}
+	if d.err != nil {
+		return false
+	}
+
+	result := b.sync(groupID, generation, memberID, assignments)
+	e.int16(result.errorCode)
+	e.bytes(result.assignment)
+	return true
+}
+
+func (b *Broker) sync(groupID string, generation int32, memberID string, assignments map[string][]byte) syncResult {
+	b.groupMu.Lock()
+	g := b.groupLocked(groupID)
+	m, ok := g.members[memberID]
+	switch {
+	case !ok:
+		b.groupMu.Unlock()
+		return syncResult{errorCode: errUnknownMemberID}
+	case generation != g.generation:
+		b.groupMu.Unlock()
+		return syncResult{errorCode: errIllegalGeneration}
+	case g.state == groupPreparingRebalance:
+		b.groupMu.Unlock()
+		return syncResult{errorCode: errRebalanceInProgress}
+	case g.state == groupStable:
+		b.groupMu.Unlock()
+		return syncResult{assignment: m.assignment}
+	}
+
+	syncing := make(chan syncResult, 1)
+	m.syncing = syncing
+	if memberID == g.leader {
+		for id, assignment := range assignments {
+			if member, ok := g.members[id]; ok {
+				member.assignment = assignment
+			}
+		}
+		g.state = groupStable
+		for _, member := range g.members {
+			if member.syncing != nil {
+				member.syncing <- syncResult{assignment: member.assignment}
+				member.syncing = nil
+			}
+		}
+	}
+	b.groupMu.Unlock()
+
+	select {
+	case result := <-syncing:
+		return result
+	case <-b.closed:
+		return syncResult{errorCode: errCoordinatorNotAvailable}
+	}
+}
+
+func (b *Broker) handleHeartbeat(req *request, e *encoder) bool {
+	d := req.body
+	groupID, generation, memberID := d.string(), d.int32(), d.string()
+
+	b.groupMu.Lock()
+	defer b.groupMu.Unlock()
+	g := b.groupLocked(groupID)
+	m, ok := g.members[memberID]
+	switch {
+	case !ok:
+		e.int16(errUnknownMemberID)
+	case generation != g.generation:
+		e.int16(errIllegalGeneration)
+	case g.state == groupPreparingRebalance:
+		e.int16(errRebalanceInProgress)
+	default:
+		m.lastHeartbeat = time.Now()
+		e.int16(errNone)
+	}
+	return true
+}
+
+func (b *Broker) handleLeaveGroup(req *request, e *encoder) bool {
+	d := req.body
+	groupID, memberID := d.string(), d.string()
+
+	b.groupMu.Lock()
+	defer b.groupMu.Unlock()
+	g := b.groupLocked(groupID)
+	if _, ok := g.members[memberID]; !ok {
+		e.int16(errUnknownMemberID)
+		return true
+	}
+	b.removeMemberLocked(g, memberID, true)
+	e.int16(errNone)
+	return true
+}
+
+func (b *Broker) handleOffsetCommit(req *request, e *encoder) bool {
+	d := req.body
+	groupID := d.string()
+	generation := d.int32()
+	memberID := d.string()
+	d.int64() // retentionTime
+
+	b.groupMu.Lock()
+	defer b.groupMu.Unlock()
+	g := b.groupLocked(groupID)
+	errorCode := errNone
+	// generation 为 -1 且 memberID 为空时为不使用消费组协议的提交
+	if generation != -1 || memberID != "" {
+		if _, ok := g.members[memberID]; !ok {
+			errorCode = errUnknownMemberID
+		} else if generation != g.generation {
+			errorCode = errIllegalGeneration
+		} else if g.state == groupPreparingRebalance {
+			errorCode = errRebalanceInProgress
+		}
+	}
+
+	n := d.arrayLen()
+	e.arrayLen(n)
+	for i := 0; i < n && d.err == nil; i++ {
+		topic := d.string()
+		e.string(topic)
+		m := d.arrayLen()
+		e.arrayLen(m)
+		for j := 0; j < m && d.err == nil; j++ {
+			partition, offset := d.int32(), d.int64()
+			d.string() // metadata
+			if errorCode == errNone {
+				if g.offsets[topic] == nil {
+					g.offsets[topic] = make(map[int32]int64)
+				}
+				g.offsets[topic][partition] = offset
+			}
+			e.int32(partition)
+			e.int16(errorCode)
+		}
+	}
+	return true
+}
+
+func (b *Broker) handleOffsetFetch(req *request, e *encoder) bool {
+	d := req.body
+	groupID := d.string()
+
+	b.groupMu.Lock()
+	defer b.groupMu.Unlock()
+	g := b.groupLocked(groupID)
+	n := d.arrayLen()
+	e.arrayLen(n)
+	for i := 0; i < n && d.err == nil; i++ {
+		topic := d.string()
+		e.string(topic)
+		partitions := d.int32Array()
+		e.arrayLen(len(partitions))
+		for _, partition := range partitions {
+			offset, ok := g.offsets[topic][partition]
+			if !ok {
+				offset = -1
+			}
+			e.int32(partition)
+			e.int64(offset)
+			e.string("") // metadata
+			e.int16(errNone)
+		}
+	}
+	return true
+}
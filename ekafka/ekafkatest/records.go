@@ -0,0 +1,135 @@
+package ekafkatest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"time"
+
+	"github.com/segmentio/kafka-go/protocol"
+)
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+// record 分区中保存的一条消息
+type record struct {
+	offset  int64
+	time    time.Time
+	key     []byte
+	value   []byte
+	headers []protocol.Header
+}
+
+// size 消息编码后的大致字节数，用于 fetch 的 maxBytes 限制
+func (r record) size() int {
+	n := 32 + len(r.key) + len(r.value)
+	for _, h := range r.headers {
+		n += 8 + len(h.Key) + len(h.Value)
+	}
+	return n
+}
+
+// decodeRecords 解析 produce 请求中的 record set，支持 v0、v1、v2 格式和所有压缩算法
+func decodeRecords(raw []byte) ([]record, error) {
+	var rs protocol.RecordSet
+	if _, err := rs.ReadFrom(bytes.NewBuffer(raw)); err != nil {
+		return nil, err
+	}
+	if rs.Records == nil {
+		return nil, nil
+	}
+	now := time.Now()
+	var records []record
+	for {
+		r, err := rs.Records.ReadRecord()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		key, err := protocol.ReadAll(r.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := protocol.ReadAll(r.Value)
+		if err != nil {
+			return nil, err
+		}
+		t := r.Time
+		if t.IsZero() || t.UnixNano() <= 0 {
+			t = now
+		}
+		records = append(records, record{
+			time:    t,
+			key:     key,
+			value:   value,
+			headers: append([]protocol.Header(nil), r.Headers...),
+		})
+	}
+}
+
+// encodeRecordBatch 将连续的消息编码为一个不压缩的 v2 record batch
+func encodeRecordBatch(records []record) []byte {
+	if len(records) == 0 {
+		return nil
+	}
+	firstTimestamp := records[0].time.UnixNano() / int64(time.Millisecond)
+	maxTimestamp := firstTimestamp
+
+	var body []byte
+	for i, r := range records {
+		timestamp := r.time.UnixNano() / int64(time.Millisecond)
+		if timestamp > maxTimestamp {
+			maxTimestamp = timestamp
+		}
+		var rec []byte
+		rec = append(rec, 0) // attributes
+		rec = appendVarint(rec, timestamp-firstTimestamp)
+		rec = appendVarint(rec, int64(i))
+		rec = appendVarBytes(rec, r.key)
+		rec = appendVarBytes(rec, r.value)
+		rec = appendVarint(rec, int64(len(r.headers)))
+		for _, h := range r.headers {
+			rec = appendVarBytes(rec, []byte(h.Key))
+			rec = appendVarBytes(rec, h.Value)
+		}
+		body = appendVarint(body, int64(len(rec)))
+		body = append(body, rec...)
+	}
+
+	// crc 覆盖 attributes 到结尾的所有字段
+	var tail encoder
+	tail.int16(0) // attributes
+	tail.int32(int32(len(records) - 1))
+	tail.int64(firstTimestamp)
+	tail.int64(maxTimestamp)
+	tail.int64(-1) // producerId
+	tail.int16(-1) // producerEpoch
+	tail.int32(-1) // baseSequence
+	tail.arrayLen(len(records))
+	tail.b = append(tail.b, body...)
+
+	var batch encoder
+	batch.int64(records[0].offset)
+	batch.int32(int32(4 + 1 + 4 + len(tail.b))) // partitionLeaderEpoch + magic + crc + tail
+	batch.int32(0)                              // partitionLeaderEpoch
+	batch.int8(2)                               // magic
+	batch.int32(int32(crc32.Checksum(tail.b, crc32c)))
+	batch.b = append(batch.b, tail.b...)
+	return batch.b
+}
+
+func appendVarBytes(b []byte, v []byte) []byte {
+	if v == nil {
+		return appendVarint(b, -1)
+	}
+	b = appendVarint(b, int64(len(v)))
+	return append(b, v...)
+}
+
+func appendVarint(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutVarint(buf[:], v)]...)
+}
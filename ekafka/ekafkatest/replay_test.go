@@ -0,0 +1,61 @@
+package ekafkatest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gotomicro/ego-component/ekafka"
+)
+
+func TestReplay(t *testing.T) {
+	broker, err := NewBroker(WithTopic("orders", 1))
+	require.NoError(t, err)
+	defer broker.Close()
+	cmp := newComponent(t, broker)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// 生产时消息时间为写入时间，每条消息之间间隔一段时间，记录间隔的时间点
+	var marks []time.Time
+	for _, value := range []string{"m0", "m1", "m2"} {
+		marks = append(marks, time.Now())
+		time.Sleep(20 * time.Millisecond)
+		require.NoError(t, cmp.Producer("p1").WriteMessages(ctx, &ekafka.Message{Value: []byte(value)}))
+		time.Sleep(20 * time.Millisecond)
+	}
+	marks = append(marks, time.Now())
+
+	replay := func(from, to time.Time) []string {
+		values := make([]string, 0)
+		err := cmp.Replay(ctx, "orders", from, to, func(ctx context.Context, msg ekafka.Message) error {
+			values = append(values, string(msg.Value))
+			return nil
+		})
+		require.NoError(t, err)
+		return values
+	}
+	assert.Equal(t, []string{"m0", "m1", "m2"}, replay(marks[0], marks[3]))
+	assert.Equal(t, []string{"m1"}, replay(marks[1], marks[2]))
+	assert.Equal(t, []string{"m1", "m2"}, replay(marks[1], time.Now()))
+	// from 之后没有消息
+	assert.Empty(t, replay(time.Now().Add(time.Minute), time.Now().Add(2*time.Minute)))
+
+	// handler 返回错误时回放终止
+	handlerErr := errors.New("handler failed")
+	calls := 0
+	err = cmp.Replay(ctx, "orders", marks[0], time.Now(), func(ctx context.Context, msg ekafka.Message) error {
+		calls++
+		return handlerErr
+	})
+	assert.ErrorIs(t, err, handlerErr)
+	assert.Equal(t, 1, calls)
+
+	// 回放不会提交消费组的 offset
+	_, ok := broker.CommittedOffset("billing", "orders", 0)
+	assert.False(t, ok)
+}
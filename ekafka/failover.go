@@ -0,0 +1,246 @@
+package ekafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/segmentio/kafka-go"
+)
+
+var (
+	// ErrFailoverBufferFull 主集群不可用期间缓存的消息超过了 failover.bufferSize，消息没有被写入也没有被缓存
+	ErrFailoverBufferFull = errors.New("ekafka: failover buffer is full")
+	// ErrFailoverBuffered 主集群不可用，消息只缓存在内存中，尚未被 kafka 确认，会在后台重放，调用方不需要重试
+	// 进程退出前没有重放成功的消息会丢失
+	ErrFailoverBuffered = errors.New("ekafka: messages buffered for failover replay")
+	// ErrFailoverUnflushed 关闭时仍有缓存的消息没有重放成功，这些消息已经丢失
+	ErrFailoverUnflushed = errors.New("ekafka: buffered messages not flushed")
+)
+
+const (
+	defaultFailoverAfter      = 30 * time.Second
+	defaultFailoverBufferSize = 10000
+	failoverReplayInterval    = time.Second
+	failoverReplayTimeout     = 10 * time.Second
+)
+
+// failoverWriter 主集群持续不可用超过 after 后切换到备用集群
+// 主集群写入失败后，消息先进入缓存并由后台按顺序重放：仍在 after 内时重放到主集群，超过 after 后切换并重放到备用集群
+// 切换后不会自动切回主集群，需要重启服务
+type failoverWriter struct {
+	primary    *kafka.Writer
+	secondary  *kafka.Writer
+	after      time.Duration
+	bufferSize int
+	logger     *elog.Component
+
+	mu sync.Mutex
+	// failingSince 主集群开始不可用的时间，非零时新消息直接进入缓存，保证与缓存中的消息有序
+	failingSince time.Time
+	failedOver   bool
+	buffer       []Message
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newFailoverWriter(primary, secondary *kafka.Writer, config failoverConfig, logger *elog.Component) *failoverWriter {
+	if config.After <= 0 {
+		config.After = defaultFailoverAfter
+	}
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaultFailoverBufferSize
+	}
+	f := &failoverWriter{
+		primary:    primary,
+		secondary:  secondary,
+		after:      config.After,
+		bufferSize: config.BufferSize,
+		logger:     logger,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	go f.run()
+	return f
+}
+
+// WriteMessages 写入当前可用的集群，主集群不可用时消息进入缓存并返回 ErrFailoverBuffered，缓存满时返回 ErrFailoverBufferFull
+func (f *failoverWriter) WriteMessages(ctx context.Context, msgs ...Message) error {
+	f.mu.Lock()
+	if f.failedOver {
+		f.mu.Unlock()
+		return f.secondary.WriteMessages(ctx, msgs...)
+	}
+	if !f.failingSince.IsZero() {
+		defer f.mu.Unlock()
+		return f.enqueueLocked(msgs, nil)
+	}
+	f.mu.Unlock()
+
+	err := f.primary.WriteMessages(ctx, msgs...)
+	if err == nil || ctx.Err() != nil || !isClusterUnavailable(err) {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failingSince.IsZero() {
+		f.failingSince = time.Now()
+		f.logger.Warn("primary cluster unavailable, buffering messages", elog.FieldErr(err))
+	}
+	return f.enqueueLocked(failedMessages(msgs, err), err)
+}
+
+func (f *failoverWriter) enqueueLocked(msgs []Message, cause error) error {
+	if len(f.buffer)+len(msgs) > f.bufferSize {
+		if cause != nil {
+			return fmt.Errorf("%w: %v", ErrFailoverBufferFull, cause)
+		}
+		return ErrFailoverBufferFull
+	}
+	f.buffer = append(f.buffer, msgs...)
+	if cause != nil {
+		return fmt.Errorf("%w: %v", ErrFailoverBuffered, cause)
+	}
+	return ErrFailoverBuffered
+}
+
+// Buffered 返回缓存中等待重放的消息数量
+func (f *failoverWriter) Buffered() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.buffer)
+}
+
+func (f *failoverWriter) run() {
+	defer close(f.done)
+	ticker := time.NewTicker(failoverReplayInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.stop:
+			return
+		case <-ticker.C:
+			f.replay()
+		}
+	}
+}
+
+// replay 重放缓存的消息，主集群不可用超过 after 时切换到备用集群
+// 重放失败的消息放回缓存头部，等待下一次重放，不会被丢弃
+func (f *failoverWriter) replay() {
+	f.mu.Lock()
+	if f.failingSince.IsZero() && !f.failedOver {
+		f.mu.Unlock()
+		return
+	}
+	if !f.failedOver && time.Since(f.failingSince) >= f.after {
+		f.failedOver = true
+		f.logger.Error("primary cluster unavailable, failing over to secondary cluster", elog.Duration("after", f.after), elog.Int("buffered", len(f.buffer)))
+	}
+	msgs, target, failedOver := f.buffer, f.primary, f.failedOver
+	f.buffer = nil
+	if failedOver {
+		target = f.secondary
+	}
+	f.mu.Unlock()
+
+	if len(msgs) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), failoverReplayTimeout)
+		err := target.WriteMessages(ctx, msgs...)
+		cancel()
+		if err != nil {
+			failed := failedMessages(msgs, err)
+			f.logger.Error("replay buffered messages failed", elog.FieldErr(err), elog.Int("count", len(failed)), elog.Any("clusterUnavailable", isClusterUnavailable(err)))
+			f.mu.Lock()
+			f.buffer = append(failed, f.buffer...)
+			f.mu.Unlock()
+			return
+		}
+	}
+
+	if !failedOver {
+		f.mu.Lock()
+		// 重放期间写入的消息留在缓存中，等待下一次重放后再恢复直接写主集群
+		if len(f.buffer) == 0 {
+			f.failingSince = time.Time{}
+			f.logger.Info("primary cluster recovered")
+		}
+		f.mu.Unlock()
+	}
+}
+
+// Close 停止后台重放，尽力写出缓存中的消息后关闭备用集群的 writer，主集群的 writer 由 Producer 关闭
+// 仍有消息没有写出时返回 ErrFailoverUnflushed
+func (f *failoverWriter) Close() error {
+	close(f.stop)
+	<-f.done
+	f.replay()
+	f.mu.Lock()
+	unflushed := len(f.buffer)
+	f.mu.Unlock()
+	if err := f.secondary.Close(); err != nil {
+		return err
+	}
+	if unflushed > 0 {
+		f.logger.Error("buffered messages dropped on close", elog.Int("count", unflushed))
+		return fmt.Errorf("%w, count: %d", ErrFailoverUnflushed, unflushed)
+	}
+	return nil
+}
+
+// ActiveCluster 返回当前写入的集群，primary 或 secondary
+func (f *failoverWriter) ActiveCluster() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failedOver {
+		return "secondary"
+	}
+	return "primary"
+}
+
+// isClusterUnavailable 网络错误和可重试的 kafka 错误视为集群不可用
+// 消息本身的错误（如消息过大）以及无法识别的错误不会触发缓存和切换，直接返回给调用方
+func isClusterUnavailable(err error) bool {
+	var writeErrors kafka.WriteErrors
+	if errors.As(err, &writeErrors) {
+		for _, e := range writeErrors {
+			if e != nil && !isClusterUnavailable(e) {
+				return false
+			}
+		}
+		return true
+	}
+	var kafkaError kafka.Error
+	if errors.As(err, &kafkaError) {
+		return kafkaError.Temporary()
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// failedMessages 返回写入失败的消息，部分失败时只返回失败的消息
+func failedMessages(msgs []Message, err error) []Message {
+	var writeErrors kafka.WriteErrors
+	if !errors.As(err, &writeErrors) || len(writeErrors) != len(msgs) {
+		return msgs
+	}
+	failed := make([]Message, 0, writeErrors.Count())
+	for i, e := range writeErrors {
+		if e != nil {
+			failed = append(failed, msgs[i])
+		}
+	}
+	return failed
+}
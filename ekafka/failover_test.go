@@ -0,0 +1,35 @@
+package ekafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsClusterUnavailable(t *testing.T) {
+	assert.True(t, isClusterUnavailable(io.ErrUnexpectedEOF))
+	assert.True(t, isClusterUnavailable(kafka.LeaderNotAvailable))
+	assert.False(t, isClusterUnavailable(kafka.MessageSizeTooLarge))
+	assert.True(t, isClusterUnavailable(kafka.WriteErrors{nil, kafka.NotEnoughReplicas}))
+	assert.False(t, isClusterUnavailable(kafka.WriteErrors{kafka.NotEnoughReplicas, kafka.MessageSizeTooLarge}))
+	assert.True(t, isClusterUnavailable(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}))
+	assert.True(t, isClusterUnavailable(fmt.Errorf("write: %w", syscall.ECONNRESET)))
+	// 无法识别的错误不视为集群不可用
+	assert.False(t, isClusterUnavailable(errors.New("unknown")))
+	assert.False(t, isClusterUnavailable(context.Canceled))
+}
+
+func TestFailedMessages(t *testing.T) {
+	msgs := []Message{{Offset: 0}, {Offset: 1}, {Offset: 2}}
+	assert.Equal(t, msgs, failedMessages(msgs, errors.New("dial failed")))
+
+	failed := failedMessages(msgs, kafka.WriteErrors{nil, kafka.NotEnoughReplicas, nil})
+	assert.Equal(t, []Message{{Offset: 1}}, failed)
+}
@@ -0,0 +1,29 @@
+package ekafka
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// fetchProbe 记录最近一次成功拉取消息的时间和拉取时的 lag，用于健康检查
+type fetchProbe struct {
+	at  int64
+	lag int64
+}
+
+func (p *fetchProbe) observe(msg Message) {
+	lag := msg.HighWaterMark - msg.Offset - 1
+	if lag < 0 {
+		lag = 0
+	}
+	atomic.StoreInt64(&p.lag, lag)
+	atomic.StoreInt64(&p.at, time.Now().UnixNano())
+}
+
+func (p *fetchProbe) last() (at time.Time, lag int64) {
+	nanos := atomic.LoadInt64(&p.at)
+	if nanos == 0 {
+		return time.Time{}, 0
+	}
+	return time.Unix(0, nanos), atomic.LoadInt64(&p.lag)
+}
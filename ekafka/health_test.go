@@ -0,0 +1,29 @@
+package ekafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchProbe(t *testing.T) {
+	var probe fetchProbe
+	at, lag := probe.last()
+	assert.True(t, at.IsZero())
+	assert.Equal(t, int64(0), lag)
+
+	before := time.Now()
+	probe.observe(Message{Offset: 5, HighWaterMark: 10})
+	at, lag = probe.last()
+	assert.False(t, at.Before(before))
+	assert.Equal(t, int64(4), lag)
+
+	// 已经消费到最新位置
+	probe.observe(Message{Offset: 9, HighWaterMark: 10})
+	_, lag = probe.last()
+	assert.Equal(t, int64(0), lag)
+	probe.observe(Message{Offset: 9})
+	_, lag = probe.last()
+	assert.Equal(t, int64(0), lag)
+}
@@ -0,0 +1,190 @@
+package ekafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// HeaderIdempotencyKey 生产者可以通过该 header 指定消息的幂等指纹
+const HeaderIdempotencyKey = "ekafka-idempotency-key"
+
+// ErrDedupInProgress 相同指纹的消息正在被其他消费者处理，消息不能被提交，需要稍后重试
+var ErrDedupInProgress = errors.New("ekafka: message with the same fingerprint is being processed")
+
+// DedupStatus 占用指纹的结果
+type DedupStatus int
+
+const (
+	// DedupAcquired 占用成功，可以处理消息
+	DedupAcquired DedupStatus = iota + 1
+	// DedupDone 消息已经处理完成
+	DedupDone
+	// DedupProcessing 消息正在被处理
+	DedupProcessing
+)
+
+const (
+	defaultDedupTTL       = 24 * time.Hour
+	defaultDedupLockTTL   = time.Minute
+	defaultDedupKeyPrefix = "ekafka:dedup:"
+	dedupValueProcessing  = "processing"
+	dedupValueDone        = "done"
+)
+
+// DedupStore 幂等消费使用的去重存储
+type DedupStore interface {
+	// Acquire 占用指纹，指纹已存在时返回 DedupDone 或 DedupProcessing
+	Acquire(ctx context.Context, key string, ttl time.Duration) (DedupStatus, error)
+	// Commit 标记消息已处理完成，ttl 内重复投递的消息都会被跳过
+	Commit(ctx context.Context, key string, ttl time.Duration) error
+	// Release 处理失败时释放指纹，使消息可以被重新处理
+	Release(ctx context.Context, key string) error
+}
+
+// RedisClient RedisDedupStore 依赖的 redis 命令，*eredis.Component 实现了该接口
+type RedisClient interface {
+	SetNx(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error)
+	Get(ctx context.Context, key string) (string, error)
+	Set(ctx context.Context, key string, value interface{}, expire time.Duration) error
+	Del(ctx context.Context, key string) (int64, error)
+}
+
+// RedisDedupStore 基于 redis 的去重存储
+type RedisDedupStore struct {
+	client RedisClient
+}
+
+// NewRedisDedupStore 创建基于 redis 的去重存储，通常传入 eredis 组件
+func NewRedisDedupStore(client RedisClient) *RedisDedupStore {
+	return &RedisDedupStore{client: client}
+}
+
+// Acquire 使用 SETNX 占用指纹，失败时读取指纹的状态
+// 读取失败（如指纹恰好过期）时视为正在处理，消息会被重试
+func (s *RedisDedupStore) Acquire(ctx context.Context, key string, ttl time.Duration) (DedupStatus, error) {
+	ok, err := s.client.SetNx(ctx, key, dedupValueProcessing, ttl)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		return DedupAcquired, nil
+	}
+	if value, err := s.client.Get(ctx, key); err == nil && value == dedupValueDone {
+		return DedupDone, nil
+	}
+	return DedupProcessing, nil
+}
+
+// Commit 将指纹标记为已处理
+func (s *RedisDedupStore) Commit(ctx context.Context, key string, ttl time.Duration) error {
+	return s.client.Set(ctx, key, dedupValueDone, ttl)
+}
+
+// Release 删除指纹
+func (s *RedisDedupStore) Release(ctx context.Context, key string) error {
+	_, err := s.client.Del(ctx, key)
+	return err
+}
+
+// FingerprintFunc 计算消息的幂等指纹，返回空字符串时不做去重
+type FingerprintFunc func(msg Message) string
+
+// Idempotent 幂等消费，保证 at-least-once 投递下相同指纹的消息在 TTL 内只被成功处理一次
+type Idempotent struct {
+	store       DedupStore
+	ttl         time.Duration
+	lockTTL     time.Duration
+	keyPrefix   string
+	fingerprint FingerprintFunc
+}
+
+// IdempotentOption 幂等消费选项
+type IdempotentOption func(i *Idempotent)
+
+// WithDedupTTL 设置已处理指纹的保留时间，默认24小时
+func WithDedupTTL(ttl time.Duration) IdempotentOption {
+	return func(i *Idempotent) {
+		i.ttl = ttl
+	}
+}
+
+// WithDedupLockTTL 设置处理中指纹的保留时间，默认1分钟
+// 处理过程中进程崩溃时，指纹会在该时间后过期，重新投递的消息可以被再次处理
+func WithDedupLockTTL(ttl time.Duration) IdempotentOption {
+	return func(i *Idempotent) {
+		i.lockTTL = ttl
+	}
+}
+
+// WithDedupKeyPrefix 设置去重存储中 key 的前缀，默认为 "ekafka:dedup:"
+func WithDedupKeyPrefix(prefix string) IdempotentOption {
+	return func(i *Idempotent) {
+		i.keyPrefix = prefix
+	}
+}
+
+// WithFingerprint 自定义消息指纹，默认使用 DefaultFingerprint
+func WithFingerprint(fn FingerprintFunc) IdempotentOption {
+	return func(i *Idempotent) {
+		i.fingerprint = fn
+	}
+}
+
+// NewIdempotent 创建幂等消费
+func NewIdempotent(store DedupStore, opts ...IdempotentOption) *Idempotent {
+	i := &Idempotent{
+		store:       store,
+		ttl:         defaultDedupTTL,
+		lockTTL:     defaultDedupLockTTL,
+		keyPrefix:   defaultDedupKeyPrefix,
+		fingerprint: DefaultFingerprint,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	return i
+}
+
+// DefaultFingerprint 优先使用 HeaderIdempotencyKey header，没有时使用消息的分区和 offset
+// 消息 key 通常是业务实体 id，同一个 key 会有多条不同的消息，不能作为指纹；
+// 分区和 offset 只能识别同一条消息的重复投递，生产者重试产生的重复消息需要通过 header 指定指纹
+func DefaultFingerprint(msg Message) string {
+	if v := headerValue(msg, HeaderIdempotencyKey); v != "" {
+		return v
+	}
+	return fmt.Sprintf("%d-%d", msg.Partition, msg.Offset)
+}
+
+// Wrap 包装消息处理函数，重复的消息会被跳过，处理失败的消息会释放指纹以便重试
+// 相同指纹的消息正在被其他消费者处理时返回 ErrDedupInProgress，消息不会被跳过
+func (i *Idempotent) Wrap(handler func(ctx context.Context, msg Message) error) func(ctx context.Context, msg Message) error {
+	return func(ctx context.Context, msg Message) error {
+		fingerprint := i.fingerprint(msg)
+		if fingerprint == "" {
+			return handler(ctx, msg)
+		}
+		key := fmt.Sprintf("%s%s:%s", i.keyPrefix, msg.Topic, fingerprint)
+		status, err := i.store.Acquire(ctx, key, i.lockTTL)
+		if err != nil {
+			return fmt.Errorf("acquire dedup key failed: %w", err)
+		}
+		switch status {
+		case DedupDone:
+			return nil
+		case DedupProcessing:
+			return fmt.Errorf("%w, key: %s", ErrDedupInProgress, key)
+		}
+		if err = handler(ctx, msg); err != nil {
+			if releaseErr := i.store.Release(ctx, key); releaseErr != nil {
+				return fmt.Errorf("%w, release dedup key failed: %s", err, releaseErr)
+			}
+			return err
+		}
+		if err = i.store.Commit(ctx, key, i.ttl); err != nil {
+			return fmt.Errorf("commit dedup key failed: %w", err)
+		}
+		return nil
+	}
+}
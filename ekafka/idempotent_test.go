@@ -0,0 +1,92 @@
+package ekafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memoryRedis struct {
+	values map[string]interface{}
+}
+
+func (m *memoryRedis) SetNx(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	if _, ok := m.values[key]; ok {
+		return false, nil
+	}
+	m.values[key] = value
+	return true, nil
+}
+
+func (m *memoryRedis) Get(ctx context.Context, key string) (string, error) {
+	value, ok := m.values[key]
+	if !ok {
+		return "", errors.New("redis: nil")
+	}
+	return value.(string), nil
+}
+
+func (m *memoryRedis) Set(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	m.values[key] = value
+	return nil
+}
+
+func (m *memoryRedis) Del(ctx context.Context, key string) (int64, error) {
+	delete(m.values, key)
+	return 1, nil
+}
+
+func TestIdempotent(t *testing.T) {
+	client := &memoryRedis{values: map[string]interface{}{}}
+	idempotent := NewIdempotent(NewRedisDedupStore(client))
+
+	calls := 0
+	handlerErr := errors.New("handle failed")
+	var returnErr error
+	handler := idempotent.Wrap(func(ctx context.Context, msg Message) error {
+		calls++
+		return returnErr
+	})
+
+	msg := Message{Topic: "orders", Key: []byte("order-1"), Partition: 1, Offset: 10}
+	// 处理失败时释放指纹，重新投递后可以再次处理
+	returnErr = handlerErr
+	assert.ErrorIs(t, handler(context.Background(), msg), handlerErr)
+	assert.Empty(t, client.values)
+
+	returnErr = nil
+	assert.NoError(t, handler(context.Background(), msg))
+	assert.Equal(t, dedupValueDone, client.values["ekafka:dedup:orders:1-10"])
+	// 重复投递的消息被跳过
+	assert.NoError(t, handler(context.Background(), msg))
+	assert.Equal(t, 2, calls)
+
+	// 相同 key 的不同消息不会被当作重复消息
+	assert.NoError(t, handler(context.Background(), Message{Topic: "orders", Key: []byte("order-1"), Partition: 1, Offset: 11}))
+	assert.Equal(t, 3, calls)
+
+	// header 指纹优先
+	msg.Headers = []Header{{Key: HeaderIdempotencyKey, Value: []byte("req-1")}}
+	assert.NoError(t, handler(context.Background(), msg))
+	assert.Equal(t, 4, calls)
+	assert.Contains(t, client.values, "ekafka:dedup:orders:req-1")
+
+	// 正在被其他消费者处理时返回可重试的错误，不会跳过消息
+	client.values["ekafka:dedup:orders:req-2"] = dedupValueProcessing
+	msg.Headers = []Header{{Key: HeaderIdempotencyKey, Value: []byte("req-2")}}
+	assert.ErrorIs(t, handler(context.Background(), msg), ErrDedupInProgress)
+	assert.Equal(t, 4, calls)
+	assert.Equal(t, dedupValueProcessing, client.values["ekafka:dedup:orders:req-2"])
+
+	// 自定义指纹返回空字符串时不做去重
+	noDedup := NewIdempotent(NewRedisDedupStore(client), WithFingerprint(func(msg Message) string { return "" })).Wrap(func(ctx context.Context, msg Message) error {
+		calls++
+		return nil
+	})
+	assert.NoError(t, noDedup(context.Background(), Message{Topic: "orders"}))
+	assert.NoError(t, noDedup(context.Background(), Message{Topic: "orders"}))
+	assert.Equal(t, 6, calls)
+}
@@ -0,0 +1,124 @@
+// Package deleterecords implements the DeleteRecords (api key 21) request,
+// which is not provided by kafka-go.
+package deleterecords
+
+import (
+	"github.com/segmentio/kafka-go/protocol"
+)
+
+func init() {
+	protocol.Register(&Request{}, &Response{})
+}
+
+type Request struct {
+	Topics    []RequestTopic `kafka:"min=v0,max=v1"`
+	TimeoutMs int32          `kafka:"min=v0,max=v1"`
+}
+
+type RequestTopic struct {
+	Name       string             `kafka:"min=v0,max=v1"`
+	Partitions []RequestPartition `kafka:"min=v0,max=v1"`
+}
+
+type RequestPartition struct {
+	PartitionIndex int32 `kafka:"min=v0,max=v1"`
+	Offset         int64 `kafka:"min=v0,max=v1"`
+}
+
+func (r *Request) ApiKey() protocol.ApiKey { return protocol.DeleteRecords }
+
+// Broker DeleteRecords requests must be sent to partition leaders.
+// Expects r to be a request that was returned by Split.
+func (r *Request) Broker(cluster protocol.Cluster) (protocol.Broker, error) {
+	partition := r.Topics[0].Partitions[0].PartitionIndex
+	topic := r.Topics[0].Name
+
+	for _, p := range cluster.Topics[topic].Partitions {
+		if p.ID == partition {
+			return cluster.Brokers[p.Leader], nil
+		}
+	}
+
+	return protocol.Broker{ID: -1}, nil
+}
+
+// Split sends one request per partition so each one can be routed to its leader.
+func (r *Request) Split(cluster protocol.Cluster) ([]protocol.Message, protocol.Merger, error) {
+	messages := make([]protocol.Message, 0, 2*len(r.Topics))
+
+	for _, t := range r.Topics {
+		for _, p := range t.Partitions {
+			messages = append(messages, &Request{
+				Topics: []RequestTopic{{
+					Name:       t.Name,
+					Partitions: []RequestPartition{p},
+				}},
+				TimeoutMs: r.TimeoutMs,
+			})
+		}
+	}
+
+	return messages, new(Response), nil
+}
+
+type Response struct {
+	ThrottleTimeMs int32           `kafka:"min=v0,max=v1"`
+	Topics         []ResponseTopic `kafka:"min=v0,max=v1"`
+}
+
+type ResponseTopic struct {
+	Name       string              `kafka:"min=v0,max=v1"`
+	Partitions []ResponsePartition `kafka:"min=v0,max=v1"`
+}
+
+type ResponsePartition struct {
+	PartitionIndex int32 `kafka:"min=v0,max=v1"`
+	LowWatermark   int64 `kafka:"min=v0,max=v1"`
+	ErrorCode      int16 `kafka:"min=v0,max=v1"`
+}
+
+func (r *Response) ApiKey() protocol.ApiKey { return protocol.DeleteRecords }
+
+func (r *Response) Merge(requests []protocol.Message, results []interface{}) (protocol.Message, error) {
+	topics := make(map[string][]ResponsePartition)
+	errors := 0
+
+	for i, res := range results {
+		m, err := protocol.Result(res)
+		if err != nil {
+			for _, t := range requests[i].(*Request).Topics {
+				for _, p := range t.Partitions {
+					topics[t.Name] = append(topics[t.Name], ResponsePartition{
+						PartitionIndex: p.PartitionIndex,
+						LowWatermark:   -1,
+						ErrorCode:      -1, // UNKNOWN
+					})
+				}
+			}
+			errors++
+			continue
+		}
+
+		response := m.(*Response)
+		if r.ThrottleTimeMs < response.ThrottleTimeMs {
+			r.ThrottleTimeMs = response.ThrottleTimeMs
+		}
+		for _, t := range response.Topics {
+			topics[t.Name] = append(topics[t.Name], t.Partitions...)
+		}
+	}
+
+	if errors > 0 && errors == len(results) {
+		_, err := protocol.Result(results[0])
+		return nil, err
+	}
+
+	r.Topics = make([]ResponseTopic, 0, len(topics))
+	for name, partitions := range topics {
+		r.Topics = append(r.Topics, ResponseTopic{
+			Name:       name,
+			Partitions: partitions,
+		})
+	}
+	return r, nil
+}
@@ -41,3 +41,16 @@ func WithRegisterBalancer(balancerName string, balancer Balancer) Option {
 		c.config.balancers[balancerName] = balancer
 	}
 }
+
+// WithRegisterBalancerFunc 注册名字为<balancerName>的自定义分区函数
+// 注册之后可通过在producer配置文件中可通过<balancerName>来指定使用此分区函数
+func WithRegisterBalancerFunc(balancerName string, fn func(msg Message, partitions ...int) int) Option {
+	return WithRegisterBalancer(balancerName, BalancerFunc(fn))
+}
+
+// WithOffloader 注册大消息转存，配合 producer 的 oversizeAction = "offload" 使用
+func WithOffloader(offloader Offloader) Option {
+	return func(c *Container) {
+		c.config.offloader = offloader
+	}
+}
@@ -0,0 +1,127 @@
+package ekafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+// ErrFenced 消息所在分区已经被 Fence（rebalance 中被回收），消息不会被处理
+var ErrFenced = errors.New("ekafka: message fenced by a newer partition epoch")
+
+// OrderedHandler 有序处理函数
+type OrderedHandler = func(ctx context.Context, msg Message) error
+
+// OrderedDispatcher 严格按 key 有序的并发处理器
+// 相同 key 的消息按 Dispatch 的调用顺序串行处理，不同 key 的消息最多由 workers 个 goroutine 并发处理；没有 key 的消息按分区串行处理
+// 每个分区维护一个 epoch，分区在 rebalance 中被回收时调用 Fence，之前派发但尚未开始处理的消息会以 ErrFenced 结束，
+// 避免新的分区持有者和旧的处理过程交错修改同一个 key 的状态
+type OrderedDispatcher struct {
+	handler OrderedHandler
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	// queues 每个 key 待处理的消息，队首为正在处理的消息，key 存在即表示有 goroutine 在处理该 key
+	queues map[string][]orderedTask
+	epochs map[int]uint64
+}
+
+type orderedTask struct {
+	ctx   context.Context
+	msg   Message
+	epoch uint64
+	done  func(err error)
+}
+
+// NewOrderedDispatcher 创建有序处理器，workers 为最大并发数，小于等于0时为1
+func NewOrderedDispatcher(workers int, handler OrderedHandler) *OrderedDispatcher {
+	if workers <= 0 {
+		workers = 1
+	}
+	return &OrderedDispatcher{
+		handler: handler,
+		sem:     make(chan struct{}, workers),
+		queues:  make(map[string][]orderedTask),
+		epochs:  make(map[int]uint64),
+	}
+}
+
+// Dispatch 派发消息，不会阻塞；处理结束后以处理结果调用 done，done 可以为 nil
+// 同一个 key 的消息必须在同一个 goroutine 中按顺序派发
+func (d *OrderedDispatcher) Dispatch(ctx context.Context, msg Message, done func(err error)) {
+	if done == nil {
+		done = func(error) {}
+	}
+	key := orderedKey(msg)
+
+	d.mu.Lock()
+	queue, running := d.queues[key]
+	d.queues[key] = append(queue, orderedTask{ctx: ctx, msg: msg, epoch: d.epochs[msg.Partition], done: done})
+	d.mu.Unlock()
+
+	if !running {
+		d.wg.Add(1)
+		go d.run(key)
+	}
+}
+
+// Fence 提升分区的 epoch，应在收到 RevokedPartitions 时调用
+func (d *OrderedDispatcher) Fence(partitions ...int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, partition := range partitions {
+		d.epochs[partition]++
+	}
+}
+
+// Wait 等待所有已派发的消息处理结束
+func (d *OrderedDispatcher) Wait() {
+	d.wg.Wait()
+}
+
+func (d *OrderedDispatcher) run(key string) {
+	defer d.wg.Done()
+	for {
+		d.mu.Lock()
+		task := d.queues[key][0]
+		d.mu.Unlock()
+
+		task.done(d.handle(task))
+
+		d.mu.Lock()
+		queue := d.queues[key][1:]
+		if len(queue) == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		d.queues[key] = queue
+		d.mu.Unlock()
+	}
+}
+
+func (d *OrderedDispatcher) handle(task orderedTask) error {
+	select {
+	case d.sem <- struct{}{}:
+	case <-task.ctx.Done():
+		return task.ctx.Err()
+	}
+	defer func() { <-d.sem }()
+
+	d.mu.Lock()
+	fenced := d.epochs[task.msg.Partition] != task.epoch
+	d.mu.Unlock()
+	if fenced {
+		return ErrFenced
+	}
+	return d.handler(task.ctx, task.msg)
+}
+
+// orderedKey 有 key 的消息按 key 串行，没有 key 的消息按分区串行
+func orderedKey(msg Message) string {
+	if len(msg.Key) == 0 {
+		return "\x00" + strconv.Itoa(msg.Partition)
+	}
+	return string(msg.Key)
+}
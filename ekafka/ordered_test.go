@@ -0,0 +1,76 @@
+package ekafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrderedDispatcher(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		seen   = map[string][]int64{}
+		active = map[string]bool{}
+	)
+	dispatcher := NewOrderedDispatcher(4, func(ctx context.Context, msg Message) error {
+		mu.Lock()
+		assert.False(t, active[string(msg.Key)], "same key handled concurrently")
+		active[string(msg.Key)] = true
+		mu.Unlock()
+
+		mu.Lock()
+		seen[string(msg.Key)] = append(seen[string(msg.Key)], msg.Offset)
+		active[string(msg.Key)] = false
+		mu.Unlock()
+		return nil
+	})
+
+	keys := []string{"a", "b", "c"}
+	for offset := int64(0); offset < 300; offset++ {
+		dispatcher.Dispatch(context.Background(), Message{Key: []byte(keys[offset%3]), Offset: offset}, nil)
+	}
+	dispatcher.Wait()
+
+	for _, key := range keys {
+		assert.Len(t, seen[key], 100)
+		for i := 1; i < len(seen[key]); i++ {
+			assert.Less(t, seen[key][i-1], seen[key][i])
+		}
+	}
+}
+
+func TestOrderedDispatcherFence(t *testing.T) {
+	started, block := make(chan struct{}), make(chan struct{})
+	dispatcher := NewOrderedDispatcher(1, func(ctx context.Context, msg Message) error {
+		if msg.Offset == 0 {
+			close(started)
+			<-block
+		}
+		return nil
+	})
+
+	results := make([]error, 3)
+	for i := range results {
+		i := i
+		dispatcher.Dispatch(context.Background(), Message{Partition: 1, Key: []byte("account"), Offset: int64(i)}, func(err error) {
+			results[i] = err
+		})
+	}
+	<-started
+	// 分区被回收后，尚未开始处理的消息不再处理
+	dispatcher.Fence(1)
+	close(block)
+	dispatcher.Wait()
+
+	assert.NoError(t, results[0])
+	assert.ErrorIs(t, results[1], ErrFenced)
+	assert.ErrorIs(t, results[2], ErrFenced)
+
+	// Fence 之后派发的消息正常处理
+	var err error
+	dispatcher.Dispatch(context.Background(), Message{Partition: 1, Key: []byte("account"), Offset: 3}, func(e error) { err = e })
+	dispatcher.Wait()
+	assert.NoError(t, err)
+}
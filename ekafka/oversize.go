@@ -0,0 +1,242 @@
+package ekafka
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gotomicro/ego/core/emetric"
+)
+
+const (
+	// HeaderTruncatedFrom 被截断的消息会带上该 header，值为截断前 value 的字节数
+	HeaderTruncatedFrom = "ekafka-truncated-from"
+	// HeaderOffloadPointer 被转存的消息会带上该 header，值为 Offloader 返回的对象地址
+	HeaderOffloadPointer = "ekafka-offload-pointer"
+)
+
+const (
+	// OversizeActionReject 超过 maxMessageBytes 的消息直接返回 ErrMessageTooLarge，默认行为
+	OversizeActionReject = "reject"
+	// OversizeActionTruncate 按结构截断 value 到 maxMessageBytes 以内，JSON 截断字符串字段，文本按字符截断，二进制无法截断时返回 ErrMessageTooLarge
+	OversizeActionTruncate = "truncate"
+	// OversizeActionOffload 将 value 转存到对象存储，消息中只保留对象地址
+	OversizeActionOffload = "offload"
+)
+
+// ErrOffloaderNotFound 消息带有 HeaderOffloadPointer，但没有配置 Offloader
+var ErrOffloaderNotFound = errors.New("ekafka: offloader not found")
+
+// messageSizeHistogram 生产消息的大小分布
+var messageSizeHistogram = emetric.HistogramVecOpts{
+	Namespace: emetric.DefaultNamespace,
+	Name:      "kafka_message_bytes",
+	Help:      "Size of produced kafka messages in bytes",
+	Labels:    []string{"name", "topic", "action"},
+	Buckets:   []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304},
+}.Build()
+
+// Offloader 大消息转存，通常基于对象存储实现
+type Offloader interface {
+	// Put 保存消息 value，返回对象地址
+	Put(ctx context.Context, topic string, value []byte) (pointer string, err error)
+	// Get 根据对象地址读取消息 value
+	Get(ctx context.Context, pointer string) ([]byte, error)
+}
+
+// guardSize 检查消息大小，按 oversizeAction 处理超过 maxMessageBytes 的消息，被修改的消息会复制一份，不影响调用方
+func (p *Producer) guardSize(ctx context.Context, msgs Messages) (Messages, error) {
+	guarded, copied := msgs, false
+	for i, msg := range msgs {
+		size := messageSize(msg)
+		topic := msg.Topic
+		if topic == "" && p.w != nil {
+			topic = p.w.Topic
+		}
+		if p.maxMessageBytes <= 0 || size <= p.maxMessageBytes {
+			messageSizeHistogram.Observe(float64(size), p.compName, topic, "ok")
+			continue
+		}
+		messageSizeHistogram.Observe(float64(size), p.compName, topic, p.oversizeAction)
+
+		var (
+			guardedMsg Message
+			err        error
+		)
+		switch p.oversizeAction {
+		case OversizeActionTruncate:
+			guardedMsg, err = truncateMessage(*msg, p.maxMessageBytes, p.truncateFields)
+		case OversizeActionOffload:
+			guardedMsg, err = offloadMessage(ctx, p.offloader, topic, *msg)
+		default:
+			err = fmt.Errorf("%w, size: %d, maxMessageBytes: %d", ErrMessageTooLarge, size, p.maxMessageBytes)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !copied {
+			guarded = make(Messages, len(msgs))
+			copy(guarded, msgs)
+			copied = true
+		}
+		guarded[i] = &guardedMsg
+	}
+	return guarded, nil
+}
+
+// truncateMessage 截断 value，使消息总大小不超过 maxMessageBytes，截断后的 value 仍然是合法的 JSON 或 UTF-8 文本
+func truncateMessage(msg Message, maxMessageBytes int64, fields []string) (Message, error) {
+	value := msg.Value
+	msg.Headers = append(append([]Header(nil), msg.Headers...), Header{Key: HeaderTruncatedFrom, Value: []byte(strconv.Itoa(len(value)))})
+	msg.Value = nil
+	remain := maxMessageBytes - messageSize(&msg)
+	if remain < 0 {
+		return msg, fmt.Errorf("%w, key and headers exceed maxMessageBytes: %d", ErrMessageTooLarge, maxMessageBytes)
+	}
+	if truncated, ok := truncateJSON(value, int(remain), fields); ok {
+		msg.Value = truncated
+		return msg, nil
+	}
+	if json.Valid(value) || !utf8.Valid(value) {
+		return msg, fmt.Errorf("%w, value can not be truncated to %d bytes", ErrMessageTooLarge, remain)
+	}
+	msg.Value = []byte(truncateString(string(value), int(remain)))
+	return msg, nil
+}
+
+// jsonString JSON 中的一个字符串字段
+type jsonString struct {
+	path  string
+	value string
+	set   func(value string)
+}
+
+// truncateJSON 截断 JSON 中的字符串字段直到序列化后不超过 limit，优先截断 fields 中的字段，否则每次截断最长的字段
+// value 不是 JSON 或者截断所有字符串字段后仍然超过 limit 时返回 false
+func truncateJSON(value []byte, limit int, fields []string) ([]byte, bool) {
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil || decoder.More() {
+		return nil, false
+	}
+	for {
+		buf := &bytes.Buffer{}
+		encoder := json.NewEncoder(buf)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(doc); err != nil {
+			return nil, false
+		}
+		out := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+		over := len(out) - limit
+		if over <= 0 {
+			return out, true
+		}
+		field, ok := pickTruncateField(collectJSONStrings(&doc), fields)
+		if !ok {
+			return nil, false
+		}
+		// 每删除一个字节，序列化后至少减少一个字节
+		field.set(truncateString(field.value, len(field.value)-over))
+	}
+}
+
+// pickTruncateField 选择要截断的字段：fields 中第一个非空的字段，没有配置 fields 时选择最长的字段
+func pickTruncateField(strs []jsonString, fields []string) (jsonString, bool) {
+	if len(fields) > 0 {
+		for _, field := range fields {
+			for _, str := range strs {
+				if str.path == field && str.value != "" {
+					return str, true
+				}
+			}
+		}
+		return jsonString{}, false
+	}
+	sort.SliceStable(strs, func(i, j int) bool {
+		return len(strs[i].value) > len(strs[j].value)
+	})
+	if len(strs) == 0 || strs[0].value == "" {
+		return jsonString{}, false
+	}
+	return strs[0], true
+}
+
+// collectJSONStrings 收集所有字符串字段，路径以 "." 分隔，数组元素使用下标
+func collectJSONStrings(doc *interface{}) []jsonString {
+	strs := make([]jsonString, 0)
+	var walk func(path string, v interface{}, set func(string))
+	walk = func(path string, v interface{}, set func(string)) {
+		switch v := v.(type) {
+		case string:
+			strs = append(strs, jsonString{path: path, value: v, set: set})
+		case map[string]interface{}:
+			for key, child := range v {
+				key := key
+				walk(joinJSONPath(path, key), child, func(value string) { v[key] = value })
+			}
+		case []interface{}:
+			for i, child := range v {
+				i := i
+				walk(joinJSONPath(path, strconv.Itoa(i)), child, func(value string) { v[i] = value })
+			}
+		}
+	}
+	walk("", *doc, func(value string) { *doc = value })
+	return strs
+}
+
+func joinJSONPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return strings.Join([]string{path, key}, ".")
+}
+
+// truncateString 截断到不超过 n 个字节，不会截断多字节字符
+func truncateString(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// offloadMessage 转存 value，消息中只保留对象地址
+func offloadMessage(ctx context.Context, offloader Offloader, topic string, msg Message) (Message, error) {
+	pointer, err := offloader.Put(ctx, topic, msg.Value)
+	if err != nil {
+		return msg, fmt.Errorf("offload message failed: %w", err)
+	}
+	msg.Value = nil
+	msg.Headers = append(append([]Header(nil), msg.Headers...), Header{Key: HeaderOffloadPointer, Value: []byte(pointer)})
+	return msg, nil
+}
+
+// LoadOffloaded 读取被转存的消息 value，消息没有被转存时直接返回
+func LoadOffloaded(ctx context.Context, offloader Offloader, msg *Message) error {
+	pointer := headerValue(*msg, HeaderOffloadPointer)
+	if pointer == "" {
+		return nil
+	}
+	if offloader == nil {
+		return ErrOffloaderNotFound
+	}
+	value, err := offloader.Get(ctx, pointer)
+	if err != nil {
+		return fmt.Errorf("load offloaded message failed: %w", err)
+	}
+	msg.Value = value
+	return nil
+}
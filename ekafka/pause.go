@@ -0,0 +1,128 @@
+package ekafka
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// pauseGate 记录暂停状态，消费循环在拉取消息前通过 wait 阻塞直到恢复
+// holds 是按原因（如下游健康检查）暂停全部分区的记录，与 pause/resume 相互独立，只能通过 release 恢复
+type pauseGate struct {
+	mu         sync.Mutex
+	all        chan struct{}
+	partitions map[int]chan struct{}
+	holds      map[string]chan struct{}
+}
+
+func newPauseGate() *pauseGate {
+	return &pauseGate{
+		partitions: make(map[int]chan struct{}),
+		holds:      make(map[string]chan struct{}),
+	}
+}
+
+// hold 按原因暂停全部分区
+func (g *pauseGate) hold(reason string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, ok := g.holds[reason]; !ok {
+		g.holds[reason] = make(chan struct{})
+	}
+}
+
+// release 解除 hold，不影响 pause 暂停的分区以及其他原因的 hold
+func (g *pauseGate) release(reason string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if ch, ok := g.holds[reason]; ok {
+		close(ch)
+		delete(g.holds, reason)
+	}
+}
+
+// pause 暂停指定分区，不指定分区时暂停全部
+func (g *pauseGate) pause(partitions ...int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(partitions) == 0 {
+		if g.all == nil {
+			g.all = make(chan struct{})
+		}
+		return
+	}
+	for _, partition := range partitions {
+		if _, ok := g.partitions[partition]; !ok {
+			g.partitions[partition] = make(chan struct{})
+		}
+	}
+}
+
+// resume 恢复指定分区，不指定分区时恢复全部，不会解除 hold
+func (g *pauseGate) resume(partitions ...int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(partitions) == 0 {
+		if g.all != nil {
+			close(g.all)
+			g.all = nil
+		}
+		for partition, ch := range g.partitions {
+			close(ch)
+			delete(g.partitions, partition)
+		}
+		return
+	}
+	for _, partition := range partitions {
+		if ch, ok := g.partitions[partition]; ok {
+			close(ch)
+			delete(g.partitions, partition)
+		}
+	}
+}
+
+func (g *pauseGate) isPaused(partition int) bool {
+	return g.blocker(partition) != nil
+}
+
+// paused 返回单独暂停的分区
+func (g *pauseGate) paused() []int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	partitions := make([]int, 0, len(g.partitions))
+	for partition := range g.partitions {
+		partitions = append(partitions, partition)
+	}
+	sort.Ints(partitions)
+	return partitions
+}
+
+func (g *pauseGate) blocker(partition int) chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.all != nil {
+		return g.all
+	}
+	if ch, ok := g.partitions[partition]; ok {
+		return ch
+	}
+	for _, ch := range g.holds {
+		return ch
+	}
+	return nil
+}
+
+// wait 阻塞直到分区恢复消费或 ctx 结束
+func (g *pauseGate) wait(ctx context.Context, partition int) error {
+	for {
+		ch := g.blocker(partition)
+		if ch == nil {
+			return nil
+		}
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
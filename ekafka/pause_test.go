@@ -0,0 +1,59 @@
+package ekafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPauseGate(t *testing.T) {
+	gate := newPauseGate()
+	assert.NoError(t, gate.wait(context.Background(), 0))
+
+	gate.pause(1, 2)
+	assert.True(t, gate.isPaused(1))
+	assert.False(t, gate.isPaused(0))
+	assert.Equal(t, []int{1, 2}, gate.paused())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, gate.wait(ctx, 1), context.DeadlineExceeded)
+
+	done := make(chan error)
+	go func() {
+		done <- gate.wait(context.Background(), 2)
+	}()
+	gate.resume(2)
+	assert.NoError(t, <-done)
+	assert.Equal(t, []int{1}, gate.paused())
+
+	gate.pause()
+	assert.True(t, gate.isPaused(0))
+	gate.resume()
+	assert.False(t, gate.isPaused(0))
+	assert.False(t, gate.isPaused(1))
+
+	// hold 与 pause 相互独立
+	gate.pause(1)
+	gate.hold("health")
+	assert.True(t, gate.isPaused(0))
+	gate.resume()
+	assert.True(t, gate.isPaused(0))
+	gate.pause(1)
+	gate.release("health")
+	assert.False(t, gate.isPaused(0))
+	assert.True(t, gate.isPaused(1))
+	gate.resume(1)
+
+	done = make(chan error)
+	go func() {
+		done <- gate.wait(context.Background(), 0)
+	}()
+	gate.hold("health")
+	gate.hold("other")
+	gate.release("health")
+	gate.release("other")
+	assert.NoError(t, <-done)
+}
@@ -2,14 +2,26 @@ package ekafka
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// ErrMessageTooLarge 消息超过了 producer 配置的 maxMessageBytes
+var ErrMessageTooLarge = errors.New("ekafka: message too large")
+
 type Producer struct {
-	w         *kafka.Writer
-	processor ClientInterceptor
-	logMode   bool
+	w               *kafka.Writer
+	processor       ClientInterceptor
+	logMode         bool
+	compName        string
+	maxMessageBytes int64
+	oversizeAction  string
+	truncateFields  []string
+	offloader       Offloader
+	failover        *failoverWriter
 }
 
 func (p *Producer) setProcessor(c ClientInterceptor) {
@@ -19,13 +31,70 @@ func (p *Producer) setProcessor(c ClientInterceptor) {
 func (p *Producer) Close() error {
 	return p.processor(func(ctx context.Context, msgs Messages, c *cmd) error {
 		logCmd(p.logMode, c, "ProducerClose", cmdWithTopic(p.w.Topic))
-		return p.w.Close()
+		var failoverErr error
+		if p.failover != nil {
+			failoverErr = p.failover.Close()
+		}
+		if err := p.w.Close(); err != nil {
+			return err
+		}
+		return failoverErr
 	})(context.Background(), nil, &cmd{})
 }
 
 func (p *Producer) WriteMessages(ctx context.Context, msgs ...*Message) error {
+	msgs, err := p.guardSize(ctx, msgs)
+	if err != nil {
+		return err
+	}
 	return p.processor(func(ctx context.Context, req Messages, c *cmd) error {
 		logCmd(p.logMode, c, "WriteMessages", cmdWithTopic(p.w.Topic))
+		if p.failover != nil {
+			return p.failover.WriteMessages(ctx, req.ToNoPointer()...)
+		}
 		return p.w.WriteMessages(ctx, req.ToNoPointer()...)
 	})(ctx, msgs, &cmd{})
 }
+
+// ActiveCluster 返回当前写入的集群，未配置 failover 或未切换时为 primary，切换到备用集群后为 secondary
+func (p *Producer) ActiveCluster() string {
+	if p.failover == nil {
+		return "primary"
+	}
+	return p.failover.ActiveCluster()
+}
+
+// FailoverBuffered 返回主集群不可用期间缓存、尚未重放成功的消息数量，未配置 failover 时为0
+func (p *Producer) FailoverBuffered() int {
+	if p.failover == nil {
+		return 0
+	}
+	return p.failover.Buffered()
+}
+
+// messageSize 返回消息 key、value、headers 的总字节数
+func messageSize(msg *Message) int64 {
+	size := int64(len(msg.Key) + len(msg.Value))
+	for _, header := range msg.Headers {
+		size += int64(len(header.Key) + len(header.Value))
+	}
+	return size
+}
+
+// parseCompression 解析压缩配置，支持名称（gzip、snappy、lz4、zstd）和编号（1-4），为空时不压缩
+func parseCompression(compression string) (kafka.Compression, error) {
+	switch strings.ToLower(compression) {
+	case "", "0", "none":
+		return 0, nil
+	case "1", "gzip":
+		return kafka.Gzip, nil
+	case "2", "snappy":
+		return kafka.Snappy, nil
+	case "3", "lz4":
+		return kafka.Lz4, nil
+	case "4", "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("unknown compression: %s", compression)
+	}
+}
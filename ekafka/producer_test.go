@@ -0,0 +1,119 @@
+package ekafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCompression(t *testing.T) {
+	cases := map[string]kafka.Compression{
+		"":       0,
+		"gzip":   kafka.Gzip,
+		"Snappy": kafka.Snappy,
+		"3":      kafka.Lz4,
+		"zstd":   kafka.Zstd,
+	}
+	for value, expected := range cases {
+		compression, err := parseCompression(value)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, compression)
+	}
+	_, err := parseCompression("brotli")
+	assert.Error(t, err)
+}
+
+func TestProducerMaxMessageBytes(t *testing.T) {
+	p := &Producer{maxMessageBytes: 4}
+	err := p.WriteMessages(context.Background(), &Message{Key: []byte("k"), Value: []byte("value")})
+	assert.True(t, errors.Is(err, ErrMessageTooLarge))
+}
+
+type memoryOffloader map[string][]byte
+
+func (m memoryOffloader) Put(ctx context.Context, topic string, value []byte) (string, error) {
+	pointer := topic + "/1"
+	m[pointer] = value
+	return pointer, nil
+}
+
+func (m memoryOffloader) Get(ctx context.Context, pointer string) ([]byte, error) {
+	return m[pointer], nil
+}
+
+func TestProducerOversizeAction(t *testing.T) {
+	msg := &Message{Topic: "t", Key: []byte("k"), Value: []byte("0123456789012345678901234567890123456789")}
+
+	p := &Producer{maxMessageBytes: 32, oversizeAction: OversizeActionTruncate}
+	guarded, err := p.guardSize(context.Background(), Messages{msg})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(32), messageSize(guarded[0]))
+	assert.Equal(t, "40", headerValue(*guarded[0], HeaderTruncatedFrom))
+	// 不影响调用方的消息
+	assert.Len(t, msg.Value, 40)
+	assert.Empty(t, msg.Headers)
+
+	offloader := memoryOffloader{}
+	p = &Producer{maxMessageBytes: 32, oversizeAction: OversizeActionOffload, offloader: offloader}
+	guarded, err = p.guardSize(context.Background(), Messages{msg})
+	assert.NoError(t, err)
+	assert.Empty(t, guarded[0].Value)
+	assert.Equal(t, "t/1", headerValue(*guarded[0], HeaderOffloadPointer))
+
+	loaded := *guarded[0]
+	assert.NoError(t, LoadOffloaded(context.Background(), offloader, &loaded))
+	assert.Equal(t, msg.Value, loaded.Value)
+}
+
+func TestTruncateMessage(t *testing.T) {
+	limit := int64(120)
+	value := `{"id":1,"title":"` + strings.Repeat("t", 30) + `","body":"` + strings.Repeat("中", 40) + `","tags":["a","b"]}`
+
+	// 默认截断最长的字符串字段，结果仍然是合法的 JSON
+	msg, err := truncateMessage(Message{Value: []byte(value)}, limit, nil)
+	assert.NoError(t, err)
+	assert.LessOrEqual(t, messageSize(&msg), limit)
+	var doc map[string]interface{}
+	assert.NoError(t, json.Unmarshal(msg.Value, &doc))
+	assert.Equal(t, strings.Repeat("t", 30), doc["title"])
+	assert.True(t, strings.HasPrefix(strings.Repeat("中", 40), doc["body"].(string)))
+	assert.Equal(t, float64(1), doc["id"])
+	assert.Equal(t, []interface{}{"a", "b"}, doc["tags"])
+	assert.Equal(t, strconv.Itoa(len(value)), headerValue(msg, HeaderTruncatedFrom))
+
+	// 指定截断的字段
+	msg, err = truncateMessage(Message{Value: []byte(value)}, limit+60, []string{"title", "body"})
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(msg.Value, &doc))
+	assert.Equal(t, "", doc["title"])
+	assert.NotEmpty(t, doc["body"])
+
+	// 嵌套字段和数组
+	msg, err = truncateMessage(Message{Value: []byte(`{"data":{"items":["` + strings.Repeat("x", 100) + `"]}}`)}, 60, []string{"data.items.0"})
+	assert.NoError(t, err)
+	assert.True(t, json.Valid(msg.Value))
+	assert.LessOrEqual(t, messageSize(&msg), int64(60))
+
+	// 指定的字段截断后仍然超过限制
+	_, err = truncateMessage(Message{Value: []byte(value)}, limit, []string{"title"})
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+
+	// 没有字符串字段的 JSON 无法截断
+	_, err = truncateMessage(Message{Value: []byte(`[` + strings.Repeat("1,", 50) + `1]`)}, limit, nil)
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+
+	// 文本按字符截断，64 - len(header) = 40 字节，只能保留13个字符
+	msg, err = truncateMessage(Message{Value: []byte(strings.Repeat("中", 40))}, 64, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("中", 13), string(msg.Value))
+
+	// 二进制无法截断
+	_, err = truncateMessage(Message{Value: append([]byte{0xff, 0xfe}, make([]byte, 100)...)}, limit, nil)
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+}
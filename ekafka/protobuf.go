@@ -0,0 +1,112 @@
+package ekafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// HeaderProtoType 消息头中记录 protobuf 消息类型全名的 key，由 NewProtoMessage 写入
+const HeaderProtoType = "ekafka-proto-type"
+
+var (
+	// ErrProtoHandlerNotFound 没有找到可以处理该消息的 protobuf handler
+	ErrProtoHandlerNotFound = errors.New("ekafka: proto handler not found")
+	// ErrProtoTypeMismatch 消息头中的类型与 topic 注册的类型不一致
+	ErrProtoTypeMismatch = errors.New("ekafka: proto type mismatch")
+)
+
+type protoHandlerFn func(ctx context.Context, msg Message) error
+
+type protoRoute struct {
+	fullName protoreflect.FullName
+	fn       protoHandlerFn
+}
+
+// ProtoRouter 根据 topic 或消息头中的类型信息（envelope）将消息反序列化为对应的 protobuf 类型，并分发给注册的 handler。
+// topic 路由优先：注册了 topic 的消息总是交给该 topic 的 handler，消息头中的类型与之不一致时返回 ErrProtoTypeMismatch；
+// 没有注册 topic 的消息按消息头中的类型分发
+type ProtoRouter struct {
+	mu     sync.RWMutex
+	topics map[string]protoRoute
+	types  map[protoreflect.FullName]protoHandlerFn
+}
+
+// NewProtoRouter 返回一个空的 ProtoRouter
+func NewProtoRouter() *ProtoRouter {
+	return &ProtoRouter{
+		topics: make(map[string]protoRoute),
+		types:  make(map[protoreflect.FullName]protoHandlerFn),
+	}
+}
+
+// Handle 注册 topic 对应的 typed handler，该 topic 的消息均会被反序列化为 T
+// 同时也会按 T 的类型全名注册，用于没有注册 topic 的消息；topic 为空时只按类型注册
+func Handle[T proto.Message](r *ProtoRouter, topic string, handler func(ctx context.Context, msg Message, payload T) error) {
+	var zero T
+	fullName := zero.ProtoReflect().Descriptor().FullName()
+	fn := func(ctx context.Context, msg Message) error {
+		payload := zero.ProtoReflect().New().Interface().(T)
+		if err := proto.Unmarshal(msg.Value, payload); err != nil {
+			return fmt.Errorf("ekafka: unmarshal %s failed: %w", fullName, err)
+		}
+		return handler(ctx, msg, payload)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if topic != "" {
+		r.topics[topic] = protoRoute{fullName: fullName, fn: fn}
+	}
+	r.types[fullName] = fn
+}
+
+// HandleMessage 分发消息，签名与 consumerserver.OnEachMessageHandler 一致，可直接注册
+func (r *ProtoRouter) HandleMessage(ctx context.Context, msg Message) error {
+	typeName := protoreflect.FullName(headerValue(msg, HeaderProtoType))
+	r.mu.RLock()
+	route, ok := r.topics[msg.Topic]
+	fn := route.fn
+	if !ok && typeName != "" {
+		fn = r.types[typeName]
+	}
+	r.mu.RUnlock()
+
+	if ok && typeName != "" && typeName != route.fullName {
+		return fmt.Errorf("%w, topic: %s, expect: %s, got: %s", ErrProtoTypeMismatch, msg.Topic, route.fullName, typeName)
+	}
+
+	if fn == nil {
+		return fmt.Errorf("%w, topic: %s", ErrProtoHandlerNotFound, msg.Topic)
+	}
+	return fn(ctx, msg)
+}
+
+// NewProtoMessage 序列化 protobuf 消息，并在消息头中写入类型全名
+func NewProtoMessage(key []byte, payload proto.Message) (*Message, error) {
+	value, err := proto.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return &Message{
+		Key:   key,
+		Value: value,
+		Headers: []Header{{
+			Key:   HeaderProtoType,
+			Value: []byte(payload.ProtoReflect().Descriptor().FullName()),
+		}},
+	}, nil
+}
+
+func headerValue(msg Message, key string) string {
+	for _, header := range msg.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package ekafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestProtoRouter(t *testing.T) {
+	router := NewProtoRouter()
+	var gotString string
+	var gotInt int64
+	Handle(router, "topic-string", func(ctx context.Context, msg Message, payload *wrapperspb.StringValue) error {
+		gotString = payload.GetValue()
+		return nil
+	})
+	Handle(router, "", func(ctx context.Context, msg Message, payload *wrapperspb.Int64Value) error {
+		gotInt = payload.GetValue()
+		return nil
+	})
+
+	// 按 topic 分发
+	msg, err := NewProtoMessage(nil, wrapperspb.String("hello"))
+	assert.NoError(t, err)
+	msg.Headers = nil
+	msg.Topic = "topic-string"
+	assert.NoError(t, router.HandleMessage(context.Background(), *msg))
+	assert.Equal(t, "hello", gotString)
+
+	// 类型与 topic 一致
+	msg, err = NewProtoMessage(nil, wrapperspb.String("world"))
+	assert.NoError(t, err)
+	msg.Topic = "topic-string"
+	assert.NoError(t, router.HandleMessage(context.Background(), *msg))
+	assert.Equal(t, "world", gotString)
+
+	// 没有注册 topic 时按消息头中的类型分发
+	msg, err = NewProtoMessage(nil, wrapperspb.Int64(42))
+	assert.NoError(t, err)
+	msg.Topic = "topic-any"
+	assert.NoError(t, router.HandleMessage(context.Background(), *msg))
+	assert.Equal(t, int64(42), gotInt)
+
+	// topic 路由优先，消息头中的类型不一致时报错
+	msg, err = NewProtoMessage(nil, wrapperspb.Int64(43))
+	assert.NoError(t, err)
+	msg.Topic = "topic-string"
+	err = router.HandleMessage(context.Background(), *msg)
+	assert.True(t, errors.Is(err, ErrProtoTypeMismatch))
+	assert.Equal(t, int64(42), gotInt)
+
+	// 未注册
+	err = router.HandleMessage(context.Background(), Message{Topic: "unknown"})
+	assert.True(t, errors.Is(err, ErrProtoHandlerNotFound))
+
+	// 反序列化失败
+	err = router.HandleMessage(context.Background(), Message{Topic: "topic-string", Value: []byte{0xff}})
+	assert.Error(t, err)
+}
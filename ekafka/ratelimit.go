@@ -0,0 +1,60 @@
+package ekafka
+
+import (
+	"context"
+
+	"golang.org/x/time/rate"
+)
+
+// consumeLimiter 限制消费速率，按消息条数和字节数分别限流
+type consumeLimiter struct {
+	messages *rate.Limiter
+	bytes    *rate.Limiter
+}
+
+// newConsumeLimiter 未配置限流时返回 nil
+func newConsumeLimiter(messagesPerSecond float64, bytesPerSecond int) *consumeLimiter {
+	if messagesPerSecond <= 0 && bytesPerSecond <= 0 {
+		return nil
+	}
+	l := &consumeLimiter{}
+	if messagesPerSecond > 0 {
+		burst := int(messagesPerSecond)
+		if burst < 1 {
+			burst = 1
+		}
+		l.messages = rate.NewLimiter(rate.Limit(messagesPerSecond), burst)
+	}
+	if bytesPerSecond > 0 {
+		l.bytes = rate.NewLimiter(rate.Limit(bytesPerSecond), bytesPerSecond)
+	}
+	return l
+}
+
+// wait 阻塞直到允许处理该消息
+func (l *consumeLimiter) wait(ctx context.Context, msg Message) error {
+	if l == nil {
+		return nil
+	}
+	if l.messages != nil {
+		if err := l.messages.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	if l.bytes != nil {
+		// 超过 burst 的消息分多次获取令牌
+		size := int(messageSize(&msg))
+		burst := l.bytes.Burst()
+		for size > 0 {
+			n := size
+			if n > burst {
+				n = burst
+			}
+			if err := l.bytes.WaitN(ctx, n); err != nil {
+				return err
+			}
+			size -= n
+		}
+	}
+	return nil
+}
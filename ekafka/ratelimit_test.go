@@ -0,0 +1,29 @@
+package ekafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsumeLimiter(t *testing.T) {
+	assert.Nil(t, newConsumeLimiter(0, 0))
+	var l *consumeLimiter
+	assert.NoError(t, l.wait(context.Background(), Message{}))
+
+	// 10 条/秒，前 10 条使用 burst，第 11 条需要等待
+	l = newConsumeLimiter(10, 0)
+	start := time.Now()
+	for i := 0; i < 11; i++ {
+		assert.NoError(t, l.wait(context.Background(), Message{}))
+	}
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	// 超过 burst 的消息分多次获取令牌，ctx 超时返回错误
+	l = newConsumeLimiter(0, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, l.wait(ctx, Message{Value: make([]byte, 100)}))
+}
@@ -0,0 +1,110 @@
+package ekafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/segmentio/kafka-go"
+)
+
+// ReplayHandler 处理回放的消息，返回错误时回放终止
+type ReplayHandler = func(ctx context.Context, msg Message) error
+
+// Replay 按分区依次回放 topic 中 [from, to] 时间范围内的消息
+// 回放使用独立的 reader，不加入消费组、不提交 offset，不影响线上消费组的消费进度
+// 每个分区回放到 to 或者回放开始时的最新 offset 为止
+func (cmp *Component) Replay(ctx context.Context, topic string, from, to time.Time, handler ReplayHandler) error {
+	client := cmp.Client()
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{topic}})
+	if err != nil {
+		return fmt.Errorf("get metadata of topic %s failed: %w", topic, err)
+	}
+	partitions := make([]int, 0)
+	for _, t := range metadata.Topics {
+		if t.Name != topic {
+			continue
+		}
+		if t.Error != nil {
+			return fmt.Errorf("get metadata of topic %s failed: %w", topic, t.Error)
+		}
+		for _, p := range t.Partitions {
+			partitions = append(partitions, p.ID)
+		}
+	}
+	sort.Ints(partitions)
+
+	requests := make([]kafka.OffsetRequest, 0, len(partitions))
+	for _, partition := range partitions {
+		requests = append(requests, kafka.LastOffsetOf(partition))
+	}
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+		Topics: map[string][]kafka.OffsetRequest{topic: requests},
+	})
+	if err != nil {
+		return fmt.Errorf("list offsets of topic %s failed: %w", topic, err)
+	}
+
+	for _, partitionOffsets := range offsets.Topics[topic] {
+		if partitionOffsets.Error != nil {
+			return fmt.Errorf("list offsets of topic %s partition %d failed: %w", topic, partitionOffsets.Partition, partitionOffsets.Error)
+		}
+		if err := cmp.replayPartition(ctx, topic, partitionOffsets.Partition, partitionOffsets.LastOffset, from, to, handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cmp *Component) replayPartition(ctx context.Context, topic string, partition int, endOffset int64, from, to time.Time, handler ReplayHandler) error {
+	if endOffset <= 0 {
+		return nil
+	}
+	mechanism, err := NewMechanism(cmp.config.SASLMechanism, cmp.config.SASLUserName, cmp.config.SASLPassword)
+	if err != nil {
+		return err
+	}
+	readerConfig := kafka.ReaderConfig{
+		Brokers:     cmp.config.Brokers,
+		Topic:       topic,
+		Partition:   partition,
+		MaxWait:     time.Second,
+		Logger:      newKafkaLogger(cmp.logger),
+		ErrorLogger: newKafkaErrorLogger(cmp.logger),
+	}
+	if mechanism != nil {
+		readerConfig.Dialer = &kafka.Dialer{
+			DualStack:     true,
+			SASLMechanism: mechanism,
+		}
+	}
+	reader := kafka.NewReader(readerConfig)
+	defer reader.Close()
+
+	if err := reader.SetOffsetAt(ctx, from); err != nil {
+		return fmt.Errorf("seek topic %s partition %d to %s failed: %w", topic, partition, from, err)
+	}
+	// 没有 from 之后的消息，此时 broker 返回的 offset 为 -1
+	if offset := reader.Offset(); offset < 0 || offset >= endOffset {
+		return nil
+	}
+	cmp.logger.Info("replay partition", elog.String("topic", topic), elog.Int("partition", partition), elog.Int64("endOffset", endOffset))
+
+	for {
+		msg, err := reader.ReadMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("replay topic %s partition %d failed: %w", topic, partition, err)
+		}
+		if msg.Time.After(to) {
+			return nil
+		}
+		if err := handler(ctx, msg); err != nil {
+			return err
+		}
+		if msg.Offset >= endOffset-1 {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package ekafka
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// HeaderRetryAttempt 消息已经被重新投递的次数
+	HeaderRetryAttempt = "ekafka-retry-attempt"
+	// HeaderRetryNotBefore 消息最早可以被处理的时间，unix 毫秒时间戳
+	HeaderRetryNotBefore = "ekafka-retry-not-before"
+	// HeaderOriginalTopic 消息最初所在的 topic
+	HeaderOriginalTopic = "ekafka-original-topic"
+)
+
+// RetryPolicy 分级延迟重试策略
+// 处理失败的消息依次投递到 <topic>.retry.<delay>，重试次数耗尽后投递到死信 topic
+type RetryPolicy struct {
+	// Delays 每一级重试的等待时间，如 [5s, 1m, 10m]
+	Delays []time.Duration
+	// DLQTopic 死信 topic，默认为 <topic>.dlq
+	DLQTopic string
+}
+
+// RetryTopicName 返回指定延迟对应的 retry topic 名称，如 orders.retry.5s
+func RetryTopicName(topic string, delay time.Duration) string {
+	return topic + ".retry." + formatDelay(delay)
+}
+
+// DLQTopicName 返回默认的死信 topic 名称
+func DLQTopicName(topic string) string {
+	return topic + ".dlq"
+}
+
+// RetryTopics 返回该策略下 topic 需要的所有 retry topic
+func (p RetryPolicy) RetryTopics(topic string) []string {
+	topics := make([]string, 0, len(p.Delays))
+	for _, delay := range p.Delays {
+		topics = append(topics, RetryTopicName(topic, delay))
+	}
+	return topics
+}
+
+// Next 根据处理失败的消息生成下一次重新投递的消息
+// 消息的 Topic 为下一级 retry topic，重试次数耗尽时为死信 topic，此时 dlq 返回 true
+func (p RetryPolicy) Next(msg Message, now time.Time) (next *Message, dlq bool) {
+	originalTopic := headerValue(msg, HeaderOriginalTopic)
+	if originalTopic == "" {
+		originalTopic = msg.Topic
+	}
+	attempt := RetryAttempt(msg)
+
+	headers := make([]Header, 0, len(msg.Headers)+3)
+	for _, header := range msg.Headers {
+		switch header.Key {
+		case HeaderRetryAttempt, HeaderRetryNotBefore, HeaderOriginalTopic:
+			continue
+		}
+		headers = append(headers, header)
+	}
+	headers = append(headers,
+		Header{Key: HeaderOriginalTopic, Value: []byte(originalTopic)},
+		Header{Key: HeaderRetryAttempt, Value: []byte(strconv.Itoa(attempt + 1))},
+	)
+
+	next = &Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+	}
+	if attempt >= len(p.Delays) {
+		next.Topic = p.DLQTopic
+		if next.Topic == "" {
+			next.Topic = DLQTopicName(originalTopic)
+		}
+		return next, true
+	}
+
+	delay := p.Delays[attempt]
+	next.Topic = RetryTopicName(originalTopic, delay)
+	next.Headers = append(next.Headers, Header{
+		Key:   HeaderRetryNotBefore,
+		Value: []byte(strconv.FormatInt(now.Add(delay).UnixNano()/int64(time.Millisecond), 10)),
+	})
+	return next, false
+}
+
+// RetryAttempt 返回消息已经被重新投递的次数
+func RetryAttempt(msg Message) int {
+	attempt, _ := strconv.Atoi(headerValue(msg, HeaderRetryAttempt))
+	return attempt
+}
+
+// RetryNotBefore 返回消息最早可以被处理的时间，没有该消息头时返回零值
+func RetryNotBefore(msg Message) time.Time {
+	value := headerValue(msg, HeaderRetryNotBefore)
+	if value == "" {
+		return time.Time{}
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+func formatDelay(delay time.Duration) string {
+	switch {
+	case delay >= time.Hour && delay%time.Hour == 0:
+		return fmt.Sprintf("%dh", delay/time.Hour)
+	case delay >= time.Minute && delay%time.Minute == 0:
+		return fmt.Sprintf("%dm", delay/time.Minute)
+	case delay >= time.Second && delay%time.Second == 0:
+		return fmt.Sprintf("%ds", delay/time.Second)
+	default:
+		return fmt.Sprintf("%dms", delay/time.Millisecond)
+	}
+}
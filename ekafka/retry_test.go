@@ -0,0 +1,38 @@
+package ekafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyNext(t *testing.T) {
+	policy := RetryPolicy{Delays: []time.Duration{5 * time.Second, time.Minute, 10 * time.Minute}}
+	assert.Equal(t, []string{"orders.retry.5s", "orders.retry.1m", "orders.retry.10m"}, policy.RetryTopics("orders"))
+
+	now := time.Unix(1600000000, 0)
+	msg := Message{
+		Topic:   "orders",
+		Key:     []byte("k"),
+		Value:   []byte("v"),
+		Headers: []Header{{Key: "traceparent", Value: []byte("tp")}},
+	}
+	expected := []string{"orders.retry.5s", "orders.retry.1m", "orders.retry.10m"}
+	for i, topic := range expected {
+		next, dlq := policy.Next(msg, now)
+		assert.False(t, dlq)
+		assert.Equal(t, topic, next.Topic)
+		assert.Equal(t, i+1, RetryAttempt(*next))
+		assert.Equal(t, now.Add(policy.Delays[i]), RetryNotBefore(*next))
+		assert.Equal(t, "tp", headerValue(*next, "traceparent"))
+		assert.Equal(t, "orders", headerValue(*next, HeaderOriginalTopic))
+		msg = *next
+	}
+
+	next, dlq := policy.Next(msg, now)
+	assert.True(t, dlq)
+	assert.Equal(t, "orders.dlq", next.Topic)
+	assert.True(t, RetryNotBefore(*next).IsZero())
+	assert.Equal(t, []byte("v"), next.Value)
+}
@@ -0,0 +1,100 @@
+package ekafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego/core/emetric"
+)
+
+// HeaderEventType 常用的事件类型 header
+const HeaderEventType = "event-type"
+
+// ErrRouteNotFound 没有找到 header 值对应的 handler，且没有设置 fallback
+var ErrRouteNotFound = errors.New("ekafka: route not found")
+
+const (
+	routeFallback  = "_fallback"
+	routeUnmatched = "_unmatched"
+)
+
+var (
+	// routeHandleCounter 每个路由的处理次数
+	routeHandleCounter = emetric.CounterVecOpts{
+		Namespace: emetric.DefaultNamespace,
+		Name:      "kafka_route_handle_total",
+		Labels:    []string{"topic", "header", "route", "code"},
+	}.Build()
+
+	// routeHandleHistogram 每个路由的处理耗时
+	routeHandleHistogram = emetric.HistogramVecOpts{
+		Namespace: emetric.DefaultNamespace,
+		Name:      "kafka_route_handle_seconds",
+		Labels:    []string{"topic", "header", "route"},
+	}.Build()
+)
+
+// RouteHandler 路由处理函数，签名与 consumerserver.OnEachMessageHandler 一致
+type RouteHandler = func(ctx context.Context, msg Message) error
+
+// HeaderRouter 根据指定 header 的值将消息分发给注册的 handler，用于一个 topic 中混合了多种事件的场景
+type HeaderRouter struct {
+	header   string
+	mu       sync.RWMutex
+	routes   map[string]RouteHandler
+	fallback RouteHandler
+}
+
+// NewHeaderRouter 返回按 header 分发消息的 HeaderRouter
+func NewHeaderRouter(header string) *HeaderRouter {
+	return &HeaderRouter{
+		header: header,
+		routes: make(map[string]RouteHandler),
+	}
+}
+
+// Handle 注册 header 值为 value 的消息的 handler
+func (r *HeaderRouter) Handle(value string, handler RouteHandler) *HeaderRouter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes[value] = handler
+	return r
+}
+
+// Fallback 设置没有匹配到路由时的 handler，未设置时返回 ErrRouteNotFound
+func (r *HeaderRouter) Fallback(handler RouteHandler) *HeaderRouter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = handler
+	return r
+}
+
+// HandleMessage 分发消息，签名与 consumerserver.OnEachMessageHandler 一致，可直接注册
+func (r *HeaderRouter) HandleMessage(ctx context.Context, msg Message) error {
+	value := headerValue(msg, r.header)
+
+	r.mu.RLock()
+	route, handler := value, r.routes[value]
+	if handler == nil {
+		route, handler = routeFallback, r.fallback
+	}
+	r.mu.RUnlock()
+
+	if handler == nil {
+		routeHandleCounter.Inc(msg.Topic, r.header, routeUnmatched, "Error")
+		return fmt.Errorf("%w, topic: %s, %s: %s", ErrRouteNotFound, msg.Topic, r.header, value)
+	}
+
+	now := time.Now()
+	err := handler(ctx, msg)
+	routeHandleHistogram.Observe(time.Since(now).Seconds(), msg.Topic, r.header, route)
+	if err != nil {
+		routeHandleCounter.Inc(msg.Topic, r.header, route, "Error")
+		return err
+	}
+	routeHandleCounter.Inc(msg.Topic, r.header, route, "OK")
+	return nil
+}
@@ -0,0 +1,39 @@
+package ekafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderRouter(t *testing.T) {
+	var handled []string
+	router := NewHeaderRouter(HeaderEventType).
+		Handle("created", func(ctx context.Context, msg Message) error {
+			handled = append(handled, "created")
+			return nil
+		}).
+		Handle("deleted", func(ctx context.Context, msg Message) error {
+			handled = append(handled, "deleted")
+			return nil
+		})
+
+	newMsg := func(eventType string) Message {
+		return Message{Topic: "orders", Headers: []Header{{Key: HeaderEventType, Value: []byte(eventType)}}}
+	}
+	assert.NoError(t, router.HandleMessage(context.Background(), newMsg("created")))
+	assert.NoError(t, router.HandleMessage(context.Background(), newMsg("deleted")))
+	assert.Equal(t, []string{"created", "deleted"}, handled)
+
+	err := router.HandleMessage(context.Background(), newMsg("updated"))
+	assert.True(t, errors.Is(err, ErrRouteNotFound))
+
+	router.Fallback(func(ctx context.Context, msg Message) error {
+		handled = append(handled, "fallback")
+		return nil
+	})
+	assert.NoError(t, router.HandleMessage(context.Background(), Message{Topic: "orders"}))
+	assert.Equal(t, "fallback", handled[2])
+}
@@ -0,0 +1,42 @@
+package e2e
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego-component/ekafka"
+	"github.com/stretchr/testify/assert"
+)
+
+// 创建 topic、扩容分区、修改配置、删除消息后删除 topic
+func Test_Admin(t *testing.T) {
+	cmp := ekafka.Load("kafka").Build()
+	admin := cmp.Admin()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Minute)
+	defer cancel()
+
+	topic := "ekafka-admin-" + RandomString(8)
+	err := admin.CreateTopics(ctx, ekafka.TopicSpec{
+		Name:              topic,
+		NumPartitions:     1,
+		ReplicationFactor: 1,
+		Configs:           map[string]string{"retention.ms": "3600000"},
+	})
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, admin.DeleteTopics(context.Background(), topic))
+	}()
+
+	assert.NoError(t, admin.CreatePartitions(ctx, topic, 2))
+
+	assert.NoError(t, admin.AlterTopicConfigs(ctx, topic, map[string]string{"retention.ms": "7200000"}))
+	configs, err := admin.DescribeTopicConfigs(ctx, topic, "retention.ms")
+	assert.NoError(t, err)
+	assert.Equal(t, "7200000", configs["retention.ms"])
+
+	lowWatermarks, err := admin.DeleteRecords(ctx, topic, map[int]int64{0: 0})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), lowWatermarks[0])
+}
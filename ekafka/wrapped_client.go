@@ -2,7 +2,10 @@ package ekafka
 
 import (
 	"context"
+	"fmt"
+	"strconv"
 
+	"github.com/gotomicro/ego-component/ekafka/internal/deleterecords"
 	"github.com/segmentio/kafka-go"
 )
 
@@ -91,3 +94,96 @@ func (wc *Client) CreateTopics(ctx context.Context, req *kafka.CreateTopicsReque
 	})(ctx, nil, &cmd{})
 	return
 }
+
+func (wc *Client) DescribeConfigs(ctx context.Context, req *kafka.DescribeConfigsRequest) (res *kafka.DescribeConfigsResponse, err error) {
+	err = wc.processor(func(ctx context.Context, msgs Messages, c *cmd) error {
+		logCmd(wc.logMode, c, "DescribeConfigs")
+		res, err = wc.cc.DescribeConfigs(ctx, req)
+		return err
+	})(ctx, nil, &cmd{})
+	return
+}
+
+// topicMaxMessageBytes 返回 topic 生效的 max.message.bytes
+func (wc *Client) topicMaxMessageBytes(ctx context.Context, topic string) (int64, error) {
+	res, err := wc.DescribeConfigs(ctx, &kafka.DescribeConfigsRequest{
+		Resources: []kafka.DescribeConfigRequestResource{{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: topic,
+			ConfigNames:  []string{"max.message.bytes"},
+		}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, resource := range res.Resources {
+		if resource.Error != nil {
+			return 0, resource.Error
+		}
+		for _, entry := range resource.ConfigEntries {
+			if entry.ConfigName == "max.message.bytes" {
+				return strconv.ParseInt(entry.ConfigValue, 10, 64)
+			}
+		}
+	}
+	return 0, fmt.Errorf("max.message.bytes of topic %s not found", topic)
+}
+
+func (wc *Client) CreatePartitions(ctx context.Context, req *kafka.CreatePartitionsRequest) (res *kafka.CreatePartitionsResponse, err error) {
+	err = wc.processor(func(ctx context.Context, msgs Messages, c *cmd) error {
+		logCmd(wc.logMode, c, "CreatePartitions")
+		res, err = wc.cc.CreatePartitions(ctx, req)
+		return err
+	})(ctx, nil, &cmd{})
+	return
+}
+
+func (wc *Client) AlterConfigs(ctx context.Context, req *kafka.AlterConfigsRequest) (res *kafka.AlterConfigsResponse, err error) {
+	err = wc.processor(func(ctx context.Context, msgs Messages, c *cmd) error {
+		logCmd(wc.logMode, c, "AlterConfigs")
+		res, err = wc.cc.AlterConfigs(ctx, req)
+		return err
+	})(ctx, nil, &cmd{})
+	return
+}
+
+func (wc *Client) DescribeGroups(ctx context.Context, req *kafka.DescribeGroupsRequest) (res *kafka.DescribeGroupsResponse, err error) {
+	err = wc.processor(func(ctx context.Context, msgs Messages, c *cmd) error {
+		logCmd(wc.logMode, c, "DescribeGroups")
+		res, err = wc.cc.DescribeGroups(ctx, req)
+		return err
+	})(ctx, nil, &cmd{})
+	return
+}
+
+func (wc *Client) ListGroups(ctx context.Context, req *kafka.ListGroupsRequest) (res *kafka.ListGroupsResponse, err error) {
+	err = wc.processor(func(ctx context.Context, msgs Messages, c *cmd) error {
+		logCmd(wc.logMode, c, "ListGroups")
+		res, err = wc.cc.ListGroups(ctx, req)
+		return err
+	})(ctx, nil, &cmd{})
+	return
+}
+
+// deleteRecords 删除分区中 offset 之前的消息，kafka-go 没有提供该接口，直接发送 DeleteRecords 请求
+func (wc *Client) deleteRecords(ctx context.Context, req *deleterecords.Request) (res *deleterecords.Response, err error) {
+	err = wc.processor(func(ctx context.Context, msgs Messages, c *cmd) error {
+		logCmd(wc.logMode, c, "DeleteRecords")
+		transport := wc.cc.Transport
+		if transport == nil {
+			transport = kafka.DefaultTransport
+		}
+		if wc.cc.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, wc.cc.Timeout)
+			defer cancel()
+		}
+		m, err := transport.RoundTrip(ctx, wc.cc.Addr, req)
+		if err != nil {
+			return err
+		}
+		res = m.(*deleterecords.Response)
+		return nil
+	})(ctx, nil, &cmd{})
+	return
+}
@@ -0,0 +1,241 @@
+package emongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// DefaultBulkChunkSize 默认每批写入的文档数
+	DefaultBulkChunkSize = 1000
+	// DefaultBulkMaxRetries 默认可重试错误的最大重试次数
+	DefaultBulkMaxRetries = 3
+)
+
+// retryableWriteCodes 可以重试的写入错误码，主节点切换、节点关闭、网络超时等
+var retryableWriteCodes = map[int]bool{
+	6:     true, // HostUnreachable
+	7:     true, // HostNotFound
+	89:    true, // NetworkTimeout
+	91:    true, // ShutdownInProgress
+	189:   true, // PrimarySteppedDown
+	262:   true, // ExceededTimeLimit
+	9001:  true, // SocketException
+	10107: true, // NotWritablePrimary
+	11600: true, // InterruptedAtShutdown
+	11602: true, // InterruptedDueToReplStateChange
+	13435: true, // NotPrimaryNoSecondaryOk
+	13436: true, // NotPrimaryOrSecondary
+}
+
+// UpsertItem BulkUpsert的一个文档，Replacement不为空时替换整个文档，否则使用Update更新
+type UpsertItem struct {
+	Filter      interface{}
+	Update      interface{}
+	Replacement interface{}
+}
+
+// BulkItemError 写入失败的文档
+type BulkItemError struct {
+	Index   int    // 文档在传入的切片中的位置
+	Code    int    // 错误码，非服务端返回的错误时为0
+	Message string // 错误信息
+}
+
+// BulkError 部分文档写入失败
+type BulkError struct {
+	Errors []BulkItemError
+}
+
+// Error 实现error接口
+func (e *BulkError) Error() string {
+	return fmt.Sprintf("emongo: %d documents failed in bulk write, first error at %d: %s", len(e.Errors), e.Errors[0].Index, e.Errors[0].Message)
+}
+
+// BulkResult 批量写入结果
+type BulkResult struct {
+	Matched  int64
+	Modified int64
+	Upserted int64
+	Deleted  int64
+	Errors   []BulkItemError // 写入失败的文档
+}
+
+// BulkOption 设置批量写入
+type BulkOption func(o *bulkOptions)
+
+type bulkOptions struct {
+	chunkSize     int
+	maxRetries    int
+	retryInterval time.Duration
+}
+
+// BulkChunkSize 设置每批写入的文档数，默认1000
+func BulkChunkSize(size int) BulkOption {
+	return func(o *bulkOptions) {
+		o.chunkSize = size
+	}
+}
+
+// BulkMaxRetries 设置可重试错误的最大重试次数，默认3
+func BulkMaxRetries(retries int) BulkOption {
+	return func(o *bulkOptions) {
+		o.maxRetries = retries
+	}
+}
+
+// BulkRetryInterval 设置重试间隔，第n次重试等待n倍的间隔，默认100ms
+func BulkRetryInterval(interval time.Duration) BulkOption {
+	return func(o *bulkOptions) {
+		o.retryInterval = interval
+	}
+}
+
+// BulkUpsert 分批、无序地写入文档，不存在时插入，遇到主节点切换、网络错误等可重试错误时只重试失败的文档。
+// 部分文档失败时返回*BulkError，BulkResult中包含成功写入的数量和失败的文档
+func (wc *Collection) BulkUpsert(ctx context.Context, items []UpsertItem, opts ...BulkOption) (*BulkResult, error) {
+	models := make([]mongo.WriteModel, 0, len(items))
+	for _, item := range items {
+		if item.Replacement != nil {
+			models = append(models, mongo.NewReplaceOneModel().SetFilter(item.Filter).SetReplacement(item.Replacement).SetUpsert(true))
+			continue
+		}
+		models = append(models, mongo.NewUpdateOneModel().SetFilter(item.Filter).SetUpdate(item.Update).SetUpsert(true))
+	}
+	return wc.bulkWrite(ctx, models, opts...)
+}
+
+// BulkDelete 分批、无序地删除每个filter匹配的第一个文档，重试、返回值与BulkUpsert相同，开启软删除时为软删除
+func (wc *Collection) BulkDelete(ctx context.Context, filters []interface{}, opts ...BulkOption) (*BulkResult, error) {
+	models := make([]mongo.WriteModel, 0, len(filters))
+	for _, filter := range filters {
+		models = append(models, mongo.NewDeleteOneModel().SetFilter(filter))
+	}
+	result, err := wc.bulkWrite(ctx, models, opts...)
+	if result != nil && wc.softDeleting(ctx) {
+		// 软删除为更新，更新的数量即为删除的数量
+		result.Deleted, result.Matched, result.Modified = result.Modified, 0, 0
+	}
+	return result, err
+}
+
+func (wc *Collection) bulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...BulkOption) (*BulkResult, error) {
+	o := &bulkOptions{
+		chunkSize:     DefaultBulkChunkSize,
+		maxRetries:    DefaultBulkMaxRetries,
+		retryInterval: 100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.chunkSize <= 0 {
+		o.chunkSize = DefaultBulkChunkSize
+	}
+
+	result := &BulkResult{}
+	for start := 0; start < len(models); start += o.chunkSize {
+		end := start + o.chunkSize
+		if end > len(models) {
+			end = len(models)
+		}
+		indexes := make([]int, 0, end-start)
+		for i := start; i < end; i++ {
+			indexes = append(indexes, i)
+		}
+		wc.writeChunk(ctx, models, indexes, o, result)
+	}
+	if len(result.Errors) > 0 {
+		return result, &BulkError{Errors: result.Errors}
+	}
+	return result, nil
+}
+
+// writeChunk 写入一批文档，只重试可重试错误的文档
+func (wc *Collection) writeChunk(ctx context.Context, models []mongo.WriteModel, indexes []int, o *bulkOptions, result *BulkResult) {
+	for attempt := 0; ; attempt++ {
+		chunk := make([]mongo.WriteModel, 0, len(indexes))
+		for _, i := range indexes {
+			chunk = append(chunk, models[i])
+		}
+		res, err := wc.BulkWrite(ctx, chunk, options.BulkWrite().SetOrdered(false))
+		if res != nil {
+			result.Matched += res.MatchedCount
+			result.Modified += res.ModifiedCount
+			result.Upserted += res.UpsertedCount
+			result.Deleted += res.DeletedCount
+		}
+		if err == nil {
+			return
+		}
+
+		retry, failed := splitBulkErrors(err, indexes)
+		if len(retry) == 0 || attempt >= o.maxRetries || ctx.Err() != nil {
+			result.Errors = append(result.Errors, failed...)
+			result.Errors = append(result.Errors, retry...)
+			return
+		}
+		result.Errors = append(result.Errors, failed...)
+		indexes = indexes[:0:0]
+		for _, e := range retry {
+			indexes = append(indexes, e.Index)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(o.retryInterval * time.Duration(attempt+1)):
+		}
+	}
+}
+
+// splitBulkErrors 将写入错误分为可重试和不可重试的文档，Index转换为传入切片中的位置。
+// 同时有文档写入错误和write concern错误时都返回，没有写入错误的文档使用write concern错误
+func splitBulkErrors(err error, indexes []int) (retry []BulkItemError, failed []BulkItemError) {
+	var bwe mongo.BulkWriteException
+	if errors.As(err, &bwe) && (len(bwe.WriteErrors) > 0 || bwe.WriteConcernError != nil) {
+		written := make(map[int]bool, len(bwe.WriteErrors))
+		for _, we := range bwe.WriteErrors {
+			written[we.Index] = true
+			item := BulkItemError{Index: indexes[we.Index], Code: we.Code, Message: we.Message}
+			if retryableWriteCodes[we.Code] {
+				retry = append(retry, item)
+				continue
+			}
+			failed = append(failed, item)
+		}
+		if wce := bwe.WriteConcernError; wce != nil {
+			for i, index := range indexes {
+				if written[i] {
+					continue
+				}
+				item := BulkItemError{Index: index, Code: wce.Code, Message: "write concern error: " + wce.Message}
+				if retryableWriteCodes[wce.Code] || bwe.HasErrorLabel("RetryableWriteError") {
+					retry = append(retry, item)
+					continue
+				}
+				failed = append(failed, item)
+			}
+		}
+		return retry, failed
+	}
+
+	// 整批失败，如网络错误
+	code := 0
+	var ce mongo.CommandError
+	if errors.As(err, &ce) {
+		code = int(ce.Code)
+	}
+	retryable := mongo.IsNetworkError(err) || hasErrorLabel(err, "RetryableWriteError") || retryableWriteCodes[code]
+	for _, i := range indexes {
+		item := BulkItemError{Index: i, Code: code, Message: err.Error()}
+		if retryable {
+			retry = append(retry, item)
+			continue
+		}
+		failed = append(failed, item)
+	}
+	return retry, failed
+}
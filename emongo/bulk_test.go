@@ -0,0 +1,58 @@
+package emongo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestSplitBulkErrors(t *testing.T) {
+	indexes := []int{10, 11, 12}
+	err := mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+		{WriteError: mongo.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}},
+		{WriteError: mongo.WriteError{Index: 2, Code: 189, Message: "primary stepped down"}},
+	}}
+	retry, failed := splitBulkErrors(err, indexes)
+	assert.Equal(t, []BulkItemError{{Index: 12, Code: 189, Message: "primary stepped down"}}, retry)
+	assert.Equal(t, []BulkItemError{{Index: 10, Code: 11000, Message: "duplicate key"}}, failed)
+
+	// 同时返回文档写入错误和write concern错误
+	err = mongo.BulkWriteException{
+		WriteErrors:       []mongo.BulkWriteError{{WriteError: mongo.WriteError{Index: 1, Code: 11000, Message: "duplicate key"}}},
+		WriteConcernError: &mongo.WriteConcernError{Code: 64, Message: "waiting for replication timed out"},
+	}
+	retry, failed = splitBulkErrors(err, indexes)
+	assert.Empty(t, retry)
+	assert.Equal(t, []BulkItemError{
+		{Index: 11, Code: 11000, Message: "duplicate key"},
+		{Index: 10, Code: 64, Message: "write concern error: waiting for replication timed out"},
+		{Index: 12, Code: 64, Message: "write concern error: waiting for replication timed out"},
+	}, failed)
+
+	// 只有write concern错误，可重试的错误码重试整批
+	err = mongo.BulkWriteException{WriteConcernError: &mongo.WriteConcernError{Code: 91, Message: "shutdown in progress"}}
+	retry, failed = splitBulkErrors(err, indexes[:2])
+	assert.Empty(t, failed)
+	assert.Equal(t, []BulkItemError{
+		{Index: 10, Code: 91, Message: "write concern error: shutdown in progress"},
+		{Index: 11, Code: 91, Message: "write concern error: shutdown in progress"},
+	}, retry)
+
+	err2 := fmt.Errorf("write fail, %w", mongo.CommandError{Code: 10107, Message: "not primary"})
+	retry, failed = splitBulkErrors(err2, indexes[:2])
+	assert.Len(t, retry, 2)
+	assert.Empty(t, failed)
+	assert.Equal(t, 11, retry[1].Index)
+
+	retry, failed = splitBulkErrors(errors.New("invalid document"), indexes[:1])
+	assert.Empty(t, retry)
+	assert.Equal(t, []BulkItemError{{Index: 10, Message: "invalid document"}}, failed)
+}
+
+func TestBulkError(t *testing.T) {
+	err := &BulkError{Errors: []BulkItemError{{Index: 3, Code: 11000, Message: "duplicate key"}, {Index: 5}}}
+	assert.Equal(t, "emongo: 2 documents failed in bulk write, first error at 3: duplicate key", err.Error())
+}
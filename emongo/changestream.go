@@ -0,0 +1,343 @@
+package emongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// errCodeChangeStreamHistoryLost resume token对应的oplog已经被覆盖
+const errCodeChangeStreamHistoryLost = 286
+
+// ErrChangeStreamHistoryLost resume token对应的oplog已经被覆盖，无法从上一次的位置继续消费
+var ErrChangeStreamHistoryLost = errors.New("emongo: change stream history lost")
+
+// ChangeEvent change stream事件
+type ChangeEvent struct {
+	ID                bson.Raw            `bson:"_id"`
+	OperationType     string              `bson:"operationType"` // insert、update、replace、delete等
+	ClusterTime       primitive.Timestamp `bson:"clusterTime"`
+	Namespace         ChangeNamespace     `bson:"ns"`
+	DocumentKey       bson.Raw            `bson:"documentKey"`
+	FullDocument      bson.Raw            `bson:"fullDocument"`      // insert、replace时为完整文档，update时需要开启FullDocument
+	UpdateDescription bson.Raw            `bson:"updateDescription"` // update时更新、删除的字段
+}
+
+// ChangeNamespace 事件所在的库、集合
+type ChangeNamespace struct {
+	DB   string `bson:"db"`
+	Coll string `bson:"coll"`
+}
+
+// ChangeHandler 处理change stream事件，返回错误时间隔retryInterval重试，超过最大次数后交给DeadLetterHandler
+type ChangeHandler func(ctx context.Context, event *ChangeEvent) error
+
+// DeadLetterHandler 处理重试maxAttempts次仍然失败的事件，err为最后一次处理的错误，
+// 返回nil后保存resume token继续消费，返回错误时不保存resume token，重新连接后再次处理该事件
+type DeadLetterHandler func(ctx context.Context, event *ChangeEvent, err error) error
+
+// DeadLetter 写入死信集合的文档
+type DeadLetter struct {
+	Watcher   string      `bson:"watcher"`
+	Event     ChangeEvent `bson:"event"`
+	Error     string      `bson:"error"`
+	CreatedAt time.Time   `bson:"createdAt"`
+}
+
+// NewCollectionDeadLetter 将处理失败的事件写入死信集合，修复后可以从集合中读取事件重新处理
+func NewCollectionDeadLetter(name string, coll *Collection) DeadLetterHandler {
+	return func(ctx context.Context, event *ChangeEvent, err error) error {
+		_, insertErr := coll.InsertOne(ctx, DeadLetter{Watcher: name, Event: *event, Error: err.Error(), CreatedAt: time.Now()})
+		return insertErr
+	}
+}
+
+// HistoryLostHandler resume token对应的oplog已经被覆盖时调用，token为失效的resume token，
+// 返回重新开始消费的集群时间，返回nil时从最新的位置消费，返回错误时Watch退出并返回该错误
+type HistoryLostHandler func(ctx context.Context, token bson.Raw) (*primitive.Timestamp, error)
+
+// ResumeTokenStore 保存change stream的resume token
+type ResumeTokenStore interface {
+	// LoadResumeToken 读取resume token，没有时返回nil
+	LoadResumeToken(ctx context.Context, key string) (bson.Raw, error)
+	// SaveResumeToken 保存resume token
+	SaveResumeToken(ctx context.Context, key string, token bson.Raw) error
+}
+
+// KVStore 键值存储，*eredis.Component 实现了该接口
+type KVStore interface {
+	Exists(ctx context.Context, key string) (bool, error)
+	GetBytes(ctx context.Context, key string) ([]byte, error)
+	Set(ctx context.Context, key string, value interface{}, expire time.Duration) error
+}
+
+// NewKVResumeTokenStore 使用键值存储（如eredis）保存resume token
+func NewKVResumeTokenStore(kv KVStore) ResumeTokenStore {
+	return &kvResumeTokenStore{kv: kv}
+}
+
+type kvResumeTokenStore struct {
+	kv KVStore
+}
+
+func (s *kvResumeTokenStore) LoadResumeToken(ctx context.Context, key string) (bson.Raw, error) {
+	exists, err := s.kv.Exists(ctx, key)
+	if err != nil || !exists {
+		return nil, err
+	}
+	token, err := s.kv.GetBytes(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return bson.Raw(token), nil
+}
+
+func (s *kvResumeTokenStore) SaveResumeToken(ctx context.Context, key string, token bson.Raw) error {
+	return s.kv.Set(ctx, key, []byte(token), 0)
+}
+
+// NewMemoryResumeTokenStore 在内存中保存resume token，进程重启后从最新的位置消费，适用于测试
+func NewMemoryResumeTokenStore() ResumeTokenStore {
+	return &memoryResumeTokenStore{tokens: make(map[string]bson.Raw)}
+}
+
+type memoryResumeTokenStore struct {
+	mu     sync.RWMutex
+	tokens map[string]bson.Raw
+}
+
+func (s *memoryResumeTokenStore) LoadResumeToken(ctx context.Context, key string) (bson.Raw, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tokens[key], nil
+}
+
+func (s *memoryResumeTokenStore) SaveResumeToken(ctx context.Context, key string, token bson.Raw) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[key] = token
+	return nil
+}
+
+// WatcherOption 设置ChangeStreamWatcher
+type WatcherOption func(w *ChangeStreamWatcher)
+
+// WithWatchPipeline 设置过滤事件的pipeline，如只消费insert事件：
+//
+//	mongo.Pipeline{{{"$match", bson.D{{"operationType", "insert"}}}}}
+func WithWatchPipeline(pipeline mongo.Pipeline) WatcherOption {
+	return func(w *ChangeStreamWatcher) {
+		w.pipeline = pipeline
+	}
+}
+
+// WithResumeTokenStore 设置resume token的存储，不设置时进程重启后从最新的位置消费
+func WithResumeTokenStore(store ResumeTokenStore) WatcherOption {
+	return func(w *ChangeStreamWatcher) {
+		w.store = store
+	}
+}
+
+// WithFullDocument 设置update事件是否返回完整文档，如options.UpdateLookup
+func WithFullDocument(fullDocument options.FullDocument) WatcherOption {
+	return func(w *ChangeStreamWatcher) {
+		w.fullDocument = fullDocument
+	}
+}
+
+// WithRetryInterval 设置断开后重新连接、处理事件失败后重试的间隔，默认1s
+func WithRetryInterval(interval time.Duration) WatcherOption {
+	return func(w *ChangeStreamWatcher) {
+		w.retryInterval = interval
+	}
+}
+
+// WithMaxAttempts 设置每个事件最多处理的次数，默认3，小于等于0时一直重试直到成功
+func WithMaxAttempts(attempts int) WatcherOption {
+	return func(w *ChangeStreamWatcher) {
+		w.maxAttempts = attempts
+	}
+}
+
+// WithDeadLetter 设置超过最大处理次数的事件的处理函数，不设置时记录ERROR日志后跳过该事件
+func WithDeadLetter(deadLetter DeadLetterHandler) WatcherOption {
+	return func(w *ChangeStreamWatcher) {
+		w.deadLetter = deadLetter
+	}
+}
+
+// WithHistoryLostHandler 设置resume token失效（oplog已经被覆盖）时的处理函数，不设置时Watch返回ErrChangeStreamHistoryLost
+func WithHistoryLostHandler(handler HistoryLostHandler) WatcherOption {
+	return func(w *ChangeStreamWatcher) {
+		w.historyLostHandler = handler
+	}
+}
+
+// ChangeStreamWatcher 消费集合的change stream，保存消费位置，断开后自动从上一次的位置继续消费
+type ChangeStreamWatcher struct {
+	name          string
+	coll          *Collection
+	handler       ChangeHandler
+	pipeline      mongo.Pipeline
+	store         ResumeTokenStore
+	fullDocument  options.FullDocument
+	retryInterval time.Duration
+	maxAttempts   int
+	deadLetter    DeadLetterHandler
+	token         bson.Raw
+	logger        *elog.Component
+
+	historyLostHandler HistoryLostHandler
+	startAt            *primitive.Timestamp // resume token失效后重新开始消费的位置
+}
+
+// NewChangeStreamWatcher 创建ChangeStreamWatcher，name为resume token的存储key，同一个消费者需要保持不变
+func (c *Component) NewChangeStreamWatcher(name string, coll *Collection, handler ChangeHandler, opts ...WatcherOption) *ChangeStreamWatcher {
+	w := &ChangeStreamWatcher{
+		name:          name,
+		coll:          coll,
+		handler:       handler,
+		pipeline:      mongo.Pipeline{},
+		retryInterval: time.Second,
+		maxAttempts:   3,
+		logger:        c.logger.With(elog.String("watcher", name)),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	return w
+}
+
+// Watch 开始消费，阻塞直到ctx结束，resume token失效并且没有设置HistoryLostHandler时返回ErrChangeStreamHistoryLost
+func (w *ChangeStreamWatcher) Watch(ctx context.Context) error {
+	if w.store != nil {
+		token, err := w.store.LoadResumeToken(ctx, w.name)
+		if err != nil {
+			return fmt.Errorf("emongo: load resume token fail, %w", err)
+		}
+		w.token = token
+	}
+
+	for {
+		err := w.watch(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if isHistoryLost(err) {
+			if err := w.historyLost(ctx, err); err != nil {
+				return err
+			}
+			continue
+		}
+		w.logger.Error("change stream interrupted", elog.FieldErr(err))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(w.retryInterval):
+		}
+	}
+}
+
+// historyLost 清除失效的resume token，没有设置HistoryLostHandler时返回错误，否则从其返回的位置重新消费
+func (w *ChangeStreamWatcher) historyLost(ctx context.Context, err error) error {
+	token := w.token
+	w.token = nil
+	w.logger.Error("change stream history lost, resume token cleared", elog.FieldErr(err), elog.String("token", token.String()))
+	if w.historyLostHandler == nil {
+		return fmt.Errorf("%w, %v", ErrChangeStreamHistoryLost, err)
+	}
+	startAt, err := w.historyLostHandler(ctx, token)
+	if err != nil {
+		return err
+	}
+	w.startAt = startAt
+	return nil
+}
+
+// isHistoryLost 是否为resume token对应的oplog已经被覆盖的错误
+func isHistoryLost(err error) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) && se.HasErrorCode(errCodeChangeStreamHistoryLost)
+}
+
+// changeStreamOptions 有resume token时从token之后继续消费，否则从startAt开始，都没有时从最新的位置开始
+func (w *ChangeStreamWatcher) changeStreamOptions() *options.ChangeStreamOptions {
+	opts := options.ChangeStream()
+	if w.fullDocument != "" {
+		opts.SetFullDocument(w.fullDocument)
+	}
+	if w.token != nil {
+		opts.SetResumeAfter(w.token)
+	} else if w.startAt != nil {
+		opts.SetStartAtOperationTime(w.startAt)
+	}
+	return opts
+}
+
+func (w *ChangeStreamWatcher) watch(ctx context.Context) error {
+	cs, err := w.coll.Watch(ctx, w.pipeline, w.changeStreamOptions())
+	if err != nil {
+		return err
+	}
+	defer cs.Close(context.Background())
+
+	for cs.Next(ctx) {
+		var event ChangeEvent
+		if err := cs.Decode(&event); err != nil {
+			return err
+		}
+		if err := w.handle(ctx, &event); err != nil {
+			return err
+		}
+		w.saveToken(ctx, cs.ResumeToken())
+	}
+	return cs.Err()
+}
+
+// handle 处理事件，失败时间隔retryInterval重试，处理maxAttempts次仍然失败时交给deadLetter，避免一个无法处理的事件阻塞消费
+func (w *ChangeStreamWatcher) handle(ctx context.Context, event *ChangeEvent) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = w.handler(ctx, event); err == nil {
+			return nil
+		}
+		if w.maxAttempts > 0 && attempt >= w.maxAttempts {
+			break
+		}
+		w.logger.Warn("handle change event fail, retry", elog.FieldErr(err), elog.String("operationType", event.OperationType), elog.Int("attempt", attempt))
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(w.retryInterval):
+		}
+	}
+
+	if w.deadLetter == nil {
+		w.logger.Error("handle change event fail, skip", elog.FieldErr(err), elog.String("operationType", event.OperationType), elog.String("documentKey", event.DocumentKey.String()))
+		return nil
+	}
+	if dlqErr := w.deadLetter(ctx, event, err); dlqErr != nil {
+		return fmt.Errorf("dead letter %s event fail, %w", event.OperationType, dlqErr)
+	}
+	w.logger.Warn("handle change event fail, sent to dead letter", elog.FieldErr(err), elog.String("operationType", event.OperationType))
+	return nil
+}
+
+// saveToken 保存resume token，保存失败时只记录日志，重新连接时使用内存中的token
+func (w *ChangeStreamWatcher) saveToken(ctx context.Context, token bson.Raw) {
+	w.token = token
+	if w.store == nil {
+		return
+	}
+	if err := w.store.SaveResumeToken(ctx, w.name, token); err != nil {
+		w.logger.Warn("save resume token fail", elog.FieldErr(err))
+	}
+}
@@ -0,0 +1,167 @@
+package emongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type memoryKV map[string][]byte
+
+func (kv memoryKV) Exists(ctx context.Context, key string) (bool, error) {
+	_, ok := kv[key]
+	return ok, nil
+}
+
+func (kv memoryKV) GetBytes(ctx context.Context, key string) ([]byte, error) {
+	value, ok := kv[key]
+	if !ok {
+		return nil, errors.New("redis: nil")
+	}
+	return value, nil
+}
+
+func (kv memoryKV) Set(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	kv[key] = value.([]byte)
+	return nil
+}
+
+func TestResumeTokenStore(t *testing.T) {
+	ctx := context.Background()
+	token, err := bson.Marshal(bson.M{"_data": "8262"})
+	assert.NoError(t, err)
+
+	for _, store := range []ResumeTokenStore{NewKVResumeTokenStore(memoryKV{}), NewMemoryResumeTokenStore()} {
+		got, err := store.LoadResumeToken(ctx, "orders")
+		assert.NoError(t, err)
+		assert.Nil(t, got)
+
+		assert.NoError(t, store.SaveResumeToken(ctx, "orders", token))
+		got, err = store.LoadResumeToken(ctx, "orders")
+		assert.NoError(t, err)
+		assert.Equal(t, bson.Raw(token), got)
+	}
+}
+
+func TestChangeStreamWatcherHandle(t *testing.T) {
+	ctx := context.Background()
+	errPoison := errors.New("poison")
+	newWatcher := func(handler ChangeHandler, opts ...WatcherOption) *ChangeStreamWatcher {
+		w := &ChangeStreamWatcher{name: "orders", handler: handler, retryInterval: time.Millisecond, maxAttempts: 3, logger: elog.DefaultLogger}
+		for _, opt := range opts {
+			opt(w)
+		}
+		return w
+	}
+	event := &ChangeEvent{OperationType: "insert"}
+
+	// 重试后成功
+	attempts := 0
+	w := newWatcher(func(ctx context.Context, event *ChangeEvent) error {
+		attempts++
+		if attempts < 2 {
+			return errPoison
+		}
+		return nil
+	})
+	assert.NoError(t, w.handle(ctx, event))
+	assert.Equal(t, 2, attempts)
+
+	// 超过最大次数后交给死信处理
+	attempts = 0
+	var dead *ChangeEvent
+	var deadErr error
+	w = newWatcher(func(ctx context.Context, event *ChangeEvent) error {
+		attempts++
+		return errPoison
+	}, WithDeadLetter(func(ctx context.Context, event *ChangeEvent, err error) error {
+		dead, deadErr = event, err
+		return nil
+	}))
+	assert.NoError(t, w.handle(ctx, event))
+	assert.Equal(t, 3, attempts)
+	assert.Same(t, event, dead)
+	assert.Equal(t, errPoison, deadErr)
+
+	// 死信处理失败时返回错误，不保存resume token
+	w = newWatcher(func(ctx context.Context, event *ChangeEvent) error {
+		return errPoison
+	}, WithMaxAttempts(1), WithDeadLetter(func(ctx context.Context, event *ChangeEvent, err error) error {
+		return errors.New("dlq unavailable")
+	}))
+	assert.Error(t, w.handle(ctx, event))
+
+	// 没有设置死信处理时跳过
+	attempts = 0
+	w = newWatcher(func(ctx context.Context, event *ChangeEvent) error {
+		attempts++
+		return errPoison
+	}, WithMaxAttempts(2))
+	assert.NoError(t, w.handle(ctx, event))
+	assert.Equal(t, 2, attempts)
+
+	// 一直重试时ctx结束后返回
+	cancelCtx, cancel := context.WithCancel(ctx)
+	w = newWatcher(func(ctx context.Context, event *ChangeEvent) error {
+		cancel()
+		return errPoison
+	}, WithMaxAttempts(0))
+	assert.ErrorIs(t, w.handle(cancelCtx, event), context.Canceled)
+}
+
+func TestChangeStreamWatcherHistoryLost(t *testing.T) {
+	ctx := context.Background()
+	token, err := bson.Marshal(bson.M{"_data": "8262"})
+	assert.NoError(t, err)
+	errLost := fmt.Errorf("watch fail, %w", mongo.CommandError{Code: 286, Name: "ChangeStreamHistoryLost"})
+	assert.True(t, isHistoryLost(errLost))
+	assert.False(t, isHistoryLost(mongo.CommandError{Code: 11600}))
+	assert.False(t, isHistoryLost(errors.New("network")))
+
+	// 没有设置处理函数时清除token并返回错误
+	w := &ChangeStreamWatcher{name: "orders", token: token, logger: elog.DefaultLogger}
+	assert.ErrorIs(t, w.historyLost(ctx, errLost), ErrChangeStreamHistoryLost)
+	assert.Nil(t, w.token)
+
+	// 从处理函数返回的位置重新消费
+	startAt := &primitive.Timestamp{T: 1650000000}
+	var lostToken bson.Raw
+	w = &ChangeStreamWatcher{name: "orders", token: token, logger: elog.DefaultLogger}
+	WithHistoryLostHandler(func(ctx context.Context, token bson.Raw) (*primitive.Timestamp, error) {
+		lostToken = token
+		return startAt, nil
+	})(w)
+	assert.NoError(t, w.historyLost(ctx, errLost))
+	assert.Equal(t, bson.Raw(token), lostToken)
+	opts := w.changeStreamOptions()
+	assert.Nil(t, opts.ResumeAfter)
+	assert.Equal(t, startAt, opts.StartAtOperationTime)
+
+	// 收到新的事件后从新的token继续消费
+	w.saveToken(ctx, token)
+	opts = w.changeStreamOptions()
+	assert.Equal(t, bson.Raw(token), opts.ResumeAfter)
+	assert.Nil(t, opts.StartAtOperationTime)
+
+	// 处理函数返回nil时从最新的位置消费，返回错误时Watch退出
+	w = &ChangeStreamWatcher{name: "orders", token: token, logger: elog.DefaultLogger, historyLostHandler: func(ctx context.Context, token bson.Raw) (*primitive.Timestamp, error) {
+		return nil, nil
+	}}
+	assert.NoError(t, w.historyLost(ctx, errLost))
+	opts = w.changeStreamOptions()
+	assert.Nil(t, opts.ResumeAfter)
+	assert.Nil(t, opts.StartAtOperationTime)
+	errStop := errors.New("stop")
+	w.historyLostHandler = func(ctx context.Context, token bson.Raw) (*primitive.Timestamp, error) {
+		return nil, errStop
+	}
+	assert.Equal(t, errStop, w.historyLost(ctx, errLost))
+}
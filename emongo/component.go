@@ -2,15 +2,18 @@ package emongo
 
 import (
 	"github.com/gotomicro/ego/core/elog"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const PackageName = "component.emongo"
 
 // Component client (cmdable and config)
 type Component struct {
-	config *config
-	client *Client
-	logger *elog.Component
+	name    string
+	config  *config
+	client  *Client
+	logger  *elog.Component
+	txnOpts *options.TransactionOptions
 }
 
 // Client returns emongo Client
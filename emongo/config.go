@@ -4,6 +4,8 @@ import (
 	"time"
 
 	"github.com/gotomicro/ego/core/util/xtime"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
 )
 
 type config struct {
@@ -25,17 +27,83 @@ type config struct {
 	EnableAccessInterceptor bool `json:"enableAccessInterceptor" toml:"enableAccessInterceptor"`
 	// EnableTraceInterceptor 是否启用trace拦截器
 	EnableTraceInterceptor bool `json:"enableTraceInterceptor" toml:"enableTraceInterceptor"`
-	// SlowLogThreshold 慢日志门限值，超过该门限值的请求，将被记录到慢日志中
-	SlowLogThreshold time.Duration
-	interceptors     []Interceptor
+	// SlowLogThreshold 慢日志门限值，超过该门限值的命令，将被记录到慢日志中，默认0不记录
+	SlowLogThreshold time.Duration `json:"slowLogThreshold" toml:"slowLogThreshold"`
+	// ExplainSampleRate 慢查询执行explain的采样率，取值0~1，默认0不执行，执行后慢日志中记录执行计划
+	ExplainSampleRate float64 `json:"explainSampleRate" toml:"explainSampleRate"`
+	// TransactionReadConcern WithTransaction的read concern，可选local、majority、snapshot等，默认使用客户端的配置
+	TransactionReadConcern string `json:"transactionReadConcern" toml:"transactionReadConcern"`
+	// TransactionWriteConcern WithTransaction的write concern，可选majority或者确认写入的节点数量，默认使用客户端的配置
+	TransactionWriteConcern string `json:"transactionWriteConcern" toml:"transactionWriteConcern"`
+	// TransactionMaxRetries WithTransaction遇到TransientTransactionError、UnknownTransactionCommitResult时的最大重试次数，默认3
+	TransactionMaxRetries int `json:"transactionMaxRetries" toml:"transactionMaxRetries"`
+	// RetryReads 是否开启驱动的读重试，默认开启，可重试的读操作失败后驱动自动重试一次
+	RetryReads bool `json:"retryReads" toml:"retryReads"`
+	// RetryWrites 是否开启驱动的写重试，默认开启，可重试的写操作失败后驱动自动重试一次
+	RetryWrites bool `json:"retryWrites" toml:"retryWrites"`
+	// RetryMaxAttempts Component.Retry遇到可重试错误时的最大重试次数，默认3
+	RetryMaxAttempts int `json:"retryMaxAttempts" toml:"retryMaxAttempts"`
+	// RetryInterval Component.Retry第一次重试前的等待时间，之后按指数增长，默认100ms
+	RetryInterval time.Duration `json:"retryInterval" toml:"retryInterval"`
+	// RetryMaxInterval Component.Retry重试前的最大等待时间，默认2s
+	RetryMaxInterval time.Duration `json:"retryMaxInterval" toml:"retryMaxInterval"`
+	// GridFSChunkSize GridFS的分块大小，默认255KB
+	GridFSChunkSize int32 `json:"gridfsChunkSize" toml:"gridfsChunkSize"`
+	// IndexDryRun 启动时只检查WithIndexes声明的索引，不创建缺少的索引
+	IndexDryRun bool `json:"indexDryRun" toml:"indexDryRun"`
+	// ValidatorDryRun 启动时只检查WithValidator声明的校验规则，不创建、不更新
+	ValidatorDryRun bool `json:"validatorDryRun" toml:"validatorDryRun"`
+	// SoftDeleteCollections 开启软删除的集合，格式为 库名.集合名，删除时设置SoftDeleteField为当前时间，查询时过滤已删除的文档
+	SoftDeleteCollections []string `json:"softDeleteCollections" toml:"softDeleteCollections"`
+	// SoftDeleteField 软删除字段，默认deleted_at
+	SoftDeleteField string `json:"softDeleteField" toml:"softDeleteField"`
+	// VersionCollections 开启乐观锁的集合，格式为 库名.集合名，ReplaceOne、UpdateOne时校验并递增VersionField
+	VersionCollections []string `json:"versionCollections" toml:"versionCollections"`
+	// VersionField 乐观锁的版本号字段，默认version
+	VersionField string `json:"versionField" toml:"versionField"`
+	// TLS TLS连接配置，mongodb+srv的DSN默认开启TLS，配置CAFile等证书时需要Enable=true或者DSN中指定tls=true
+	TLS TLSConfig `json:"tls" toml:"tls"`
+	// Compressors 网络传输压缩算法，可选snappy、zlib、zstd，按顺序与服务端协商
+	Compressors []string `json:"compressors" toml:"compressors"`
+	// ServerAPIVersion Stable API版本，Atlas Serverless等集群需要配置为1，默认不指定
+	ServerAPIVersion string `json:"serverAPIVersion" toml:"serverAPIVersion"`
+	// ServerAPIStrict 开启Stable API的strict模式，使用不在Stable API中的命令时报错
+	ServerAPIStrict bool `json:"serverAPIStrict" toml:"serverAPIStrict"`
+	interceptors    []Interceptor
+	indexes         []CollectionIndexes
+	validators      []CollectionValidator
+	client          *mongo.Client
+}
+
+// TLSConfig TLS连接配置
+type TLSConfig struct {
+	// Enable 是否开启TLS
+	Enable bool `json:"enable" toml:"enable"`
+	// CAFile CA证书文件，为空时使用系统根证书
+	CAFile string `json:"caFile" toml:"caFile"`
+	// CertFile 客户端证书文件，用于X.509认证，可以是证书和私钥合并的PEM文件
+	CertFile string `json:"certFile" toml:"certFile"`
+	// KeyFile 客户端私钥文件，为空时从CertFile中读取
+	KeyFile string `json:"keyFile" toml:"keyFile"`
+	// InsecureSkipVerify 是否跳过服务端证书校验，仅用于测试环境
+	InsecureSkipVerify bool `json:"insecureSkipVerify" toml:"insecureSkipVerify"`
 }
 
 // DefaultConfig 返回默认配置
 func DefaultConfig() *config {
 	return &config{
-		DSN:           "",
-		Debug:         true,
-		SocketTimeout: xtime.Duration("300s"),
-		PoolLimit:     100,
+		DSN:                   "",
+		Debug:                 true,
+		SocketTimeout:         xtime.Duration("300s"),
+		PoolLimit:             100,
+		TransactionMaxRetries: 3,
+		RetryReads:            true,
+		RetryWrites:           true,
+		RetryMaxAttempts:      3,
+		RetryInterval:         xtime.Duration("100ms"),
+		RetryMaxInterval:      xtime.Duration("2s"),
+		GridFSChunkSize:       gridfs.DefaultChunkSize,
+		SoftDeleteField:       "deleted_at",
+		VersionField:          "version",
 	}
 }
@@ -0,0 +1,79 @@
+package emongo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// supportedCompressors 驱动支持的压缩算法
+var supportedCompressors = map[string]bool{"snappy": true, "zlib": true, "zstd": true}
+
+// applyConnectionOptions 在DSN之后应用TLS、压缩、Stable API配置
+// mongodb+srv的DSN默认开启TLS，ApplyURI会覆盖之前设置的TLSConfig，所以需要在ApplyURI之后调用
+func applyConnectionOptions(clientOpts *options.ClientOptions, config *config) error {
+	if config.TLS.Enable || config.TLS.CAFile != "" || config.TLS.CertFile != "" || config.TLS.InsecureSkipVerify {
+		tlsConfig, err := newTLSConfig(config.TLS, clientOpts.TLSConfig)
+		if err != nil {
+			return err
+		}
+		clientOpts.SetTLSConfig(tlsConfig)
+	}
+
+	if len(config.Compressors) > 0 {
+		for _, compressor := range config.Compressors {
+			if !supportedCompressors[compressor] {
+				return fmt.Errorf("unsupported compressor %q", compressor)
+			}
+		}
+		clientOpts.SetCompressors(config.Compressors)
+	}
+
+	if config.ServerAPIVersion != "" {
+		version := options.ServerAPIVersion(config.ServerAPIVersion)
+		if err := version.Validate(); err != nil {
+			return err
+		}
+		clientOpts.SetServerAPIOptions(options.ServerAPI(version).SetStrict(config.ServerAPIStrict))
+	}
+	return nil
+}
+
+// newTLSConfig 根据配置构建tls.Config，base为DSN中解析出的TLS配置，配置文件中的证书优先
+func newTLSConfig(conf TLSConfig, base *tls.Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if base != nil {
+		tlsConfig = base.Clone()
+	}
+	if conf.InsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	if conf.CAFile != "" {
+		data, err := ioutil.ReadFile(conf.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read tls ca file fail, %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificate found in tls ca file %s", conf.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if conf.CertFile != "" {
+		keyFile := conf.KeyFile
+		if keyFile == "" {
+			keyFile = conf.CertFile
+		}
+		cert, err := tls.LoadX509KeyPair(conf.CertFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load tls cert fail, %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
@@ -0,0 +1,33 @@
+package emongo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestApplyConnectionOptions(t *testing.T) {
+	conf := DefaultConfig()
+	conf.Compressors = []string{"zstd", "snappy"}
+	conf.ServerAPIVersion = "1"
+	conf.ServerAPIStrict = true
+	conf.TLS.InsecureSkipVerify = true
+
+	clientOpts := options.Client().ApplyURI("mongodb://127.0.0.1:27017/?tls=true")
+	require.NoError(t, applyConnectionOptions(clientOpts, conf))
+	assert.Equal(t, []string{"zstd", "snappy"}, clientOpts.Compressors)
+	assert.Equal(t, options.ServerAPIVersion1, clientOpts.ServerAPIOptions.ServerAPIVersion)
+	assert.True(t, *clientOpts.ServerAPIOptions.Strict)
+	assert.True(t, clientOpts.TLSConfig.InsecureSkipVerify)
+
+	conf = DefaultConfig()
+	assert.Error(t, applyConnectionOptions(options.Client(), &config{Compressors: []string{"gzip"}}))
+	assert.Error(t, applyConnectionOptions(options.Client(), &config{ServerAPIVersion: "2"}))
+	assert.Error(t, applyConnectionOptions(options.Client(), &config{TLS: TLSConfig{CAFile: "testdata/not-exist.pem"}}))
+
+	clientOpts = options.Client()
+	require.NoError(t, applyConnectionOptions(clientOpts, conf))
+	assert.Nil(t, clientOpts.TLSConfig)
+}
@@ -10,7 +10,6 @@ import (
 	"github.com/gotomicro/ego/core/elog"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 )
 
 type Option func(c *Container)
@@ -45,24 +44,54 @@ func Load(key string) *Container {
 func (c *Container) newSession(config config) *Client {
 	// check config param
 	c.isConfigErr(config)
+
+	var client *Client
+	if config.client != nil {
+		// 使用WithClient传入的客户端，不再按DSN建立连接
+		client = &Client{cc: config.client, processor: defaultProcessor}
+	} else {
+		client = c.dial(config)
+	}
+	if c.config.Debug {
+		client.logMode = true
+	}
+	client.softDelete = newNamespaceField(config.SoftDeleteField, config.SoftDeleteCollections)
+	client.versioning = newNamespaceField(config.VersionField, config.VersionCollections)
+	instances.Store(c.name, client)
+	client.wrapProcessor(InterceptorChain(config.interceptors...))
+	return client
+}
+
+// dial 按DSN以及连接相关的配置建立连接
+func (c *Container) dial(config config) *Client {
 	mps := uint64(config.PoolLimit)
 
 	clientOpts := options.Client()
 	clientOpts.MaxPoolSize = &mps
 	clientOpts.SocketTimeout = &config.SocketTimeout
-	if c.config.EnableTraceInterceptor {
-		clientOpts.Monitor = otelmongo.NewMonitor()
+	clientOpts.SetRetryReads(config.RetryReads)
+	clientOpts.SetRetryWrites(config.RetryWrites)
+	if config.EnableMetricInterceptor {
+		clientOpts.SetPoolMonitor(newPoolMonitor(c.name))
+	}
+	var monitor *commandMonitor
+	if config.EnableTraceInterceptor || config.EnableMetricInterceptor || config.SlowLogThreshold > 0 {
+		monitor = newCommandMonitor(c.name, &config, c.logger)
+		clientOpts.Monitor = monitor.eventMonitor()
+	}
+
+	clientOpts.ApplyURI(config.DSN)
+	if err := applyConnectionOptions(clientOpts, &config); err != nil {
+		c.logger.Panic("invalid connection config", elog.FieldErr(err))
 	}
 
-	client, err := Connect(context.Background(), clientOpts.ApplyURI(config.DSN))
+	client, err := Connect(context.Background(), clientOpts)
 	if err != nil {
 		c.logger.Panic("dial mongo", elog.FieldAddr(config.DSN), elog.Any("error", err))
 	}
-	if c.config.Debug {
-		client.logMode = true
+	if monitor != nil {
+		monitor.client = client.cc
 	}
-	instances.Store(c.name, client)
-	client.wrapProcessor(InterceptorChain(config.interceptors...))
 	return client
 }
 
@@ -112,10 +141,31 @@ func (c *Container) Build(options ...Option) *Component {
 	}
 
 	c.logger = c.logger.With(elog.FieldAddr(fmt.Sprintf("%s", c.config.DSN)))
+	txnOpts, err := transactionOptions(c.config)
+	if err != nil {
+		c.logger.Panic("invalid transaction config", elog.FieldErr(err))
+	}
 	client := c.newSession(*c.config)
-	return &Component{
-		config: c.config,
-		client: client,
-		logger: c.logger,
+	cmp := &Component{
+		name:    c.name,
+		config:  c.config,
+		client:  client,
+		logger:  c.logger,
+		txnOpts: txnOpts,
+	}
+	if len(c.config.indexes) > 0 {
+		report, err := cmp.EnsureIndexes(context.Background(), c.config.IndexDryRun)
+		if err != nil {
+			c.logger.Panic("ensure indexes", elog.FieldErr(err))
+		}
+		cmp.logIndexReport(report)
+	}
+	if len(c.config.validators) > 0 {
+		report, err := cmp.EnsureValidators(context.Background(), c.config.ValidatorDryRun)
+		if err != nil {
+			c.logger.Panic("ensure validators", elog.FieldErr(err))
+		}
+		cmp.logValidatorReport(report)
 	}
+	return cmp
 }
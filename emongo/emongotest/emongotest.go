@@ -0,0 +1,62 @@
+// Package emongotest 基于mongo driver的mtest mock部署，在没有MongoDB的情况下对基于emongo.Component的代码做单元测试
+//
+// Run 创建一个连接mock部署的Component，测试中通过AddMockResponses按顺序设置每条命令的响应，
+// 通过GetStartedEvent检查发出的命令。mock部署不会执行命令，响应需要与驱动期望的格式一致，可以使用本包提供的Response函数构建。
+package emongotest
+
+import (
+	"testing"
+
+	"github.com/gotomicro/ego-component/emongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// T mock测试环境，内嵌mtest.T，可以直接调用AddMockResponses、GetStartedEvent等方法
+type T struct {
+	*mtest.T
+	// Component 连接mock部署的Component
+	Component *emongo.Component
+}
+
+// Run 创建连接mock部署的Component并执行fn，options为构建Component时的选项
+func Run(t *testing.T, name string, fn func(mt *T), options ...emongo.Option) {
+	m := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer m.Close()
+	m.Run(name, func(mt *mtest.T) {
+		opts := append([]emongo.Option{emongo.WithClient(mt.Client)}, options...)
+		fn(&T{T: mt, Component: emongo.DefaultContainer().Build(opts...)})
+	})
+}
+
+// SuccessResponse 命令执行成功的响应，elems为响应中的其他字段，如n、nModified
+func SuccessResponse(elems ...bson.E) bson.D {
+	return mtest.CreateSuccessResponse(elems...)
+}
+
+// FindResponse find、aggregate等返回游标的命令的响应，namespace为 库名.集合名，docs可以是结构体、bson.M等
+func FindResponse(t *testing.T, namespace string, docs ...interface{}) bson.D {
+	batch := make([]bson.D, 0, len(docs))
+	for _, doc := range docs {
+		data, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatalf("emongotest: marshal document fail, %v", err)
+		}
+		var d bson.D
+		if err := bson.Unmarshal(data, &d); err != nil {
+			t.Fatalf("emongotest: unmarshal document fail, %v", err)
+		}
+		batch = append(batch, d)
+	}
+	return mtest.CreateCursorResponse(0, namespace, mtest.FirstBatch, batch...)
+}
+
+// ErrorResponse 命令执行失败的响应，如code为11000的重复键错误
+func ErrorResponse(code int32, message string) bson.D {
+	return mtest.CreateCommandErrorResponse(mtest.CommandError{Code: code, Message: message})
+}
+
+// WriteErrorResponse 写入部分文档失败的响应，index为失败文档在本次写入中的位置
+func WriteErrorResponse(index int, code int, message string) bson.D {
+	return mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: index, Code: code, Message: message})
+}
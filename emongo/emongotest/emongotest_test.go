@@ -0,0 +1,43 @@
+package emongotest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type user struct {
+	ID   int    `bson:"_id"`
+	Name string `bson:"name"`
+}
+
+func TestRun(t *testing.T) {
+	Run(t, "find", func(mt *T) {
+		coll := mt.Component.Client().Database("shop").Collection("users")
+		mt.AddMockResponses(FindResponse(t, "shop.users", user{ID: 1, Name: "a"}, user{ID: 2, Name: "b"}))
+
+		cursor, err := coll.Find(context.Background(), bson.M{"name": bson.M{"$ne": ""}})
+		require.NoError(t, err)
+		var users []user
+		require.NoError(t, cursor.All(context.Background(), &users))
+		assert.Equal(t, []user{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}}, users)
+
+		started := mt.GetStartedEvent()
+		assert.Equal(t, "find", started.CommandName)
+		assert.Equal(t, "users", started.Command.Lookup("find").StringValue())
+	})
+
+	Run(t, "insert", func(mt *T) {
+		coll := mt.Component.Client().Database("shop").Collection("users")
+		mt.AddMockResponses(SuccessResponse(), WriteErrorResponse(0, 11000, "duplicate key"))
+
+		_, err := coll.InsertOne(context.Background(), user{ID: 1, Name: "a"})
+		require.NoError(t, err)
+		_, err = coll.InsertOne(context.Background(), user{ID: 1, Name: "a"})
+		assert.True(t, mongo.IsDuplicateKeyError(err))
+	})
+}
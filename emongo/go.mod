@@ -5,7 +5,11 @@ go 1.15
 require (
 	github.com/BurntSushi/toml v0.3.1
 	github.com/gotomicro/ego v1.0.0
+	github.com/prometheus/client_golang v1.12.1
+	github.com/prometheus/client_model v0.2.0
 	github.com/stretchr/testify v1.7.0
-	go.mongodb.org/mongo-driver v1.8.4
-	go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo v0.29.0
+	go.mongodb.org/mongo-driver v1.9.4
+	go.opentelemetry.io/otel v1.4.1
+	go.opentelemetry.io/otel/sdk v1.4.1
+	go.opentelemetry.io/otel/trace v1.4.1
 )
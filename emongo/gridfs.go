@@ -0,0 +1,180 @@
+package emongo
+
+import (
+	"context"
+	"io"
+
+	"github.com/gotomicro/ego/core/emetric"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// gridfsBytesCounter GridFS上传、下载的字节数
+var gridfsBytesCounter = emetric.CounterVecOpts{
+	Namespace: emetric.DefaultNamespace,
+	Name:      "mongo_gridfs_bytes_total",
+	Help:      "Number of bytes uploaded to or downloaded from GridFS",
+	Labels:    []string{"name", "bucket", "operation"},
+}.Build()
+
+// GridFS 文件存储，每次操作创建新的gridfs.Bucket，可以在多个goroutine中使用
+type GridFS struct {
+	compName  string
+	db        *mongo.Database
+	opts      *options.BucketOptions
+	processor processor
+	logMode   bool
+}
+
+// GridFS 返回database库中的GridFS，分块大小默认使用配置中的GridFSChunkSize，可以通过opts覆盖
+func (c *Component) GridFS(database string, opts ...*options.BucketOptions) *GridFS {
+	bucketOpts := options.GridFSBucket()
+	if c.config.GridFSChunkSize > 0 {
+		bucketOpts.SetChunkSizeBytes(c.config.GridFSChunkSize)
+	}
+	return &GridFS{
+		compName:  c.name,
+		db:        c.client.cc.Database(database),
+		opts:      options.MergeBucketOptions(append([]*options.BucketOptions{bucketOpts}, opts...)...),
+		processor: c.client.processor,
+		logMode:   c.client.logMode,
+	}
+}
+
+// bucket 创建gridfs.Bucket，ctx有截止时间时设置为读写的截止时间
+func (g *GridFS) bucket(ctx context.Context) (*gridfs.Bucket, error) {
+	bucket, err := gridfs.NewBucket(g.db, g.opts)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = bucket.SetReadDeadline(deadline)
+		_ = bucket.SetWriteDeadline(deadline)
+	}
+	return bucket, nil
+}
+
+func (g *GridFS) bucketName() string {
+	if g.opts.Name != nil {
+		return *g.opts.Name
+	}
+	return options.DefaultName
+}
+
+func (g *GridFS) countBytes(operation string, n int64) {
+	gridfsBytesCounter.Add(float64(n), g.compName, g.bucketName(), operation)
+}
+
+// Upload 从source读取数据并上传为filename文件，返回文件ID
+func (g *GridFS) Upload(ctx context.Context, filename string, source io.Reader, opts ...*options.UploadOptions) (fileID primitive.ObjectID, err error) {
+	err = g.processor(func(c *cmd) error {
+		logCmd(g.logMode, c, "GridFS.Upload", nil, filename)
+		bucket, err := g.bucket(ctx)
+		if err != nil {
+			return err
+		}
+		reader := &countingReader{Reader: source}
+		fileID, err = bucket.UploadFromStream(filename, reader, opts...)
+		g.countBytes("upload", reader.n)
+		return err
+	})
+	return
+}
+
+// Download 下载fileID对应的文件并写入w，返回写入的字节数
+func (g *GridFS) Download(ctx context.Context, fileID interface{}, w io.Writer) (n int64, err error) {
+	err = g.processor(func(c *cmd) error {
+		logCmd(g.logMode, c, "GridFS.Download", nil, fileID)
+		bucket, err := g.bucket(ctx)
+		if err != nil {
+			return err
+		}
+		n, err = bucket.DownloadToStream(fileID, w)
+		g.countBytes("download", n)
+		return err
+	})
+	return
+}
+
+// DownloadByName 按文件名下载文件并写入w，默认下载最新的版本，返回写入的字节数
+func (g *GridFS) DownloadByName(ctx context.Context, filename string, w io.Writer, opts ...*options.NameOptions) (n int64, err error) {
+	err = g.processor(func(c *cmd) error {
+		logCmd(g.logMode, c, "GridFS.DownloadByName", nil, filename)
+		bucket, err := g.bucket(ctx)
+		if err != nil {
+			return err
+		}
+		n, err = bucket.DownloadToStreamByName(filename, w, opts...)
+		g.countBytes("download", n)
+		return err
+	})
+	return
+}
+
+// OpenUploadStream 返回上传文件的io.WriteCloser，Close后文件才会写入，文件ID为stream.FileID
+func (g *GridFS) OpenUploadStream(ctx context.Context, filename string, opts ...*options.UploadOptions) (stream *gridfs.UploadStream, err error) {
+	err = g.processor(func(c *cmd) error {
+		logCmd(g.logMode, c, "GridFS.OpenUploadStream", nil, filename)
+		bucket, err := g.bucket(ctx)
+		if err != nil {
+			return err
+		}
+		stream, err = bucket.OpenUploadStream(filename, opts...)
+		return err
+	})
+	return
+}
+
+// OpenDownloadStream 返回下载文件的io.ReadCloser，用完后需要Close
+func (g *GridFS) OpenDownloadStream(ctx context.Context, fileID interface{}) (stream *gridfs.DownloadStream, err error) {
+	err = g.processor(func(c *cmd) error {
+		logCmd(g.logMode, c, "GridFS.OpenDownloadStream", nil, fileID)
+		bucket, err := g.bucket(ctx)
+		if err != nil {
+			return err
+		}
+		stream, err = bucket.OpenDownloadStream(fileID)
+		return err
+	})
+	return
+}
+
+// Delete 删除fileID对应的文件和所有分块
+func (g *GridFS) Delete(ctx context.Context, fileID interface{}) error {
+	return g.processor(func(c *cmd) error {
+		logCmd(g.logMode, c, "GridFS.Delete", nil, fileID)
+		bucket, err := g.bucket(ctx)
+		if err != nil {
+			return err
+		}
+		return bucket.Delete(fileID)
+	})
+}
+
+// Find 查询文件信息，filter作用于files集合
+func (g *GridFS) Find(ctx context.Context, filter interface{}, opts ...*options.GridFSFindOptions) (cursor *mongo.Cursor, err error) {
+	err = g.processor(func(c *cmd) error {
+		logCmd(g.logMode, c, "GridFS.Find", nil, filter)
+		bucket, err := g.bucket(ctx)
+		if err != nil {
+			return err
+		}
+		cursor, err = bucket.Find(filter, opts...)
+		return err
+	})
+	return
+}
+
+// countingReader 统计读取的字节数
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
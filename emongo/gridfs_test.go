@@ -0,0 +1,32 @@
+package emongo
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestGridFSOptions(t *testing.T) {
+	client, err := NewClient(options.Client().ApplyURI("mongodb://127.0.0.1:27017"))
+	require.NoError(t, err)
+	cmp := &Component{name: "mongo", config: DefaultConfig(), client: client}
+
+	fs := cmp.GridFS("test")
+	assert.Equal(t, int32(255*1024), *fs.opts.ChunkSizeBytes)
+	assert.Equal(t, "fs", fs.bucketName())
+
+	fs = cmp.GridFS("test", options.GridFSBucket().SetName("avatars").SetChunkSizeBytes(1024))
+	assert.Equal(t, int32(1024), *fs.opts.ChunkSizeBytes)
+	assert.Equal(t, "avatars", fs.bucketName())
+}
+
+func TestCountingReader(t *testing.T) {
+	reader := &countingReader{Reader: strings.NewReader("hello gridfs")}
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), reader.n)
+}
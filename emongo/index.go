@@ -0,0 +1,268 @@
+package emongo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Index 索引定义
+type Index struct {
+	Name        string        // 索引名，为空时按字段生成，如user_id_1_created_at_-1
+	Keys        bson.D        // 索引字段，1为升序，-1为降序
+	Unique      bool          // 是否唯一索引
+	Sparse      bool          // 是否稀疏索引
+	ExpireAfter time.Duration // TTL索引的过期时间，为0时不过期
+}
+
+// CollectionIndexes 集合的索引定义
+type CollectionIndexes struct {
+	Database   string
+	Collection string
+	Indexes    []Index
+}
+
+// IndexDiff 定义与数据库中不一致的索引
+type IndexDiff struct {
+	Namespace string // 库名.集合名
+	Name      string // 索引名
+	Detail    string // 不一致的原因
+}
+
+// IndexReport 索引检查结果
+type IndexReport struct {
+	DryRun  bool        // 是否只检查不创建
+	Missing []IndexDiff // 声明了但数据库中不存在的索引，DryRun为false时已经创建
+	Changed []IndexDiff // 与数据库中同名索引的定义不一致，需要人工处理
+	Extra   []IndexDiff // 数据库中存在但没有声明的索引，不会删除
+}
+
+// HasDrift 数据库中的索引与声明是否不一致
+func (r *IndexReport) HasDrift() bool {
+	return len(r.Missing) > 0 || len(r.Changed) > 0 || len(r.Extra) > 0
+}
+
+// IndexesFromStruct 从模型的index标签读取索引定义，标签格式为 index:"索引名[,desc][,unique][,sparse]"，
+// 索引名相同的字段组成复合索引，字段顺序与结构体中的顺序一致，字段名使用bson标签
+//
+//	type Order struct {
+//		UserID    int64     `bson:"user_id" index:"idx_user_created"`
+//		CreatedAt time.Time `bson:"created_at" index:"idx_user_created,desc"`
+//		OrderNo   string    `bson:"order_no" index:"uniq_order_no,unique"`
+//	}
+func IndexesFromStruct(model interface{}) []Index {
+	t := reflect.TypeOf(model)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	indexes := make([]Index, 0)
+	positions := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("index")
+		if !ok {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		key := bsonFieldName(field)
+		direction := 1
+		var unique, sparse bool
+		for _, part := range parts[1:] {
+			switch strings.TrimSpace(part) {
+			case "desc":
+				direction = -1
+			case "unique":
+				unique = true
+			case "sparse":
+				sparse = true
+			}
+		}
+
+		name := strings.TrimSpace(parts[0])
+		if name == "" {
+			name = indexName(bson.D{{Key: key, Value: direction}})
+		}
+		pos, ok := positions[name]
+		if !ok {
+			pos = len(indexes)
+			positions[name] = pos
+			indexes = append(indexes, Index{Name: name})
+		}
+		indexes[pos].Keys = append(indexes[pos].Keys, bson.E{Key: key, Value: direction})
+		indexes[pos].Unique = indexes[pos].Unique || unique
+		indexes[pos].Sparse = indexes[pos].Sparse || sparse
+	}
+	return indexes
+}
+
+// bsonFieldName 返回字段在bson中的名称，与bson默认的规则一致
+func bsonFieldName(field reflect.StructField) string {
+	if name := strings.Split(field.Tag.Get("bson"), ",")[0]; name != "" && name != "-" {
+		return name
+	}
+	return strings.ToLower(field.Name)
+}
+
+// indexName 按字段生成索引名，与mongo默认的规则一致
+func indexName(keys bson.D) string {
+	parts := make([]string, 0, len(keys)*2)
+	for _, key := range keys {
+		parts = append(parts, key.Key, fmt.Sprintf("%v", key.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+func (i Index) name() string {
+	if i.Name != "" {
+		return i.Name
+	}
+	return indexName(i.Keys)
+}
+
+func (i Index) model() mongo.IndexModel {
+	opts := options.Index().SetName(i.name()).SetBackground(true)
+	if i.Unique {
+		opts.SetUnique(true)
+	}
+	if i.Sparse {
+		opts.SetSparse(true)
+	}
+	if i.ExpireAfter > 0 {
+		opts.SetExpireAfterSeconds(int32(i.ExpireAfter / time.Second))
+	}
+	return mongo.IndexModel{Keys: i.Keys, Options: opts}
+}
+
+// existingIndex 数据库中的索引
+type existingIndex struct {
+	Name               string `bson:"name"`
+	Key                bson.D `bson:"key"`
+	Unique             bool   `bson:"unique"`
+	Sparse             bool   `bson:"sparse"`
+	ExpireAfterSeconds *int64 `bson:"expireAfterSeconds"`
+}
+
+// diff 返回声明与数据库中索引不一致的原因，一致时返回空
+func (i Index) diff(e existingIndex) string {
+	if indexName(i.Keys) != indexName(normalizeKeys(e.Key)) {
+		return fmt.Sprintf("keys %s != %s", indexName(i.Keys), indexName(normalizeKeys(e.Key)))
+	}
+	if i.Unique != e.Unique {
+		return fmt.Sprintf("unique %v != %v", i.Unique, e.Unique)
+	}
+	if i.Sparse != e.Sparse {
+		return fmt.Sprintf("sparse %v != %v", i.Sparse, e.Sparse)
+	}
+	var expire int64
+	if e.ExpireAfterSeconds != nil {
+		expire = *e.ExpireAfterSeconds
+	}
+	if int64(i.ExpireAfter/time.Second) != expire {
+		return fmt.Sprintf("expireAfterSeconds %d != %d", int64(i.ExpireAfter/time.Second), expire)
+	}
+	return ""
+}
+
+// normalizeKeys 数据库返回的方向可能是int32、int64、float64，统一为int
+func normalizeKeys(keys bson.D) bson.D {
+	normalized := make(bson.D, 0, len(keys))
+	for _, key := range keys {
+		value := key.Value
+		switch v := value.(type) {
+		case int32:
+			value = int(v)
+		case int64:
+			value = int(v)
+		case float64:
+			value = int(v)
+		}
+		normalized = append(normalized, bson.E{Key: key.Key, Value: value})
+	}
+	return normalized
+}
+
+// diffIndexes 对比声明与数据库中的索引
+func diffIndexes(namespace string, declared []Index, existing []existingIndex, report *IndexReport) []Index {
+	existingByName := make(map[string]existingIndex, len(existing))
+	for _, e := range existing {
+		existingByName[e.Name] = e
+	}
+	declaredNames := make(map[string]bool, len(declared))
+	missing := make([]Index, 0)
+	for _, index := range declared {
+		name := index.name()
+		declaredNames[name] = true
+		e, ok := existingByName[name]
+		if !ok {
+			missing = append(missing, index)
+			report.Missing = append(report.Missing, IndexDiff{Namespace: namespace, Name: name, Detail: indexName(index.Keys)})
+			continue
+		}
+		if detail := index.diff(e); detail != "" {
+			report.Changed = append(report.Changed, IndexDiff{Namespace: namespace, Name: name, Detail: detail})
+		}
+	}
+	for _, e := range existing {
+		if e.Name == "_id_" || declaredNames[e.Name] {
+			continue
+		}
+		report.Extra = append(report.Extra, IndexDiff{Namespace: namespace, Name: e.Name, Detail: indexName(normalizeKeys(e.Key))})
+	}
+	return missing
+}
+
+// EnsureIndexes 对比WithIndexes声明的索引与数据库中的索引，dryRun为false时在后台创建缺少的索引。
+// 定义不一致、没有声明的索引只记录在报告中，不会修改或删除
+func (c *Component) EnsureIndexes(ctx context.Context, dryRun bool) (*IndexReport, error) {
+	report := &IndexReport{DryRun: dryRun}
+	for _, ci := range c.config.indexes {
+		coll := c.client.Database(ci.Database).Collection(ci.Collection)
+		namespace := ci.Database + "." + ci.Collection
+
+		existing := make([]existingIndex, 0)
+		cursor, err := coll.Indexes().List(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("emongo: list indexes of %s fail, %w", namespace, err)
+		}
+		if err := cursor.All(ctx, &existing); err != nil {
+			return nil, fmt.Errorf("emongo: decode indexes of %s fail, %w", namespace, err)
+		}
+
+		missing := diffIndexes(namespace, ci.Indexes, existing, report)
+		if dryRun || len(missing) == 0 {
+			continue
+		}
+		models := make([]mongo.IndexModel, 0, len(missing))
+		for _, index := range missing {
+			models = append(models, index.model())
+		}
+		if _, err := coll.Indexes().CreateMany(ctx, models); err != nil {
+			return nil, fmt.Errorf("emongo: create indexes of %s fail, %w", namespace, err)
+		}
+	}
+	return report, nil
+}
+
+// logIndexReport 记录索引检查结果
+func (c *Component) logIndexReport(report *IndexReport) {
+	for _, diff := range report.Missing {
+		if report.DryRun {
+			c.logger.Warn("index missing", elog.String("namespace", diff.Namespace), elog.String("index", diff.Name), elog.String("keys", diff.Detail))
+			continue
+		}
+		c.logger.Info("index created", elog.String("namespace", diff.Namespace), elog.String("index", diff.Name), elog.String("keys", diff.Detail))
+	}
+	for _, diff := range report.Changed {
+		c.logger.Warn("index changed", elog.String("namespace", diff.Namespace), elog.String("index", diff.Name), elog.String("detail", diff.Detail))
+	}
+	for _, diff := range report.Extra {
+		c.logger.Warn("index not declared", elog.String("namespace", diff.Namespace), elog.String("index", diff.Name), elog.String("keys", diff.Detail))
+	}
+}
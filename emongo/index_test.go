@@ -0,0 +1,48 @@
+package emongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type indexedOrder struct {
+	ID        string    `bson:"_id"`
+	UserID    int64     `bson:"user_id" index:"idx_user_created"`
+	CreatedAt time.Time `bson:"created_at" index:"idx_user_created,desc"`
+	OrderNo   string    `bson:"order_no" index:"uniq_order_no,unique"`
+	Status    int       `index:",sparse"`
+}
+
+func TestIndexesFromStruct(t *testing.T) {
+	assert.Equal(t, []Index{
+		{Name: "idx_user_created", Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Name: "uniq_order_no", Keys: bson.D{{Key: "order_no", Value: 1}}, Unique: true},
+		{Name: "status_1", Keys: bson.D{{Key: "status", Value: 1}}, Sparse: true},
+	}, IndexesFromStruct(&indexedOrder{}))
+}
+
+func TestDiffIndexes(t *testing.T) {
+	declared := []Index{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Name: "uniq_order_no", Keys: bson.D{{Key: "order_no", Value: 1}}, Unique: true},
+		{Name: "ttl_expired_at", Keys: bson.D{{Key: "expired_at", Value: 1}}, ExpireAfter: time.Hour},
+	}
+	expire := int64(60)
+	existing := []existingIndex{
+		{Name: "_id_", Key: bson.D{{Key: "_id", Value: int32(1)}}},
+		{Name: "user_id_1_created_at_-1", Key: bson.D{{Key: "user_id", Value: int32(1)}, {Key: "created_at", Value: float64(-1)}}},
+		{Name: "ttl_expired_at", Key: bson.D{{Key: "expired_at", Value: int32(1)}}, ExpireAfterSeconds: &expire},
+		{Name: "status_1", Key: bson.D{{Key: "status", Value: int32(1)}}},
+	}
+
+	report := &IndexReport{}
+	missing := diffIndexes("test.orders", declared, existing, report)
+	assert.Equal(t, declared[1:2], missing)
+	assert.True(t, report.HasDrift())
+	assert.Equal(t, []IndexDiff{{Namespace: "test.orders", Name: "uniq_order_no", Detail: "order_no_1"}}, report.Missing)
+	assert.Equal(t, []IndexDiff{{Namespace: "test.orders", Name: "ttl_expired_at", Detail: "expireAfterSeconds 3600 != 60"}}, report.Changed)
+	assert.Equal(t, []IndexDiff{{Namespace: "test.orders", Name: "status_1", Detail: "status_1"}}, report.Extra)
+}
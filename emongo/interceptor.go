@@ -99,10 +99,6 @@ func accessInterceptor(compName string, c *config, logger *elog.Component) func(
 				fields = append(fields, elog.Any("res", cmd.res))
 			}
 
-			if c.SlowLogThreshold > time.Duration(0) && cost > c.SlowLogThreshold {
-				logger.Warn("slow", fields...)
-			}
-
 			if err != nil {
 				fields = append(fields, elog.FieldEvent("error"), elog.FieldErr(err))
 				if errors.Is(err, mongo.ErrNoDocuments) {
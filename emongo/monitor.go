@@ -0,0 +1,267 @@
+package emongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/gotomicro/ego/core/emetric"
+	"github.com/gotomicro/ego/core/etrace"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/event"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// commandHistogram 按集合和命令统计的耗时
+	commandHistogram = emetric.HistogramVecOpts{
+		Namespace: emetric.DefaultNamespace,
+		Name:      "mongo_command_seconds",
+		Help:      "Latency of mongo commands by collection and command",
+		Labels:    []string{"name", "collection", "command"},
+		Buckets:   []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}.Build()
+	// commandCounter 按集合、命令和结果统计的次数，code为OK、Error
+	commandCounter = emetric.CounterVecOpts{
+		Namespace: emetric.DefaultNamespace,
+		Name:      "mongo_command_total",
+		Help:      "Number of mongo commands by collection, command and result code",
+		Labels:    []string{"name", "collection", "command", "code"},
+	}.Build()
+	// replyBytesHistogram 按集合和命令统计的响应大小
+	replyBytesHistogram = emetric.HistogramVecOpts{
+		Namespace: emetric.DefaultNamespace,
+		Name:      "mongo_reply_bytes",
+		Help:      "Size of mongo command replies in bytes",
+		Labels:    []string{"name", "collection", "command"},
+		Buckets:   []float64{128, 512, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216},
+	}.Build()
+)
+
+// ignoredCommandFields 不需要记录到statement中的命令字段
+var ignoredCommandFields = map[string]bool{
+	"lsid":             true,
+	"$clusterTime":     true,
+	"$db":              true,
+	"$readPreference":  true,
+	"txnNumber":        true,
+	"autocommit":       true,
+	"startTransaction": true,
+}
+
+// maxStatementLength statement的最大长度，超过时截断
+const maxStatementLength = 1024
+
+// commandMonitor 为每条命令创建span并记录监控，span的父节点为请求context中的span
+type commandMonitor struct {
+	compName          string
+	enableTrace       bool
+	enableMetric      bool
+	slowLogThreshold  time.Duration
+	explainSampleRate float64
+	tracer            *etrace.Tracer
+	logger            *elog.Component
+	client            *mongo.Client // 慢查询执行explain使用，连接后设置
+	explains          chan struct{} // 正在执行的explain，限制并发数量
+	commands          sync.Map      // connectionID+requestID -> *startedCommand
+}
+
+type startedCommand struct {
+	database   string
+	collection string
+	command    bson.Raw // 开启慢日志时保存命令，用于记录慢日志和explain
+	span       trace.Span
+}
+
+func newCommandMonitor(compName string, config *config, logger *elog.Component) *commandMonitor {
+	return &commandMonitor{
+		compName:          compName,
+		enableTrace:       config.EnableTraceInterceptor,
+		enableMetric:      config.EnableMetricInterceptor,
+		slowLogThreshold:  config.SlowLogThreshold,
+		explainSampleRate: config.ExplainSampleRate,
+		tracer:            etrace.NewTracer(trace.SpanKindClient),
+		logger:            logger,
+		explains:          make(chan struct{}, maxConcurrentExplains),
+	}
+}
+
+// eventMonitor 返回注册到mongo客户端的CommandMonitor
+func (m *commandMonitor) eventMonitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started:   m.started,
+		Succeeded: m.succeeded,
+		Failed:    m.failed,
+	}
+}
+
+func commandKey(connectionID string, requestID int64) string {
+	return connectionID + "-" + strconv.FormatInt(requestID, 10)
+}
+
+func (m *commandMonitor) started(ctx context.Context, evt *event.CommandStartedEvent) {
+	started := &startedCommand{database: evt.DatabaseName, collection: commandCollection(evt.Command, evt.CommandName)}
+	if m.slowLogThreshold > 0 {
+		// evt.Command的内存在命令结束后可能被复用，需要复制
+		started.command = append(bson.Raw(nil), evt.Command...)
+	}
+	if m.enableTrace && ctx != nil {
+		host, port := peerInfo(evt.ConnectionID)
+		attrs := []attribute.KeyValue{
+			semconv.DBSystemMongoDB,
+			semconv.DBNameKey.String(evt.DatabaseName),
+			semconv.DBOperationKey.String(evt.CommandName),
+			semconv.DBMongoDBCollectionKey.String(started.collection),
+			semconv.DBStatementKey.String(sanitizeCommand(evt.Command)),
+			semconv.NetPeerNameKey.String(host),
+			semconv.NetPeerPortKey.Int(port),
+		}
+		_, started.span = m.tracer.Start(ctx, "mongo."+evt.CommandName, nil, trace.WithAttributes(attrs...))
+	}
+	m.commands.Store(commandKey(evt.ConnectionID, evt.RequestID), started)
+}
+
+func (m *commandMonitor) succeeded(ctx context.Context, evt *event.CommandSucceededEvent) {
+	m.finished(&evt.CommandFinishedEvent, len(evt.Reply), nil)
+}
+
+func (m *commandMonitor) failed(ctx context.Context, evt *event.CommandFailedEvent) {
+	m.finished(&evt.CommandFinishedEvent, 0, errors.New(evt.Failure))
+}
+
+func (m *commandMonitor) finished(evt *event.CommandFinishedEvent, replySize int, err error) {
+	value, ok := m.commands.LoadAndDelete(commandKey(evt.ConnectionID, evt.RequestID))
+	if !ok {
+		return
+	}
+	started := value.(*startedCommand)
+	cost := time.Duration(evt.DurationNanos)
+
+	if m.enableMetric {
+		code := "OK"
+		if err != nil {
+			code = "Error"
+		}
+		commandCounter.Inc(m.compName, started.collection, evt.CommandName, code)
+		commandHistogram.Observe(cost.Seconds(), m.compName, started.collection, evt.CommandName)
+		if err == nil {
+			replyBytesHistogram.Observe(float64(replySize), m.compName, started.collection, evt.CommandName)
+		}
+	}
+
+	if m.slowLogThreshold > 0 && cost > m.slowLogThreshold {
+		m.observeSlow(evt.CommandName, started, cost)
+	}
+
+	if started.span == nil {
+		return
+	}
+	defer started.span.End()
+	started.span.SetAttributes(
+		attribute.Int("db.mongodb.reply_size", replySize),
+		attribute.Int64("db.duration_ms", cost.Milliseconds()),
+	)
+	if err != nil {
+		started.span.RecordError(err)
+		started.span.SetStatus(codes.Error, err.Error())
+		return
+	}
+	started.span.SetStatus(codes.Ok, "OK")
+}
+
+// commandCollection 返回命令操作的集合，find、insert、update等命令的第一个字段为集合名
+func commandCollection(command bson.Raw, commandName string) string {
+	value, err := command.LookupErr(commandName)
+	if err != nil {
+		return ""
+	}
+	collection, ok := value.StringValueOK()
+	if !ok {
+		return ""
+	}
+	return collection
+}
+
+// sanitizeCommand 将命令中的值替换为?，只保留结构，避免敏感数据写入链路
+func sanitizeCommand(command bson.Raw) string {
+	elements, err := command.Elements()
+	if err != nil {
+		return ""
+	}
+	doc := make(bson.D, 0, len(elements))
+	for _, element := range elements {
+		key := element.Key()
+		if ignoredCommandFields[key] {
+			continue
+		}
+		value := element.Value()
+		// 命令名对应的值为集合名，保留
+		if len(doc) == 0 && value.Type == bsontype.String {
+			doc = append(doc, bson.E{Key: key, Value: value.StringValue()})
+			continue
+		}
+		doc = append(doc, bson.E{Key: key, Value: sanitizeValue(value)})
+	}
+	statement, err := bson.MarshalExtJSON(doc, false, false)
+	if err != nil {
+		return ""
+	}
+	if len(statement) > maxStatementLength {
+		return string(statement[:maxStatementLength]) + "..."
+	}
+	return string(statement)
+}
+
+func sanitizeValue(value bson.RawValue) interface{} {
+	switch value.Type {
+	case bsontype.EmbeddedDocument:
+		elements, err := value.Document().Elements()
+		if err != nil {
+			return "?"
+		}
+		doc := make(bson.D, 0, len(elements))
+		for _, element := range elements {
+			doc = append(doc, bson.E{Key: element.Key(), Value: sanitizeValue(element.Value())})
+		}
+		return doc
+	case bsontype.Array:
+		values, err := value.Array().Values()
+		if err != nil || len(values) == 0 {
+			return bson.A{}
+		}
+		// 数组中为文档时（如pipeline、documents）保留第一个文档的结构
+		if values[0].Type == bsontype.EmbeddedDocument {
+			sanitized := bson.A{sanitizeValue(values[0])}
+			if len(values) > 1 {
+				sanitized = append(sanitized, fmt.Sprintf("... %d more", len(values)-1))
+			}
+			return sanitized
+		}
+		return "?"
+	}
+	return "?"
+}
+
+// peerInfo 解析连接ID中的地址，连接ID格式为 host:port[-序号]
+func peerInfo(connectionID string) (hostname string, port int) {
+	addr := connectionID
+	if idx := strings.LastIndexByte(addr, '['); idx >= 0 {
+		addr = addr[:idx]
+	}
+	if idx := strings.LastIndexByte(addr, ':'); idx >= 0 {
+		hostname = addr[:idx]
+		port, _ = strconv.Atoi(addr[idx+1:])
+		return
+	}
+	return addr, 0
+}
@@ -0,0 +1,112 @@
+package emongo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/gotomicro/ego/core/etrace"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSanitizeCommand(t *testing.T) {
+	command, err := bson.Marshal(bson.D{
+		{Key: "find", Value: "users"},
+		{Key: "filter", Value: bson.D{{Key: "phone", Value: "13800000000"}, {Key: "age", Value: bson.D{{Key: "$gt", Value: 18}}}}},
+		{Key: "limit", Value: 10},
+		{Key: "lsid", Value: bson.D{{Key: "id", Value: "x"}}},
+		{Key: "$db", Value: "test"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "users", commandCollection(command, "find"))
+	assert.Equal(t, `{"find":"users","filter":{"phone":"?","age":{"$gt":"?"}},"limit":"?"}`, sanitizeCommand(command))
+
+	command, err = bson.Marshal(bson.D{
+		{Key: "insert", Value: "users"},
+		{Key: "documents", Value: bson.A{bson.D{{Key: "name", Value: "a"}}, bson.D{{Key: "name", Value: "b"}}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, `{"insert":"users","documents":[{"name":"?"},"... 1 more"]}`, sanitizeCommand(command))
+}
+
+func TestPeerInfo(t *testing.T) {
+	host, port := peerInfo("mongo-0.mongo:27017[-12]")
+	assert.Equal(t, "mongo-0.mongo", host)
+	assert.Equal(t, 27017, port)
+}
+
+func TestCommandMonitor(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	etrace.SetGlobalTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer etrace.SetGlobalTracer(trace.NewNoopTracerProvider())
+
+	m := newCommandMonitor("mongo.monitor", &config{EnableTraceInterceptor: true, EnableMetricInterceptor: true}, elog.DefaultLogger)
+	monitor := m.eventMonitor()
+	command, err := bson.Marshal(bson.D{{Key: "find", Value: "users"}, {Key: "filter", Value: bson.D{{Key: "phone", Value: "13800000000"}}}})
+	require.NoError(t, err)
+	reply, err := bson.Marshal(bson.D{{Key: "ok", Value: 1}})
+	require.NoError(t, err)
+
+	// 父span在请求context中时，命令的span为其子节点
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "request")
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: command, CommandName: "find", DatabaseName: "test", RequestID: 1, ConnectionID: "127.0.0.1:27017[-1]"})
+	monitor.Succeeded(ctx, &event.CommandSucceededEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 1, ConnectionID: "127.0.0.1:27017[-1]", DurationNanos: int64(2 * time.Millisecond)}, Reply: reply})
+	monitor.Started(ctx, &event.CommandStartedEvent{Command: command, CommandName: "find", DatabaseName: "test", RequestID: 2, ConnectionID: "127.0.0.1:27017[-1]"})
+	monitor.Failed(ctx, &event.CommandFailedEvent{CommandFinishedEvent: event.CommandFinishedEvent{CommandName: "find", RequestID: 2, ConnectionID: "127.0.0.1:27017[-1]"}, Failure: "timeout"})
+	parent.End()
+
+	m.commands.Range(func(key, value interface{}) bool {
+		t.Errorf("command %v not finished", key)
+		return true
+	})
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 3)
+	for _, span := range spans[:2] {
+		assert.Equal(t, "mongo.find", span.Name())
+		assert.Equal(t, trace.SpanKindClient, span.SpanKind())
+		assert.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+		attrs := spanAttributes(span)
+		assert.Equal(t, "users", attrs[semconv.DBMongoDBCollectionKey].AsString())
+		assert.Equal(t, `{"find":"users","filter":{"phone":"?"}}`, attrs[semconv.DBStatementKey].AsString())
+		assert.Equal(t, "127.0.0.1", attrs[semconv.NetPeerNameKey].AsString())
+	}
+	assert.Equal(t, int64(len(reply)), spanAttributes(spans[0])["db.mongodb.reply_size"].AsInt64())
+	assert.Equal(t, codes.Ok, spans[0].Status().Code)
+	assert.Equal(t, codes.Error, spans[1].Status().Code)
+	assert.Equal(t, "timeout", spans[1].Status().Description)
+
+	assert.Equal(t, float64(1), testutil.ToFloat64(commandCounter.WithLabelValues("mongo.monitor", "users", "find", "OK")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(commandCounter.WithLabelValues("mongo.monitor", "users", "find", "Error")))
+	assert.Equal(t, uint64(2), histogramCount(t, commandHistogram.WithLabelValues("mongo.monitor", "users", "find")))
+	// 失败的命令没有响应，不记录响应大小
+	assert.Equal(t, uint64(1), histogramCount(t, replyBytesHistogram.WithLabelValues("mongo.monitor", "users", "find")))
+}
+
+func histogramCount(t *testing.T, observer prometheus.Observer) uint64 {
+	var metric dto.Metric
+	require.NoError(t, observer.(prometheus.Metric).Write(&metric))
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, attr := range span.Attributes() {
+		attrs[attr.Key] = attr.Value
+	}
+	return attrs
+}
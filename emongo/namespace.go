@@ -0,0 +1,27 @@
+package emongo
+
+// namespaceField 按集合开启的字段约定，如软删除字段、版本号字段
+type namespaceField struct {
+	field       string
+	collections map[string]bool // 库名.集合名
+}
+
+// newNamespaceField 没有开启的集合时返回nil
+func newNamespaceField(field string, namespaces []string) *namespaceField {
+	if len(namespaces) == 0 {
+		return nil
+	}
+	nf := &namespaceField{field: field, collections: make(map[string]bool, len(namespaces))}
+	for _, namespace := range namespaces {
+		nf.collections[namespace] = true
+	}
+	return nf
+}
+
+// fieldFor 返回集合的字段，集合没有开启时返回空
+func (nf *namespaceField) fieldFor(database, collection string) string {
+	if nf == nil || !nf.collections[database+"."+collection] {
+		return ""
+	}
+	return nf.field
+}
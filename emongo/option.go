@@ -1,5 +1,7 @@
 package emongo
 
+import "go.mongodb.org/mongo-driver/mongo"
+
 // WithInterceptor 注入拦截器
 func WithInterceptor(interceptors ...Interceptor) Option {
 	return func(c *Container) {
@@ -23,3 +25,33 @@ func WithDSN(dsn string) Option {
 		c.config.DSN = dsn
 	}
 }
+
+// WithIndexes 声明集合的索引，Build时检查并在后台创建缺少的索引，索引可以通过IndexesFromStruct从模型读取
+func WithIndexes(database string, collection string, indexes ...Index) Option {
+	return func(c *Container) {
+		c.config.indexes = append(c.config.indexes, CollectionIndexes{
+			Database:   database,
+			Collection: collection,
+			Indexes:    indexes,
+		})
+	}
+}
+
+// WithValidator 声明集合的$jsonSchema校验规则，Build时检查，集合不存在时创建集合，规则不一致时通过collMod更新
+func WithValidator(database string, collection string, validator Validator) Option {
+	return func(c *Container) {
+		c.config.validators = append(c.config.validators, CollectionValidator{
+			Database:   database,
+			Collection: collection,
+			Validator:  validator,
+		})
+	}
+}
+
+// WithClient 使用已经创建好的mongo客户端，不再按DSN建立连接，连接相关的配置以及链路、监控的命令监听不会生效，
+// 主要用于单元测试中连接mtest的mock部署，见emongotest
+func WithClient(client *mongo.Client) Option {
+	return func(c *Container) {
+		c.config.client = client
+	}
+}
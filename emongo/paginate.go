@@ -0,0 +1,204 @@
+package emongo
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidPageToken 分页token无法解析，或者与本次查询的排序字段不一致
+var ErrInvalidPageToken = errors.New("emongo: invalid page token")
+
+// Page 游标分页的一页数据
+type Page struct {
+	// Documents 本页的文档
+	Documents []bson.Raw
+	// NextToken 下一页的token，没有下一页时为空
+	NextToken string
+}
+
+// HasMore 是否还有下一页
+func (p *Page) HasMore() bool {
+	return p.NextToken != ""
+}
+
+// Decode 将本页的文档解析到results中，results必须是slice的指针
+func (p *Page) Decode(results interface{}) error {
+	rv := reflect.ValueOf(results)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("results argument must be a pointer to a slice, but was a %s", rv.Kind())
+	}
+	slice := rv.Elem()
+	slice.SetLen(0)
+	for _, doc := range p.Documents {
+		elem := reflect.New(slice.Type().Elem())
+		if err := bson.Unmarshal(doc, elem.Interface()); err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, elem.Elem()))
+	}
+	return nil
+}
+
+// pageToken 分页token的内容，记录排序字段以及上一页最后一个文档中这些字段的值
+type pageToken struct {
+	Keys   []string        `bson:"k"`
+	Values []bson.RawValue `bson:"v"`
+}
+
+// PaginateCursor 基于游标的分页查询，适用于无限滚动的列表
+// sort中没有_id时自动追加_id作为最后一个排序字段，保证排序值相同的文档顺序稳定
+// token为空时查询第一页，否则传入上一页返回的NextToken，token与sort绑定，换了排序字段的token返回ErrInvalidPageToken
+func PaginateCursor(ctx context.Context, coll *Collection, filter interface{}, sort bson.D, token string, limit int64) (*Page, error) {
+	if limit <= 0 {
+		return nil, fmt.Errorf("emongo: invalid page limit %d", limit)
+	}
+	sort = stableSort(sort)
+	if filter == nil {
+		filter = bson.D{}
+	}
+	if token != "" {
+		cond, err := pageCond(sort, token)
+		if err != nil {
+			return nil, err
+		}
+		filter = bson.D{{Key: "$and", Value: bson.A{filter, cond}}}
+	}
+
+	cursor, err := coll.Find(ctx, filter, options.Find().SetSort(sort).SetLimit(limit+1))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	page := &Page{Documents: make([]bson.Raw, 0, limit)}
+	for cursor.Next(ctx) {
+		if int64(len(page.Documents)) == limit {
+			page.NextToken, err = encodePageToken(sort, page.Documents[limit-1])
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+		page.Documents = append(page.Documents, append(bson.Raw(nil), cursor.Current...))
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// stableSort sort中没有_id时追加_id，方向与最后一个排序字段相同
+func stableSort(sort bson.D) bson.D {
+	direction := interface{}(1)
+	for _, e := range sort {
+		if e.Key == "_id" {
+			return sort
+		}
+		direction = e.Value
+	}
+	stable := make(bson.D, 0, len(sort)+1)
+	stable = append(stable, sort...)
+	return append(stable, bson.E{Key: "_id", Value: direction})
+}
+
+// sortKeys 返回排序字段名
+func sortKeys(sort bson.D) []string {
+	keys := make([]string, 0, len(sort))
+	for _, e := range sort {
+		keys = append(keys, e.Key)
+	}
+	return keys
+}
+
+// encodePageToken 根据最后一个文档生成下一页的token
+func encodePageToken(sort bson.D, last bson.Raw) (string, error) {
+	token := pageToken{Keys: sortKeys(sort), Values: make([]bson.RawValue, 0, len(sort))}
+	for _, key := range token.Keys {
+		value, err := last.LookupErr(strings.Split(key, ".")...)
+		if err != nil {
+			// 文档中没有排序字段时按null处理
+			value = bson.RawValue{Type: bson.TypeNull}
+		}
+		token.Values = append(token.Values, value)
+	}
+	data, err := bson.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodePageToken 解析token，并校验排序字段与sort一致
+func decodePageToken(sort bson.D, token string) (*pageToken, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	var t pageToken
+	if err := bson.Unmarshal(data, &t); err != nil {
+		return nil, ErrInvalidPageToken
+	}
+	if !reflect.DeepEqual(t.Keys, sortKeys(sort)) || len(t.Values) != len(t.Keys) {
+		return nil, ErrInvalidPageToken
+	}
+	return &t, nil
+}
+
+// pageCond 构建位于token之后的文档的查询条件
+// 排序为 a asc, b desc 时条件为 {$or: [{a: {$gt: va}}, {a: va, b: {$lt: vb}}, {a: va, b: null}]}
+// MongoDB排序时null和不存在的字段最小，升序时排在最前面，降序时排在最后面，$gt、$lt不会匹配null，需要单独处理
+func pageCond(sort bson.D, token string) (bson.D, error) {
+	t, err := decodePageToken(sort, token)
+	if err != nil {
+		return nil, err
+	}
+	or := make(bson.A, 0, len(sort))
+	for i, e := range sort {
+		after := func(value interface{}) bson.D {
+			cond := make(bson.D, 0, i+1)
+			for j := 0; j < i; j++ {
+				cond = append(cond, bson.E{Key: t.Keys[j], Value: t.Values[j]})
+			}
+			return append(cond, bson.E{Key: e.Key, Value: value})
+		}
+		null := t.Values[i].Type == bson.TypeNull
+		switch {
+		case !isDescending(e.Value) && null:
+			// 升序时null之后为所有有值的文档
+			or = append(or, after(bson.D{{Key: "$ne", Value: nil}}))
+		case !isDescending(e.Value):
+			or = append(or, after(bson.D{{Key: "$gt", Value: t.Values[i]}}))
+		case null:
+			// 降序时null之后没有更小的值
+		case e.Key == "_id":
+			// _id不会为null
+			or = append(or, after(bson.D{{Key: "$lt", Value: t.Values[i]}}))
+		default:
+			// 降序时比当前值小的文档之后为null和不存在该字段的文档
+			or = append(or, after(bson.D{{Key: "$lt", Value: t.Values[i]}}), after(nil))
+		}
+	}
+	return bson.D{{Key: "$or", Value: or}}, nil
+}
+
+// isDescending 排序方向是否为降序
+func isDescending(direction interface{}) bool {
+	switch v := direction.(type) {
+	case int:
+		return v < 0
+	case int32:
+		return v < 0
+	case int64:
+		return v < 0
+	case float64:
+		return v < 0
+	}
+	return false
+}
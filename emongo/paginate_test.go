@@ -0,0 +1,68 @@
+package emongo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPageToken(t *testing.T) {
+	sort := stableSort(bson.D{bson.E{Key: "score", Value: -1}})
+	assert.Equal(t, bson.D{bson.E{Key: "score", Value: -1}, bson.E{Key: "_id", Value: -1}}, sort)
+	assert.Equal(t, bson.D{bson.E{Key: "_id", Value: 1}}, stableSort(nil))
+
+	last, err := bson.Marshal(bson.D{{Key: "_id", Value: 7}, {Key: "score", Value: 90}})
+	require.NoError(t, err)
+	token, err := encodePageToken(sort, last)
+	require.NoError(t, err)
+
+	cond, err := pageCond(sort, token)
+	require.NoError(t, err)
+	data, err := bson.MarshalExtJSON(cond, false, false)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"$or":[{"score":{"$lt":90}},{"score":null},{"score":90,"_id":{"$lt":7}}]}`, string(data))
+
+	_, err = pageCond(bson.D{bson.E{Key: "name", Value: 1}}, token)
+	assert.ErrorIs(t, err, ErrInvalidPageToken)
+	_, err = pageCond(sort, "not a token")
+	assert.ErrorIs(t, err, ErrInvalidPageToken)
+}
+
+func TestPageTokenMissingField(t *testing.T) {
+	// 文档中没有排序字段
+	last, err := bson.Marshal(bson.D{{Key: "_id", Value: 7}})
+	require.NoError(t, err)
+	for _, c := range []struct {
+		sort bson.D
+		cond string
+	}{
+		{sort: bson.D{{Key: "score", Value: 1}}, cond: `{"$or":[{"score":{"$ne":null}},{"score":null,"_id":{"$gt":7}}]}`},
+		{sort: bson.D{{Key: "score", Value: -1}}, cond: `{"$or":[{"score":null,"_id":{"$lt":7}}]}`},
+	} {
+		sort := stableSort(c.sort)
+		token, err := encodePageToken(sort, last)
+		require.NoError(t, err)
+		cond, err := pageCond(sort, token)
+		require.NoError(t, err)
+		data, err := bson.MarshalExtJSON(cond, false, false)
+		require.NoError(t, err)
+		assert.JSONEq(t, c.cond, string(data))
+	}
+}
+
+func TestPageDecode(t *testing.T) {
+	doc, err := bson.Marshal(bson.M{"name": "a"})
+	require.NoError(t, err)
+	page := &Page{Documents: []bson.Raw{doc, doc}}
+
+	var results []struct {
+		Name string `bson:"name"`
+	}
+	require.NoError(t, page.Decode(&results))
+	assert.Len(t, results, 2)
+	assert.Equal(t, "a", results[0].Name)
+	assert.False(t, page.HasMore())
+	assert.Error(t, page.Decode(results))
+}
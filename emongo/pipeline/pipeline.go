@@ -0,0 +1,188 @@
+// Package pipeline 聚合管道构建器，生成可以直接传给emongo Aggregate的mongo.Pipeline
+package pipeline
+
+import (
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Builder 聚合管道构建器，Build返回可以直接传给Aggregate的mongo.Pipeline
+//
+//	p := pipeline.New().
+//		Match(bson.M{"status": "paid"}).
+//		Group("$user_id", pipeline.Sum("total", "$amount"), pipeline.Count("orders")).
+//		Sort(pipeline.Desc("total")).
+//		Limit(10).
+//		Build()
+type Builder struct {
+	stages mongo.Pipeline
+}
+
+// New 创建聚合管道构建器
+func New() *Builder {
+	return &Builder{stages: mongo.Pipeline{}}
+}
+
+// Stage 追加自定义阶段，如Stage("$sample", bson.M{"size": 10})
+func (p *Builder) Stage(name string, value interface{}) *Builder {
+	p.stages = append(p.stages, bson.D{{Key: name, Value: value}})
+	return p
+}
+
+// Match 追加$match阶段
+func (p *Builder) Match(filter interface{}) *Builder {
+	return p.Stage("$match", filter)
+}
+
+// Group 追加$group阶段，id为分组的表达式，如"$user_id"，为nil时所有文档为一组
+func (p *Builder) Group(id interface{}, accumulators ...bson.E) *Builder {
+	group := bson.D{{Key: "_id", Value: id}}
+	return p.Stage("$group", append(group, accumulators...))
+}
+
+// Lookup 追加$lookup阶段，关联from集合中foreignField等于localField的文档，结果写入as字段
+func (p *Builder) Lookup(from, localField, foreignField, as string) *Builder {
+	return p.Stage("$lookup", bson.D{
+		{Key: "from", Value: from},
+		{Key: "localField", Value: localField},
+		{Key: "foreignField", Value: foreignField},
+		{Key: "as", Value: as},
+	})
+}
+
+// Unwind 追加$unwind阶段，path如"$items"
+func (p *Builder) Unwind(path string, preserveNullAndEmptyArrays bool) *Builder {
+	if !preserveNullAndEmptyArrays {
+		return p.Stage("$unwind", path)
+	}
+	return p.Stage("$unwind", bson.D{
+		{Key: "path", Value: path},
+		{Key: "preserveNullAndEmptyArrays", Value: true},
+	})
+}
+
+// Sort 追加$sort阶段，字段通过Asc、Desc生成
+func (p *Builder) Sort(fields ...bson.E) *Builder {
+	return p.Stage("$sort", bson.D(fields))
+}
+
+// Project 追加$project阶段，字段通过Include、Exclude、Field生成
+func (p *Builder) Project(fields ...bson.E) *Builder {
+	return p.Stage("$project", bson.D(fields))
+}
+
+// AddFields 追加$addFields阶段
+func (p *Builder) AddFields(fields ...bson.E) *Builder {
+	return p.Stage("$addFields", bson.D(fields))
+}
+
+// Facet 追加$facet阶段，每个子管道的结果写入同名字段，字段按名称排序
+func (p *Builder) Facet(facets map[string]*Builder) *Builder {
+	names := make([]string, 0, len(facets))
+	for name := range facets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	facet := make(bson.D, 0, len(facets))
+	for _, name := range names {
+		facet = append(facet, bson.E{Key: name, Value: facets[name].Build()})
+	}
+	return p.Stage("$facet", facet)
+}
+
+// Skip 追加$skip阶段
+func (p *Builder) Skip(n int64) *Builder {
+	return p.Stage("$skip", n)
+}
+
+// Limit 追加$limit阶段
+func (p *Builder) Limit(n int64) *Builder {
+	return p.Stage("$limit", n)
+}
+
+// Count 追加$count阶段，文档数量写入field字段
+func (p *Builder) Count(field string) *Builder {
+	return p.Stage("$count", field)
+}
+
+// Build 返回聚合管道
+func (p *Builder) Build() mongo.Pipeline {
+	return p.stages
+}
+
+// Asc 升序排序字段
+func Asc(field string) bson.E {
+	return bson.E{Key: field, Value: 1}
+}
+
+// Desc 降序排序字段
+func Desc(field string) bson.E {
+	return bson.E{Key: field, Value: -1}
+}
+
+// Include 投影中包含的字段
+func Include(field string) bson.E {
+	return bson.E{Key: field, Value: 1}
+}
+
+// Exclude 投影中排除的字段
+func Exclude(field string) bson.E {
+	return bson.E{Key: field, Value: 0}
+}
+
+// Field 投影、$addFields中通过表达式计算的字段，如Field("year", bson.M{"$year": "$created_at"})
+func Field(field string, expr interface{}) bson.E {
+	return bson.E{Key: field, Value: expr}
+}
+
+// Sum $group中的$sum累加器
+func Sum(field string, expr interface{}) bson.E {
+	return accumulator(field, "$sum", expr)
+}
+
+// Count $group中统计文档数量的累加器
+func Count(field string) bson.E {
+	return accumulator(field, "$sum", 1)
+}
+
+// Avg $group中的$avg累加器
+func Avg(field string, expr interface{}) bson.E {
+	return accumulator(field, "$avg", expr)
+}
+
+// Min $group中的$min累加器
+func Min(field string, expr interface{}) bson.E {
+	return accumulator(field, "$min", expr)
+}
+
+// Max $group中的$max累加器
+func Max(field string, expr interface{}) bson.E {
+	return accumulator(field, "$max", expr)
+}
+
+// First $group中的$first累加器
+func First(field string, expr interface{}) bson.E {
+	return accumulator(field, "$first", expr)
+}
+
+// Last $group中的$last累加器
+func Last(field string, expr interface{}) bson.E {
+	return accumulator(field, "$last", expr)
+}
+
+// Push $group中的$push累加器
+func Push(field string, expr interface{}) bson.E {
+	return accumulator(field, "$push", expr)
+}
+
+// AddToSet $group中的$addToSet累加器
+func AddToSet(field string, expr interface{}) bson.E {
+	return accumulator(field, "$addToSet", expr)
+}
+
+func accumulator(field string, op string, expr interface{}) bson.E {
+	return bson.E{Key: field, Value: bson.D{{Key: op, Value: expr}}}
+}
@@ -0,0 +1,53 @@
+package pipeline
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBuilder(t *testing.T) {
+	pipeline := New().
+		Match(bson.M{"status": "paid"}).
+		Lookup("users", "user_id", "_id", "user").
+		Unwind("$user", true).
+		Group("$user_id", Sum("total", "$amount"), Count("orders"), First("name", "$user.name")).
+		Sort(Desc("total"), Asc("_id")).
+		Project(Include("total"), Exclude("_id"), Field("name", bson.M{"$toUpper": "$name"})).
+		Limit(10).
+		Build()
+
+	assert.Equal(t, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": "paid"}}},
+		{{Key: "$lookup", Value: bson.D{{Key: "from", Value: "users"}, {Key: "localField", Value: "user_id"}, {Key: "foreignField", Value: "_id"}, {Key: "as", Value: "user"}}}},
+		{{Key: "$unwind", Value: bson.D{{Key: "path", Value: "$user"}, {Key: "preserveNullAndEmptyArrays", Value: true}}}},
+		{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$user_id"},
+			{Key: "total", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
+			{Key: "orders", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "name", Value: bson.D{{Key: "$first", Value: "$user.name"}}},
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "total", Value: -1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$project", Value: bson.D{{Key: "total", Value: 1}, {Key: "_id", Value: 0}, {Key: "name", Value: bson.M{"$toUpper": "$name"}}}}},
+		{{Key: "$limit", Value: int64(10)}},
+	}, pipeline)
+}
+
+func TestBuilderFacet(t *testing.T) {
+	pipeline := New().Facet(map[string]*Builder{
+		"total": New().Count("count"),
+		"list":  New().Skip(20).Limit(10),
+	}).Build()
+
+	assert.Equal(t, mongo.Pipeline{
+		{{Key: "$facet", Value: bson.D{
+			{Key: "list", Value: mongo.Pipeline{{{Key: "$skip", Value: int64(20)}}, {{Key: "$limit", Value: int64(10)}}}},
+			{Key: "total", Value: mongo.Pipeline{{{Key: "$count", Value: "count"}}}},
+		}}},
+	}, pipeline)
+
+	_, err := bson.Marshal(bson.D{{Key: "pipeline", Value: pipeline}})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,109 @@
+package emongo
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gotomicro/ego/core/emetric"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var (
+	// poolEventCounter 连接池事件次数，event为checkout、checkout_failed、created、closed、cleared
+	poolEventCounter = emetric.CounterVecOpts{
+		Namespace: emetric.DefaultNamespace,
+		Name:      "mongo_pool_events_total",
+		Help:      "Number of mongo connection pool events by address, event and reason",
+		Labels:    []string{"name", "address", "event", "reason"},
+	}.Build()
+	// poolConnectionsGauge 连接池的连接数，state为open、in_use、max
+	poolConnectionsGauge = emetric.GaugeVecOpts{
+		Namespace: emetric.DefaultNamespace,
+		Name:      "mongo_pool_connections",
+		Help:      "Number of mongo connections by address and state",
+		Labels:    []string{"name", "address", "state"},
+	}.Build()
+	// poolCheckoutWaitHistogram 获取连接的等待时间，result为OK、Error
+	poolCheckoutWaitHistogram = emetric.HistogramVecOpts{
+		Namespace: emetric.DefaultNamespace,
+		Name:      "mongo_pool_checkout_wait_seconds",
+		Help:      "Time spent waiting to check out a mongo connection by address and result",
+		Labels:    []string{"name", "address", "result"},
+		Buckets:   []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5},
+	}.Build()
+)
+
+// checkoutWaits 记录每个节点正在获取连接的开始时间。驱动的事件中没有关联获取连接的开始和结束，
+// 按先进先出配对，并发获取时单次等待时间是近似值，等待时间的总和是准确的
+type checkoutWaits struct {
+	mu     sync.Mutex
+	starts map[string][]time.Time
+	now    func() time.Time
+}
+
+func (w *checkoutWaits) start(address string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.starts[address] = append(w.starts[address], w.now())
+}
+
+// finish 返回最早开始获取连接的等待时间，没有开始时间时返回false
+func (w *checkoutWaits) finish(address string) (time.Duration, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	starts := w.starts[address]
+	if len(starts) == 0 {
+		return 0, false
+	}
+	start := starts[0]
+	if len(starts) == 1 {
+		delete(w.starts, address)
+	} else {
+		w.starts[address] = starts[1:]
+	}
+	return w.now().Sub(start), true
+}
+
+// newPoolMonitor 将连接池事件记录为监控指标，in_use接近max时获取连接需要等待
+func newPoolMonitor(compName string) *event.PoolMonitor {
+	waits := &checkoutWaits{starts: make(map[string][]time.Time), now: time.Now}
+	observeWait := func(address string, result string) {
+		if wait, ok := waits.finish(address); ok {
+			poolCheckoutWaitHistogram.Observe(wait.Seconds(), compName, address, result)
+		}
+	}
+	return &event.PoolMonitor{
+		Event: func(evt *event.PoolEvent) {
+			switch evt.Type {
+			case event.GetStarted:
+				waits.start(evt.Address)
+			case event.PoolCreated:
+				if evt.PoolOptions != nil {
+					poolConnectionsGauge.Set(float64(evt.PoolOptions.MaxPoolSize), compName, evt.Address, "max")
+				}
+			case event.GetSucceeded:
+				observeWait(evt.Address, "OK")
+				poolEventCounter.Inc(compName, evt.Address, "checkout", "")
+				poolConnectionsGauge.Inc(compName, evt.Address, "in_use")
+			case event.GetFailed:
+				observeWait(evt.Address, "Error")
+				poolEventCounter.Inc(compName, evt.Address, "checkout_failed", evt.Reason)
+			case event.ConnectionReturned:
+				poolConnectionsGauge.Add(-1, compName, evt.Address, "in_use")
+			case event.ConnectionCreated:
+				poolEventCounter.Inc(compName, evt.Address, "created", "")
+				poolConnectionsGauge.Inc(compName, evt.Address, "open")
+			case event.ConnectionClosed:
+				poolEventCounter.Inc(compName, evt.Address, "closed", evt.Reason)
+				poolConnectionsGauge.Add(-1, compName, evt.Address, "open")
+			case event.PoolCleared:
+				poolEventCounter.Inc(compName, evt.Address, "cleared", "")
+			case event.PoolClosedEvent:
+				// 连接池关闭后不会再有获取连接的结束事件
+				waits.mu.Lock()
+				delete(waits.starts, evt.Address)
+				waits.mu.Unlock()
+			}
+		},
+	}
+}
@@ -0,0 +1,54 @@
+package emongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+func TestPoolMonitor(t *testing.T) {
+	monitor := newPoolMonitor("mongo.pool")
+	addr := "127.0.0.1:27017"
+	monitor.Event(&event.PoolEvent{Type: event.PoolCreated, Address: addr, PoolOptions: &event.MonitorPoolOptions{MaxPoolSize: 100}})
+	monitor.Event(&event.PoolEvent{Type: event.ConnectionCreated, Address: addr})
+	monitor.Event(&event.PoolEvent{Type: event.GetStarted, Address: addr})
+	monitor.Event(&event.PoolEvent{Type: event.GetSucceeded, Address: addr})
+	monitor.Event(&event.PoolEvent{Type: event.GetStarted, Address: addr})
+	monitor.Event(&event.PoolEvent{Type: event.GetSucceeded, Address: addr})
+	monitor.Event(&event.PoolEvent{Type: event.ConnectionReturned, Address: addr})
+	monitor.Event(&event.PoolEvent{Type: event.GetStarted, Address: addr})
+	monitor.Event(&event.PoolEvent{Type: event.GetFailed, Address: addr, Reason: event.ReasonTimedOut})
+
+	assert.Equal(t, float64(100), testutil.ToFloat64(poolConnectionsGauge.WithLabelValues("mongo.pool", addr, "max")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(poolConnectionsGauge.WithLabelValues("mongo.pool", addr, "open")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(poolConnectionsGauge.WithLabelValues("mongo.pool", addr, "in_use")))
+	assert.Equal(t, float64(2), testutil.ToFloat64(poolEventCounter.WithLabelValues("mongo.pool", addr, "checkout", "")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(poolEventCounter.WithLabelValues("mongo.pool", addr, "checkout_failed", event.ReasonTimedOut)))
+	assert.Equal(t, uint64(2), histogramCount(t, poolCheckoutWaitHistogram.WithLabelValues("mongo.pool", addr, "OK")))
+	assert.Equal(t, uint64(1), histogramCount(t, poolCheckoutWaitHistogram.WithLabelValues("mongo.pool", addr, "Error")))
+}
+
+func TestCheckoutWaits(t *testing.T) {
+	now := time.Unix(0, 0)
+	waits := &checkoutWaits{starts: make(map[string][]time.Time), now: func() time.Time { return now }}
+	waits.start("a")
+	now = now.Add(time.Second)
+	waits.start("a")
+	now = now.Add(2 * time.Second)
+
+	// 先进先出配对
+	wait, ok := waits.finish("a")
+	assert.True(t, ok)
+	assert.Equal(t, 3*time.Second, wait)
+	wait, ok = waits.finish("a")
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Second, wait)
+
+	// 没有开始时间时不记录
+	_, ok = waits.finish("a")
+	assert.False(t, ok)
+	assert.Empty(t, waits.starts)
+}
@@ -0,0 +1,70 @@
+package emongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+type readPrefKey struct{}
+
+type readConcernKey struct{}
+
+// WithReadPreference 返回指定读偏好的context，使用该context的查询（Find、FindOne、Aggregate、CountDocuments、Distinct、
+// EstimatedDocumentCount）按该读偏好选择节点，不影响其他查询
+//
+//	cursor, err := coll.Find(emongo.WithReadPreference(ctx, readpref.SecondaryPreferred()), filter)
+func WithReadPreference(ctx context.Context, rp *readpref.ReadPref) context.Context {
+	return context.WithValue(ctx, readPrefKey{}, rp)
+}
+
+// WithReadConcern 返回指定read concern的context，如readconcern.Majority()，作用的查询与WithReadPreference相同
+func WithReadConcern(ctx context.Context, rc *readconcern.ReadConcern) context.Context {
+	return context.WithValue(ctx, readConcernKey{}, rc)
+}
+
+// ReadFromSecondary 返回优先读从节点的context，从节点都不可用时读主节点
+func ReadFromSecondary(ctx context.Context) context.Context {
+	return WithReadPreference(ctx, readpref.SecondaryPreferred())
+}
+
+// ReadMajority 返回读取多数节点已确认数据的context
+func ReadMajority(ctx context.Context) context.Context {
+	return WithReadConcern(ctx, readconcern.Majority())
+}
+
+// collectionOptionsFromContext 返回context中的读偏好、read concern，都没有时返回nil
+func collectionOptionsFromContext(ctx context.Context) *options.CollectionOptions {
+	if ctx == nil {
+		return nil
+	}
+	rp, _ := ctx.Value(readPrefKey{}).(*readpref.ReadPref)
+	rc, _ := ctx.Value(readConcernKey{}).(*readconcern.ReadConcern)
+	if rp == nil && rc == nil {
+		return nil
+	}
+	opts := options.Collection()
+	if rp != nil {
+		opts.SetReadPreference(rp)
+	}
+	if rc != nil {
+		opts.SetReadConcern(rc)
+	}
+	return opts
+}
+
+// readColl 返回查询使用的集合，context中指定了读偏好、read concern时使用对应配置的集合
+func (wc *Collection) readColl(ctx context.Context) *mongo.Collection {
+	opts := collectionOptionsFromContext(ctx)
+	if opts == nil {
+		return wc.coll
+	}
+	coll, err := wc.coll.Clone(opts)
+	if err != nil {
+		return wc.coll
+	}
+	return coll
+}
@@ -0,0 +1,28 @@
+package emongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+func TestReadColl(t *testing.T) {
+	client, err := NewClient(options.Client().ApplyURI("mongodb://127.0.0.1:27017"))
+	require.NoError(t, err)
+	coll := &Collection{coll: client.Client().Database("test").Collection("orders")}
+
+	ctx := context.Background()
+	assert.Same(t, coll.coll, coll.readColl(ctx))
+
+	assert.Nil(t, collectionOptionsFromContext(ctx))
+
+	ctx = ReadMajority(ReadFromSecondary(ctx))
+	assert.NotSame(t, coll.coll, coll.readColl(ctx))
+	opts := collectionOptionsFromContext(ctx)
+	assert.Equal(t, readpref.SecondaryPreferredMode, opts.ReadPreference.Mode())
+	assert.Equal(t, "majority", opts.ReadConcern.GetLevel())
+}
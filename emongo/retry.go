@@ -0,0 +1,85 @@
+package emongo
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/gotomicro/ego/core/emetric"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// retryCounter 应用层重试次数，result为retry（发起一次重试）、recovered（重试后成功）、exhausted（重试次数用完仍失败）
+var retryCounter = emetric.CounterVecOpts{
+	Namespace: emetric.DefaultNamespace,
+	Name:      "mongo_retry_total",
+	Help:      "Number of application level mongo retries by operation and result",
+	Labels:    []string{"name", "operation", "result"},
+}.Build()
+
+// isRetryableError 是否为主节点切换、网络错误等可以重试的错误
+func isRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if mongo.IsNetworkError(err) || hasErrorLabel(err, "RetryableWriteError") {
+		return true
+	}
+	var se mongo.ServerError
+	if !errors.As(err, &se) {
+		return false
+	}
+	for code := range retryableWriteCodes {
+		if se.HasErrorCode(code) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryBackoff 第attempt次重试前的等待时间，按指数增长，不超过maxInterval，并加上随机抖动避免同时重试
+func retryBackoff(attempt int, interval time.Duration, maxInterval time.Duration) time.Duration {
+	backoff := interval
+	for i := 0; i < attempt && backoff < maxInterval; i++ {
+		backoff *= 2
+	}
+	if maxInterval > 0 && backoff > maxInterval {
+		backoff = maxInterval
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+}
+
+// Retry 执行fn，遇到网络错误、主节点切换等可重试错误时按退避时间重试，最多重试RetryMaxAttempts次，
+// 用于平滑副本集选主期间的失败，operation用于日志和监控。fn可能被执行多次，需要保证幂等
+func (c *Component) Retry(ctx context.Context, operation string, fn func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		if err == nil {
+			if attempt > 0 {
+				retryCounter.Inc(c.name, operation, "recovered")
+			}
+			return nil
+		}
+		if !isRetryableError(err) || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= c.config.RetryMaxAttempts {
+			retryCounter.Inc(c.name, operation, "exhausted")
+			return err
+		}
+
+		backoff := retryBackoff(attempt, c.config.RetryInterval, c.config.RetryMaxInterval)
+		c.logger.Warn("retry", elog.String("operation", operation), elog.FieldErr(err), elog.Int("attempt", attempt+1), elog.Duration("backoff", backoff))
+		retryCounter.Inc(c.name, operation, "retry")
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+	}
+}
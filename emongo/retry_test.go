@@ -0,0 +1,58 @@
+package emongo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	assert.True(t, isRetryableError(mongo.CommandError{Code: 10107, Name: "NotWritablePrimary"}))
+	assert.True(t, isRetryableError(mongo.CommandError{Code: 1, Labels: []string{"NetworkError"}}))
+	assert.True(t, isRetryableError(mongo.WriteException{WriteConcernError: &mongo.WriteConcernError{Code: 11602}}))
+	assert.False(t, isRetryableError(mongo.CommandError{Code: 11000}))
+	assert.False(t, isRetryableError(context.DeadlineExceeded))
+	assert.False(t, isRetryableError(errors.New("boom")))
+}
+
+func TestRetry(t *testing.T) {
+	conf := DefaultConfig()
+	conf.RetryMaxAttempts = 2
+	conf.RetryInterval = time.Millisecond
+	conf.RetryMaxInterval = 2 * time.Millisecond
+	cmp := &Component{name: "test", config: conf, logger: elog.DefaultLogger}
+
+	calls := 0
+	err := cmp.Retry(context.Background(), "find", func(ctx context.Context) error {
+		calls++
+		if calls < 2 {
+			return mongo.CommandError{Code: 189}
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	calls = 0
+	err = cmp.Retry(context.Background(), "find", func(ctx context.Context) error {
+		calls++
+		return mongo.CommandError{Code: 189}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	err = cmp.Retry(context.Background(), "insert", func(ctx context.Context) error {
+		calls++
+		return mongo.CommandError{Code: 11000}
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+
+	assert.LessOrEqual(t, int64(retryBackoff(10, time.Millisecond, 2*time.Millisecond)), int64(2*time.Millisecond))
+}
@@ -0,0 +1,166 @@
+package emongo
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/gotomicro/ego/core/emetric"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// slowCommandCounter 按集合和命令统计的慢查询次数
+var slowCommandCounter = emetric.CounterVecOpts{
+	Namespace: emetric.DefaultNamespace,
+	Name:      "mongo_slow_command_total",
+	Help:      "Number of mongo commands slower than slowLogThreshold",
+	Labels:    []string{"name", "collection", "command"},
+}.Build()
+
+// explainableCommands 可以执行explain的命令
+var explainableCommands = map[string]bool{
+	"find":          true,
+	"aggregate":     true,
+	"count":         true,
+	"distinct":      true,
+	"findAndModify": true,
+	"update":        true,
+	"delete":        true,
+}
+
+// explainTimeout explain的超时时间
+const explainTimeout = 5 * time.Second
+
+// maxConcurrentExplains 同时执行的explain数量，超过时慢日志中不记录执行计划，避免数据库变慢时explain进一步增加压力
+const maxConcurrentExplains = 4
+
+// observeSlow 记录慢查询日志，按采样率执行explain并记录执行计划
+func (m *commandMonitor) observeSlow(commandName string, started *startedCommand, cost time.Duration) {
+	slowCommandCounter.Inc(m.compName, started.collection, commandName)
+	fields := []elog.Field{
+		elog.FieldMethod(commandName),
+		elog.String("collection", started.collection),
+		elog.String("statement", sanitizeCommand(started.command)),
+		elog.FieldCost(cost),
+		elog.Duration("threshold", m.slowLogThreshold),
+	}
+	if m.client == nil || !explainableCommands[commandName] || !sampled(m.explainSampleRate) {
+		m.logger.Warn("slow", fields...)
+		return
+	}
+	if !m.acquireExplain() {
+		m.logger.Warn("slow", append(fields, elog.String("plan", "explain skipped, too many explains"))...)
+		return
+	}
+	// explain会再次访问数据库，不阻塞业务请求
+	go func() {
+		defer m.releaseExplain()
+		plan, err := m.explain(started)
+		if err != nil {
+			fields = append(fields, elog.String("plan", "explain fail: "+err.Error()))
+		} else {
+			fields = append(fields, elog.String("plan", plan))
+		}
+		m.logger.Warn("slow", fields...)
+	}()
+}
+
+// acquireExplain 获取执行explain的名额，正在执行的explain达到maxConcurrentExplains时返回false
+func (m *commandMonitor) acquireExplain() bool {
+	select {
+	case m.explains <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (m *commandMonitor) releaseExplain() {
+	<-m.explains
+}
+
+// explain 执行explain，返回执行计划摘要
+func (m *commandMonitor) explain(started *startedCommand) (string, error) {
+	elements, err := started.command.Elements()
+	if err != nil {
+		return "", err
+	}
+	command := make(bson.D, 0, len(elements))
+	for _, element := range elements {
+		if ignoredCommandFields[element.Key()] {
+			continue
+		}
+		command = append(command, bson.E{Key: element.Key(), Value: element.Value()})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+	defer cancel()
+	var result bson.M
+	err = m.client.Database(started.database).RunCommand(ctx, bson.D{
+		{Key: "explain", Value: command},
+		{Key: "verbosity", Value: "queryPlanner"},
+	}).Decode(&result)
+	if err != nil {
+		return "", err
+	}
+	return planSummary(result), nil
+}
+
+// planSummary 返回执行计划的阶段，如 IXSCAN(user_id_1) -> FETCH -> LIMIT
+func planSummary(explain bson.M) string {
+	planner, ok := explain["queryPlanner"].(bson.M)
+	if !ok {
+		// aggregate的执行计划在第一个阶段的$cursor中
+		if stages, ok := explain["stages"].(bson.A); ok && len(stages) > 0 {
+			if first, ok := stages[0].(bson.M); ok {
+				if cursor, ok := first["$cursor"].(bson.M); ok {
+					planner, _ = cursor["queryPlanner"].(bson.M)
+				}
+			}
+		}
+	}
+	plan, ok := planner["winningPlan"].(bson.M)
+	if !ok {
+		return ""
+	}
+	// 6.0以上版本使用SBE时执行计划在queryPlan中
+	if queryPlan, ok := plan["queryPlan"].(bson.M); ok {
+		plan = queryPlan
+	}
+	return strings.Join(planStages(plan), " -> ")
+}
+
+// planStages 从最内层的阶段开始返回执行计划的所有阶段
+func planStages(plan bson.M) []string {
+	stage, _ := plan["stage"].(string)
+	if index, ok := plan["indexName"].(string); ok {
+		stage += "(" + index + ")"
+	}
+	var stages []string
+	if input, ok := plan["inputStage"].(bson.M); ok {
+		stages = planStages(input)
+	}
+	if inputs, ok := plan["inputStages"].(bson.A); ok {
+		children := make([]string, 0, len(inputs))
+		for _, input := range inputs {
+			if input, ok := input.(bson.M); ok {
+				children = append(children, strings.Join(planStages(input), " -> "))
+			}
+		}
+		stages = []string{"[" + strings.Join(children, ", ") + "]"}
+	}
+	return append(stages, stage)
+}
+
+// sampled 按采样率决定是否执行，rate大于等于1时全部执行，小于等于0时不执行
+func sampled(rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	return rand.Float64() < rate
+}
@@ -0,0 +1,57 @@
+package emongo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPlanSummary(t *testing.T) {
+	find := bson.M{"queryPlanner": bson.M{"winningPlan": bson.M{
+		"stage": "LIMIT",
+		"inputStage": bson.M{
+			"stage":      "FETCH",
+			"inputStage": bson.M{"stage": "IXSCAN", "indexName": "user_id_1"},
+		},
+	}}}
+	assert.Equal(t, "IXSCAN(user_id_1) -> FETCH -> LIMIT", planSummary(find))
+
+	aggregate := bson.M{"stages": bson.A{
+		bson.M{"$cursor": bson.M{"queryPlanner": bson.M{"winningPlan": bson.M{"queryPlan": bson.M{"stage": "COLLSCAN"}}}}},
+	}}
+	assert.Equal(t, "COLLSCAN", planSummary(aggregate))
+
+	or := bson.M{"queryPlanner": bson.M{"winningPlan": bson.M{
+		"stage": "SUBPLAN",
+		"inputStage": bson.M{"stage": "OR", "inputStages": bson.A{
+			bson.M{"stage": "IXSCAN", "indexName": "a_1"},
+			bson.M{"stage": "IXSCAN", "indexName": "b_1"},
+		}},
+	}}}
+	assert.Equal(t, "[IXSCAN(a_1), IXSCAN(b_1)] -> OR -> SUBPLAN", planSummary(or))
+	assert.Equal(t, "", planSummary(bson.M{}))
+}
+
+func TestSampled(t *testing.T) {
+	assert.True(t, sampled(1))
+	assert.False(t, sampled(0))
+}
+
+func TestAcquireExplain(t *testing.T) {
+	m := newCommandMonitor("mongo", &config{SlowLogThreshold: time.Millisecond, ExplainSampleRate: 1}, elog.DefaultLogger)
+	for i := 0; i < maxConcurrentExplains; i++ {
+		assert.True(t, m.acquireExplain())
+	}
+	// 达到并发上限时不再执行explain
+	assert.False(t, m.acquireExplain())
+	m.releaseExplain()
+	assert.True(t, m.acquireExplain())
+}
+
+func TestSlowLogOptIn(t *testing.T) {
+	// 默认不开启慢日志，不开启监控、链路时不安装命令监听
+	assert.Equal(t, time.Duration(0), DefaultConfig().SlowLogThreshold)
+}
@@ -0,0 +1,181 @@
+package emongo
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type withDeletedKey struct{}
+
+// WithDeleted 返回不使用软删除的context，查询包含已删除的文档，删除为物理删除
+func WithDeleted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, withDeletedKey{}, true)
+}
+
+func isWithDeleted(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	withDeleted, _ := ctx.Value(withDeletedKey{}).(bool)
+	return withDeleted
+}
+
+// softDeleting 本次操作是否使用软删除
+func (wc *Collection) softDeleting(ctx context.Context) bool {
+	return wc.softDeleteField != "" && !isWithDeleted(ctx)
+}
+
+// notDeleted 在filter中加入软删除字段为null的条件
+func (wc *Collection) notDeleted(ctx context.Context, filter interface{}) interface{} {
+	if !wc.softDeleting(ctx) {
+		return filter
+	}
+	cond := bson.D{{Key: wc.softDeleteField, Value: nil}}
+	if filter == nil {
+		return cond
+	}
+	return bson.D{{Key: "$and", Value: bson.A{filter, cond}}}
+}
+
+// pipelineHeadStages 必须是pipeline第一个阶段的阶段，过滤已删除文档的$match加在这些阶段之后
+var pipelineHeadStages = map[string]bool{
+	"$geoNear":    true,
+	"$search":     true,
+	"$searchMeta": true,
+	"$collStats":  true,
+	"$indexStats": true,
+}
+
+// notDeletedPipeline 在pipeline的最前面（$geoNear、$search、$collStats等必须在最前面的阶段之后）加入过滤已删除文档的$match阶段，
+// 不支持的pipeline类型不做修改
+func (wc *Collection) notDeletedPipeline(ctx context.Context, pipeline interface{}) interface{} {
+	if !wc.softDeleting(ctx) {
+		return pipeline
+	}
+	match := bson.D{{Key: "$match", Value: bson.D{{Key: wc.softDeleteField, Value: nil}}}}
+	switch stages := pipeline.(type) {
+	case mongo.Pipeline:
+		i := matchPosition(len(stages), func(i int) interface{} { return stages[i] })
+		return append(append(append(mongo.Pipeline{}, stages[:i]...), match), stages[i:]...)
+	case []bson.D:
+		i := matchPosition(len(stages), func(i int) interface{} { return stages[i] })
+		return append(append(append([]bson.D{}, stages[:i]...), match), stages[i:]...)
+	case bson.A:
+		i := matchPosition(len(stages), func(i int) interface{} { return stages[i] })
+		return append(append(append(bson.A{}, stages[:i]...), match), stages[i:]...)
+	case []interface{}:
+		i := matchPosition(len(stages), func(i int) interface{} { return stages[i] })
+		return append(append(append([]interface{}{}, stages[:i]...), match), stages[i:]...)
+	}
+	return pipeline
+}
+
+// matchPosition 返回$match阶段插入的位置，即开头的pipelineHeadStages之后
+func matchPosition(n int, stage func(i int) interface{}) int {
+	i := 0
+	for i < n && pipelineHeadStages[stageName(stage(i))] {
+		i++
+	}
+	return i
+}
+
+// stageName 返回阶段的名称，如$match
+func stageName(stage interface{}) string {
+	switch s := stage.(type) {
+	case bson.D:
+		if len(s) > 0 {
+			return s[0].Key
+		}
+	case bson.M:
+		for name := range s {
+			return name
+		}
+	case map[string]interface{}:
+		for name := range s {
+			return name
+		}
+	}
+	return ""
+}
+
+// softDeleteModels 将BulkWrite中的删除转换为软删除，更新、替换只作用于没有删除的文档，不修改传入的models
+func (wc *Collection) softDeleteModels(ctx context.Context, models []mongo.WriteModel) []mongo.WriteModel {
+	if !wc.softDeleting(ctx) {
+		return models
+	}
+	ret := make([]mongo.WriteModel, 0, len(models))
+	for _, model := range models {
+		switch m := model.(type) {
+		case *mongo.DeleteOneModel:
+			model = &mongo.UpdateOneModel{Filter: wc.notDeleted(ctx, m.Filter), Update: wc.softDeleteUpdate(), Collation: m.Collation, Hint: m.Hint}
+		case *mongo.DeleteManyModel:
+			model = &mongo.UpdateManyModel{Filter: wc.notDeleted(ctx, m.Filter), Update: wc.softDeleteUpdate(), Collation: m.Collation, Hint: m.Hint}
+		case *mongo.UpdateOneModel:
+			copied := *m
+			copied.Filter = wc.notDeleted(ctx, m.Filter)
+			model = &copied
+		case *mongo.UpdateManyModel:
+			copied := *m
+			copied.Filter = wc.notDeleted(ctx, m.Filter)
+			model = &copied
+		case *mongo.ReplaceOneModel:
+			copied := *m
+			copied.Filter = wc.notDeleted(ctx, m.Filter)
+			model = &copied
+		}
+		ret = append(ret, model)
+	}
+	return ret
+}
+
+// softDeleteUpdate 将软删除字段设置为当前时间的更新
+func (wc *Collection) softDeleteUpdate() bson.D {
+	return bson.D{{Key: "$set", Value: bson.D{{Key: wc.softDeleteField, Value: time.Now()}}}}
+}
+
+// softDeleteOptions 将删除的选项转换为更新的选项
+func softDeleteOptions(opts []*options.DeleteOptions) *options.UpdateOptions {
+	deleteOpts := options.MergeDeleteOptions(opts...)
+	updateOpts := options.Update()
+	if deleteOpts.Collation != nil {
+		updateOpts.SetCollation(deleteOpts.Collation)
+	}
+	if deleteOpts.Hint != nil {
+		updateOpts.SetHint(deleteOpts.Hint)
+	}
+	return updateOpts
+}
+
+// softFindOneAndDeleteOptions 将FindOneAndDelete的选项转换为FindOneAndUpdate的选项，返回删除前的文档
+func softFindOneAndDeleteOptions(opts []*options.FindOneAndDeleteOptions) *options.FindOneAndUpdateOptions {
+	deleteOpts := options.MergeFindOneAndDeleteOptions(opts...)
+	updateOpts := options.FindOneAndUpdate().SetReturnDocument(options.Before)
+	if deleteOpts.Collation != nil {
+		updateOpts.SetCollation(deleteOpts.Collation)
+	}
+	if deleteOpts.MaxTime != nil {
+		updateOpts.SetMaxTime(*deleteOpts.MaxTime)
+	}
+	if deleteOpts.Projection != nil {
+		updateOpts.SetProjection(deleteOpts.Projection)
+	}
+	if deleteOpts.Sort != nil {
+		updateOpts.SetSort(deleteOpts.Sort)
+	}
+	if deleteOpts.Hint != nil {
+		updateOpts.SetHint(deleteOpts.Hint)
+	}
+	return updateOpts
+}
+
+// softDeleteResult 将更新的结果转换为删除的结果
+func softDeleteResult(res *mongo.UpdateResult) *mongo.DeleteResult {
+	if res == nil {
+		return nil
+	}
+	return &mongo.DeleteResult{DeletedCount: res.ModifiedCount}
+}
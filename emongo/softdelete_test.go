@@ -0,0 +1,97 @@
+package emongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestSoftDelete(t *testing.T) {
+	sd := newNamespaceField("deleted_at", []string{"shop.orders"})
+	assert.Equal(t, "deleted_at", sd.fieldFor("shop", "orders"))
+	assert.Equal(t, "", sd.fieldFor("shop", "users"))
+	assert.Nil(t, newNamespaceField("deleted_at", nil))
+	assert.Equal(t, "", (*namespaceField)(nil).fieldFor("shop", "orders"))
+
+	ctx := context.Background()
+	coll := &Collection{softDeleteField: "deleted_at"}
+	filter := bson.M{"user_id": 1}
+	assert.Equal(t, bson.D{{Key: "$and", Value: bson.A{filter, bson.D{{Key: "deleted_at", Value: nil}}}}}, coll.notDeleted(ctx, filter))
+	assert.Equal(t, bson.D{{Key: "deleted_at", Value: nil}}, coll.notDeleted(ctx, nil))
+	assert.Equal(t, filter, coll.notDeleted(WithDeleted(ctx), filter))
+	assert.Equal(t, filter, (&Collection{}).notDeleted(ctx, filter))
+
+	pipeline := coll.notDeletedPipeline(ctx, mongo.Pipeline{{{Key: "$limit", Value: 1}}})
+	assert.Equal(t, mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{{Key: "deleted_at", Value: nil}}}},
+		{{Key: "$limit", Value: 1}},
+	}, pipeline)
+
+	// $geoNear、$search、$collStats等必须是第一个阶段
+	geoNear := bson.D{{Key: "$geoNear", Value: bson.M{"near": bson.A{0, 0}, "distanceField": "dist"}}}
+	stages := mongo.Pipeline{geoNear, {{Key: "$limit", Value: 1}}}
+	assert.Equal(t, mongo.Pipeline{
+		geoNear,
+		{{Key: "$match", Value: bson.D{{Key: "deleted_at", Value: nil}}}},
+		{{Key: "$limit", Value: 1}},
+	}, coll.notDeletedPipeline(ctx, stages))
+	assert.Equal(t, mongo.Pipeline{geoNear, {{Key: "$limit", Value: 1}}}, stages, "caller's pipeline unchanged")
+	assert.Equal(t, bson.A{
+		bson.M{"$search": bson.M{"text": bson.M{"query": "a", "path": "name"}}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "deleted_at", Value: nil}}}},
+	}, coll.notDeletedPipeline(ctx, bson.A{bson.M{"$search": bson.M{"text": bson.M{"query": "a", "path": "name"}}}}))
+	assert.Equal(t, []bson.D{
+		{{Key: "$collStats", Value: bson.M{"count": bson.M{}}}},
+		{{Key: "$match", Value: bson.D{{Key: "deleted_at", Value: nil}}}},
+	}, coll.notDeletedPipeline(ctx, []bson.D{{{Key: "$collStats", Value: bson.M{"count": bson.M{}}}}}))
+}
+
+func TestSoftDeleteModels(t *testing.T) {
+	ctx := context.Background()
+	coll := &Collection{softDeleteField: "deleted_at"}
+	notDeleted := func(filter interface{}) interface{} {
+		return bson.D{{Key: "$and", Value: bson.A{filter, bson.D{{Key: "deleted_at", Value: nil}}}}}
+	}
+
+	update := mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": 2}).SetUpdate(bson.M{"$set": bson.M{"name": "a"}})
+	models := []mongo.WriteModel{
+		mongo.NewInsertOneModel().SetDocument(bson.M{"_id": 1}),
+		update,
+		mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": 3}).SetReplacement(bson.M{"name": "b"}),
+		mongo.NewDeleteOneModel().SetFilter(bson.M{"_id": 4}).SetHint("_id_"),
+		mongo.NewDeleteManyModel().SetFilter(bson.M{"user_id": 5}),
+	}
+	got := coll.softDeleteModels(ctx, models)
+	require.Len(t, got, 5)
+	assert.Same(t, models[0], got[0])
+	assert.Equal(t, notDeleted(bson.M{"_id": 2}), got[1].(*mongo.UpdateOneModel).Filter)
+	assert.Equal(t, bson.M{"_id": 2}, update.Filter, "caller's model unchanged")
+	assert.Equal(t, notDeleted(bson.M{"_id": 3}), got[2].(*mongo.ReplaceOneModel).Filter)
+
+	// 删除转换为设置删除时间的更新
+	deleteOne := got[3].(*mongo.UpdateOneModel)
+	assert.Equal(t, notDeleted(bson.M{"_id": 4}), deleteOne.Filter)
+	assert.Equal(t, "_id_", deleteOne.Hint)
+	assert.Equal(t, "deleted_at", deleteOne.Update.(bson.D)[0].Value.(bson.D)[0].Key)
+	deleteMany := got[4].(*mongo.UpdateManyModel)
+	assert.Equal(t, notDeleted(bson.M{"user_id": 5}), deleteMany.Filter)
+
+	// WithDeleted时为物理删除
+	assert.Equal(t, models, coll.softDeleteModels(WithDeleted(ctx), models))
+}
+
+func TestSoftDeleteOptions(t *testing.T) {
+	updateOpts := softDeleteOptions([]*options.DeleteOptions{options.Delete().SetHint("user_id_1")})
+	assert.Equal(t, "user_id_1", updateOpts.Hint)
+
+	findOpts := softFindOneAndDeleteOptions([]*options.FindOneAndDeleteOptions{options.FindOneAndDelete().SetSort(bson.M{"_id": -1})})
+	assert.Equal(t, options.Before, *findOpts.ReturnDocument)
+	assert.Equal(t, bson.M{"_id": -1}, findOpts.Sort)
+
+	assert.Equal(t, int64(2), softDeleteResult(&mongo.UpdateResult{MatchedCount: 2, ModifiedCount: 2}).DeletedCount)
+}
@@ -0,0 +1,123 @@
+package emongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+)
+
+const (
+	// labelTransientTransactionError 事务中的操作遇到临时错误，可以重试整个事务
+	labelTransientTransactionError = "TransientTransactionError"
+	// labelUnknownTransactionCommitResult 提交结果未知，可以重试提交
+	labelUnknownTransactionCommitResult = "UnknownTransactionCommitResult"
+)
+
+// WithTransaction 创建session并在事务中执行fn，fn返回错误时回滚事务。
+// 遇到TransientTransactionError时重试整个事务，遇到UnknownTransactionCommitResult时重试提交，
+// 重试次数为配置中的TransactionMaxRetries。fn可能被执行多次，不要在fn中执行非幂等的外部操作。
+//
+//	err := cmp.WithTransaction(ctx, func(sessCtx emongo.SessionContext) error {
+//		if _, err := orders.InsertOne(sessCtx, order); err != nil {
+//			return err
+//		}
+//		_, err := stocks.UpdateOne(sessCtx, bson.M{"_id": order.SkuID}, bson.M{"$inc": bson.M{"count": -1}})
+//		return err
+//	})
+func (c *Component) WithTransaction(ctx context.Context, fn func(sessCtx SessionContext) error, opts ...*options.TransactionOptions) error {
+	sess, err := c.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("emongo: start session fail, %w", err)
+	}
+	defer sess.EndSession(context.Background())
+
+	txnOpts := options.MergeTransactionOptions(append([]*options.TransactionOptions{c.txnOpts}, opts...)...)
+	for attempt := 0; ; attempt++ {
+		err = mongo.WithSession(ctx, sess, func(sessCtx SessionContext) error {
+			if err := sess.StartTransaction(txnOpts); err != nil {
+				return err
+			}
+			if err := fn(sessCtx); err != nil {
+				_ = sess.AbortTransaction(context.Background())
+				return err
+			}
+			return c.commitTransaction(sessCtx, sess)
+		})
+		if err == nil || attempt >= c.config.TransactionMaxRetries || !hasErrorLabel(err, labelTransientTransactionError) || ctx.Err() != nil {
+			return err
+		}
+		c.logger.Warn("retry transaction", elog.FieldErr(err), elog.Int("attempt", attempt+1))
+	}
+}
+
+// commitTransaction 提交事务，提交结果未知时重试提交
+func (c *Component) commitTransaction(ctx context.Context, sess Session) error {
+	for attempt := 0; ; attempt++ {
+		err := sess.CommitTransaction(ctx)
+		if err == nil || attempt >= c.config.TransactionMaxRetries || !hasErrorLabel(err, labelUnknownTransactionCommitResult) || ctx.Err() != nil {
+			return err
+		}
+		c.logger.Warn("retry commit transaction", elog.FieldErr(err), elog.Int("attempt", attempt+1))
+	}
+}
+
+// hasErrorLabel 判断错误是否带有服务端返回的label
+func hasErrorLabel(err error, label string) bool {
+	var se mongo.ServerError
+	return errors.As(err, &se) && se.HasErrorLabel(label)
+}
+
+// transactionOptions 根据配置生成事务的默认选项
+func transactionOptions(config *config) (*options.TransactionOptions, error) {
+	opts := options.Transaction()
+	rc, err := parseReadConcern(config.TransactionReadConcern)
+	if err != nil {
+		return nil, err
+	}
+	if rc != nil {
+		opts.SetReadConcern(rc)
+	}
+	wc, err := parseWriteConcern(config.TransactionWriteConcern)
+	if err != nil {
+		return nil, err
+	}
+	if wc != nil {
+		opts.SetWriteConcern(wc)
+	}
+	return opts, nil
+}
+
+// parseReadConcern 解析read concern，可选local、available、majority、linearizable、snapshot，为空时返回nil
+func parseReadConcern(level string) (*readconcern.ReadConcern, error) {
+	switch level {
+	case "":
+		return nil, nil
+	case "local", "available", "majority", "linearizable", "snapshot":
+		return readconcern.New(readconcern.Level(level)), nil
+	}
+	return nil, fmt.Errorf("emongo: unknown read concern %q", level)
+}
+
+// parseWriteConcern 解析write concern，可选majority或者确认写入的节点数量，为空时返回nil
+func parseWriteConcern(w string) (*writeconcern.WriteConcern, error) {
+	w = strings.TrimSpace(w)
+	if w == "" {
+		return nil, nil
+	}
+	if w == "majority" {
+		return writeconcern.New(writeconcern.WMajority()), nil
+	}
+	n, err := strconv.Atoi(w)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("emongo: unknown write concern %q", w)
+	}
+	return writeconcern.New(writeconcern.W(n)), nil
+}
@@ -0,0 +1,33 @@
+package emongo
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestTransactionOptions(t *testing.T) {
+	opts, err := transactionOptions(&config{TransactionReadConcern: "snapshot", TransactionWriteConcern: "majority"})
+	assert.NoError(t, err)
+	assert.Equal(t, "snapshot", opts.ReadConcern.GetLevel())
+	assert.Equal(t, "majority", opts.WriteConcern.GetW())
+
+	opts, err = transactionOptions(&config{TransactionWriteConcern: "2"})
+	assert.NoError(t, err)
+	assert.Nil(t, opts.ReadConcern)
+	assert.Equal(t, 2, opts.WriteConcern.GetW())
+
+	_, err = transactionOptions(&config{TransactionReadConcern: "unknown"})
+	assert.Error(t, err)
+	_, err = transactionOptions(&config{TransactionWriteConcern: "all"})
+	assert.Error(t, err)
+}
+
+func TestHasErrorLabel(t *testing.T) {
+	err := fmt.Errorf("insert fail, %w", mongo.CommandError{Labels: []string{labelTransientTransactionError}})
+	assert.True(t, hasErrorLabel(err, labelTransientTransactionError))
+	assert.False(t, hasErrorLabel(err, labelUnknownTransactionCommitResult))
+	assert.False(t, hasErrorLabel(fmt.Errorf("fail"), labelTransientTransactionError))
+}
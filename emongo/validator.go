@@ -0,0 +1,182 @@
+package emongo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/gotomicro/ego/core/elog"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Validator 集合的$jsonSchema校验规则
+type Validator struct {
+	Schema interface{} // $jsonSchema的内容，如bson.M{"bsonType": "object", "required": bson.A{"name"}}
+	Level  string      // validationLevel，可选strict、moderate，默认strict
+	Action string      // validationAction，可选error、warn，默认error
+}
+
+// CollectionValidator 集合的校验规则定义
+type CollectionValidator struct {
+	Database   string
+	Collection string
+	Validator  Validator
+}
+
+// ValidatorDiff 与数据库中不一致的校验规则
+type ValidatorDiff struct {
+	Namespace string // 库名.集合名
+	Detail    string // 不一致的原因
+}
+
+// ValidatorReport 校验规则检查结果
+type ValidatorReport struct {
+	DryRun  bool            // 是否只检查不修改
+	Missing []ValidatorDiff // 集合不存在或者没有校验规则，DryRun为false时已经创建
+	Changed []ValidatorDiff // 与数据库中的校验规则不一致，DryRun为false时已经更新
+}
+
+// HasDrift 数据库中的校验规则与声明是否不一致
+func (r *ValidatorReport) HasDrift() bool {
+	return len(r.Missing) > 0 || len(r.Changed) > 0
+}
+
+func (v Validator) level() string {
+	if v.Level == "" {
+		return "strict"
+	}
+	return v.Level
+}
+
+func (v Validator) action() string {
+	if v.Action == "" {
+		return "error"
+	}
+	return v.Action
+}
+
+// command 构建create、collMod命令
+func (v Validator) command(op string, collection string) bson.D {
+	return bson.D{
+		{Key: op, Value: collection},
+		{Key: "validator", Value: bson.D{{Key: "$jsonSchema", Value: v.Schema}}},
+		{Key: "validationLevel", Value: v.level()},
+		{Key: "validationAction", Value: v.action()},
+	}
+}
+
+// collectionSpec listCollections返回的集合信息
+type collectionSpec struct {
+	Options struct {
+		Validator        bson.Raw `bson:"validator"`
+		ValidationLevel  string   `bson:"validationLevel"`
+		ValidationAction string   `bson:"validationAction"`
+	} `bson:"options"`
+}
+
+// diff 返回声明与数据库中校验规则不一致的原因，一致时返回空
+func (v Validator) diff(spec collectionSpec) (string, error) {
+	declared, err := canonicalJSON(bson.D{{Key: "$jsonSchema", Value: v.Schema}})
+	if err != nil {
+		return "", err
+	}
+	existing, err := canonicalJSON(spec.Options.Validator)
+	if err != nil {
+		return "", err
+	}
+	if !reflect.DeepEqual(declared, existing) {
+		return "validator changed", nil
+	}
+	level, action := spec.Options.ValidationLevel, spec.Options.ValidationAction
+	if level == "" {
+		level = "strict"
+	}
+	if action == "" {
+		action = "error"
+	}
+	if v.level() != level {
+		return fmt.Sprintf("validationLevel %s != %s", v.level(), level), nil
+	}
+	if v.action() != action {
+		return fmt.Sprintf("validationAction %s != %s", v.action(), action), nil
+	}
+	return "", nil
+}
+
+// canonicalJSON 转换为与字段顺序、整数类型无关的结构，用于比较校验规则
+func canonicalJSON(v interface{}) (interface{}, error) {
+	if raw, ok := v.(bson.Raw); ok && len(raw) == 0 {
+		return nil, nil
+	}
+	data, err := bson.MarshalExtJSON(v, false, false)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EnsureValidators 对比WithValidator声明的校验规则与数据库中的校验规则，dryRun为false时创建集合或者通过collMod更新校验规则
+func (c *Component) EnsureValidators(ctx context.Context, dryRun bool) (*ValidatorReport, error) {
+	report := &ValidatorReport{DryRun: dryRun}
+	for _, cv := range c.config.validators {
+		db := c.client.Database(cv.Database)
+		namespace := cv.Database + "." + cv.Collection
+
+		specs := make([]collectionSpec, 0, 1)
+		cursor, err := db.ListCollections(ctx, bson.D{{Key: "name", Value: cv.Collection}})
+		if err != nil {
+			return nil, fmt.Errorf("emongo: list collection %s fail, %w", namespace, err)
+		}
+		if err := cursor.All(ctx, &specs); err != nil {
+			return nil, fmt.Errorf("emongo: decode collection %s fail, %w", namespace, err)
+		}
+
+		op := "collMod"
+		switch {
+		case len(specs) == 0:
+			op = "create"
+			report.Missing = append(report.Missing, ValidatorDiff{Namespace: namespace, Detail: "collection not exists"})
+		case len(specs[0].Options.Validator) == 0:
+			report.Missing = append(report.Missing, ValidatorDiff{Namespace: namespace, Detail: "validator not exists"})
+		default:
+			detail, err := cv.Validator.diff(specs[0])
+			if err != nil {
+				return nil, fmt.Errorf("emongo: compare validator of %s fail, %w", namespace, err)
+			}
+			if detail == "" {
+				continue
+			}
+			report.Changed = append(report.Changed, ValidatorDiff{Namespace: namespace, Detail: detail})
+		}
+		if dryRun {
+			continue
+		}
+		if err := db.RunCommand(ctx, cv.Validator.command(op, cv.Collection)).Err(); err != nil {
+			return nil, fmt.Errorf("emongo: %s validator of %s fail, %w", op, namespace, err)
+		}
+	}
+	return report, nil
+}
+
+// logValidatorReport 记录校验规则检查结果
+func (c *Component) logValidatorReport(report *ValidatorReport) {
+	for _, diff := range report.Missing {
+		if report.DryRun {
+			c.logger.Warn("validator missing", elog.String("namespace", diff.Namespace), elog.String("detail", diff.Detail))
+			continue
+		}
+		c.logger.Info("validator created", elog.String("namespace", diff.Namespace), elog.String("detail", diff.Detail))
+	}
+	for _, diff := range report.Changed {
+		if report.DryRun {
+			c.logger.Warn("validator changed", elog.String("namespace", diff.Namespace), elog.String("detail", diff.Detail))
+			continue
+		}
+		c.logger.Info("validator updated", elog.String("namespace", diff.Namespace), elog.String("detail", diff.Detail))
+	}
+}
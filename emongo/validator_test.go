@@ -0,0 +1,46 @@
+package emongo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestValidatorDiff(t *testing.T) {
+	v := Validator{Schema: bson.M{
+		"bsonType": "object",
+		"required": bson.A{"name", "age"},
+		"properties": bson.M{
+			"age": bson.M{"bsonType": "int", "minimum": 0},
+		},
+	}}
+
+	// 数据库返回的字段顺序、整数类型与声明不同
+	var spec collectionSpec
+	raw, err := bson.Marshal(bson.D{{Key: "$jsonSchema", Value: bson.D{
+		{Key: "properties", Value: bson.D{{Key: "age", Value: bson.D{{Key: "minimum", Value: int64(0)}, {Key: "bsonType", Value: "int"}}}}},
+		{Key: "required", Value: bson.A{"name", "age"}},
+		{Key: "bsonType", Value: "object"},
+	}}})
+	require.NoError(t, err)
+	spec.Options.Validator = raw
+	detail, err := v.diff(spec)
+	require.NoError(t, err)
+	assert.Empty(t, detail)
+
+	spec.Options.ValidationAction = "warn"
+	detail, err = v.diff(spec)
+	require.NoError(t, err)
+	assert.Equal(t, "validationAction error != warn", detail)
+
+	v.Schema = bson.M{"bsonType": "object", "required": bson.A{"name"}}
+	detail, err = v.diff(spec)
+	require.NoError(t, err)
+	assert.Equal(t, "validator changed", detail)
+
+	cmd := v.command("collMod", "users")
+	assert.Equal(t, bson.E{Key: "collMod", Value: "users"}, cmd[0])
+	assert.Equal(t, bson.E{Key: "validationLevel", Value: "strict"}, cmd[2])
+}
@@ -0,0 +1,187 @@
+package emongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrVersionConflict 乐观锁冲突，更新时文档的版本号已经被其他请求修改
+var ErrVersionConflict = errors.New("emongo: optimistic lock version conflict")
+
+type expectedVersionKey struct{}
+
+// WithExpectedVersion 返回带有期望版本号的context，开启乐观锁的集合UpdateOne时只更新该版本号的文档
+//
+//	_, err := coll.UpdateOne(emongo.WithExpectedVersion(ctx, order.Version), bson.M{"_id": order.ID}, bson.M{"$set": bson.M{"status": 2}})
+//	if errors.Is(err, emongo.ErrVersionConflict) {
+//		// 重新读取后重试
+//	}
+func WithExpectedVersion(ctx context.Context, version int64) context.Context {
+	return context.WithValue(ctx, expectedVersionKey{}, version)
+}
+
+func expectedVersion(ctx context.Context) (int64, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	version, ok := ctx.Value(expectedVersionKey{}).(int64)
+	return version, ok
+}
+
+// versionCond 版本号等于version的条件，版本号为0时匹配没有版本号的文档
+func versionCond(field string, version int64) bson.D {
+	if version == 0 {
+		return bson.D{{Key: field, Value: bson.D{{Key: "$in", Value: bson.A{0, nil}}}}}
+	}
+	return bson.D{{Key: field, Value: version}}
+}
+
+// versionedReplacement 读取替换文档中的版本号，返回版本号加1后的文档
+func versionedReplacement(field string, replacement interface{}) (bson.D, int64, error) {
+	doc, err := toBsonD(replacement)
+	if err != nil {
+		return nil, 0, err
+	}
+	var version int64
+	pos := -1
+	for i, e := range doc {
+		if e.Key != field {
+			continue
+		}
+		pos = i
+		switch v := e.Value.(type) {
+		case int32:
+			version = int64(v)
+		case int64:
+			version = v
+		case float64:
+			version = int64(v)
+		case nil:
+		default:
+			return nil, 0, fmt.Errorf("emongo: version field %s must be integer, got %T", field, e.Value)
+		}
+	}
+	if pos < 0 {
+		doc = append(doc, bson.E{Key: field, Value: version + 1})
+	} else {
+		doc[pos].Value = version + 1
+	}
+	return doc, version, nil
+}
+
+// versionedUpdate 在更新中加入版本号加1，更新中已经修改了版本号或者更新为pipeline时不做修改
+func versionedUpdate(field string, update interface{}) interface{} {
+	doc, err := toBsonD(update)
+	if err != nil {
+		return update
+	}
+	for i, e := range doc {
+		ops, err := toBsonD(e.Value)
+		if err != nil {
+			continue
+		}
+		for _, op := range ops {
+			if op.Key == field {
+				return update
+			}
+		}
+		if e.Key == "$inc" {
+			doc[i].Value = append(ops, bson.E{Key: field, Value: 1})
+			return doc
+		}
+	}
+	return append(doc, bson.E{Key: "$inc", Value: bson.D{{Key: field, Value: 1}}})
+}
+
+// toBsonD 将文档转换为bson.D，保持字段顺序
+func toBsonD(doc interface{}) (bson.D, error) {
+	if d, ok := doc.(bson.D); ok {
+		return append(bson.D(nil), d...), nil
+	}
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var d bson.D
+	if err := bson.Unmarshal(data, &d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// versionConflict 没有匹配到文档时，按原始条件判断文档是否存在，存在时为版本号冲突
+func (wc *Collection) versionConflict(ctx context.Context, filter interface{}, version int64, res *mongo.UpdateResult, err error) error {
+	if err != nil || res == nil || res.MatchedCount > 0 || res.UpsertedCount > 0 {
+		return err
+	}
+	count, err := wc.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return wc.versionConflictError(version)
+	}
+	return nil
+}
+
+// versionConflictError 返回版本号冲突的错误
+func (wc *Collection) versionConflictError(version int64) error {
+	return fmt.Errorf("%w: collection %s, version %d", ErrVersionConflict, wc.coll.Name(), version)
+}
+
+// versionedReplaceOne 替换时校验替换文档中的版本号，并将版本号加1。
+// 带版本号条件的upsert在版本号不一致时会插入新文档，因此先不插入替换，没有匹配的文档且文档不存在、版本号为0时才插入
+func (wc *Collection) versionedReplaceOne(ctx context.Context, filter, replacement interface{}, opts ...*options.ReplaceOptions) (*mongo.UpdateResult, error) {
+	doc, version, err := versionedReplacement(wc.versionField, replacement)
+	if err != nil {
+		return nil, err
+	}
+	cond := bson.D{{Key: "$and", Value: bson.A{filter, versionCond(wc.versionField, version)}}}
+	upsert := options.MergeReplaceOptions(opts...).Upsert
+	if upsert == nil || !*upsert {
+		res, err := wc.replaceOne(ctx, cond, doc, opts...)
+		return res, wc.versionConflict(ctx, filter, version, res, err)
+	}
+
+	res, err := wc.replaceOne(ctx, cond, doc, append(opts, options.Replace().SetUpsert(false))...)
+	if err := wc.versionConflict(ctx, filter, version, res, err); err != nil || res.MatchedCount > 0 || version != 0 {
+		return res, err
+	}
+	res, err = wc.replaceOne(ctx, cond, doc, opts...)
+	return res, wc.upsertConflict(version, err)
+}
+
+// versionedUpdateOne 更新时将版本号加1，context中有期望版本号时校验版本号，upsert的处理与versionedReplaceOne相同
+func (wc *Collection) versionedUpdateOne(ctx context.Context, filter, update interface{}, opts ...*options.UpdateOptions) (*mongo.UpdateResult, error) {
+	update = versionedUpdate(wc.versionField, update)
+	version, ok := expectedVersion(ctx)
+	if !ok {
+		return wc.updateOne(ctx, filter, update, opts...)
+	}
+	cond := bson.D{{Key: "$and", Value: bson.A{filter, versionCond(wc.versionField, version)}}}
+	upsert := options.MergeUpdateOptions(opts...).Upsert
+	if upsert == nil || !*upsert {
+		res, err := wc.updateOne(ctx, cond, update, opts...)
+		return res, wc.versionConflict(ctx, filter, version, res, err)
+	}
+
+	res, err := wc.updateOne(ctx, cond, update, append(opts, options.Update().SetUpsert(false))...)
+	if err := wc.versionConflict(ctx, filter, version, res, err); err != nil || res.MatchedCount > 0 || version != 0 {
+		return res, err
+	}
+	res, err = wc.updateOne(ctx, cond, update, opts...)
+	return res, wc.upsertConflict(version, err)
+}
+
+// upsertConflict 检查文档不存在后插入时，其他请求已经插入了文档，插入违反唯一索引，视为版本号冲突
+func (wc *Collection) upsertConflict(version int64, err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("%w: %v", wc.versionConflictError(version), err)
+	}
+	return err
+}
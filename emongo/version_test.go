@@ -0,0 +1,118 @@
+package emongo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type versionedOrder struct {
+	ID      int64 `bson:"_id"`
+	Status  int   `bson:"status"`
+	Version int64 `bson:"version"`
+}
+
+func TestVersionedReplacement(t *testing.T) {
+	doc, version, err := versionedReplacement("version", versionedOrder{ID: 1, Status: 2, Version: 3})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), version)
+	assert.Equal(t, bson.D{{Key: "_id", Value: int64(1)}, {Key: "status", Value: int32(2)}, {Key: "version", Value: int64(4)}}, doc)
+
+	doc, version, err = versionedReplacement("version", bson.M{"_id": 1})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), version)
+	assert.Equal(t, bson.E{Key: "version", Value: int64(1)}, doc[len(doc)-1])
+
+	_, _, err = versionedReplacement("version", bson.M{"version": "v1"})
+	assert.Error(t, err)
+}
+
+func TestVersionedUpdate(t *testing.T) {
+	assert.Equal(t, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "status", Value: int32(2)}}},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	}, versionedUpdate("version", bson.M{"$set": bson.M{"status": 2}}))
+
+	assert.Equal(t, bson.D{
+		{Key: "$inc", Value: bson.D{{Key: "count", Value: int32(1)}, {Key: "version", Value: 1}}},
+	}, versionedUpdate("version", bson.D{{Key: "$inc", Value: bson.M{"count": 1}}}))
+
+	update := bson.M{"$set": bson.M{"version": 10}}
+	assert.Equal(t, update, versionedUpdate("version", update))
+
+	pipeline := bson.A{bson.M{"$set": bson.M{"status": 2}}}
+	assert.Equal(t, pipeline, versionedUpdate("version", pipeline))
+}
+
+func TestVersionCond(t *testing.T) {
+	assert.Equal(t, bson.D{{Key: "version", Value: int64(3)}}, versionCond("version", 3))
+	assert.Equal(t, bson.D{{Key: "version", Value: bson.D{{Key: "$in", Value: bson.A{0, nil}}}}}, versionCond("version", 0))
+
+	version, ok := expectedVersion(WithExpectedVersion(context.Background(), 5))
+	assert.True(t, ok)
+	assert.Equal(t, int64(5), version)
+}
+
+func TestVersionedUpsert(t *testing.T) {
+	m := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	defer m.Close()
+	ctx := context.Background()
+	upsert := options.Replace().SetUpsert(true)
+	updateUpsert := func(mt *mtest.T) bool {
+		return mt.GetStartedEvent().Command.Lookup("updates").Array().Index(0).Value().Document().Lookup("upsert").Boolean()
+	}
+
+	m.Run("conflict", func(mt *mtest.T) {
+		coll := &Collection{coll: mt.Coll, processor: defaultProcessor, versionField: "version"}
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+			mtest.CreateCursorResponse(0, "db.orders", mtest.FirstBatch, bson.D{{Key: "n", Value: 1}}),
+		)
+		_, err := coll.ReplaceOne(ctx, bson.M{"_id": 1}, versionedOrder{ID: 1, Status: 2, Version: 3}, upsert)
+		assert.ErrorIs(t, err, ErrVersionConflict)
+		// 带版本号条件时不插入
+		assert.False(t, updateUpsert(mt))
+	})
+
+	m.Run("version without document", func(mt *mtest.T) {
+		coll := &Collection{coll: mt.Coll, processor: defaultProcessor, versionField: "version"}
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+			mtest.CreateCursorResponse(0, "db.orders", mtest.FirstBatch),
+		)
+		res, err := coll.ReplaceOne(ctx, bson.M{"_id": 1}, versionedOrder{ID: 1, Status: 2, Version: 3}, upsert)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), res.MatchedCount+res.UpsertedCount)
+	})
+
+	m.Run("insert new document", func(mt *mtest.T) {
+		coll := &Collection{coll: mt.Coll, processor: defaultProcessor, versionField: "version"}
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+			mtest.CreateCursorResponse(0, "db.orders", mtest.FirstBatch),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 0}, bson.E{Key: "upserted", Value: bson.A{bson.D{{Key: "index", Value: 0}, {Key: "_id", Value: 1}}}}),
+		)
+		res, err := coll.ReplaceOne(ctx, bson.M{"_id": 1}, versionedOrder{ID: 1, Status: 2}, upsert)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), res.UpsertedCount)
+		assert.False(t, updateUpsert(mt))
+		mt.GetStartedEvent()
+		assert.True(t, updateUpsert(mt))
+	})
+
+	m.Run("concurrent insert", func(mt *mtest.T) {
+		coll := &Collection{coll: mt.Coll, processor: defaultProcessor, versionField: "version"}
+		mt.AddMockResponses(
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 0}, bson.E{Key: "nModified", Value: 0}),
+			mtest.CreateCursorResponse(0, "db.orders", mtest.FirstBatch),
+			mtest.CreateWriteErrorsResponse(mtest.WriteError{Index: 0, Code: 11000, Message: "duplicate key"}),
+		)
+		_, err := coll.UpdateOne(WithExpectedVersion(ctx, 0), bson.M{"_id": 1}, bson.M{"$set": bson.M{"status": 2}}, options.Update().SetUpsert(true))
+		assert.ErrorIs(t, err, ErrVersionConflict)
+	})
+}
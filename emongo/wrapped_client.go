@@ -22,9 +22,11 @@ import (
 )
 
 type Client struct {
-	cc        *mongo.Client
-	processor processor
-	logMode   bool
+	cc         *mongo.Client
+	processor  processor
+	logMode    bool
+	softDelete *namespaceField
+	versioning *namespaceField
 }
 
 func NewClient(opts ...*options.ClientOptions) (*Client, error) {
@@ -79,7 +81,7 @@ func (wc *Client) Database(name string, opts ...*options.DatabaseOptions) *Datab
 	if db == nil {
 		return nil
 	}
-	return &Database{db: db, processor: wc.processor, logMode: wc.logMode}
+	return &Database{db: db, processor: wc.processor, logMode: wc.logMode, softDelete: wc.softDelete, versioning: wc.versioning}
 }
 
 func (wc *Client) Disconnect(ctx context.Context) error {
@@ -124,6 +126,9 @@ func (wc *Client) StartSession(opts ...*options.SessionOptions) (ss Session, err
 		logCmd(wc.logMode, c, "StartSession", ss)
 		return err
 	})
+	if err != nil {
+		return nil, err
+	}
 	return &session{Session: ss, logMode: wc.logMode, processor: wc.processor}, nil
 }
 
@@ -46,14 +46,17 @@ func logCmd(logMode bool, c *cmd, name string, res interface{}, req ...interface
 }
 
 type Collection struct {
-	coll      *mongo.Collection
-	processor processor
-	logMode   bool
+	coll            *mongo.Collection
+	processor       processor
+	logMode         bool
+	softDeleteField string
+	versionField    string
 }
 
 func (wc *Collection) Aggregate(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) (res *mongo.Cursor, err error) {
+	pipeline = wc.notDeletedPipeline(ctx, pipeline)
 	err = wc.processor(func(c *cmd) error {
-		res, err = wc.coll.Aggregate(ctx, pipeline, opts...)
+		res, err = wc.readColl(ctx).Aggregate(ctx, pipeline, opts...)
 		logCmd(wc.logMode, c, "Aggregate", res, pipeline)
 		return err
 	})
@@ -63,6 +66,7 @@ func (wc *Collection) Aggregate(ctx context.Context, pipeline interface{}, opts
 func (wc *Collection) BulkWrite(ctx context.Context, models []mongo.WriteModel, opts ...*options.BulkWriteOptions) (
 	res *mongo.BulkWriteResult, err error) {
 
+	models = wc.softDeleteModels(ctx, models)
 	err = wc.processor(func(c *cmd) error {
 		res, err = wc.coll.BulkWrite(ctx, models, opts...)
 		logCmd(wc.logMode, c, "BulkWrite", res, models)
@@ -81,8 +85,9 @@ func (wc *Collection) Clone(opts ...*options.CollectionOptions) (res *mongo.Coll
 }
 
 func (wc *Collection) CountDocuments(ctx context.Context, filter interface{}, opts ...*options.CountOptions) (res int64, err error) {
+	filter = wc.notDeleted(ctx, filter)
 	err = wc.processor(func(c *cmd) error {
-		res, err = wc.coll.CountDocuments(ctx, filter, opts...)
+		res, err = wc.readColl(ctx).CountDocuments(ctx, filter, opts...)
 		logCmd(wc.logMode, c, "CountDocuments", res, filter)
 		return err
 	})
@@ -94,6 +99,10 @@ func (wc *Collection) Database() *mongo.Database { return wc.coll.Database() }
 func (wc *Collection) DeleteMany(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (
 	res *mongo.DeleteResult, err error) {
 
+	if wc.softDeleting(ctx) {
+		updateRes, err := wc.UpdateMany(ctx, filter, wc.softDeleteUpdate(), softDeleteOptions(opts))
+		return softDeleteResult(updateRes), err
+	}
 	err = wc.processor(func(c *cmd) error {
 		res, err = wc.coll.DeleteMany(ctx, filter, opts...)
 		logCmd(wc.logMode, c, "DeleteMany", res, filter)
@@ -103,6 +112,10 @@ func (wc *Collection) DeleteMany(ctx context.Context, filter interface{}, opts .
 }
 
 func (wc *Collection) DeleteOne(ctx context.Context, filter interface{}, opts ...*options.DeleteOptions) (res *mongo.DeleteResult, err error) {
+	if wc.softDeleting(ctx) {
+		updateRes, err := wc.UpdateOne(ctx, filter, wc.softDeleteUpdate(), softDeleteOptions(opts))
+		return softDeleteResult(updateRes), err
+	}
 	err = wc.processor(func(c *cmd) error {
 		res, err = wc.coll.DeleteOne(ctx, filter, opts...)
 		logCmd(wc.logMode, c, "DeleteOne", res, filter)
@@ -112,8 +125,9 @@ func (wc *Collection) DeleteOne(ctx context.Context, filter interface{}, opts ..
 }
 
 func (wc *Collection) Distinct(ctx context.Context, fieldName string, filter interface{}, opts ...*options.DistinctOptions) (res []interface{}, err error) {
+	filter = wc.notDeleted(ctx, filter)
 	err = wc.processor(func(c *cmd) error {
-		res, err = wc.coll.Distinct(ctx, fieldName, filter, opts...)
+		res, err = wc.readColl(ctx).Distinct(ctx, fieldName, filter, opts...)
 		logCmd(wc.logMode, c, "Distinct", nil, fieldName, filter)
 		return err
 	})
@@ -127,9 +141,17 @@ func (wc *Collection) Drop(ctx context.Context) error {
 	})
 }
 
+// EstimatedDocumentCount 开启软删除时集合的元数据中包含已删除的文档，使用CountDocuments统计没有删除的文档
 func (wc *Collection) EstimatedDocumentCount(ctx context.Context, opts ...*options.EstimatedDocumentCountOptions) (res int64, err error) {
+	if wc.softDeleting(ctx) {
+		countOpts := options.Count()
+		if maxTime := options.MergeEstimatedDocumentCountOptions(opts...).MaxTime; maxTime != nil {
+			countOpts.SetMaxTime(*maxTime)
+		}
+		return wc.CountDocuments(ctx, nil, countOpts)
+	}
 	err = wc.processor(func(c *cmd) error {
-		res, err = wc.coll.EstimatedDocumentCount(ctx, opts...)
+		res, err = wc.readColl(ctx).EstimatedDocumentCount(ctx, opts...)
 		logCmd(wc.logMode, c, "EstimatedDocumentCount", res)
 		return err
 	})
@@ -137,8 +159,9 @@ func (wc *Collection) EstimatedDocumentCount(ctx context.Context, opts ...*optio
 }
 
 func (wc *Collection) Find(ctx context.Context, filter interface{}, opts ...*options.FindOptions) (res *mongo.Cursor, err error) {
+	filter = wc.notDeleted(ctx, filter)
 	err = wc.processor(func(c *cmd) error {
-		res, err = wc.coll.Find(ctx, filter, opts...)
+		res, err = wc.readColl(ctx).Find(ctx, filter, opts...)
 		logCmd(wc.logMode, c, "Find", res, filter)
 		return err
 	})
@@ -146,8 +169,9 @@ func (wc *Collection) Find(ctx context.Context, filter interface{}, opts ...*opt
 }
 
 func (wc *Collection) FindOne(ctx context.Context, filter interface{}, opts ...*options.FindOneOptions) (res *mongo.SingleResult) {
+	filter = wc.notDeleted(ctx, filter)
 	_ = wc.processor(func(c *cmd) error {
-		res = wc.coll.FindOne(ctx, filter, opts...)
+		res = wc.readColl(ctx).FindOne(ctx, filter, opts...)
 		logCmd(wc.logMode, c, "FindOne", res, filter)
 		return res.Err()
 	})
@@ -155,6 +179,9 @@ func (wc *Collection) FindOne(ctx context.Context, filter interface{}, opts ...*
 }
 
 func (wc *Collection) FindOneAndDelete(ctx context.Context, filter interface{}, opts ...*options.FindOneAndDeleteOptions) (res *mongo.SingleResult) {
+	if wc.softDeleting(ctx) {
+		return wc.FindOneAndUpdate(ctx, filter, wc.softDeleteUpdate(), softFindOneAndDeleteOptions(opts))
+	}
 	_ = wc.processor(func(c *cmd) error {
 		res = wc.coll.FindOneAndDelete(ctx, filter, opts...)
 		logCmd(wc.logMode, c, "FindOneAndDelete", res, filter)
@@ -164,6 +191,7 @@ func (wc *Collection) FindOneAndDelete(ctx context.Context, filter interface{},
 }
 
 func (wc *Collection) FindOneAndReplace(ctx context.Context, filter, replacement interface{}, opts ...*options.FindOneAndReplaceOptions) (res *mongo.SingleResult) {
+	filter = wc.notDeleted(ctx, filter)
 	_ = wc.processor(func(c *cmd) error {
 		res = wc.coll.FindOneAndReplace(ctx, filter, replacement, opts...)
 		logCmd(wc.logMode, c, "FindOneAndReplace", res, filter)
@@ -173,6 +201,7 @@ func (wc *Collection) FindOneAndReplace(ctx context.Context, filter, replacement
 }
 
 func (wc *Collection) FindOneAndUpdate(ctx context.Context, filter, update interface{}, opts ...*options.FindOneAndUpdateOptions) (res *mongo.SingleResult) {
+	filter = wc.notDeleted(ctx, filter)
 	_ = wc.processor(func(c *cmd) error {
 		res = wc.coll.FindOneAndUpdate(ctx, filter, update, opts...)
 		logCmd(wc.logMode, c, "FindOneAndReplace", res, filter)
@@ -204,6 +233,14 @@ func (wc *Collection) InsertOne(ctx context.Context, document interface{}, opts
 func (wc *Collection) Name() string { return wc.coll.Name() }
 
 func (wc *Collection) ReplaceOne(ctx context.Context, filter, replacement interface{}, opts ...*options.ReplaceOptions) (res *mongo.UpdateResult, err error) {
+	if wc.versionField != "" {
+		return wc.versionedReplaceOne(ctx, filter, replacement, opts...)
+	}
+	return wc.replaceOne(ctx, filter, replacement, opts...)
+}
+
+func (wc *Collection) replaceOne(ctx context.Context, filter, replacement interface{}, opts ...*options.ReplaceOptions) (res *mongo.UpdateResult, err error) {
+	filter = wc.notDeleted(ctx, filter)
 	_ = wc.processor(func(c *cmd) error {
 		res, err = wc.coll.ReplaceOne(ctx, filter, replacement, opts...)
 		logCmd(wc.logMode, c, "ReplaceOne", res, filter, replacement)
@@ -213,6 +250,7 @@ func (wc *Collection) ReplaceOne(ctx context.Context, filter, replacement interf
 }
 
 func (wc *Collection) UpdateMany(ctx context.Context, filter, replacement interface{}, opts ...*options.UpdateOptions) (res *mongo.UpdateResult, err error) {
+	filter = wc.notDeleted(ctx, filter)
 	_ = wc.processor(func(c *cmd) error {
 		res, err = wc.coll.UpdateMany(ctx, filter, replacement, opts...)
 		logCmd(wc.logMode, c, "UpdateMany", res, filter, replacement)
@@ -222,6 +260,14 @@ func (wc *Collection) UpdateMany(ctx context.Context, filter, replacement interf
 }
 
 func (wc *Collection) UpdateOne(ctx context.Context, filter, replacement interface{}, opts ...*options.UpdateOptions) (res *mongo.UpdateResult, err error) {
+	if wc.versionField != "" {
+		return wc.versionedUpdateOne(ctx, filter, replacement, opts...)
+	}
+	return wc.updateOne(ctx, filter, replacement, opts...)
+}
+
+func (wc *Collection) updateOne(ctx context.Context, filter, replacement interface{}, opts ...*options.UpdateOptions) (res *mongo.UpdateResult, err error) {
+	filter = wc.notDeleted(ctx, filter)
 	_ = wc.processor(func(c *cmd) error {
 		res, err = wc.coll.UpdateOne(ctx, filter, replacement, opts...)
 		logCmd(wc.logMode, c, "UpdateOne", res, filter, replacement)
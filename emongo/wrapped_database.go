@@ -26,10 +26,12 @@ import (
 )
 
 type Database struct {
-	mu        sync.Mutex
-	db        *mongo.Database
-	processor processor
-	logMode   bool
+	mu         sync.Mutex
+	db         *mongo.Database
+	processor  processor
+	logMode    bool
+	softDelete *namespaceField
+	versioning *namespaceField
 }
 
 func (wd *Database) Client() *Client {
@@ -51,7 +53,13 @@ func (wd *Database) Collection(name string, opts ...*options.CollectionOptions)
 	if coll == nil {
 		return nil
 	}
-	return &Collection{coll: coll, processor: wd.processor, logMode: wd.logMode}
+	return &Collection{
+		coll:            coll,
+		processor:       wd.processor,
+		logMode:         wd.logMode,
+		softDeleteField: wd.softDelete.fieldFor(wd.db.Name(), name),
+		versionField:    wd.versioning.fieldFor(wd.db.Name(), name),
+	}
 }
 
 func (wd *Database) Drop(ctx context.Context) error {
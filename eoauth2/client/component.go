@@ -82,7 +82,27 @@ func (c *Component) OauthLogin(w http.ResponseWriter, r *http.Request, req Oauth
 		Secure:   false,
 		HttpOnly: true,
 	})
-	http.Redirect(w, r, c.Client.AuthCodeURL(sEnc, oauth2.AccessTypeOnline), http.StatusFound)
+	opts := []oauth2.AuthCodeOption{oauth2.AccessTypeOnline}
+	if c.Config.EnablePKCE {
+		codeVerifier, err := genCodeVerifier()
+		if err != nil {
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     c.Config.OauthPKCECookieName,
+			Value:    codeVerifier,
+			MaxAge:   300,
+			Path:     "/",
+			Domain:   "",
+			Secure:   false,
+			HttpOnly: true,
+		})
+		opts = append(opts,
+			oauth2.SetAuthURLParam("code_challenge", codeChallengeS256(codeVerifier)),
+			oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+		)
+	}
+	http.Redirect(w, r, c.Client.AuthCodeURL(sEnc, opts...), http.StatusFound)
 	return
 }
 
@@ -139,7 +159,25 @@ func (c *Component) OauthCode(w http.ResponseWriter, r *http.Request) (*OauthTok
 		return ot, fmt.Errorf("state not equal")
 	}
 
-	jr, err := c.Client.Exchange(r.Context(), code)
+	var opts []oauth2.AuthCodeOption
+	if c.Config.EnablePKCE {
+		pkceCookie, err := r.Cookie(c.Config.OauthPKCECookieName)
+		if err != nil {
+			return ot, fmt.Errorf("get pkce cookie error,err: %w", err)
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     c.Config.OauthPKCECookieName,
+			Value:    "",
+			MaxAge:   -1,
+			Path:     "/",
+			Domain:   "",
+			Secure:   false,
+			HttpOnly: true,
+		})
+		opts = append(opts, oauth2.SetAuthURLParam("code_verifier", pkceCookie.Value))
+	}
+
+	jr, err := c.Client.Exchange(r.Context(), code, opts...)
 	if err != nil {
 		return ot, fmt.Errorf("code exchange error, err: %w", err)
 	}
@@ -156,6 +194,22 @@ func genRandState() (string, error) {
 	return base64.URLEncoding.EncodeToString(rnd), nil
 }
 
+// genCodeVerifier 生成PKCE的code_verifier，43个字符
+func genCodeVerifier() (string, error) {
+	rnd := make([]byte, 32)
+	if _, err := rand.Read(rnd); err != nil {
+		elog.Error("failed to generate code verifier", zap.Error(err))
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(rnd), nil
+}
+
+// codeChallengeS256 S256方式的code_challenge
+func codeChallengeS256(codeVerifier string) string {
+	hash := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
 func (c *Component) hashStateCode(code, seed string) string {
 	hashBytes := sha256.Sum256([]byte(code + c.Config.ClientID + seed))
 	return hex.EncodeToString(hashBytes[:])
@@ -9,11 +9,14 @@ type Config struct {
 	RedirectURL          string
 	UserInfoURL          string
 	OauthStateCookieName string
+	EnablePKCE           bool   // 开启PKCE（rfc7636），使用S256的code_challenge，防止code被截获后换取token
+	OauthPKCECookieName  string // 开启PKCE时保存code_verifier的cookie
 }
 
 // DefaultConfig 定义默认配置
 func DefaultConfig() *Config {
 	return &Config{
 		OauthStateCookieName: "ego_oauth_state",
+		OauthPKCECookieName:  "ego_oauth_pkce",
 	}
 }
@@ -4,15 +4,18 @@ go 1.16
 
 require (
 	github.com/HdrHistogram/hdrhistogram-go v1.1.0 // indirect
+	github.com/alicebob/miniredis/v2 v2.14.3
 	github.com/go-redis/redis/v8 v8.8.1-0.20210327152210-1e30221353c4
 	github.com/gotomicro/ego v0.8.0
 	github.com/gotomicro/ego-component/egorm v0.2.1
 	github.com/gotomicro/ego-component/eredis v0.2.3-0.20210616023629-a1d9cf7b56a5
 	github.com/pborman/uuid v1.2.1
 	github.com/spf13/cast v1.3.1
+	github.com/stretchr/testify v1.7.0
 	github.com/uber/jaeger-lib v2.4.1+incompatible // indirect
 	github.com/vmihailenco/msgpack v4.0.4+incompatible
 	go.uber.org/zap v1.17.0
 	golang.org/x/oauth2 v0.0.0-20200107190931-bf48bf16ab8d
+	gorm.io/driver/sqlite v1.1.4
 	gorm.io/gorm v1.21.3
 )
@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -64,7 +65,14 @@ type AccessRequestParam struct {
 
 func (ar *AccessRequest) handleAuthorizationCodeRequest(ctx context.Context, param AccessRequestParam) *AccessRequest {
 	// get client authentication
-	auth := ar.getClientAuth(param.ClientAuthParam, ar.config.AllowClientSecretInParams)
+	// public clients (mobile, SPA) can't keep a secret, they authenticate with client_id and code_verifier
+	publicClient := param.CodeVerifier != "" && param.ClientId != "" && param.ClientSecret == "" && param.Authorization == ""
+	var auth *BasicAuth
+	if publicClient {
+		auth = &BasicAuth{Username: param.ClientId}
+	} else {
+		auth = ar.getClientAuth(param.ClientAuthParam, ar.config.AllowClientSecretInParams)
+	}
 	if auth == nil {
 		ar.setError(E_INVALID_GRANT, nil, "getClientAuth_request=%s", "getClientAuth is required")
 		return ar
@@ -135,6 +143,13 @@ func (ar *AccessRequest) handleAuthorizationCodeRequest(ctx context.Context, par
 		return ar
 	}
 
+	// public client must use PKCE, otherwise anyone who intercepts the code can exchange it
+	if publicClient && len(ar.AuthorizeData.CodeChallenge) == 0 {
+		ar.setError(E_INVALID_GRANT, errors.New("code_challenge (rfc7636) required for public clients"),
+			"auth_code_request=%s", "pkce code challenge is missing")
+		return ar
+	}
+
 	// Verify PKCE, if present in the authorization data
 	if len(ar.AuthorizeData.CodeChallenge) > 0 {
 		// https://tools.ietf.org/html/rfc7636#section-4.1
@@ -157,7 +172,7 @@ func (ar *AccessRequest) handleAuthorizationCodeRequest(ctx context.Context, par
 				"auth_code_request=%s", "pkce transform algorithm not supported (rfc7636)")
 			return ar
 		}
-		if codeVerifier != ar.AuthorizeData.CodeChallenge {
+		if subtle.ConstantTimeCompare([]byte(codeVerifier), []byte(ar.AuthorizeData.CodeChallenge)) != 1 {
 			ar.setError(E_INVALID_GRANT, errors.New("code_verifier failed comparison with code_challenge"),
 				"auth_code_request=%s", "pkce code verifier does not match challenge")
 			return ar
@@ -199,6 +214,10 @@ func (ar *AccessRequest) handleRefreshTokenRequest(ctx context.Context, param Ac
 	// must be a valid refresh code
 	var err error
 	ar.AccessData, err = ar.config.storage.LoadRefresh(ctx, ar.Code)
+	if errors.Is(err, ErrRefreshTokenReused) {
+		ar.setError(E_INVALID_GRANT, err, "refresh_token=%s", "refresh token reused, token family revoked")
+		return ar
+	}
 	if err != nil {
 		ar.setError(E_INVALID_GRANT, err, "refresh_token=%s", "error loading access data")
 		return ar
@@ -413,6 +432,23 @@ func (ar *AccessRequest) Build(options ...AccessRequestOption) error {
 		return fmt.Errorf("Build error4, err %w", ar.responseErr)
 	}
 
+	// rotate refresh token after the new token is saved, so that it can be used only once,
+	// and a failed save doesn't burn the refresh token.
+	// concurrent requests with the same refresh token, only one of them can succeed
+	rotator, rotate := ar.config.storage.(RefreshTokenRotator)
+	rotate = rotate && ar.Type == REFRESH_TOKEN && !ar.config.RetainTokenAfterRefresh
+	if rotate {
+		if err = rotator.RotateRefresh(ar.Ctx, ar.Code); err != nil {
+			// the new token must not be used
+			if ret.RefreshToken != "" {
+				ar.config.storage.RemoveRefresh(ar.Ctx, ret.RefreshToken)
+			}
+			ar.config.storage.RemoveAccess(ar.Ctx, ret.AccessToken)
+			ar.setError(E_INVALID_GRANT, err, "finish_access_request=%s", "error rotating refresh token")
+			return fmt.Errorf("Build error5, err %w", ar.responseErr)
+		}
+	}
+
 	// remove authorization token
 	if ret.AuthorizeData != nil {
 		ar.config.storage.RemoveAuthorize(ar.Ctx, ret.AuthorizeData.Code)
@@ -420,7 +456,8 @@ func (ar *AccessRequest) Build(options ...AccessRequestOption) error {
 
 	// remove previous access token
 	if ret.AccessData != nil && !ar.config.RetainTokenAfterRefresh {
-		if ret.AccessData.RefreshToken != "" {
+		// rotated refresh token is kept as used for reuse detection
+		if ret.AccessData.RefreshToken != "" && !rotate {
 			ar.config.storage.RemoveRefresh(ar.Ctx, ret.AccessData.RefreshToken)
 		}
 		ar.config.storage.RemoveAccess(ar.Ctx, ret.AccessData.AccessToken)
@@ -0,0 +1,226 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStorage 记录刷新token时对存储的调用顺序，clients、authorize用于授权码换取token
+type fakeStorage struct {
+	Storage
+	saveErr   error
+	rotateErr error
+	calls     []string
+	clients   map[string]Client
+	authorize *AuthorizeData
+}
+
+func (s *fakeStorage) GetClient(ctx context.Context, id string) (Client, error) {
+	client, ok := s.clients[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return client, nil
+}
+
+func (s *fakeStorage) LoadAuthorize(ctx context.Context, code string) (*AuthorizeData, error) {
+	if s.authorize == nil || s.authorize.Code != code {
+		return nil, ErrNotFound
+	}
+	return s.authorize, nil
+}
+
+func (s *fakeStorage) SaveAccess(ctx context.Context, data *AccessData) error {
+	s.calls = append(s.calls, "save")
+	return s.saveErr
+}
+
+func (s *fakeStorage) RotateRefresh(ctx context.Context, token string) error {
+	s.calls = append(s.calls, "rotate "+token)
+	return s.rotateErr
+}
+
+func (s *fakeStorage) RemoveAccess(ctx context.Context, token string) error {
+	s.calls = append(s.calls, "remove access "+token)
+	return nil
+}
+
+func (s *fakeStorage) RemoveRefresh(ctx context.Context, token string) error {
+	s.calls = append(s.calls, "remove refresh "+token)
+	return nil
+}
+
+func newRefreshRequest(storage Storage) *AccessRequest {
+	config := DefaultConfig()
+	config.storage = storage
+	config.accessTokenGen = accessTokenGenFunc(func(data *AccessData, generateRefresh bool) (string, string, error) {
+		return "new-access", "new-refresh", nil
+	})
+	return &AccessRequest{
+		Type:            REFRESH_TOKEN,
+		Code:            "old-refresh",
+		Client:          &DefaultClient{Id: "client"},
+		AccessData:      &AccessData{AccessToken: "old-access", RefreshToken: "old-refresh"},
+		GenerateRefresh: true,
+		Context:         &Context{Ctx: context.Background(), logger: elog.DefaultLogger, output: make(ResponseData)},
+		config:          config,
+	}
+}
+
+type accessTokenGenFunc func(data *AccessData, generateRefresh bool) (string, string, error)
+
+func (f accessTokenGenFunc) GenerateAccessToken(data *AccessData, generateRefresh bool) (string, string, error) {
+	return f(data, generateRefresh)
+}
+
+func TestAccessRequestBuildRotateRefresh(t *testing.T) {
+	storage := &fakeStorage{}
+	ar := newRefreshRequest(storage)
+	require.NoError(t, ar.Build(WithAccessRequestAuthorized(true)))
+	// 轮换之后的refresh token保留用于检测重复使用
+	assert.Equal(t, []string{"save", "rotate old-refresh", "remove access old-access"}, storage.calls)
+	assert.Equal(t, "new-refresh", ar.GetOutput("refresh_token"))
+}
+
+func TestAccessRequestBuildSaveFailed(t *testing.T) {
+	// 保存失败时不轮换refresh token，客户端可以重试
+	storage := &fakeStorage{saveErr: errors.New("db down")}
+	ar := newRefreshRequest(storage)
+	require.Error(t, ar.Build(WithAccessRequestAuthorized(true)))
+	assert.Equal(t, []string{"save"}, storage.calls)
+}
+
+func TestAccessRequestBuildRefreshReused(t *testing.T) {
+	storage := &fakeStorage{rotateErr: ErrRefreshTokenReused}
+	ar := newRefreshRequest(storage)
+	require.Error(t, ar.Build(WithAccessRequestAuthorized(true)))
+	// 新签发的token被删除，之前的token由存储吊销
+	assert.Equal(t, []string{"save", "rotate old-refresh", "remove refresh new-refresh", "remove access new-access"}, storage.calls)
+	assert.Equal(t, E_INVALID_GRANT, ar.GetOutput("error"))
+	assert.Nil(t, ar.GetOutput("access_token"))
+}
+
+func TestAccessRequestBuildRetainToken(t *testing.T) {
+	storage := &fakeStorage{}
+	ar := newRefreshRequest(storage)
+	ar.config.RetainTokenAfterRefresh = true
+	require.NoError(t, ar.Build(WithAccessRequestAuthorized(true)))
+	assert.Equal(t, []string{"save"}, storage.calls)
+}
+
+func TestAccessRequestPKCE(t *testing.T) {
+	// rfc7636 附录B的示例
+	const (
+		verifier  = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+		challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+		other     = "0123456789012345678901234567890123456789abc"
+	)
+	public := &DefaultClient{Id: "spa", RedirectUri: "https://spa.example.com/cb"}
+	confidential := &DefaultClient{Id: "web", Secret: "secret", RedirectUri: "https://web.example.com/cb"}
+	basicAuth := "Basic " + base64.StdEncoding.EncodeToString([]byte("web:secret"))
+	tests := []struct {
+		name      string
+		client    Client
+		challenge string
+		method    string
+		param     AccessRequestParam
+		wantErr   string
+	}{
+		{
+			name:      "public client S256",
+			client:    public,
+			challenge: challenge,
+			method:    PKCE_S256,
+			param:     AccessRequestParam{CodeVerifier: verifier, ClientAuthParam: ClientAuthParam{ClientId: "spa"}},
+		},
+		{
+			name:      "public client plain",
+			client:    public,
+			challenge: verifier,
+			method:    PKCE_PLAIN,
+			param:     AccessRequestParam{CodeVerifier: verifier, ClientAuthParam: ClientAuthParam{ClientId: "spa"}},
+		},
+		{
+			name:      "wrong verifier",
+			client:    public,
+			challenge: challenge,
+			method:    PKCE_S256,
+			param:     AccessRequestParam{CodeVerifier: other, ClientAuthParam: ClientAuthParam{ClientId: "spa"}},
+			wantErr:   E_INVALID_GRANT,
+		},
+		{
+			name:      "invalid verifier format",
+			client:    public,
+			challenge: challenge,
+			method:    PKCE_S256,
+			param:     AccessRequestParam{CodeVerifier: "short", ClientAuthParam: ClientAuthParam{ClientId: "spa"}},
+			wantErr:   E_INVALID_REQUEST,
+		},
+		{
+			name:    "public client without challenge",
+			client:  public,
+			param:   AccessRequestParam{CodeVerifier: verifier, ClientAuthParam: ClientAuthParam{ClientId: "spa"}},
+			wantErr: E_INVALID_GRANT,
+		},
+		{
+			// 不带secret时按公开客户端处理，有secret的客户端校验失败
+			name:      "confidential client with empty secret",
+			client:    confidential,
+			challenge: challenge,
+			method:    PKCE_S256,
+			param:     AccessRequestParam{CodeVerifier: verifier, ClientAuthParam: ClientAuthParam{ClientId: "web"}},
+			wantErr:   E_UNAUTHORIZED_CLIENT,
+		},
+		{
+			name:      "confidential client with secret and PKCE",
+			client:    confidential,
+			challenge: challenge,
+			method:    PKCE_S256,
+			param:     AccessRequestParam{CodeVerifier: verifier, ClientAuthParam: ClientAuthParam{Authorization: basicAuth}},
+		},
+		{
+			name:   "confidential client without PKCE",
+			client: confidential,
+			param:  AccessRequestParam{ClientAuthParam: ClientAuthParam{ClientId: "web", ClientSecret: "secret"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &fakeStorage{
+				clients: map[string]Client{public.Id: public, confidential.Id: confidential},
+				authorize: &AuthorizeData{
+					Client:              tt.client,
+					Code:                "code",
+					ExpiresIn:           60,
+					RedirectUri:         tt.client.GetRedirectUri(),
+					CreatedAt:           time.Now(),
+					CodeChallenge:       tt.challenge,
+					CodeChallengeMethod: tt.method,
+				},
+			}
+			config := DefaultConfig()
+			config.storage = storage
+			ar := &AccessRequest{
+				Context: &Context{Ctx: context.Background(), logger: elog.DefaultLogger, output: make(ResponseData)},
+				config:  config,
+			}
+			param := tt.param
+			param.Code = "code"
+			ar = ar.handleAuthorizationCodeRequest(context.Background(), param)
+			if tt.wantErr == "" {
+				require.False(t, ar.IsError(), "%v", ar.internalErr)
+				assert.Equal(t, tt.client.GetId(), ar.Client.GetId())
+				return
+			}
+			assert.True(t, ar.IsError())
+			assert.Equal(t, tt.wantErr, ar.GetOutput("error"))
+		})
+	}
+}
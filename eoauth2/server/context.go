@@ -110,7 +110,7 @@ func (c *Context) setError(responseError string, internalError error, debugForma
 	c.output = make(ResponseData) // clear output
 	c.output["error"] = c.responseErr.Error()
 	c.output["state"] = state
-	c.logger.Error("set error", zap.Any("internalErr", c.internalErr), zap.String("errDescription", fmt.Sprintf(debugFormat, debugArgs)))
+	c.logger.Error("set error", zap.Any("internalErr", c.internalErr), zap.String("errDescription", fmt.Sprintf(debugFormat, debugArgs...)))
 }
 
 func (c *Context) setRedirectFragment(f bool) {
@@ -11,6 +11,10 @@ var (
 	// client is not found. All other returned errors must be treated as storage-specific errors,
 	// like "connection lost", "connection refused", etc.
 	ErrNotFound = errors.New("Entity not found")
+	// ErrRefreshTokenReused is the error returned by LoadRefresh and RotateRefresh when a refresh
+	// token that has already been rotated is presented again. The storage must revoke the whole
+	// token family before returning it, since either the client or an attacker holds a stolen token.
+	ErrRefreshTokenReused = errors.New("Refresh token reused")
 )
 
 // Storage interface
@@ -58,3 +62,14 @@ type Storage interface {
 	// RemoveRefresh revokes or deletes refresh AccessData.
 	RemoveRefresh(ctx context.Context, token string) error
 }
+
+// RefreshTokenRotator is implemented by storages that support refresh token rotation.
+// A refresh token can be used only once: the old refresh token is marked as used instead of
+// being removed, and every refresh token derived from the same authorization belongs to one family.
+// Presenting a used refresh token revokes the whole family.
+type RefreshTokenRotator interface {
+	// RotateRefresh atomically marks the refresh token as used.
+	// It's called after the new AccessData is saved, the new tokens are removed if it fails.
+	// Returns ErrRefreshTokenReused if it was already used, after revoking its token family.
+	RotateRefresh(ctx context.Context, token string) error
+}
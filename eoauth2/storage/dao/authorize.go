@@ -19,6 +19,9 @@ type Authorize struct {
 	State       string `gorm:"not null" json:"state" form:"state"`                      // 状态
 	Extra       string `gorm:"not null;type:longtext" json:"extra" form:"extra"`        // 额外信息
 	Ctime       int64  `gorm:"not null" json:"ctime" form:"ctime"`                      // 创建时间
+	// CodeChallenge PKCE的code_challenge，换取token时校验code_verifier
+	CodeChallenge       string `gorm:"not null" json:"codeChallenge" form:"codeChallenge"`
+	CodeChallengeMethod string `gorm:"not null" json:"codeChallengeMethod" form:"codeChallengeMethod"` // PKCE的code_challenge_method，plain或者S256
 }
 
 func (t *Authorize) TableName() string {
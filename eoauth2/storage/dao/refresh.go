@@ -3,6 +3,7 @@ package dao
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/gotomicro/ego-component/egorm"
 	"gorm.io/gorm"
@@ -12,6 +13,9 @@ type Refresh struct {
 	Id     int    `gorm:"not null;primary_key;AUTO_INCREMENT" json:"id" form:"id"` // FormID
 	Token  string `gorm:"not null" json:"token" form:"token"`                      // token
 	Access string `gorm:"not null" json:"access" form:"access"`                    // access
+	Family string `gorm:"not null" json:"family" form:"family"`                    // token family，同一次授权轮换出的refresh token属于同一个family
+	UsedAt int64  `gorm:"not null" json:"usedAt" form:"usedAt"`                    // 使用时间，已使用的refresh token再次使用时吊销整个family
+	Ctime  int64  `gorm:"not null" json:"ctime" form:"ctime"`                      // 创建时间
 }
 
 func (t *Refresh) TableName() string {
@@ -19,6 +23,7 @@ func (t *Refresh) TableName() string {
 }
 
 func RefreshCreate(ctx context.Context, db *gorm.DB, data *Refresh) (err error) {
+	data.Ctime = time.Now().Unix()
 	if err = db.WithContext(ctx).Create(data).Error; err != nil {
 		err = fmt.Errorf("RefreshCreate, err: %w", err)
 		return
@@ -45,3 +50,23 @@ func RefreshInfoX(ctx context.Context, db *gorm.DB, conds egorm.Conds) (resp Ref
 	}
 	return
 }
+
+// RefreshUse 将未使用的refresh token标记为已使用，refresh token已经使用过或者不存在时返回false
+func RefreshUse(ctx context.Context, db *gorm.DB, token string) (ok bool, err error) {
+	result := db.WithContext(ctx).Table("refresh").Where("token = ? and used_at = 0", token).Update("used_at", time.Now().Unix())
+	if err = result.Error; err != nil {
+		err = fmt.Errorf("RefreshUse, err: %w", err)
+		return
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// RefreshListX List的扩展方法，根据Cond查询多条记录
+func RefreshListX(ctx context.Context, db *gorm.DB, conds egorm.Conds) (resp []Refresh, err error) {
+	sql, binds := egorm.BuildQuery(conds)
+	if err = db.WithContext(ctx).Table("refresh").Where(sql, binds...).Find(&resp).Error; err != nil {
+		err = fmt.Errorf("RefreshListX, err: %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,23 @@
+package dto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Session 用户的一次登录，对应一个parent token
+type Session struct {
+	Id         string            `json:"id"`         // 会话id，由parent token计算，不会泄露parent token
+	Platform   string            `json:"platform"`   // 登录的终端类型，如web、android、ios
+	Ctime      int64             `json:"ctime"`      // 登录时间
+	LastActive int64             `json:"lastActive"` // 最后使用时间
+	ExpireAt   int64             `json:"expireAt"`   // 最长有效期的时间戳
+	ClientIds  []string          `json:"clientIds"`  // 通过该会话登录的子系统
+	Meta       map[string]string `json:"meta"`       // 登录时记录的设备信息，如ip、user agent
+}
+
+// SessionId 根据parent token计算会话id，用于判断是否为当前会话
+func SessionId(parentToken string) string {
+	hash := sha256.Sum256([]byte(parentToken))
+	return hex.EncodeToString(hash[:16])
+}
@@ -66,6 +66,9 @@ func (s *storage) SaveAuthorize(ctx context.Context, data *server.AuthorizeData)
 		State:       data.State,
 		Ctime:       data.CreatedAt.Unix(),
 		Extra:       cast.ToString(data.UserData),
+
+		CodeChallenge:       data.CodeChallenge,
+		CodeChallengeMethod: data.CodeChallengeMethod,
 	}
 
 	tx := s.db.Begin()
@@ -103,6 +106,9 @@ func (s *storage) LoadAuthorize(ctx context.Context, code string) (*server.Autho
 		State:       info.State,
 		CreatedAt:   time.Unix(info.Ctime, 0),
 		UserData:    info.Extra,
+
+		CodeChallenge:       info.CodeChallenge,
+		CodeChallengeMethod: info.CodeChallengeMethod,
 	}
 	c, err := s.GetClient(ctx, info.Client)
 	if err != nil {
@@ -149,7 +155,7 @@ func (s *storage) SaveAccess(ctx context.Context, data *server.AccessData) (err
 	tx := s.db.Begin()
 
 	if data.RefreshToken != "" {
-		if err := s.saveRefresh(ctx, tx, data.RefreshToken, data.AccessToken); err != nil {
+		if err := s.saveRefresh(ctx, tx, data.RefreshToken, data.AccessToken, s.refreshFamily(ctx, data)); err != nil {
 			tx.Rollback()
 			return err
 		}
@@ -250,9 +256,34 @@ func (s *storage) LoadRefresh(ctx context.Context, code string) (*server.AccessD
 	if err != nil {
 		return nil, err
 	}
+	if info.UsedAt > 0 {
+		if err = s.revokeRefreshFamily(ctx, refreshFamilyOf(info)); err != nil {
+			return nil, err
+		}
+		return nil, server.ErrRefreshTokenReused
+	}
 	return s.LoadAccess(ctx, info.Access)
 }
 
+// RotateRefresh marks the refresh token as used, reuse of a used refresh token revokes the whole token family.
+func (s *storage) RotateRefresh(ctx context.Context, code string) (err error) {
+	ok, err := dao.RefreshUse(ctx, s.db, code)
+	if err != nil {
+		return
+	}
+	if ok {
+		return nil
+	}
+	info, err := dao.RefreshInfoX(ctx, s.db, egorm.Conds{"token": code})
+	if err != nil {
+		return
+	}
+	if err = s.revokeRefreshFamily(ctx, refreshFamilyOf(info)); err != nil {
+		return
+	}
+	return server.ErrRefreshTokenReused
+}
+
 // RemoveRefresh revokes or deletes refresh AccessData.
 func (s *storage) RemoveRefresh(ctx context.Context, code string) (err error) {
 	err = dao.RefreshDeleteX(ctx, s.db, egorm.Conds{"token": code})
@@ -269,16 +300,80 @@ func (s *storage) CreateClientWithInformation(id string, secret string, redirect
 	}
 }
 
-func (s *storage) saveRefresh(ctx context.Context, tx *gorm.DB, refresh, access string) (err error) {
+func (s *storage) saveRefresh(ctx context.Context, tx *gorm.DB, refresh, access, family string) (err error) {
 	obj := dao.Refresh{
 		Token:  refresh,
 		Access: access,
+		Family: family,
 	}
 
 	err = dao.RefreshCreate(ctx, tx, &obj)
 	return
 }
 
+// refreshFamily 通过refresh token刷新时继承之前的token family，否则以新的refresh token作为family
+func (s *storage) refreshFamily(ctx context.Context, data *server.AccessData) string {
+	if data.AccessData == nil || data.AccessData.RefreshToken == "" {
+		return data.RefreshToken
+	}
+	prev, err := dao.RefreshInfoX(ctx, s.db, egorm.Conds{"token": data.AccessData.RefreshToken})
+	if err != nil {
+		return data.AccessData.RefreshToken
+	}
+	return refreshFamilyOf(prev)
+}
+
+// refreshFamilyOf 返回refresh token所属的family，增加family之前保存的refresh token以自身作为family
+func refreshFamilyOf(info dao.Refresh) string {
+	if info.Family == "" {
+		return info.Token
+	}
+	return info.Family
+}
+
+// revokeRefreshFamily 吊销token family中的所有refresh token以及签发的access token
+func (s *storage) revokeRefreshFamily(ctx context.Context, family string) (err error) {
+	// family为空时会匹配所有增加family之前保存的refresh token
+	if family == "" {
+		return errors.New("revoke refresh token family, family is empty")
+	}
+	list, err := dao.RefreshListX(ctx, s.db, egorm.Conds{"family": family})
+	if err != nil {
+		return
+	}
+	// family的第一个refresh token可能是增加family之前保存的，family字段为空
+	root, err := dao.RefreshInfoX(ctx, s.db, egorm.Conds{"token": family})
+	if err == nil && root.Family == "" {
+		list = append(list, root)
+	}
+	ids := make([]int, 0, len(list))
+	accessTokens := make([]string, 0, len(list))
+	for _, info := range list {
+		ids = append(ids, info.Id)
+		accessTokens = append(accessTokens, info.Access)
+	}
+	s.logger.Warn("refresh token reused, revoke token family", elog.String("family", family), elog.Int("tokens", len(list)))
+
+	tx := s.db.Begin()
+	if len(accessTokens) > 0 {
+		if err = dao.AccessDeleteX(ctx, tx, egorm.Conds{"access_token": accessTokens}); err != nil {
+			tx.Rollback()
+			return
+		}
+		if err = dao.ExpiresDeleteX(ctx, tx, egorm.Conds{"token": accessTokens}); err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+	if len(ids) > 0 {
+		if err = dao.RefreshDeleteX(ctx, tx, egorm.Conds{"id": ids}); err != nil {
+			tx.Rollback()
+			return
+		}
+	}
+	return tx.Commit().Error
+}
+
 // AddExpireAtData add info in expires table
 func (s *storage) AddExpireAtData(ctx context.Context, tx *gorm.DB, code string, expireAt time.Time) (err error) {
 	obj := dao.Expires{
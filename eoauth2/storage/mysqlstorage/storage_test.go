@@ -0,0 +1,147 @@
+package mysqlstorage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego-component/egorm"
+	"github.com/gotomicro/ego-component/eoauth2/server"
+	"github.com/gotomicro/ego-component/eoauth2/storage/dao"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestStorage(t *testing.T) *storage {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "oauth2.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&dao.App{}, &dao.Access{}, &dao.Refresh{}, &dao.Expires{}, &dao.Authorize{}))
+	// SaveAccess累加app表的call_no
+	require.NoError(t, db.Exec("ALTER TABLE app ADD COLUMN call_no integer NOT NULL DEFAULT 0").Error)
+	require.NoError(t, db.Create(&dao.App{ClientId: "client", Secret: "secret"}).Error)
+	return NewStorage(db, elog.DefaultLogger)
+}
+
+// saveAccess 保存access token，prev不为空时表示通过prev刷新
+func saveAccess(t *testing.T, s *storage, access, refresh string, prev *server.AccessData) {
+	err := s.SaveAccess(context.Background(), &server.AccessData{
+		Client:       &server.DefaultClient{Id: "client"},
+		AccessData:   prev,
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresIn:    3600,
+	})
+	require.NoError(t, err)
+}
+
+func refreshExists(t *testing.T, s *storage, token string) bool {
+	list, err := dao.RefreshListX(context.Background(), s.db, egorm.Conds{"token": token})
+	require.NoError(t, err)
+	return len(list) > 0
+}
+
+func accessExists(t *testing.T, s *storage, token string) bool {
+	_, err := s.LoadAccess(context.Background(), token)
+	return err == nil
+}
+
+func TestRotateRefresh(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	saveAccess(t, s, "a1", "r1", nil)
+	data, err := s.LoadRefresh(ctx, "r1")
+	require.NoError(t, err)
+	assert.Equal(t, "a1", data.AccessToken)
+
+	require.NoError(t, s.RotateRefresh(ctx, "r1"))
+	saveAccess(t, s, "a2", "r2", data)
+	info, err := dao.RefreshInfoX(ctx, s.db, egorm.Conds{"token": "r2"})
+	require.NoError(t, err)
+	assert.Equal(t, "r1", info.Family)
+
+	// 另一个family不受影响
+	saveAccess(t, s, "b1", "s1", nil)
+
+	// 再次使用r1时吊销整个family
+	assert.Equal(t, server.ErrRefreshTokenReused, s.RotateRefresh(ctx, "r1"))
+	for _, token := range []string{"r1", "r2"} {
+		assert.False(t, refreshExists(t, s, token), token)
+	}
+	assert.False(t, accessExists(t, s, "a1"))
+	assert.False(t, accessExists(t, s, "a2"))
+	assert.True(t, refreshExists(t, s, "s1"))
+	assert.True(t, accessExists(t, s, "b1"))
+}
+
+func TestLoadRefreshReused(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	saveAccess(t, s, "a1", "r1", nil)
+	require.NoError(t, s.RotateRefresh(ctx, "r1"))
+	_, err := s.LoadRefresh(ctx, "r1")
+	assert.Equal(t, server.ErrRefreshTokenReused, err)
+	assert.False(t, refreshExists(t, s, "r1"))
+	assert.False(t, accessExists(t, s, "a1"))
+}
+
+func TestLegacyRefreshFamily(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	// 增加family之前保存的refresh token
+	saveAccess(t, s, "la1", "lr1", nil)
+	saveAccess(t, s, "la2", "lr2", nil)
+	require.NoError(t, s.db.Table("refresh").Where("1=1").Update("family", "").Error)
+
+	data, err := s.LoadRefresh(ctx, "lr1")
+	require.NoError(t, err)
+	require.NoError(t, s.RotateRefresh(ctx, "lr1"))
+	saveAccess(t, s, "a2", "r2", data)
+	info, err := dao.RefreshInfoX(ctx, s.db, egorm.Conds{"token": "r2"})
+	require.NoError(t, err)
+	assert.Equal(t, "lr1", info.Family)
+
+	// 只吊销lr1轮换出的token，其他用户的refresh token不受影响
+	_, err = s.LoadRefresh(ctx, "lr1")
+	assert.Equal(t, server.ErrRefreshTokenReused, err)
+	assert.False(t, refreshExists(t, s, "lr1"))
+	assert.False(t, refreshExists(t, s, "r2"))
+	assert.False(t, accessExists(t, s, "la1"))
+	assert.False(t, accessExists(t, s, "a2"))
+	assert.True(t, refreshExists(t, s, "lr2"))
+	assert.True(t, accessExists(t, s, "la2"))
+}
+
+func TestRevokeEmptyRefreshFamily(t *testing.T) {
+	s := newTestStorage(t)
+	require.NoError(t, dao.RefreshCreate(context.Background(), s.db, &dao.Refresh{Token: "lr1", Access: "la1"}))
+	assert.Error(t, s.revokeRefreshFamily(context.Background(), ""))
+	assert.True(t, refreshExists(t, s, "lr1"))
+}
+
+func TestSaveAuthorizePKCE(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	for _, method := range []string{server.PKCE_S256, server.PKCE_PLAIN, ""} {
+		code := "code-" + method
+		require.NoError(t, s.SaveAuthorize(ctx, &server.AuthorizeData{
+			Client:              &server.DefaultClient{Id: "client"},
+			Code:                code,
+			ExpiresIn:           600,
+			RedirectUri:         "https://app.example.com/cb",
+			CreatedAt:           time.Now(),
+			CodeChallenge:       "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+			CodeChallengeMethod: method,
+		}))
+
+		// 换取token时需要读取code_challenge校验code_verifier
+		data, err := s.LoadAuthorize(ctx, code)
+		require.NoError(t, err)
+		assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", data.CodeChallenge)
+		assert.Equal(t, method, data.CodeChallengeMethod)
+		assert.Equal(t, "client", data.Client.GetId())
+	}
+}
@@ -9,10 +9,14 @@ import (
 	"github.com/go-redis/redis/v8"
 	"github.com/gotomicro/ego-component/eoauth2/storage/dto"
 	"github.com/gotomicro/ego-component/eredis"
+	"github.com/spf13/cast"
+	"github.com/vmihailenco/msgpack"
 )
 
 type config struct {
-	parentAccessExpiration int64 // 父亲节点token
+	parentAccessExpiration int64 // 父亲节点token，开启滑动过期时为最长有效期
+	slidingExpiration      int64 // 滑动过期，每次使用parent token时有效期延长到该时间，不超过parentAccessExpiration，0表示固定过期
+	idleTimeout            int64 // 空闲超时，parent token超过该时间没有使用则失效，0表示不限制
 
 	/*
 		    hashmap
@@ -32,6 +36,8 @@ type config struct {
 		  			 expiration: 最大的过期时间
 					 value:
 						uid:                   uid
+						lastActive:            最后使用时间
+						expireAt:              最长有效期的时间戳
 						tokenInfo:             tokenInfo
 						expireList:             [{"subTokenClientId1":"ctime"}]
 						expireTime:            最大过期时间
@@ -52,6 +58,8 @@ type config struct {
 		ttl: 3600
 	*/
 	subTokenMapParentTokenKey string // token与父级token的映射关系
+	refreshTokenKey           string // refresh token信息，轮换后标记为已使用
+	refreshTokenFamilyKey     string // 同一次授权轮换出的所有refresh token
 	//clientType                []string // 支持的客户端类型，web、andorid、ios，用于设置一个客户端，可以登录几个parent token。
 }
 
@@ -61,6 +69,8 @@ func defaultConfig() *config {
 		uidMapParentTokenFieldKey: "%s|%s",      // uid map parent token type
 		parentTokenMapSubTokenKey: "sso:ptk:%s", //  parent token map
 		subTokenMapParentTokenKey: "sso:stk:%s", // sub token map parent token
+		refreshTokenKey:           "sso:rtk:%s", // refresh token
+		refreshTokenFamilyKey:     "sso:rtf:%s", // refresh token family
 		parentAccessExpiration:    24 * 3600,
 		//platform:                []string{"web", "android", "ios"},
 	}
@@ -256,12 +266,47 @@ func (u *uidMapParentToken) getExpireTime(ctx context.Context, uid int64) (expir
 //	return
 //}
 
+// touchParentTokenScript 使用、续期parent token时检查空闲超时，并更新最后使用时间、延长有效期，有效期不超过expireAt
+// 返回-1: parent token不存在，-2: 空闲超时或者超过最长有效期，1: 成功
+var touchParentTokenScript = redis.NewScript(`
+local v = redis.call("HMGET", KEYS[1], ARGV[1], ARGV[2], ARGV[3])
+if not v[1] then
+	return -1
+end
+local now = tonumber(ARGV[4])
+local idle = tonumber(ARGV[5])
+local ttl = tonumber(ARGV[6])
+local last = tonumber(v[2] or v[1])
+if idle > 0 and now - last > idle then
+	redis.call("DEL", KEYS[1])
+	return -2
+end
+if v[3] then
+	local remain = tonumber(v[3]) - now
+	if remain <= 0 then
+		redis.call("DEL", KEYS[1])
+		return -2
+	end
+	if ttl > 0 and remain < ttl then
+		ttl = remain
+	end
+end
+redis.call("HSET", KEYS[1], ARGV[2], now)
+if ttl > 0 then
+	redis.call("EXPIRE", KEYS[1], ttl)
+end
+return 1
+`)
+
 type parentToken struct {
 	config             *config
 	redis              *eredis.Component
 	hashKeyCtime       string
 	hashKeyUid         string
 	hashKeyPlatform    string
+	hashKeyLastActive  string
+	hashKeyExpireAt    string
+	hashKeyMeta        string
 	hashExpireTimeList string
 }
 
@@ -272,6 +317,9 @@ func newParentToken(config *config, redis *eredis.Component) *parentToken {
 		hashKeyCtime:       "_c",   // create time
 		hashKeyPlatform:    "_p",   // 类型
 		hashKeyUid:         "_u",   // uid
+		hashKeyLastActive:  "_la",  // last active time
+		hashKeyExpireAt:    "_ea",  // expire at，最长有效期
+		hashKeyMeta:        "_m",   // 设备信息
 		hashExpireTimeList: "_etl", // expire time List
 
 	}
@@ -281,27 +329,88 @@ func (p *parentToken) getKey(pToken string) string {
 	return fmt.Sprintf(p.config.parentTokenMapSubTokenKey, pToken)
 }
 
-func (p *parentToken) create(ctx context.Context, pToken dto.Token, platform string, uid int64) error {
-	err := p.redis.HMSet(ctx, p.getKey(pToken.Token), map[string]interface{}{
-		p.hashKeyCtime:    time.Now().Unix(),
-		p.hashKeyUid:      uid,
-		p.hashKeyPlatform: platform,
-	}, time.Duration(pToken.ExpiresIn)*time.Second)
+func (p *parentToken) create(ctx context.Context, pToken dto.Token, platform string, uid int64, meta map[string]string) error {
+	nowTime := time.Now().Unix()
+	// 开启滑动过期时，初始有效期为滑动过期时间，使用时再延长
+	expiresIn := pToken.ExpiresIn
+	if p.config.slidingExpiration > 0 && p.config.slidingExpiration < expiresIn {
+		expiresIn = p.config.slidingExpiration
+	}
+	fields := map[string]interface{}{
+		p.hashKeyCtime:      nowTime,
+		p.hashKeyUid:        uid,
+		p.hashKeyPlatform:   platform,
+		p.hashKeyLastActive: nowTime,
+		p.hashKeyExpireAt:   nowTime + pToken.ExpiresIn,
+	}
+	if len(meta) > 0 {
+		metaBytes, err := msgpack.Marshal(meta)
+		if err != nil {
+			return fmt.Errorf("parentToken.create marshal meta failed, err:%w", err)
+		}
+		fields[p.hashKeyMeta] = metaBytes
+	}
+	err := p.redis.HMSet(ctx, p.getKey(pToken.Token), fields, time.Duration(expiresIn)*time.Second)
 	if err != nil {
 		return fmt.Errorf("parentToken.create failed, err:%w", err)
 	}
 	return nil
 }
 
+// renew 续期parent token，开启滑动过期时只延长到滑动过期时间，有效期不超过最长有效期
 func (p *parentToken) renew(ctx context.Context, pToken dto.Token) error {
-	err := p.redis.Client().Expire(ctx, p.getKey(pToken.Token), time.Duration(pToken.ExpiresIn)*time.Second).Err()
-	if err != nil {
-		return fmt.Errorf("parentToken.renew failed, err:%w", err)
+	expiresIn := pToken.ExpiresIn
+	if p.config.slidingExpiration > 0 && p.config.slidingExpiration < expiresIn {
+		expiresIn = p.config.slidingExpiration
+	}
+	if expiresIn <= 0 {
+		return fmt.Errorf("parentToken.renew failed, invalid expires in %d", pToken.ExpiresIn)
 	}
+	return p.runTouch(ctx, pToken.Token, expiresIn)
+}
 
+// touch 使用parent token，检查空闲超时，更新最后使用时间，开启滑动过期时延长有效期
+func (p *parentToken) touch(ctx context.Context, pToken string) error {
+	if p.config.slidingExpiration <= 0 && p.config.idleTimeout <= 0 {
+		return nil
+	}
+	return p.runTouch(ctx, pToken, p.config.slidingExpiration)
+}
+
+// runTouch 执行touchParentTokenScript，ttl为0时不修改有效期
+func (p *parentToken) runTouch(ctx context.Context, pToken string, ttl int64) error {
+	ret, err := touchParentTokenScript.Run(ctx, p.redis.Client(),
+		[]string{p.getKey(pToken)},
+		p.hashKeyCtime, p.hashKeyLastActive, p.hashKeyExpireAt,
+		time.Now().Unix(), p.config.idleTimeout, ttl,
+	).Int64()
+	if err != nil {
+		return fmt.Errorf("parentToken.touch failed, err: %w", err)
+	}
+	switch ret {
+	case -1:
+		return fmt.Errorf("parentToken.touch failed, err: %w", redis.Nil)
+	case -2:
+		return ErrParentTokenExpired
+	}
 	return nil
 }
 
+// expired parent token的信息是否已经空闲超时或者超过最长有效期，与touchParentTokenScript的判断一致
+func (p *parentToken) expired(info map[string]string, now int64) bool {
+	last := cast.ToInt64(info[p.hashKeyLastActive])
+	if last == 0 {
+		last = cast.ToInt64(info[p.hashKeyCtime])
+	}
+	if p.config.idleTimeout > 0 && now-last > p.config.idleTimeout {
+		return true
+	}
+	if value, ok := info[p.hashKeyExpireAt]; ok && cast.ToInt64(value) <= now {
+		return true
+	}
+	return false
+}
+
 func (p *parentToken) delete(ctx context.Context, pToken string) error {
 	_, err := p.redis.Del(ctx, p.getKey(pToken))
 	if err != nil {
@@ -0,0 +1,109 @@
+package redisstorage
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gotomicro/ego-component/eoauth2/storage/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParentTokenTouch(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newTestStorage(t, WithParentAccessExpiration(3600), WithSlidingExpiration(600), WithIdleTimeout(300))
+	p := s.tokenServer.parentToken
+	key := p.getKey("pt")
+	require.NoError(t, p.create(ctx, dto.Token{Token: "pt", ExpiresIn: 3600}, "web", 1, nil))
+	// 初始有效期为滑动过期时间
+	assert.Equal(t, 600*time.Second, mr.TTL(key))
+
+	now := time.Now().Unix()
+	mr.HSet(key, p.hashKeyLastActive, strconv.FormatInt(now-100, 10))
+	mr.SetTTL(key, 100*time.Second)
+	require.NoError(t, p.touch(ctx, "pt"))
+	assert.Equal(t, 600*time.Second, mr.TTL(key))
+	assert.GreaterOrEqual(t, hashInt(t, mr, key, p.hashKeyLastActive), now)
+
+	// 滑动延长不超过最长有效期
+	mr.HSet(key, p.hashKeyExpireAt, strconv.FormatInt(now+100, 10))
+	require.NoError(t, p.touch(ctx, "pt"))
+	assert.LessOrEqual(t, int64(mr.TTL(key)), int64(100*time.Second))
+
+	mr.HSet(key, p.hashKeyExpireAt, strconv.FormatInt(now-1, 10))
+	assert.Equal(t, ErrParentTokenExpired, p.touch(ctx, "pt"))
+	assert.False(t, mr.Exists(key))
+
+	err := p.touch(ctx, "pt")
+	assert.True(t, errors.Is(err, redis.Nil))
+}
+
+func TestParentTokenIdleTimeout(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newTestStorage(t, WithIdleTimeout(300))
+	p := s.tokenServer.parentToken
+	key := p.getKey("pt")
+	require.NoError(t, p.create(ctx, dto.Token{Token: "pt", ExpiresIn: 3600}, "web", 1, nil))
+
+	// 没有开启滑动过期时不修改有效期
+	mr.SetTTL(key, 1000*time.Second)
+	require.NoError(t, p.touch(ctx, "pt"))
+	assert.Equal(t, 1000*time.Second, mr.TTL(key))
+
+	mr.HSet(key, p.hashKeyLastActive, strconv.FormatInt(time.Now().Unix()-301, 10))
+	assert.Equal(t, ErrParentTokenExpired, p.touch(ctx, "pt"))
+	assert.False(t, mr.Exists(key))
+}
+
+func TestParentTokenRenew(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newTestStorage(t, WithIdleTimeout(300))
+	p := s.tokenServer.parentToken
+	key := p.getKey("pt")
+	require.NoError(t, p.create(ctx, dto.Token{Token: "pt", ExpiresIn: 3600}, "web", 1, nil))
+
+	now := time.Now().Unix()
+	mr.HSet(key, p.hashKeyLastActive, strconv.FormatInt(now-100, 10))
+	mr.SetTTL(key, 100*time.Second)
+	require.NoError(t, p.renew(ctx, dto.Token{Token: "pt", ExpiresIn: 3600}))
+	assert.LessOrEqual(t, int64(mr.TTL(key)), int64(3600*time.Second))
+	assert.Greater(t, int64(mr.TTL(key)), int64(3500*time.Second))
+	assert.GreaterOrEqual(t, hashInt(t, mr, key, p.hashKeyLastActive), now)
+
+	// 续期不能超过最长有效期
+	mr.HSet(key, p.hashKeyExpireAt, strconv.FormatInt(now+100, 10))
+	require.NoError(t, p.renew(ctx, dto.Token{Token: "pt", ExpiresIn: 3600}))
+	assert.LessOrEqual(t, int64(mr.TTL(key)), int64(100*time.Second))
+
+	// 空闲超时后不能续期
+	mr.HSet(key, p.hashKeyLastActive, strconv.FormatInt(now-301, 10))
+	assert.Equal(t, ErrParentTokenExpired, p.renew(ctx, dto.Token{Token: "pt", ExpiresIn: 3600}))
+	assert.False(t, mr.Exists(key))
+
+	assert.Error(t, p.renew(ctx, dto.Token{Token: "pt", ExpiresIn: 3600}))
+	assert.Error(t, p.renew(ctx, dto.Token{Token: "pt"}))
+}
+
+func TestParentTokenRenewSliding(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newTestStorage(t, WithParentAccessExpiration(3600), WithSlidingExpiration(600))
+	p := s.tokenServer.parentToken
+	key := p.getKey("pt")
+	require.NoError(t, p.create(ctx, dto.Token{Token: "pt", ExpiresIn: 3600}, "web", 1, nil))
+
+	// 开启滑动过期时续期到滑动过期时间
+	mr.SetTTL(key, 100*time.Second)
+	require.NoError(t, s.RenewParentToken(ctx, dto.Token{Token: "pt", ExpiresIn: 3600}))
+	assert.Equal(t, 600*time.Second, mr.TTL(key))
+}
+
+func hashInt(t *testing.T, mr *miniredis.Miniredis, key, field string) int64 {
+	value, err := strconv.ParseInt(mr.HGet(key, field), 10, 64)
+	require.NoError(t, err)
+	return value
+}
@@ -0,0 +1,136 @@
+package redisstorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gotomicro/ego-component/eredis"
+)
+
+// rotateRefreshTokenScript 原子地将refresh token标记为已使用
+// 返回-1: refresh token不存在，0: 已经使用过，1: 标记成功
+var rotateRefreshTokenScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+return redis.call("HSETNX", KEYS[1], ARGV[1], ARGV[2])
+`)
+
+/*
+	hashmap
+	key: sso:rtk:{refreshToken}
+	value:
+		_a: {accessToken}
+		_f: {family}
+		_u: 使用时间，未使用时不存在
+		_c: 创建时间
+	ttl: parentAccessExpiration
+
+	set
+	key: sso:rtf:{family}
+	value: 同一个family的所有refresh token
+	ttl: parentAccessExpiration
+*/
+
+// refreshToken 轮换的refresh token，用于检测refresh token被重复使用
+type refreshToken struct {
+	config        *config
+	redis         *eredis.Component
+	hashKeyAccess string
+	hashKeyFamily string
+	hashKeyUsedAt string
+	hashKeyCtime  string
+}
+
+func newRefreshToken(config *config, redis *eredis.Component) *refreshToken {
+	return &refreshToken{
+		config:        config,
+		redis:         redis,
+		hashKeyAccess: "_a",
+		hashKeyFamily: "_f",
+		hashKeyUsedAt: "_u",
+		hashKeyCtime:  "_c", // create time
+	}
+}
+
+func (r *refreshToken) getKey(token string) string {
+	return fmt.Sprintf(r.config.refreshTokenKey, token)
+}
+
+func (r *refreshToken) getFamilyKey(family string) string {
+	return fmt.Sprintf(r.config.refreshTokenFamilyKey, family)
+}
+
+// create 保存refresh token，family为空时以refresh token作为新的family
+func (r *refreshToken) create(ctx context.Context, token string, accessToken string, family string) error {
+	if family == "" {
+		family = token
+	}
+	expiration := time.Duration(r.config.parentAccessExpiration) * time.Second
+	err := r.redis.HMSet(ctx, r.getKey(token), map[string]interface{}{
+		r.hashKeyAccess: accessToken,
+		r.hashKeyFamily: family,
+		r.hashKeyCtime:  time.Now().Unix(),
+	}, expiration)
+	if err != nil {
+		return fmt.Errorf("refreshToken.create failed, err:%w", err)
+	}
+	_, err = r.redis.SAdd(ctx, r.getFamilyKey(family), token)
+	if err != nil {
+		return fmt.Errorf("refreshToken.create add family failed, err:%w", err)
+	}
+	_, err = r.redis.Expire(ctx, r.getFamilyKey(family), expiration)
+	if err != nil {
+		return fmt.Errorf("refreshToken.create expire family failed, err:%w", err)
+	}
+	return nil
+}
+
+// get 获取refresh token信息，不存在时exist为false
+func (r *refreshToken) get(ctx context.Context, token string) (accessToken string, family string, used bool, exist bool, err error) {
+	info, err := r.redis.HGetAll(ctx, r.getKey(token))
+	if err != nil {
+		err = fmt.Errorf("refreshToken.get failed, err:%w", err)
+		return
+	}
+	if len(info) == 0 {
+		return
+	}
+	_, used = info[r.hashKeyUsedAt]
+	return info[r.hashKeyAccess], info[r.hashKeyFamily], used, true, nil
+}
+
+// rotate 将refresh token标记为已使用，返回-1: 不存在，0: 已经使用过，1: 标记成功
+func (r *refreshToken) rotate(ctx context.Context, token string) (int64, error) {
+	ret, err := rotateRefreshTokenScript.Run(ctx, r.redis.Client(), []string{r.getKey(token)}, r.hashKeyUsedAt, time.Now().Unix()).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("refreshToken.rotate failed, err:%w", err)
+	}
+	return ret, nil
+}
+
+// deleteFamily 删除family中的所有refresh token，返回这些refresh token签发的access token
+func (r *refreshToken) deleteFamily(ctx context.Context, family string) (accessTokens []string, err error) {
+	tokens, err := r.redis.SMembers(ctx, r.getFamilyKey(family))
+	if err != nil {
+		err = fmt.Errorf("refreshToken.deleteFamily get family failed, err:%w", err)
+		return
+	}
+	keys := make([]string, 0, len(tokens)+1)
+	for _, token := range tokens {
+		accessToken, err := r.redis.HGet(ctx, r.getKey(token), r.hashKeyAccess)
+		if err == nil && accessToken != "" {
+			accessTokens = append(accessTokens, accessToken)
+		}
+		keys = append(keys, r.getKey(token))
+	}
+	keys = append(keys, r.getFamilyKey(family))
+	err = r.redis.Client().Del(ctx, keys...).Err()
+	if err != nil {
+		err = fmt.Errorf("refreshToken.deleteFamily failed, err:%w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,199 @@
+package redisstorage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gotomicro/ego-component/eoauth2/storage/dto"
+	"github.com/spf13/cast"
+	"github.com/vmihailenco/msgpack"
+)
+
+// ErrSessionNotFound 用户没有该会话
+var ErrSessionNotFound = errors.New("session not found")
+
+// userSession uid索引中的一个parent token
+type userSession struct {
+	field       string // uid hash map的field key，{platform}|{parentToken}
+	platform    string
+	parentToken string
+}
+
+// userSessions 通过uid索引获取用户的所有parent token
+func (t *tokenServer) userSessions(ctx context.Context, uid int64) ([]userSession, error) {
+	fields, err := t.redis.HGetAll(ctx, t.uidMapParentToken.getKey(uid))
+	if err != nil {
+		return nil, fmt.Errorf("tokenServer.userSessions failed, err: %w", err)
+	}
+	sessions := make([]userSession, 0, len(fields))
+	for field := range fields {
+		if field == t.uidMapParentToken.hashExpireTimeList || field == t.uidMapParentToken.hashExpireTime {
+			continue
+		}
+		idx := strings.LastIndex(field, "|")
+		if idx < 0 {
+			continue
+		}
+		sessions = append(sessions, userSession{
+			field:       field,
+			platform:    field[:idx],
+			parentToken: field[idx+1:],
+		})
+	}
+	return sessions, nil
+}
+
+// listSessions 获取用户的所有有效会话，最近使用的在最前面，并清理已经失效的索引
+func (t *tokenServer) listSessions(ctx context.Context, uid int64) ([]dto.Session, error) {
+	userSessions, err := t.userSessions(ctx, uid)
+	if err != nil {
+		return nil, err
+	}
+	nowTime := time.Now().Unix()
+	sessions := make([]dto.Session, 0, len(userSessions))
+	staleFields := make([]string, 0)
+	for _, us := range userSessions {
+		info, err := t.redis.HGetAll(ctx, t.parentToken.getKey(us.parentToken))
+		if err != nil {
+			return nil, fmt.Errorf("tokenServer.listSessions get parent token failed, err: %w", err)
+		}
+		// parent token已经过期、空闲超时或者被删除
+		if len(info) == 0 || t.parentToken.expired(info, nowTime) {
+			staleFields = append(staleFields, us.field)
+			continue
+		}
+		session := dto.Session{
+			Id:         dto.SessionId(us.parentToken),
+			Platform:   us.platform,
+			Ctime:      cast.ToInt64(info[t.parentToken.hashKeyCtime]),
+			LastActive: cast.ToInt64(info[t.parentToken.hashKeyLastActive]),
+			ExpireAt:   cast.ToInt64(info[t.parentToken.hashKeyExpireAt]),
+			ClientIds:  make([]string, 0),
+		}
+		if session.LastActive == 0 {
+			session.LastActive = session.Ctime
+		}
+		if value := info[t.parentToken.hashKeyMeta]; value != "" {
+			_ = msgpack.Unmarshal([]byte(value), &session.Meta)
+		}
+		if value := info[t.parentToken.hashExpireTimeList]; value != "" {
+			var expires uidTokenExpires
+			if err := expires.Unmarshal([]byte(value)); err == nil {
+				for _, expire := range expires {
+					if expire.ExpireTime > nowTime {
+						session.ClientIds = append(session.ClientIds, expire.Token)
+					}
+				}
+			}
+		}
+		sessions = append(sessions, session)
+	}
+	if len(staleFields) > 0 {
+		if err = t.redis.HDel(ctx, t.uidMapParentToken.getKey(uid), staleFields...); err != nil {
+			return nil, fmt.Errorf("tokenServer.listSessions remove stale sessions failed, err: %w", err)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastActive > sessions[j].LastActive
+	})
+	return sessions, nil
+}
+
+// sessionTokens 获取parent token下各个子系统的token
+func (t *tokenServer) sessionTokens(ctx context.Context, pToken string) ([]string, error) {
+	info, err := t.redis.HGetAll(ctx, t.parentToken.getKey(pToken))
+	if err != nil {
+		return nil, fmt.Errorf("tokenServer.sessionTokens get parent token failed, err: %w", err)
+	}
+	tokens := make([]string, 0)
+	if value := info[t.parentToken.hashExpireTimeList]; value != "" {
+		var expires uidTokenExpires
+		if err := expires.Unmarshal([]byte(value)); err == nil {
+			for _, expire := range expires {
+				var token dto.Token
+				if err := token.Unmarshal([]byte(info[expire.Token])); err == nil && token.Token != "" {
+					tokens = append(tokens, token.Token)
+				}
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// removeSession 删除parent token、子系统token，以及uid索引
+func (t *tokenServer) removeSession(ctx context.Context, uid int64, us userSession, tokens []string) error {
+	keys := []string{t.parentToken.getKey(us.parentToken)}
+	for _, token := range tokens {
+		keys = append(keys, t.subToken.getKey(token))
+	}
+	if err := t.redis.Client().Del(ctx, keys...).Err(); err != nil {
+		return fmt.Errorf("tokenServer.removeSession remove token failed, err: %w", err)
+	}
+	if err := t.redis.HDel(ctx, t.uidMapParentToken.getKey(uid), us.field); err != nil {
+		return fmt.Errorf("tokenServer.removeSession remove uid index failed, err: %w", err)
+	}
+	return nil
+}
+
+// ListSessions 获取用户的所有有效会话（登录的设备），最近使用的在最前面
+func (s *Storage) ListSessions(ctx context.Context, uid int64) ([]dto.Session, error) {
+	return s.tokenServer.listSessions(ctx, uid)
+}
+
+// kickSessions 使用户的会话失效，keep返回true的会话保留，返回失效的会话数量
+func (s *Storage) kickSessions(ctx context.Context, uid int64, keep func(sessionId string) bool) (int, error) {
+	userSessions, err := s.tokenServer.userSessions(ctx, uid)
+	if err != nil {
+		return 0, err
+	}
+	cnt := 0
+	for _, us := range userSessions {
+		if keep(dto.SessionId(us.parentToken)) {
+			continue
+		}
+		if err = s.removeSession(ctx, uid, us); err != nil {
+			return cnt, err
+		}
+		cnt++
+	}
+	return cnt, nil
+}
+
+// removeSession 吊销会话中子系统的access token以及refresh token，再删除parent token和uid索引
+func (s *Storage) removeSession(ctx context.Context, uid int64, us userSession) error {
+	tokens, err := s.tokenServer.sessionTokens(ctx, us.parentToken)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if err = s.revokeAccess(ctx, token); err != nil {
+			return fmt.Errorf("Storage.removeSession revoke access failed, err: %w", err)
+		}
+	}
+	return s.tokenServer.removeSession(ctx, uid, us, tokens)
+}
+
+// KickSession 使用户的某个会话失效，该会话登录的子系统token同时失效
+func (s *Storage) KickSession(ctx context.Context, uid int64, sessionId string) error {
+	cnt, err := s.kickSessions(ctx, uid, func(id string) bool {
+		return id != sessionId
+	})
+	if err != nil {
+		return err
+	}
+	if cnt == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// KickOtherSessions 使用户除当前会话外的其他会话失效，用于“退出其他设备”，currentSessionId为空时所有会话都失效
+func (s *Storage) KickOtherSessions(ctx context.Context, uid int64, currentSessionId string) (int, error) {
+	return s.kickSessions(ctx, uid, func(id string) bool {
+		return id == currentSessionId
+	})
+}
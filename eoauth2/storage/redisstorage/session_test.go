@@ -0,0 +1,106 @@
+package redisstorage
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gotomicro/ego-component/eoauth2/server"
+	"github.com/gotomicro/ego-component/eoauth2/storage/dao"
+	"github.com/gotomicro/ego-component/eoauth2/storage/dto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// login 创建parent token，并通过授权码为client签发access token和refresh token
+func login(t *testing.T, s *Storage, uid int64, platform string, pToken string, accessToken string, refreshToken string) {
+	ctx := context.Background()
+	require.NoError(t, s.CreateParentToken(ctx, dto.Token{Token: pToken, ExpiresIn: 3600}, uid, platform))
+	code := "code-" + pToken
+	require.NoError(t, s.addExpireAtData(ctx, s.db, code, time.Now().Add(time.Minute), pToken))
+	require.NoError(t, s.SaveAccess(ctx, &server.AccessData{
+		Client:        &server.DefaultClient{Id: "client"},
+		AuthorizeData: &server.AuthorizeData{Code: code},
+		AccessToken:   accessToken,
+		RefreshToken:  refreshToken,
+		ExpiresIn:     3600,
+		CreatedAt:     time.Now(),
+	}))
+}
+
+func TestKickSession(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newTestStorage(t, WithParentAccessExpiration(3600))
+	require.NoError(t, s.db.Create(&dao.App{ClientId: "client"}).Error)
+	login(t, s, 1, "web", "pt1", "at1", "rt1")
+	login(t, s, 1, "ios", "pt2", "at2", "rt2")
+
+	// 通过refresh token刷新，老的access token仍然在token family中
+	prev, err := s.LoadRefresh(ctx, "rt1")
+	require.NoError(t, err)
+	require.NoError(t, s.RotateRefresh(ctx, "rt1"))
+	require.NoError(t, s.SaveAccess(ctx, &server.AccessData{
+		Client:       &server.DefaultClient{Id: "client"},
+		AccessData:   prev,
+		AccessToken:  "at1b",
+		RefreshToken: "rt1b",
+		ExpiresIn:    3600,
+		CreatedAt:    time.Now(),
+	}))
+
+	require.NoError(t, s.KickSession(ctx, 1, dto.SessionId("pt1")))
+	// 被踢下线的会话的access token、refresh token都失效
+	for _, token := range []string{"at1", "at1b"} {
+		_, err = s.LoadAccess(ctx, token)
+		assert.Error(t, err, token)
+		assert.False(t, mr.Exists(s.tokenServer.subToken.getKey(token)), token)
+	}
+	for _, token := range []string{"rt1", "rt1b"} {
+		_, err = s.LoadRefresh(ctx, token)
+		assert.Error(t, err, token)
+		assert.False(t, mr.Exists(s.tokenServer.refresh.getKey(token)), token)
+	}
+	assert.False(t, mr.Exists(s.tokenServer.refresh.getFamilyKey("rt1")))
+	assert.False(t, mr.Exists(s.tokenServer.parentToken.getKey("pt1")))
+
+	// 其他会话不受影响
+	_, err = s.LoadAccess(ctx, "at2")
+	assert.NoError(t, err)
+	_, err = s.LoadRefresh(ctx, "rt2")
+	assert.NoError(t, err)
+	sessions, err := s.ListSessions(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, dto.SessionId("pt2"), sessions[0].Id)
+	assert.Equal(t, []string{"client"}, sessions[0].ClientIds)
+
+	assert.Equal(t, ErrSessionNotFound, s.KickSession(ctx, 1, dto.SessionId("pt1")))
+	cnt, err := s.KickOtherSessions(ctx, 1, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, cnt)
+	_, err = s.LoadAccess(ctx, "at2")
+	assert.Error(t, err)
+	assert.False(t, mr.Exists(s.tokenServer.refresh.getKey("rt2")))
+}
+
+func TestListSessionsExpired(t *testing.T) {
+	ctx := context.Background()
+	s, mr := newTestStorage(t, WithParentAccessExpiration(3600), WithIdleTimeout(300))
+	p := s.tokenServer.parentToken
+	for _, pToken := range []string{"pt1", "pt2", "pt3"} {
+		require.NoError(t, s.CreateParentToken(ctx, dto.Token{Token: pToken, ExpiresIn: 3600}, 1, "web"))
+	}
+	now := time.Now().Unix()
+	// pt2空闲超时，pt3超过最长有效期，key还没有过期
+	mr.HSet(p.getKey("pt2"), p.hashKeyLastActive, strconv.FormatInt(now-301, 10))
+	mr.HSet(p.getKey("pt3"), p.hashKeyExpireAt, strconv.FormatInt(now-1, 10))
+
+	sessions, err := s.ListSessions(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, dto.SessionId("pt1"), sessions[0].Id)
+	userSessions, err := s.tokenServer.userSessions(ctx, 1)
+	require.NoError(t, err)
+	assert.Len(t, userSessions, 1)
+}
@@ -75,6 +75,9 @@ func (s *Storage) SaveAuthorize(ctx context.Context, data *server.AuthorizeData)
 		State:       data.State,
 		Ctime:       data.CreatedAt.Unix(),
 		Extra:       cast.ToString(data.UserData),
+
+		CodeChallenge:       data.CodeChallenge,
+		CodeChallengeMethod: data.CodeChallengeMethod,
 	}
 	tx := s.db.Begin()
 	err = dao.AuthorizeCreate(ctx, tx, &obj)
@@ -111,6 +114,9 @@ func (s *Storage) LoadAuthorize(ctx context.Context, code string) (*server.Autho
 		State:       info.State,
 		CreatedAt:   time.Unix(info.Ctime, 0),
 		UserData:    info.Extra,
+
+		CodeChallenge:       info.CodeChallenge,
+		CodeChallengeMethod: info.CodeChallengeMethod,
 	}
 	c, err := s.GetClient(ctx, info.Client)
 	if err != nil {
@@ -237,6 +243,18 @@ func (s *Storage) SaveAccess(ctx context.Context, data *server.AccessData) (err
 		return fmt.Errorf("设置redis token失败, err:%w", err)
 	}
 
+	if data.RefreshToken != "" {
+		prevRefreshToken := ""
+		if data.AccessData != nil {
+			prevRefreshToken = data.AccessData.RefreshToken
+		}
+		err = s.tokenServer.createRefreshToken(ctx, data.RefreshToken, data.AccessToken, prevRefreshToken)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("设置redis refresh token失败, err:%w", err)
+		}
+	}
+
 	tx.Commit()
 	return nil
 }
@@ -317,10 +335,99 @@ func (s *Storage) RemoveAllAccess(ctx context.Context, token string) (err error)
 // 2 再从sub token中找到对应parent token，看是否有效
 // 3 刷新token
 // 必须要这个信息用于给予access token，告诉oauth2老的token，用于在save access的时候，查询到ptoken，并处理老token的逻辑
+// 4 refresh token只能使用一次，使用已经轮换过的refresh token时，吊销整个token family
+// 兼容之前使用access token刷新的方式，refresh token不存在时，按access token加载
 // AuthorizeData and AccessData DON'T NEED to be loaded if not easily available.
 // Optionally can return error if expired
 func (s *Storage) LoadRefresh(ctx context.Context, token string) (*server.AccessData, error) {
-	return s.LoadAccess(ctx, token)
+	accessToken, family, used, exist, err := s.tokenServer.refresh.get(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return s.LoadAccess(ctx, token)
+	}
+	if used {
+		if err = s.revokeRefreshFamily(ctx, family); err != nil {
+			return nil, err
+		}
+		return nil, server.ErrRefreshTokenReused
+	}
+	return s.LoadAccess(ctx, accessToken)
+}
+
+// RotateRefresh 将refresh token标记为已使用，并发使用同一个refresh token时只有一个能成功，其余的吊销整个token family
+func (s *Storage) RotateRefresh(ctx context.Context, token string) error {
+	ret, err := s.tokenServer.refresh.rotate(ctx, token)
+	if err != nil {
+		return err
+	}
+	switch ret {
+	case 1:
+		return nil
+	case -1:
+		// 使用access token刷新，没有refresh token信息
+		return nil
+	}
+	_, family, _, _, err := s.tokenServer.refresh.get(ctx, token)
+	if err != nil {
+		return err
+	}
+	if err = s.revokeRefreshFamily(ctx, family); err != nil {
+		return err
+	}
+	return server.ErrRefreshTokenReused
+}
+
+// revokeRefreshFamily 吊销token family中的所有refresh token以及签发的access token
+func (s *Storage) revokeRefreshFamily(ctx context.Context, family string) (err error) {
+	accessTokens, err := s.tokenServer.revokeRefreshFamily(ctx, family)
+	if err != nil {
+		return
+	}
+	s.logger.Warn("refresh token reused, revoke token family", elog.String("family", family), elog.Int("tokens", len(accessTokens)))
+	return s.removeAccessTokens(ctx, accessTokens)
+}
+
+// revokeAccess 删除access token，并吊销它的refresh token所在的token family
+func (s *Storage) revokeAccess(ctx context.Context, token string) error {
+	accessTokens := []string{token}
+	// 通过RefreshToken接口签发的token没有access记录
+	info, err := dao.AccessInfoX(ctx, s.db, egorm.Conds{"access_token": token})
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if info.RefreshToken != "" {
+		_, family, _, exist, err := s.tokenServer.refresh.get(ctx, info.RefreshToken)
+		if err != nil {
+			return err
+		}
+		if exist {
+			familyTokens, err := s.tokenServer.revokeRefreshFamily(ctx, family)
+			if err != nil {
+				return err
+			}
+			accessTokens = append(accessTokens, familyTokens...)
+		}
+	}
+	return s.removeAccessTokens(ctx, accessTokens)
+}
+
+// removeAccessTokens 删除access token的access以及expires记录
+func (s *Storage) removeAccessTokens(ctx context.Context, accessTokens []string) (err error) {
+	if len(accessTokens) == 0 {
+		return
+	}
+	tx := s.db.Begin()
+	if err = dao.AccessDeleteX(ctx, tx, egorm.Conds{"access_token": accessTokens}); err != nil {
+		tx.Rollback()
+		return
+	}
+	if err = dao.ExpiresDeleteX(ctx, tx, egorm.Conds{"token": accessTokens}); err != nil {
+		tx.Rollback()
+		return
+	}
+	return tx.Commit().Error
 }
 
 // RemoveRefresh revokes or deletes refresh AccessData.
@@ -368,7 +475,12 @@ func (s *Storage) removeExpireAtData(ctx context.Context, code string) (err erro
 
 // CreateParentToken 创建父级token
 func (s *Storage) CreateParentToken(ctx context.Context, pToken dto.Token, uid int64, platform string) (err error) {
-	return s.tokenServer.createParentToken(ctx, pToken, uid, platform)
+	return s.tokenServer.createParentToken(ctx, pToken, uid, platform, nil)
+}
+
+// CreateParentTokenWithMeta 创建父级token，并记录设备信息，如ip、user agent，ListSessions时返回
+func (s *Storage) CreateParentTokenWithMeta(ctx context.Context, pToken dto.Token, uid int64, platform string, meta map[string]string) (err error) {
+	return s.tokenServer.createParentToken(ctx, pToken, uid, platform, meta)
 }
 
 // RenewParentToken 续期父级token
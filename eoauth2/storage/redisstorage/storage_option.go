@@ -25,3 +25,29 @@ func WithParentAccessExpiration(key int64) Option {
 		c.config.parentAccessExpiration = key
 	}
 }
+
+func WithRefreshTokenKey(key string) Option {
+	return func(c *Storage) {
+		c.config.refreshTokenKey = key
+	}
+}
+
+func WithRefreshTokenFamilyKey(key string) Option {
+	return func(c *Storage) {
+		c.config.refreshTokenFamilyKey = key
+	}
+}
+
+// WithSlidingExpiration 滑动过期时间（秒），每次使用parent token时有效期延长到该时间，不超过ParentAccessExpiration
+func WithSlidingExpiration(expiration int64) Option {
+	return func(c *Storage) {
+		c.config.slidingExpiration = expiration
+	}
+}
+
+// WithIdleTimeout 空闲超时时间（秒），parent token超过该时间没有使用则失效
+func WithIdleTimeout(timeout int64) Option {
+	return func(c *Storage) {
+		c.config.idleTimeout = timeout
+	}
+}
@@ -0,0 +1,58 @@
+package redisstorage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gotomicro/ego-component/eoauth2/server"
+	"github.com/gotomicro/ego-component/eoauth2/storage/dao"
+	"github.com/gotomicro/ego-component/eredis"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestStorage 使用miniredis、sqlite创建Storage
+func newTestStorage(t *testing.T, options ...Option) (*Storage, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(mr.Close)
+	redis := eredis.DefaultContainer().Build(eredis.WithStub(), eredis.WithAddr(mr.Addr()))
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "oauth2.db")), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&dao.App{}, &dao.Access{}, &dao.Refresh{}, &dao.Expires{}, &dao.Authorize{}))
+	// SaveAccess累加app表的call_no
+	require.NoError(t, db.Exec("ALTER TABLE app ADD COLUMN call_no integer NOT NULL DEFAULT 0").Error)
+	return NewStorage(db, redis, elog.DefaultLogger, options...), mr
+}
+
+func TestSaveAuthorizePKCE(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestStorage(t)
+	require.NoError(t, s.db.Create(&dao.App{ClientId: "client", Secret: "secret"}).Error)
+	for _, method := range []string{server.PKCE_S256, server.PKCE_PLAIN, ""} {
+		code := "code-" + method
+		require.NoError(t, s.SaveAuthorize(ctx, &server.AuthorizeData{
+			Client:              &server.DefaultClient{Id: "client"},
+			Code:                code,
+			ExpiresIn:           600,
+			RedirectUri:         "https://app.example.com/cb",
+			CreatedAt:           time.Now(),
+			CodeChallenge:       "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+			CodeChallengeMethod: method,
+		}))
+
+		// 换取token时需要读取code_challenge校验code_verifier
+		data, err := s.LoadAuthorize(ctx, code)
+		require.NoError(t, err)
+		assert.Equal(t, "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", data.CodeChallenge)
+		assert.Equal(t, method, data.CodeChallengeMethod)
+		assert.Equal(t, "client", data.Client.GetId())
+	}
+}
@@ -17,11 +17,15 @@ const (
 	newTokenKeyPrefix      = "ssoNewToken:%s"
 )
 
+// ErrParentTokenExpired parent token空闲超时或者超过最长有效期
+var ErrParentTokenExpired = errors.New("parent token expired")
+
 type tokenServer struct {
 	redis             *eredis.Component
 	uidMapParentToken *uidMapParentToken
 	parentToken       *parentToken
 	subToken          *subToken
+	refresh           *refreshToken
 	config            *config
 }
 
@@ -32,11 +36,12 @@ func initTokenServer(config *config, redis *eredis.Component) *tokenServer {
 		uidMapParentToken: newUidMapParentToken(config, redis),
 		parentToken:       newParentToken(config, redis),
 		subToken:          newSubToken(config, redis),
+		refresh:           newRefreshToken(config, redis),
 	}
 }
 
 // createParentToken sso的父节点token
-func (t *tokenServer) createParentToken(ctx context.Context, pToken dto.Token, uid int64, platform string) (err error) {
+func (t *tokenServer) createParentToken(ctx context.Context, pToken dto.Token, uid int64, platform string, meta map[string]string) (err error) {
 	// 1 设置uid 到 parent token关系
 	err = t.uidMapParentToken.setToken(ctx, uid, platform, pToken)
 	if err != nil {
@@ -44,7 +49,7 @@ func (t *tokenServer) createParentToken(ctx context.Context, pToken dto.Token, u
 	}
 
 	// 2 创建父级的token信息
-	return t.parentToken.create(ctx, pToken, platform, uid)
+	return t.parentToken.create(ctx, pToken, platform, uid, meta)
 }
 
 func (t *tokenServer) renewParentToken(ctx context.Context, pToken dto.Token) (err error) {
@@ -67,6 +72,35 @@ func (t *tokenServer) createToken(ctx context.Context, clientId string, token dt
 	return
 }
 
+// createRefreshToken 保存refresh token，通过refresh token刷新时继承之前的token family
+func (t *tokenServer) createRefreshToken(ctx context.Context, token string, accessToken string, prevToken string) error {
+	family := ""
+	if prevToken != "" {
+		_, family, _, _, _ = t.refresh.get(ctx, prevToken)
+	}
+	return t.refresh.create(ctx, token, accessToken, family)
+}
+
+// revokeRefreshFamily 删除family中的所有refresh token，以及这些refresh token签发的子系统token
+func (t *tokenServer) revokeRefreshFamily(ctx context.Context, family string) (accessTokens []string, err error) {
+	accessTokens, err = t.refresh.deleteFamily(ctx, family)
+	if err != nil {
+		return
+	}
+	if len(accessTokens) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(accessTokens))
+	for _, accessToken := range accessTokens {
+		keys = append(keys, t.subToken.getKey(accessToken))
+	}
+	err = t.redis.Client().Del(ctx, keys...).Err()
+	if err != nil {
+		err = fmt.Errorf("tokenServer.revokeRefreshFamily remove sub token failed, err:%w", err)
+	}
+	return
+}
+
 func (t *tokenServer) removeParentToken(ctx context.Context, pToken string) (err error) {
 	return t.parentToken.delete(ctx, pToken)
 }
@@ -81,6 +115,11 @@ func (t *tokenServer) getToken(clientId string, pToken string) (tokenInfo dto.To
 }
 
 func (t *tokenServer) getUidByParentToken(ctx context.Context, pToken string) (uid int64, err error) {
+	// 每次通过parent token获取用户信息都视为一次使用
+	err = t.parentToken.touch(ctx, pToken)
+	if err != nil {
+		return
+	}
 	return t.parentToken.getUid(ctx, pToken)
 }
 
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -14,17 +15,42 @@ import (
 const tokenKeyPattern = "/token/%d"
 
 type Component struct {
-	config *config
-	client *redis.Client
-	logger *elog.Component
+	config  *config
+	client  *redis.Client
+	logger  *elog.Component
+	keys    *keySet
+	jwks    *jwksCache
+	issuers map[string]*issuer
 }
 
 func newComponent(cfg *config, client *redis.Client, logger *elog.Component) *Component {
-	return &Component{
+	c := &Component{
 		config: cfg,
 		client: client,
 		logger: logger,
+		keys:   newKeySet(),
 	}
+	signingKid := cfg.SigningKid
+	if signingKid == "" && len(cfg.SigningKeys) > 0 {
+		signingKid = cfg.SigningKeys[len(cfg.SigningKeys)-1].Kid
+	}
+	for _, key := range cfg.SigningKeys {
+		if err := c.keys.add(key, key.Kid == signingKid); err != nil {
+			logger.Panic("parse signing key panic", elog.FieldErr(err), elog.String("kid", key.Kid))
+		}
+	}
+	// 兼容之前的配置，使用AccessTokenKey签发，只使用JWKS校验时不需要本地密钥
+	if len(cfg.SigningKeys) == 0 && cfg.JwksURL == "" {
+		if err := c.keys.add(SigningKey{Secret: cfg.AccessTokenKey}, true); err != nil {
+			logger.Panic("parse access token key panic", elog.FieldErr(err))
+		}
+	}
+	if cfg.JwksURL != "" {
+		c.jwks = newJwksCache(cfg.JwksURL, cfg, logger)
+		c.jwks.start()
+	}
+	c.issuers = newIssuers(cfg, logger)
+	return c
 }
 
 type AccessTokenTicket struct {
@@ -32,9 +58,30 @@ type AccessTokenTicket struct {
 	ExpiresIn   int64  `json:"expiresIn"`
 }
 
-func (c *Component) CreateAccessToken(uid int, startTime int64) (resp AccessTokenTicket, err error) {
+// TokenOption 签发token时设置额外的声明
+type TokenOption func(claims jwt.MapClaims)
+
+// WithScopes 签发的token包含scope声明（空格分隔），用于Permissions校验Scopes
+func WithScopes(scopes ...string) TokenOption {
+	return func(claims jwt.MapClaims) {
+		if len(scopes) > 0 {
+			claims["scope"] = strings.Join(scopes, " ")
+		}
+	}
+}
+
+// WithRoles 签发的token包含roles声明，用于Permissions校验Roles
+func WithRoles(roles ...string) TokenOption {
+	return func(claims jwt.MapClaims) {
+		if len(roles) > 0 {
+			claims["roles"] = roles
+		}
+	}
+}
+
+func (c *Component) CreateAccessToken(uid int, startTime int64, options ...TokenOption) (resp AccessTokenTicket, err error) {
 	// using the uid as the jwtId
-	tokenString, err := c.EncodeAccessToken(uid, uid, startTime)
+	tokenString, err := c.EncodeAccessToken(uid, uid, startTime, options...)
 	if err != nil {
 		return
 	}
@@ -49,20 +96,13 @@ func (c *Component) CreateAccessToken(uid int, startTime int64) (resp AccessToke
 	return
 }
 
+// CheckAccessToken 校验token是否有效，被吊销的token无效，需要错误原因时使用ValidateAccessToken
 func (c *Component) CheckAccessToken(tokenStr string) bool {
-	sc, err := c.DecodeAccessToken(tokenStr)
-	if err != nil {
-		return false
-	}
-	uid := sc["jti"].(float64)
-	uidInt := int(uid)
-	err = c.client.Get(context.Background(), fmt.Sprintf(c.config.TokenPrefix+tokenKeyPattern, uidInt)).Err()
-	if err != nil {
-		return false
-	}
-	return true
+	_, err := c.ValidateAccessToken(context.Background(), tokenStr)
+	return err == nil
 }
 
+// RefreshAccessToken 签发新的token，保留之前token的scope、roles
 func (c *Component) RefreshAccessToken(tokenStr string, startTime int64) (resp AccessTokenTicket, err error) {
 	sc, err := c.DecodeAccessToken(tokenStr)
 	if err != nil {
@@ -70,19 +110,30 @@ func (c *Component) RefreshAccessToken(tokenStr string, startTime int64) (resp A
 	}
 	uid := sc["jti"].(float64)
 	uidInt := int(uid)
-	return c.CreateAccessToken(uidInt, startTime)
+	return c.CreateAccessToken(uidInt, startTime, WithScopes(claimStrings(sc, "scope", "scp")...), WithRoles(claimStrings(sc, "roles", "role")...))
 }
 
-func (c *Component) EncodeAccessToken(jwtId int, uid int, startTime int64) (tokenStr string, err error) {
-	jwtToken := jwt.New(jwt.SigningMethodHS256)
+// EncodeAccessToken 签发token，options用于设置scope、roles等声明
+func (c *Component) EncodeAccessToken(jwtId int, uid int, startTime int64, options ...TokenOption) (tokenStr string, err error) {
+	key := c.keys.signingKey()
+	if key == nil {
+		return "", errors.New("etoken: no signing key")
+	}
+	jwtToken := jwt.New(key.method)
+	if key.kid != "" {
+		jwtToken.Header["kid"] = key.kid
+	}
 	claims := make(jwt.MapClaims)
 	claims["jti"] = jwtId
 	claims["iss"] = c.config.AccessTokenIss
 	claims["sub"] = uid
 	claims["iat"] = startTime
 	claims["exp"] = startTime + c.config.AccessTokenExpireInterval
+	for _, option := range options {
+		option(claims)
+	}
 	jwtToken.Claims = claims
-	tokenStr, err = jwtToken.SignedString([]byte(c.config.AccessTokenKey))
+	tokenStr, err = jwtToken.SignedString(key.signKey)
 	if err != nil {
 		return
 	}
@@ -90,9 +141,7 @@ func (c *Component) EncodeAccessToken(jwtId int, uid int, startTime int64) (toke
 }
 
 func (c *Component) DecodeAccessToken(tokenStr string) (resp map[string]interface{}, err error) {
-	tokenParse, err := jwt.Parse(tokenStr, func(jwtToken *jwt.Token) (interface{}, error) {
-		return []byte(c.config.AccessTokenKey), nil
-	})
+	tokenParse, err := jwt.Parse(tokenStr, keyFunc(c.keys, c.jwks))
 	if err != nil {
 		return
 	}
@@ -104,3 +153,49 @@ func (c *Component) DecodeAccessToken(tokenStr string) (resp map[string]interfac
 	}
 	return
 }
+
+// keyFunc 根据token header的kid选择校验密钥，本地密钥优先，其次是JWKS
+func keyFunc(keys *keySet, jwks *jwksCache) jwt.Keyfunc {
+	return func(jwtToken *jwt.Token) (interface{}, error) {
+		kid, _ := jwtToken.Header["kid"].(string)
+		key, ok := keys.get(kid)
+		if !ok {
+			if jwks == nil {
+				return nil, ErrKeyNotFound
+			}
+			var err error
+			key, err = jwks.get(context.Background(), kid)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if jwtToken.Method.Alg() != key.method.Alg() {
+			return nil, ErrAlgorithmMismatch
+		}
+		return key.verifyKey, nil
+	}
+}
+
+// RotateSigningKey 添加新的密钥并使用它签发token，之前的密钥仍然可以校验已经签发的token。
+// 多实例部署时需要每个实例都轮换，或者通过配置SigningKeys、SigningKid轮换
+func (c *Component) RotateSigningKey(key SigningKey) error {
+	return c.keys.add(key, true)
+}
+
+// RemoveSigningKey 删除不再使用的密钥，它签发的token将无法通过校验，不能删除当前的签发密钥
+func (c *Component) RemoveSigningKey(kid string) error {
+	return c.keys.remove(kid)
+}
+
+// Close 停止JWKS后台刷新
+func (c *Component) Close() error {
+	if c.jwks != nil {
+		c.jwks.close()
+	}
+	for _, iss := range c.issuers {
+		if iss.jwks != nil {
+			iss.jwks.close()
+		}
+	}
+	return nil
+}
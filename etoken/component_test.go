@@ -0,0 +1,26 @@
+package etoken
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+// newTestComponent 使用miniredis创建组件，cfg为nil时使用默认配置
+func newTestComponent(t *testing.T, cfg *config) (*Component, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	if cfg == nil {
+		cfg = DefaultConfig()
+	}
+	c := newComponent(cfg, client, elog.DefaultLogger)
+	t.Cleanup(func() { c.Close() })
+	return c, mr
+}
@@ -1,5 +1,7 @@
 package etoken
 
+import "time"
+
 type Option func(c *Container)
 
 // PackageName ..
@@ -11,6 +13,30 @@ type config struct {
 	AccessTokenKey            string
 	AccessTokenExpireInterval int64
 	TokenPrefix               string
+	// SigningKeys 签发、校验token的密钥，配置后不再使用AccessTokenKey。
+	// 轮换时追加新的密钥并修改SigningKid，旧的密钥保留到它签发的token都过期后再删除。
+	// 之前通过AccessTokenKey签发的token没有kid，迁移时可以保留一个Kid为空、Secret为AccessTokenKey的密钥
+	SigningKeys []SigningKey
+	SigningKid  string // 签发token使用的密钥，为空时使用SigningKeys中的最后一个
+	// JwksURL 远程JWKS地址，配置后根据token header的kid从JWKS中选择公钥校验，用于校验其他服务签发的token
+	JwksURL                string
+	JwksRefreshInterval    time.Duration // 后台刷新JWKS的间隔，默认10m，小于等于0时不刷新
+	JwksMinRefreshInterval time.Duration // kid找不到时重新加载JWKS的最小间隔，默认30s
+	JwksTimeout            time.Duration // 请求JWKS的超时时间，默认3s
+	// Permissions 接口需要的权限，key为egin的"GET /api/users/:id"或者egrpc的"/pkg.Service/Method"，
+	// "*"用于没有配置的接口，没有配置"*"时拒绝访问没有配置的接口，不需要token的接口配置Anonymous
+	Permissions map[string]Permission
+	// Issuers 信任的其他签发方，VerifyToken根据token的iss选择签发方的密钥、audience、时钟偏差校验token
+	Issuers []IssuerConfig
+}
+
+// IssuerConfig 信任的签发方
+type IssuerConfig struct {
+	Issuer      string        // token的iss
+	Audiences   []string      // 允许的aud，token的aud包含其中一个即可，为空时不校验aud
+	ClockSkew   time.Duration // 校验exp、nbf、iat时允许的时钟偏差
+	SigningKeys []SigningKey  // 签发方的密钥，一般只需要配置公钥
+	JwksURL     string        // 签发方的JWKS地址，与SigningKeys至少配置一个
 }
 
 // DefaultConfig ...
@@ -20,5 +46,15 @@ func DefaultConfig() *config {
 		AccessTokenKey:            "ecologysK#xo",
 		AccessTokenExpireInterval: 24 * 3600,
 		TokenPrefix:               "/egotoken",
+		JwksRefreshInterval:       10 * time.Minute,
+		JwksMinRefreshInterval:    30 * time.Second,
+		JwksTimeout:               3 * time.Second,
 	}
 }
+
+// Permission 接口需要的权限，Scopes、Roles都为空时只校验token
+type Permission struct {
+	Scopes    []string // token需要包含全部scope，取自scope（空格分隔）或者scp声明，本服务通过WithScopes签发
+	Roles     []string // token需要包含其中一个role，取自roles或者role声明，本服务通过WithRoles签发
+	Anonymous bool     // 公开的接口，不校验token
+}
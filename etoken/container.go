@@ -44,3 +44,15 @@ func WithRedis(client *eredis.Component) Option {
 		c.client = client.Stub()
 	}
 }
+
+// WithPermissions 设置接口需要的权限，与配置中的Permissions合并，相同的接口以此为准
+func WithPermissions(permissions map[string]Permission) Option {
+	return func(c *Container) {
+		if c.config.Permissions == nil {
+			c.config.Permissions = make(map[string]Permission, len(permissions))
+		}
+		for route, permission := range permissions {
+			c.config.Permissions[route] = permission
+		}
+	}
+}
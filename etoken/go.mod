@@ -4,11 +4,15 @@ go 1.16
 
 require (
 	github.com/HdrHistogram/hdrhistogram-go v1.1.0 // indirect
+	github.com/alicebob/miniredis/v2 v2.14.3
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/frankban/quicktest v1.11.3 // indirect
+	github.com/gin-gonic/gin v1.7.7
 	github.com/go-redis/redis/v8 v8.6.0
 	github.com/gotomicro/ego v0.8.0
 	github.com/gotomicro/ego-component/eredis v0.1.5-0.20210301102617-a45f200f21c4
 	github.com/pierrec/lz4 v2.6.0+incompatible // indirect
+	github.com/stretchr/testify v1.7.0
 	github.com/uber/jaeger-lib v2.4.1+incompatible // indirect
+	google.golang.org/grpc v1.42.0
 )
@@ -0,0 +1,162 @@
+package etoken
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+var (
+	// ErrUnknownIssuer token的iss不是信任的签发方
+	ErrUnknownIssuer = errors.New("etoken: unknown issuer")
+	// ErrInvalidAudience token的aud不包含签发方配置的audience
+	ErrInvalidAudience = errors.New("etoken: invalid audience")
+)
+
+// issuer 信任的签发方，密钥与本服务签发token的密钥相互独立
+type issuer struct {
+	config IssuerConfig
+	keys   *keySet
+	jwks   *jwksCache
+}
+
+func newIssuers(cfg *config, logger *elog.Component) map[string]*issuer {
+	issuers := make(map[string]*issuer, len(cfg.Issuers))
+	for _, issCfg := range cfg.Issuers {
+		if issCfg.Issuer == "" {
+			logger.Panic("issuer is empty", elog.FieldValueAny(issCfg))
+		}
+		if len(issCfg.SigningKeys) == 0 && issCfg.JwksURL == "" {
+			logger.Panic("issuer has no signing keys or jwks url", elog.String("issuer", issCfg.Issuer))
+		}
+		iss := &issuer{
+			config: issCfg,
+			keys:   newKeySet(),
+		}
+		for _, key := range issCfg.SigningKeys {
+			if err := iss.keys.add(key, false); err != nil {
+				logger.Panic("parse issuer signing key panic", elog.FieldErr(err), elog.String("issuer", issCfg.Issuer), elog.String("kid", key.Kid))
+			}
+		}
+		if issCfg.JwksURL != "" {
+			iss.jwks = newJwksCache(issCfg.JwksURL, cfg, logger.With(elog.String("issuer", issCfg.Issuer)))
+			iss.jwks.start()
+		}
+		issuers[issCfg.Issuer] = iss
+	}
+	return issuers
+}
+
+// VerifyToken 校验token的签名和声明，根据token的iss从Issuers中选择签发方的密钥、audience、时钟偏差，
+// iss为AccessTokenIss且不在Issuers中时使用本服务的密钥校验，Issuers签发的token必须包含exp。
+// 只校验token本身，不检查是否被吊销，用于校验其他身份提供方签发的token
+func (c *Component) VerifyToken(tokenStr string) (map[string]interface{}, error) {
+	unverified, _, err := new(jwt.Parser).ParseUnverified(tokenStr, jwt.MapClaims{})
+	if err != nil {
+		return nil, err
+	}
+	iss, _ := unverified.Claims.(jwt.MapClaims)["iss"].(string)
+	selected, ok := c.issuers[iss]
+	if !ok {
+		if iss != c.config.AccessTokenIss {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownIssuer, iss)
+		}
+		return c.DecodeAccessToken(tokenStr)
+	}
+
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	tokenParse, err := parser.Parse(tokenStr, keyFunc(selected.keys, selected.jwks))
+	if err != nil {
+		return nil, err
+	}
+	claims, ok := tokenParse.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("assert error")
+	}
+	if err = selected.verifyClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// verifyClaims 校验exp、nbf、iat、aud，exp必须存在，exp、nbf、iat允许ClockSkew的偏差
+func (i *issuer) verifyClaims(claims jwt.MapClaims, now time.Time) error {
+	skew := int64(i.config.ClockSkew / time.Second)
+	ts := now.Unix()
+	exp, ok, err := numericClaim(claims, "exp")
+	if err != nil {
+		return err
+	}
+	// 没有exp的token永远不会过期
+	if !ok {
+		return jwt.NewValidationError("token has no exp", jwt.ValidationErrorClaimsInvalid)
+	}
+	if ts-skew > exp {
+		return jwt.NewValidationError("token is expired", jwt.ValidationErrorExpired)
+	}
+	nbf, ok, err := numericClaim(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && ts+skew < nbf {
+		return jwt.NewValidationError("token is not valid yet", jwt.ValidationErrorNotValidYet)
+	}
+	iat, ok, err := numericClaim(claims, "iat")
+	if err != nil {
+		return err
+	}
+	if ok && ts+skew < iat {
+		return jwt.NewValidationError("token used before issued", jwt.ValidationErrorIssuedAt)
+	}
+	if len(i.config.Audiences) > 0 && !containsAudience(claims["aud"], i.config.Audiences) {
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// numericClaim 读取exp、nbf、iat等时间声明，ok为false表示没有该声明，不是数字时返回错误
+func numericClaim(claims jwt.MapClaims, name string) (value int64, ok bool, err error) {
+	raw, ok := claims[name]
+	if !ok {
+		return 0, false, nil
+	}
+	switch v := raw.(type) {
+	case float64:
+		return int64(v), true, nil
+	case json.Number:
+		value, err = v.Int64()
+		if err == nil {
+			return value, true, nil
+		}
+	}
+	return 0, false, jwt.NewValidationError(fmt.Sprintf("token %s is not a number", name), jwt.ValidationErrorClaimsInvalid)
+}
+
+// containsAudience aud可以是字符串或者字符串数组
+func containsAudience(aud interface{}, audiences []string) bool {
+	var values []string
+	switch v := aud.(type) {
+	case string:
+		values = []string{v}
+	case []interface{}:
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+	case []string:
+		values = v
+	}
+	for _, value := range values {
+		for _, audience := range audiences {
+			if value == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package etoken
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyClaims(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	ts := float64(now.Unix())
+	iss := &issuer{config: IssuerConfig{Issuer: "idp", ClockSkew: 10 * time.Second, Audiences: []string{"api"}}}
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		errCode uint32
+		wantErr error
+	}{
+		{name: "valid", claims: jwt.MapClaims{"exp": ts + 60, "nbf": ts, "iat": ts, "aud": "api"}},
+		{name: "json number", claims: jwt.MapClaims{"exp": json.Number("1600000060"), "nbf": json.Number("1600000000"), "aud": []interface{}{"web", "api"}}},
+		{name: "no exp", claims: jwt.MapClaims{"aud": "api"}, errCode: jwt.ValidationErrorClaimsInvalid},
+		{name: "exp not number", claims: jwt.MapClaims{"exp": "1600000060", "aud": "api"}, errCode: jwt.ValidationErrorClaimsInvalid},
+		{name: "expired", claims: jwt.MapClaims{"exp": ts - 11, "aud": "api"}, errCode: jwt.ValidationErrorExpired},
+		{name: "expired within skew", claims: jwt.MapClaims{"exp": ts - 10, "aud": "api"}},
+		{name: "not valid yet", claims: jwt.MapClaims{"exp": ts + 60, "nbf": ts + 11, "aud": "api"}, errCode: jwt.ValidationErrorNotValidYet},
+		{name: "nbf within skew", claims: jwt.MapClaims{"exp": ts + 60, "nbf": ts + 10, "aud": "api"}},
+		{name: "nbf not number", claims: jwt.MapClaims{"exp": ts + 60, "nbf": "later", "aud": "api"}, errCode: jwt.ValidationErrorClaimsInvalid},
+		{name: "issued in future", claims: jwt.MapClaims{"exp": ts + 60, "iat": ts + 11, "aud": "api"}, errCode: jwt.ValidationErrorIssuedAt},
+		{name: "iat not number", claims: jwt.MapClaims{"exp": ts + 60, "iat": true, "aud": "api"}, errCode: jwt.ValidationErrorClaimsInvalid},
+		{name: "wrong audience", claims: jwt.MapClaims{"exp": ts + 60, "aud": "web"}, wantErr: ErrInvalidAudience},
+		{name: "no audience", claims: jwt.MapClaims{"exp": ts + 60}, wantErr: ErrInvalidAudience},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := iss.verifyClaims(tt.claims, now)
+			switch {
+			case tt.wantErr != nil:
+				assert.Equal(t, tt.wantErr, err)
+			case tt.errCode != 0:
+				require.Error(t, err)
+				ve, ok := err.(*jwt.ValidationError)
+				require.True(t, ok)
+				assert.Equal(t, tt.errCode, ve.Errors)
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestVerifyToken(t *testing.T) {
+	keys := newTestKeys(t)
+	cfg := DefaultConfig()
+	cfg.Issuers = []IssuerConfig{
+		{Issuer: "idp", Audiences: []string{"api"}, SigningKeys: []SigningKey{{Kid: "idp-1", Algorithm: "RS256", PublicKey: keys.rsaPublic}}},
+	}
+	c := newComponent(cfg, nil, elog.DefaultLogger)
+	defer c.Close()
+
+	sign := func(claims jwt.MapClaims, kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = kid
+		tokenStr, err := token.SignedString(keys.rsa)
+		require.NoError(t, err)
+		return tokenStr
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	claims, err := c.VerifyToken(sign(jwt.MapClaims{"iss": "idp", "sub": "u1", "aud": "api", "exp": exp}, "idp-1"))
+	require.NoError(t, err)
+	assert.Equal(t, "u1", claims["sub"])
+
+	// 其他签发方的token必须包含exp
+	_, err = c.VerifyToken(sign(jwt.MapClaims{"iss": "idp", "sub": "u1", "aud": "api"}, "idp-1"))
+	assert.Error(t, err)
+	_, err = c.VerifyToken(sign(jwt.MapClaims{"iss": "idp", "aud": "web", "exp": exp}, "idp-1"))
+	assert.Equal(t, ErrInvalidAudience, err)
+	_, err = c.VerifyToken(sign(jwt.MapClaims{"iss": "other", "aud": "api", "exp": exp}, "idp-1"))
+	assert.True(t, errors.Is(err, ErrUnknownIssuer))
+	// 签发方的密钥与本服务的密钥相互独立
+	_, err = c.VerifyToken(sign(jwt.MapClaims{"iss": cfg.AccessTokenIss, "exp": exp}, "idp-1"))
+	assert.Error(t, err)
+
+	// 本服务签发的token
+	token, err := c.EncodeAccessToken(1, 1, time.Now().Unix())
+	require.NoError(t, err)
+	claims, err = c.VerifyToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), claims["sub"])
+}
@@ -0,0 +1,293 @@
+package etoken
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gotomicro/ego/core/elog"
+)
+
+// maxJwksBodySize JWKS响应的最大字节数
+const maxJwksBodySize = 1 << 20
+
+// jwk JSON Web Key，只支持RSA、EC公钥
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwksCache 缓存远程JWKS的公钥，后台定时刷新，kid找不到时立即刷新（限制最小间隔，避免伪造的kid打满JWKS服务）
+type jwksCache struct {
+	url                string
+	client             *http.Client
+	logger             *elog.Component
+	refreshInterval    time.Duration
+	minRefreshInterval time.Duration
+
+	mu          sync.RWMutex
+	keys        map[string]*verifyKey
+	lastRefresh time.Time
+	refreshMu   sync.Mutex
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+func newJwksCache(url string, config *config, logger *elog.Component) *jwksCache {
+	return &jwksCache{
+		url:                url,
+		client:             &http.Client{Timeout: config.JwksTimeout},
+		logger:             logger,
+		refreshInterval:    config.JwksRefreshInterval,
+		minRefreshInterval: config.JwksMinRefreshInterval,
+		keys:               make(map[string]*verifyKey),
+		stop:               make(chan struct{}),
+	}
+}
+
+// start 首次加载JWKS并启动后台刷新，首次加载失败时只记录日志，校验时会再次尝试加载
+func (j *jwksCache) start() {
+	if err := j.refresh(context.Background()); err != nil {
+		j.logger.Error("load jwks fail", elog.FieldErr(err), elog.String("url", j.url))
+	}
+	if j.refreshInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(j.refreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := j.refresh(context.Background()); err != nil {
+					j.logger.Error("refresh jwks fail", elog.FieldErr(err), elog.String("url", j.url))
+				}
+			case <-j.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (j *jwksCache) close() {
+	j.stopOnce.Do(func() {
+		close(j.stop)
+	})
+}
+
+// get 根据kid获取公钥，找不到时距离上次刷新超过minRefreshInterval则重新加载
+func (j *jwksCache) get(ctx context.Context, kid string) (*verifyKey, error) {
+	if k, ok := j.lookup(kid); ok {
+		return k, nil
+	}
+	j.mu.RLock()
+	lastRefresh := j.lastRefresh
+	j.mu.RUnlock()
+	if time.Since(lastRefresh) < j.minRefreshInterval {
+		return nil, ErrKeyNotFound
+	}
+	if err := j.refresh(ctx); err != nil {
+		return nil, err
+	}
+	if k, ok := j.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+func (j *jwksCache) lookup(kid string) (*verifyKey, bool) {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	k, ok := j.keys[kid]
+	return k, ok
+}
+
+// refresh 加载JWKS，并发调用时只请求一次
+func (j *jwksCache) refresh(ctx context.Context) error {
+	j.mu.RLock()
+	lastRefresh := j.lastRefresh
+	j.mu.RUnlock()
+
+	j.refreshMu.Lock()
+	defer j.refreshMu.Unlock()
+	j.mu.RLock()
+	refreshed := j.lastRefresh.After(lastRefresh)
+	j.mu.RUnlock()
+	if refreshed {
+		return nil
+	}
+
+	keys, err := j.fetch(ctx)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	// 失败也记录刷新时间，避免JWKS服务不可用时每次校验都请求
+	j.lastRefresh = time.Now()
+	if err != nil {
+		return err
+	}
+	j.keys = keys
+	return nil
+}
+
+func (j *jwksCache) fetch(ctx context.Context) (map[string]*verifyKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("etoken: new jwks request, err: %w", err)
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("etoken: fetch jwks, err: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("etoken: fetch jwks, status: %d", resp.StatusCode)
+	}
+	// 限制响应大小，避免异常的JWKS服务占满内存
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxJwksBodySize+1))
+	if err != nil {
+		return nil, fmt.Errorf("etoken: read jwks, err: %w", err)
+	}
+	if len(body) > maxJwksBodySize {
+		return nil, fmt.Errorf("etoken: jwks response exceeds %d bytes", maxJwksBodySize)
+	}
+	var set jwkSet
+	if err = json.Unmarshal(body, &set); err != nil {
+		return nil, fmt.Errorf("etoken: decode jwks, err: %w", err)
+	}
+	keys := make(map[string]*verifyKey, len(set.Keys))
+	for _, key := range set.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		k, err := key.verifyKey()
+		if err != nil {
+			j.logger.Warn("skip jwk", elog.FieldErr(err), elog.String("kid", key.Kid))
+			continue
+		}
+		keys[k.kid] = k
+	}
+	return keys, nil
+}
+
+// verifyKey 将JWK解析为公钥，没有alg时根据kty、crv推断
+func (key jwk) verifyKey() (*verifyKey, error) {
+	k := &verifyKey{kid: key.Kid}
+	alg := key.Alg
+	switch key.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("etoken: decode jwk n, err: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("etoken: decode jwk e, err: %w", err)
+		}
+		k.verifyKey = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if alg == "" {
+			alg = jwt.SigningMethodRS256.Alg()
+		}
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Crv {
+		case "P-256":
+			curve, alg = elliptic.P256(), defaultString(alg, jwt.SigningMethodES256.Alg())
+		case "P-384":
+			curve, alg = elliptic.P384(), defaultString(alg, jwt.SigningMethodES384.Alg())
+		case "P-521":
+			curve, alg = elliptic.P521(), defaultString(alg, jwt.SigningMethodES512.Alg())
+		default:
+			return nil, fmt.Errorf("etoken: unsupported jwk crv %s", key.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil {
+			return nil, fmt.Errorf("etoken: decode jwk x, err: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(key.Y)
+		if err != nil {
+			return nil, fmt.Errorf("etoken: decode jwk y, err: %w", err)
+		}
+		k.verifyKey = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	default:
+		return nil, fmt.Errorf("etoken: unsupported jwk kty %s", key.Kty)
+	}
+	k.method = jwt.GetSigningMethod(alg)
+	if k.method == nil {
+		return nil, fmt.Errorf("etoken: unsupported jwk alg %s", alg)
+	}
+	return k, nil
+}
+
+// newJwk 将公钥转换为JWK
+func newJwk(k *verifyKey) (jwk, bool) {
+	key := jwk{Kid: k.kid, Use: "sig", Alg: k.method.Alg()}
+	switch pub := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		key.Kty = "RSA"
+		key.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		key.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		key.Kty = "EC"
+		key.Crv = pub.Curve.Params().Name
+		key.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		key.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+	default:
+		return jwk{}, false
+	}
+	return key, true
+}
+
+// JWKS 本地非对称密钥的公钥，供其他服务通过JwksURL校验本服务签发的token，HMAC密钥不会公开
+func (c *Component) JWKS() ([]byte, error) {
+	set := jwkSet{Keys: make([]jwk, 0)}
+	for _, k := range c.keys.list() {
+		if key, ok := newJwk(k); ok {
+			set.Keys = append(set.Keys, key)
+		}
+	}
+	return json.Marshal(set)
+}
+
+// JWKSHandler 对外提供JWKS，一般挂载在/.well-known/jwks.json
+func (c *Component) JWKSHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := c.JWKS()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "max-age=300")
+		_, _ = w.Write(body)
+	}
+}
+
+func defaultString(value string, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,255 @@
+package etoken
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gotomicro/ego/core/elog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJwkVerifyKey(t *testing.T) {
+	keys := newTestKeys(t)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	require.NoError(t, err)
+	rsaJwk, ok := newJwk(&verifyKey{kid: "rsa", method: jwt.SigningMethodPS256, verifyKey: &keys.rsa.PublicKey})
+	require.True(t, ok)
+
+	tests := []struct {
+		name    string
+		key     jwk
+		alg     string
+		public  interface{}
+		wantErr bool
+	}{
+		{name: "rsa", key: rsaJwk, alg: "PS256", public: &keys.rsa.PublicKey},
+		{name: "rsa without alg", key: jwk{Kty: "RSA", N: rsaJwk.N, E: rsaJwk.E}, alg: "RS256", public: &keys.rsa.PublicKey},
+		{name: "p-256 without alg", key: ecJwk(keys.ec), alg: "ES256", public: &keys.ec.PublicKey},
+		{name: "p-384 without alg", key: ecJwk(p384), alg: "ES384", public: &p384.PublicKey},
+		{name: "p-521 without alg", key: ecJwk(p521), alg: "ES512", public: &p521.PublicKey},
+		{name: "unsupported kty", key: jwk{Kty: "oct", Alg: "HS256"}, wantErr: true},
+		{name: "unsupported crv", key: jwk{Kty: "EC", Crv: "P-224"}, wantErr: true},
+		{name: "unsupported alg", key: jwk{Kty: "RSA", Alg: "RSA-OAEP", N: rsaJwk.N, E: rsaJwk.E}, wantErr: true},
+		{name: "invalid n", key: jwk{Kty: "RSA", N: "!", E: rsaJwk.E}, wantErr: true},
+		{name: "invalid x", key: jwk{Kty: "EC", Crv: "P-256", X: "!", Y: "AA"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := tt.key.verifyKey()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, k.method.Alg())
+			assert.Equal(t, tt.public, k.verifyKey)
+		})
+	}
+}
+
+// ecJwk 没有alg的EC公钥
+func ecJwk(key *ecdsa.PrivateKey) jwk {
+	k, _ := newJwk(&verifyKey{method: jwt.SigningMethodES256, verifyKey: &key.PublicKey})
+	k.Alg = ""
+	return k
+}
+
+// jwksServer 可以替换密钥的JWKS服务，记录请求次数
+type jwksServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	body     string
+	requests int32
+}
+
+func newJwksServer(t *testing.T, keys ...*verifyKey) *jwksServer {
+	s := &jwksServer{}
+	s.setKeys(t, keys...)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.requests, 1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_, _ = w.Write([]byte(s.body))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) setKeys(t *testing.T, keys ...*verifyKey) {
+	set := jwkSet{Keys: make([]jwk, 0, len(keys))}
+	for _, k := range keys {
+		key, ok := newJwk(k)
+		require.True(t, ok)
+		set.Keys = append(set.Keys, key)
+	}
+	body, err := json.Marshal(set)
+	require.NoError(t, err)
+	s.setBody(string(body))
+}
+
+func (s *jwksServer) setBody(body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.body = body
+}
+
+func newTestJwksCache(url string, minRefreshInterval time.Duration) *jwksCache {
+	cfg := DefaultConfig()
+	cfg.JwksRefreshInterval = 0
+	cfg.JwksMinRefreshInterval = minRefreshInterval
+	return newJwksCache(url, cfg, elog.DefaultLogger)
+}
+
+func TestJwksCache(t *testing.T) {
+	keys := newTestKeys(t)
+	v1 := &verifyKey{kid: "v1", method: jwt.SigningMethodRS256, verifyKey: &keys.rsa.PublicKey}
+	v2 := &verifyKey{kid: "v2", method: jwt.SigningMethodES256, verifyKey: &keys.ec.PublicKey}
+	srv := newJwksServer(t, v1)
+	j := newTestJwksCache(srv.URL, 100*time.Millisecond)
+	j.start()
+	defer j.close()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&srv.requests))
+
+	k, err := j.get(context.Background(), "v1")
+	require.NoError(t, err)
+	assert.Equal(t, &keys.rsa.PublicKey, k.verifyKey)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&srv.requests))
+
+	// 刚刷新过，找不到kid时不再请求
+	_, err = j.get(context.Background(), "unknown")
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&srv.requests))
+
+	// 超过最小间隔后，找不到kid时重新加载，伪造的kid只请求一次
+	srv.setKeys(t, v1, v2)
+	time.Sleep(150 * time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := j.get(context.Background(), "forged")
+			assert.Equal(t, ErrKeyNotFound, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&srv.requests))
+	k, err = j.get(context.Background(), "v2")
+	require.NoError(t, err)
+	assert.Equal(t, "ES256", k.method.Alg())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&srv.requests))
+}
+
+func TestJwksCacheFetch(t *testing.T) {
+	keys := newTestKeys(t)
+	rsaJwk, _ := newJwk(&verifyKey{kid: "v1", method: jwt.SigningMethodRS256, verifyKey: &keys.rsa.PublicKey})
+	encJwk := rsaJwk
+	encJwk.Kid, encJwk.Use = "enc", "enc"
+	body, err := json.Marshal(map[string]interface{}{"keys": []interface{}{
+		rsaJwk,
+		encJwk,
+		jwk{Kid: "bad", Kty: "EC", Crv: "P-224"},
+	}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		body    string
+		kids    []string
+		wantErr bool
+	}{
+		// 跳过加密用的密钥和不支持的密钥
+		{name: "skip unsupported keys", body: string(body), kids: []string{"v1"}},
+		{name: "empty", body: `{"keys":[]}`, kids: []string{}},
+		{name: "invalid json", body: `{"keys":`, wantErr: true},
+		{name: "too large", body: `{"keys":[],"padding":"` + strings.Repeat("a", maxJwksBodySize) + `"}`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newJwksServer(t)
+			srv.setBody(tt.body)
+			keys, err := newTestJwksCache(srv.URL, 0).fetch(context.Background())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			kids := make([]string, 0, len(keys))
+			for kid := range keys {
+				kids = append(kids, kid)
+			}
+			assert.Equal(t, tt.kids, kids)
+		})
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	_, err = newTestJwksCache(srv.URL, 0).fetch(context.Background())
+	assert.Error(t, err)
+}
+
+func TestKeyFuncJwks(t *testing.T) {
+	keys := newTestKeys(t)
+	srv := newJwksServer(t, &verifyKey{kid: "rsa", method: jwt.SigningMethodRS256, verifyKey: &keys.rsa.PublicKey})
+	j := newTestJwksCache(srv.URL, time.Minute)
+	local := newKeySet()
+	require.NoError(t, local.add(SigningKey{Kid: "hmac", Secret: "secret"}, true))
+
+	_, err := jwt.Parse(signToken(t, jwt.SigningMethodRS256, "rsa", keys.rsa), keyFunc(local, j))
+	assert.NoError(t, err)
+	_, err = jwt.Parse(signToken(t, jwt.SigningMethodHS256, "hmac", []byte("secret")), keyFunc(local, j))
+	assert.NoError(t, err)
+
+	// JWKS中公开的公钥不能作为HMAC密钥
+	_, err = jwt.Parse(signToken(t, jwt.SigningMethodHS256, "rsa", []byte(keys.rsaPublic)), keyFunc(local, j))
+	require.Error(t, err)
+	assert.Equal(t, ErrAlgorithmMismatch, err.(*jwt.ValidationError).Inner)
+	_, err = jwt.Parse(signToken(t, jwt.SigningMethodRS256, "unknown", keys.rsa), keyFunc(local, j))
+	require.Error(t, err)
+	assert.Equal(t, ErrKeyNotFound, err.(*jwt.ValidationError).Inner)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&srv.requests))
+}
+
+func TestJWKSHandler(t *testing.T) {
+	keys := newTestKeys(t)
+	cfg := DefaultConfig()
+	cfg.SigningKeys = []SigningKey{
+		{Kid: "hmac", Secret: "secret"},
+		{Kid: "rsa", Algorithm: "RS256", PrivateKey: keys.rsaPrivate},
+		{Kid: "ec", Algorithm: "ES256", PublicKey: keys.ecPublic},
+	}
+	cfg.SigningKid = "rsa"
+	c := newComponent(cfg, nil, elog.DefaultLogger)
+	defer c.Close()
+	srv := httptest.NewServer(c.JWKSHandler())
+	defer srv.Close()
+
+	// HMAC密钥不会公开
+	fetched, err := newTestJwksCache(srv.URL, 0).fetch(context.Background())
+	require.NoError(t, err)
+	require.Len(t, fetched, 2)
+	assert.Equal(t, &keys.rsa.PublicKey, fetched["rsa"].verifyKey)
+	assert.Equal(t, &keys.ec.PublicKey, fetched["ec"].verifyKey)
+
+	// 其他服务通过JWKS校验本服务签发的token
+	token, err := c.EncodeAccessToken(1, 1, time.Now().Unix())
+	require.NoError(t, err)
+	_, err = jwt.Parse(token, keyFunc(newKeySet(), newTestJwksCache(srv.URL, 0)))
+	assert.NoError(t, err)
+}
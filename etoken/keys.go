@@ -0,0 +1,185 @@
+package etoken
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	// ErrKeyNotFound token的kid找不到对应的密钥
+	ErrKeyNotFound = errors.New("etoken: signing key not found")
+	// ErrAlgorithmMismatch token的alg与密钥的算法不一致，防止使用公钥作为HMAC密钥伪造token
+	ErrAlgorithmMismatch = errors.New("etoken: signing algorithm mismatch")
+)
+
+// SigningKey 签发、校验token的密钥
+type SigningKey struct {
+	Kid        string // key id，写入token header的kid，校验时根据kid选择密钥
+	Algorithm  string // 签名算法，HS256、HS384、HS512、RS256、RS384、RS512、ES256、ES384、ES512、PS256等，默认HS256
+	Secret     string // HMAC密钥
+	PrivateKey string // RSA、ECDSA私钥，PEM内容或者PEM文件路径，用于签发
+	PublicKey  string // RSA、ECDSA公钥，PEM内容或者PEM文件路径，只用于校验时可以只配置公钥
+}
+
+// verifyKey 解析后的密钥
+type verifyKey struct {
+	kid       string
+	method    jwt.SigningMethod
+	signKey   interface{} // 为nil时不能用于签发
+	verifyKey interface{}
+}
+
+// keySet 本地密钥，轮换时追加新的密钥作为签发密钥，旧的密钥保留用于校验之前签发的token
+type keySet struct {
+	mu      sync.RWMutex
+	keys    map[string]*verifyKey
+	current *verifyKey
+}
+
+func newKeySet() *keySet {
+	return &keySet{keys: make(map[string]*verifyKey)}
+}
+
+// add 添加密钥，current为true时作为签发密钥
+func (s *keySet) add(key SigningKey, current bool) error {
+	k, err := parseSigningKey(key)
+	if err != nil {
+		return err
+	}
+	if current && k.signKey == nil {
+		return fmt.Errorf("etoken: signing key %s has no private key", key.Kid)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[k.kid] = k
+	if current {
+		s.current = k
+	}
+	return nil
+}
+
+// remove 删除密钥，不能删除当前的签发密钥
+func (s *keySet) remove(kid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current != nil && s.current.kid == kid {
+		return fmt.Errorf("etoken: cannot remove current signing key %s", kid)
+	}
+	delete(s.keys, kid)
+	return nil
+}
+
+func (s *keySet) signingKey() *verifyKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+func (s *keySet) get(kid string) (*verifyKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	k, ok := s.keys[kid]
+	return k, ok
+}
+
+func (s *keySet) list() []*verifyKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]*verifyKey, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// parseSigningKey 解析配置的密钥
+func parseSigningKey(key SigningKey) (*verifyKey, error) {
+	alg := key.Algorithm
+	if alg == "" {
+		alg = jwt.SigningMethodHS256.Alg()
+	}
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return nil, fmt.Errorf("etoken: unsupported signing algorithm %s", alg)
+	}
+	k := &verifyKey{kid: key.Kid, method: method}
+	switch method.(type) {
+	case *jwt.SigningMethodHMAC:
+		if key.Secret == "" {
+			return nil, fmt.Errorf("etoken: signing key %s secret is empty", key.Kid)
+		}
+		k.signKey = []byte(key.Secret)
+		k.verifyKey = []byte(key.Secret)
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		if key.PrivateKey != "" {
+			pem, err := readPEM(key.PrivateKey)
+			if err != nil {
+				return nil, err
+			}
+			priv, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, fmt.Errorf("etoken: parse signing key %s private key, err: %w", key.Kid, err)
+			}
+			k.signKey = priv
+			k.verifyKey = &priv.PublicKey
+		}
+		if key.PublicKey != "" {
+			pem, err := readPEM(key.PublicKey)
+			if err != nil {
+				return nil, err
+			}
+			pub, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+			if err != nil {
+				return nil, fmt.Errorf("etoken: parse signing key %s public key, err: %w", key.Kid, err)
+			}
+			k.verifyKey = pub
+		}
+	case *jwt.SigningMethodECDSA:
+		if key.PrivateKey != "" {
+			pem, err := readPEM(key.PrivateKey)
+			if err != nil {
+				return nil, err
+			}
+			priv, err := jwt.ParseECPrivateKeyFromPEM(pem)
+			if err != nil {
+				return nil, fmt.Errorf("etoken: parse signing key %s private key, err: %w", key.Kid, err)
+			}
+			k.signKey = priv
+			k.verifyKey = &priv.PublicKey
+		}
+		if key.PublicKey != "" {
+			pem, err := readPEM(key.PublicKey)
+			if err != nil {
+				return nil, err
+			}
+			pub, err := jwt.ParseECPublicKeyFromPEM(pem)
+			if err != nil {
+				return nil, fmt.Errorf("etoken: parse signing key %s public key, err: %w", key.Kid, err)
+			}
+			k.verifyKey = pub
+		}
+	default:
+		return nil, fmt.Errorf("etoken: unsupported signing algorithm %s", alg)
+	}
+	if k.verifyKey == nil {
+		return nil, fmt.Errorf("etoken: signing key %s has no private key or public key", key.Kid)
+	}
+	return k, nil
+}
+
+// readPEM 配置的是PEM内容时直接返回，否则作为文件路径读取
+func readPEM(value string) ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return []byte(value), nil
+	}
+	content, err := ioutil.ReadFile(value)
+	if err != nil {
+		return nil, fmt.Errorf("etoken: read pem file %s, err: %w", value, err)
+	}
+	return content, nil
+}
@@ -0,0 +1,168 @@
+package etoken
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testKeys 测试使用的RSA、ECDSA密钥，PEM格式
+type testKeys struct {
+	rsa        *rsa.PrivateKey
+	rsaPrivate string
+	rsaPublic  string
+	ec         *ecdsa.PrivateKey
+	ecPrivate  string
+	ecPublic   string
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaPublic, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecPrivate, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+	ecPublic, err := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	require.NoError(t, err)
+	return testKeys{
+		rsa:        rsaKey,
+		rsaPrivate: encodePEM("RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey)),
+		rsaPublic:  encodePEM("PUBLIC KEY", rsaPublic),
+		ec:         ecKey,
+		ecPrivate:  encodePEM("EC PRIVATE KEY", ecPrivate),
+		ecPublic:   encodePEM("PUBLIC KEY", ecPublic),
+	}
+}
+
+func encodePEM(typ string, der []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}))
+}
+
+// signToken 使用指定的算法、kid、密钥签发token
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	token := jwt.NewWithClaims(method, jwt.MapClaims{"sub": 1, "exp": time.Now().Add(time.Hour).Unix()})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	tokenStr, err := token.SignedString(key)
+	require.NoError(t, err)
+	return tokenStr
+}
+
+func TestParseSigningKey(t *testing.T) {
+	keys := newTestKeys(t)
+	publicFile := filepath.Join(t.TempDir(), "public.pem")
+	require.NoError(t, ioutil.WriteFile(publicFile, []byte(keys.rsaPublic), 0600))
+
+	tests := []struct {
+		name    string
+		key     SigningKey
+		alg     string
+		canSign bool
+		wantErr bool
+	}{
+		{name: "default hmac", key: SigningKey{Secret: "secret"}, alg: "HS256", canSign: true},
+		{name: "hmac", key: SigningKey{Algorithm: "HS512", Secret: "secret"}, alg: "HS512", canSign: true},
+		{name: "empty secret", key: SigningKey{Algorithm: "HS256"}, wantErr: true},
+		{name: "rsa private key", key: SigningKey{Algorithm: "RS256", PrivateKey: keys.rsaPrivate}, alg: "RS256", canSign: true},
+		{name: "rsa public key", key: SigningKey{Algorithm: "RS256", PublicKey: keys.rsaPublic}, alg: "RS256"},
+		{name: "rsa public key file", key: SigningKey{Algorithm: "PS256", PublicKey: publicFile}, alg: "PS256"},
+		{name: "ecdsa private key", key: SigningKey{Algorithm: "ES256", PrivateKey: keys.ecPrivate}, alg: "ES256", canSign: true},
+		{name: "ecdsa public key", key: SigningKey{Algorithm: "ES256", PublicKey: keys.ecPublic}, alg: "ES256"},
+		{name: "rsa without key", key: SigningKey{Algorithm: "RS256", Secret: "secret"}, wantErr: true},
+		{name: "rsa algorithm with ecdsa key", key: SigningKey{Algorithm: "RS256", PublicKey: keys.ecPublic}, wantErr: true},
+		{name: "ecdsa algorithm with rsa key", key: SigningKey{Algorithm: "ES256", PrivateKey: keys.rsaPrivate}, wantErr: true},
+		{name: "missing file", key: SigningKey{Algorithm: "RS256", PublicKey: "/not/exist.pem"}, wantErr: true},
+		{name: "unsupported algorithm", key: SigningKey{Algorithm: "none", Secret: "secret"}, wantErr: true},
+		{name: "unknown algorithm", key: SigningKey{Algorithm: "HS1", Secret: "secret"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := parseSigningKey(tt.key)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, k.method.Alg())
+			assert.Equal(t, tt.canSign, k.signKey != nil)
+			assert.NotNil(t, k.verifyKey)
+		})
+	}
+}
+
+func TestKeySet(t *testing.T) {
+	keys := newTestKeys(t)
+	s := newKeySet()
+	require.NoError(t, s.add(SigningKey{Kid: "v1", Secret: "secret"}, true))
+	// 只有公钥的密钥不能用于签发
+	assert.Error(t, s.add(SigningKey{Kid: "v2", Algorithm: "RS256", PublicKey: keys.rsaPublic}, true))
+	require.NoError(t, s.add(SigningKey{Kid: "v2", Algorithm: "RS256", PrivateKey: keys.rsaPrivate}, true))
+	assert.Equal(t, "v2", s.signingKey().kid)
+	assert.Len(t, s.list(), 2)
+
+	assert.Error(t, s.remove("v2"))
+	require.NoError(t, s.remove("v1"))
+	_, ok := s.get("v1")
+	assert.False(t, ok)
+	_, ok = s.get("v2")
+	assert.True(t, ok)
+}
+
+func TestKeyFunc(t *testing.T) {
+	keys := newTestKeys(t)
+	s := newKeySet()
+	require.NoError(t, s.add(SigningKey{Secret: "legacy"}, false))
+	require.NoError(t, s.add(SigningKey{Kid: "hmac", Secret: "secret"}, false))
+	require.NoError(t, s.add(SigningKey{Kid: "rsa", Algorithm: "RS256", PublicKey: keys.rsaPublic}, false))
+	require.NoError(t, s.add(SigningKey{Kid: "ec", Algorithm: "ES256", PublicKey: keys.ecPublic}, false))
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "legacy hmac without kid", token: signToken(t, jwt.SigningMethodHS256, "", []byte("legacy"))},
+		{name: "hmac", token: signToken(t, jwt.SigningMethodHS256, "hmac", []byte("secret"))},
+		{name: "rsa", token: signToken(t, jwt.SigningMethodRS256, "rsa", keys.rsa)},
+		{name: "ecdsa", token: signToken(t, jwt.SigningMethodES256, "ec", keys.ec)},
+		// 使用公开的公钥作为HMAC密钥伪造token
+		{name: "hs256 signed with rsa public key", token: signToken(t, jwt.SigningMethodHS256, "rsa", []byte(keys.rsaPublic)), wantErr: ErrAlgorithmMismatch},
+		{name: "hs256 signed with ecdsa public key", token: signToken(t, jwt.SigningMethodHS256, "ec", []byte(keys.ecPublic)), wantErr: ErrAlgorithmMismatch},
+		{name: "rs512 with rs256 key", token: signToken(t, jwt.SigningMethodRS512, "rsa", keys.rsa), wantErr: ErrAlgorithmMismatch},
+		{name: "ps256 with rs256 key", token: signToken(t, jwt.SigningMethodPS256, "rsa", keys.rsa), wantErr: ErrAlgorithmMismatch},
+		{name: "rs256 with hmac key", token: signToken(t, jwt.SigningMethodRS256, "hmac", keys.rsa), wantErr: ErrAlgorithmMismatch},
+		{name: "hs512 with hs256 key", token: signToken(t, jwt.SigningMethodHS512, "hmac", []byte("secret")), wantErr: ErrAlgorithmMismatch},
+		{name: "unknown kid", token: signToken(t, jwt.SigningMethodHS256, "unknown", []byte("secret")), wantErr: ErrKeyNotFound},
+		{name: "kid of another key", token: signToken(t, jwt.SigningMethodHS256, "hmac", []byte("legacy")), wantErr: jwt.ErrSignatureInvalid},
+		{name: "none", token: signToken(t, jwt.SigningMethodNone, "hmac", jwt.UnsafeAllowNoneSignatureType), wantErr: ErrAlgorithmMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := jwt.Parse(tt.token, keyFunc(s, nil))
+			if tt.wantErr == nil {
+				require.NoError(t, err)
+				assert.True(t, token.Valid)
+				return
+			}
+			require.Error(t, err)
+			ve, ok := err.(*jwt.ValidationError)
+			require.True(t, ok)
+			assert.Equal(t, tt.wantErr, ve.Inner)
+		})
+	}
+}
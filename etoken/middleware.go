@@ -0,0 +1,228 @@
+package etoken
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/gotomicro/ego/core/elog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ClaimsKey egin中通过c.Get(etoken.ClaimsKey)获取token的claims
+const ClaimsKey = "etoken.claims"
+
+var (
+	// ErrTokenMissing 请求没有携带token
+	ErrTokenMissing = errors.New("etoken: token missing")
+	// ErrPermissionDenied token没有接口需要的scope或者role
+	ErrPermissionDenied = errors.New("etoken: permission denied")
+)
+
+type claimsContextKey struct{}
+
+// ClaimsFromContext 获取中间件校验通过的token claims，egin使用c.Request.Context()
+func ClaimsFromContext(ctx context.Context) (map[string]interface{}, bool) {
+	claims, ok := ctx.Value(claimsContextKey{}).(map[string]interface{})
+	return claims, ok
+}
+
+// EginAuth egin中间件，根据Permissions校验token的scope、role。
+// token取自Authorization: Bearer {token}，token无效返回401，权限不足返回403。
+// 注意：没有配置权限的接口返回403，公开的接口需要配置Anonymous
+func (c *Component) EginAuth() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, err := c.authorizeRoute(ctx.Request.Context(), ctx.Request.Method+" "+ctx.FullPath(), bearerToken(ctx.GetHeader("Authorization")))
+		if err != nil {
+			code := http.StatusUnauthorized
+			if errors.Is(err, ErrPermissionDenied) {
+				code = http.StatusForbidden
+			}
+			ctx.AbortWithStatusJSON(code, gin.H{"code": code, "msg": err.Error()})
+			return
+		}
+		if claims == nil {
+			ctx.Next()
+			return
+		}
+		ctx.Set(ClaimsKey, claims)
+		ctx.Request = ctx.Request.WithContext(context.WithValue(ctx.Request.Context(), claimsContextKey{}, claims))
+		ctx.Next()
+	}
+}
+
+// EgrpcUnaryAuth egrpc unary拦截器，根据Permissions校验token的scope、role。
+// token取自metadata的authorization，token无效返回Unauthenticated，权限不足返回PermissionDenied。
+// 注意：没有配置权限的方法返回PermissionDenied，公开的方法需要配置Anonymous
+func (c *Component) EgrpcUnaryAuth() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := c.grpcAuthorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// EgrpcStreamAuth egrpc stream拦截器，与EgrpcUnaryAuth相同
+func (c *Component) EgrpcStreamAuth() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := c.grpcAuthorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type authServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (c *Component) grpcAuthorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	tokenStr := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			tokenStr = bearerToken(values[0])
+		}
+	}
+	claims, err := c.authorizeRoute(ctx, fullMethod, tokenStr)
+	if err != nil {
+		if errors.Is(err, ErrPermissionDenied) {
+			return ctx, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if claims == nil {
+		return ctx, nil
+	}
+	return context.WithValue(ctx, claimsContextKey{}, claims), nil
+}
+
+// authorizeRoute 根据接口的权限校验token。没有配置权限的接口拒绝访问，Anonymous的接口不校验token，返回的claims为nil
+func (c *Component) authorizeRoute(ctx context.Context, route string, tokenStr string) (map[string]interface{}, error) {
+	permission, ok := c.permission(route)
+	if !ok {
+		c.logger.Warn("permission not configured", elog.String("route", route))
+		return nil, ErrPermissionDenied
+	}
+	if permission.Anonymous {
+		return nil, nil
+	}
+	return c.authorize(ctx, tokenStr, permission)
+}
+
+// permission 获取接口需要的权限，没有配置时使用"*"
+func (c *Component) permission(route string) (Permission, bool) {
+	if permission, ok := c.config.Permissions[route]; ok {
+		return permission, true
+	}
+	permission, ok := c.config.Permissions["*"]
+	return permission, ok
+}
+
+// authorize 校验token，并检查scope、role。
+// 本服务签发的token会检查是否被吊销，其他签发方的token通过VerifyToken校验
+func (c *Component) authorize(ctx context.Context, tokenStr string, permission Permission) (map[string]interface{}, error) {
+	if tokenStr == "" {
+		return nil, ErrTokenMissing
+	}
+	var (
+		claims map[string]interface{}
+		err    error
+	)
+	if _, ok := c.issuers[tokenIssuer(tokenStr)]; ok || c.client == nil {
+		claims, err = c.VerifyToken(tokenStr)
+	} else {
+		claims, err = c.ValidateAccessToken(ctx, tokenStr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !hasAllScopes(claimStrings(claims, "scope", "scp"), permission.Scopes) ||
+		!hasAnyRole(claimStrings(claims, "roles", "role"), permission.Roles) {
+		c.logger.Warn("permission denied", elog.Any("sub", claims["sub"]), elog.Any("iss", claims["iss"]), elog.Any("permission", permission))
+		return nil, ErrPermissionDenied
+	}
+	return claims, nil
+}
+
+// bearerToken 去掉Bearer前缀
+func bearerToken(value string) string {
+	if len(value) > 7 && strings.EqualFold(value[:7], "bearer ") {
+		return strings.TrimSpace(value[7:])
+	}
+	return strings.TrimSpace(value)
+}
+
+// tokenIssuer 不校验签名，获取token的iss
+func tokenIssuer(tokenStr string) string {
+	token, _, err := new(jwt.Parser).ParseUnverified(tokenStr, jwt.MapClaims{})
+	if err != nil {
+		return ""
+	}
+	iss, _ := token.Claims.(jwt.MapClaims)["iss"].(string)
+	return iss
+}
+
+// claimStrings 获取字符串数组声明，字符串按空格分隔，多个key取第一个存在的
+func claimStrings(claims map[string]interface{}, keys ...string) []string {
+	for _, key := range keys {
+		switch v := claims[key].(type) {
+		case string:
+			return strings.Fields(v)
+		case []interface{}:
+			values := make([]string, 0, len(v))
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					values = append(values, s)
+				}
+			}
+			return values
+		case []string:
+			return v
+		}
+	}
+	return nil
+}
+
+func hasAllScopes(scopes []string, required []string) bool {
+	for _, r := range required {
+		if !containsString(scopes, r) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAnyRole(roles []string, required []string) bool {
+	if len(required) == 0 {
+		return true
+	}
+	for _, r := range required {
+		if containsString(roles, r) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
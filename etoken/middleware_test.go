@@ -0,0 +1,149 @@
+package etoken
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestTokenOptions(t *testing.T) {
+	c, _ := newTestComponent(t, nil)
+	now := time.Now().Unix()
+	token, err := c.EncodeAccessToken(1, 1, now, WithScopes("user:read", "user:write"), WithRoles("admin"))
+	require.NoError(t, err)
+	claims, err := c.DecodeAccessToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, "user:read user:write", claims["scope"])
+	assert.Equal(t, []string{"admin"}, claimStrings(claims, "roles", "role"))
+
+	// 没有设置时不包含scope、roles声明
+	token, err = c.EncodeAccessToken(1, 1, now, WithScopes(), WithRoles())
+	require.NoError(t, err)
+	claims, err = c.DecodeAccessToken(token)
+	require.NoError(t, err)
+	assert.NotContains(t, claims, "scope")
+	assert.NotContains(t, claims, "roles")
+
+	// 刷新时保留scope、roles
+	ticket, err := c.CreateAccessToken(2, now-10, WithScopes("user:read"), WithRoles("admin"))
+	require.NoError(t, err)
+	ticket, err = c.RefreshAccessToken(ticket.AccessToken, now)
+	require.NoError(t, err)
+	claims, err = c.ValidateAccessToken(context.Background(), ticket.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "user:read", claims["scope"])
+	assert.Equal(t, []string{"admin"}, claimStrings(claims, "roles", "role"))
+}
+
+// newAuthTestComponent 创建配置了接口权限的组件，返回uid 1、2、3的token，分别为user:read scope、admin role、没有权限
+func newAuthTestComponent(t *testing.T, permissions map[string]Permission) (*Component, []string) {
+	cfg := DefaultConfig()
+	cfg.Permissions = permissions
+	c, _ := newTestComponent(t, cfg)
+	now := time.Now().Unix()
+	tokens := make([]string, 0, 3)
+	for uid, options := range [][]TokenOption{{WithScopes("user:read")}, {WithRoles("admin")}, nil} {
+		ticket, err := c.CreateAccessToken(uid+1, now, options...)
+		require.NoError(t, err)
+		tokens = append(tokens, ticket.AccessToken)
+	}
+	return c, tokens
+}
+
+func TestEginAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, tokens := newAuthTestComponent(t, map[string]Permission{
+		"GET /public":       {Anonymous: true},
+		"GET /users/:id":    {Scopes: []string{"user:read"}},
+		"DELETE /users/:id": {Roles: []string{"admin", "owner"}},
+	})
+	r := gin.New()
+	r.Use(c.EginAuth())
+	handler := func(ctx *gin.Context) {
+		_, exists := ctx.Get(ClaimsKey)
+		_, ok := ClaimsFromContext(ctx.Request.Context())
+		assert.Equal(t, exists, ok)
+		ctx.Status(http.StatusOK)
+	}
+	r.GET("/public", handler)
+	r.GET("/users/:id", handler)
+	r.DELETE("/users/:id", handler)
+	r.GET("/other", handler)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		code   int
+	}{
+		{name: "anonymous", method: http.MethodGet, path: "/public", code: http.StatusOK},
+		{name: "not configured", method: http.MethodGet, path: "/other", token: tokens[0], code: http.StatusForbidden},
+		{name: "token missing", method: http.MethodGet, path: "/users/1", code: http.StatusUnauthorized},
+		{name: "invalid token", method: http.MethodGet, path: "/users/1", token: "invalid", code: http.StatusUnauthorized},
+		{name: "scope", method: http.MethodGet, path: "/users/1", token: tokens[0], code: http.StatusOK},
+		{name: "scope missing", method: http.MethodGet, path: "/users/1", token: tokens[2], code: http.StatusForbidden},
+		{name: "role", method: http.MethodDelete, path: "/users/1", token: tokens[1], code: http.StatusOK},
+		{name: "role missing", method: http.MethodDelete, path: "/users/1", token: tokens[0], code: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+			assert.Equal(t, tt.code, rec.Code)
+		})
+	}
+}
+
+func TestEgrpcUnaryAuth(t *testing.T) {
+	c, tokens := newAuthTestComponent(t, map[string]Permission{
+		"/user.User/Login": {Anonymous: true},
+		"/user.User/Get":   {Scopes: []string{"user:read"}},
+	})
+	interceptor := c.EgrpcUnaryAuth()
+	call := func(method string, token string) (map[string]interface{}, error) {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+		}
+		var claims map[string]interface{}
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			claims, _ = ClaimsFromContext(ctx)
+			return nil, nil
+		})
+		return claims, err
+	}
+
+	claims, err := call("/user.User/Login", "")
+	require.NoError(t, err)
+	assert.Nil(t, claims)
+	_, err = call("/user.User/Delete", tokens[0])
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = call("/user.User/Get", "")
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = call("/user.User/Get", tokens[2])
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	claims, err = call("/user.User/Get", tokens[0])
+	require.NoError(t, err)
+	assert.Equal(t, "user:read", claims["scope"])
+
+	// "*"用于没有配置的方法
+	c.config.Permissions["*"] = Permission{}
+	claims, err = call("/user.User/Delete", tokens[2])
+	require.NoError(t, err)
+	assert.NotNil(t, claims)
+}
@@ -0,0 +1,135 @@
+package etoken
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// revokedTokenKeyPattern 被吊销的token，jti:iat
+	revokedTokenKeyPattern = "/revoked/token/%s"
+	// revokedUserKeyPattern 用户吊销所有token的时间，iat不晚于该时间的token无效
+	revokedUserKeyPattern = "/revoked/user/%d"
+)
+
+// revokeTokenScript 将token加入黑名单，存储的token与被吊销的token相同时删除，避免Get、Del之间误删新签发的token。
+// KEYS[1]为黑名单，KEYS[2]为存储的token；ARGV[1]为吊销时间，ARGV[2]为黑名单的过期时间（毫秒），ARGV[3]为被吊销的token
+var revokeTokenScript = redis.NewScript(`
+redis.call("set", KEYS[1], ARGV[1], "px", ARGV[2])
+if redis.call("get", KEYS[2]) == ARGV[3] then
+	redis.call("del", KEYS[2])
+end
+return 1
+`)
+
+var (
+	// ErrTokenRevoked token已经被吊销
+	ErrTokenRevoked = errors.New("etoken: token revoked")
+	// ErrTokenNotFound token不在存储中，如已经过期或者被新的token替换
+	ErrTokenNotFound = errors.New("etoken: token not found")
+)
+
+// ValidateAccessToken 校验token的签名、有效期，以及是否被吊销，成功时返回claims。
+// 存储中的token必须与tokenStr相同，被同一用户新签发的token替换后返回ErrTokenNotFound
+func (c *Component) ValidateAccessToken(ctx context.Context, tokenStr string) (map[string]interface{}, error) {
+	sc, err := c.DecodeAccessToken(tokenStr)
+	if err != nil {
+		return nil, err
+	}
+	uid, _ := claimInt64(sc, "sub")
+	iat, _ := claimInt64(sc, "iat")
+	values, err := c.client.MGet(ctx,
+		c.tokenKey(sc),
+		fmt.Sprintf(c.config.TokenPrefix+revokedTokenKeyPattern, tokenID(sc)),
+		fmt.Sprintf(c.config.TokenPrefix+revokedUserKeyPattern, uid),
+	).Result()
+	if err != nil {
+		return nil, fmt.Errorf("check token error %w", err)
+	}
+	if stored, ok := values[0].(string); !ok || stored != tokenStr {
+		return nil, ErrTokenNotFound
+	}
+	if values[1] != nil {
+		return nil, ErrTokenRevoked
+	}
+	if values[2] != nil {
+		revokedAt, _ := strconv.ParseInt(fmt.Sprint(values[2]), 10, 64)
+		// iat只精确到秒，吊销后同一秒内重新登录签发的token有效；
+		// 同一秒内吊销前签发的token已经被RevokeAllForUser从存储中删除，上面的检查会拒绝
+		if iat < revokedAt {
+			return nil, ErrTokenRevoked
+		}
+	}
+	return sc, nil
+}
+
+// Revoke 吊销token，用于退出登录；黑名单的过期时间为token的剩余有效期，已经过期的token不需要吊销
+func (c *Component) Revoke(ctx context.Context, tokenStr string) error {
+	sc, err := c.DecodeAccessToken(tokenStr)
+	var ve *jwt.ValidationError
+	if errors.As(err, &ve) && ve.Errors&jwt.ValidationErrorExpired != 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	exp, _ := claimInt64(sc, "exp")
+	ttl := time.Until(time.Unix(exp, 0))
+	if ttl <= 0 {
+		return nil
+	}
+	// 只删除与当前token相同的存储，避免误删新签发的token
+	err = revokeTokenScript.Run(ctx, c.client,
+		[]string{fmt.Sprintf(c.config.TokenPrefix+revokedTokenKeyPattern, tokenID(sc)), c.tokenKey(sc)},
+		time.Now().Unix(), ttl.Milliseconds(), tokenStr,
+	).Err()
+	if err != nil {
+		return fmt.Errorf("revoke token error %w", err)
+	}
+	return nil
+}
+
+// RevokeAllForUser 吊销用户在此之前签发的所有token，用于修改密码、账号被盗等场景
+func (c *Component) RevokeAllForUser(ctx context.Context, uid int) error {
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, fmt.Sprintf(c.config.TokenPrefix+revokedUserKeyPattern, uid), time.Now().Unix(), time.Duration(c.config.AccessTokenExpireInterval)*time.Second)
+		pipe.Del(ctx, fmt.Sprintf(c.config.TokenPrefix+tokenKeyPattern, uid))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("revoke user token error %w", err)
+	}
+	return nil
+}
+
+// tokenKey token在redis中的key，CreateAccessToken使用uid作为jti
+func (c *Component) tokenKey(sc map[string]interface{}) string {
+	jti, _ := claimInt64(sc, "jti")
+	return fmt.Sprintf(c.config.TokenPrefix+tokenKeyPattern, jti)
+}
+
+// tokenID 唯一标识一个token，jti为uid时同一用户的token通过签发时间区分
+func tokenID(sc map[string]interface{}) string {
+	jti, _ := claimInt64(sc, "jti")
+	iat, _ := claimInt64(sc, "iat")
+	return fmt.Sprintf("%d:%d", jti, iat)
+}
+
+// claimInt64 jwt解析出的数字为float64
+func claimInt64(sc map[string]interface{}, key string) (int64, bool) {
+	switch v := sc[key].(type) {
+	case float64:
+		return int64(v), true
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,93 @@
+package etoken
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAccessToken(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestComponent(t, nil)
+	now := time.Now().Unix()
+
+	old, err := c.CreateAccessToken(1, now-10)
+	require.NoError(t, err)
+	sc, err := c.ValidateAccessToken(ctx, old.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), sc["sub"])
+
+	// 同一用户重新签发后，原来的token被替换
+	latest, err := c.CreateAccessToken(1, now)
+	require.NoError(t, err)
+	_, err = c.ValidateAccessToken(ctx, old.AccessToken)
+	assert.Equal(t, ErrTokenNotFound, err)
+	_, err = c.ValidateAccessToken(ctx, latest.AccessToken)
+	assert.NoError(t, err)
+
+	// 没有存储的token
+	token, err := c.EncodeAccessToken(2, 2, now)
+	require.NoError(t, err)
+	_, err = c.ValidateAccessToken(ctx, token)
+	assert.Equal(t, ErrTokenNotFound, err)
+}
+
+func TestRevoke(t *testing.T) {
+	ctx := context.Background()
+	c, mr := newTestComponent(t, nil)
+	now := time.Now().Unix()
+
+	old, err := c.CreateAccessToken(1, now-10)
+	require.NoError(t, err)
+	latest, err := c.CreateAccessToken(1, now)
+	require.NoError(t, err)
+
+	// 吊销旧的token不会删除新签发的token
+	require.NoError(t, c.Revoke(ctx, old.AccessToken))
+	_, err = c.ValidateAccessToken(ctx, latest.AccessToken)
+	assert.NoError(t, err)
+
+	require.NoError(t, c.Revoke(ctx, latest.AccessToken))
+	_, err = c.ValidateAccessToken(ctx, latest.AccessToken)
+	assert.Error(t, err)
+	assert.False(t, c.CheckAccessToken(latest.AccessToken))
+	assert.False(t, mr.Exists(c.config.TokenPrefix+"/token/1"))
+	// 黑名单的过期时间为token的剩余有效期
+	ttl := mr.TTL(c.config.TokenPrefix + "/revoked/token/" + tokenID(map[string]interface{}{"jti": float64(1), "iat": float64(now)}))
+	assert.InDelta(t, float64(c.config.AccessTokenExpireInterval), ttl.Seconds(), 2)
+
+	// 已经过期的token不需要吊销
+	expired, err := c.EncodeAccessToken(1, 1, now-2*c.config.AccessTokenExpireInterval)
+	require.NoError(t, err)
+	assert.NoError(t, c.Revoke(ctx, expired))
+}
+
+func TestRevokeAllForUser(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestComponent(t, nil)
+	now := time.Now().Unix()
+
+	before, err := c.CreateAccessToken(1, now-1)
+	require.NoError(t, err)
+	other, err := c.CreateAccessToken(2, now-1)
+	require.NoError(t, err)
+	require.NoError(t, c.RevokeAllForUser(ctx, 1))
+	_, err = c.ValidateAccessToken(ctx, before.AccessToken)
+	assert.Error(t, err)
+	_, err = c.ValidateAccessToken(ctx, other.AccessToken)
+	assert.NoError(t, err)
+
+	// 吊销后同一秒内重新登录签发的token有效
+	after, err := c.CreateAccessToken(1, time.Now().Unix())
+	require.NoError(t, err)
+	_, err = c.ValidateAccessToken(ctx, after.AccessToken)
+	assert.NoError(t, err)
+
+	// 吊销之前签发的token即使重新写入存储也无效
+	require.NoError(t, c.client.Set(ctx, c.config.TokenPrefix+"/token/1", before.AccessToken, time.Minute).Err())
+	_, err = c.ValidateAccessToken(ctx, before.AccessToken)
+	assert.Equal(t, ErrTokenRevoked, err)
+}